@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package guestio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aibor/virtrun/sysinit"
+)
+
+// ErrConsoleNotFound is returned if no console with the given name is given
+// by the host.
+var ErrConsoleNotFound = errors.New("console not found")
+
+// ConsolePath returns the device path of the additional console with the
+// given name, like "/dev/hvc1". The name is the one the console is given on
+// the host, like with flag "-console trace=trace.log". Unlike device names,
+// names do not depend on the transport type and the other consoles.
+func ConsolePath(name string) (string, error) {
+	params, err := sysinit.ReadCmdline()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	path, exists := params.Consoles()[name]
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrConsoleNotFound, name)
+	}
+
+	return path, nil
+}
+
+// OpenConsole opens the additional console with the given name for writing.
+// See [ConsolePath].
+func OpenConsole(name string) (*os.File, error) {
+	path, err := ConsolePath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(path, os.O_WRONLY, 0) //nolint:wrapcheck
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package guestio provides output channels to the host for binaries running in
+// a virtrun guest.
+//
+// Named consoles given on the host are found with [ConsolePath] and
+// [OpenConsole].
+//
+// Streams work in standalone mode only. They are sent on the control console
+// of the init, so virtrun must run with the control console enabled (flag
+// "-control"). As the init owns the console, streams are available only in the
+// process that runs [sysinit.Main], not in processes it starts.
+package guestio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aibor/virtrun/internal/hostconn"
+	"github.com/aibor/virtrun/sysinit"
+)
+
+// ErrNotAvailable is returned if no connection to the host is available.
+var ErrNotAvailable = errors.New("host streams not available")
+
+// Create opens a new stream to the host with the given name. virtrun writes
+// the data of the stream into a file with the name as path relative to its
+// artifact directory. Existing files are overwritten.
+//
+// Multiple streams can be open at the same time. The stream must be closed
+// once all data is written, so the host can verify it is complete.
+func Create(name string) (io.WriteCloser, error) {
+	conn := hostconn.Get()
+	if conn == nil {
+		return nil, ErrNotAvailable
+	}
+
+	stream, err := conn.Writer().OpenStream(sysinit.FileStreamPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+
+	return stream, nil
+}
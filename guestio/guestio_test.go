@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package guestio_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/aibor/virtrun/guestio"
+	"github.com/aibor/virtrun/internal/hostconn"
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopCloser struct {
+	bytes.Buffer
+}
+
+func (*nopCloser) Close() error {
+	return nil
+}
+
+func TestCreate(t *testing.T) {
+	t.Run("not available", func(t *testing.T) {
+		_, err := guestio.Create("report.txt")
+		assert.ErrorIs(t, err, guestio.ErrNotAvailable)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var output bytes.Buffer
+
+		hostconn.Set(pipe.NewConn(&output))
+		t.Cleanup(func() { hostconn.Set(nil) })
+
+		stream, err := guestio.Create("report.txt")
+		require.NoError(t, err)
+
+		_, err = io.WriteString(stream, "report")
+		require.NoError(t, err)
+		require.NoError(t, stream.Close())
+
+		received := map[string]*nopCloser{}
+
+		err = pipe.ReceiveStreams(&output, func(
+			name string,
+		) (io.WriteCloser, error) {
+			received[name] = &nopCloser{}
+			return received[name], nil
+		})
+		require.NoError(t, err)
+
+		require.Contains(t, received, sysinit.FileStreamPrefix+"report.txt")
+		assert.Equal(t, "report",
+			received[sysinit.FileStreamPrefix+"report.txt"].String())
+	})
+}
+
+func TestConsolePath_NotFound(t *testing.T) {
+	// The host's kernel command line has no named consoles.
+	_, err := guestio.ConsolePath("trace")
+	require.ErrorIs(t, err, guestio.ErrConsoleNotFound)
+
+	_, err = guestio.OpenConsole("trace")
+	require.ErrorIs(t, err, guestio.ErrConsoleNotFound)
+}
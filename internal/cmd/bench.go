@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/aibor/virtrun/sysinit"
+)
+
+const (
+	// defaultBenchCount is the default number of runs of the bench
+	// subcommand.
+	defaultBenchCount = 5
+
+	// defaultBenchEchoCount is the default number of round trips measured
+	// per run of the bench subcommand.
+	defaultBenchEchoCount = 10
+)
+
+// benchSample are the measurements of a single run of the bench subcommand.
+type benchSample struct {
+	// initramfs is the time it took to build the initramfs archive.
+	initramfs time.Duration
+
+	// boot is the time until the init was started by the kernel.
+	boot time.Duration
+
+	// echo is the median round trip time on the control console.
+	echo time.Duration
+
+	// total is the time QEMU ran.
+	total time.Duration
+}
+
+// benchMeasurements are the names of the measurements of a [benchSample] in
+// the order of [benchSample.values].
+var benchMeasurements = []string{
+	"initramfs build",
+	"boot to init",
+	"echo round trip",
+	"total",
+}
+
+// values returns the measurements of the sample in the order of
+// [benchMeasurements].
+func (s benchSample) values() []time.Duration {
+	return []time.Duration{s.initramfs, s.boot, s.echo, s.total}
+}
+
+// newBenchSample returns the [benchSample] of the given [virtrun.RunResult].
+func newBenchSample(result *virtrun.RunResult) benchSample {
+	sample := benchSample{
+		initramfs: result.InitramfsDuration,
+		echo:      median(result.EchoRoundTrips),
+		total:     result.Duration,
+	}
+
+	for _, state := range result.States {
+		if sysinit.State(state.State) == sysinit.StateBooted {
+			sample.boot = state.Elapsed
+		}
+	}
+
+	return sample
+}
+
+// bench runs the given binary multiple times, one after the other, and
+// prints the minimum, median and maximum of the time it took to build the
+// initramfs, to boot the guest until the init runs, of the round trips on the
+// control console and of the whole run. The output of the guest is discarded.
+// Log records have the number of the run as attribute "run".
+func bench(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		count     uint64 = defaultBenchCount
+		echoCount uint64 = defaultBenchEchoCount
+	)
+
+	flags := newBenchFlags(args[0], stderr, &count, &echoCount)
+
+	err := flags.ParseArgs(PrependEnvArgs(args[1:]))
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	err = Validate(flags.spec)
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+
+	setupLogging(stderr, flags.LogLevel(), flags.LogFormat())
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	samples := make([]benchSample, 0, count)
+
+	for run := range count {
+		// Each run gets its own copy, as running modifies the spec.
+		spec := *flags.spec
+		spec.Qemu.EchoCount = int(echoCount)
+
+		logger := slog.With(slog.Uint64("run", run+1))
+
+		result, err := runWithTimeouts(ctx, flags, &spec, nil, io.Discard,
+			logger)
+		if err != nil {
+			return fmt.Errorf("run %d: %w", run+1, err)
+		}
+
+		samples = append(samples, newBenchSample(result))
+	}
+
+	writeBenchSummary(stdout, samples)
+
+	return nil
+}
+
+// newBenchFlags returns [flags] with the additional flags "-count" and
+// "-echoCount" that set the given values.
+func newBenchFlags(
+	name string,
+	output io.Writer,
+	count, echoCount *uint64,
+) *flags {
+	flags := newFlags(name, output)
+	flags.flagSet.Init(name+" [flags...] binary [initargs...]",
+		flag.ContinueOnError)
+	flags.flagSet.Var(
+		&limitedUintValue{
+			Value: count,
+			min:   1,
+		},
+		"count",
+		"number of runs to measure",
+	)
+	flags.flagSet.Var(
+		&limitedUintValue{
+			Value: echoCount,
+			min:   1,
+		},
+		"echoCount",
+		"number of round trips on the control console to measure per run",
+	)
+
+	return flags
+}
+
+// writeBenchSummary writes a table with the minimum, median and maximum of
+// each measurement of the given samples to w.
+func writeBenchSummary(w io.Writer, samples []benchSample) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(table, "MEASUREMENT (%d RUNS)\tMIN\tMEDIAN\tMAX\n",
+		len(samples))
+
+	for idx, name := range benchMeasurements {
+		values := make([]time.Duration, len(samples))
+		for sampleIdx, sample := range samples {
+			values[sampleIdx] = sample.values()[idx]
+		}
+
+		slices.Sort(values)
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n",
+			name,
+			formatBenchDuration(values[0]),
+			formatBenchDuration(median(values)),
+			formatBenchDuration(values[len(values)-1]),
+		)
+	}
+
+	_ = table.Flush()
+}
+
+// formatBenchDuration returns the given duration rounded to microseconds,
+// which is precise enough for the measurements.
+func formatBenchDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
+
+// median returns the median of the given durations. It returns 0 if there
+// are none.
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := slices.Sorted(slices.Values(durations))
+	mid := len(sorted) / 2
+
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+
+	return sorted[mid]
+}
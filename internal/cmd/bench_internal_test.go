@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBenchSample(t *testing.T) {
+	result := &virtrun.RunResult{
+		InitramfsDuration: 20 * time.Millisecond,
+		Duration:          time.Second,
+		EchoRoundTrips: []time.Duration{
+			3 * time.Millisecond,
+			time.Millisecond,
+			2 * time.Millisecond,
+		},
+		States: []qemu.StateChange{
+			{State: string(sysinit.StateBooted), Elapsed: 300 * time.Millisecond},
+			{State: string(sysinit.StateMainStarted), Elapsed: time.Second},
+		},
+	}
+
+	expected := benchSample{
+		initramfs: 20 * time.Millisecond,
+		boot:      300 * time.Millisecond,
+		echo:      2 * time.Millisecond,
+		total:     time.Second,
+	}
+	assert.Equal(t, expected, newBenchSample(result))
+}
+
+func TestWriteBenchSummary(t *testing.T) {
+	samples := []benchSample{
+		{
+			initramfs: 30 * time.Millisecond,
+			boot:      400 * time.Millisecond,
+			echo:      200 * time.Microsecond,
+			total:     time.Second,
+		},
+		{
+			initramfs: 10 * time.Millisecond,
+			boot:      200 * time.Millisecond,
+			echo:      100 * time.Microsecond,
+			total:     800 * time.Millisecond,
+		},
+	}
+
+	var buf bytes.Buffer
+
+	writeBenchSummary(&buf, samples)
+
+	expected := "" +
+		"MEASUREMENT (2 RUNS)  MIN    MEDIAN  MAX\n" +
+		"initramfs build       10ms   20ms    30ms\n" +
+		"boot to init          200ms  300ms   400ms\n" +
+		"echo round trip       100µs  150µs   200µs\n" +
+		"total                 800ms  900ms   1s\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		expected  time.Duration
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:      "odd",
+			durations: []time.Duration{3, 1, 2},
+			expected:  2,
+		},
+		{
+			name:      "even",
+			durations: []time.Duration{40, 10, 30, 20},
+			expected:  25,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, median(tt.durations))
+		})
+	}
+}
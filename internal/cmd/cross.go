@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/internal/tempdir"
+)
+
+// crossBuild defines how test binaries are built for the guest.
+type crossBuild struct {
+	arch    sys.Arch
+	tags    string
+	ldflags string
+	cgo     bool
+}
+
+// addFlags adds the flags for building test binaries to the given
+// [flag.FlagSet].
+func (b *crossBuild) addFlags(fs *flag.FlagSet) {
+	fs.Var(
+		&b.arch,
+		"arch",
+		"architecture to build the test binaries for (default is the host "+
+			"arch)",
+	)
+
+	fs.StringVar(
+		&b.tags,
+		"tags",
+		b.tags,
+		"comma separated list of build tags, passed to \"go test -tags\"",
+	)
+
+	fs.StringVar(
+		&b.ldflags,
+		"ldflags",
+		b.ldflags,
+		"linker flags, passed to \"go test -ldflags\"",
+	)
+
+	fs.BoolVar(
+		&b.cgo,
+		"cgo",
+		b.cgo,
+		"build with cgo enabled. The C compiler for the arch must be set "+
+			"by environment variable CC.",
+	)
+}
+
+// command returns the command that builds the test binaries of the given
+// packages into the given directory.
+func (b *crossBuild) command(
+	ctx context.Context,
+	dir string,
+	packages []string,
+) *exec.Cmd {
+	args := []string{"test", "-c", "-o", dir + string(filepath.Separator)}
+
+	if b.tags != "" {
+		args = append(args, "-tags", b.tags)
+	}
+
+	if b.ldflags != "" {
+		args = append(args, "-ldflags", b.ldflags)
+	}
+
+	args = append(args, packages...)
+
+	cgo := "0"
+	if b.cgo {
+		cgo = "1"
+	}
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Env = append(os.Environ(),
+		"GOOS=linux",
+		"GOARCH="+b.arch.String(),
+		"CGO_ENABLED="+cgo,
+	)
+
+	return cmd
+}
+
+// build builds the test binaries of the given packages into the given
+// directory and returns their paths. Packages without tests have no binary.
+// The output of the go command is written to the given writer.
+func (b *crossBuild) build(
+	ctx context.Context,
+	dir string,
+	packages []string,
+	output io.Writer,
+) ([]string, error) {
+	cmd := b.command(ctx, dir, packages)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("go test -c: %w", err)
+	}
+
+	binaries, err := filepath.Glob(filepath.Join(dir, "*.test"))
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if len(binaries) == 0 {
+		return nil, ErrNoTestBinaries
+	}
+
+	slices.Sort(binaries)
+
+	return binaries, nil
+}
+
+// splitCrossArgs splits the given positional arguments into packages and
+// arguments for the test binaries, which follow "--".
+func splitCrossArgs(args []string) ([]string, []string) {
+	idx := slices.Index(args, "--")
+	if idx < 0 {
+		return args, []string{}
+	}
+
+	return args[:idx], args[idx+1:]
+}
+
+// cross builds the test binaries of the given packages for the architecture
+// given by flag "-arch" and runs each in its own guest, like [parallel] does.
+// Arguments after "--" are passed to each test binary.
+func cross(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var summary summaryFiles
+
+	build := crossBuild{arch: sys.Native}
+	jobs := uint64(runtime.NumCPU())
+
+	flags := newFlags(args[0], stderr)
+	flags.flagSet.Init(args[0]+" [flags...] package... [-- test args...]",
+		flag.ContinueOnError)
+	addJobsFlag(flags.flagSet, &jobs)
+	summary.addFlags(flags.flagSet)
+	build.addFlags(flags.flagSet)
+
+	err := flags.ParseArgs(PrependEnvArgs(args[1:]))
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	err = flags.checkMultipleRuns()
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	packages, testArgs := splitCrossArgs(flags.flagSet.Args())
+	if len(packages) == 0 {
+		return fmt.Errorf("parse args: %w", flags.fail("no package given", nil))
+	}
+
+	setupLogging(stderr, flags.LogLevel(), flags.LogFormat())
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	dir, err := tempdir.Create("")
+	if err != nil {
+		return fmt.Errorf("temp dir: %w", err)
+	}
+	defer dir.Remove() //nolint:errcheck
+
+	binaries, err := build.build(ctx, dir.Path(), packages, stderr)
+	if err != nil {
+		return fmt.Errorf("build: %w", err)
+	}
+
+	specs, err := binarySpecs(flags, binaries, testArgs)
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	for _, spec := range specs {
+		err = Validate(spec)
+		if err != nil {
+			return fmt.Errorf("validate: %w", err)
+		}
+	}
+
+	summaries := runParallel(ctx, flags, specs, jobs, stdout)
+
+	err = summary.write(summaries)
+	if err != nil {
+		return err
+	}
+
+	return newParallelError(summaries)
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrossBuild_Command(t *testing.T) {
+	tests := []struct {
+		name         string
+		build        crossBuild
+		expectedArgs []string
+		expectedEnv  []string
+	}{
+		{
+			name:  "default",
+			build: crossBuild{arch: sys.ARM64},
+			expectedArgs: []string{
+				"go", "test", "-c", "-o", "/tmp/bin/", "./...",
+			},
+			expectedEnv: []string{
+				"GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=0",
+			},
+		},
+		{
+			name: "all",
+			build: crossBuild{
+				arch:    sys.RISCV64,
+				tags:    "integration,linux",
+				ldflags: "-X main.version=1",
+				cgo:     true,
+			},
+			expectedArgs: []string{
+				"go", "test", "-c", "-o", "/tmp/bin/",
+				"-tags", "integration,linux",
+				"-ldflags", "-X main.version=1",
+				"./...",
+			},
+			expectedEnv: []string{
+				"GOOS=linux", "GOARCH=riscv64", "CGO_ENABLED=1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := tt.build.command(context.Background(), "/tmp/bin",
+				[]string{"./..."})
+
+			assert.Equal(t, tt.expectedArgs, cmd.Args)
+			assert.Subset(t, cmd.Env, tt.expectedEnv)
+		})
+	}
+}
+
+func TestCrossBuild_Build(t *testing.T) {
+	src := t.TempDir()
+	testFile := "package b\n\nimport \"testing\"\n\nfunc TestB(*testing.T) {}\n"
+
+	for name, content := range map[string]string{
+		"go.mod":      "module example.com/cross\n\ngo 1.23\n",
+		"a/a.go":      "package a\n",
+		"b/b.go":      "package b\n",
+		"b/b_test.go": testFile,
+	} {
+		path := filepath.Join(src, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(src))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	build := crossBuild{arch: sys.Native}
+	dir := t.TempDir()
+
+	binaries, err := build.build(context.Background(), dir,
+		[]string{"./..."}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "b.test")}, binaries)
+
+	_, err = build.build(context.Background(), t.TempDir(),
+		[]string{"./a"}, io.Discard)
+	require.ErrorIs(t, err, ErrNoTestBinaries)
+}
+
+func TestSplitCrossArgs(t *testing.T) {
+	packages, args := splitCrossArgs([]string{"./a", "./b/...", "--", "-x"})
+	assert.Equal(t, []string{"./a", "./b/..."}, packages)
+	assert.Equal(t, []string{"-x"}, args)
+
+	packages, args = splitCrossArgs([]string{"./a"})
+	assert.Equal(t, []string{"./a"}, packages)
+	assert.Empty(t, args)
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// debugToolValue is a command the binary is run under in the guest, like
+// "strace -f -o /tmp/debug/trace". The tool is looked up in the host's PATH
+// and added to the initramfs along with its shared libraries.
+type debugToolValue struct {
+	spec *virtrun.Spec
+	cmd  string
+}
+
+func (d *debugToolValue) String() string {
+	return d.cmd
+}
+
+func (d *debugToolValue) Set(s string) error {
+	if d.cmd != "" {
+		return fmt.Errorf("%w: given more than once", ErrInvalidDebugTool)
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: empty", ErrInvalidDebugTool)
+	}
+
+	// The command is passed to the guest as list separated by semicolons.
+	if strings.Contains(s, ";") {
+		return fmt.Errorf("%w: contains \";\": %s", ErrInvalidDebugTool, s)
+	}
+
+	path, err := exec.LookPath(fields[0])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidDebugTool, err)
+	}
+
+	path, err = AbsoluteFilePath(path)
+	if err != nil {
+		return err
+	}
+
+	d.cmd = s
+	d.spec.Initramfs.Files = append(d.spec.Initramfs.Files, path)
+	d.spec.Qemu.DebugTool = append(
+		[]string{virtrun.DataFilePath(path)},
+		fields[1:]...,
+	)
+
+	return nil
+}
@@ -0,0 +1,427 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+
+	cpuinfoFile = "/proc/cpuinfo"
+	meminfoFile = "/proc/meminfo"
+)
+
+// checkResult is the result of a single check of [doctor].
+type checkResult struct {
+	name   string
+	status string
+	msg    string
+
+	// hint tells how to fix a warning or failure.
+	hint string
+}
+
+// doctor checks if the host can run guests for the given architecture and
+// prints the result of each check with a hint how to fix it. It checks the
+// QEMU binary, KVM access, nested virtualization, the kernel, its build config
+// and the available memory. It fails if any check failed. Warnings do not
+// prevent running guests, but make them slow.
+func doctor(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		arch         = sys.Native
+		kernel       string
+		kernelConfig string
+		executable   string
+		memory       uint64 = memDefault
+	)
+
+	fs := flag.NewFlagSet(args[0]+" [flags...] [binary]", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.Var(
+		&arch,
+		"arch",
+		"architecture of the guest. (default is the one of the given "+
+			"binary or the host arch)",
+	)
+
+	fs.Var(
+		(*KernelPath)(&kernel),
+		"kernel",
+		"path to the kernel to check, or reference to a cached kernel",
+	)
+
+	fs.Var(
+		(*FilePath)(&kernelConfig),
+		"kernelConfig",
+		"kernel build config file to check (default is the config-VERSION "+
+			"file next to the kernel or the config embedded into it)",
+	)
+
+	fs.StringVar(
+		&executable,
+		"qemu-bin",
+		executable,
+		"QEMU binary to check (default depends on arch)",
+	)
+
+	fs.Var(
+		&limitedUintValue{
+			Value: &memory,
+			min:   memMin,
+			max:   memMax,
+		},
+		"memory",
+		"memory (in MB) the guest needs",
+	)
+
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return &ParseArgsError{msg: "flag parse", err: err}
+	}
+
+	if fs.NArg() > 1 {
+		err := &ParseArgsError{msg: "at most one binary expected"}
+		fmt.Fprintln(stderr, err.Error())
+		fs.Usage()
+
+		return err
+	}
+
+	if fs.NArg() == 1 {
+		arch, err = sys.ReadELFArch(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("binary arch: %w", err)
+		}
+	}
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	kvm := checkKVM(arch)
+	results := []checkResult{
+		checkQemu(ctx, arch, executable),
+		kvm,
+		checkNested(readCheckFile(cpuinfoFile), kvm.status == checkOK),
+		checkKernel(kernel, arch),
+		checkKernelConfig(kernel, kernelConfig, arch),
+		checkMemory(readCheckFile(meminfoFile), memory),
+	}
+
+	if printCheckResults(stdout, results) {
+		return ErrEnvironmentCheckFailed
+	}
+
+	return nil
+}
+
+// printCheckResults prints the given results with their hints. It returns
+// true if any check failed.
+func printCheckResults(w io.Writer, results []checkResult) bool {
+	failed := false
+
+	for _, result := range results {
+		fmt.Fprintf(w, "%-4s  %s: %s\n",
+			result.status, result.name, result.msg)
+
+		if result.hint != "" {
+			fmt.Fprintf(w, "      hint: %s\n", result.hint)
+		}
+
+		failed = failed || result.status == checkFail
+	}
+
+	return failed
+}
+
+// readCheckFile returns the content of the file at the given path or nil, if
+// it can not be read.
+func readCheckFile(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// checkQemu checks if the given QEMU binary can be run. If it is empty, the
+// default binary for the given arch is checked.
+func checkQemu(
+	ctx context.Context,
+	arch sys.Arch,
+	executable string,
+) checkResult {
+	result := checkResult{name: "qemu"}
+
+	if executable == "" {
+		var spec virtrun.Qemu
+
+		err := spec.AddDefaultsFor(arch)
+		if err != nil {
+			result.status = checkFail
+			result.msg = err.Error()
+
+			return result
+		}
+
+		executable = spec.Executable
+	}
+
+	version, err := qemuVersion(ctx, executable)
+	if err != nil {
+		result.status = checkFail
+		result.msg = fmt.Sprintf("%s: %v", executable, err)
+		result.hint = fmt.Sprintf("install the QEMU system emulator for %s "+
+			"or set the binary with -qemu-bin", arch)
+
+		return result
+	}
+
+	result.status = checkOK
+	result.msg = executable + ": " + version
+
+	return result
+}
+
+// checkKVM checks if KVM can run guests of the given arch. Without KVM,
+// guests are emulated, which is slow but works.
+func checkKVM(arch sys.Arch) checkResult {
+	result := checkResult{name: "kvm"}
+
+	err := arch.CheckKVM()
+	if err == nil {
+		result.status = checkOK
+		result.msg = sys.KVMDevice + " can run " + arch.String() + " guests"
+
+		return result
+	}
+
+	result.status = checkWarn
+	result.msg = fmt.Sprintf("guests are emulated: %v", err)
+	result.hint = kvmHint(err)
+
+	return result
+}
+
+// kvmHint returns a hint how to fix the given error of [sys.Arch.CheckKVM].
+func kvmHint(err error) string {
+	switch {
+	case errors.Is(err, sys.ErrKVMForeignArch):
+		return ""
+	case errors.Is(err, os.ErrNotExist):
+		return "enable virtualization in the firmware settings and load " +
+			"the kvm module of the CPU, like kvm_intel or kvm_amd"
+	case errors.Is(err, os.ErrPermission):
+		return "add the user to the group owning " + sys.KVMDevice +
+			", usually kvm, and log in again"
+	default:
+		return "make sure no other hypervisor occupies the virtualization " +
+			"extensions of the CPU"
+	}
+}
+
+// checkNested checks if the host runs in a virtual machine, based on the
+// given content of /proc/cpuinfo. If it does, KVM requires nested
+// virtualization.
+func checkNested(cpuinfo []byte, kvm bool) checkResult {
+	result := checkResult{name: "nested virtualization"}
+
+	switch {
+	case !hasCPUFlag(cpuinfo, "hypervisor"):
+		result.status = checkOK
+		result.msg = "no hypervisor detected, not required"
+	case kvm:
+		result.status = checkOK
+		result.msg = "running in a virtual machine with nested " +
+			"virtualization"
+	default:
+		result.status = checkWarn
+		result.msg = "running in a virtual machine without KVM"
+		result.hint = "enable nested virtualization for the virtual " +
+			"machine on its host, or use a CI runner with KVM support"
+	}
+
+	return result
+}
+
+// hasCPUFlag returns true if the given flag is in the flags line of the given
+// content of /proc/cpuinfo.
+func hasCPUFlag(cpuinfo []byte, flag string) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(cpuinfo))
+
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(key) != "flags" {
+			continue
+		}
+
+		return strings.Contains(" "+value+" ", " "+flag+" ")
+	}
+
+	return false
+}
+
+// checkKernel checks if the kernel at the given path is readable and built
+// for the given arch.
+func checkKernel(path string, arch sys.Arch) checkResult {
+	result := checkResult{name: "kernel"}
+
+	if path == "" {
+		result.status = checkSkip
+		result.msg = "no kernel given (use -kernel)"
+
+		return result
+	}
+
+	kernelArch, err := sys.ReadKernelArch(path)
+
+	switch {
+	case errors.Is(err, sys.ErrUnknownKernelFormat):
+		result.status = checkWarn
+		result.msg = path + ": readable, but its arch is unknown"
+		result.hint = "make sure the kernel is built for " + arch.String()
+	case errors.Is(err, os.ErrPermission):
+		result.status = checkFail
+		result.msg = err.Error()
+		result.hint = "kernels in /boot are often readable by root only, " +
+			"copy it or use \"virtrun kernel fetch\""
+	case err != nil:
+		result.status = checkFail
+		result.msg = err.Error()
+	case kernelArch != arch:
+		result.status = checkFail
+		result.msg = fmt.Sprintf("%s: built for %s, guest arch is %s",
+			path, kernelArch, arch)
+		result.hint = "use a kernel built for " + arch.String()
+	default:
+		result.status = checkOK
+		result.msg = path + ": readable, built for " + arch.String()
+	}
+
+	return result
+}
+
+// checkKernelConfig checks if the build config of the given kernel has all
+// options enabled the guest system requires. The config is read from the
+// given file, if set. See [virtrun.MissingKernelConfigOptions].
+func checkKernelConfig(kernel, kernelConfig string, arch sys.Arch) checkResult {
+	result := checkResult{name: "kernel config"}
+
+	if kernel == "" && kernelConfig == "" {
+		result.status = checkSkip
+		result.msg = "no kernel given (use -kernel or -kernelConfig)"
+
+		return result
+	}
+
+	spec := virtrun.Qemu{
+		Kernel:       kernel,
+		KernelConfig: kernelConfig,
+		NoKVM:        true,
+	}
+
+	err := spec.AddDefaultsFor(arch)
+	if err != nil {
+		result.status = checkFail
+		result.msg = err.Error()
+
+		return result
+	}
+
+	// The transport type is detected from the kernel config as well.
+	spec.TransportType = ""
+
+	missing, err := virtrun.MissingKernelConfigOptions(spec)
+
+	switch {
+	case errors.Is(err, sys.ErrNoKernelConfig):
+		result.status = checkSkip
+		result.msg = "kernel config not available"
+		result.hint = "pass the kernel build config with -kernelConfig"
+	case err != nil:
+		result.status = checkFail
+		result.msg = err.Error()
+	case len(missing) > 0:
+		result.status = checkFail
+		result.msg = "missing " + strings.Join(missing, ", ")
+		result.hint = "use a kernel built with the missing options enabled"
+	default:
+		result.status = checkOK
+		result.msg = "all required options enabled"
+	}
+
+	return result
+}
+
+// checkMemory checks if the given memory in MB is available, based on the
+// given content of /proc/meminfo.
+func checkMemory(meminfo []byte, required uint64) checkResult {
+	result := checkResult{name: "memory"}
+
+	availableKB, found := meminfoValue(meminfo, "MemAvailable")
+	if !found {
+		result.status = checkWarn
+		result.msg = "available memory unknown"
+
+		return result
+	}
+
+	available := availableKB / 1024
+
+	if available < required {
+		result.status = checkFail
+		result.msg = fmt.Sprintf("%d MB available, %d MB required",
+			available, required)
+		result.hint = "free memory on the host or lower -memory"
+
+		return result
+	}
+
+	result.status = checkOK
+	result.msg = fmt.Sprintf("%d MB available, %d MB required",
+		available, required)
+
+	return result
+}
+
+// meminfoValue returns the value of the given key in the given content of
+// /proc/meminfo, in kB.
+func meminfoValue(meminfo []byte, key string) (uint64, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(meminfo))
+
+	for scanner.Scan() {
+		name, value, found := strings.Cut(scanner.Text(), ":")
+		if !found || name != key {
+			continue
+		}
+
+		value = strings.TrimSpace(strings.TrimSuffix(
+			strings.TrimSpace(value), "kB"))
+
+		number, err := strconv.ParseUint(value, 10, 64)
+
+		return number, err == nil
+	}
+
+	return 0, false
+}
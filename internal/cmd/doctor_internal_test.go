@@ -0,0 +1,248 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckKVM_ForeignArch(t *testing.T) {
+	foreign := sys.ARM64
+	if sys.Native == sys.ARM64 {
+		foreign = sys.AMD64
+	}
+
+	result := checkKVM(foreign)
+	assert.Equal(t, checkWarn, result.status)
+	assert.Empty(t, result.hint)
+}
+
+func TestKVMHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "missing device",
+			err:      os.ErrNotExist,
+			expected: "kvm module",
+		},
+		{
+			name:     "permission",
+			err:      os.ErrPermission,
+			expected: "group",
+		},
+		{
+			name:     "other",
+			err:      sys.ErrKVMAPIVersion,
+			expected: "hypervisor",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Contains(t, kvmHint(tt.err), tt.expected)
+		})
+	}
+}
+
+func TestCheckNested(t *testing.T) {
+	vm := []byte("processor\t: 0\nflags\t\t: fpu vme hypervisor lahf_lm\n")
+	bare := []byte("processor\t: 0\nflags\t\t: fpu vme lahf_lm\n")
+
+	tests := []struct {
+		name     string
+		cpuinfo  []byte
+		kvm      bool
+		expected string
+	}{
+		{
+			name:     "bare metal",
+			cpuinfo:  bare,
+			expected: checkOK,
+		},
+		{
+			name:     "vm with kvm",
+			cpuinfo:  vm,
+			kvm:      true,
+			expected: checkOK,
+		},
+		{
+			name:     "vm without kvm",
+			cpuinfo:  vm,
+			expected: checkWarn,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkNested(tt.cpuinfo, tt.kvm)
+			assert.Equal(t, tt.expected, result.status)
+		})
+	}
+}
+
+func TestCheckKernel(t *testing.T) {
+	dir := t.TempDir()
+
+	bzImage := make([]byte, 0x400)
+	copy(bzImage[0x202:], "HdrS")
+
+	amd64Path := filepath.Join(dir, "bzImage")
+	require.NoError(t, os.WriteFile(amd64Path, bzImage, 0o600))
+
+	unknownPath := filepath.Join(dir, "vmlinuz.gz")
+	require.NoError(t, os.WriteFile(unknownPath, []byte{0x1f, 0x8b}, 0o600))
+
+	tests := []struct {
+		name     string
+		path     string
+		arch     sys.Arch
+		expected string
+	}{
+		{
+			name:     "none",
+			arch:     sys.AMD64,
+			expected: checkSkip,
+		},
+		{
+			name:     "match",
+			path:     amd64Path,
+			arch:     sys.AMD64,
+			expected: checkOK,
+		},
+		{
+			name:     "mismatch",
+			path:     amd64Path,
+			arch:     sys.ARM64,
+			expected: checkFail,
+		},
+		{
+			name:     "unknown format",
+			path:     unknownPath,
+			arch:     sys.AMD64,
+			expected: checkWarn,
+		},
+		{
+			name:     "missing",
+			path:     filepath.Join(dir, "missing"),
+			arch:     sys.AMD64,
+			expected: checkFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkKernel(tt.path, tt.arch)
+			assert.Equal(t, tt.expected, result.status, result.msg)
+		})
+	}
+}
+
+func TestCheckKernelConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	complete := filepath.Join(dir, "complete")
+	content := "CONFIG_BLK_DEV_INITRD=y\nCONFIG_BINFMT_ELF=y\n" +
+		"CONFIG_DEVTMPFS=y\nCONFIG_PROC_FS=y\nCONFIG_SYSFS=y\n" +
+		"CONFIG_TMPFS=y\nCONFIG_VIRTIO_PCI=y\nCONFIG_VIRTIO_CONSOLE=m\n"
+	require.NoError(t, os.WriteFile(complete, []byte(content), 0o600))
+
+	incomplete := filepath.Join(dir, "incomplete")
+	content = "CONFIG_VIRTIO_PCI=y\nCONFIG_VIRTIO_CONSOLE=y\n"
+	require.NoError(t, os.WriteFile(incomplete, []byte(content), 0o600))
+
+	kernel := filepath.Join(dir, "bzImage")
+	require.NoError(t, os.WriteFile(kernel, []byte("kernel"), 0o600))
+
+	tests := []struct {
+		name         string
+		kernel       string
+		kernelConfig string
+		expected     string
+	}{
+		{
+			name:     "none",
+			expected: checkSkip,
+		},
+		{
+			name:     "not available",
+			kernel:   kernel,
+			expected: checkSkip,
+		},
+		{
+			name:         "complete",
+			kernelConfig: complete,
+			expected:     checkOK,
+		},
+		{
+			name:         "incomplete",
+			kernelConfig: incomplete,
+			expected:     checkFail,
+		},
+		{
+			name:         "missing",
+			kernelConfig: filepath.Join(dir, "missing"),
+			expected:     checkFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkKernelConfig(tt.kernel, tt.kernelConfig, sys.AMD64)
+			assert.Equal(t, tt.expected, result.status, result.msg)
+		})
+	}
+}
+
+func TestCheckMemory(t *testing.T) {
+	meminfo := []byte("MemTotal:        8000000 kB\n" +
+		"MemFree:          100000 kB\n" +
+		"MemAvailable:    1048576 kB\n")
+
+	tests := []struct {
+		name        string
+		meminfo     []byte
+		required    uint64
+		expected    string
+		expectedMsg string
+	}{
+		{
+			name:        "enough",
+			meminfo:     meminfo,
+			required:    256,
+			expected:    checkOK,
+			expectedMsg: "1024 MB available, 256 MB required",
+		},
+		{
+			name:        "too little",
+			meminfo:     meminfo,
+			required:    2048,
+			expected:    checkFail,
+			expectedMsg: "1024 MB available, 2048 MB required",
+		},
+		{
+			name:        "unknown",
+			required:    256,
+			expected:    checkWarn,
+			expectedMsg: "available memory unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkMemory(tt.meminfo, tt.required)
+			assert.Equal(t, tt.expected, result.status)
+			assert.Equal(t, tt.expectedMsg, result.msg)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// printInvocation writes the given [virtrun.Invocation] in the given format.
+func printInvocation(
+	w io.Writer,
+	invocation *virtrun.Invocation,
+	format string,
+) error {
+	if format == dryRunFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(invocation) //nolint:wrapcheck
+	}
+
+	args := make([]string, len(invocation.Args))
+	for idx, arg := range invocation.Args {
+		args[idx] = shellQuote(arg)
+	}
+
+	fmt.Fprintf(w, "command: %s\n", strings.Join(args, " "))
+	fmt.Fprintf(w, "kernel cmdline: %s\n",
+		strings.Join(invocation.KernelCmdline, " "))
+	fmt.Fprintln(w, "consoles:")
+
+	for _, console := range invocation.Consoles {
+		fmt.Fprintf(w, "  %s: %s\n", console.Device, console.Output)
+	}
+
+	return nil
+}
+
+// shellQuote quotes the given string with single quotes if it contains
+// characters a shell would interpret.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\$`;&|<>()*?[]#~") {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
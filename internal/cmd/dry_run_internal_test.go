@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintInvocation(t *testing.T) {
+	invocation := &virtrun.Invocation{
+		Args: []string{
+			"qemu-system-x86_64",
+			"-append", "console=hvc0 A='b'",
+		},
+		KernelCmdline: []string{"console=hvc0", "A='b'"},
+		Consoles: []qemu.Console{
+			{Device: "hvc0", Output: "stdout"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{
+			name:   "text",
+			format: dryRunFormatText,
+			expected: "command: qemu-system-x86_64 -append " +
+				`'console=hvc0 A='\''b'\'''` + "\n" +
+				"kernel cmdline: console=hvc0 A='b'\n" +
+				"consoles:\n" +
+				"  hvc0: stdout\n",
+		},
+		{
+			name:   "json",
+			format: dryRunFormatJSON,
+			expected: `{
+  "args": [
+    "qemu-system-x86_64",
+    "-append",
+    "console=hvc0 A='b'"
+  ],
+  "kernelCmdline": [
+    "console=hvc0",
+    "A='b'"
+  ],
+  "consoles": [
+    {
+      "device": "hvc0",
+      "output": "stdout"
+    }
+  ]
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := printInvocation(&buf, invocation, tt.format)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvVarList is a list of environment variables in the form "KEY=VALUE".
+type EnvVarList []string
+
+func (e *EnvVarList) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *EnvVarList) Set(s string) error {
+	err := ValidateEnvVar(s)
+	if err != nil {
+		return err
+	}
+
+	*e = append(*e, s)
+
+	return nil
+}
+
+// EnvPassthroughList is a list of environment variables in the form
+// "KEY=VALUE" that is added to by the names of host environment variables.
+// Variables that are not set on the host are not added.
+type EnvPassthroughList []string
+
+func (e *EnvPassthroughList) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *EnvPassthroughList) Set(s string) error {
+	value, found := os.LookupEnv(s)
+
+	err := ValidateEnvVar(s + "=" + value)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		*e = append(*e, s+"="+value)
+	}
+
+	return nil
+}
+
+// ValidateEnvVar checks if the given string is a valid environment variable
+// in the form "KEY=VALUE" that can be passed via the kernel command line.
+func ValidateEnvVar(s string) error {
+	key, value, found := strings.Cut(s, "=")
+
+	switch {
+	case !found:
+		return fmt.Errorf("%w: missing \"=\": %s", ErrInvalidEnvVar, s)
+	case key == "" || strings.ContainsAny(key, " \t\n\"."):
+		return fmt.Errorf("%w: invalid name: %s", ErrInvalidEnvVar, s)
+	case strings.ContainsAny(value, "\n\""):
+		return fmt.Errorf("%w: invalid value: %s", ErrInvalidEnvVar, s)
+	}
+
+	return nil
+}
+
+// SysctlList is a list of guest kernel parameters in the form "KEY=VALUE".
+type SysctlList []string
+
+func (l *SysctlList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *SysctlList) Set(s string) error {
+	key, value, found := strings.Cut(s, "=")
+
+	switch {
+	case !found || key == "":
+		return fmt.Errorf("%w: %s", ErrInvalidSysctl, s)
+	case strings.ContainsAny(s, " \t\n\";"):
+		return fmt.Errorf("%w: invalid character: %s", ErrInvalidSysctl, s)
+	case value == "":
+		return fmt.Errorf("%w: empty value: %s", ErrInvalidSysctl, s)
+	}
+
+	*l = append(*l, s)
+
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"strings"
+	"time"
 )
 
 var (
@@ -23,6 +25,105 @@ var (
 	// ErrNotRegularFile is returned if a file should be read but is not a
 	// regular file.
 	ErrNotRegularFile = errors.New("not a regular file")
+
+	// ErrInvalidEnvVar is returned if an environment variable is not in the
+	// form "KEY=VALUE" or can not be passed to the guest.
+	ErrInvalidEnvVar = errors.New("invalid environment variable")
+
+	// ErrInvalidMountOptions is returned if mount options are not in the form
+	// "PATH:OPTIONS" or can not be passed to the guest.
+	ErrInvalidMountOptions = errors.New("invalid mount options")
+
+	// ErrInvalidSysctl is returned if a kernel parameter is not in the form
+	// "KEY=VALUE" or can not be passed to the guest.
+	ErrInvalidSysctl = errors.New("invalid kernel parameter")
+
+	// ErrInvalidGlob is returned if a glob pattern for guest files is
+	// malformed or can not be passed to the guest.
+	ErrInvalidGlob = errors.New("invalid glob pattern")
+
+	// ErrInvalidIDMappings is returned if user namespace ID mappings are
+	// malformed.
+	ErrInvalidIDMappings = errors.New("invalid id mappings")
+
+	// ErrInvalidVolume is returned if a volume is not in the form
+	// "HOSTPATH:GUESTPATH[:ro]" or can not be passed to the guest.
+	ErrInvalidVolume = errors.New("invalid volume")
+
+	// ErrInvalidFileTarget is returned if the target of an additional file
+	// is neither an absolute guest path nor a plain file name.
+	ErrInvalidFileTarget = errors.New("invalid file target")
+
+	// ErrInvalidCPUList is returned if a list of host CPUs is not in the
+	// form "0-3,6".
+	ErrInvalidCPUList = errors.New("invalid cpu list")
+
+	// ErrInvalidIOPriority is returned if an I/O priority is not in the form
+	// "CLASS[:LEVEL]".
+	ErrInvalidIOPriority = errors.New("invalid io priority")
+
+	// ErrInvalidCgroupLimit is returned if a cgroup limit is not in the form
+	// "FILE=VALUE".
+	ErrInvalidCgroupLimit = errors.New("invalid cgroup limit")
+
+	// ErrInvalidForward is returned if a forward is not in the form
+	// "GUESTADDRESS=HOSTADDRESS" or has an invalid address.
+	ErrInvalidForward = errors.New("invalid forward")
+
+	// ErrInvalidDebugTool is returned if a debug tool command is empty, can
+	// not be found or can not be passed to the guest.
+	ErrInvalidDebugTool = errors.New("invalid debug tool")
+
+	// ErrUnknownGoTestFlag is returned if a go test flag to rewrite is not
+	// supported.
+	ErrUnknownGoTestFlag = errors.New("unknown go test flag")
+
+	// ErrUnknownProfile is returned if a profile is not defined in the
+	// profiles file.
+	ErrUnknownProfile = errors.New("unknown profile")
+
+	// ErrInvalidProfile is returned if a profile is malformed.
+	ErrInvalidProfile = errors.New("invalid profile")
+
+	// ErrQemuNotFound is returned if no QEMU binary is found.
+	ErrQemuNotFound = errors.New("no qemu binary found")
+
+	// ErrEnvironmentCheckFailed is returned if any check of the host
+	// environment failed.
+	ErrEnvironmentCheckFailed = errors.New("environment check failed")
+
+	// ErrInitContractViolated is returned if a standalone init does not
+	// satisfy the contract of virtrun.
+	ErrInitContractViolated = errors.New("init contract violated")
+
+	// ErrNoTestBinaries is returned if building the test binaries of the
+	// given packages produced none, like if they have no tests.
+	ErrNoTestBinaries = errors.New("no test binaries built")
+
+	// ErrStandaloneConflict is returned if flags are combined with
+	// standalone mode that do not work with it.
+	ErrStandaloneConflict = errors.New("not supported in standalone mode")
+
+	// ErrImageConflict is returned if an OCI image is combined with flags
+	// that do not work with it.
+	ErrImageConflict = errors.New("not supported with an image")
+
+	// ErrHostRootConflict is returned if sharing the host's root directory
+	// is combined with flags that do not work with it.
+	ErrHostRootConflict = errors.New("not supported with host root")
+
+	// ErrUnknownServeMethod is returned if a client of the serve subcommand
+	// requests an unknown method.
+	ErrUnknownServeMethod = errors.New("unknown serve method")
+
+	// ErrGuestWithoutJob is returned if a guest of the serve subcommand
+	// exited without requesting a job, like if its init does not support
+	// jobs.
+	ErrGuestWithoutJob = errors.New("guest exited without job")
+
+	// ErrServerRunFailed is returned if a run on a server failed for other
+	// reasons than a non-zero exit code of the binary.
+	ErrServerRunFailed = errors.New("server run failed")
 )
 
 // ParseArgsError wraps errors that occur during argument parsing.
@@ -47,3 +148,60 @@ func (*ParseArgsError) Is(other error) bool {
 func (e *ParseArgsError) Unwrap() error {
 	return e.err
 }
+
+// TimeoutError is returned if a run exceeded a timeout.
+type TimeoutError struct {
+	// Phase is the phase of the run the timeout applies to: "boot" or "run".
+	Phase string
+
+	// Timeout is the exceeded timeout.
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout of %s exceeded", e.Phase, e.Timeout)
+}
+
+func (*TimeoutError) Is(other error) bool {
+	_, ok := other.(*TimeoutError)
+	return ok
+}
+
+// ExitCodeError wraps the error of a run with the exit code virtrun exits
+// with for it, as defined by the exit code flags of the run.
+type ExitCodeError struct {
+	Err      error
+	ExitCode int
+}
+
+func (e *ExitCodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
+
+func (*ExitCodeError) Is(other error) bool {
+	_, ok := other.(*ExitCodeError)
+	return ok
+}
+
+// ParallelError is returned if any of multiple runs failed, like the runs of
+// the binaries of a parallel run.
+type ParallelError struct {
+	// Failed are the names of the failed runs in order.
+	Failed []string
+
+	// ExitCode is the exit code of the first failed run.
+	ExitCode int
+}
+
+func (e *ParallelError) Error() string {
+	return "failed runs: " + strings.Join(e.Failed, ", ")
+}
+
+func (*ParallelError) Is(other error) bool {
+	_, ok := other.(*ParallelError)
+	return ok
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/aibor/virtrun/internal/qemu"
+)
+
+const (
+	exitCodeModePassthrough = "passthrough"
+	exitCodeModeClamp       = "clamp"
+
+	// exitCodeGuestFailed is the exit code for non-zero guest exit codes that
+	// are not passed through.
+	exitCodeGuestFailed = 1
+
+	infraExitCodeMin = 2
+	infraExitCodeMax = 255
+)
+
+// exitCodePolicy defines how the exit code of virtrun is derived from the
+// error of a run. The zero value passes guest exit codes through.
+type exitCodePolicy struct {
+	// mode defines how non-zero guest exit codes are mapped. With
+	// [exitCodeModeClamp], they are mapped to [exitCodeGuestFailed].
+	// Otherwise, they are passed through.
+	mode string
+
+	// infra is the exit code for failures other than a non-zero guest exit
+	// code and timeouts, like a guest that does not boot. If set, it is
+	// reserved together with [exitCodeTimeout], so guest exit codes equal
+	// to any of them are mapped to [exitCodeGuestFailed]. If 0, it is the
+	// exit code of QEMU, if it exited with one, or -1 otherwise.
+	infra uint64
+}
+
+// exitCode returns the exit code for the given error.
+func (p exitCodePolicy) exitCode(err error) int {
+	if err == nil || errors.Is(err, ErrHelp) {
+		return 0
+	}
+
+	if errors.Is(err, &TimeoutError{}) {
+		return exitCodeTimeout
+	}
+
+	var qemuCmdErr *qemu.CommandError
+
+	hasCmdErr := errors.As(err, &qemuCmdErr)
+
+	if hasCmdErr && errors.Is(err, qemu.ErrGuestNonZeroExitCode) {
+		return p.guestExitCode(qemuCmdErr.ExitCode)
+	}
+
+	if p.infra != 0 {
+		return int(p.infra)
+	}
+
+	if hasCmdErr && qemuCmdErr.ExitCode != 0 {
+		return qemuCmdErr.ExitCode
+	}
+
+	return -1
+}
+
+// guestExitCode maps the given non-zero guest exit code.
+func (p exitCodePolicy) guestExitCode(code int) int {
+	if p.mode == exitCodeModeClamp {
+		return exitCodeGuestFailed
+	}
+
+	reserved := code == exitCodeTimeout || code == int(p.infra)
+	if p.infra != 0 && reserved {
+		return exitCodeGuestFailed
+	}
+
+	return code
+}
+
+// wrap returns the given error wrapped in an [ExitCodeError] with the exit
+// code for it. It returns nil, if the error is nil.
+func (p exitCodePolicy) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &ExitCodeError{Err: err, ExitCode: p.exitCode(err)}
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCodePolicy(t *testing.T) {
+	guestExit := func(code int) error {
+		return fmt.Errorf("run: %w", &qemu.CommandError{
+			Err:      qemu.ErrGuestNonZeroExitCode,
+			Guest:    true,
+			ExitCode: code,
+		})
+	}
+
+	panicErr := &qemu.CommandError{Err: qemu.ErrGuestPanic, Guest: true}
+	qemuErr := &qemu.CommandError{Err: errors.New("fail"), ExitCode: 3}
+	timeoutErr := &TimeoutError{Phase: "boot", Timeout: time.Second}
+
+	tests := []struct {
+		name     string
+		policy   exitCodePolicy
+		err      error
+		expected int
+	}{
+		{
+			name:     "success",
+			err:      nil,
+			expected: 0,
+		},
+		{
+			name:     "passthrough",
+			policy:   exitCodePolicy{mode: exitCodeModePassthrough},
+			err:      guestExit(3),
+			expected: 3,
+		},
+		{
+			name:     "passthrough timeout code without infra code",
+			err:      guestExit(exitCodeTimeout),
+			expected: exitCodeTimeout,
+		},
+		{
+			name:     "passthrough reserved infra code",
+			policy:   exitCodePolicy{infra: 3},
+			err:      guestExit(3),
+			expected: exitCodeGuestFailed,
+		},
+		{
+			name:     "passthrough reserved timeout code",
+			policy:   exitCodePolicy{infra: 3},
+			err:      guestExit(exitCodeTimeout),
+			expected: exitCodeGuestFailed,
+		},
+		{
+			name:     "clamp",
+			policy:   exitCodePolicy{mode: exitCodeModeClamp},
+			err:      guestExit(42),
+			expected: exitCodeGuestFailed,
+		},
+		{
+			name:     "timeout",
+			policy:   exitCodePolicy{mode: exitCodeModeClamp, infra: 3},
+			err:      timeoutErr,
+			expected: exitCodeTimeout,
+		},
+		{
+			name:     "guest failure",
+			err:      panicErr,
+			expected: -1,
+		},
+		{
+			name:     "guest failure with infra code",
+			policy:   exitCodePolicy{infra: 3},
+			err:      panicErr,
+			expected: 3,
+		},
+		{
+			name:     "qemu failure",
+			err:      qemuErr,
+			expected: 3,
+		},
+		{
+			name:     "qemu failure with infra code",
+			policy:   exitCodePolicy{infra: 99},
+			err:      qemuErr,
+			expected: 99,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.policy.exitCode(tt.err))
+
+			wrapped := tt.policy.wrap(tt.err)
+			assert.Equal(t, tt.expected, exitCodeFor(wrapped))
+		})
+	}
+}
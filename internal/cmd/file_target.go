@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// FileList is a list of additional files in the form "HOSTPATH[:TARGET]".
+// Files without target are added to Files. Files with target are added to
+// Targets. The target is either an absolute guest path or a plain file name.
+// See [virtrun.Initramfs.FileTargets].
+type FileList struct {
+	Files   *[]string
+	Targets *[]virtrun.FileTarget
+}
+
+func (l *FileList) String() string {
+	var files []string
+
+	if l.Files != nil {
+		files = append(files, *l.Files...)
+	}
+
+	if l.Targets != nil {
+		for _, file := range *l.Targets {
+			files = append(files, file.Source+":"+file.Target)
+		}
+	}
+
+	return strings.Join(files, ",")
+}
+
+func (l *FileList) Set(s string) error {
+	for _, e := range strings.Split(s, ",") {
+		source, target, hasTarget := strings.Cut(e, ":")
+
+		source, err := AbsoluteFilePath(source)
+		if err != nil {
+			return err
+		}
+
+		if !hasTarget {
+			*l.Files = append(*l.Files, source)
+			continue
+		}
+
+		target, err = fileTarget(target)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, e)
+		}
+
+		*l.Targets = append(*l.Targets, virtrun.FileTarget{
+			Source: source,
+			Target: target,
+		})
+	}
+
+	return nil
+}
+
+// fileTarget returns the cleaned target of an additional file. It must be
+// either an absolute guest path that is not hidden by a mount or a plain file
+// name.
+func fileTarget(target string) (string, error) {
+	if path.IsAbs(target) {
+		target = path.Clean(target)
+
+		if target == "/" || isHiddenGuestPath(target) {
+			return "", fmt.Errorf("%w: guest path hidden by mount",
+				ErrInvalidFileTarget)
+		}
+
+		return target, nil
+	}
+
+	if target == "" || target == "." || target == ".." ||
+		strings.Contains(target, "/") {
+		return "", fmt.Errorf("%w: neither absolute path nor file name",
+			ErrInvalidFileTarget)
+	}
+
+	return target, nil
+}
+
+// hasGuestPathFiles returns true if any of the file targets of the given
+// [virtrun.Initramfs] is an absolute guest path.
+func hasGuestPathFiles(cfg virtrun.Initramfs) bool {
+	for _, file := range cfg.FileTargets {
+		if path.IsAbs(file.Target) {
+			return true
+		}
+	}
+
+	return false
+}
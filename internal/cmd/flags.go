@@ -5,11 +5,20 @@
 package cmd
 
 import (
+	"cmp"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"os"
+	"regexp"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/tracing"
 	"github.com/aibor/virtrun/internal/virtrun"
 )
 
@@ -23,39 +32,89 @@ const (
 	smpDefault = 1
 	smpMin     = 1
 	smpMax     = 16
+
+	zramSwapMin = 0
+	zramSwapMax = 16384
+
+	oomScoreAdjMin = -1000
+	oomScoreAdjMax = 1000
+
+	niceMin = -20
+	niceMax = 19
+
+	metricsInterval = time.Second
+
+	dryRunFormatText = "text"
+	dryRunFormatJSON = "json"
+
+	outputFormatJSON = "json"
+
+	logFormatText = "text"
+	logFormatJSON = "json"
 )
 
 type flags struct {
 	name string
 
-	spec        *virtrun.Spec
-	flagSet     *flag.FlagSet
-	versionFlag bool
-	debugFlag   bool
+	spec         *virtrun.Spec
+	flagSet      *flag.FlagSet
+	versionFlag  bool
+	debugFlag    bool
+	logLevel     slog.Level
+	logFormat    string
+	metricsFile  string
+	dryRun       bool
+	dryRunFormat string
+	noTTY        bool
+	output       string
+	outputFile   string
+	otlpEndpoint string
+	timeout      time.Duration
+	bootTimeout  time.Duration
+	profile      profileValue
+	exitCodes    exitCodePolicy
+	server       string
 }
 
 func newFlags(name string, output io.Writer) *flags {
 	flags := &flags{
-		name: name,
+		name:         name,
+		dryRunFormat: dryRunFormatText,
+		logLevel:     slog.LevelWarn,
+		logFormat:    logFormatText,
+		exitCodes:    exitCodePolicy{mode: exitCodeModePassthrough},
+		otlpEndpoint: tracing.EndpointFromEnv(),
 		spec: &virtrun.Spec{
 			Qemu: virtrun.Qemu{
-				CPU:    cpuDefault,
-				Memory: memDefault,
-				SMP:    1,
+				CPU:      cpuDefault,
+				Memory:   memDefault,
+				SMP:      1,
+				CoverDir: os.Getenv("GOCOVERDIR"),
 			},
 		},
 	}
 
-	flags.initFlagset(output)
+	flags.profile.flags = flags
+	flags.flagSet = flags.newFlagSet(output)
 
 	return flags
 }
 
-func (f *flags) initFlagset(output io.Writer) {
+// newFlagSet creates a [flag.FlagSet] with all flags bound to f.
+func (f *flags) newFlagSet(output io.Writer) *flag.FlagSet {
 	fsName := f.name + " [flags...] binary [initargs...]"
 	fs := flag.NewFlagSet(fsName, flag.ContinueOnError)
 	fs.SetOutput(output)
 
+	fs.Var(
+		&f.profile,
+		"profile",
+		"name of the profile to apply. It sets the kernel, QEMU binary and "+
+			"further flags as defined in the profiles file (path from env "+
+			"VIRTRUN_PROFILES or virtrun/profiles.json in the user config "+
+			"dir). Flags given after it take precedence.",
+	)
+
 	fs.StringVar(
 		&f.spec.Qemu.Executable,
 		"qemu-bin",
@@ -64,9 +123,37 @@ func (f *flags) initFlagset(output io.Writer) {
 	)
 
 	fs.Var(
-		(*FilePath)(&f.spec.Qemu.Kernel),
+		(*KernelPath)(&f.spec.Qemu.Kernel),
 		"kernel",
-		"path to kernel to use",
+		"path to kernel to use, or reference to a kernel fetched with "+
+			"\"virtrun kernel fetch\" like cache:6.6-amd64",
+	)
+
+	fs.Var(
+		(*FilePath)(&f.spec.Qemu.Firmware),
+		"firmware",
+		"firmware to boot with, like the UEFI firmware OVMF.fd. "+
+			"(default is the QEMU default firmware)",
+	)
+
+	fs.BoolVar(
+		&f.spec.Qemu.UKI,
+		"uki",
+		f.spec.Qemu.UKI,
+		"build a Unified Kernel Image with the kernel, initramfs and "+
+			"kernel command line embedded and boot it via the UEFI firmware "+
+			"given by -firmware. It is built with systemd's ukify.",
+	)
+
+	fs.Func(
+		"ukifyArg",
+		"argument to pass to \"ukify build\", like for signing the "+
+			"Unified Kernel Image built for -uki. Flag may be used more than "+
+			"once.",
+		func(s string) error {
+			f.spec.Qemu.UKIfyArgs = append(f.spec.Qemu.UKIfyArgs, s)
+			return nil
+		},
 	)
 
 	fs.StringVar(
@@ -90,10 +177,47 @@ func (f *flags) initFlagset(output io.Writer) {
 		"disable hardware support (default depends on binary arch)",
 	)
 
+	fs.BoolVar(
+		&f.spec.Qemu.NoContainerDetect,
+		"nocontainer",
+		f.spec.Qemu.NoContainerDetect,
+		"do not adapt defaults to the container environment virtrun runs "+
+			"in, like the guest memory to the container's memory limit",
+	)
+
 	fs.Var(
 		&f.spec.Qemu.TransportType,
 		"transport",
-		"io transport type: isa, pci, mmio (default depends on binary arch)",
+		"io transport type: isa, pci, mmio (default is detected from QEMU "+
+			"devices and kernel config)",
+	)
+
+	fs.Var(
+		(*FilePath)(&f.spec.Qemu.KernelConfig),
+		"kernelConfig",
+		"kernel build config file, like a copy of /proc/config.gz, used for "+
+			"detecting the transport type (default is the config-VERSION "+
+			"file next to the kernel, if any)",
+	)
+
+	fs.Func(
+		"kernelAppend",
+		"additional kernel command line parameters, separated by "+
+			"whitespace. Values containing whitespace must be enclosed in "+
+			"double quotes. Parameters virtrun depends on, like console= "+
+			"and panic=, can not be overridden. Flag may be used more than "+
+			"once.",
+		func(s string) error {
+			params, err := qemu.ParseKernelParams(s)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			f.spec.Qemu.KernelParams = append(f.spec.Qemu.KernelParams,
+				params...)
+
+			return nil
+		},
 	)
 
 	fs.BoolVar(
@@ -114,55 +238,517 @@ func (f *flags) initFlagset(output io.Writer) {
 	)
 
 	fs.Var(
-		&limitedUintValue{
-			Value: &f.spec.Qemu.SMP,
-			min:   smpMin,
-			max:   smpMax,
+		&smpValue{
+			limitedUintValue{
+				Value: &f.spec.Qemu.SMP,
+				min:   smpMin,
+				max:   smpMax,
+			},
 		},
 		"smp",
-		"number of CPUs for the QEMU VM",
+		"number of CPUs for the QEMU VM, or auto for as many as the host "+
+			"has, up to "+strconv.Itoa(smpMax)+" or the cap given like "+
+			"auto:4. The guest gets the number in env "+
+			virtrun.SMPEnvVar+".",
+	)
+
+	fs.Var(
+		(*CPUList)(&f.spec.Qemu.ProcessLimits.CPUs),
+		"hostCPUs",
+		"host CPUs to pin the QEMU process to, like 0-3,6, so parallel "+
+			"instances on a shared host do not starve each other.",
+	)
+
+	fs.Var(
+		&limitedIntValue{
+			Value: &f.spec.Qemu.ProcessLimits.Nice,
+			min:   niceMin,
+			max:   niceMax,
+		},
+		"nice",
+		"nice value of the QEMU process. Unchanged if 0.",
+	)
+
+	fs.Var(
+		&IOPriority{
+			Class: &f.spec.Qemu.ProcessLimits.IOClass,
+			Level: &f.spec.Qemu.ProcessLimits.IOLevel,
+		},
+		"ionice",
+		"I/O scheduling class and level of the QEMU process in the form "+
+			"CLASS[:LEVEL], like idle or best-effort:7. Classes are "+
+			"realtime, best-effort and idle.",
+	)
+
+	fs.Var(
+		(*FilePath)(&f.spec.Qemu.ProcessLimits.Cgroup),
+		"cgroup",
+		"cgroup v2 directory to start the QEMU process in. It is created, "+
+			"if it does not exist. The cgroup must be delegated to the user.",
+	)
+
+	fs.Var(
+		(*CgroupLimitList)(&f.spec.Qemu.ProcessLimits.CgroupLimits),
+		"cgroupLimit",
+		"limit to write into the -cgroup in the form FILE=VALUE, like "+
+			"\"cpu.max=200000 100000\" or memory.max=1G. Flag may be used "+
+			"more than once.",
 	)
 
 	fs.BoolVar(
-		&f.spec.Initramfs.StandaloneInit,
-		"standalone",
-		f.spec.Initramfs.StandaloneInit,
-		"run first given file as init itself. Use this if it has virtrun"+
-			" support built in.",
+		&f.spec.Qemu.PTY,
+		"pty",
+		f.spec.Qemu.PTY,
+		"run binary with a pseudo-terminal as controlling terminal in the "+
+			"guest. Not supported in standalone mode.",
+	)
+
+	fs.BoolVar(
+		&f.noTTY,
+		"noTTYPassthrough",
+		f.noTTY,
+		"do not pass the terminal to QEMU as input, if stdin is one, so "+
+			"QEMU does not put it into raw mode. The guest gets no input.",
+	)
+
+	fs.Var(
+		(*EnvVarList)(&f.spec.Qemu.Env),
+		"env",
+		"environment variable in the form KEY=VALUE to set for the binary in "+
+			"the guest. Flag may be used more than once.",
+	)
+
+	fs.Func(
+		"failOnOutput",
+		"regular expression that fails the run if a line of the guest's "+
+			"output matches it, like \"WARNING: suspicious RCU usage\". "+
+			"Flag may be used more than once.",
+		func(s string) error {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			f.spec.Qemu.LineFilters = append(f.spec.Qemu.LineFilters,
+				qemu.FailOnMatch(re))
+
+			return nil
+		},
+	)
+
+	fs.Func(
+		"redactOutput",
+		"regular expression whose matches in the guest's output are "+
+			"replaced by [REDACTED], like secrets. Flag may be used more "+
+			"than once.",
+		func(s string) error {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			f.spec.Qemu.LineFilters = append(f.spec.Qemu.LineFilters,
+				qemu.Redact(re))
+
+			return nil
+		},
+	)
+
+	fs.BoolVar(
+		&f.spec.Qemu.FailOnKernelReport,
+		"failOnKernelReport",
+		f.spec.Qemu.FailOnKernelReport,
+		"fail the run if the guest kernel reports a bug, like an Oops, a "+
+			"WARN_ON splat, a lockdep report or KASAN and UBSAN findings",
+	)
+
+	fs.BoolVar(
+		&f.spec.Qemu.PhaseMarkers,
+		"phaseMarkers",
+		f.spec.Qemu.PhaseMarkers,
+		"insert a marker line into the guest output at the start of each "+
+			"lifecycle phase: BOOT, INIT, MAIN-START, MAIN-END, SHUTDOWN",
+	)
+
+	fs.Func(
+		"console",
+		"target of an additional console of the guest: a host file path, - "+
+			"for stdout or fd:N for an open file descriptor of virtrun. "+
+			"Consoles are present in the guest in the order given, like "+
+			"/dev/hvc1. With prefix NAME=, the guest finds the console by "+
+			"name. Flag may be used more than once.",
+		func(s string) error {
+			f.spec.Qemu.Consoles = append(f.spec.Qemu.Consoles, s)
+			return nil
+		},
+	)
+
+	fs.Var(
+		(*EnvPassthroughList)(&f.spec.Qemu.Env),
+		"envPassthrough",
+		"name of a host environment variable to set for the binary in the "+
+			"guest with its host value. It is ignored if not set on the "+
+			"host. Flag may be used more than once.",
+	)
+
+	fs.Var(
+		(*MountOptionsList)(&f.spec.Qemu.MountOptions),
+		"mountOptions",
+		"additional mount options for a guest mount point in the form "+
+			"PATH:OPTIONS, like /tmp:size=2G,nosuid. Flag may be used more "+
+			"than once.",
+	)
+
+	fs.Var(
+		(*SysctlList)(&f.spec.Qemu.Sysctls),
+		"sysctl",
+		"guest kernel parameter to set in the form KEY=VALUE, like "+
+			"vm.overcommit_memory=2. Flag may be used more than once.",
+	)
+
+	fs.Var(
+		&limitedUintValue{
+			Value: &f.spec.Qemu.ZramSwap,
+			min:   zramSwapMin,
+			max:   zramSwapMax,
+		},
+		"zramSwap",
+		"size (in MB) of compressed swap space in guest memory. Requires "+
+			"the zram kernel module. Not supported in standalone mode.",
+	)
+
+	fs.Func(
+		"seed",
+		"fixed random seed (decimal integer) passed to the guest for "+
+			"reproducible runs. It is exported as VIRTRUN_SEED and written to "+
+			"/run/virtrun/seed.",
+		func(s string) error {
+			_, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			f.spec.Qemu.Seed = s
+
+			return nil
+		},
+	)
+
+	fs.Var(
+		&limitedIntValue{
+			Value: &f.spec.Qemu.OOMScoreAdj,
+			min:   oomScoreAdjMin,
+			max:   oomScoreAdjMax,
+		},
+		"oomScoreAdj",
+		"OOM score adjustment for the binary in the guest. "+
+			"Not supported in standalone mode.",
+	)
+
+	fs.Var(
+		(*GlobList)(&f.spec.Qemu.Collect),
+		"collect",
+		"glob pattern of absolute guest paths to copy into the artifact "+
+			"directory once the binary returned. Directories are copied "+
+			"recursively. Flag may be used more than once.",
+	)
+
+	fs.StringVar(
+		&f.spec.Qemu.ArtifactDir,
+		"artifactDir",
+		f.spec.Qemu.ArtifactDir,
+		"directory to write collected and streamed guest files to, "+
+			"keeping their guest path. An index of the received files is "+
+			"written into it as "+virtrun.ArtifactIndexName+
+			". (default is the current directory, without index)",
+	)
+
+	fs.BoolVar(
+		&f.spec.Qemu.ConsoleLog,
+		"consoleLog",
+		f.spec.Qemu.ConsoleLog,
+		"write the guest console output and the QEMU output into the log "+
+			"files "+virtrun.ConsoleLogName+" and "+virtrun.QemuLogName+
+			" in the artifact directory as well, with each line prefixed "+
+			"by the time it was written.",
+	)
+
+	fs.BoolVar(
+		&f.spec.Qemu.KernelLog,
+		"kernelLog",
+		f.spec.Qemu.KernelLog,
+		"stream the guest kernel log into the file "+
+			virtrun.KernelLogName+" in the artifact directory, with each "+
+			"line prefixed by the time since boot like dmesg does.",
+	)
+
+	fs.Var(
+		(*FilePath)(&f.spec.Qemu.RawConsoleDir),
+		"rawConsoleDir",
+		"directory QEMU writes the raw bytes of each guest console into, "+
+			"before virtrun processes them, like "+
+			"stdio"+qemu.RawConsoleSuffix+". Use it for debugging the "+
+			"processing of the guest output.",
+	)
+
+	fs.StringVar(
+		&f.spec.Qemu.CoverDir,
+		"coverDir",
+		f.spec.Qemu.CoverDir,
+		"directory to write the coverage data of a binary built with "+
+			"-cover to. GOCOVERDIR is set in the guest and the files are "+
+			"copied into the directory once the binary returned. (default "+
+			"from env GOCOVERDIR)",
+	)
+
+	fs.BoolVar(
+		&f.spec.Qemu.UserNamespace,
+		"userns",
+		f.spec.Qemu.UserNamespace,
+		"run the binary in a new user namespace with ID mappings written "+
+			"by the init. Not supported in standalone mode.",
+	)
+
+	fs.Var(
+		(*IDMappings)(&f.spec.Qemu.IDMappings),
+		"idMappings",
+		"user and group ID mappings for -userns in the form "+
+			"CONTAINERID:HOSTID:SIZE, separated by \";\" "+
+			"(default 0:100000:65536)",
+	)
+
+	fs.BoolVar(
+		&f.spec.Qemu.Control,
+		"control",
+		f.spec.Qemu.Control,
+		"add a console for requests and streams between host and guest. "+
+			"Streams created with package guestio are written to the "+
+			"artifact dir.",
+	)
+
+	fs.DurationVar(
+		&f.spec.Qemu.HeartbeatTimeout,
+		"heartbeatTimeout",
+		f.spec.Qemu.HeartbeatTimeout,
+		"stop the guest if it did not send a heartbeat for the given "+
+			"duration, including the boot. Disabled if 0.",
+	)
+
+	fs.Var(
+		(*VolumeList)(&f.spec.Initramfs.Volumes),
+		"volume",
+		"host file or directory to copy into the guest in the form "+
+			"HOSTPATH:GUESTPATH[:ro], like ./testdata:/srv/testdata:ro. "+
+			"With \":ro\", the guest path is read-only. Flag may be used "+
+			"more than once.",
+	)
+
+	fs.BoolVar(
+		&f.spec.Qemu.HostRoot,
+		"hostRoot",
+		f.spec.Qemu.HostRoot,
+		"share the host's root directory read-only with the guest via "+
+			"virtiofs and run the binary chrooted into it with a writable "+
+			"tmpfs overlay on top. Requires virtiofsd. Not supported with "+
+			"-image, -volume and in standalone mode.",
+	)
+
+	fs.StringVar(
+		&f.spec.Qemu.Virtiofsd,
+		"virtiofsd",
+		f.spec.Qemu.Virtiofsd,
+		"virtiofsd binary to use for -hostRoot (default is the one in PATH "+
+			"or in /usr/libexec)",
+	)
+
+	fs.Var(
+		(*ForwardList)(&f.spec.Qemu.Forwards),
+		"forward",
+		"expose a host socket in the guest in the form "+
+			"GUESTADDRESS=HOSTADDRESS. Addresses are \"unix:PATH\" or "+
+			"\"tcp:HOST:PORT\", like tcp:127.0.0.1:5432=unix:/run/db.sock. "+
+			"Connections to the guest address are forwarded to the host "+
+			"address via the control console. Flag may be used more than "+
+			"once.",
+	)
+
+	fs.DurationVar(
+		&f.timeout,
+		"timeout",
+		f.timeout,
+		"stop the guest if the run takes longer than the given duration, "+
+			"including the boot. virtrun exits with code 124 then. "+
+			"Disabled if 0.",
+	)
+
+	fs.DurationVar(
+		&f.bootTimeout,
+		"bootTimeout",
+		f.bootTimeout,
+		"stop the guest if its init did not start within the given "+
+			"duration. virtrun exits with code 124 then. Disabled if 0.",
+	)
+
+	fs.StringVar(
+		&f.exitCodes.mode,
+		"exitCodeMode",
+		f.exitCodes.mode,
+		"how a non-zero guest exit code maps to the exit code of virtrun: "+
+			"passthrough, clamp (to 1)",
+	)
+
+	fs.Var(
+		&limitedUintValue{
+			Value: &f.exitCodes.infra,
+			min:   infraExitCodeMin,
+			max:   infraExitCodeMax,
+		},
+		"infraExitCode",
+		"exit code for failures other than a non-zero guest exit code and "+
+			"timeouts, like a guest that does not boot. If set, guest exit "+
+			"codes equal to it or 124 are mapped to 1. (default is the "+
+			"exit code of QEMU or 255)",
 	)
 
 	fs.BoolVar(
 		&f.spec.Qemu.NoGoTestFlagRewrite,
 		"noGoTestFlagRewrite",
 		f.spec.Qemu.NoGoTestFlagRewrite,
-		"disable automatic go test flag rewrite for file based output.",
+		"disable automatic go test flag rewrite for file based output. "+
+			"Same as -goTestFlagRewrite none.",
 	)
 
-	fs.BoolVar(
-		&f.spec.Initramfs.Keep,
+	fs.Var(
+		&goTestFlagRewriteValue{cfg: &f.spec.Qemu},
+		"goTestFlagRewrite",
+		"comma separated go test flags without \"-test.\" prefix to "+
+			"rewrite, so they work in the guest, or all or none. Supported: "+
+			strings.Join(virtrun.GoTestFlagsRewritable, ", "),
+	)
+
+	fs.Var(
+		&keepInitramfsValue{cfg: &f.spec.Initramfs},
 		"keepInitramfs",
-		f.spec.Initramfs.Keep,
-		"do not delete initramfs once qemu is done. Intended for debugging. "+
-			"The path to the file is printed on stderr",
+		"do not delete initramfs once qemu is done. The path to the file is "+
+			"printed on stderr. With a path as value, like "+
+			"-keepInitramfs=initramfs.cpio, the file is written there, so "+
+			"it can be used with -initramfs.",
+	)
+
+	fs.BoolVar(
+		&f.spec.Initramfs.NoMemfd,
+		"noMemfd",
+		f.spec.Initramfs.NoMemfd,
+		"write the initramfs to a temporary file instead of passing it to "+
+			"qemu from memory as file descriptor, like for qemu builds "+
+			"that can not load it from a file descriptor path.",
 	)
 
 	fs.Var(
-		(*FilePathList)(&f.spec.Initramfs.Files),
-		"addFile",
-		"file to add to guest's /data dir. Flag may be used more than once.",
+		(*FilePath)(&f.spec.Initramfs.Archive),
+		"initramfs",
+		"previously built initramfs file to use instead of building one. "+
+			"It must contain the given binary. Flags for the content of the "+
+			"initramfs are not supported with it.",
 	)
 
 	fs.Var(
-		(*FilePathList)(&f.spec.Initramfs.Modules),
-		"addModule",
-		"kernel module to add to guest. Flag may be used more than once.",
+		(*FilePathList)(&f.spec.Qemu.PushFiles),
+		"pushFile",
+		"file to send into guest's /data dir at runtime instead of adding "+
+			"it to the initramfs. Flag may be used more than once.",
+	)
+
+	fs.Var(
+		&debugToolValue{spec: f.spec},
+		"debugTool",
+		"command to run the binary under in the guest, like "+
+			"\"strace -f -o /tmp/debug/trace\". The tool is looked up in "+
+			"PATH and added with its shared libraries. Files written into "+
+			"/tmp/debug are copied into the artifact directory. "+
+			"Not supported in standalone mode.",
+	)
+
+	fs.BoolVar(
+		&f.spec.Qemu.ModulesAutoload,
+		"autoloadModules",
+		f.spec.Qemu.ModulesAutoload,
+		"load only those added kernel modules that are required by "+
+			"devices present in the guest. Not supported in standalone mode.",
+	)
+
+	addInitramfsFlags(fs, &f.spec.Initramfs)
+
+	fs.StringVar(
+		&f.metricsFile,
+		"metricsFile",
+		f.metricsFile,
+		"file to write resource usage samples of the guest to as JSON "+
+			"lines, taken every second.",
+	)
+
+	fs.BoolVar(
+		&f.dryRun,
+		"dryRun",
+		f.dryRun,
+		"print the QEMU command line, kernel command line and console "+
+			"mapping instead of running QEMU. The initramfs is not built.",
+	)
+
+	fs.StringVar(
+		&f.dryRunFormat,
+		"dryRunFormat",
+		f.dryRunFormat,
+		"output format for -dryRun: text, json",
+	)
+
+	fs.StringVar(
+		&f.output,
+		"output",
+		f.output,
+		"format of a result record written once QEMU is done: json. "+
+			"The record has the exit code, durations, detected kernel "+
+			"panics and OOMs, console mapping and initramfs hash. "+
+			"Disabled if empty.",
+	)
+
+	fs.StringVar(
+		&f.outputFile,
+		"outputFile",
+		f.outputFile,
+		"file to write the result record of -output to. An existing file "+
+			"is overwritten. (default stderr)",
+	)
+
+	fs.StringVar(
+		&f.otlpEndpoint,
+		"otlpEndpoint",
+		f.otlpEndpoint,
+		"OTLP/HTTP URL to export a trace of the phases of the run to, like "+
+			"http://localhost:4318/v1/traces. (default from env "+
+			"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT)",
 	)
 
 	fs.BoolVar(
 		&f.debugFlag,
 		"debug",
 		f.debugFlag,
-		"enable debug output",
+		"enable debug output. Same as -logLevel debug.",
+	)
+
+	fs.TextVar(
+		&f.logLevel,
+		"logLevel",
+		f.logLevel,
+		"minimum level of log messages of virtrun, QEMU and the guest init: "+
+			"debug, info, warn, error",
+	)
+
+	fs.StringVar(
+		&f.logFormat,
+		"logFormat",
+		f.logFormat,
+		"format of log messages: text, json",
 	)
 
 	fs.BoolVar(
@@ -172,7 +758,7 @@ func (f *flags) initFlagset(output io.Writer) {
 		"show version and exit",
 	)
 
-	f.flagSet = fs
+	return fs
 }
 
 // fail fails like flag does. It prints the error first and then usage.
@@ -189,6 +775,56 @@ func (f *flags) Debug() bool {
 	return f.debugFlag
 }
 
+// LogLevel returns the minimum log level. It is [slog.LevelDebug] if the
+// debug flag is set.
+func (f *flags) LogLevel() slog.Level {
+	if f.debugFlag {
+		return min(f.logLevel, slog.LevelDebug)
+	}
+
+	return f.logLevel
+}
+
+func (f *flags) LogFormat() string {
+	return f.logFormat
+}
+
+func (f *flags) MetricsFile() string {
+	return f.metricsFile
+}
+
+func (f *flags) DryRun() bool {
+	return f.dryRun
+}
+
+func (f *flags) NoTTYPassthrough() bool {
+	return f.noTTY
+}
+
+func (f *flags) DryRunFormat() string {
+	return f.dryRunFormat
+}
+
+func (f *flags) Timeout() time.Duration {
+	return f.timeout
+}
+
+func (f *flags) BootTimeout() time.Duration {
+	return f.bootTimeout
+}
+
+func (f *flags) Output() string {
+	return f.output
+}
+
+func (f *flags) OutputFile() string {
+	return f.outputFile
+}
+
+func (f *flags) OTLPEndpoint() string {
+	return f.otlpEndpoint
+}
+
 func (f *flags) printVersionInformation() error {
 	buildInfo, ok := debug.ReadBuildInfo()
 	if !ok {
@@ -214,10 +850,49 @@ func (f *flags) ParseArgs(args []string) error {
 		return &ParseArgsError{msg: "version requested", err: err}
 	}
 
-	if f.spec.Qemu.Kernel == "" {
+	switch f.dryRunFormat {
+	case dryRunFormatText, dryRunFormatJSON:
+	default:
+		return f.fail("unknown dry run format: "+f.dryRunFormat, nil)
+	}
+
+	switch f.output {
+	case "", outputFormatJSON:
+	default:
+		return f.fail("unknown output format: "+f.output, nil)
+	}
+
+	switch f.exitCodes.mode {
+	case exitCodeModePassthrough, exitCodeModeClamp:
+	default:
+		return f.fail("unknown exit code mode: "+f.exitCodes.mode, nil)
+	}
+
+	switch f.logFormat {
+	case logFormatText, logFormatJSON:
+	default:
+		return f.fail("unknown log format: "+f.logFormat, nil)
+	}
+
+	// The kernel of a server is given to the server.
+	if f.spec.Qemu.Kernel == "" && f.server == "" {
 		return f.fail("no kernel given (use -kernel)", nil)
 	}
 
+	if f.spec.Qemu.IDMappings != "" && !f.spec.Qemu.UserNamespace {
+		return f.fail("-idMappings requires a user namespace (use -userns)",
+			nil)
+	}
+
+	limits := f.spec.Qemu.ProcessLimits
+	if len(limits.CgroupLimits) > 0 && limits.Cgroup == "" {
+		return f.fail("-cgroupLimit requires a cgroup (use -cgroup)", nil)
+	}
+
+	if f.spec.Qemu.UKI && f.spec.Qemu.Firmware == "" {
+		return f.fail("-uki requires UEFI firmware (use -firmware)", nil)
+	}
+
 	positionalArgs := f.flagSet.Args()
 
 	// First positional argument is supposed to be a binary file.
@@ -236,5 +911,116 @@ func (f *flags) ParseArgs(args []string) error {
 	// the guest system's init program.
 	f.spec.Qemu.InitArgs = positionalArgs[1:]
 
+	if f.spec.Initramfs.Archive != "" && !reusableInitramfs(f.spec.Initramfs) {
+		return f.fail("-initramfs can not be combined with flags for the "+
+			"content of the initramfs", nil)
+	}
+
+	// Read-only volumes are made read-only by the init.
+	for _, volume := range f.spec.Initramfs.Volumes {
+		if volume.ReadOnly {
+			f.spec.Qemu.ReadOnlyPaths = append(f.spec.Qemu.ReadOnlyPaths,
+				volume.Target)
+		}
+	}
+
+	// Metrics are sampled only if they are written somewhere.
+	if f.metricsFile != "" {
+		f.spec.Qemu.MetricsInterval = metricsInterval
+	}
+
 	return nil
 }
+
+// reusableInitramfs returns true if the given [virtrun.Initramfs] has no
+// parameters for building the archive file set.
+func reusableInitramfs(cfg virtrun.Initramfs) bool {
+	return !cfg.StandaloneInit && !cfg.Keep &&
+		len(cfg.Files) == 0 &&
+		len(cfg.FileTargets) == 0 &&
+		len(cfg.Modules) == 0 &&
+		len(cfg.KernelModules) == 0 &&
+		len(cfg.BinfmtFiles) == 0 &&
+		cfg.InitConfig == "" &&
+		len(cfg.Volumes) == 0 &&
+		cfg.Image == ""
+}
+
+// addInitramfsFlags adds the flags for the content of the initramfs to the
+// given [flag.FlagSet].
+func addInitramfsFlags(fs *flag.FlagSet, cfg *virtrun.Initramfs) {
+	fs.BoolVar(
+		&cfg.StandaloneInit,
+		"standalone",
+		cfg.StandaloneInit,
+		"run first given file as init itself. Use this if it has virtrun"+
+			" support built in. Additional files and modules are added like"+
+			" in wrapped mode.",
+	)
+
+	fs.Var(
+		&FileList{Files: &cfg.Files, Targets: &cfg.FileTargets},
+		"addFile",
+		"file to add to guest's /data dir. With HOSTPATH:TARGET, the file "+
+			"is added as TARGET instead, which is either an absolute guest "+
+			"path, like ./foo.conf:/etc/foo.conf, or a file name in /data. "+
+			"Flag may be used more than once.",
+	)
+
+	fs.Var(
+		(*FilePathList)(&cfg.Modules),
+		"addModule",
+		"kernel module to add to guest. Flag may be used more than once.",
+	)
+
+	fs.Var(
+		(*KernelModuleList)(&cfg.KernelModules),
+		"module",
+		"kernel module to load in the guest, given by name, like veth, or "+
+			"by .ko path. Names are resolved in the -kernelModulesDir. "+
+			"Modules it depends on are added as well. Flag may be used more "+
+			"than once.",
+	)
+
+	fs.Var(
+		(*FilePath)(&cfg.KernelModulesDir),
+		"kernelModulesDir",
+		"kernel modules directory with modules.dep for -module, like "+
+			"/lib/modules/6.12.1.",
+	)
+
+	fs.Var(
+		(*FilePathList)(&cfg.BinfmtFiles),
+		"addBinfmt",
+		"binfmt_misc rule file in binfmt.d(5) format to register in the "+
+			"guest. Interpreters must be added with -addFile. Flag may be "+
+			"used more than once.",
+	)
+
+	fs.Var(
+		(*FilePath)(&cfg.InitConfig),
+		"initConfig",
+		"JSON file with environment variables, additional arguments and "+
+			"commands to run before the binary for the init in the guest. "+
+			"Not supported in standalone mode.",
+	)
+
+	fs.StringVar(
+		&cfg.Image,
+		"image",
+		cfg.Image,
+		"OCI image to run the binary chrooted into: an OCI image layout "+
+			"directory, an image tarball as written by \"docker save\" or "+
+			"an image name to fetch with skopeo, like "+
+			"docker.io/library/alpine:3. Not supported in standalone mode.",
+	)
+
+	fs.StringVar(
+		&cfg.LibCacheDir,
+		"libCache",
+		cmp.Or(cfg.LibCacheDir, os.Getenv("VIRTRUN_LIB_CACHE")),
+		"directory to cache the shared libraries resolved for ELF files in. "+
+			"Entries are invalidated if the libraries change. "+
+			"(default from env VIRTRUN_LIB_CACHE)",
+	)
+}
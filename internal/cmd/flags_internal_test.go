@@ -7,8 +7,10 @@ package cmd
 import (
 	"io"
 	"testing"
+	"time"
 
 	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
 	"github.com/aibor/virtrun/internal/virtrun"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,6 +20,10 @@ func TestFlags_ParseArgs(t *testing.T) {
 	absBinPath, err := AbsoluteFilePath("bin.test")
 	require.NoError(t, err)
 
+	t.Setenv("VIRTRUN_TEST_SET", "on host")
+	t.Setenv("VIRTRUN_TEST_INVALID", "with \"quotes\"")
+	t.Setenv("GOCOVERDIR", "")
+
 	tests := []struct {
 		name              string
 		args              []string
@@ -62,6 +68,481 @@ func TestFlags_ParseArgs(t *testing.T) {
 			},
 			expecterErr: &ParseArgsError{},
 		},
+		{
+			name: "reserved kernel param",
+			args: []string{
+				"-kernel=/boot/this",
+				"-kernelAppend=nokaslr console=ttyS1",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "invalid env var",
+			args: []string{
+				"-kernel=/boot/this",
+				"-env=NOVALUE",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "invalid mount options",
+			args: []string{
+				"-kernel=/boot/this",
+				"-mountOptions=tmp:size=1G",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "relative collect pattern",
+			args: []string{
+				"-kernel=/boot/this",
+				"-collect=*.xml",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "invalid id mappings",
+			args: []string{
+				"-kernel=/boot/this",
+				"-idMappings=0:1000",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "id mappings without userns",
+			args: []string{
+				"-kernel=/boot/this",
+				"-idMappings=0:1000:1",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "oom score adj out of range",
+			args: []string{
+				"-kernel=/boot/this",
+				"-oomScoreAdj=-1001",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "unknown dry run format",
+			args: []string{
+				"-kernel=/boot/this",
+				"-dryRun",
+				"-dryRunFormat=yaml",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "unknown output format",
+			args: []string{
+				"-kernel=/boot/this",
+				"-output=xml",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "unknown exit code mode",
+			args: []string{
+				"-kernel=/boot/this",
+				"-exitCodeMode=ignore",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "reserved infra exit code",
+			args: []string{
+				"-kernel=/boot/this",
+				"-infraExitCode=1",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "volume without guest path",
+			args: []string{
+				"-kernel=/boot/this",
+				"-volume=/srv/testdata",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "volume hidden by mount",
+			args: []string{
+				"-kernel=/boot/this",
+				"-volume=/srv/testdata:/tmp/testdata",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "volumes",
+			args: []string{
+				"-kernel=/boot/this",
+				"-volume=/srv/testdata:/srv/testdata/:ro",
+				"-volume=/etc/hosts:/etc/hosts",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+					Volumes: []virtrun.Volume{
+						{
+							Source:   "/srv/testdata",
+							Target:   "/srv/testdata",
+							ReadOnly: true,
+						},
+						{
+							Source: "/etc/hosts",
+							Target: "/etc/hosts",
+						},
+					},
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:        "/boot/this",
+					CPU:           "max",
+					Memory:        256,
+					SMP:           1,
+					InitArgs:      []string{},
+					ReadOnlyPaths: []string{"/srv/testdata"},
+				},
+			},
+		},
+		{
+			name: "invalid host cpus",
+			args: []string{
+				"-kernel=/boot/this",
+				"-hostCPUs=3-1",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "host cpu above cpu set size",
+			args: []string{
+				"-kernel=/boot/this",
+				"-hostCPUs=1020-1024",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "invalid ionice",
+			args: []string{
+				"-kernel=/boot/this",
+				"-ionice=idle:8",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "cgroup limit without cgroup",
+			args: []string{
+				"-kernel=/boot/this",
+				"-cgroupLimit=memory.max=1G",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "file target hidden by mount",
+			args: []string{
+				"-kernel=/boot/this",
+				"-addFile=/srv/foo.conf:/run/foo.conf",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "file target relative path",
+			args: []string{
+				"-kernel=/boot/this",
+				"-addFile=/srv/foo.conf:etc/foo.conf",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "file targets",
+			args: []string{
+				"-kernel=/boot/this",
+				"-addFile=/srv/foo.conf:/etc/app//foo.conf,/srv/tool-amd64:tool",
+				"-addFile=/srv/plain",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+					Files:  []string{"/srv/plain"},
+					FileTargets: []virtrun.FileTarget{
+						{
+							Source: "/srv/foo.conf",
+							Target: "/etc/app/foo.conf",
+						},
+						{
+							Source: "/srv/tool-amd64",
+							Target: "tool",
+						},
+					},
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:   "/boot/this",
+					CPU:      "max",
+					Memory:   256,
+					SMP:      1,
+					InitArgs: []string{},
+				},
+			},
+		},
+		{
+			name: "forward with relative path",
+			args: []string{
+				"-kernel=/boot/this",
+				"-forward=unix:db.sock=tcp:127.0.0.1:5432",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "forwards",
+			args: []string{
+				"-kernel=/boot/this",
+				"-forward=tcp:127.0.0.1:5432=unix:/run/db.sock",
+				"-forward=unix:/run/cache.sock=tcp:localhost:6379",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:   "/boot/this",
+					CPU:      "max",
+					Memory:   256,
+					SMP:      1,
+					InitArgs: []string{},
+					Forwards: []virtrun.Forward{
+						{
+							Guest: "tcp:127.0.0.1:5432",
+							Host:  "unix:/run/db.sock",
+						},
+						{
+							Guest: "unix:/run/cache.sock",
+							Host:  "tcp:localhost:6379",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "debug tool",
+			args: []string{
+				"-kernel=/boot/this",
+				"-debugTool=/bin/sh -x",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+					Files:  []string{"/bin/sh"},
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:    "/boot/this",
+					CPU:       "max",
+					Memory:    256,
+					SMP:       1,
+					InitArgs:  []string{},
+					DebugTool: []string{"/data/sh", "-x"},
+				},
+			},
+		},
+		{
+			name: "debug tool with semicolon",
+			args: []string{
+				"-kernel=/boot/this",
+				"-debugTool=/bin/sh -c;true",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "env passthrough",
+			args: []string{
+				"-kernel=/boot/this",
+				"-env=FOO=bar",
+				"-envPassthrough=VIRTRUN_TEST_SET",
+				"-envPassthrough=VIRTRUN_TEST_UNSET",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:   "/boot/this",
+					CPU:      "max",
+					Memory:   256,
+					SMP:      1,
+					InitArgs: []string{},
+					Env:      []string{"FOO=bar", "VIRTRUN_TEST_SET=on host"},
+				},
+			},
+		},
+		{
+			name: "env passthrough invalid value",
+			args: []string{
+				"-kernel=/boot/this",
+				"-envPassthrough=VIRTRUN_TEST_INVALID",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "keep initramfs with path",
+			args: []string{
+				"-kernel=/boot/this",
+				"-keepInitramfs=/tmp/initramfs.cpio",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+					Keep:   true,
+					Output: "/tmp/initramfs.cpio",
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:   "/boot/this",
+					CPU:      "max",
+					Memory:   256,
+					SMP:      1,
+					InitArgs: []string{},
+				},
+			},
+		},
+		{
+			name: "reuse initramfs",
+			args: []string{
+				"-kernel=/boot/this",
+				"-initramfs=/tmp/initramfs.cpio",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary:  absBinPath,
+					Archive: "/tmp/initramfs.cpio",
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:   "/boot/this",
+					CPU:      "max",
+					Memory:   256,
+					SMP:      1,
+					InitArgs: []string{},
+				},
+			},
+		},
+		{
+			name: "reuse initramfs with content flags",
+			args: []string{
+				"-kernel=/boot/this",
+				"-initramfs=/tmp/initramfs.cpio",
+				"-addFile=/etc/hosts",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "uki without firmware",
+			args: []string{
+				"-kernel=/boot/this",
+				"-uki",
+				"bin.test",
+			},
+			expecterErr: &ParseArgsError{},
+		},
+		{
+			name: "uki",
+			args: []string{
+				"-kernel=/boot/this",
+				"-firmware=/usr/share/ovmf/OVMF.fd",
+				"-uki",
+				"-ukifyArg=--secureboot-private-key=key.pem",
+				"-ukifyArg=--secureboot-certificate=cert.pem",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:   "/boot/this",
+					Firmware: "/usr/share/ovmf/OVMF.fd",
+					UKI:      true,
+					UKIfyArgs: []string{
+						"--secureboot-private-key=key.pem",
+						"--secureboot-certificate=cert.pem",
+					},
+					CPU:      "max",
+					Memory:   256,
+					SMP:      1,
+					InitArgs: []string{},
+				},
+			},
+		},
+		{
+			name: "host root",
+			args: []string{
+				"-kernel=/boot/this",
+				"-hostRoot",
+				"-virtiofsd=/opt/virtiofsd",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:    "/boot/this",
+					HostRoot:  true,
+					Virtiofsd: "/opt/virtiofsd",
+					CPU:       "max",
+					Memory:    256,
+					SMP:       1,
+					InitArgs:  []string{},
+				},
+			},
+		},
+		{
+			name: "kernel config",
+			args: []string{
+				"-kernel=/boot/this",
+				"-kernelConfig=/boot/config-this",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:       "/boot/this",
+					KernelConfig: "/boot/config-this",
+					CPU:          "max",
+					Memory:       256,
+					SMP:          1,
+					InitArgs:     []string{},
+				},
+			},
+		},
 		{
 			name: "debug",
 			args: []string{
@@ -83,6 +564,50 @@ func TestFlags_ParseArgs(t *testing.T) {
 			},
 			expectedDebugFlag: true,
 		},
+		{
+			name: "console log",
+			args: []string{
+				"-kernel=/boot/this",
+				"-artifactDir=/tmp/artifacts",
+				"-consoleLog",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:      "/boot/this",
+					CPU:         "max",
+					Memory:      256,
+					SMP:         1,
+					InitArgs:    []string{},
+					ArtifactDir: "/tmp/artifacts",
+					ConsoleLog:  true,
+				},
+			},
+		},
+		{
+			name: "metrics file",
+			args: []string{
+				"-kernel=/boot/this",
+				"-metricsFile", "/tmp/metrics.json",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+				},
+				Qemu: virtrun.Qemu{
+					Kernel:          "/boot/this",
+					CPU:             "max",
+					Memory:          256,
+					SMP:             1,
+					InitArgs:        []string{},
+					MetricsInterval: time.Second,
+				},
+			},
+		},
 		{
 			name: "simple go test invocation",
 			args: []string{
@@ -117,14 +642,47 @@ func TestFlags_ParseArgs(t *testing.T) {
 				"-machine=pc",
 				"-transport", "mmio",
 				"-memory=269",
+				"-kernelAppend", `nokaslr dyndbg="file a.c +p"`,
 				"-verbose",
+				"-pty",
+				"-env", "FOO=bar",
+				"-env", "EMPTY=",
+				"-console", "-",
+				"-console", "/tmp/trace.log",
+				"-failOnKernelReport",
+				"-mountOptions", "/tmp:size=2G,nosuid",
+				"-sysctl", "vm.panic_on_oom=1",
+				"-oomScoreAdj", "-1000",
+				"-zramSwap", "512",
+				"-seed", "1234",
+				"-autoloadModules",
+				"-userns",
+				"-idMappings", "0:1000:1;1:100000:65535",
+				"-collect", "/tmp/*.xml",
+				"-artifactDir", "/tmp/artifacts",
+				"-rawConsoleDir", "/tmp/raw",
+				"-kernelLog",
+				"-control",
+				"-heartbeatTimeout", "30s",
+				"-hostCPUs", "0-2,6",
+				"-nice", "10",
+				"-ionice", "best-effort:7",
+				"-cgroup", "/sys/fs/cgroup/ci/virtrun",
+				"-cgroupLimit", "memory.max=1G",
 				"-smp", "7",
 				"-nokvm=true",
+				"-nocontainer",
 				"-standalone",
 				"-noGoTestFlagRewrite",
 				"-keepInitramfs",
+				"-noMemfd",
 				"-addFile", "/file2",
 				"-addFile", "/dir/file3",
+				"-pushFile", "/input.bin",
+				"-addBinfmt", "/etc/binfmt.d/qemu-aarch64.conf",
+				"-module", "veth,/mod/tun.ko",
+				"-kernelModulesDir", "/lib/modules/6.12.1",
+				"-initConfig", "/init.json",
 				"bin.test",
 				"-test.paniconexit0",
 				"-test.v=true",
@@ -137,24 +695,63 @@ func TestFlags_ParseArgs(t *testing.T) {
 						"/file2",
 						"/dir/file3",
 					},
-					StandaloneInit: true,
-					Keep:           true,
+					BinfmtFiles: []string{
+						"/etc/binfmt.d/qemu-aarch64.conf",
+					},
+					KernelModules:    []string{"veth", "/mod/tun.ko"},
+					KernelModulesDir: "/lib/modules/6.12.1",
+					InitConfig:       "/init.json",
+					StandaloneInit:   true,
+					Keep:             true,
+					NoMemfd:          true,
 				},
 				Qemu: virtrun.Qemu{
-					Kernel:        "/boot/this",
-					CPU:           "host",
-					Machine:       "pc",
-					TransportType: qemu.TransportTypeMMIO,
-					Memory:        269,
-					NoKVM:         true,
-					SMP:           7,
+					Kernel:            "/boot/this",
+					CPU:               "host",
+					Machine:           "pc",
+					TransportType:     qemu.TransportTypeMMIO,
+					Memory:            269,
+					NoKVM:             true,
+					NoContainerDetect: true,
+					SMP:               7,
 					InitArgs: []string{
 						"-test.paniconexit0",
 						"-test.v=true",
 						"-test.timeout=10m0s",
 					},
+					KernelParams: []string{
+						"nokaslr",
+						`dyndbg="file a.c +p"`,
+					},
 					Verbose:             true,
 					NoGoTestFlagRewrite: true,
+					PTY:                 true,
+					Env:                 []string{"FOO=bar", "EMPTY="},
+					Consoles:            []string{"-", "/tmp/trace.log"},
+					FailOnKernelReport:  true,
+					MountOptions:        []string{"/tmp:size=2G,nosuid"},
+					Sysctls:             []string{"vm.panic_on_oom=1"},
+					OOMScoreAdj:         -1000,
+					ZramSwap:            512,
+					Seed:                "1234",
+					ModulesAutoload:     true,
+					UserNamespace:       true,
+					IDMappings:          "0:1000:1;1:100000:65535",
+					Collect:             []string{"/tmp/*.xml"},
+					ArtifactDir:         "/tmp/artifacts",
+					RawConsoleDir:       "/tmp/raw",
+					KernelLog:           true,
+					PushFiles:           []string{"/input.bin"},
+					Control:             true,
+					HeartbeatTimeout:    30 * time.Second,
+					ProcessLimits: sys.ProcessLimits{
+						CPUs:         []int{0, 1, 2, 6},
+						Nice:         10,
+						IOClass:      sys.IOClassBestEffort,
+						IOLevel:      7,
+						Cgroup:       "/sys/fs/cgroup/ci/virtrun",
+						CgroupLimits: []string{"memory.max=1G"},
+					},
 				},
 			},
 		},
@@ -204,3 +801,105 @@ func TestFlags_ParseArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestFlags_CoverDir(t *testing.T) {
+	t.Setenv("GOCOVERDIR", "/host/cover")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "from env",
+			args:     []string{"-kernel=/boot/this", "bin.test"},
+			expected: "/host/cover",
+		},
+		{
+			name: "flag",
+			args: []string{
+				"-kernel=/boot/this",
+				"-coverDir=/other/cover",
+				"bin.test",
+			},
+			expected: "/other/cover",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := newFlags("test", io.Discard)
+
+			err := flags.ParseArgs(tt.args)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, flags.spec.Qemu.CoverDir)
+		})
+	}
+}
+
+func TestFlags_OTLPEndpoint(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "from env",
+			args:     []string{"-kernel=/boot/this", "bin.test"},
+			expected: "http://collector:4318/v1/traces",
+		},
+		{
+			name: "flag",
+			args: []string{
+				"-kernel=/boot/this",
+				"-otlpEndpoint=http://localhost:4318/v1/traces",
+				"bin.test",
+			},
+			expected: "http://localhost:4318/v1/traces",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := newFlags("test", io.Discard)
+
+			err := flags.ParseArgs(tt.args)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, flags.OTLPEndpoint())
+		})
+	}
+}
+
+func TestFlags_LineFilters(t *testing.T) {
+	flags := newFlags("test", io.Discard)
+
+	err := flags.ParseArgs([]string{
+		"-kernel=/boot/this",
+		"-redactOutput", `token=\w+`,
+		"-failOnOutput", "suspicious RCU usage",
+		"bin.test",
+	})
+	require.NoError(t, err)
+	require.Len(t, flags.spec.Qemu.LineFilters, 2)
+
+	line, err := flags.spec.Qemu.LineFilters[0]([]byte("token=abc"))
+	require.NoError(t, err)
+	assert.Equal(t, "[REDACTED]", string(line))
+
+	_, err = flags.spec.Qemu.LineFilters[1]([]byte("suspicious RCU usage"))
+	require.ErrorIs(t, err, qemu.ErrGuestOutputMatch)
+
+	flags = newFlags("test", io.Discard)
+
+	err = flags.ParseArgs([]string{
+		"-kernel=/boot/this",
+		"-failOnOutput", "(",
+		"bin.test",
+	})
+	require.ErrorIs(t, err, &ParseArgsError{})
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/forward"
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// ForwardList is a list of host sockets exposed in the guest in the form
+// "GUESTADDRESS=HOSTADDRESS". Addresses are in the form "unix:PATH" or
+// "tcp:HOST:PORT".
+type ForwardList []virtrun.Forward
+
+func (l *ForwardList) String() string {
+	forwards := make([]string, len(*l))
+
+	for idx, fwd := range *l {
+		forwards[idx] = fwd.Guest.String() + "=" + fwd.Host.String()
+	}
+
+	return strings.Join(forwards, ",")
+}
+
+func (l *ForwardList) Set(s string) error {
+	guest, host, found := strings.Cut(s, "=")
+	if !found {
+		return fmt.Errorf("%w: not GUESTADDRESS=HOSTADDRESS: %s",
+			ErrInvalidForward, s)
+	}
+
+	guestAddress, err := forward.ParseAddress(guest)
+	if err != nil {
+		return fmt.Errorf("%w: guest: %w", ErrInvalidForward, err)
+	}
+
+	hostAddress, err := forward.ParseAddress(host)
+	if err != nil {
+		return fmt.Errorf("%w: host: %w", ErrInvalidForward, err)
+	}
+
+	*l = append(*l, virtrun.Forward{Guest: guestAddress, Host: hostAddress})
+
+	return nil
+}
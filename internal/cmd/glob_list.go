@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// GlobList is a list of glob patterns for guest file paths as supported by
+// [filepath.Match].
+type GlobList []string
+
+func (g *GlobList) String() string {
+	return strings.Join(*g, ";")
+}
+
+func (g *GlobList) Set(s string) error {
+	_, err := filepath.Match(s, "")
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: %w: %s", ErrInvalidGlob, err, s)
+	case !filepath.IsAbs(s):
+		return fmt.Errorf("%w: path not absolute: %s", ErrInvalidGlob, s)
+	case strings.ContainsAny(s, " \t\n\";"):
+		return fmt.Errorf("%w: invalid character: %s", ErrInvalidGlob, s)
+	}
+
+	*g = append(*g, s)
+
+	return nil
+}
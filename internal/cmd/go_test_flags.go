@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+const (
+	goTestFlagRewriteAll  = "all"
+	goTestFlagRewriteNone = "none"
+)
+
+// goTestFlagRewriteValue selects the go test flags that are rewritten. It is
+// a comma separated list of names of [virtrun.GoTestFlagsRewritable], "all"
+// or "none".
+type goTestFlagRewriteValue struct {
+	cfg *virtrun.Qemu
+}
+
+func (g *goTestFlagRewriteValue) String() string {
+	switch {
+	case g.cfg == nil:
+		return ""
+	case g.cfg.NoGoTestFlagRewrite:
+		return goTestFlagRewriteNone
+	case len(g.cfg.GoTestFlagRewrite) == 0:
+		return goTestFlagRewriteAll
+	default:
+		return strings.Join(g.cfg.GoTestFlagRewrite, ",")
+	}
+}
+
+func (g *goTestFlagRewriteValue) Set(s string) error {
+	switch s {
+	case goTestFlagRewriteAll:
+		g.cfg.NoGoTestFlagRewrite = false
+		g.cfg.GoTestFlagRewrite = nil
+
+		return nil
+	case goTestFlagRewriteNone:
+		g.cfg.NoGoTestFlagRewrite = true
+		g.cfg.GoTestFlagRewrite = nil
+
+		return nil
+	}
+
+	names := strings.Split(s, ",")
+
+	for _, name := range names {
+		if !slices.Contains(virtrun.GoTestFlagsRewritable, name) {
+			return fmt.Errorf("%w: %s", ErrUnknownGoTestFlag, name)
+		}
+	}
+
+	g.cfg.NoGoTestFlagRewrite = false
+	g.cfg.GoTestFlagRewrite = names
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoTestFlagRewriteValue(t *testing.T) {
+	tests := []struct {
+		name          string
+		inputs        []string
+		expectedNo    bool
+		expectedNames []string
+		expectedStr   string
+		expectedErr   error
+	}{
+		{
+			name:        "default",
+			expectedStr: "all",
+		},
+		{
+			name:          "selected",
+			inputs:        []string{"coverprofile,outputdir"},
+			expectedNames: []string{"coverprofile", "outputdir"},
+			expectedStr:   "coverprofile,outputdir",
+		},
+		{
+			name:        "none",
+			inputs:      []string{"coverprofile", "none"},
+			expectedNo:  true,
+			expectedStr: "none",
+		},
+		{
+			name:        "all",
+			inputs:      []string{"none", "all"},
+			expectedStr: "all",
+		},
+		{
+			name:        "unknown",
+			inputs:      []string{"coverprofile,json"},
+			expectedErr: ErrUnknownGoTestFlag,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg virtrun.Qemu
+
+			value := &goTestFlagRewriteValue{cfg: &cfg}
+
+			for _, input := range tt.inputs {
+				err := value.Set(input)
+				if tt.expectedErr != nil {
+					require.ErrorIs(t, err, tt.expectedErr)
+					return
+				}
+
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.expectedNo, cfg.NoGoTestFlagRewrite)
+			assert.Equal(t, tt.expectedNames, cfg.GoTestFlagRewrite)
+			assert.Equal(t, tt.expectedStr, value.String())
+		})
+	}
+}
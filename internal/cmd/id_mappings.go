@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aibor/virtrun/sysinit"
+)
+
+// IDMappings is a list of user namespace ID mappings in the form
+// "CONTAINERID:HOSTID:SIZE;CONTAINERID:HOSTID:SIZE".
+type IDMappings string
+
+func (m *IDMappings) String() string {
+	return string(*m)
+}
+
+func (m *IDMappings) Set(s string) error {
+	_, err := sysinit.ParseIDMappings(s)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidIDMappings, err)
+	}
+
+	*m = IDMappings(s)
+
+	return nil
+}
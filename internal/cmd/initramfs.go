@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aibor/virtrun/internal/initramfs"
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// buildInitramfs writes the initramfs archive for the given binary, like it is
+// built by the "run" subcommand, into a file.
+func buildInitramfs(args []string, _ io.Reader, _, stderr io.Writer) error {
+	var (
+		cfg    virtrun.Initramfs
+		output = "initramfs.cpio"
+	)
+
+	fs := flag.NewFlagSet(args[0]+" [flags...] binary", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.StringVar(&output, "output", output, "path of the archive file")
+	addInitramfsFlags(fs, &cfg)
+
+	binary, err := parseSinglePositional(fs, args[1:], "binary")
+	if err != nil {
+		return err
+	}
+
+	cfg.Binary, err = AbsoluteFilePath(binary)
+	if err != nil {
+		return fmt.Errorf("binary path: %w", err)
+	}
+
+	err = validateInitramfs(cfg)
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	defer setupProgress(&cfg, stderr)()
+
+	err = virtrun.WriteInitramfsArchive(ctx, cfg, output)
+	if err != nil {
+		return fmt.Errorf("build initramfs: %w", err)
+	}
+
+	return nil
+}
+
+// inspectInitramfs lists the content of an initramfs archive file like
+// "ls -l" does.
+func inspectInitramfs(
+	args []string,
+	_ io.Reader,
+	stdout, stderr io.Writer,
+) error {
+	fs := flag.NewFlagSet(args[0]+" archive", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	path, err := parseSinglePositional(fs, args[1:], "archive")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer file.Close()
+
+	headers, err := initramfs.ReadCPIOHeaders(file)
+	if err != nil {
+		return fmt.Errorf("read archive: %w", err)
+	}
+
+	for _, header := range headers {
+		fmt.Fprintf(stdout, "%s %10d %s",
+			header.FileInfo().Mode(), header.Size, header.Name)
+
+		if header.Linkname != "" {
+			fmt.Fprintf(stdout, " -> %s", header.Linkname)
+		}
+
+		fmt.Fprintln(stdout)
+	}
+
+	return nil
+}
+
+// parseSinglePositional parses the given arguments with the given
+// [flag.FlagSet] and returns the only positional argument. The name is used
+// for the error message if there is none.
+func parseSinglePositional(
+	fs *flag.FlagSet,
+	args []string,
+	name string,
+) (string, error) {
+	err := fs.Parse(args)
+	if err != nil {
+		return "", &ParseArgsError{msg: "flag parse", err: err}
+	}
+
+	if fs.NArg() != 1 {
+		err := &ParseArgsError{msg: "exactly one " + name + " required"}
+		fmt.Fprintln(fs.Output(), err.Error())
+		fs.Usage()
+
+		return "", err
+	}
+
+	return fs.Arg(0), nil
+}
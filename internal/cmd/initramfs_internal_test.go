@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/aibor/virtrun/internal/initramfs"
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectInitramfs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "initramfs.cpio")
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+
+	writer := initramfs.NewCPIOFSWriter(file)
+	require.NoError(t, writer.AddFS(fstest.MapFS{
+		"init": {Data: []byte("bin"), Mode: 0o755},
+		"lib":  {Mode: 0o755 | os.ModeDir},
+		"lib64": {
+			Data: []byte("lib"),
+			Mode: 0o777 | os.ModeSymlink,
+		},
+	}))
+	require.NoError(t, writer.Close())
+	require.NoError(t, file.Close())
+
+	var stdout bytes.Buffer
+
+	err = inspectInitramfs(
+		[]string{"inspect", path},
+		nil,
+		&stdout,
+		io.Discard,
+	)
+	require.NoError(t, err)
+
+	expected := "" +
+		"dr-xr-xr-x          0 .\n" +
+		"-rwxr-xr-x          3 init\n" +
+		"drwxr-xr-x          0 lib\n" +
+		"Lrwxrwxrwx          0 lib64 -> lib\n"
+	assert.Equal(t, expected, stdout.String())
+}
+
+func TestInspectInitramfs_Args(t *testing.T) {
+	err := inspectInitramfs([]string{"inspect"}, nil, io.Discard, io.Discard)
+	require.ErrorIs(t, err, &ParseArgsError{})
+	assert.ErrorContains(t, err, "exactly one archive required")
+}
+
+func TestValidateInitramfs_ImageConflict(t *testing.T) {
+	binary, err := os.Executable()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		cfg  virtrun.Initramfs
+	}{
+		{
+			name: "standalone",
+			cfg: virtrun.Initramfs{
+				Binary:         binary,
+				Image:          "alpine",
+				StandaloneInit: true,
+			},
+		},
+		{
+			name: "volume",
+			cfg: virtrun.Initramfs{
+				Binary: binary,
+				Image:  "alpine",
+				Volumes: []virtrun.Volume{
+					{Source: t.TempDir(), Target: "/srv"},
+				},
+			},
+		},
+		{
+			name: "file target",
+			cfg: virtrun.Initramfs{
+				Binary: binary,
+				Image:  "alpine",
+				FileTargets: []virtrun.FileTarget{
+					{Source: binary, Target: "/etc/foo.conf"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInitramfs(tt.cfg)
+			require.ErrorIs(t, err, ErrImageConflict)
+		})
+	}
+}
+
+func TestValidate_HostRootConflict(t *testing.T) {
+	binary, err := os.Executable()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		cfg  virtrun.Initramfs
+	}{
+		{
+			name: "standalone",
+			cfg: virtrun.Initramfs{
+				Binary:         binary,
+				StandaloneInit: true,
+			},
+		},
+		{
+			name: "image",
+			cfg: virtrun.Initramfs{
+				Binary: binary,
+				Image:  "alpine",
+			},
+		},
+		{
+			name: "volume",
+			cfg: virtrun.Initramfs{
+				Binary: binary,
+				Volumes: []virtrun.Volume{
+					{Source: t.TempDir(), Target: "/srv"},
+				},
+			},
+		},
+		{
+			name: "file target",
+			cfg: virtrun.Initramfs{
+				Binary: binary,
+				FileTargets: []virtrun.FileTarget{
+					{Source: binary, Target: "/etc/foo.conf"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &virtrun.Spec{
+				Qemu:      virtrun.Qemu{Kernel: binary, HostRoot: true},
+				Initramfs: tt.cfg,
+			}
+
+			err := Validate(spec)
+			require.ErrorIs(t, err, ErrHostRootConflict)
+		})
+	}
+}
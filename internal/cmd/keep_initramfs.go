@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"strconv"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// keepInitramfsValue is a boolean flag that optionally takes the path to
+// write the initramfs archive file to as value instead.
+type keepInitramfsValue struct {
+	cfg *virtrun.Initramfs
+}
+
+func (*keepInitramfsValue) IsBoolFlag() bool {
+	return true
+}
+
+func (k *keepInitramfsValue) String() string {
+	if k.cfg == nil {
+		return "false"
+	}
+
+	if k.cfg.Output != "" {
+		return k.cfg.Output
+	}
+
+	return strconv.FormatBool(k.cfg.Keep)
+}
+
+func (k *keepInitramfsValue) Set(s string) error {
+	keep, err := strconv.ParseBool(s)
+	if err != nil {
+		path, err := AbsoluteFilePath(s)
+		if err != nil {
+			return err
+		}
+
+		k.cfg.Output = path
+		keep = true
+	}
+
+	k.cfg.Keep = keep
+
+	return nil
+}
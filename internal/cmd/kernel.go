@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/kernelcache"
+)
+
+// KernelPath is a [FilePath] that also accepts a reference to a cached
+// kernel prefixed with [kernelcache.RefPrefix], like "cache:6.6-amd64", or a
+// [kernelcache.Constraint] with the same prefix, like "cache:>=6.1,arm64".
+// The reference is resolved to the path of the cached kernel. The constraint
+// is resolved to the path of the newest cached kernel satisfying it.
+type KernelPath string
+
+func (k *KernelPath) String() string {
+	return string(*k)
+}
+
+func (k *KernelPath) Set(s string) error {
+	name, isRef := strings.CutPrefix(s, kernelcache.RefPrefix)
+	if !isRef {
+		return (*FilePath)(k).Set(s)
+	}
+
+	if kernelcache.IsConstraint(name) {
+		return k.setConstraint(name)
+	}
+
+	ref, err := kernelcache.ParseRef(name)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	cache, err := kernelCache()
+	if err != nil {
+		return err
+	}
+
+	path, err := cache.Lookup(ref)
+	if err != nil {
+		return fmt.Errorf("%w (use \"virtrun kernel fetch\")", err)
+	}
+
+	*k = KernelPath(path)
+
+	return nil
+}
+
+// setConstraint sets the path of the newest cached kernel satisfying the
+// given [kernelcache.Constraint].
+func (k *KernelPath) setConstraint(s string) error {
+	constraint, err := kernelcache.ParseConstraint(s)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	cache, err := kernelCache()
+	if err != nil {
+		return err
+	}
+
+	ref, err := cache.Select(constraint)
+	if err != nil {
+		return fmt.Errorf("%w (use \"virtrun kernel fetch\")", err)
+	}
+
+	*k = KernelPath(cache.Path(ref))
+
+	return nil
+}
+
+// kernelCache returns the [kernelcache.Cache] in the directory given by the
+// environment variable VIRTRUN_KERNEL_CACHE, if set. Otherwise, it is the
+// [kernelcache.DefaultDir].
+func kernelCache() (kernelcache.Cache, error) {
+	if dir := os.Getenv("VIRTRUN_KERNEL_CACHE"); dir != "" {
+		return kernelcache.Cache{Dir: dir}, nil
+	}
+
+	dir, err := kernelcache.DefaultDir()
+	if err != nil {
+		return kernelcache.Cache{}, fmt.Errorf("kernel cache dir: %w", err)
+	}
+
+	return kernelcache.Cache{Dir: dir}, nil
+}
+
+// kernel manages the kernel cache with its own subcommands "fetch" and
+// "list".
+func kernel(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	kernelSubcommands := map[string]subcommand{
+		"fetch": fetchKernel,
+		"list":  listKernels,
+	}
+
+	if len(args) > 1 {
+		if fn, exists := kernelSubcommands[args[1]]; exists {
+			cmdArgs := append([]string{args[0] + " " + args[1]}, args[2:]...)
+			return fn(cmdArgs, stdin, stdout, stderr)
+		}
+	}
+
+	err := &ParseArgsError{msg: "subcommand required: fetch, list"}
+	fmt.Fprintf(stderr, "%s\nUsage: %s fetch|list [flags...]\n",
+		err.Error(), args[0])
+
+	return err
+}
+
+// fetchKernel downloads the referenced kernel into the kernel cache and
+// prints its path.
+func fetchKernel(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		urlTemplate = os.Getenv("VIRTRUN_KERNEL_URL")
+		checksum    string
+	)
+
+	fs := flag.NewFlagSet(args[0]+" [flags...] VERSION-ARCH",
+		flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.StringVar(
+		&urlTemplate,
+		"url",
+		urlTemplate,
+		"URL template of the kernel. \"{version}\" and \"{arch}\" are "+
+			"replaced by the values of the reference. "+
+			"(default from env VIRTRUN_KERNEL_URL)",
+	)
+
+	fs.StringVar(
+		&checksum,
+		"sha256",
+		checksum,
+		"hex encoded SHA-256 checksum the kernel must match. Required.",
+	)
+
+	name, err := parseSinglePositional(fs, args[1:], "kernel reference")
+	if err != nil {
+		return err
+	}
+
+	ref, err := kernelcache.ParseRef(name)
+	if err != nil {
+		return fmt.Errorf("parse reference: %w", err)
+	}
+
+	if urlTemplate == "" {
+		err := &ParseArgsError{msg: "no URL given (use -url)"}
+		fmt.Fprintln(stderr, err.Error())
+		fs.Usage()
+
+		return err
+	}
+
+	if checksum == "" {
+		err := &ParseArgsError{msg: "no checksum given (use -sha256)"}
+		fmt.Fprintln(stderr, err.Error())
+		fs.Usage()
+
+		return err
+	}
+
+	cache, err := kernelCache()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	path, err := cache.Fetch(ctx, http.DefaultClient, urlTemplate, ref,
+		strings.ToLower(checksum))
+	if err != nil {
+		return fmt.Errorf("fetch %s: %w", ref, err)
+	}
+
+	fmt.Fprintln(stdout, path)
+
+	return nil
+}
+
+// listKernels prints the references and paths of all cached kernels.
+func listKernels(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return &ParseArgsError{msg: "flag parse", err: err}
+	}
+
+	cache, err := kernelCache()
+	if err != nil {
+		return err
+	}
+
+	refs, err := cache.List()
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+
+	for _, ref := range refs {
+		fmt.Fprintf(stdout, "%s%s %s\n",
+			kernelcache.RefPrefix, ref, cache.Path(ref))
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/kernelcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernelPath_Set(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("VIRTRUN_KERNEL_CACHE", dir)
+
+	cached := filepath.Join(dir, "arm64", "6.6", "vmlinuz")
+	newest := filepath.Join(dir, "arm64", "6.10", "vmlinuz")
+
+	for _, path := range []string{cached, newest} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+	}
+
+	absPath, err := AbsoluteFilePath("vmlinuz")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "file path",
+			input:    "vmlinuz",
+			expected: absPath,
+		},
+		{
+			name:     "cached",
+			input:    "cache:6.6-arm64",
+			expected: cached,
+		},
+		{
+			name:        "not cached",
+			input:       "cache:6.6-amd64",
+			expectedErr: kernelcache.ErrNotCached,
+		},
+		{
+			name:     "constraint",
+			input:    "cache:>=6.1, arm64",
+			expected: newest,
+		},
+		{
+			name:     "constraint with upper bound",
+			input:    "cache:>=6.1,<6.10,arm64",
+			expected: cached,
+		},
+		{
+			name:        "constraint not satisfied",
+			input:       "cache:>=6.11,arm64",
+			expectedErr: kernelcache.ErrNotCached,
+		},
+		{
+			name:        "invalid constraint",
+			input:       "cache:>=6.x,arm64",
+			expectedErr: kernelcache.ErrInvalidConstraint,
+		},
+		{
+			name:        "invalid reference",
+			input:       "cache:6.6",
+			expectedErr: kernelcache.ErrInvalidRef,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path KernelPath
+
+			err := path.Set(tt.input)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, string(path))
+		})
+	}
+}
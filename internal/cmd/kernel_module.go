@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// KernelModuleList is a list of kernel modules given by name or by path.
+// Paths are made absolute, names are kept as they are. See
+// [sys.IsModulePath].
+type KernelModuleList []string
+
+func (l *KernelModuleList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *KernelModuleList) Set(s string) error {
+	for _, module := range strings.Split(s, ",") {
+		if module == "" {
+			return ErrEmptyFilePath
+		}
+
+		if sys.IsModulePath(module) {
+			path, err := AbsoluteFilePath(module)
+			if err != nil {
+				return err
+			}
+
+			module = path
+		}
+
+		*l = append(*l, module)
+	}
+
+	return nil
+}
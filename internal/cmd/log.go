@@ -5,20 +5,81 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"io"
 	"log/slog"
+	"strings"
 )
 
-func setupLogging(writer io.Writer, debug bool) {
-	level := slog.LevelWarn
-	if debug {
-		level = slog.LevelDebug
+// setupLogging sets the default [slog.Logger] writing records with the given
+// minimum level in the given format to the given writer.
+func setupLogging(writer io.Writer, level slog.Level, format string) {
+	opts := &slog.HandlerOptions{
+		Level: level,
 	}
 
-	slog.SetDefault(slog.New(slog.NewTextHandler(
-		writer,
-		&slog.HandlerOptions{
-			Level: level,
-		},
-	)))
+	var handler slog.Handler
+
+	switch format {
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(writer, opts)
+	default:
+		handler = slog.NewTextHandler(writer, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+// qemuLogWriter logs each line QEMU writes to its stderr with the given
+// logger. QEMU prefixes warnings with "warning:", so those are logged with
+// level warn. All other lines are logged with level error. Incomplete lines
+// are buffered until they are completed or [qemuLogWriter.Flush] is called.
+type qemuLogWriter struct {
+	logger *slog.Logger
+	buf    []byte
+}
+
+func newQemuLogWriter(logger *slog.Logger) *qemuLogWriter {
+	return &qemuLogWriter{
+		logger: logger.With(slog.String("origin", "qemu")),
+	}
+}
+
+func (w *qemuLogWriter) Write(data []byte) (int, error) {
+	w.buf = append(w.buf, data...)
+
+	for {
+		line, rest, found := bytes.Cut(w.buf, []byte{'\n'})
+		if !found {
+			break
+		}
+
+		w.log(string(line))
+		w.buf = rest
+	}
+
+	return len(data), nil
+}
+
+// Flush logs a buffered incomplete line.
+func (w *qemuLogWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.log(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *qemuLogWriter) log(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	level := slog.LevelError
+	if strings.Contains(line, "warning:") {
+		level = slog.LevelWarn
+	}
+
+	w.logger.Log(context.Background(), level, line)
 }
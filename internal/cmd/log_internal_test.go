@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQemuLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+
+			return attr
+		},
+	}))
+
+	writer := newQemuLogWriter(logger)
+
+	for _, data := range []string{
+		"qemu: warning: host doesn't support ",
+		"requested feature\n\nqemu: could not load",
+		" kernel\nincomplete",
+	} {
+		n, err := writer.Write([]byte(data))
+		require.NoError(t, err)
+		assert.Equal(t, len(data), n)
+	}
+
+	writer.Flush()
+
+	expected := "" +
+		`level=WARN msg="qemu: warning: host doesn't support requested ` +
+		`feature" origin=qemu` + "\n" +
+		`level=ERROR msg="qemu: could not load kernel" origin=qemu` + "\n" +
+		`level=ERROR msg=incomplete origin=qemu` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestFlags_LogLevel(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		expectedLevel  slog.Level
+		expectedFormat string
+		expectedErr    string
+	}{
+		{
+			name:           "default",
+			expectedLevel:  slog.LevelWarn,
+			expectedFormat: logFormatText,
+		},
+		{
+			name:           "level and format",
+			args:           []string{"-logLevel", "info", "-logFormat", "json"},
+			expectedLevel:  slog.LevelInfo,
+			expectedFormat: logFormatJSON,
+		},
+		{
+			name:           "debug flag",
+			args:           []string{"-logLevel", "error", "-debug"},
+			expectedLevel:  slog.LevelDebug,
+			expectedFormat: logFormatText,
+		},
+		{
+			name:        "unknown level",
+			args:        []string{"-logLevel", "verbose"},
+			expectedErr: "invalid value",
+		},
+		{
+			name:        "unknown format",
+			args:        []string{"-logFormat", "xml"},
+			expectedErr: "unknown log format: xml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := newFlags("test", io.Discard)
+
+			args := append([]string{"-kernel", "/boot/this"}, tt.args...)
+			err := flags.ParseArgs(append(args, "bin.test"))
+
+			if tt.expectedErr != "" {
+				require.ErrorIs(t, err, &ParseArgsError{})
+				assert.ErrorContains(t, err, tt.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedLevel, flags.LogLevel())
+			assert.Equal(t, tt.expectedFormat, flags.LogFormat())
+		})
+	}
+}
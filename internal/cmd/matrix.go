@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+)
+
+// matrixCell is a single run of a matrix run. The name of the summary is the
+// name of the [Profile] applied for the run.
+type matrixCell struct {
+	runSummary
+
+	// flags are the parsed flags with the profile applied.
+	flags *flags
+}
+
+// matrix runs the given binary once for each profile given by flag
+// "-profiles", one after the other, and prints a summary table. Output lines
+// are prefixed with the name of the profile. Log records have it as attribute
+// "profile".
+func matrix(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var (
+		profiles []string
+		summary  summaryFiles
+	)
+
+	flags := newMatrixFlags(args[0], stderr, &profiles, &summary)
+
+	cmdArgs := PrependEnvArgs(args[1:])
+
+	err := flags.ParseArgs(cmdArgs)
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	if len(profiles) == 0 {
+		err := flags.fail("no profiles given (use -profiles)", nil)
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	err = flags.checkMultipleRuns()
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	cells, err := matrixCells(args[0], stderr, cmdArgs, profiles)
+	if err != nil {
+		return err
+	}
+
+	setupLogging(stderr, flags.LogLevel(), flags.LogFormat())
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	var mu sync.Mutex
+
+	for _, cell := range cells {
+		out := &prefixWriter{w: stdout, mu: &mu, prefix: cell.name}
+		logger := slog.With(slog.String("profile", cell.name))
+
+		cell.start = time.Now()
+
+		_, err := runWithTimeouts(ctx, cell.flags, cell.flags.spec,
+			nil, out, logger)
+		if err != nil && !errors.Is(err, qemu.ErrGuestNonZeroExitCode) {
+			logger.Error("Run failed", slog.Any("error", err))
+		}
+
+		out.Flush()
+
+		cell.duration = time.Since(cell.start)
+		cell.err = err
+	}
+
+	writeMatrixSummary(stdout, cells)
+
+	summaries := make([]runSummary, len(cells))
+	for idx, cell := range cells {
+		summaries[idx] = cell.runSummary
+	}
+
+	err = summary.write(summaries)
+	if err != nil {
+		return err
+	}
+
+	return newParallelError(summaries)
+}
+
+// newMatrixFlags returns [flags] with the additional flag "-profiles" that
+// appends to the given list and the flags of the given [summaryFiles].
+func newMatrixFlags(
+	name string,
+	output io.Writer,
+	profiles *[]string,
+	summary *summaryFiles,
+) *flags {
+	flags := newFlags(name, output)
+	flags.flagSet.Init(name+" [flags...] binary [initargs...]",
+		flag.ContinueOnError)
+	flags.flagSet.Func(
+		"profiles",
+		"comma separated names of the profiles to run the binary with. "+
+			"Flag may be used more than once.",
+		func(s string) error {
+			*profiles = append(*profiles, strings.Split(s, ",")...)
+			return nil
+		},
+	)
+	summary.addFlags(flags.flagSet)
+
+	return flags
+}
+
+// matrixCells returns a [matrixCell] for each of the given profiles. The
+// flags of each cell are parsed from the given arguments with the profile
+// applied first, so the arguments take precedence. If an artifact directory
+// is set, each cell gets its own sub directory named like the profile.
+func matrixCells(
+	name string,
+	output io.Writer,
+	args []string,
+	profiles []string,
+) ([]*matrixCell, error) {
+	cells := make([]*matrixCell, 0, len(profiles))
+	seen := make(map[string]bool, len(profiles))
+
+	for _, profile := range profiles {
+		if seen[profile] {
+			continue
+		}
+
+		seen[profile] = true
+
+		var (
+			ignoredProfiles []string
+			ignoredSummary  summaryFiles
+		)
+
+		flags := newMatrixFlags(name, output, &ignoredProfiles,
+			&ignoredSummary)
+
+		err := flags.ParseArgs(append([]string{"-profile", profile}, args...))
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: parse args: %w", profile, err)
+		}
+
+		spec := flags.spec
+		if spec.Qemu.ArtifactDir != "" {
+			spec.Qemu.ArtifactDir = filepath.Join(spec.Qemu.ArtifactDir, profile)
+		}
+
+		err = Validate(spec)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: validate: %w", profile, err)
+		}
+
+		cells = append(cells, &matrixCell{
+			runSummary: runSummary{name: profile},
+			flags:      flags,
+		})
+	}
+
+	return cells, nil
+}
+
+// writeMatrixSummary writes a table with the result of each cell.
+func writeMatrixSummary(w io.Writer, cells []*matrixCell) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(table, "PROFILE\tARCH\tKERNEL\tRESULT\tDURATION")
+
+	for _, cell := range cells {
+		duration := "-"
+		if cell.duration > 0 {
+			duration = cell.duration.Round(time.Millisecond).String()
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n",
+			cell.name,
+			cmp.Or(string(cell.flags.spec.Qemu.Arch), "-"),
+			cell.flags.spec.Qemu.Kernel,
+			describeResult(cell.err),
+			duration,
+		)
+	}
+
+	_ = table.Flush()
+}
+
+// describeResult returns a short description of the result of a run with the
+// given error.
+func describeResult(err error) string {
+	var cmdErr *qemu.CommandError
+
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, &TimeoutError{}):
+		return "timeout"
+	case errors.Is(err, qemu.ErrGuestNonZeroExitCode) &&
+		errors.As(err, &cmdErr):
+		return fmt.Sprintf("exit %d", cmdErr.ExitCode)
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatrixCells(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"vmlinuz-6.1", "vmlinuz-6.6", "bin.test"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		require.NoError(t, err)
+	}
+
+	path := filepath.Join(dir, "profiles.json")
+	require.NoError(t, os.WriteFile(path, fmt.Appendf(nil, `{
+		"6.1": {"kernel": "%[1]s/vmlinuz-6.1", "args": ["-memory", "512"]},
+		"6.6": {"kernel": "%[1]s/vmlinuz-6.6", "arch": "amd64"}
+	}`, dir), 0o600))
+
+	t.Setenv("VIRTRUN_PROFILES", path)
+
+	args := []string{
+		"-profiles", "6.1,6.6",
+		"-artifactDir", "/out",
+		"-smp", "2",
+		filepath.Join(dir, "bin.test"),
+	}
+
+	cells, err := matrixCells("test", io.Discard, args, []string{"6.1", "6.6"})
+	require.NoError(t, err)
+	require.Len(t, cells, 2)
+
+	assert.Equal(t, "6.1", cells[0].name)
+	assert.Equal(t, dir+"/vmlinuz-6.1", cells[0].flags.spec.Qemu.Kernel)
+	assert.Equal(t, "/out/6.1", cells[0].flags.spec.Qemu.ArtifactDir)
+	assert.Equal(t, uint64(512), cells[0].flags.spec.Qemu.Memory)
+	assert.Equal(t, uint64(2), cells[0].flags.spec.Qemu.SMP)
+
+	assert.Equal(t, "6.6", cells[1].name)
+	assert.Equal(t, dir+"/vmlinuz-6.6", cells[1].flags.spec.Qemu.Kernel)
+	assert.Equal(t, "/out/6.6", cells[1].flags.spec.Qemu.ArtifactDir)
+	assert.Equal(t, sys.AMD64, cells[1].flags.spec.Qemu.Arch)
+	assert.Equal(t, uint64(memDefault), cells[1].flags.spec.Qemu.Memory)
+
+	_, err = matrixCells("test", io.Discard, args, []string{"unknown"})
+	require.ErrorIs(t, err, &ParseArgsError{})
+	assert.ErrorContains(t, err, ErrUnknownProfile.Error())
+}
+
+func TestDescribeResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "success",
+			expected: "ok",
+		},
+		{
+			name:     "timeout",
+			err:      &TimeoutError{Phase: "run", Timeout: time.Second},
+			expected: "timeout",
+		},
+		{
+			name: "exit code",
+			err: &qemu.CommandError{
+				Err:      qemu.ErrGuestNonZeroExitCode,
+				Guest:    true,
+				ExitCode: 3,
+			},
+			expected: "exit 3",
+		},
+		{
+			name:     "other",
+			err:      errors.New("boom"),
+			expected: "error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, describeResult(tt.err))
+		})
+	}
+}
+
+func TestWriteMatrixSummary(t *testing.T) {
+	newCell := func(profile, kernel string) *matrixCell {
+		flags := newFlags("test", io.Discard)
+		flags.spec.Qemu.Kernel = kernel
+
+		return &matrixCell{runSummary: runSummary{name: profile}, flags: flags}
+	}
+
+	cells := []*matrixCell{
+		newCell("6.1", "/boot/vmlinuz-6.1"),
+		newCell("6.6-arm64", "/boot/vmlinuz-6.6"),
+	}
+	cells[0].duration = 1500 * time.Millisecond
+	cells[1].flags.spec.Qemu.Arch = sys.ARM64
+	cells[1].err = errors.New("boom")
+
+	var buf bytes.Buffer
+
+	writeMatrixSummary(&buf, cells)
+
+	expected := "" +
+		"PROFILE    ARCH   KERNEL             RESULT  DURATION\n" +
+		"6.1        -      /boot/vmlinuz-6.1  ok      1.5s\n" +
+		"6.6-arm64  arm64  /boot/vmlinuz-6.6  error   -\n"
+	assert.Equal(t, expected, buf.String())
+}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MountOptionsList is a list of mount options for guest mount points in the
+// form "PATH:OPTIONS".
+type MountOptionsList []string
+
+func (m *MountOptionsList) String() string {
+	return strings.Join(*m, ";")
+}
+
+func (m *MountOptionsList) Set(s string) error {
+	path, options, found := strings.Cut(s, ":")
+
+	switch {
+	case !found || options == "":
+		return fmt.Errorf("%w: missing options: %s", ErrInvalidMountOptions, s)
+	case !filepath.IsAbs(path):
+		return fmt.Errorf("%w: path not absolute: %s", ErrInvalidMountOptions, s)
+	case strings.ContainsAny(s, " \t\n\";"):
+		return fmt.Errorf("%w: invalid character: %s", ErrInvalidMountOptions, s)
+	}
+
+	*m = append(*m, s)
+
+	return nil
+}
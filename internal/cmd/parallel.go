@@ -0,0 +1,282 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+	"golang.org/x/sync/errgroup"
+)
+
+// parallel runs each given binary in its own guest. Up to the number of
+// guests given by flag "-jobs" run concurrently. Output lines are prefixed
+// with the name of the binary. Log records have it as attribute "binary".
+func parallel(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	var summary summaryFiles
+
+	jobs := uint64(runtime.NumCPU())
+
+	flags := newFlags(args[0], stderr)
+	flags.flagSet.Init(args[0]+" [flags...] binary...", flag.ContinueOnError)
+	addJobsFlag(flags.flagSet, &jobs)
+	summary.addFlags(flags.flagSet)
+
+	err := flags.ParseArgs(PrependEnvArgs(args[1:]))
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	specs, err := parallelSpecs(flags)
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	for _, spec := range specs {
+		err = Validate(spec)
+		if err != nil {
+			return fmt.Errorf("validate: %w", err)
+		}
+	}
+
+	setupLogging(stderr, flags.LogLevel(), flags.LogFormat())
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	summaries := runParallel(ctx, flags, specs, jobs, stdout)
+
+	err = summary.write(summaries)
+	if err != nil {
+		return err
+	}
+
+	return newParallelError(summaries)
+}
+
+// addJobsFlag adds the flag for the number of guests to run concurrently to
+// the given [flag.FlagSet].
+func addJobsFlag(fs *flag.FlagSet, jobs *uint64) {
+	fs.Var(
+		&limitedUintValue{
+			Value: jobs,
+			min:   1,
+		},
+		"jobs",
+		"number of guests to run concurrently (default number of CPUs)",
+	)
+}
+
+// runParallel runs each of the given specs in its own guest, with up to the
+// given number of jobs concurrently, and returns the summaries of the runs
+// in the order of the specs. Output lines are prefixed with the name of the
+// binary. Log records have it as attribute "binary".
+func runParallel(
+	ctx context.Context,
+	flags *flags,
+	specs []*virtrun.Spec,
+	jobs uint64,
+	stdout io.Writer,
+) []runSummary {
+	var (
+		group     errgroup.Group
+		mu        sync.Mutex
+		summaries = make([]runSummary, len(specs))
+	)
+
+	group.SetLimit(int(min(jobs, uint64(len(specs)))))
+
+	for idx, spec := range specs {
+		name := filepath.Base(spec.Initramfs.Binary)
+
+		group.Go(func() error {
+			out := &prefixWriter{w: stdout, mu: &mu, prefix: name}
+			logger := slog.With(slog.String("binary", name))
+			start := time.Now()
+
+			_, err := runWithTimeouts(ctx, flags, spec, nil, out, logger)
+			if err != nil && !errors.Is(err, qemu.ErrGuestNonZeroExitCode) {
+				logger.Error("Run failed", slog.Any("error", err))
+			}
+
+			out.Flush()
+
+			summaries[idx] = runSummary{
+				name:     name,
+				start:    start,
+				duration: time.Since(start),
+				err:      err,
+			}
+
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	return summaries
+}
+
+// parallelSpecs returns a [virtrun.Spec] for each positional argument of the
+// parsed flags. Each positional argument is a binary. See [binarySpecs].
+func parallelSpecs(flags *flags) ([]*virtrun.Spec, error) {
+	err := flags.checkMultipleRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	binaries := append(
+		[]string{flags.spec.Initramfs.Binary},
+		flags.spec.Qemu.InitArgs...,
+	)
+
+	return binarySpecs(flags, binaries, []string{})
+}
+
+// binarySpecs returns a [virtrun.Spec] based on the parsed flags for each of
+// the given binaries, run with the given arguments. If an artifact directory
+// is set, each binary gets its own sub directory named like the binary.
+func binarySpecs(
+	flags *flags,
+	binaries []string,
+	args []string,
+) ([]*virtrun.Spec, error) {
+	specs := make([]*virtrun.Spec, 0, len(binaries))
+	names := make(map[string]bool, len(binaries))
+
+	for _, binary := range binaries {
+		path, err := AbsoluteFilePath(binary)
+		if err != nil {
+			return nil, flags.fail("binary path", err)
+		}
+
+		name := filepath.Base(path)
+		if names[name] {
+			return nil, flags.fail("duplicate binary name: "+name, nil)
+		}
+
+		names[name] = true
+
+		spec := *flags.spec
+		spec.Initramfs.Binary = path
+		spec.Qemu.InitArgs = slices.Clone(args)
+
+		if spec.Qemu.ArtifactDir != "" {
+			spec.Qemu.ArtifactDir = filepath.Join(spec.Qemu.ArtifactDir, name)
+		}
+
+		specs = append(specs, &spec)
+	}
+
+	return specs, nil
+}
+
+// checkMultipleRuns fails if flags are set that are not supported for
+// multiple runs, as they are about a single run.
+func (f *flags) checkMultipleRuns() error {
+	if f.DryRun() || f.Output() != "" || f.MetricsFile() != "" {
+		return f.fail("-dryRun, -output and -metricsFile are not "+
+			"supported with multiple runs", nil)
+	}
+
+	if f.spec.Initramfs.Archive != "" || f.spec.Initramfs.Output != "" {
+		return f.fail("initramfs files are not supported with "+
+			"multiple runs", nil)
+	}
+
+	return nil
+}
+
+// newParallelError returns a [ParallelError] for the given summaries of
+// runs. It returns nil if all runs succeeded.
+func newParallelError(summaries []runSummary) error {
+	var parallelErr *ParallelError
+
+	for _, summary := range summaries {
+		if summary.err == nil {
+			continue
+		}
+
+		if parallelErr == nil {
+			parallelErr = &ParallelError{ExitCode: exitCodeFor(summary.err)}
+		}
+
+		parallelErr.Failed = append(parallelErr.Failed, summary.name)
+	}
+
+	if parallelErr == nil {
+		return nil
+	}
+
+	return parallelErr
+}
+
+// prefixWriter writes complete lines prefixed with the name of the writer
+// in brackets. Incomplete lines are buffered until they are completed or
+// [prefixWriter.Flush] is called. The mutex is shared by all writers of the
+// same output, so lines are not interleaved.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+
+	idx := bytes.LastIndexByte(p.buf, '\n')
+	if idx < 0 {
+		return len(data), nil
+	}
+
+	err := p.writeLines(p.buf[:idx+1])
+	p.buf = p.buf[idx+1:]
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// Flush writes a buffered incomplete line terminated with a line break.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) == 0 {
+		return
+	}
+
+	_ = p.writeLines(append(p.buf, '\n'))
+	p.buf = nil
+}
+
+func (p *prefixWriter) writeLines(lines []byte) error {
+	var out bytes.Buffer
+
+	for _, line := range bytes.SplitAfter(lines, []byte{'\n'}) {
+		if len(line) > 0 {
+			fmt.Fprintf(&out, "[%s] %s", p.prefix, line)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.w.Write(out.Bytes())
+
+	return err //nolint:wrapcheck
+}
@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		mu  sync.Mutex
+	)
+
+	first := &prefixWriter{w: &buf, mu: &mu, prefix: "a.test"}
+	second := &prefixWriter{w: &buf, mu: &mu, prefix: "b.test"}
+
+	for _, write := range []struct {
+		w    *prefixWriter
+		data string
+	}{
+		{first, "one\ntw"},
+		{second, "three\n"},
+		{first, "o\nfour"},
+		{second, "five"},
+	} {
+		n, err := write.w.Write([]byte(write.data))
+		require.NoError(t, err)
+		assert.Equal(t, len(write.data), n)
+	}
+
+	first.Flush()
+	second.Flush()
+
+	expected := "[a.test] one\n" +
+		"[b.test] three\n" +
+		"[a.test] two\n" +
+		"[a.test] four\n" +
+		"[b.test] five\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestParallelSpecs(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		expectedDirs  []string
+		expectedNames []string
+		expectedErr   string
+	}{
+		{
+			name:          "binaries",
+			args:          []string{"a.test", "sub/b.test"},
+			expectedNames: []string{"a.test", "b.test"},
+			expectedDirs:  []string{"", ""},
+		},
+		{
+			name:          "artifact dir",
+			args:          []string{"-artifactDir", "out", "a.test", "b.test"},
+			expectedNames: []string{"a.test", "b.test"},
+			expectedDirs:  []string{"out/a.test", "out/b.test"},
+		},
+		{
+			name:        "duplicate name",
+			args:        []string{"a.test", "sub/a.test"},
+			expectedErr: "duplicate binary name: a.test",
+		},
+		{
+			name:        "dry run",
+			args:        []string{"-dryRun", "a.test"},
+			expectedErr: "not supported with multiple runs",
+		},
+		{
+			name:        "kept initramfs",
+			args:        []string{"-keepInitramfs=initramfs.cpio", "a.test"},
+			expectedErr: "not supported with multiple runs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := newFlags("test", io.Discard)
+
+			args := append([]string{"-kernel", "/boot/this"}, tt.args...)
+			require.NoError(t, flags.ParseArgs(args))
+
+			specs, err := parallelSpecs(flags)
+			if tt.expectedErr != "" {
+				require.ErrorIs(t, err, &ParseArgsError{})
+				assert.ErrorContains(t, err, tt.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, specs, len(tt.expectedNames))
+
+			for idx, spec := range specs {
+				assert.True(t, filepath.IsAbs(spec.Initramfs.Binary))
+				assert.Equal(t, tt.expectedNames[idx],
+					filepath.Base(spec.Initramfs.Binary))
+				assert.Equal(t, tt.expectedDirs[idx], spec.Qemu.ArtifactDir)
+				assert.Empty(t, spec.Qemu.InitArgs)
+			}
+		})
+	}
+}
+
+func TestNewParallelError(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		summaries := []runSummary{{name: "a.test"}, {name: "b.test"}}
+		assert.NoError(t, newParallelError(summaries))
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		err := newParallelError([]runSummary{
+			{name: "a.test"},
+			{name: "b.test", err: &qemu.CommandError{
+				Err:      qemu.ErrGuestNonZeroExitCode,
+				ExitCode: 3,
+			}},
+			{name: "c.test", err: errors.New("boom")},
+		})
+
+		var parallelErr *ParallelError
+
+		require.ErrorAs(t, err, &parallelErr)
+		assert.Equal(t, []string{"b.test", "c.test"}, parallelErr.Failed)
+		assert.Equal(t, 3, exitCodeFor(err))
+	})
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// probe prints the host architecture, if KVM is available and the QEMU
+// binaries used by default for each supported architecture. It fails if none
+// of the QEMU binaries is found.
+func probe(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return &ParseArgsError{msg: "flag parse", err: err}
+	}
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	native := sys.Native
+
+	kvm := "not available"
+	if native.KVMAvailable() {
+		kvm = "available"
+	}
+
+	fmt.Fprintf(stdout, "host arch: %s\n", native)
+	fmt.Fprintf(stdout, "kvm: %s\n", kvm)
+
+	found := false
+
+	for _, arch := range []sys.Arch{sys.AMD64, sys.ARM64, sys.RISCV64} {
+		var spec virtrun.Qemu
+
+		err := spec.AddDefaultsFor(arch)
+		if err != nil {
+			return fmt.Errorf("%s defaults: %w", arch, err)
+		}
+
+		version, err := qemuVersion(ctx, spec.Executable)
+		if err != nil {
+			fmt.Fprintf(stdout, "qemu %s: %s: %v\n", arch, spec.Executable, err)
+			continue
+		}
+
+		found = true
+
+		fmt.Fprintf(stdout, "qemu %s: %s: %s\n", arch, spec.Executable, version)
+	}
+
+	if !found {
+		return ErrQemuNotFound
+	}
+
+	return nil
+}
+
+// qemuVersion returns the first line of the version output of the given QEMU
+// binary.
+func qemuVersion(ctx context.Context, executable string) (string, error) {
+	path, err := exec.LookPath(executable)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	output, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	line, _, _ := bytes.Cut(output, []byte("\n"))
+
+	return string(line), nil
+}
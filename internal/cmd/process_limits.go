@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"golang.org/x/sys/unix"
+)
+
+// ioLevelMax is the lowest priority level within an I/O scheduling class.
+const ioLevelMax = 7
+
+// cpuMax is the highest CPU number a [unix.CPUSet] can hold.
+const cpuMax = len(unix.CPUSet{})*64 - 1
+
+// ioClassNames are the names of the I/O scheduling classes, like ionice(1)
+// names them.
+var ioClassNames = map[string]sys.IOClass{
+	"realtime":    sys.IOClassRealtime,
+	"best-effort": sys.IOClassBestEffort,
+	"idle":        sys.IOClassIdle,
+}
+
+// CPUList is a list of host CPUs in the form "0-3,6", like taskset(1) takes
+// it.
+type CPUList []int
+
+func (l *CPUList) String() string {
+	cpus := make([]string, len(*l))
+	for idx, cpu := range *l {
+		cpus[idx] = strconv.Itoa(cpu)
+	}
+
+	return strings.Join(cpus, ",")
+}
+
+func (l *CPUList) Set(s string) error {
+	var cpus []int
+
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+
+		start, err := strconv.ParseUint(first, 10, 16)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidCPUList, s)
+		}
+
+		end := start
+
+		if isRange {
+			end, err = strconv.ParseUint(last, 10, 16)
+			if err != nil || end < start {
+				return fmt.Errorf("%w: %s", ErrInvalidCPUList, s)
+			}
+		}
+
+		if end > uint64(cpuMax) {
+			return fmt.Errorf("%w: cpu %d above %d", ErrInvalidCPUList, end,
+				cpuMax)
+		}
+
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, int(cpu))
+		}
+	}
+
+	*l = cpus
+
+	return nil
+}
+
+// IOPriority is an I/O scheduling class and priority level in the form
+// "CLASS[:LEVEL]", like "best-effort:7" or "idle". See [sys.IOClass].
+type IOPriority struct {
+	Class *sys.IOClass
+	Level *int
+}
+
+func (p *IOPriority) String() string {
+	if p.Class == nil {
+		return ""
+	}
+
+	for name, class := range ioClassNames {
+		if class == *p.Class {
+			return name + ":" + strconv.Itoa(*p.Level)
+		}
+	}
+
+	return ""
+}
+
+func (p *IOPriority) Set(s string) error {
+	name, levelStr, hasLevel := strings.Cut(s, ":")
+
+	class, exists := ioClassNames[name]
+	if !exists {
+		return fmt.Errorf("%w: unknown class: %s", ErrInvalidIOPriority, s)
+	}
+
+	level := 0
+
+	if hasLevel {
+		var err error
+
+		level, err = strconv.Atoi(levelStr)
+		if err != nil || level < 0 || level > ioLevelMax {
+			return fmt.Errorf("%w: level not 0-%d: %s", ErrInvalidIOPriority,
+				ioLevelMax, s)
+		}
+	}
+
+	*p.Class = class
+	*p.Level = level
+
+	return nil
+}
+
+// CgroupLimitList is a list of cgroup limits in the form "FILE=VALUE", like
+// "memory.max=1G". See [sys.ProcessLimits.CgroupLimits].
+type CgroupLimitList []string
+
+func (l *CgroupLimitList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *CgroupLimitList) Set(s string) error {
+	file, _, found := strings.Cut(s, "=")
+	if !found || file == "" || strings.Contains(file, "/") {
+		return fmt.Errorf("%w: not FILE=VALUE: %s", ErrInvalidCgroupLimit, s)
+	}
+
+	*l = append(*l, s)
+
+	return nil
+}
@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// Profile is a named set of parameters for running with a specific kernel and
+// machine, so the same binary can be run easily with different kernels.
+type Profile struct {
+	// Kernel is the path of the kernel to use, a reference to a cached
+	// kernel, like "cache:6.6-amd64", or a constraint for cached kernels, like
+	// "cache:>=6.1,amd64". See [KernelPath].
+	Kernel string `json:"kernel"`
+
+	// Arch is the architecture of the kernel. Main binaries of other
+	// architectures are rejected.
+	Arch sys.Arch `json:"arch"`
+
+	// QemuBin is the QEMU binary to use.
+	QemuBin string `json:"qemuBin"`
+
+	// Cmdline is a list of additional kernel command line parameters.
+	Cmdline []string `json:"cmdline"`
+
+	// Args is a list of further flags.
+	Args []string `json:"args"`
+}
+
+// ProfilesFile returns the path of the JSON file [Profile]s are read from. It
+// is the value of the environment variable VIRTRUN_PROFILES, if set.
+// Otherwise, it is "virtrun/profiles.json" in the user's config directory.
+func ProfilesFile() (string, error) {
+	if path := os.Getenv("VIRTRUN_PROFILES"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	return filepath.Join(dir, "virtrun", "profiles.json"), nil
+}
+
+// ReadProfile reads the [Profile] with the given name from the file at the
+// given path. The file contains a JSON object with profiles by name.
+func ReadProfile(path, name string) (Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Profile{}, err //nolint:wrapcheck
+	}
+
+	var profiles map[string]Profile
+
+	err = json.Unmarshal(data, &profiles)
+	if err != nil {
+		return Profile{}, fmt.Errorf("%w: %w", ErrInvalidProfile, err)
+	}
+
+	profile, exists := profiles[name]
+	if !exists {
+		return Profile{}, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+
+	return profile, nil
+}
+
+// profileValue is a [flag.Value] that applies the [Profile] with the given
+// name to the flags once it is set. So, flags given after it take precedence.
+type profileValue struct {
+	flags *flags
+	name  string
+}
+
+func (p *profileValue) String() string {
+	return p.name
+}
+
+func (p *profileValue) Set(name string) error {
+	// This also prevents profiles from applying other profiles.
+	if p.name != "" {
+		return fmt.Errorf("%w: only one profile can be applied",
+			ErrInvalidProfile)
+	}
+
+	p.name = name
+
+	path, err := ProfilesFile()
+	if err != nil {
+		return fmt.Errorf("profiles file: %w", err)
+	}
+
+	profile, err := ReadProfile(path, name)
+	if err != nil {
+		return err
+	}
+
+	return p.flags.applyProfile(profile)
+}
+
+// applyProfile sets the flags as defined by the given [Profile].
+func (f *flags) applyProfile(profile Profile) error {
+	if profile.Kernel != "" {
+		err := (*KernelPath)(&f.spec.Qemu.Kernel).Set(profile.Kernel)
+		if err != nil {
+			return fmt.Errorf("kernel: %w", err)
+		}
+	}
+
+	if profile.Arch != "" {
+		err := f.spec.Qemu.Arch.Set(string(profile.Arch))
+		if err != nil {
+			return fmt.Errorf("arch: %w", err)
+		}
+	}
+
+	if profile.QemuBin != "" {
+		f.spec.Qemu.Executable = profile.QemuBin
+	}
+
+	f.spec.Qemu.KernelParams = append(f.spec.Qemu.KernelParams,
+		profile.Cmdline...)
+
+	// A dedicated flag set binds the same values, so the arguments are
+	// applied like they were given on the command line.
+	fs := f.newFlagSet(io.Discard)
+
+	err := fs.Parse(profile.Args)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidProfile, err)
+	}
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected argument %s", ErrInvalidProfile,
+			fs.Arg(0))
+	}
+
+	return nil
+}
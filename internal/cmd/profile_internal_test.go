@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlags_ParseArgs_Profile(t *testing.T) {
+	absBinPath, err := AbsoluteFilePath("bin.test")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"arm64-lts": {
+			"kernel": "/boot/vmlinuz-arm64",
+			"arch": "arm64",
+			"qemuBin": "qemu-system-aarch64",
+			"cmdline": ["nokaslr"],
+			"args": ["-machine", "virt", "-memory", "512"]
+		},
+		"nested": {
+			"args": ["-profile", "arm64-lts"]
+		},
+		"positional": {
+			"args": ["bin.test"]
+		}
+	}`), 0o600))
+
+	t.Setenv("VIRTRUN_PROFILES", path)
+
+	tests := []struct {
+		name         string
+		args         []string
+		expectedSpec *virtrun.Spec
+		expectedErr  string
+	}{
+		{
+			name: "profile",
+			args: []string{
+				"-profile", "arm64-lts",
+				"-memory", "1024",
+				"bin.test",
+			},
+			expectedSpec: &virtrun.Spec{
+				Initramfs: virtrun.Initramfs{
+					Binary: absBinPath,
+				},
+				Qemu: virtrun.Qemu{
+					Executable:   "qemu-system-aarch64",
+					Kernel:       "/boot/vmlinuz-arm64",
+					Arch:         sys.ARM64,
+					KernelParams: []string{"nokaslr"},
+					Machine:      "virt",
+					CPU:          "max",
+					Memory:       1024,
+					SMP:          1,
+					InitArgs:     []string{},
+				},
+			},
+		},
+		{
+			name:        "unknown",
+			args:        []string{"-profile", "unknown", "bin.test"},
+			expectedErr: ErrUnknownProfile.Error(),
+		},
+		{
+			name:        "nested",
+			args:        []string{"-profile", "nested", "bin.test"},
+			expectedErr: "only one profile can be applied",
+		},
+		{
+			name:        "positional argument",
+			args:        []string{"-profile", "positional", "bin.test"},
+			expectedErr: "unexpected argument bin.test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := newFlags("test", io.Discard)
+
+			err := flags.ParseArgs(tt.args)
+			if tt.expectedErr != "" {
+				require.ErrorIs(t, err, &ParseArgsError{})
+				assert.ErrorContains(t, err, tt.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedSpec, flags.spec)
+		})
+	}
+}
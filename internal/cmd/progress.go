@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+	"golang.org/x/sys/unix"
+)
+
+// progressInterval is the minimum interval between two updates of the
+// progress indicator for written files.
+const progressInterval = 100 * time.Millisecond
+
+// clearLine moves the cursor to the start of the line and erases it.
+const clearLine = "\r\033[K"
+
+// progressIndicator renders the progress of building an initramfs archive on
+// a single terminal line, which is cleared once the archive is done.
+type progressIndicator struct {
+	w     io.Writer
+	now   func() time.Time
+	last  time.Time
+	shown bool
+}
+
+// newProgressIndicator returns a new [progressIndicator] writing to the given
+// writer, if it is a terminal. Otherwise, it returns nil.
+func newProgressIndicator(w io.Writer) *progressIndicator {
+	if !isTerminal(w) {
+		return nil
+	}
+
+	return &progressIndicator{w: w, now: time.Now}
+}
+
+// Handle renders the given progress. Phase changes are always rendered,
+// written files at most once per [progressInterval].
+func (p *progressIndicator) Handle(progress virtrun.InitramfsProgress) {
+	if progress.Phase == virtrun.InitramfsPhaseDone {
+		p.Clear()
+		return
+	}
+
+	now := p.now()
+	if progress.Files > 0 && now.Sub(p.last) < progressInterval {
+		return
+	}
+
+	p.last = now
+	p.shown = true
+
+	line := "initramfs: " + string(progress.Phase)
+	if progress.Files > 0 {
+		line += fmt.Sprintf(", %d files, %.1f MiB", progress.Files,
+			float64(progress.Bytes)/(1<<20))
+	}
+
+	_, _ = io.WriteString(p.w, clearLine+line)
+}
+
+// Clear erases the progress line, if it is shown, like if the build failed.
+func (p *progressIndicator) Clear() {
+	if p.shown {
+		_, _ = io.WriteString(p.w, clearLine)
+		p.shown = false
+	}
+}
+
+// setupProgress sets a [progressIndicator] writing to the given writer as
+// progress handler of the given config, if the writer is a terminal and debug
+// logs, which would interleave with it, are disabled. The returned function
+// clears the indicator.
+func setupProgress(cfg *virtrun.Initramfs, w io.Writer) func() {
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return func() {}
+	}
+
+	indicator := newProgressIndicator(w)
+	if indicator == nil {
+		return func() {}
+	}
+
+	cfg.ProgressHandler = indicator.Handle
+
+	return indicator.Clear
+}
+
+// isTerminal returns true if the given writer is a terminal.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	_, err := unix.IoctlGetTermios(int(file.Fd()), unix.TCGETS)
+
+	return err == nil
+}
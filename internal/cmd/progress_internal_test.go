@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressIndicator(t *testing.T) {
+	var (
+		out bytes.Buffer
+		now time.Time
+	)
+
+	indicator := &progressIndicator{
+		w:   &out,
+		now: func() time.Time { return now },
+	}
+
+	step := func(progress virtrun.InitramfsProgress, advance time.Duration) {
+		now = now.Add(advance)
+		indicator.Handle(progress)
+	}
+
+	step(virtrun.InitramfsProgress{Phase: virtrun.InitramfsPhaseLibs}, 0)
+	assert.Equal(t, clearLine+"initramfs: resolve libs", out.String())
+
+	out.Reset()
+	step(virtrun.InitramfsProgress{Phase: virtrun.InitramfsPhaseWrite}, 0)
+	step(virtrun.InitramfsProgress{
+		Phase: virtrun.InitramfsPhaseWrite,
+		Files: 1,
+		Bytes: 1 << 19,
+	}, time.Millisecond)
+	assert.Equal(t, clearLine+"initramfs: write archive", out.String(),
+		"file updates are throttled")
+
+	out.Reset()
+	step(virtrun.InitramfsProgress{
+		Phase: virtrun.InitramfsPhaseWrite,
+		Files: 2,
+		Bytes: 3 << 19,
+	}, progressInterval)
+	assert.Equal(t, clearLine+"initramfs: write archive, 2 files, 1.5 MiB",
+		out.String())
+
+	out.Reset()
+	step(virtrun.InitramfsProgress{Phase: virtrun.InitramfsPhaseDone}, 0)
+	assert.Equal(t, clearLine, out.String())
+
+	out.Reset()
+	indicator.Clear()
+	assert.Empty(t, out.String(), "cleared already")
+}
+
+func TestNewProgressIndicator_NoTerminal(t *testing.T) {
+	assert.Nil(t, newProgressIndicator(&bytes.Buffer{}))
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// resultRecord is the machine readable result of a run written with flag
+// "-output".
+type resultRecord struct {
+	ExitCode        int                 `json:"exitCode"`
+	Error           string              `json:"error,omitempty"`
+	Panic           bool                `json:"panic"`
+	OOM             bool                `json:"oom"`
+	OOMProcess      string              `json:"oomProcess,omitempty"`
+	Timeout         bool                `json:"timeout"`
+	Duration        time.Duration       `json:"duration"`
+	BootDuration    time.Duration       `json:"bootDuration"`
+	RunDuration     time.Duration       `json:"runDuration"`
+	CPUTime         time.Duration       `json:"cpuTime"`
+	States          []qemu.StateChange  `json:"states,omitempty"`
+	Phases          []qemu.PhaseSpan    `json:"phases,omitempty"`
+	Consoles        []qemu.Console      `json:"consoles,omitempty"`
+	KernelReports   []qemu.KernelReport `json:"kernelReports,omitempty"`
+	InitramfsSHA256 string              `json:"initramfsSha256,omitempty"`
+	Artifacts       []virtrun.Artifact  `json:"artifacts,omitempty"`
+	Warnings        []virtrun.Warning   `json:"warnings,omitempty"`
+}
+
+// newResultRecord creates the [resultRecord] for the given result and error
+// of [virtrun.Run]. The result may be nil if QEMU did not run.
+func newResultRecord(result *virtrun.RunResult, err error) resultRecord {
+	record := resultRecord{
+		ExitCode: exitCodeFor(err),
+		Panic:    errors.Is(err, qemu.ErrGuestPanic),
+		OOM:      errors.Is(err, qemu.ErrGuestOom),
+		Timeout:  errors.Is(err, &TimeoutError{}),
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	var oomErr *qemu.GuestOOMError
+	if errors.As(err, &oomErr) {
+		record.OOMProcess = oomErr.Process
+	}
+
+	if result != nil {
+		record.Duration = result.Duration
+		record.BootDuration = result.BootDuration
+		record.RunDuration = result.RunDuration
+		record.CPUTime = result.CPUTime
+		record.States = result.States
+		record.Phases = result.Phases
+		record.Consoles = result.Consoles
+		record.KernelReports = result.KernelReports
+		record.InitramfsSHA256 = result.InitramfsSHA256
+		record.Artifacts = result.Artifacts
+		record.Warnings = result.Warnings
+	}
+
+	return record
+}
+
+// writeResultRecord writes the given record as JSON line to the file at the
+// given path. An existing file is overwritten. If the path is empty, it is
+// written to w.
+func writeResultRecord(w io.Writer, path string, record resultRecord) error {
+	if path == "" {
+		return json.NewEncoder(w).Encode(record) //nolint:wrapcheck
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	err = json.NewEncoder(file).Encode(record)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return file.Close() //nolint:wrapcheck
+}
@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewResultRecord(t *testing.T) {
+	result := &virtrun.RunResult{
+		Duration:     time.Second,
+		BootDuration: 400 * time.Millisecond,
+		RunDuration:  500 * time.Millisecond,
+		CPUTime:      2 * time.Second,
+		States: []qemu.StateChange{
+			{State: "booted", Elapsed: 300 * time.Millisecond},
+		},
+		Phases: []qemu.PhaseSpan{
+			{Phase: qemu.PhaseBoot, FirstLine: 1, Lines: 12},
+			{
+				Phase:     qemu.PhaseInit,
+				Elapsed:   300 * time.Millisecond,
+				FirstLine: 13,
+				Lines:     2,
+			},
+		},
+		Consoles: []qemu.Console{
+			{Device: "hvc0", Output: "stdout"},
+		},
+		KernelReports: []qemu.KernelReport{
+			{Kind: qemu.KernelReportWarning, Line: "WARNING: CPU: 0 PID: 1"},
+		},
+		InitramfsSHA256: "abc",
+		Warnings: []virtrun.Warning{
+			{Code: virtrun.WarningKVMUnavailable, Message: "no kvm"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		result   *virtrun.RunResult
+		err      error
+		expected resultRecord
+	}{
+		{
+			name:   "success",
+			result: result,
+			expected: resultRecord{
+				Duration:        result.Duration,
+				BootDuration:    result.BootDuration,
+				RunDuration:     result.RunDuration,
+				CPUTime:         result.CPUTime,
+				States:          result.States,
+				Phases:          result.Phases,
+				Consoles:        result.Consoles,
+				KernelReports:   result.KernelReports,
+				InitramfsSHA256: result.InitramfsSHA256,
+				Warnings:        result.Warnings,
+			},
+		},
+		{
+			name:   "non zero exit code",
+			result: &virtrun.RunResult{},
+			err: &qemu.CommandError{
+				Err:      qemu.ErrGuestNonZeroExitCode,
+				Guest:    true,
+				ExitCode: 3,
+			},
+			expected: resultRecord{
+				ExitCode: 3,
+				Error:    "qemu guest: guest did not return exit code 0",
+			},
+		},
+		{
+			name:   "panic",
+			result: &virtrun.RunResult{},
+			err: fmt.Errorf("qemu run: %w", &qemu.CommandError{
+				Err:   qemu.ErrGuestPanic,
+				Guest: true,
+			}),
+			expected: resultRecord{
+				ExitCode: -1,
+				Error:    "qemu run: qemu guest: guest system panicked",
+				Panic:    true,
+			},
+		},
+		{
+			name: "oom",
+			err:  qemu.ErrGuestOom,
+			expected: resultRecord{
+				ExitCode: -1,
+				Error:    "guest system ran out of memory",
+				OOM:      true,
+			},
+		},
+		{
+			name: "oom kill",
+			err: &qemu.CommandError{
+				Err:   &qemu.GuestOOMError{PID: 116, Process: "main"},
+				Guest: true,
+			},
+			expected: resultRecord{
+				ExitCode: -1,
+				Error: "qemu guest: guest system ran out of memory: " +
+					"killed process 116 (main), total-vm: 0kB, " +
+					"anon-rss: 0kB, file-rss: 0kB, shmem-rss: 0kB",
+				OOM:        true,
+				OOMProcess: "main",
+			},
+		},
+		{
+			name:   "timeout",
+			result: &virtrun.RunResult{},
+			err:    &TimeoutError{Phase: "boot", Timeout: time.Second},
+			expected: resultRecord{
+				ExitCode: exitCodeTimeout,
+				Error:    "boot timeout of 1s exceeded",
+				Timeout:  true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := newResultRecord(tt.result, tt.err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestWriteResultRecord(t *testing.T) {
+	record := resultRecord{ExitCode: 1, Duration: time.Second}
+	expected := `{"exitCode":1,"panic":false,"oom":false,"timeout":false,` +
+		`"duration":1000000000,"bootDuration":0,"runDuration":0,` +
+		`"cpuTime":0}` + "\n"
+
+	t.Run("writer", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		require.NoError(t, writeResultRecord(&buf, "", record))
+		assert.Equal(t, expected, buf.String())
+	})
+
+	t.Run("file", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		path := filepath.Join(t.TempDir(), "result.json")
+
+		require.NoError(t, writeResultRecord(&buf, path, record))
+		assert.Empty(t, buf.String())
+
+		actual, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(actual))
+	})
+}
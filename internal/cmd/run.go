@@ -6,32 +6,75 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/tempdir"
+	"github.com/aibor/virtrun/internal/tracing"
 	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/aibor/virtrun/sysinit"
 )
 
-func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
-	flags := newFlags(args[0], stderr)
+const (
+	// traceServiceName is the service name of exported traces.
+	traceServiceName = "virtrun"
 
-	err := flags.ParseArgs(PrependEnvArgs(args[1:]))
-	if err != nil {
-		return fmt.Errorf("parse args: %w", err)
-	}
+	// traceExportTimeout is the maximum time exporting a trace may take.
+	traceExportTimeout = 10 * time.Second
+)
 
-	err = Validate(flags.spec)
-	if err != nil {
-		return fmt.Errorf("validate: %w", err)
+// subcommand runs with the given arguments. The first argument is the name of
+// the command as used in usage messages.
+type subcommand func(
+	args []string,
+	stdin io.Reader,
+	stdout, stderr io.Writer,
+) error
+
+// subcommands are the subcommands by name.
+var subcommands = map[string]subcommand{
+	"run":               run,
+	"build-initramfs":   buildInitramfs,
+	"inspect-initramfs": inspectInitramfs,
+	"probe":             probe,
+	"parallel":          parallel,
+	"cross":             cross,
+	"kernel":            kernel,
+	"matrix":            matrix,
+	"shell":             shell,
+	"doctor":            doctor,
+	"verify-init":       verifyInit,
+	"bench":             bench,
+	"serve":             serve,
+}
+
+// selectSubcommand returns the [subcommand] named by the first argument after
+// the program name along with its arguments. Without a known subcommand, the
+// "run" subcommand is returned with all arguments, so virtrun can be used
+// with "go test -exec".
+func selectSubcommand(args []string) (subcommand, []string) {
+	if len(args) > 1 {
+		if fn, exists := subcommands[args[1]]; exists {
+			return fn, append([]string{args[0] + " " + args[1]}, args[2:]...)
+		}
 	}
 
-	setupLogging(stderr, flags.Debug())
+	return run, args
+}
 
-	ctx, cancel := signal.NotifyContext(
+// notifyContext returns a context that is canceled once the process receives
+// a termination signal.
+func notifyContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(
 		context.Background(),
 		syscall.SIGABRT,
 		syscall.SIGINT,
@@ -39,9 +82,82 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 		syscall.SIGQUIT,
 		syscall.SIGHUP,
 	)
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := newFlags(args[0], stderr)
+	addServerFlag(flags)
+
+	err := flags.ParseArgs(PrependEnvArgs(args[1:]))
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	if flags.server != "" {
+		return runOnServer(flags, stdout)
+	}
+
+	return runFlags(flags, stdin, stdout, stderr)
+}
+
+// runFlags runs a single guest as given by the parsed flags.
+func runFlags(flags *flags, stdin io.Reader, stdout, stderr io.Writer) error {
+	err := Validate(flags.spec)
+	if err != nil {
+		return fmt.Errorf("validate: %w", flags.exitCodes.wrap(err))
+	}
+
+	setupLogging(stderr, flags.LogLevel(), flags.LogFormat())
+
+	ctx, cancel := notifyContext()
 	defer cancel()
 
-	err = virtrun.Run(ctx, flags.spec, stdin, stdout, stderr)
+	if flags.DryRun() {
+		invocation, err := virtrun.DryRun(ctx, flags.spec)
+		if err != nil {
+			return fmt.Errorf("dry run: %w", err)
+		}
+
+		return printInvocation(stdout, invocation, flags.DryRunFormat())
+	}
+
+	defer setupProgress(&flags.spec.Initramfs, stderr)()
+
+	var tracer *tracing.Tracer
+
+	if endpoint := flags.OTLPEndpoint(); endpoint != "" {
+		tracer = tracing.NewTracer(traceServiceName)
+		ctx = tracing.WithTracer(ctx, tracer)
+
+		defer exportTrace(tracer, endpoint)
+	}
+
+	runCtx, span := tracing.Start(ctx, "run")
+	span.SetAttr("binary", flags.spec.Initramfs.Binary)
+	span.SetAttr("kernel", flags.spec.Qemu.Kernel)
+
+	result, err := runWithTimeouts(runCtx, flags, flags.spec,
+		stdin, stdout, slog.Default())
+	span.SetError(err)
+	span.End()
+
+	// Metrics are written even if the run failed, as they might help finding
+	// the cause.
+	if path := flags.MetricsFile(); path != "" && result != nil {
+		if err := writeMetrics(path, result.Metrics); err != nil {
+			return fmt.Errorf("write metrics: %w", err)
+		}
+	}
+
+	// The result record is written for failed runs as well, as it describes
+	// the failure.
+	if flags.Output() == outputFormatJSON {
+		record := newResultRecord(result, err)
+		if err := writeResultRecord(stderr, flags.OutputFile(), record); err != nil {
+			return fmt.Errorf("write result: %w", err)
+		}
+	}
+
 	if err != nil {
 		return fmt.Errorf("run: %w", err)
 	}
@@ -49,32 +165,127 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 	return nil
 }
 
-func handleRunError(err error, errWriter io.Writer) int {
-	if err == nil {
-		return 0
+// runWithTimeouts runs [virtrun.Run] with the given spec and the timeouts
+// given by the flags. If a timeout is exceeded, a [TimeoutError] is returned.
+// If the guest is emulated because KVM is not available, the timeouts are
+// scaled by [virtrun.EmulationTimeoutFactor]. The stderr output of QEMU is
+// logged with the given logger. A returned error is an [ExitCodeError] with
+// the exit code given by the exit code policy of the flags.
+func runWithTimeouts(
+	ctx context.Context,
+	flags *flags,
+	spec *virtrun.Spec,
+	stdin io.Reader,
+	stdout io.Writer,
+	logger *slog.Logger,
+) (*virtrun.RunResult, error) {
+	runTimeout, bootTimeout := flags.Timeout(), flags.BootTimeout()
+
+	if err := virtrun.CheckKVM(spec); err != nil {
+		runTimeout *= virtrun.EmulationTimeoutFactor
+		bootTimeout *= virtrun.EmulationTimeoutFactor
+
+		logger.Debug("Timeouts scaled for emulated guest",
+			slog.Duration("timeout", runTimeout),
+			slog.Duration("boot_timeout", bootTimeout))
+	}
+
+	ctx, stateHandler, stopTimeouts := withTimeouts(ctx,
+		runTimeout, bootTimeout)
+	defer stopTimeouts()
+
+	spec.Qemu.StateHandler = stateHandler
+
+	dir, err := newRunTempDir(logger)
+	if err != nil {
+		return nil, flags.exitCodes.wrap(fmt.Errorf("temp dir: %w", err))
+	}
+	defer dir.Remove() //nolint:errcheck
+
+	spec.Initramfs.TempDir = dir.Path()
+	spec.Qemu.TempDir = dir.Path()
+
+	// The terminal is restored once the run is done, even if QEMU was killed
+	// or the run panicked, so it is not left in raw mode.
+	stdin, restoreTerminal := terminalInput(stdin, !flags.NoTTYPassthrough())
+	defer restoreTerminal()
+
+	qemuStderr := newQemuLogWriter(logger)
+	result, err := virtrun.Run(ctx, spec, stdin, stdout, qemuStderr)
+	qemuStderr.Flush()
+
+	// QEMU is interrupted once a timeout is exceeded, so the error of the
+	// run is just a consequence.
+	if timeoutErr := timeoutCause(ctx); err != nil && timeoutErr != nil {
+		err = timeoutErr
+	}
+
+	return result, flags.exitCodes.wrap(err)
+}
+
+// newRunTempDir creates a new [tempdir.Dir] for the temporary files of a run.
+// Directories of previous runs that did not remove them, like killed ones,
+// are removed first.
+func newRunTempDir(logger *slog.Logger) (*tempdir.Dir, error) {
+	removed, err := tempdir.Sweep("")
+	if err != nil {
+		logger.Warn("Removing stale temp dirs failed", slog.Any("error", err))
+	}
+
+	for _, path := range removed {
+		logger.Debug("Removed stale temp dir", slog.String("path", path))
+	}
+
+	return tempdir.Create("") //nolint:wrapcheck
+}
+
+// exportTrace exports the spans of the given tracer to the given OTLP
+// endpoint URL. A failed export is logged only, so it does not fail the run.
+func exportTrace(tracer *tracing.Tracer, endpoint string) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		traceExportTimeout)
+	defer cancel()
+
+	err := tracer.Export(ctx, http.DefaultClient, endpoint)
+	if err != nil {
+		slog.Warn("Trace export failed", slog.Any("error", err))
 	}
+}
 
+// writeMetrics writes the given metrics as JSON lines to the file at the
+// given path. An existing file is overwritten.
+func writeMetrics(path string, metrics []sysinit.Metrics) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+
+	for _, sample := range metrics {
+		if err := encoder.Encode(sample); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return file.Close() //nolint:wrapcheck
+}
+
+func handleRunError(err error, errWriter io.Writer) int {
 	// [ErrHelp] is returned when help is requested. So exit without error
 	// in this case.
-	if errors.Is(err, ErrHelp) {
+	if err == nil || errors.Is(err, ErrHelp) {
 		return 0
 	}
 
-	exitCode := -1
+	exitCode := exitCodeFor(err)
 
 	// ParseArgs already prints errors, so we just exit without an error.
 	if errors.Is(err, &ParseArgsError{}) {
 		return exitCode
 	}
 
-	var qemuCmdErr *qemu.CommandError
-
-	if errors.As(err, &qemuCmdErr) {
-		if qemuCmdErr.ExitCode != 0 {
-			exitCode = qemuCmdErr.ExitCode
-		}
-	}
-
 	// Do not print the error in case the guest process ran successfully and
 	// the guest properly communicated a non-zero exit code.
 	if errors.Is(err, qemu.ErrGuestNonZeroExitCode) {
@@ -86,7 +297,30 @@ func handleRunError(err error, errWriter io.Writer) int {
 	return exitCode
 }
 
+// exitCodeFor returns the exit code for the given error. If the error has an
+// exit code attached, that one is returned. Otherwise, it is derived with the
+// default [exitCodePolicy].
+func exitCodeFor(err error) int {
+	var exitCodeErr *ExitCodeError
+
+	if errors.As(err, &exitCodeErr) {
+		return exitCodeErr.ExitCode
+	}
+
+	var parallelErr *ParallelError
+
+	if errors.As(err, &parallelErr) {
+		return parallelErr.ExitCode
+	}
+
+	return exitCodePolicy{}.exitCode(err)
+}
+
+// Run runs the subcommand given by the arguments and returns the exit code.
+// See [selectSubcommand].
 func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
-	err := run(args, stdin, stdout, stderr)
+	fn, cmdArgs := selectSubcommand(args)
+	err := fn(cmdArgs, stdin, stdout, stderr)
+
 	return handleRunError(err, stderr)
 }
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectSubcommand(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		expectedFn   subcommand
+		expectedArgs []string
+	}{
+		{
+			name:         "bare",
+			args:         []string{"virtrun", "-debug", "bin.test"},
+			expectedFn:   run,
+			expectedArgs: []string{"virtrun", "-debug", "bin.test"},
+		},
+		{
+			name:         "no args",
+			args:         []string{"virtrun"},
+			expectedFn:   run,
+			expectedArgs: []string{"virtrun"},
+		},
+		{
+			name:         "run",
+			args:         []string{"virtrun", "run", "-debug", "bin.test"},
+			expectedFn:   run,
+			expectedArgs: []string{"virtrun run", "-debug", "bin.test"},
+		},
+		{
+			name:         "inspect",
+			args:         []string{"virtrun", "inspect-initramfs", "file"},
+			expectedFn:   inspectInitramfs,
+			expectedArgs: []string{"virtrun inspect-initramfs", "file"},
+		},
+		{
+			name:         "probe",
+			args:         []string{"virtrun", "probe"},
+			expectedFn:   probe,
+			expectedArgs: []string{"virtrun probe"},
+		},
+		{
+			name:         "parallel",
+			args:         []string{"virtrun", "parallel", "a.test", "b.test"},
+			expectedFn:   parallel,
+			expectedArgs: []string{"virtrun parallel", "a.test", "b.test"},
+		},
+		{
+			name:         "shell",
+			args:         []string{"virtrun", "shell", "/bin/busybox", "sh"},
+			expectedFn:   shell,
+			expectedArgs: []string{"virtrun shell", "/bin/busybox", "sh"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, args := selectSubcommand(tt.args)
+
+			assert.Equal(t,
+				reflect.ValueOf(tt.expectedFn).Pointer(),
+				reflect.ValueOf(fn).Pointer(),
+			)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
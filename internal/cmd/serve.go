@@ -0,0 +1,718 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+const (
+	// defaultServePool is the default number of guests the serve subcommand
+	// keeps booted.
+	defaultServePool = 2
+
+	// serveRetryDelay is the time the serve subcommand waits before it boots
+	// a guest again, after a guest failed before it got a job.
+	serveRetryDelay = time.Second
+
+	// serveArchiveName is the name of the initramfs archive file the serve
+	// subcommand builds once for all guests.
+	serveArchiveName = "initramfs.cpio"
+
+	// serveMetricsTimeout is the time clients of the metrics endpoint have
+	// to send the request headers.
+	serveMetricsTimeout = 10 * time.Second
+)
+
+// Protocol between the serve subcommand and its clients. It uses the
+// connection of package pipe on the unix socket of the server.
+const (
+	// serveMethodRun is the method clients request a run with. The
+	// parameters are [serveRunParams], the result is a [serveRunResult].
+	// The output of the guest is sent as stream named [serveStdoutStream]
+	// before the response.
+	serveMethodRun = "run"
+
+	// serveStdoutStream is the name of the stream the output of the guest
+	// is sent to the client as.
+	serveStdoutStream = "stdout"
+)
+
+// serveRunParams are the parameters of [serveMethodRun].
+type serveRunParams struct {
+	// Binary is the absolute path of the binary on the host.
+	Binary string `json:"binary"`
+
+	// Args are the arguments the binary is run with.
+	Args []string `json:"args,omitempty"`
+
+	// Env are additional environment variables in the form "KEY=VALUE".
+	Env []string `json:"env,omitempty"`
+
+	// Timeout is the timeout of the run, starting once a guest got the
+	// job. If 0, the timeout of the server is used.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// serveRunResult is the result of [serveMethodRun].
+type serveRunResult struct {
+	// ExitCode is the exit code for the run, as defined by the exit code
+	// flags of the server.
+	ExitCode int `json:"exitCode"`
+
+	// Error is the error of the run, unless it succeeded or just the binary
+	// exited with a non-zero exit code.
+	Error string `json:"error,omitempty"`
+}
+
+// serveConfig are the values of the flags of the serve subcommand in addition
+// to the ones of [flags].
+type serveConfig struct {
+	// socket is the unix socket to accept clients on.
+	socket string
+
+	// size is the number of guests to keep booted.
+	size uint64
+
+	// metricsAddress is the TCP address to serve metrics on via HTTP. If
+	// empty, no metrics are served.
+	metricsAddress string
+}
+
+// serve keeps the number of guests given by flag "-pool" booted and set up,
+// waiting for jobs of clients, which connect to the unix socket given by flag
+// "-socket". See [runOnServer] for the client. Each guest runs a single job
+// and is replaced by a new one afterwards, so jobs do not interfere with each
+// other. Guests are booted with the given flags and with virtrun itself as
+// main binary, which is never run. The binaries of the jobs must be of the
+// same architecture. Shared libraries they require are sent along. With flag
+// "-metricsAddress", metrics of the pool are served via HTTP, see
+// [serveMetrics].
+func serve(args []string, _ io.Reader, _, stderr io.Writer) error {
+	cfg := serveConfig{size: defaultServePool}
+	flags := newServeFlags(args[0], stderr, &cfg)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("executable: %w", err)
+	}
+
+	// The main binary is virtrun itself, so the archive can be built, but
+	// it is never run, as the guests run the binaries of the jobs instead.
+	err = flags.ParseArgs(append(PrependEnvArgs(args[1:]), "--", executable))
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	err = flags.checkServe(cfg.socket)
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	err = Validate(flags.spec)
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+
+	setupLogging(stderr, flags.LogLevel(), flags.LogFormat())
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	dir, err := newRunTempDir(slog.Default())
+	if err != nil {
+		return fmt.Errorf("temp dir: %w", err)
+	}
+	defer dir.Remove() //nolint:errcheck
+
+	flags.spec.Initramfs.TempDir = dir.Path()
+	flags.spec.Qemu.TempDir = dir.Path()
+
+	pool, err := newServePool(flags, int(cfg.size))
+	if err != nil {
+		return err
+	}
+
+	// The archive is built once, as it is the same for all guests.
+	archive := filepath.Join(dir.Path(), serveArchiveName)
+
+	err = virtrun.WriteInitramfsArchive(ctx, flags.spec.Initramfs, archive)
+	if err != nil {
+		return fmt.Errorf("build initramfs: %w", err)
+	}
+
+	flags.spec.Initramfs.Archive = archive
+
+	// The socket file is removed once the listener is closed.
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "unix", cfg.socket)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	if cfg.metricsAddress != "" {
+		metricsListener, err := (&net.ListenConfig{}).Listen(ctx, "tcp",
+			cfg.metricsAddress)
+		if err != nil {
+			_ = listener.Close()
+			return fmt.Errorf("listen metrics: %w", err)
+		}
+
+		stop := serveMetricsHTTP(metricsListener, pool.metrics)
+		defer stop()
+	}
+
+	slog.Info("Serving", slog.String("socket", cfg.socket),
+		slog.Int("pool", pool.size))
+
+	return pool.serve(ctx, listener)
+}
+
+// newServeFlags returns [flags] with the additional flags "-socket", "-pool"
+// and "-metricsAddress" that set the values of the given [serveConfig].
+func newServeFlags(name string, output io.Writer, cfg *serveConfig) *flags {
+	flags := newFlags(name, output)
+	flags.flagSet.Init(name+" [flags...]", flag.ContinueOnError)
+	flags.flagSet.StringVar(
+		&cfg.socket,
+		"socket",
+		cfg.socket,
+		"unix socket to accept jobs of clients on. Required.",
+	)
+	flags.flagSet.Var(
+		&limitedUintValue{
+			Value: &cfg.size,
+			min:   1,
+		},
+		"pool",
+		"number of guests to keep booted. Guests are not reused, each one "+
+			"runs a single job and is replaced by a newly booted one.",
+	)
+	flags.flagSet.StringVar(
+		&cfg.metricsAddress,
+		"metricsAddress",
+		cfg.metricsAddress,
+		"TCP address, like localhost:9090, to serve metrics on in the "+
+			"Prometheus text format at path /metrics.",
+	)
+
+	return flags
+}
+
+// checkServe fails if flags are set that are not supported by the serve
+// subcommand or if the given socket is empty.
+func (f *flags) checkServe(socket string) error {
+	// The binary set by the serve subcommand is the only positional
+	// argument.
+	if f.flagSet.NArg() != 1 {
+		return f.fail("serve takes no binary, clients send their own", nil)
+	}
+
+	if socket == "" {
+		return f.fail("no socket given (use -socket)", nil)
+	}
+
+	if f.spec.Initramfs.StandaloneInit {
+		return f.fail("-standalone is not supported with serve", nil)
+	}
+
+	return f.checkMultipleRuns()
+}
+
+// serveJob is a run requested by a client, waiting for a guest.
+type serveJob struct {
+	job     virtrun.Job
+	timeout time.Duration
+	stdout  io.Writer
+
+	// started is the time a guest got the job.
+	started time.Time
+
+	// done receives the error of the run once it is done.
+	done chan error
+}
+
+// servePool keeps guests booted that wait for jobs. See [serve].
+type servePool struct {
+	flags *flags
+	size  int
+	arch  sys.Arch
+
+	// timeoutFactor scales the timeouts of the flags, if the guests are
+	// emulated.
+	timeoutFactor time.Duration
+
+	// jobs passes jobs to the waiting guests.
+	jobs chan *serveJob
+
+	// metrics collects the metrics of the pool.
+	metrics *serveMetrics
+
+	// run runs a single guest. It is [virtrun.Run], unless replaced by
+	// tests.
+	run func(
+		ctx context.Context,
+		spec *virtrun.Spec,
+		stdin io.Reader,
+		stdout, stderr io.Writer,
+	) (*virtrun.RunResult, error)
+}
+
+// newServePool creates a [servePool] of the given size for guests as given by
+// the flags.
+func newServePool(flags *flags, size int) (*servePool, error) {
+	arch, err := sys.ReadELFArch(flags.spec.Initramfs.Binary)
+	if err != nil {
+		return nil, fmt.Errorf("read main binary arch: %w", err)
+	}
+
+	pool := &servePool{
+		flags:         flags,
+		size:          size,
+		arch:          arch,
+		timeoutFactor: 1,
+		jobs:          make(chan *serveJob),
+		metrics:       newServeMetrics(),
+		run:           virtrun.Run,
+	}
+
+	if err := virtrun.CheckKVM(flags.spec); err != nil {
+		pool.timeoutFactor = virtrun.EmulationTimeoutFactor
+	}
+
+	return pool, nil
+}
+
+// serve boots the guests of the pool and serves clients connecting to the
+// listener until the context is canceled. Running guests are stopped then.
+func (p *servePool) serve(ctx context.Context, listener net.Listener) error {
+	var guests sync.WaitGroup
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// The guests must be stopped before returning, so their temporary files
+	// can be removed.
+	defer guests.Wait()
+	defer cancel()
+
+	for slot := range p.size {
+		logger := slog.With(slog.Int("slot", slot))
+
+		guests.Add(1)
+
+		go func() {
+			defer guests.Done()
+			p.runSlot(ctx, logger)
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("accept: %w", err)
+		}
+
+		go p.serveConn(ctx, conn)
+	}
+}
+
+// runSlot boots a guest after the other until the context is canceled.
+func (p *servePool) runSlot(ctx context.Context, logger *slog.Logger) {
+	for ctx.Err() == nil {
+		err := p.runGuest(ctx, logger)
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+
+		// A guest failing before it got a job fails most likely again, so
+		// retrying right away would just burn CPU time.
+		logger.Error("Guest failed", slog.Any("error", err))
+		p.metrics.fail(serveFailureBoot)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(serveRetryDelay):
+		}
+	}
+}
+
+// runGuest boots a guest that waits for a job and runs it. The error of the
+// run is sent to the job. An error is returned only if the guest failed before
+// it got a job.
+func (p *servePool) runGuest(ctx context.Context, logger *slog.Logger) error {
+	bootTimeout := p.flags.BootTimeout() * p.timeoutFactor
+
+	p.metrics.boot()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	ctx, stateHandler, stopTimeouts := withTimeouts(ctx, 0, bootTimeout)
+	defer stopTimeouts()
+
+	var (
+		output   serveOutput
+		assigned atomic.Pointer[serveJob]
+		timer    atomic.Pointer[time.Timer]
+	)
+
+	spec := *p.flags.spec
+	spec.Qemu.StateHandler = stateHandler
+	spec.Qemu.NextJob = func() (virtrun.Job, error) {
+		select {
+		case <-ctx.Done():
+			return virtrun.Job{}, context.Cause(ctx)
+		case job := <-p.jobs:
+			job.started = time.Now()
+			assigned.Store(job)
+			output.set(job.stdout)
+
+			// The run timeout starts once the guest got the job, as the
+			// time it waited is not related to it.
+			timeout := cmp.Or(job.timeout, p.flags.Timeout()) *
+				p.timeoutFactor
+			if timeout > 0 {
+				timer.Store(time.AfterFunc(timeout, func() {
+					cancel(&TimeoutError{Phase: "run", Timeout: timeout})
+				}))
+			}
+
+			return job.job, nil
+		}
+	}
+
+	qemuStderr := newQemuLogWriter(logger)
+	_, err := p.run(ctx, &spec, nil, &output, qemuStderr)
+	qemuStderr.Flush()
+
+	if t := timer.Load(); t != nil {
+		t.Stop()
+	}
+
+	// QEMU is interrupted once a timeout is exceeded, so the error of the
+	// run is just a consequence.
+	if timeoutErr := timeoutCause(ctx); err != nil && timeoutErr != nil {
+		err = timeoutErr
+	}
+
+	job := assigned.Load()
+	if job == nil {
+		return cmp.Or(err, ErrGuestWithoutJob)
+	}
+
+	p.metrics.run(time.Since(job.started), err)
+	job.done <- err
+
+	return nil
+}
+
+// serveConn serves the requests of a single client until it disconnects.
+func (p *servePool) serveConn(ctx context.Context, netConn net.Conn) {
+	defer netConn.Close()
+
+	conn := pipe.NewConn(netConn)
+	conn.EnableFlowControl(pipe.DefaultWindowSize)
+	conn.Handler = func(method string, params json.RawMessage) (any, error) {
+		if method != serveMethodRun {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownServeMethod, method)
+		}
+
+		var runParams serveRunParams
+
+		err := json.Unmarshal(params, &runParams)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return p.handleRun(ctx, conn.Writer(), runParams)
+	}
+
+	err := conn.Serve(netConn)
+	if err != nil {
+		slog.Warn("Serving client failed", slog.Any("error", err))
+	}
+}
+
+// handleRun runs the binary of the given parameters in the next free guest.
+// The output of the guest is sent to w as stream.
+func (p *servePool) handleRun(
+	ctx context.Context,
+	w *pipe.Writer,
+	params serveRunParams,
+) (serveRunResult, error) {
+	arch, err := sys.ReadELFArch(params.Binary)
+	if err != nil {
+		return serveRunResult{}, fmt.Errorf("read binary arch: %w", err)
+	}
+
+	if arch != p.arch {
+		return serveRunResult{}, fmt.Errorf("%w: binary is %s, guests are %s",
+			virtrun.ErrArchMismatch, arch, p.arch)
+	}
+
+	stdout, err := w.OpenStream(serveStdoutStream)
+	if err != nil {
+		return serveRunResult{}, fmt.Errorf("open stdout: %w", err)
+	}
+
+	job := &serveJob{
+		job: virtrun.Job{
+			Binary: params.Binary,
+			Args:   params.Args,
+			Env:    params.Env,
+		},
+		timeout: params.Timeout,
+		stdout:  stdout,
+		done:    make(chan error, 1),
+	}
+
+	runErr := p.submit(ctx, job)
+
+	// The stream must be closed before the response is sent, so the client
+	// has all output once it got the response.
+	err = stdout.Close()
+	if err != nil {
+		return serveRunResult{}, fmt.Errorf("close stdout: %w", err)
+	}
+
+	runErr = p.flags.exitCodes.wrap(runErr)
+
+	result := serveRunResult{ExitCode: exitCodeFor(runErr)}
+	if runErr != nil && !errors.Is(runErr, qemu.ErrGuestNonZeroExitCode) {
+		result.Error = runErr.Error()
+	}
+
+	return result, nil
+}
+
+// submit passes the job to the next free guest and returns the error of the
+// run once it is done. Whether a guest was free right away is counted by the
+// metrics.
+func (p *servePool) submit(ctx context.Context, job *serveJob) error {
+	select {
+	case p.jobs <- job:
+		p.metrics.job(true)
+		return <-job.done
+	default:
+		p.metrics.job(false)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case p.jobs <- job:
+		return <-job.done
+	}
+}
+
+// serveMetricsHTTP serves the metrics via HTTP on the given listener at path
+// "/metrics" until the returned stop function is called, which closes the
+// listener.
+func serveMetricsHTTP(listener net.Listener, metrics *serveMetrics) func() {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics)
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: serveMetricsTimeout,
+	}
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Serving metrics failed", slog.Any("error", err))
+		}
+	}()
+
+	slog.Info("Serving metrics",
+		slog.String("address", listener.Addr().String()))
+
+	return func() { _ = server.Close() }
+}
+
+// serveOutput is the stdout of a guest of the pool. Output is discarded until
+// the guest got a job, as it is not related to any job.
+type serveOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (o *serveOutput) set(w io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.w = w
+}
+
+// Write implements [io.Writer].
+func (o *serveOutput) Write(data []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.w == nil {
+		return len(data), nil
+	}
+
+	return o.w.Write(data) //nolint:wrapcheck
+}
+
+// addServerFlag adds the flag "-server" to the flags. See [runOnServer].
+func addServerFlag(flags *flags) {
+	flags.flagSet.StringVar(
+		&flags.server,
+		"server",
+		flags.server,
+		"unix socket of a virtrun serve instance to run the binary in one "+
+			"of its booted guests. Only the flags -env, -envPassthrough, "+
+			"-timeout and the go test flag rewrite flags may be used "+
+			"along, everything else is defined by the server.",
+	)
+}
+
+// runOnServer runs the binary given by the flags in a guest of the serve
+// subcommand listening on the unix socket given by flag "-server", instead of
+// booting a guest. Only the binary, its arguments, the environment variables
+// and the timeout are taken from the flags, see [serverRunFlags]. Everything
+// else is defined by the server. The output of the guest is written to stdout.
+func runOnServer(flags *flags, stdout io.Writer) error {
+	err := flags.checkServerRun()
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	netConn, err := (&net.Dialer{}).DialContext(ctx, "unix", flags.server)
+	if err != nil {
+		return fmt.Errorf("connect server: %w", err)
+	}
+	defer netConn.Close()
+
+	conn := pipe.NewConn(netConn)
+	conn.EnableFlowControl(pipe.DefaultWindowSize)
+	conn.Open = func(name string) (io.WriteCloser, error) {
+		if name != serveStdoutStream {
+			return nil, fmt.Errorf("%w: %s", virtrun.ErrUnknownStream, name)
+		}
+
+		return nopWriteCloser{stdout}, nil
+	}
+
+	go func() { _ = conn.Serve(netConn) }()
+
+	params := serveRunParams{
+		Binary:  flags.spec.Initramfs.Binary,
+		Args:    flags.spec.Qemu.InitArgs,
+		Env:     flags.spec.Qemu.Env,
+		Timeout: flags.Timeout(),
+	}
+
+	var result serveRunResult
+
+	// The stream is closed before the response is sent, so all output is
+	// written once the call returns.
+	err = conn.Call(ctx, serveMethodRun, params, &result)
+	if err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+
+	switch {
+	case result.Error != "":
+		return &ExitCodeError{
+			Err:      fmt.Errorf("%w: %s", ErrServerRunFailed, result.Error),
+			ExitCode: result.ExitCode,
+		}
+	case result.ExitCode != 0:
+		return &ExitCodeError{
+			Err:      qemu.ErrGuestNonZeroExitCode,
+			ExitCode: result.ExitCode,
+		}
+	default:
+		return nil
+	}
+}
+
+// serverRunFlags are the flags that take effect for runs on a server. All
+// others are defined by the server.
+var serverRunFlags = []string{
+	"server",
+	"env",
+	"envPassthrough",
+	"timeout",
+	"goTestFlagRewrite",
+	"noGoTestFlagRewrite",
+}
+
+// checkServerRun fails if flags other than [serverRunFlags] are set or if go
+// test flags are given that would be rewritten for a run, as runs on a server
+// can not rewrite them.
+func (f *flags) checkServerRun() error {
+	var ignored []string
+
+	f.flagSet.Visit(func(fl *flag.Flag) {
+		if !slices.Contains(serverRunFlags, fl.Name) {
+			ignored = append(ignored, "-"+fl.Name)
+		}
+	})
+
+	if len(ignored) > 0 {
+		return f.fail(strings.Join(ignored, ", ")+" not supported with "+
+			"-server, the server defines them", nil)
+	}
+
+	if f.spec.Qemu.NoGoTestFlagRewrite {
+		return nil
+	}
+
+	for _, arg := range f.spec.Qemu.InitArgs {
+		name, _, _ := strings.Cut(strings.TrimPrefix(arg, "-test."), "=")
+		if strings.HasPrefix(arg, "-test.") &&
+			slices.Contains(virtrun.GoTestFlagsRewritable, name) {
+			return f.fail("go test flag "+arg+" is not supported with "+
+				"-server (use -goTestFlagRewrite none)", nil)
+		}
+	}
+
+	return nil
+}
+
+// nopWriteCloser is an [io.WriteCloser] whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
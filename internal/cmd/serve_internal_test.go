@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServeRun runs a guest of a [servePool] without QEMU. It waits for a job
+// and prints its arguments and environment. The first argument selects the
+// result: "fail" exits with code 3, "hang" runs until the context is canceled
+// and everything else succeeds.
+func fakeServeRun(
+	ctx context.Context,
+	spec *virtrun.Spec,
+	_ io.Reader,
+	stdout, _ io.Writer,
+) (*virtrun.RunResult, error) {
+	job, err := spec.Qemu.NextJob()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(stdout, "args: %s, env: %s\n",
+		strings.Join(job.Args, " "), strings.Join(job.Env, " "))
+
+	switch job.Args[0] {
+	case "fail":
+		return &virtrun.RunResult{}, &qemu.CommandError{
+			Err:      qemu.ErrGuestNonZeroExitCode,
+			Guest:    true,
+			ExitCode: 3,
+		}
+	case "hang":
+		<-ctx.Done()
+		return &virtrun.RunResult{}, ctx.Err()
+	default:
+		return &virtrun.RunResult{}, nil
+	}
+}
+
+func TestServe(t *testing.T) {
+	executable, err := os.Executable()
+	require.NoError(t, err)
+
+	serveFlags := newServeFlags("serve", io.Discard, &serveConfig{})
+	require.NoError(t, serveFlags.ParseArgs([]string{
+		"-kernel", "/boot/this", "--", executable,
+	}))
+
+	pool, err := newServePool(serveFlags, 2)
+	require.NoError(t, err)
+
+	pool.run = fakeServeRun
+
+	socket := filepath.Join(t.TempDir(), "virtrun.sock")
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+
+	go func() { served <- pool.serve(ctx, listener) }()
+
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-served)
+	})
+
+	notELF := filepath.Join(t.TempDir(), "script")
+	require.NoError(t, os.WriteFile(notELF, []byte("#!/bin/sh"), 0o755))
+
+	tests := []struct {
+		name             string
+		args             []string
+		expectedOutput   string
+		expectedExitCode int
+		expectedErr      error
+	}{
+		{
+			name:           "success",
+			args:           []string{"-env", "A=1", executable, "ok", "-v"},
+			expectedOutput: "args: ok -v, env: A=1\n",
+		},
+		{
+			name:             "non-zero exit code",
+			args:             []string{executable, "fail"},
+			expectedOutput:   "args: fail, env: \n",
+			expectedExitCode: 3,
+			expectedErr:      qemu.ErrGuestNonZeroExitCode,
+		},
+		{
+			name:             "timeout",
+			args:             []string{"-timeout", "10ms", executable, "hang"},
+			expectedOutput:   "args: hang, env: \n",
+			expectedExitCode: exitCodeTimeout,
+			expectedErr:      ErrServerRunFailed,
+		},
+		{
+			name:        "not an ELF file",
+			args:        []string{notELF, "ok"},
+			expectedErr: pipe.ErrRemote,
+		},
+		{
+			name:        "host-side flag",
+			args:        []string{"-smp", "2", executable, "ok"},
+			expectedErr: &ParseArgsError{},
+		},
+		{
+			name: "rewritten go test flag",
+			args: []string{
+				executable, "-test.coverprofile=cover.out",
+			},
+			expectedErr: &ParseArgsError{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+
+			flags := newFlags("run", io.Discard)
+			addServerFlag(flags)
+
+			args := append([]string{"-server", socket}, tt.args...)
+			require.NoError(t, flags.ParseArgs(args))
+
+			err := runOnServer(flags, &stdout)
+			if tt.expectedErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tt.expectedErr)
+			}
+
+			assert.Equal(t, tt.expectedOutput, stdout.String())
+
+			if tt.expectedExitCode != 0 {
+				assert.Equal(t, tt.expectedExitCode, exitCodeFor(err))
+			}
+		})
+	}
+}
+
+func TestCheckServe(t *testing.T) {
+	executable, err := os.Executable()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		args        []string
+		socket      string
+		expectedErr bool
+	}{
+		{
+			name:   "valid",
+			args:   []string{"-kernel", "/boot/this"},
+			socket: "virtrun.sock",
+		},
+		{
+			name:        "no socket",
+			args:        []string{"-kernel", "/boot/this"},
+			expectedErr: true,
+		},
+		{
+			name:        "binary given",
+			args:        []string{"-kernel", "/boot/this", executable},
+			socket:      "virtrun.sock",
+			expectedErr: true,
+		},
+		{
+			name:        "standalone",
+			args:        []string{"-kernel", "/boot/this", "-standalone"},
+			socket:      "virtrun.sock",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := newServeFlags("serve", io.Discard, &serveConfig{})
+
+			args := append(tt.args, "--", executable)
+			require.NoError(t, flags.ParseArgs(args))
+
+			err := flags.checkServe(tt.socket)
+			if tt.expectedErr {
+				assert.ErrorIs(t, err, &ParseArgsError{})
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
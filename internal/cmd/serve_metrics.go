@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+)
+
+// Failure types of the serve subcommand, used as label of metric
+// "virtrun_serve_failures_total".
+const (
+	// serveFailureBoot is a guest that failed before it got a job.
+	serveFailureBoot = "boot"
+
+	// serveFailureTimeout is a job that exceeded its timeout.
+	serveFailureTimeout = "timeout"
+
+	// serveFailureExitCode is a job whose binary exited with a non-zero exit
+	// code.
+	serveFailureExitCode = "exit_code"
+
+	// serveFailureRun is a job that failed for any other reason.
+	serveFailureRun = "run"
+)
+
+// serveMetricsContentType is the content type of the Prometheus text
+// exposition format.
+const serveMetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// serveMetrics collects metrics of a [servePool]. It is an [http.Handler]
+// that serves them in the Prometheus text exposition format.
+type serveMetrics struct {
+	mu sync.Mutex
+
+	boots       uint64
+	hits        uint64
+	misses      uint64
+	runDuration time.Duration
+	runs        uint64
+	failures    map[string]uint64
+}
+
+// newServeMetrics returns [serveMetrics] with all failure types set to 0, so
+// they are present before the first failure.
+func newServeMetrics() *serveMetrics {
+	return &serveMetrics{
+		failures: map[string]uint64{
+			serveFailureBoot:     0,
+			serveFailureTimeout:  0,
+			serveFailureExitCode: 0,
+			serveFailureRun:      0,
+		},
+	}
+}
+
+// boot counts a guest boot.
+func (m *serveMetrics) boot() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.boots++
+}
+
+// job counts a job that got a guest right away if hit is true, or that had
+// to wait for one otherwise.
+func (m *serveMetrics) job(hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+// run counts a run of a job handed to a guest of the given duration and its
+// failure, if err is not nil. Failures before a guest got a job are counted
+// by [serveMetrics.fail] only, so they are not part of the run durations.
+func (m *serveMetrics) run(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runs++
+	m.runDuration += duration
+
+	if err != nil {
+		m.failures[serveFailureType(err)]++
+	}
+}
+
+// fail counts a failure of the given type.
+func (m *serveMetrics) fail(failureType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures[failureType]++
+}
+
+// serveFailureType returns the failure type for the error of a run.
+func serveFailureType(err error) string {
+	var timeoutErr *TimeoutError
+
+	switch {
+	case errors.As(err, &timeoutErr):
+		return serveFailureTimeout
+	case errors.Is(err, qemu.ErrGuestNonZeroExitCode):
+		return serveFailureExitCode
+	default:
+		return serveFailureRun
+	}
+}
+
+// ServeHTTP implements [http.Handler].
+func (m *serveMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", serveMetricsContentType)
+
+	_ = m.write(w)
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+func (m *serveMetrics) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counters := []struct {
+		name, help string
+		value      uint64
+	}{
+		{"virtrun_serve_boots_total", "Guests booted.", m.boots},
+		{"virtrun_serve_pool_hits_total",
+			"Jobs that got a booted guest right away.", m.hits},
+		{"virtrun_serve_pool_misses_total",
+			"Jobs that waited for a guest to boot.", m.misses},
+	}
+
+	for _, counter := range counters {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n",
+			counter.name, counter.help, counter.name, counter.name,
+			counter.value)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "# HELP virtrun_serve_run_duration_seconds "+
+		"Duration of jobs handed to a guest, from getting it to their "+
+		"end.\n"+
+		"# TYPE virtrun_serve_run_duration_seconds summary\n"+
+		"virtrun_serve_run_duration_seconds_sum %g\n"+
+		"virtrun_serve_run_duration_seconds_count %d\n",
+		m.runDuration.Seconds(), m.runs)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	_, err = io.WriteString(w, "# HELP virtrun_serve_failures_total "+
+		"Failed guests and jobs by type.\n"+
+		"# TYPE virtrun_serve_failures_total counter\n")
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	for _, failureType := range slices.Sorted(maps.Keys(m.failures)) {
+		_, err := fmt.Fprintf(w,
+			"virtrun_serve_failures_total{type=%q} %d\n",
+			failureType, m.failures[failureType])
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeMetrics(t *testing.T) {
+	metrics := newServeMetrics()
+	metrics.boot()
+	metrics.boot()
+	metrics.job(true)
+	metrics.job(false)
+	metrics.run(time.Second, nil)
+	metrics.run(500*time.Millisecond, &qemu.CommandError{
+		Err:      qemu.ErrGuestNonZeroExitCode,
+		ExitCode: 1,
+	})
+	metrics.run(2*time.Second, &TimeoutError{Phase: "run"})
+	metrics.run(time.Second, errors.New("broken"))
+	metrics.fail(serveFailureBoot)
+
+	expected := `# HELP virtrun_serve_boots_total Guests booted.
+# TYPE virtrun_serve_boots_total counter
+virtrun_serve_boots_total 2
+# HELP virtrun_serve_pool_hits_total Jobs that got a booted guest right away.
+# TYPE virtrun_serve_pool_hits_total counter
+virtrun_serve_pool_hits_total 1
+# HELP virtrun_serve_pool_misses_total Jobs that waited for a guest to boot.
+# TYPE virtrun_serve_pool_misses_total counter
+virtrun_serve_pool_misses_total 1
+# HELP virtrun_serve_run_duration_seconds ` +
+		`Duration of jobs handed to a guest, from getting it to their end.
+# TYPE virtrun_serve_run_duration_seconds summary
+virtrun_serve_run_duration_seconds_sum 4.5
+virtrun_serve_run_duration_seconds_count 4
+# HELP virtrun_serve_failures_total Failed guests and jobs by type.
+# TYPE virtrun_serve_failures_total counter
+virtrun_serve_failures_total{type="boot"} 1
+virtrun_serve_failures_total{type="exit_code"} 1
+virtrun_serve_failures_total{type="run"} 1
+virtrun_serve_failures_total{type="timeout"} 1
+`
+
+	t.Run("handler", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		metrics.ServeHTTP(recorder, httptest.NewRequest(
+			http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, serveMetricsContentType,
+			recorder.Header().Get("Content-Type"))
+		assert.Equal(t, expected, recorder.Body.String())
+	})
+
+	t.Run("text format", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, metrics.write(&buf))
+
+		expected := map[string]float64{
+			"virtrun_serve_boots_total":                      2,
+			"virtrun_serve_pool_hits_total":                  1,
+			"virtrun_serve_pool_misses_total":                1,
+			"virtrun_serve_run_duration_seconds_sum":         4.5,
+			"virtrun_serve_run_duration_seconds_count":       4,
+			`virtrun_serve_failures_total{type="boot"}`:      1,
+			`virtrun_serve_failures_total{type="exit_code"}`: 1,
+			`virtrun_serve_failures_total{type="run"}`:       1,
+			`virtrun_serve_failures_total{type="timeout"}`:   1,
+		}
+		assert.Equal(t, expected, parseMetricsText(t, buf.String()))
+	})
+
+	t.Run("http", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		stop := serveMetricsHTTP(listener, metrics)
+		t.Cleanup(stop)
+
+		url := "http://" + listener.Addr().String()
+
+		req, err := http.NewRequestWithContext(context.Background(),
+			http.MethodGet, url+"/metrics", nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, expected, string(body))
+	})
+}
+
+// metricsSampleRegexp matches a sample line of the Prometheus text exposition
+// format with the metric name, the optional labels and the value as groups.
+var metricsSampleRegexp = regexp.MustCompile(
+	`^([a-zA-Z_:][a-zA-Z0-9_:]*)` +
+		`(\{[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\.)*"` +
+		`(?:,[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\.)*")*\})? (\S+)$`)
+
+// parseMetricsText parses the given metrics in the Prometheus text exposition
+// format and returns the samples by name and labels. It fails the test if
+// the format is violated: each metric family needs a single HELP and TYPE
+// line before its samples, which must not be interleaved with other
+// families.
+func parseMetricsText(t *testing.T, text string) map[string]float64 {
+	t.Helper()
+
+	var (
+		samples = map[string]float64{}
+		types   = map[string]string{}
+		helps   = map[string]bool{}
+		sampled = map[string]bool{}
+		family  string
+	)
+
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if comment, ok := strings.CutPrefix(line, "# "); ok {
+			fields := strings.SplitN(comment, " ", 3)
+			require.Len(t, fields, 3, line)
+
+			name := fields[1]
+			require.False(t, sampled[name], "%s after samples", line)
+
+			switch fields[0] {
+			case "HELP":
+				require.False(t, helps[name], "duplicate %s", line)
+				helps[name] = true
+			case "TYPE":
+				require.NotContains(t, types, name, "duplicate %s", line)
+				require.Contains(t, []string{
+					"counter", "gauge", "summary", "histogram", "untyped",
+				}, fields[2], line)
+				types[name] = fields[2]
+			}
+
+			family = name
+
+			continue
+		}
+
+		match := metricsSampleRegexp.FindStringSubmatch(line)
+		require.NotNil(t, match, "invalid sample %q", line)
+
+		name := match[1]
+		if types[family] == "summary" {
+			name = strings.TrimSuffix(name, "_sum")
+			name = strings.TrimSuffix(name, "_count")
+		}
+
+		require.Equal(t, family, name, "sample %q of other family", line)
+		require.True(t, helps[name], "sample %q without HELP", line)
+
+		if types[name] == "counter" {
+			require.True(t, strings.HasSuffix(name, "_total"), line)
+		}
+
+		sampled[name] = true
+
+		value, err := strconv.ParseFloat(match[3], 64)
+		require.NoError(t, err, line)
+
+		key := match[1] + match[2]
+		require.NotContains(t, samples, key, "duplicate sample %q", line)
+		samples[key] = value
+	}
+
+	return samples
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// shell runs the given shell binary interactively in the guest. It runs with
+// a pseudo-terminal and control characters typed into the terminal are passed
+// to the guest. The guest powers off once the shell exits.
+func shell(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := newFlags(args[0], stderr)
+	flags.flagSet.Init(args[0]+" [flags...] shell [args...]",
+		flag.ContinueOnError)
+
+	err := flags.ParseArgs(PrependEnvArgs(args[1:]))
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	if flags.NoTTYPassthrough() {
+		err := flags.fail("-noTTYPassthrough is not supported for a shell",
+			nil)
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	if flags.spec.Initramfs.StandaloneInit {
+		err := flags.fail("-standalone is not supported for a shell", nil)
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	flags.spec.Qemu.PTY = true
+	flags.spec.Qemu.Interactive = true
+
+	// The terminal type is passed, so the shell and other programs in the
+	// guest use the capabilities of the host terminal. It can be overridden
+	// by flag.
+	if term := os.Getenv("TERM"); term != "" {
+		flags.spec.Qemu.Env = append([]string{"TERM=" + term},
+			flags.spec.Qemu.Env...)
+	}
+
+	return runFlags(flags, stdin, stdout, stderr)
+}
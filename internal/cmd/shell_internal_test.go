@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellStandalone(t *testing.T) {
+	var stderr bytes.Buffer
+
+	args := []string{
+		"virtrun shell",
+		"-kernel", "/boot/this",
+		"-standalone",
+		"/bin/busybox", "sh",
+	}
+
+	err := shell(args, nil, nil, &stderr)
+	require.ErrorIs(t, err, &ParseArgsError{})
+	require.ErrorContains(t, err, "-standalone is not supported")
+}
+
+func TestShellNoTTYPassthrough(t *testing.T) {
+	var stderr bytes.Buffer
+
+	args := []string{
+		"virtrun shell",
+		"-kernel", "/boot/this",
+		"-noTTYPassthrough",
+		"/bin/busybox", "sh",
+	}
+
+	err := shell(args, nil, nil, &stderr)
+	require.ErrorIs(t, err, &ParseArgsError{})
+	require.ErrorContains(t, err, "-noTTYPassthrough is not supported")
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// smpAuto is the value of the SMP flag for using as many CPUs as the host
+// has, up to a cap.
+const smpAuto = "auto"
+
+// smpValue is the number of CPUs of the guest. Besides a fixed number, it
+// accepts "auto" for the number of CPUs available on the host, capped at the
+// max value, and "auto:CAP" with a lower cap.
+type smpValue struct {
+	limitedUintValue
+}
+
+func (s *smpValue) Set(str string) error {
+	capValue, isAuto := strings.CutPrefix(str, smpAuto)
+	if !isAuto {
+		return s.limitedUintValue.Set(str)
+	}
+
+	limit := s.max
+
+	if capValue != "" {
+		capValue, found := strings.CutPrefix(capValue, ":")
+		if !found {
+			return fmt.Errorf("parse: invalid value %q", str)
+		}
+
+		value := limitedUintValue{Value: &limit, min: s.min, max: s.max}
+
+		err := value.Set(capValue)
+		if err != nil {
+			return fmt.Errorf("cap: %w", err)
+		}
+	}
+
+	*s.Value = min(uint64(runtime.NumCPU()), limit)
+
+	return nil
+}
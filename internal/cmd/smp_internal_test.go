@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMPValue_Set(t *testing.T) {
+	hostCPUs := uint64(runtime.NumCPU())
+
+	tests := []struct {
+		input       string
+		expected    uint64
+		expectedErr error
+	}{
+		{
+			input:    "3",
+			expected: 3,
+		},
+		{
+			input:    "auto",
+			expected: min(hostCPUs, smpMax),
+		},
+		{
+			input:    "auto:1",
+			expected: 1,
+		},
+		{
+			input:    "auto:2",
+			expected: min(hostCPUs, 2),
+		},
+		{
+			input:       "auto:17",
+			expectedErr: ErrValueOutOfRange,
+		},
+		{
+			input:       "17",
+			expectedErr: ErrValueOutOfRange,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var smp uint64
+
+			value := smpValue{
+				limitedUintValue{Value: &smp, min: smpMin, max: smpMax},
+			}
+
+			err := value.Set(tt.input)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, smp)
+		})
+	}
+
+	t.Run("invalid auto", func(t *testing.T) {
+		var smp uint64
+
+		value := smpValue{limitedUintValue{Value: &smp}}
+		require.Error(t, value.Set("automatic"))
+	})
+}
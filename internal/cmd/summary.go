@@ -0,0 +1,270 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// summaryPackage is the package name of the runs in summaries.
+const summaryPackage = "virtrun"
+
+// runSummary is the summary of one of multiple runs.
+type runSummary struct {
+	// name is the name of the run, like the binary or profile name.
+	name string
+
+	// start is the time the run started.
+	start time.Time
+
+	// duration is how long the run took.
+	duration time.Duration
+
+	// err is the error of the run.
+	err error
+}
+
+// summaryFiles are the paths of the files summaries of multiple runs are
+// written to. Summaries are not written, if the path is empty.
+type summaryFiles struct {
+	junit     string
+	test2json string
+}
+
+// addFlags adds the flags for the summary files to the given
+// [flag.FlagSet].
+func (s *summaryFiles) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(
+		&s.junit,
+		"junitFile",
+		s.junit,
+		"file to write a JUnit XML report with a test case for each run to.",
+	)
+
+	fs.StringVar(
+		&s.test2json,
+		"test2jsonFile",
+		s.test2json,
+		"file to write go test2json events with a test for each run to.",
+	)
+}
+
+// write writes the given summaries into the files with non-empty paths.
+func (s *summaryFiles) write(summaries []runSummary) error {
+	writers := []struct {
+		path string
+		fn   func(io.Writer, []runSummary) error
+	}{
+		{s.junit, writeJUnit},
+		{s.test2json, writeTest2JSON},
+	}
+
+	for _, writer := range writers {
+		if writer.path == "" {
+			continue
+		}
+
+		err := writeSummaryFile(writer.path, summaries, writer.fn)
+		if err != nil {
+			return fmt.Errorf("write summary: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeSummaryFile writes the given summaries to the file at the given path
+// using the given function. An existing file is overwritten.
+func writeSummaryFile(
+	path string,
+	summaries []runSummary,
+	fn func(io.Writer, []runSummary) error,
+) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	err = fn(file, summaries)
+	if err != nil {
+		return err
+	}
+
+	return file.Close() //nolint:wrapcheck
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the given summaries as JUnit XML report with a single
+// test suite. Each run is a test case.
+func writeJUnit(w io.Writer, summaries []runSummary) error {
+	var total time.Duration
+
+	suite := junitTestSuite{
+		Name:  summaryPackage,
+		Tests: len(summaries),
+	}
+
+	for _, summary := range summaries {
+		total += summary.duration
+
+		testCase := junitTestCase{
+			Name:      summary.name,
+			ClassName: summaryPackage,
+			Time:      junitTime(summary.duration),
+		}
+
+		if summary.err != nil {
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				Message: describeResult(summary.err),
+				Text:    summary.err.Error(),
+			}
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	suite.Time = junitTime(total)
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	err = encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err //nolint:wrapcheck
+}
+
+// junitTime formats the given duration in seconds.
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// test2jsonEvent is an event as written by "go tool test2json".
+type test2jsonEvent struct {
+	Time    time.Time `json:",omitempty"`
+	Action  string
+	Package string   `json:",omitempty"`
+	Test    string   `json:",omitempty"`
+	Elapsed *float64 `json:",omitempty"`
+	Output  string   `json:",omitempty"`
+}
+
+// writeTest2JSON writes the given summaries as events like
+// "go tool test2json" does. Each run is a test of a single package. The
+// error of a failed run is the output of its test.
+func writeTest2JSON(w io.Writer, summaries []runSummary) error {
+	var events []test2jsonEvent
+
+	failed := false
+
+	for _, summary := range summaries {
+		end := summary.start.Add(summary.duration)
+		elapsed := summary.duration.Seconds()
+		action := "pass"
+
+		events = append(events, test2jsonEvent{
+			Time:    summary.start,
+			Action:  "run",
+			Package: summaryPackage,
+			Test:    summary.name,
+		})
+
+		if summary.err != nil {
+			failed = true
+			action = "fail"
+
+			events = append(events, test2jsonEvent{
+				Time:    end,
+				Action:  "output",
+				Package: summaryPackage,
+				Test:    summary.name,
+				Output:  summary.err.Error() + "\n",
+			})
+		}
+
+		events = append(events, test2jsonEvent{
+			Time:    end,
+			Action:  action,
+			Package: summaryPackage,
+			Test:    summary.name,
+			Elapsed: &elapsed,
+		})
+	}
+
+	packageAction := "pass"
+	if failed {
+		packageAction = "fail"
+	}
+
+	events = append(events, test2jsonEvent{
+		Time:    summariesEnd(summaries),
+		Action:  packageAction,
+		Package: summaryPackage,
+	})
+
+	encoder := json.NewEncoder(w)
+
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return nil
+}
+
+// summariesEnd returns the time the last of the given runs ended.
+func summariesEnd(summaries []runSummary) time.Time {
+	var end time.Time
+
+	for _, summary := range summaries {
+		if runEnd := summary.start.Add(summary.duration); runEnd.After(end) {
+			end = runEnd
+		}
+	}
+
+	return end
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSummaries() []runSummary {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	return []runSummary{
+		{
+			name:     "a.test",
+			start:    start,
+			duration: 1500 * time.Millisecond,
+		},
+		{
+			name:     "b.test",
+			start:    start.Add(time.Second),
+			duration: 2 * time.Second,
+			err: &qemu.CommandError{
+				Err:      qemu.ErrGuestNonZeroExitCode,
+				Guest:    true,
+				ExitCode: 1,
+			},
+		},
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := writeJUnit(&buf, testSummaries())
+	require.NoError(t, err)
+
+	expected := xml.Header + "<testsuites>\n" +
+		`  <testsuite name="virtrun" tests="2" failures="1" time="3.500">` +
+		"\n" +
+		`    <testcase name="a.test" classname="virtrun" time="1.500">` +
+		"</testcase>\n" +
+		`    <testcase name="b.test" classname="virtrun" time="2.000">` +
+		"\n" +
+		`      <failure message="exit 1">` +
+		"qemu guest: guest did not return exit code 0</failure>\n" +
+		"    </testcase>\n" +
+		"  </testsuite>\n" +
+		"</testsuites>\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriteTest2JSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := writeTest2JSON(&buf, testSummaries())
+	require.NoError(t, err)
+
+	expected := "" +
+		`{"Time":"2024-05-01T12:00:00Z","Action":"run",` +
+		`"Package":"virtrun","Test":"a.test"}` + "\n" +
+		`{"Time":"2024-05-01T12:00:01.5Z","Action":"pass",` +
+		`"Package":"virtrun","Test":"a.test","Elapsed":1.5}` + "\n" +
+		`{"Time":"2024-05-01T12:00:01Z","Action":"run",` +
+		`"Package":"virtrun","Test":"b.test"}` + "\n" +
+		`{"Time":"2024-05-01T12:00:03Z","Action":"output",` +
+		`"Package":"virtrun","Test":"b.test",` +
+		`"Output":"qemu guest: guest did not return exit code 0\n"}` + "\n" +
+		`{"Time":"2024-05-01T12:00:03Z","Action":"fail",` +
+		`"Package":"virtrun","Test":"b.test","Elapsed":2}` + "\n" +
+		`{"Time":"2024-05-01T12:00:03Z","Action":"fail",` +
+		`"Package":"virtrun"}` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestSummaryFiles_Write(t *testing.T) {
+	dir := t.TempDir()
+	files := summaryFiles{
+		junit:     filepath.Join(dir, "junit.xml"),
+		test2json: filepath.Join(dir, "test2json.json"),
+	}
+
+	summaries := []runSummary{{name: "a.test", err: errors.New("boom")}}
+
+	require.NoError(t, files.write(summaries))
+
+	for _, path := range []string{files.junit, files.test2json} {
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "boom")
+	}
+
+	files.junit = filepath.Join(dir, "missing", "junit.xml")
+
+	assert.ErrorContains(t, files.write(summaries), "write summary")
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// saveTerminal returns a function that restores the current state of the
+// terminal and true, if the given reader is one. Otherwise, the function does
+// nothing and false is returned.
+func saveTerminal(r io.Reader) (func(), bool) {
+	file, ok := r.(*os.File)
+	if !ok {
+		return func() {}, false
+	}
+
+	fd := int(file.Fd())
+
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return func() {}, false
+	}
+
+	return func() {
+		_ = unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	}, true
+}
+
+// terminalInput returns the input for QEMU and a function that restores the
+// state of the terminal, if stdin is one. QEMU puts the terminal into raw
+// mode and restores it on exit, but not if it is killed, like once a timeout
+// is exceeded. Unless passthrough is true, QEMU gets no input instead of the
+// terminal, so it does not change the terminal's state at all.
+func terminalInput(stdin io.Reader, passthrough bool) (io.Reader, func()) {
+	restore, isTerminal := saveTerminal(stdin)
+	if isTerminal && !passthrough {
+		return nil, restore
+	}
+
+	return stdin, restore
+}
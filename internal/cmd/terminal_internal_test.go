@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestTerminalInput_NoTerminal(t *testing.T) {
+	readPipe, writePipe, err := os.Pipe()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = readPipe.Close()
+		_ = writePipe.Close()
+	})
+
+	tests := []struct {
+		name  string
+		stdin io.Reader
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name:  "reader",
+			stdin: strings.NewReader("input"),
+		},
+		{
+			name:  "pipe",
+			stdin: readPipe,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, isTerminal := saveTerminal(tt.stdin)
+			assert.False(t, isTerminal)
+
+			for _, passthrough := range []bool{true, false} {
+				stdin, restore := terminalInput(tt.stdin, passthrough)
+				assert.Equal(t, tt.stdin, stdin)
+				assert.NotPanics(t, restore)
+			}
+		})
+	}
+}
+
+func TestTerminalInput_Terminal(t *testing.T) {
+	terminal, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+
+	t.Cleanup(func() { _ = terminal.Close() })
+
+	fd := int(terminal.Fd())
+
+	initial, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	require.NoError(t, err)
+
+	t.Run("passthrough", func(t *testing.T) {
+		stdin, restore := terminalInput(terminal, true)
+		assert.Equal(t, terminal, stdin)
+
+		// Raw mode like QEMU sets it, without echo.
+		raw := *initial
+		raw.Lflag &^= unix.ECHO | unix.ICANON
+		require.NoError(t, unix.IoctlSetTermios(fd, unix.TCSETS, &raw))
+
+		restore()
+
+		restored, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+		require.NoError(t, err)
+		assert.Equal(t, initial.Lflag, restored.Lflag)
+	})
+
+	t.Run("no passthrough", func(t *testing.T) {
+		stdin, _ := terminalInput(terminal, false)
+		assert.Nil(t, stdin)
+	})
+}
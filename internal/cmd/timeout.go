@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aibor/virtrun/sysinit"
+)
+
+// exitCodeTimeout is the exit code if a [TimeoutError] occurred. It is the
+// same timeout(1) uses.
+const exitCodeTimeout = 124
+
+// withTimeouts returns a context that is canceled with a [TimeoutError] as
+// cause once the run timeout is exceeded or the guest did not boot within the
+// boot timeout. The guest is considered booted once it communicated
+// [sysinit.StateBooted] to the returned state handler. A timeout is disabled
+// if it is 0.
+func withTimeouts(
+	ctx context.Context,
+	runTimeout, bootTimeout time.Duration,
+) (context.Context, func(state string), context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	var runTimer, bootTimer *time.Timer
+
+	if runTimeout > 0 {
+		runTimer = time.AfterFunc(runTimeout, func() {
+			cancel(&TimeoutError{Phase: "run", Timeout: runTimeout})
+		})
+	}
+
+	if bootTimeout > 0 {
+		bootTimer = time.AfterFunc(bootTimeout, func() {
+			cancel(&TimeoutError{Phase: "boot", Timeout: bootTimeout})
+		})
+	}
+
+	stateHandler := func(state string) {
+		if bootTimer != nil && state == string(sysinit.StateBooted) {
+			bootTimer.Stop()
+		}
+	}
+
+	stop := func() {
+		for _, timer := range []*time.Timer{runTimer, bootTimer} {
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+
+		cancel(nil)
+	}
+
+	return ctx, stateHandler, stop
+}
+
+// timeoutCause returns the [TimeoutError] the given context was canceled
+// with, if any.
+func timeoutCause(ctx context.Context) error {
+	var timeoutErr *TimeoutError
+	if errors.As(context.Cause(ctx), &timeoutErr) {
+		return timeoutErr
+	}
+
+	return nil
+}
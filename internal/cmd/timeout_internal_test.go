@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTimeouts(t *testing.T) {
+	const (
+		short = 10 * time.Millisecond
+		long  = time.Minute
+	)
+
+	tests := []struct {
+		name          string
+		runTimeout    time.Duration
+		bootTimeout   time.Duration
+		states        []sysinit.State
+		expectedPhase string
+	}{
+		{
+			name:          "run timeout",
+			runTimeout:    short,
+			bootTimeout:   long,
+			states:        []sysinit.State{sysinit.StateBooted},
+			expectedPhase: "run",
+		},
+		{
+			name:          "boot timeout",
+			runTimeout:    long,
+			bootTimeout:   short,
+			expectedPhase: "boot",
+		},
+		{
+			name:          "boot timeout other state",
+			bootTimeout:   short,
+			states:        []sysinit.State{"other"},
+			expectedPhase: "boot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, stateHandler, stop := withTimeouts(
+				context.Background(),
+				tt.runTimeout,
+				tt.bootTimeout,
+			)
+			defer stop()
+
+			for _, state := range tt.states {
+				stateHandler(string(state))
+			}
+
+			<-ctx.Done()
+
+			err := timeoutCause(ctx)
+
+			var timeoutErr *TimeoutError
+
+			require.ErrorAs(t, err, &timeoutErr)
+			assert.Equal(t, tt.expectedPhase, timeoutErr.Phase)
+			assert.Equal(t, exitCodeTimeout, exitCodeFor(err))
+		})
+	}
+}
+
+func TestWithTimeouts_Booted(t *testing.T) {
+	ctx, stateHandler, stop := withTimeouts(
+		context.Background(),
+		0,
+		10*time.Millisecond,
+	)
+
+	stateHandler(string(sysinit.StateBooted))
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, ctx.Err())
+
+	stop()
+
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.NoError(t, timeoutCause(ctx))
+}
@@ -6,8 +6,11 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
+	"github.com/aibor/virtrun/internal/sys"
 	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/aibor/virtrun/sysinit"
 )
 
 // Validate file parameters of the given [Spec].
@@ -17,21 +20,134 @@ func Validate(spec *virtrun.Spec) error {
 		return fmt.Errorf("kernel file: %w", err)
 	}
 
-	for _, file := range spec.Initramfs.Files {
+	if spec.Qemu.Firmware != "" {
+		err := ValidateFilePath(spec.Qemu.Firmware)
+		if err != nil {
+			return fmt.Errorf("firmware file: %w", err)
+		}
+	}
+
+	for _, file := range spec.Qemu.PushFiles {
 		err := ValidateFilePath(file)
+		if err != nil {
+			return fmt.Errorf("push file: %w", err)
+		}
+	}
+
+	if spec.Initramfs.Archive != "" {
+		err := ValidateFilePath(spec.Initramfs.Archive)
+		if err != nil {
+			return fmt.Errorf("initramfs: %w", err)
+		}
+	}
+
+	// The init runs the binary chrooted into the host's root directory, so
+	// neither the binary as init nor files outside of it work.
+	if spec.Qemu.HostRoot {
+		switch {
+		case spec.Initramfs.StandaloneInit:
+			return fmt.Errorf("standalone mode: %w", ErrHostRootConflict)
+		case spec.Initramfs.Image != "":
+			return fmt.Errorf("image: %w", ErrHostRootConflict)
+		case len(spec.Initramfs.Volumes) > 0:
+			return fmt.Errorf("volume: %w", ErrHostRootConflict)
+		case hasGuestPathFiles(spec.Initramfs):
+			return fmt.Errorf("file target: %w", ErrHostRootConflict)
+		}
+	}
+
+	return validateInitramfs(spec.Initramfs)
+}
+
+// validateInitramfs validates the file parameters of the given
+// [virtrun.Initramfs].
+func validateInitramfs(cfg virtrun.Initramfs) error {
+	for _, file := range cfg.Files {
+		err := ValidateFilePath(file)
+		if err != nil {
+			return fmt.Errorf("additional file: %w", err)
+		}
+	}
+
+	for _, file := range cfg.FileTargets {
+		err := ValidateFilePath(file.Source)
 		if err != nil {
 			return fmt.Errorf("additional file: %w", err)
 		}
 	}
 
-	for _, file := range spec.Initramfs.Modules {
+	for _, file := range cfg.Modules {
 		err := ValidateFilePath(file)
 		if err != nil {
 			return fmt.Errorf("module: %w", err)
 		}
 	}
 
-	err = ValidateFilePath(spec.Initramfs.Binary)
+	for _, module := range cfg.KernelModules {
+		if !sys.IsModulePath(module) {
+			continue
+		}
+
+		err := ValidateFilePath(module)
+		if err != nil {
+			return fmt.Errorf("module: %w", err)
+		}
+	}
+
+	for _, file := range cfg.BinfmtFiles {
+		err := ValidateFilePath(file)
+		if err != nil {
+			return fmt.Errorf("binfmt file: %w", err)
+		}
+	}
+
+	for _, volume := range cfg.Volumes {
+		_, err := os.Stat(volume.Source)
+		if err != nil {
+			return fmt.Errorf("volume: %w", err)
+		}
+	}
+
+	if cfg.InitConfig != "" {
+		err := ValidateFilePath(cfg.InitConfig)
+		if err != nil {
+			return fmt.Errorf("init config: %w", err)
+		}
+
+		// A standalone init does not read the config.
+		if cfg.StandaloneInit {
+			return fmt.Errorf("init config: %w", ErrStandaloneConflict)
+		}
+
+		// Mistakes in the config are reported before the guest boots.
+		initCfg, err := sysinit.ReadInitConfig(cfg.InitConfig)
+		if err != nil {
+			return fmt.Errorf("init config: %w", err)
+		}
+
+		err = initCfg.ValidateUnits()
+		if err != nil {
+			return fmt.Errorf("init config: %w", err)
+		}
+	}
+
+	// The init runs the binary chrooted into the image, so neither the
+	// binary as init nor volumes and files outside of the image work.
+	if cfg.Image != "" {
+		if cfg.StandaloneInit {
+			return fmt.Errorf("standalone mode: %w", ErrImageConflict)
+		}
+
+		if len(cfg.Volumes) > 0 {
+			return fmt.Errorf("volume: %w", ErrImageConflict)
+		}
+
+		if hasGuestPathFiles(cfg) {
+			return fmt.Errorf("file target: %w", ErrImageConflict)
+		}
+	}
+
+	err := ValidateFilePath(cfg.Binary)
 	if err != nil {
 		return fmt.Errorf("main binary: %w", err)
 	}
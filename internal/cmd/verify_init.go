@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// verifyInitTimeout is the timeout for verifying an init, if none is given
+// by flag.
+const verifyInitTimeout = time.Minute
+
+// initPoweroffHint tells how to fix an init that does not power off.
+const initPoweroffHint = "call sysinit.Poweroff once done instead of " +
+	"exiting, the init must not return"
+
+// verifyInit boots the given binary as standalone init and checks that it
+// satisfies the contract of virtrun for inits: it prints its exit code, like
+// with sysinit.PrintExitCode, and powers off the system within the timeout.
+// It prints the result of each check and fails if any check failed. The exit
+// code of the init itself does not matter.
+func verifyInit(
+	args []string,
+	stdin io.Reader,
+	stdout, stderr io.Writer,
+) error {
+	flags := newFlags(args[0], stderr)
+	flags.flagSet.Init(args[0]+" [flags...] binary [args...]",
+		flag.ContinueOnError)
+
+	err := flags.ParseArgs(PrependEnvArgs(args[1:]))
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	flags.spec.Initramfs.StandaloneInit = true
+
+	if flags.timeout == 0 {
+		flags.timeout = verifyInitTimeout
+	}
+
+	err = Validate(flags.spec)
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+
+	setupLogging(stderr, flags.LogLevel(), flags.LogFormat())
+
+	ctx, cancel := notifyContext()
+	defer cancel()
+
+	result, err := runWithTimeouts(ctx, flags, flags.spec,
+		stdin, stdout, slog.Default())
+	if result == nil {
+		return fmt.Errorf("run: %w", err)
+	}
+
+	if printCheckResults(stdout, checkInitContract(result, err)) {
+		return ErrInitContractViolated
+	}
+
+	return nil
+}
+
+// checkInitContract checks the result and error of the run of an init for
+// the contract of virtrun for inits.
+func checkInitContract(result *virtrun.RunResult, err error) []checkResult {
+	var code int
+
+	var cmdErr *qemu.CommandError
+	if errors.As(err, &cmdErr) {
+		code = cmdErr.ExitCode
+	}
+
+	exitCode := checkResult{
+		name:   "exit code",
+		status: checkOK,
+		msg:    fmt.Sprintf("printed exit code %d", code),
+	}
+
+	if !result.ExitCodeFound {
+		exitCode.status = checkFail
+		exitCode.msg = "no exit code found in the output"
+		exitCode.hint = "print it with sysinit.PrintExitCode before " +
+			"powering off"
+	}
+
+	poweroff := checkResult{
+		name:   "poweroff",
+		status: checkOK,
+		msg:    "system powered off",
+	}
+
+	timeout := checkResult{
+		name:   "timeout",
+		status: checkOK,
+		msg: fmt.Sprintf("finished after %s",
+			result.Duration.Round(time.Millisecond)),
+	}
+
+	switch {
+	case errors.Is(err, qemu.ErrGuestPanic):
+		poweroff.status = checkFail
+		poweroff.msg = "kernel panicked, probably because the init exited"
+		poweroff.hint = initPoweroffHint
+	case errors.Is(err, &TimeoutError{}) && result.ExitCodeFound:
+		poweroff.status = checkFail
+		poweroff.msg = "system still running after the exit code was printed"
+		poweroff.hint = initPoweroffHint
+	case errors.Is(err, &TimeoutError{}):
+		poweroff.status = checkSkip
+		poweroff.msg = "no exit code printed before the timeout"
+	}
+
+	if errors.Is(err, &TimeoutError{}) {
+		timeout.status = checkFail
+		timeout.msg = err.Error()
+		timeout.hint = "raise -timeout if the init just needs more time"
+	}
+
+	return []checkResult{exitCode, poweroff, timeout}
+}
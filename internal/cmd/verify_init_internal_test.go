@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckInitContract(t *testing.T) {
+	timeoutErr := &TimeoutError{Phase: "run", Timeout: time.Minute}
+
+	tests := []struct {
+		name     string
+		result   *virtrun.RunResult
+		err      error
+		expected []string
+	}{
+		{
+			name:     "success",
+			result:   &virtrun.RunResult{ExitCodeFound: true},
+			expected: []string{checkOK, checkOK, checkOK},
+		},
+		{
+			name:   "non zero exit code",
+			result: &virtrun.RunResult{ExitCodeFound: true},
+			err: &qemu.CommandError{
+				Err:      qemu.ErrGuestNonZeroExitCode,
+				Guest:    true,
+				ExitCode: 3,
+			},
+			expected: []string{checkOK, checkOK, checkOK},
+		},
+		{
+			name:   "no exit code",
+			result: &virtrun.RunResult{},
+			err: &qemu.CommandError{
+				Err:   qemu.ErrGuestNoExitCodeFound,
+				Guest: true,
+			},
+			expected: []string{checkFail, checkOK, checkOK},
+		},
+		{
+			name:   "init exited",
+			result: &virtrun.RunResult{ExitCodeFound: true},
+			err: &qemu.CommandError{
+				Err:   qemu.ErrGuestPanic,
+				Guest: true,
+			},
+			expected: []string{checkOK, checkFail, checkOK},
+		},
+		{
+			name:     "no poweroff",
+			result:   &virtrun.RunResult{ExitCodeFound: true},
+			err:      timeoutErr,
+			expected: []string{checkOK, checkFail, checkFail},
+		},
+		{
+			name:     "hanging",
+			result:   &virtrun.RunResult{},
+			err:      timeoutErr,
+			expected: []string{checkFail, checkSkip, checkFail},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := checkInitContract(tt.result, tt.err)
+
+			var actual []string
+			for _, result := range results {
+				actual = append(actual, result.status)
+			}
+
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestCheckInitContract_ExitCode(t *testing.T) {
+	err := &qemu.CommandError{
+		Err:      qemu.ErrGuestNonZeroExitCode,
+		Guest:    true,
+		ExitCode: 3,
+	}
+
+	results := checkInitContract(&virtrun.RunResult{ExitCodeFound: true}, err)
+	assert.Equal(t, "printed exit code 3", results[0].msg)
+}
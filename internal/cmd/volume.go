@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+// hiddenGuestDirs are guest directories the init mounts file systems on, so
+// volumes within them would be hidden.
+var hiddenGuestDirs = []string{"/dev", "/proc", "/run", "/sys", "/tmp"}
+
+// VolumeList is a list of host paths that are copied into the guest in the
+// form "HOSTPATH:GUESTPATH[:ro]".
+type VolumeList []virtrun.Volume
+
+func (v *VolumeList) String() string {
+	volumes := make([]string, len(*v))
+
+	for idx, volume := range *v {
+		volumes[idx] = volume.Source + ":" + volume.Target
+		if volume.ReadOnly {
+			volumes[idx] += ":ro"
+		}
+	}
+
+	return strings.Join(volumes, ",")
+}
+
+func (v *VolumeList) Set(s string) error {
+	parts := strings.Split(s, ":")
+
+	var volume virtrun.Volume
+
+	switch {
+	case len(parts) == 3 && parts[2] == "ro":
+		volume.ReadOnly = true
+	case len(parts) != 2:
+		return fmt.Errorf("%w: not HOSTPATH:GUESTPATH[:ro]: %s",
+			ErrInvalidVolume, s)
+	}
+
+	source, err := AbsoluteFilePath(parts[0])
+	if err != nil {
+		return err
+	}
+
+	volume.Source = source
+	volume.Target = filepath.Clean(parts[1])
+
+	switch {
+	case !filepath.IsAbs(volume.Target):
+		return fmt.Errorf("%w: guest path not absolute: %s",
+			ErrInvalidVolume, s)
+	case volume.Target == "/" || isHiddenGuestPath(volume.Target):
+		return fmt.Errorf("%w: guest path hidden by mount: %s",
+			ErrInvalidVolume, s)
+	case strings.ContainsAny(volume.Target, " \t\n\";"):
+		return fmt.Errorf("%w: invalid character: %s", ErrInvalidVolume, s)
+	}
+
+	*v = append(*v, volume)
+
+	return nil
+}
+
+func isHiddenGuestPath(path string) bool {
+	for _, dir := range hiddenGuestDirs {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
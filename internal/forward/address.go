@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package forward
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Address is a socket address in the form "unix:PATH" or "tcp:HOST:PORT".
+type Address string
+
+// Network returns the network of the address, like "unix" or "tcp".
+func (a Address) Network() string {
+	network, _, _ := strings.Cut(string(a), ":")
+	return network
+}
+
+// Address returns the address without network.
+func (a Address) Address() string {
+	_, address, _ := strings.Cut(string(a), ":")
+	return address
+}
+
+func (a Address) String() string {
+	return string(a)
+}
+
+// ParseAddress parses the given socket address in the form "unix:PATH" or
+// "tcp:HOST:PORT".
+func ParseAddress(s string) (Address, error) {
+	network, address, found := strings.Cut(s, ":")
+	if !found || address == "" {
+		return "", fmt.Errorf("%w: not NETWORK:ADDRESS: %s",
+			ErrInvalidAddress, s)
+	}
+
+	switch network {
+	case "unix":
+		if !strings.HasPrefix(address, "/") {
+			return "", fmt.Errorf("%w: path not absolute: %s",
+				ErrInvalidAddress, s)
+		}
+	case "tcp":
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidAddress, err)
+		}
+	default:
+		return "", fmt.Errorf("%w: unknown network: %s",
+			ErrInvalidAddress, network)
+	}
+
+	if strings.ContainsAny(address, " \t\n\";") {
+		return "", fmt.Errorf("%w: invalid character: %s",
+			ErrInvalidAddress, s)
+	}
+
+	return Address(s), nil
+}
@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package forward
+
+import "errors"
+
+var (
+	// ErrInvalidAddress is returned if a socket address can not be parsed.
+	ErrInvalidAddress = errors.New("invalid address")
+
+	// ErrUnknownConn is returned if there is no connection for a stream.
+	ErrUnknownConn = errors.New("unknown connection")
+)
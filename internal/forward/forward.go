@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package forward implements forwarding of socket connections between guest
+// and host over streams of the framed pipe protocol.
+//
+// Each forwarded connection is a pair of streams with the same name, one for
+// each direction. Each end adds its side of the connection to its [Bridges]
+// and sends the data read from it with [Bridges.Send]. Streams received from
+// the remote end are written to the connection by [Bridges.Open]. The
+// connection is closed once both directions are done.
+package forward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/aibor/virtrun/internal/pipe"
+)
+
+// Bridges holds the connections forwarded by stream name.
+//
+// The zero value is ready to use. It is safe for concurrent use.
+type Bridges struct {
+	mu    sync.Mutex
+	conns map[string]*bridge
+}
+
+// bridge is a forwarded connection. It is closed once both directions are
+// done.
+type bridge struct {
+	conn net.Conn
+	done int
+}
+
+// Add adds the given connection with the given stream name.
+func (b *Bridges) Add(name string, conn net.Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conns == nil {
+		b.conns = make(map[string]*bridge)
+	}
+
+	b.conns[name] = &bridge{conn: conn}
+}
+
+// Remove closes and removes the connection with the given stream name.
+func (b *Bridges) Remove(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if bridge, exists := b.conns[name]; exists {
+		_ = bridge.conn.Close()
+
+		delete(b.conns, name)
+	}
+}
+
+// Len returns the number of connections.
+func (b *Bridges) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.conns)
+}
+
+// Open returns the destination for the stream with the given name received
+// from the remote end. It is meant to be used as [pipe.OpenFunc].
+//
+// Data is written to the connection with the same name. Once the stream is
+// closed, the connection is closed for writing. Write errors are ignored, as
+// they must not fail the whole pipe connection. The remote end notices them
+// once the connection is closed.
+func (b *Bridges) Open(name string) (io.WriteCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bridge, exists := b.conns[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownConn, name)
+	}
+
+	return &connWriter{bridges: b, name: name, conn: bridge.conn}, nil
+}
+
+// Send sends the data read from the connection with the given name as stream
+// with the same name with the given [pipe.Writer] until the connection is
+// closed for reading.
+func (b *Bridges) Send(w *pipe.Writer, name string) error {
+	b.mu.Lock()
+	bridge, exists := b.conns[name]
+	b.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownConn, name)
+	}
+
+	defer b.finish(name)
+
+	stream, err := w.OpenStream(name)
+	if err != nil {
+		return fmt.Errorf("open stream %s: %w", name, err)
+	}
+
+	// Data is sent as soon as it is read, unlike [pipe.Writer.SendStream]
+	// does, as the remote end might wait for it before sending more.
+	buf := make([]byte, pipe.MaxPayloadSize)
+
+	for {
+		n, err := bridge.conn.Read(buf)
+		if n > 0 {
+			if _, err := stream.Write(buf[:n]); err != nil {
+				return fmt.Errorf("send %s: %w", name, err)
+			}
+		}
+
+		// Connections that are reset or closed end the stream like a
+		// regular end of the connection.
+		if err != nil {
+			break
+		}
+	}
+
+	return stream.Close() //nolint:wrapcheck
+}
+
+// finish marks one direction of the connection with the given name done. The
+// connection is closed and removed once both are done.
+func (b *Bridges) finish(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bridge, exists := b.conns[name]
+	if !exists {
+		return
+	}
+
+	bridge.done++
+	if bridge.done < 2 {
+		return
+	}
+
+	_ = bridge.conn.Close()
+
+	delete(b.conns, name)
+}
+
+// connWriter writes a received stream into a forwarded connection.
+type connWriter struct {
+	bridges *Bridges
+	name    string
+	conn    net.Conn
+	failed  bool
+}
+
+func (w *connWriter) Write(data []byte) (int, error) {
+	if !w.failed {
+		_, err := w.conn.Write(data)
+		w.failed = err != nil
+	}
+
+	return len(data), nil
+}
+
+// Close closes the connection for writing, if supported. The connection is
+// closed completely once the other direction is done as well.
+func (w *connWriter) Close() error {
+	if conn, ok := w.conn.(interface{ CloseWrite() error }); ok {
+		_ = conn.CloseWrite()
+	}
+
+	w.bridges.finish(w.name)
+
+	return nil
+}
@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package forward_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/forward"
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridges(t *testing.T) {
+	// OS pipes are buffered like consoles, so both ends can send window
+	// frames at the same time.
+	guestRead, hostWrite, err := os.Pipe()
+	require.NoError(t, err)
+
+	hostRead, guestWrite, err := os.Pipe()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = guestWrite.Close()
+		_ = hostWrite.Close()
+	})
+
+	var guestBridges, hostBridges forward.Bridges
+
+	guest := pipe.NewConn(guestWrite)
+	guest.EnableFlowControl(pipe.DefaultWindowSize)
+	guest.Open = guestBridges.Open
+
+	host := pipe.NewConn(hostWrite)
+	host.EnableFlowControl(pipe.DefaultWindowSize)
+	host.Open = hostBridges.Open
+
+	go func() { _ = guest.Serve(guestRead) }()
+	go func() { _ = host.Serve(hostRead) }()
+
+	client, guestConn := net.Pipe()
+	hostConn, server := net.Pipe()
+
+	guestBridges.Add("forward:1", guestConn)
+	hostBridges.Add("forward:1", hostConn)
+
+	go func() { _ = guestBridges.Send(guest.Writer(), "forward:1") }()
+	go func() { _ = hostBridges.Send(host.Writer(), "forward:1") }()
+
+	buf := make([]byte, 4)
+
+	_, err = client.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	_, err = io.ReadFull(server, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = server.Write([]byte("pong"))
+	require.NoError(t, err)
+
+	_, err = io.ReadFull(client, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+
+	require.NoError(t, client.Close())
+	require.NoError(t, server.Close())
+
+	assert.Eventually(t, func() bool {
+		return guestBridges.Len() == 0 && hostBridges.Len() == 0
+	}, time.Second, 10*time.Millisecond, "connections closed")
+}
+
+func TestBridges_UnknownConn(t *testing.T) {
+	var bridges forward.Bridges
+
+	_, err := bridges.Open("forward:1")
+	require.ErrorIs(t, err, forward.ErrUnknownConn)
+
+	err = bridges.Send(pipe.NewWriter(io.Discard), "forward:1")
+	require.ErrorIs(t, err, forward.ErrUnknownConn)
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedNetwork string
+		expectedAddress string
+		expectedErr     error
+	}{
+		{
+			input:           "unix:/run/db.sock",
+			expectedNetwork: "unix",
+			expectedAddress: "/run/db.sock",
+		},
+		{
+			input:           "tcp:127.0.0.1:5432",
+			expectedNetwork: "tcp",
+			expectedAddress: "127.0.0.1:5432",
+		},
+		{
+			input:       "127.0.0.1:5432",
+			expectedErr: forward.ErrInvalidAddress,
+		},
+		{
+			input:       "tcp:localhost",
+			expectedErr: forward.ErrInvalidAddress,
+		},
+		{
+			input:       "unix:db.sock",
+			expectedErr: forward.ErrInvalidAddress,
+		},
+		{
+			input:       "unix:",
+			expectedErr: forward.ErrInvalidAddress,
+		},
+		{
+			input:       "unix:/run/db;sock",
+			expectedErr: forward.ErrInvalidAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			address, err := forward.ParseAddress(tt.input)
+			require.ErrorIs(t, err, tt.expectedErr)
+
+			if tt.expectedErr == nil {
+				assert.Equal(t, tt.expectedNetwork, address.Network())
+				assert.Equal(t, tt.expectedAddress, address.Address())
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package hostconn holds the connection of the guest init to the host, so
+// public packages can use it without exposing it.
+package hostconn
+
+import (
+	"sync/atomic"
+
+	"github.com/aibor/virtrun/internal/pipe"
+)
+
+var conn atomic.Pointer[pipe.Conn]
+
+// Set sets the connection to the host.
+func Set(c *pipe.Conn) {
+	conn.Store(c)
+}
+
+// Get returns the connection to the host. It returns nil if none is set.
+func Get() *pipe.Conn {
+	return conn.Load()
+}
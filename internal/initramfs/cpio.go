@@ -5,6 +5,7 @@
 package initramfs
 
 import (
+	"errors"
 	"io"
 	"io/fs"
 	"os"
@@ -16,11 +17,34 @@ import (
 // archive/tar and archive/zip implement it.
 type CPIOFSWriter struct {
 	*cpio.Writer
+
+	// Progress is called by [CPIOFSWriter.AddFS] after each file with the
+	// number of files added and bytes written so far, if set.
+	Progress func(files int, written int64)
+
+	counter *countingWriter
+	files   int
 }
 
 // NewCPIOFSWriter creates a new archive writer.
 func NewCPIOFSWriter(w io.Writer) *CPIOFSWriter {
-	return &CPIOFSWriter{cpio.NewWriter(w)}
+	counter := &countingWriter{w: w}
+
+	return &CPIOFSWriter{
+		Writer:  cpio.NewWriter(counter),
+		counter: counter,
+	}
+}
+
+// Files returns the number of files added by [CPIOFSWriter.AddFS] so far.
+func (w *CPIOFSWriter) Files() int {
+	return w.files
+}
+
+// Written returns the number of bytes written to the underlying writer so
+// far.
+func (w *CPIOFSWriter) Written() int64 {
+	return w.counter.written
 }
 
 // AddFS adds the files from fs.FS to the archive.
@@ -71,6 +95,12 @@ func (w *CPIOFSWriter) AddFS(fsys fs.FS) error {
 			}
 		}
 
+		w.files++
+
+		if w.Progress != nil {
+			w.Progress(w.files, w.counter.written)
+		}
+
 		return nil
 	})
 }
@@ -107,3 +137,37 @@ func (w *CPIOFSWriter) writeBody(
 		return ErrFileInvalid
 	}
 }
+
+// ReadCPIOHeaders reads the headers of all files of the CPIO archive read from
+// r.
+func ReadCPIOHeaders(r io.Reader) ([]*cpio.Header, error) {
+	reader := cpio.NewReader(r)
+
+	var headers []*cpio.Header
+
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return headers, nil
+		}
+
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		headers = append(headers, header)
+	}
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	n, err := w.w.Write(data)
+	w.written += int64(n)
+
+	return n, err //nolint:wrapcheck
+}
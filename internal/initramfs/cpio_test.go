@@ -79,3 +79,49 @@ func TestCPIOFSWriter_AddFS(t *testing.T) {
 
 	assert.Equal(t, sourceFS, extractedFS)
 }
+
+func TestReadCPIOHeaders(t *testing.T) {
+	var archive bytes.Buffer
+
+	w := initramfs.NewCPIOFSWriter(&archive)
+	require.NoError(t, w.AddFS(fstest.MapFS{
+		"regular": &fstest.MapFile{Data: []byte("data")},
+		"dir":     &fstest.MapFile{Mode: fs.ModeDir},
+	}))
+	require.NoError(t, w.Close())
+
+	headers, err := initramfs.ReadCPIOHeaders(&archive)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(headers))
+	for _, header := range headers {
+		names = append(names, header.Name)
+	}
+
+	assert.Equal(t, []string{".", "dir", "regular"}, names)
+	assert.Equal(t, int64(4), headers[2].Size)
+}
+
+func TestCPIOFSWriter_Progress(t *testing.T) {
+	var (
+		archive bytes.Buffer
+		files   []int
+	)
+
+	w := initramfs.NewCPIOFSWriter(&archive)
+	w.Progress = func(count int, written int64) {
+		files = append(files, count)
+
+		assert.Equal(t, int64(archive.Len()), written)
+	}
+
+	require.NoError(t, w.AddFS(fstest.MapFS{
+		"regular": &fstest.MapFile{Data: []byte("data")},
+		"dir":     &fstest.MapFile{Mode: fs.ModeDir},
+	}))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, []int{1, 2, 3}, files)
+	assert.Equal(t, 3, w.Files())
+	assert.Equal(t, int64(archive.Len()), w.Written())
+}
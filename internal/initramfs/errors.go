@@ -6,7 +6,9 @@ package initramfs
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
+	"strings"
 )
 
 var (
@@ -33,7 +35,28 @@ var (
 	// ErrSymlinkTooDeep is returned if there are too many symbolic links to
 	// follow.
 	ErrSymlinkTooDeep = errors.New("nested links too deep")
+
+	// ErrSymlinkCycle is returned if symbolic links link to each other, so
+	// they never resolve. It is an [ErrSymlinkTooDeep] as well.
+	ErrSymlinkCycle = fmt.Errorf("%w: links form a cycle", ErrSymlinkTooDeep)
 )
 
 // PathError records an error and the operation and file path that caused it.
 type PathError = fs.PathError
+
+// SymlinkError records an error resolving a symbolic link along with the
+// chain of link targets that were followed until the error occurred.
+type SymlinkError struct {
+	Chain []string
+	Err   error
+}
+
+// Error implements the [error] interface.
+func (e *SymlinkError) Error() string {
+	return "link chain " + strings.Join(e.Chain, " -> ") + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SymlinkError) Unwrap() error {
+	return e.Err
+}
@@ -16,6 +16,7 @@ import (
 
 type file interface {
 	open(entry dirEntry) (fs.File, error)
+	info(entry dirEntry) (*fileInfo, error)
 	mode() fs.FileMode
 }
 
@@ -35,26 +36,28 @@ func (e *dirEntry) Type() fs.FileMode { return e.file.mode().Type() }
 func (e *dirEntry) IsDir() bool       { return e.file.mode()&fs.ModeDir != 0 }
 func (e *dirEntry) String() string    { return fs.FormatDirEntry(e) }
 
+// Info implements [fs.DirEntry]. Regular files added with a [FileStatFunc]
+// are not opened.
 func (e *dirEntry) Info() (fs.FileInfo, error) {
-	file, err := e.file.open(*e)
+	info, err := e.file.info(*e)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	return file.Stat() //nolint:wrapcheck
+	return info, nil
 }
 
 type fileInfo struct {
 	dirEntry
-	size int64
+	size    int64
+	modTime time.Time
 }
 
-func (i *fileInfo) Size() int64       { return i.size }
-func (i *fileInfo) Mode() fs.FileMode { return i.file.mode() }
-func (*fileInfo) ModTime() time.Time  { return time.Time{} }
-func (i *fileInfo) Sys() any          { return i.file }
-func (i *fileInfo) String() string    { return fs.FormatFileInfo(i) }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) Mode() fs.FileMode  { return i.file.mode() }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) Sys() any           { return i.file }
+func (i *fileInfo) String() string     { return fs.FormatFileInfo(i) }
 
 var (
 	_ fs.File        = (*openFile)(nil)
@@ -117,38 +120,82 @@ func (f *openFile) ReadDir(count int) ([]fs.DirEntry, error) {
 
 var _ file = (*regularFile)(nil)
 
-type regularFile FileOpenFunc
+// regularFile is a regular file whose content is read from a source. Its size
+// and modification time are taken from the source. The mode is always the
+// default one, so files are executable in any case.
+type regularFile struct {
+	openFn FileOpenFunc
+	statFn FileStatFunc
+}
 
-func (regularFile) mode() fs.FileMode {
+func (*regularFile) mode() fs.FileMode {
 	return defaultFileMode
 }
 
-func (f regularFile) open(info dirEntry) (fs.File, error) {
-	file, err := f()
+func (f *regularFile) open(entry dirEntry) (fs.File, error) {
+	file, err := f.openFn()
 	if err != nil {
 		return nil, err
 	}
 
 	sourceInfo, err := file.Stat()
 	if err != nil {
+		_ = file.Close()
 		return nil, err //nolint:wrapcheck
 	}
 
-	if !sourceInfo.Mode().IsRegular() {
-		return nil, ErrFileNotRegular
+	info, err := newRegularFileInfo(entry, sourceInfo)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
 	}
 
 	o := &openFile{
-		info: fileInfo{
-			dirEntry: info,
-			size:     sourceInfo.Size(),
-		},
+		info:   *info,
 		reader: file,
 	}
 
 	return o, nil
 }
 
+// info returns the [fileInfo] resolved from the source. The source is opened
+// only if there is no [FileStatFunc].
+func (f *regularFile) info(entry dirEntry) (*fileInfo, error) {
+	if f.statFn == nil {
+		file, err := f.open(entry)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		return &file.(*openFile).info, nil
+	}
+
+	sourceInfo, err := f.statFn()
+	if err != nil {
+		return nil, err
+	}
+
+	return newRegularFileInfo(entry, sourceInfo)
+}
+
+func newRegularFileInfo(
+	entry dirEntry,
+	sourceInfo fs.FileInfo,
+) (*fileInfo, error) {
+	if !sourceInfo.Mode().IsRegular() {
+		return nil, ErrFileNotRegular
+	}
+
+	info := &fileInfo{
+		dirEntry: entry,
+		size:     sourceInfo.Size(),
+		modTime:  sourceInfo.ModTime(),
+	}
+
+	return info, nil
+}
+
 var _ file = (*symbolicLink)(nil)
 
 type symbolicLink string
@@ -157,12 +204,12 @@ func (symbolicLink) mode() fs.FileMode {
 	return defaultFileMode | fs.ModeSymlink
 }
 
-func (l symbolicLink) open(info dirEntry) (fs.File, error) {
+func (l symbolicLink) open(entry dirEntry) (fs.File, error) {
 	reader := strings.NewReader(string(l))
 
 	o := &openFile{
 		info: fileInfo{
-			dirEntry: info,
+			dirEntry: entry,
 			size:     reader.Size(),
 		},
 		reader: reader,
@@ -171,6 +218,10 @@ func (l symbolicLink) open(info dirEntry) (fs.File, error) {
 	return o, nil
 }
 
+func (l symbolicLink) info(entry dirEntry) (*fileInfo, error) {
+	return &fileInfo{dirEntry: entry, size: int64(len(l))}, nil
+}
+
 var _ file = (*directory)(nil)
 
 type directory map[string]file
@@ -179,10 +230,10 @@ func (*directory) mode() fs.FileMode {
 	return defaultFileMode | fs.ModeDir
 }
 
-func (d *directory) open(info dirEntry) (fs.File, error) {
+func (d *directory) open(entry dirEntry) (fs.File, error) {
 	o := &openFile{
 		info: fileInfo{
-			dirEntry: info,
+			dirEntry: entry,
 		},
 		entries: d.entries(),
 	}
@@ -190,6 +241,10 @@ func (d *directory) open(info dirEntry) (fs.File, error) {
 	return o, nil
 }
 
+func (*directory) info(entry dirEntry) (*fileInfo, error) {
+	return &fileInfo{dirEntry: entry}, nil
+}
+
 func (d *directory) entries() []fs.DirEntry {
 	entries := make([]fs.DirEntry, 0, len(*d))
 
@@ -5,9 +5,11 @@
 package initramfs
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -19,9 +21,14 @@ const (
 // FileOpenFunc returns an open [fs.File] or an error if opening fails.
 type FileOpenFunc func() (fs.File, error)
 
+// FileStatFunc returns the [fs.FileInfo] of a file without opening it or an
+// error if it fails, like [os.Stat].
+type FileStatFunc func() (fs.FileInfo, error)
+
 // FSAdder defines the interface required to add files to a FS.
 type FSAdder interface {
 	Add(name string, openFn FileOpenFunc) error
+	AddWithStat(name string, openFn FileOpenFunc, statFn FileStatFunc) error
 	Symlink(oldname, newname string) error
 	Mkdir(name string) error
 	MkdirAll(name string) error
@@ -136,7 +143,7 @@ func (fsys *FS) Mkdir(name string) error {
 func (fsys *FS) MkdirAll(name string) error {
 	cleaned := clean(name)
 
-	dEntry, err := fsys.find(cleaned, symlinkDepth)
+	dEntry, err := fsys.find(cleaned, nil)
 	if err == nil {
 		if dEntry.IsDir() {
 			return nil
@@ -165,6 +172,20 @@ func (fsys *FS) MkdirAll(name string) error {
 // File content is read from the file returned by the given [FileOpenFunc]. It
 // returns a [PathError] in case of errors.
 func (fsys *FS) Add(name string, openFn FileOpenFunc) error {
+	return fsys.AddWithStat(name, openFn, nil)
+}
+
+// AddWithStat creates a new regular file with the given name like [FS.Add].
+//
+// Its size and modification time are resolved with the given [FileStatFunc]
+// whenever the [fs.FileInfo] of its [fs.DirEntry] is requested, so walking the
+// tree does not open the file. If the [FileStatFunc] is nil, the file is
+// opened instead. It returns a [PathError] in case of errors.
+func (fsys *FS) AddWithStat(
+	name string,
+	openFn FileOpenFunc,
+	statFn FileStatFunc,
+) error {
 	if openFn == nil {
 		return &PathError{
 			Op:   "add",
@@ -173,7 +194,7 @@ func (fsys *FS) Add(name string, openFn FileOpenFunc) error {
 		}
 	}
 
-	err := fsys.add(name, regularFile(openFn))
+	err := fsys.add(name, &regularFile{openFn: openFn, statFn: statFn})
 	if err != nil {
 		return &PathError{
 			Op:   "add",
@@ -203,8 +224,61 @@ func (fsys *FS) Symlink(oldname, newname string) error {
 	return nil
 }
 
+// ResolveAll resolves all symbolic links in the [FS], so broken ones are
+// found before the [FS] is used, like for writing an archive. Links in the
+// trees at the given paths are skipped, like copied trees whose links are
+// meant to be resolved relative to their own directory.
+//
+// It returns a [PathError] for each symbolic link that does not resolve,
+// joined with [errors.Join]. Their errors are [SymlinkError]s with the chain
+// of link targets.
+func (fsys *FS) ResolveAll(skip ...string) error {
+	var errs []error
+
+	skipped := make([]string, 0, len(skip))
+	for _, path := range skip {
+		skipped = append(skipped, clean(path))
+	}
+
+	err := fs.WalkDir(fsys, ".", func(
+		name string, entry fs.DirEntry, err error,
+	) error {
+		if err != nil {
+			return err
+		}
+
+		if slices.Contains(skipped, name) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if entry.Type() != fs.ModeSymlink {
+			return nil
+		}
+
+		_, err = fsys.find(name, nil)
+		if err != nil {
+			errs = append(errs, &PathError{
+				Op:   "resolve",
+				Path: name,
+				Err:  err,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return errors.Join(errs...)
+}
+
 func (fsys *FS) subDir(name string) (*directory, error) {
-	dEntry, err := fsys.find(name, symlinkDepth)
+	dEntry, err := fsys.find(name, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -239,7 +313,7 @@ func (fsys *FS) open(name string, follow bool) (fs.File, error) {
 		findFn = fsys.find
 	}
 
-	dEntry, err := findFn(name, symlinkDepth)
+	dEntry, err := findFn(name, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -248,7 +322,7 @@ func (fsys *FS) open(name string, follow bool) (fs.File, error) {
 }
 
 func (fsys *FS) readlink(name string) (string, error) {
-	dEntry, err := fsys.findNoFollow(name, symlinkDepth)
+	dEntry, err := fsys.findNoFollow(name, nil)
 	if err != nil {
 		return "", err
 	}
@@ -276,16 +350,19 @@ func (fsys *FS) lstat(name string) (fs.FileInfo, error) {
 	return info, nil
 }
 
-func (fsys *FS) find(name string, depth uint) (dirEntry, error) {
-	dEntry, err := fsys.findNoFollow(name, depth)
+// find looks up the file with the given name and follows symbolic links. The
+// chain contains the targets of the symbolic links followed so far to get to
+// the name.
+func (fsys *FS) find(name string, chain []string) (dirEntry, error) {
+	dEntry, err := fsys.findNoFollow(name, chain)
 	if err != nil {
 		return dirEntry{}, err
 	}
 
-	return fsys.follow(dEntry, depth)
+	return fsys.follow(dEntry, chain)
 }
 
-func (fsys *FS) findNoFollow(name string, depth uint) (dirEntry, error) {
+func (fsys *FS) findNoFollow(name string, chain []string) (dirEntry, error) {
 	dEntry := dirEntry{name, &fsys.root}
 
 	if name == "" || name == "." {
@@ -300,7 +377,7 @@ func (fsys *FS) findNoFollow(name string, depth uint) (dirEntry, error) {
 	for _, name = range nodes {
 		var err error
 
-		dEntry, err = fsys.follow(dEntry, depth)
+		dEntry, err = fsys.follow(dEntry, chain)
 		if err != nil {
 			return dirEntry{}, err
 		}
@@ -320,19 +397,41 @@ func (fsys *FS) findNoFollow(name string, depth uint) (dirEntry, error) {
 	return dEntry, nil
 }
 
-func (fsys *FS) follow(dEntry dirEntry, depth uint) (dirEntry, error) {
+// follow resolves the given entry, if it is a symbolic link. Targets are
+// resolved from the root of the [FS], even relative ones. Errors are returned
+// as [SymlinkError] with the chain of resolved absolute link targets that led
+// to it.
+func (fsys *FS) follow(dEntry dirEntry, chain []string) (dirEntry, error) {
 	symlink, isSymlink := dEntry.file.(symbolicLink)
 	if !isSymlink {
 		return dEntry, nil
 	}
 
-	if depth == 0 {
-		return dirEntry{}, ErrSymlinkTooDeep
+	target := clean(string(symlink))
+	absTarget := string(filepath.Separator) + target
+	cycle := slices.Contains(chain, absTarget)
+
+	chain = append(slices.Clone(chain), absTarget)
+
+	switch {
+	case cycle:
+		return dirEntry{}, &SymlinkError{Chain: chain, Err: ErrSymlinkCycle}
+	case len(chain) > symlinkDepth:
+		return dirEntry{}, &SymlinkError{Chain: chain, Err: ErrSymlinkTooDeep}
 	}
 
-	depth--
+	resolved, err := fsys.find(target, chain)
+	if err != nil {
+		// Errors of nested links have the longer chain already.
+		var symlinkErr *SymlinkError
+		if !errors.As(err, &symlinkErr) {
+			err = &SymlinkError{Chain: chain, Err: err}
+		}
+
+		return dirEntry{}, err
+	}
 
-	return fsys.find(clean(string(symlink)), depth)
+	return resolved, nil
 }
 
 func clean(path string) string {
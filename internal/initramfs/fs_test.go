@@ -5,9 +5,11 @@
 package initramfs_test
 
 import (
+	"fmt"
 	"io/fs"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/aibor/virtrun/internal/initramfs"
 	"github.com/stretchr/testify/assert"
@@ -48,6 +50,59 @@ func TestFiles_TestFS(t *testing.T) {
 	})
 }
 
+func TestFS_AddWithStat(t *testing.T) {
+	modTime := time.Date(2024, 5, 4, 3, 2, 1, 0, time.UTC)
+	sourceFS := fstest.MapFS{
+		"file": &fstest.MapFile{Data: []byte("content"), ModTime: modTime},
+		"dir":  &fstest.MapFile{Mode: fs.ModeDir},
+	}
+
+	opened := 0
+
+	addFn := func(fsys *initramfs.FS, name, source string) error {
+		return fsys.AddWithStat(name,
+			func() (fs.File, error) {
+				opened++
+				return sourceFS.Open(source)
+			},
+			func() (fs.FileInfo, error) {
+				return fs.Stat(sourceFS, source)
+			},
+		)
+	}
+
+	t.Run("info without open", func(t *testing.T) {
+		fsys := initramfs.New()
+		require.NoError(t, addFn(fsys, "file", "file"))
+
+		entries, err := fs.ReadDir(fsys, ".")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		info, err := entries[0].Info()
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(7), info.Size())
+		assert.Equal(t, modTime, info.ModTime())
+		assert.Equal(t, fs.FileMode(0o755), info.Mode())
+		assert.Zero(t, opened)
+
+		require.NoError(t, fstest.TestFS(fsys, "file"))
+	})
+
+	t.Run("source not regular", func(t *testing.T) {
+		fsys := initramfs.New()
+		require.NoError(t, addFn(fsys, "file", "dir"))
+
+		entries, err := fs.ReadDir(fsys, ".")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		_, err = entries[0].Info()
+		require.ErrorIs(t, err, initramfs.ErrFileNotRegular)
+	})
+}
+
 func TestFS_Add(t *testing.T) {
 	testFS := fstest.MapFS{
 		"test": &fstest.MapFile{
@@ -406,3 +461,119 @@ func TestFS_ReadLink(t *testing.T) {
 		})
 	}
 }
+
+func TestFS_ResolveAll(t *testing.T) {
+	tests := []struct {
+		name          string
+		links         [][2]string
+		skip          []string
+		expectedErr   error
+		expectedChain string
+	}{
+		{
+			name: "valid",
+			links: [][2]string{
+				{"/dir", "link"},
+				{"link", "other"},
+			},
+		},
+		{
+			name: "relative to root",
+			links: [][2]string{
+				{"dir", "dir/root"},
+			},
+		},
+		{
+			name: "relative broken",
+			links: [][2]string{
+				{"missing", "dir/link"},
+			},
+			expectedErr:   initramfs.ErrFileNotExist,
+			expectedChain: "resolve dir/link: link chain /missing: ",
+		},
+		{
+			name: "relative cycle",
+			links: [][2]string{
+				{"b", "a"},
+				{"/a", "b"},
+			},
+			expectedErr:   initramfs.ErrSymlinkCycle,
+			expectedChain: "resolve a: link chain /b -> /a -> /b: ",
+		},
+		{
+			name: "broken",
+			links: [][2]string{
+				{"/missing", "link"},
+			},
+			expectedErr:   initramfs.ErrFileNotExist,
+			expectedChain: "resolve link: link chain /missing: ",
+		},
+		{
+			name: "broken nested",
+			links: [][2]string{
+				{"/other", "link"},
+				{"/missing", "other"},
+			},
+			expectedErr:   initramfs.ErrFileNotExist,
+			expectedChain: "resolve link: link chain /other -> /missing: ",
+		},
+		{
+			name: "broken skipped",
+			links: [][2]string{
+				{"/missing", "dir/link"},
+			},
+			skip: []string{"/dir"},
+		},
+		{
+			name: "cycle",
+			links: [][2]string{
+				{"/b", "a"},
+				{"/a", "b"},
+			},
+			expectedErr:   initramfs.ErrSymlinkCycle,
+			expectedChain: "resolve a: link chain /b -> /a -> /b: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := initramfs.New()
+			require.NoError(t, fsys.Mkdir("dir"))
+
+			for _, link := range tt.links {
+				require.NoError(t, fsys.Symlink(link[0], link[1]))
+			}
+
+			err := fsys.ResolveAll(tt.skip...)
+			require.ErrorIs(t, err, tt.expectedErr)
+
+			if tt.expectedErr != nil {
+				var symlinkErr *initramfs.SymlinkError
+				require.ErrorAs(t, err, &symlinkErr)
+				assert.Contains(t, err.Error(), tt.expectedChain)
+			}
+		})
+	}
+}
+
+func TestFS_ResolveAll_TooDeep(t *testing.T) {
+	fsys := initramfs.New()
+	require.NoError(t, fsys.Mkdir("dir"))
+
+	target := "/dir"
+
+	for idx := range 12 {
+		name := fmt.Sprintf("link%d", idx)
+		require.NoError(t, fsys.Symlink(target, name))
+		target = "/" + name
+	}
+
+	_, err := fsys.Open("link11")
+	require.ErrorIs(t, err, initramfs.ErrSymlinkTooDeep)
+	require.NotErrorIs(t, err, initramfs.ErrSymlinkCycle)
+
+	var symlinkErr *initramfs.SymlinkError
+	require.ErrorAs(t, err, &symlinkErr)
+	assert.Len(t, symlinkErr.Chain, 11)
+	assert.Equal(t, "/link10", symlinkErr.Chain[0])
+}
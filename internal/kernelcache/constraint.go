@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package kernelcache
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// versionOperators are the comparison operators of [VersionTerm]s. Longer
+// operators come first, so they match before their prefixes.
+var versionOperators = []string{">=", "<=", ">", "<", "="}
+
+// Constraint selects cached kernels by architecture and version, so the
+// newest matching one can be used without knowing its exact version.
+type Constraint struct {
+	// Arch is the architecture of the kernel.
+	Arch sys.Arch
+
+	// Versions are the terms the version of the kernel must satisfy.
+	Versions []VersionTerm
+}
+
+// VersionTerm compares the version of a kernel with a fixed version.
+type VersionTerm struct {
+	// Operator is one of ">=", "<=", ">", "<" and "=".
+	Operator string
+
+	// Version is the version to compare with, like "6.1".
+	Version string
+}
+
+// IsConstraint returns true if the given string is a [Constraint] instead of
+// a [Ref]. Constraints contain a comma or start with a comparison operator.
+func IsConstraint(s string) bool {
+	return strings.ContainsRune(s, ',') || strings.IndexAny(s, "<>=") == 0
+}
+
+// ParseConstraint parses a [Constraint] in the form of comma separated
+// terms, like ">=6.1, <6.10, arm64". Terms are either a version with a
+// comparison operator or an architecture. If no architecture is given, it is
+// [sys.Native].
+func ParseConstraint(s string) (Constraint, error) {
+	var constraint Constraint
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+
+		term, isVersion := parseVersionTerm(field)
+		if isVersion {
+			if _, valid := versionNumbers(term.Version); !valid {
+				return Constraint{}, fmt.Errorf("%w: %s: invalid version %q",
+					ErrInvalidConstraint, s, term.Version)
+			}
+
+			constraint.Versions = append(constraint.Versions, term)
+
+			continue
+		}
+
+		if constraint.Arch != "" {
+			return Constraint{}, fmt.Errorf("%w: %s: more than one arch",
+				ErrInvalidConstraint, s)
+		}
+
+		err := constraint.Arch.Set(field)
+		if err != nil {
+			return Constraint{}, fmt.Errorf("%w: %s: %w",
+				ErrInvalidConstraint, s, err)
+		}
+	}
+
+	if constraint.Arch == "" {
+		constraint.Arch = sys.Native
+	}
+
+	return constraint, nil
+}
+
+// parseVersionTerm parses the given string as [VersionTerm], if it starts
+// with a comparison operator.
+func parseVersionTerm(s string) (VersionTerm, bool) {
+	for _, operator := range versionOperators {
+		version, found := strings.CutPrefix(s, operator)
+		if found {
+			return VersionTerm{
+				Operator: operator,
+				Version:  strings.TrimSpace(version),
+			}, true
+		}
+	}
+
+	return VersionTerm{}, false
+}
+
+func (c Constraint) String() string {
+	terms := make([]string, 0, len(c.Versions)+1)
+
+	for _, term := range c.Versions {
+		terms = append(terms, term.Operator+term.Version)
+	}
+
+	return strings.Join(append(terms, string(c.Arch)), ",")
+}
+
+// Matches returns true if the given [Ref] satisfies the constraint. Versions
+// that do not start with a dot separated list of numbers never match.
+func (c Constraint) Matches(ref Ref) bool {
+	if ref.Arch != c.Arch {
+		return false
+	}
+
+	if _, valid := versionNumbers(ref.Version); !valid {
+		return false
+	}
+
+	for _, term := range c.Versions {
+		if !term.matches(ref.Version) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (t VersionTerm) matches(version string) bool {
+	result := compareVersions(version, t.Version)
+
+	switch t.Operator {
+	case ">=":
+		return result >= 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	case "<":
+		return result < 0
+	default:
+		return result == 0
+	}
+}
+
+// Select returns the [Ref] of the newest cached kernel that satisfies the
+// given [Constraint]. It returns [ErrNotCached] if there is none.
+func (c Cache) Select(constraint Constraint) (Ref, error) {
+	refs, err := c.List()
+	if err != nil {
+		return Ref{}, err
+	}
+
+	refs = slices.DeleteFunc(refs, func(ref Ref) bool {
+		return !constraint.Matches(ref)
+	})
+
+	if len(refs) == 0 {
+		return Ref{}, fmt.Errorf("%w: %s", ErrNotCached, constraint)
+	}
+
+	return slices.MaxFunc(refs, func(a, b Ref) int {
+		return compareVersions(a.Version, b.Version)
+	}), nil
+}
+
+// versionNumbers returns the numbers of the given kernel version, like
+// [6 1 12] for "6.1.12-rc1". A suffix after a dash is ignored. It returns
+// false, if the version does not start with a dot separated list of numbers.
+func versionNumbers(version string) ([]int, bool) {
+	release, _, _ := strings.Cut(version, "-")
+	parts := strings.Split(release, ".")
+	numbers := make([]int, len(parts))
+
+	for idx, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil, false
+		}
+
+		numbers[idx] = number
+	}
+
+	return numbers, true
+}
+
+// compareVersions compares the given kernel versions by their numbers.
+// Missing numbers count as 0, so "6.1" equals "6.1.0". With equal numbers, a
+// version with suffix, like a release candidate, is older than one without.
+// Invalid versions are older than valid ones.
+func compareVersions(a, b string) int {
+	numbersA, validA := versionNumbers(a)
+	numbersB, validB := versionNumbers(b)
+
+	if !validA || !validB {
+		return compareBool(validA, validB)
+	}
+
+	for idx := range max(len(numbersA), len(numbersB)) {
+		var numberA, numberB int
+
+		if idx < len(numbersA) {
+			numberA = numbersA[idx]
+		}
+
+		if idx < len(numbersB) {
+			numberB = numbersB[idx]
+		}
+
+		if result := cmp.Compare(numberA, numberB); result != 0 {
+			return result
+		}
+	}
+
+	return compareBool(!strings.Contains(a, "-"), !strings.Contains(b, "-"))
+}
+
+// compareBool compares the given booleans with false being less than true.
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package kernelcache
+
+import "errors"
+
+var (
+	// ErrInvalidRef is returned if a kernel reference is not in the form
+	// "VERSION-ARCH".
+	ErrInvalidRef = errors.New("invalid kernel reference")
+
+	// ErrInvalidConstraint is returned if a kernel constraint is not a comma
+	// separated list of version terms and an architecture.
+	ErrInvalidConstraint = errors.New("invalid kernel constraint")
+
+	// ErrNotCached is returned if a referenced kernel is not in the cache.
+	ErrNotCached = errors.New("kernel not cached")
+
+	// ErrDownload is returned if the server responds with a status other than
+	// 200 OK.
+	ErrDownload = errors.New("download failed")
+
+	// ErrNoChecksum is returned if a kernel is fetched without checksum.
+	ErrNoChecksum = errors.New("no checksum given")
+
+	// ErrInvalidChecksum is returned if a checksum is not a hex encoded
+	// SHA-256 sum.
+	ErrInvalidChecksum = errors.New("invalid checksum")
+
+	// ErrChecksumMismatch is returned if the downloaded kernel does not match
+	// the expected checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
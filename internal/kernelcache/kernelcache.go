@@ -0,0 +1,247 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package kernelcache downloads kernels and caches them per architecture and
+// version, so they can be referenced by name instead of by path.
+package kernelcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// RefPrefix is the prefix of kernel paths that are references to cached
+// kernels, like "cache:6.6-amd64".
+const RefPrefix = "cache:"
+
+// kernelFileName is the name of the kernel file in the directory of a
+// cached kernel.
+const kernelFileName = "vmlinuz"
+
+// Ref references a cached kernel by version and architecture.
+type Ref struct {
+	Version string
+	Arch    sys.Arch
+}
+
+// ParseRef parses a [Ref] in the form "VERSION-ARCH", like "6.6-amd64". The
+// version may contain dashes itself.
+func ParseRef(s string) (Ref, error) {
+	idx := strings.LastIndexByte(s, '-')
+	if idx < 0 {
+		return Ref{}, fmt.Errorf("%w: %s", ErrInvalidRef, s)
+	}
+
+	ref := Ref{Version: s[:idx]}
+
+	switch ref.Version {
+	case "", ".", "..":
+		return Ref{}, fmt.Errorf("%w: %s", ErrInvalidRef, s)
+	}
+
+	if strings.ContainsRune(ref.Version, '/') {
+		return Ref{}, fmt.Errorf("%w: %s", ErrInvalidRef, s)
+	}
+
+	err := ref.Arch.Set(s[idx+1:])
+	if err != nil {
+		return Ref{}, fmt.Errorf("%w: %s: %w", ErrInvalidRef, s, err)
+	}
+
+	return ref, nil
+}
+
+func (r Ref) String() string {
+	return r.Version + "-" + string(r.Arch)
+}
+
+// ExpandURL returns the given URL template with the placeholders "{version}"
+// and "{arch}" replaced by the values of the given [Ref].
+func ExpandURL(template string, ref Ref) string {
+	return strings.NewReplacer(
+		"{version}", ref.Version,
+		"{arch}", string(ref.Arch),
+	).Replace(template)
+}
+
+// DefaultDir returns the default cache directory. It is "virtrun/kernels" in
+// the user's cache directory, which is XDG_CACHE_HOME on Linux, if set.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	return filepath.Join(dir, "virtrun", "kernels"), nil
+}
+
+// Cache is a directory with kernels. Each kernel is stored as
+// "ARCH/VERSION/vmlinuz".
+type Cache struct {
+	Dir string
+}
+
+// Path returns the path of the kernel file for the given [Ref]. The file
+// might not exist.
+func (c Cache) Path(ref Ref) string {
+	return filepath.Join(c.Dir, string(ref.Arch), ref.Version, kernelFileName)
+}
+
+// Lookup returns the path of the kernel file for the given [Ref]. It returns
+// [ErrNotCached] if the kernel is not in the cache.
+func (c Cache) Lookup(ref Ref) (string, error) {
+	path := c.Path(ref)
+
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrNotCached, ref)
+	} else if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	return path, nil
+}
+
+// List returns the [Ref]s of all kernels in the cache, ordered by
+// architecture and version.
+func (c Cache) List() ([]Ref, error) {
+	var refs []Ref
+
+	archDirs, err := os.ReadDir(c.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	for _, archDir := range archDirs {
+		var arch sys.Arch
+		if !archDir.IsDir() || arch.Set(archDir.Name()) != nil {
+			continue
+		}
+
+		versionDirs, err := os.ReadDir(filepath.Join(c.Dir, archDir.Name()))
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		for _, versionDir := range versionDirs {
+			ref := Ref{Version: versionDir.Name(), Arch: arch}
+
+			if _, err := os.Stat(c.Path(ref)); err == nil {
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	return refs, nil
+}
+
+// Fetch downloads the kernel for the given [Ref] from the URL the given
+// template expands to (see [ExpandURL]) into the cache and returns its path.
+//
+// The kernel must match the given hex encoded SHA-256 checksum, which is
+// required. A checksum from the same server would only detect corrupted
+// downloads, not tampered ones. The kernel is written into the cache only if
+// it matches, replacing an existing one. Signatures are not checked.
+func (c Cache) Fetch(
+	ctx context.Context,
+	client *http.Client,
+	urlTemplate string,
+	ref Ref,
+	checksum string,
+) (string, error) {
+	url := ExpandURL(urlTemplate, ref)
+
+	if checksum == "" {
+		return "", ErrNoChecksum
+	}
+
+	expected, err := hex.DecodeString(checksum)
+	if err != nil || len(expected) != sha256.Size {
+		return "", fmt.Errorf("%w: %s", ErrInvalidChecksum, checksum)
+	}
+
+	path := c.Path(ref)
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	// The kernel is downloaded into a temporary file in the same directory,
+	// so it can be moved into place atomically once verified.
+	file, err := os.CreateTemp(filepath.Dir(path), "."+kernelFileName+"-*")
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+
+	err = download(ctx, client, url, io.MultiWriter(file, hash))
+	if err != nil {
+		return "", err
+	}
+
+	if actual := hash.Sum(nil); !bytes.Equal(actual, expected) {
+		return "", fmt.Errorf("%w: expected %x, got %x",
+			ErrChecksumMismatch, expected, actual)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	return path, nil
+}
+
+// download writes the body of the response for the given URL into w.
+func download(
+	ctx context.Context,
+	client *http.Client,
+	url string,
+	w io.Writer,
+) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s: %s", ErrDownload, url, resp.Status)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", url, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,303 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package kernelcache_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/kernelcache"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    kernelcache.Ref
+		expectedErr error
+	}{
+		{
+			input:    "6.6-amd64",
+			expected: kernelcache.Ref{Version: "6.6", Arch: sys.AMD64},
+		},
+		{
+			input:    "6.10-rc1-arm64",
+			expected: kernelcache.Ref{Version: "6.10-rc1", Arch: sys.ARM64},
+		},
+		{
+			input:       "6.6",
+			expectedErr: kernelcache.ErrInvalidRef,
+		},
+		{
+			input:       "-amd64",
+			expectedErr: kernelcache.ErrInvalidRef,
+		},
+		{
+			input:       "../6.6-amd64",
+			expectedErr: kernelcache.ErrInvalidRef,
+		},
+		{
+			input:       "6.6-mips",
+			expectedErr: sys.ErrArchNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ref, err := kernelcache.ParseRef(tt.input)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, ref)
+
+			if tt.expectedErr == nil {
+				assert.Equal(t, tt.input, ref.String())
+			}
+		})
+	}
+}
+
+func TestExpandURL(t *testing.T) {
+	ref := kernelcache.Ref{Version: "6.6", Arch: sys.ARM64}
+	actual := kernelcache.ExpandURL("https://host/{arch}/vmlinuz-{version}", ref)
+	assert.Equal(t, "https://host/arm64/vmlinuz-6.6", actual)
+}
+
+func TestCache_Fetch(t *testing.T) {
+	kernel := []byte("kernel image")
+	sum := sha256.Sum256(kernel)
+	checksum := hex.EncodeToString(sum[:])
+
+	files := map[string][]byte{
+		"/amd64/6.6/vmlinuz": kernel,
+	}
+
+	mux := http.NewServeMux()
+
+	for path, content := range files {
+		mux.HandleFunc(path, func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(content)
+		})
+	}
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	urlTemplate := server.URL + "/{arch}/{version}/vmlinuz"
+	ref := kernelcache.Ref{Version: "6.6", Arch: sys.AMD64}
+
+	tests := []struct {
+		name        string
+		ref         kernelcache.Ref
+		checksum    string
+		expectedErr error
+	}{
+		{
+			name:     "given checksum",
+			ref:      ref,
+			checksum: checksum,
+		},
+		{
+			name:        "no checksum",
+			ref:         ref,
+			expectedErr: kernelcache.ErrNoChecksum,
+		},
+		{
+			name:        "checksum mismatch",
+			ref:         ref,
+			checksum:    hex.EncodeToString(make([]byte, sha256.Size)),
+			expectedErr: kernelcache.ErrChecksumMismatch,
+		},
+		{
+			name:        "invalid checksum",
+			ref:         ref,
+			checksum:    "abc",
+			expectedErr: kernelcache.ErrInvalidChecksum,
+		},
+		{
+			name:        "not found",
+			ref:         kernelcache.Ref{Version: "6.1", Arch: sys.AMD64},
+			checksum:    checksum,
+			expectedErr: kernelcache.ErrDownload,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := kernelcache.Cache{Dir: t.TempDir()}
+
+			path, err := cache.Fetch(context.Background(), server.Client(),
+				urlTemplate, tt.ref, tt.checksum)
+			require.ErrorIs(t, err, tt.expectedErr)
+
+			refs, listErr := cache.List()
+			require.NoError(t, listErr)
+
+			if tt.expectedErr != nil {
+				assert.Empty(t, refs)
+
+				return
+			}
+
+			assert.Equal(t, cache.Path(tt.ref), path)
+			assert.Equal(t, []kernelcache.Ref{tt.ref}, refs)
+
+			content, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, kernel, content)
+
+			entries, err := os.ReadDir(filepath.Dir(path))
+			require.NoError(t, err)
+			assert.Len(t, entries, 1, "temporary file must be removed")
+		})
+	}
+}
+
+func TestCache_Lookup(t *testing.T) {
+	cache := kernelcache.Cache{Dir: t.TempDir()}
+	ref := kernelcache.Ref{Version: "6.6", Arch: sys.RISCV64}
+
+	_, err := cache.Lookup(ref)
+	require.ErrorIs(t, err, kernelcache.ErrNotCached)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(cache.Path(ref)), 0o755))
+	require.NoError(t, os.WriteFile(cache.Path(ref), nil, 0o600))
+
+	path, err := cache.Lookup(ref)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cache.Dir, "riscv64", "6.6", "vmlinuz"), path)
+}
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    kernelcache.Constraint
+		expectedErr error
+	}{
+		{
+			input: ">=6.1, arm64",
+			expected: kernelcache.Constraint{
+				Arch: sys.ARM64,
+				Versions: []kernelcache.VersionTerm{
+					{Operator: ">=", Version: "6.1"},
+				},
+			},
+		},
+		{
+			input: "riscv64,> 6.1,<=6.6.12",
+			expected: kernelcache.Constraint{
+				Arch: sys.RISCV64,
+				Versions: []kernelcache.VersionTerm{
+					{Operator: ">", Version: "6.1"},
+					{Operator: "<=", Version: "6.6.12"},
+				},
+			},
+		},
+		{
+			input: "=6.6",
+			expected: kernelcache.Constraint{
+				Arch: sys.Native,
+				Versions: []kernelcache.VersionTerm{
+					{Operator: "=", Version: "6.6"},
+				},
+			},
+		},
+		{
+			input:       ">=6.x,arm64",
+			expectedErr: kernelcache.ErrInvalidConstraint,
+		},
+		{
+			input:       "amd64,arm64",
+			expectedErr: kernelcache.ErrInvalidConstraint,
+		},
+		{
+			input:       ">=6.1,mips",
+			expectedErr: sys.ErrArchNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			constraint, err := kernelcache.ParseConstraint(tt.input)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, constraint)
+		})
+	}
+}
+
+func TestCache_Select(t *testing.T) {
+	cache := kernelcache.Cache{Dir: t.TempDir()}
+
+	versions := []string{"5.15", "6.1.90", "6.6", "6.10-rc1", "custom"}
+
+	for _, version := range versions {
+		ref := kernelcache.Ref{Version: version, Arch: sys.AMD64}
+		require.NoError(t, os.MkdirAll(filepath.Dir(cache.Path(ref)), 0o755))
+		require.NoError(t, os.WriteFile(cache.Path(ref), nil, 0o600))
+	}
+
+	tests := []struct {
+		input       string
+		expected    string
+		expectedErr error
+	}{
+		{
+			input:    ">=6.1,amd64",
+			expected: "6.10-rc1",
+		},
+		{
+			input:    ">=6.1,<6.7,amd64",
+			expected: "6.6",
+		},
+		{
+			// Release candidates are older than the release.
+			input:    "<6.10,amd64",
+			expected: "6.10-rc1",
+		},
+		{
+			input:    "<=6.1.90,amd64",
+			expected: "6.1.90",
+		},
+		{
+			input:    ">5,<6.1,amd64",
+			expected: "5.15",
+		},
+		{
+			input:    "=6.6.0,amd64",
+			expected: "6.6",
+		},
+		{
+			input:       ">=6.11,amd64",
+			expectedErr: kernelcache.ErrNotCached,
+		},
+		{
+			input:       ">=6.1,arm64",
+			expectedErr: kernelcache.ErrNotCached,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			constraint, err := kernelcache.ParseConstraint(tt.input)
+			require.NoError(t, err)
+
+			ref, err := cache.Select(constraint)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, ref.Version)
+		})
+	}
+}
+
+func TestIsConstraint(t *testing.T) {
+	assert.True(t, kernelcache.IsConstraint(">=6.1"))
+	assert.True(t, kernelcache.IsConstraint("arm64,<6.6"))
+	assert.False(t, kernelcache.IsConstraint("6.6-arm64"))
+}
@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package ociimage
+
+import "errors"
+
+var (
+	// ErrInvalidImage is returned if an image has neither an OCI image index
+	// nor a Docker manifest, or if they are malformed.
+	ErrInvalidImage = errors.New("invalid image")
+
+	// ErrNoManifest is returned if a multi-platform image has no image for
+	// the requested architecture.
+	ErrNoManifest = errors.New("no image for architecture")
+
+	// ErrUnsupportedCompression is returned if a layer is compressed with
+	// an algorithm other than gzip.
+	ErrUnsupportedCompression = errors.New("unsupported layer compression")
+
+	// ErrTooManyLinks is returned if resolving a path in the root file
+	// system requires following too many symbolic links.
+	ErrTooManyLinks = errors.New("too many levels of symbolic links")
+)
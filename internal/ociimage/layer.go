@@ -0,0 +1,248 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package ociimage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// whiteoutPrefix marks files that remove the file with the name without
+	// the prefix from lower layers.
+	whiteoutPrefix = ".wh."
+
+	// whiteoutOpaque marks directories whose content from lower layers is
+	// removed.
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+	// maxLinks is the maximum number of symbolic links followed when
+	// resolving a path.
+	maxLinks = 255
+
+	// Directories and files are always writable by the owner, so later
+	// layers can change them and they can be removed.
+	dirMode  = 0o755
+	fileMode = 0o644
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// applyLayerFile applies the layer tar archive at the given path, which may
+// be gzip compressed, to the root file system in dir.
+func applyLayerFile(path, dir string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	magic, err := reader.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err //nolint:wrapcheck
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		defer gzipReader.Close()
+
+		return applyLayer(gzipReader, dir)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return fmt.Errorf("%w: zstd", ErrUnsupportedCompression)
+	default:
+		return applyLayer(reader, dir)
+	}
+}
+
+// applyLayer applies the layer tar archive read from r to the root file system
+// in dir. Whiteout files remove files of lower layers. All paths are resolved
+// within dir, so symbolic links in the image can not point outside.
+func applyLayer(r io.Reader, dir string) error {
+	reader := tar.NewReader(r)
+
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read layer: %w", err)
+		}
+
+		name := path.Clean("/" + header.Name)
+		if name == "/" {
+			continue
+		}
+
+		parent, err := resolve(dir, path.Dir(name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		base := path.Base(name)
+
+		switch {
+		case base == whiteoutOpaque:
+			err = removeContent(parent)
+		case strings.HasPrefix(base, whiteoutPrefix):
+			err = os.RemoveAll(
+				filepath.Join(parent, strings.TrimPrefix(base, whiteoutPrefix)))
+		default:
+			err = applyEntry(reader, header, dir, filepath.Join(parent, base))
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+}
+
+// applyEntry creates the file described by the given header at target. Device
+// files and FIFOs are skipped.
+func applyEntry(r io.Reader, header *tar.Header, dir, target string) error {
+	err := os.MkdirAll(filepath.Dir(target), dirMode)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	// Existing files are replaced, existing directories are merged.
+	info, err := os.Lstat(target)
+	if err == nil && !(info.IsDir() && header.Typeflag == tar.TypeDir) {
+		err := os.RemoveAll(target)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, dirMode) //nolint:wrapcheck
+	case tar.TypeReg:
+		return writeFile(target, r, fileMode|fs.FileMode(header.Mode)&0o777)
+	case tar.TypeSymlink:
+		return os.Symlink(header.Linkname, target) //nolint:wrapcheck
+	case tar.TypeLink:
+		linkName := path.Clean("/" + header.Linkname)
+
+		parent, err := resolve(dir, path.Dir(linkName))
+		if err != nil {
+			return err
+		}
+
+		source := filepath.Join(parent, path.Base(linkName))
+
+		return os.Link(source, target) //nolint:wrapcheck
+	default:
+		slog.Debug("Skip unsupported file in image layer",
+			slog.String("name", header.Name),
+			slog.String("type", string(header.Typeflag)))
+
+		return nil
+	}
+}
+
+// resolve returns the path of the given absolute image path in the root file
+// system in dir. Symbolic links are followed as if dir was the root
+// directory, so the returned path is always within dir.
+func resolve(dir, name string) (string, error) {
+	var (
+		resolved = "/"
+		parts    = strings.Split(name, "/")
+		links    = 0
+	)
+
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+
+		info, err := os.Lstat(filepath.Join(dir, next))
+		if err != nil || info.Mode().Type() != fs.ModeSymlink {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxLinks {
+			return "", ErrTooManyLinks
+		}
+
+		target, err := os.Readlink(filepath.Join(dir, next))
+		if err != nil {
+			return "", err //nolint:wrapcheck
+		}
+
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+
+	return filepath.Join(dir, resolved), nil
+}
+
+// removeContent removes everything in the given directory.
+func removeContent(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	for _, entry := range entries {
+		err := os.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return nil
+}
+
+// writeFile writes the content read from r into a new file at the given path.
+func writeFile(path string, r io.Reader, mode fs.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, r)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return file.Close() //nolint:wrapcheck
+}
@@ -0,0 +1,293 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package ociimage unpacks the root file system of OCI and Docker images, so
+// they can be used as userland of a guest.
+package ociimage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// skopeoExecutable is the tool images are fetched from registries with.
+const skopeoExecutable = "skopeo"
+
+type descriptor struct {
+	Digest   string    `json:"digest"`
+	Platform *platform `json:"platform,omitempty"`
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// manifest is either an image manifest with layers or an image index with
+// manifests for multiple platforms.
+type manifest struct {
+	Manifests []descriptor `json:"manifests"`
+	Layers    []descriptor `json:"layers"`
+}
+
+type dockerManifest struct {
+	Layers []string `json:"Layers"`
+}
+
+// Unpack unpacks the root file system of the image with the given reference
+// into the directory dst, which must exist.
+//
+// The reference is either the path of an OCI image layout directory, like
+// written by "skopeo copy" with transport "oci", the path of an image
+// tarball, like written by "docker save" or "podman save", or the name of an
+// image in a registry, like "docker.io/library/alpine:3", which is fetched
+// with skopeo. For multi-platform images, the image for the given
+// architecture is used.
+//
+// File ownership and special files, like device files, are not preserved.
+func Unpack(ctx context.Context, ref string, arch sys.Arch, dst string) error {
+	info, err := os.Stat(ref)
+
+	switch {
+	case err == nil && info.IsDir():
+		return unpackLayout(ref, arch, dst)
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return err //nolint:wrapcheck
+	}
+
+	isTarball := err == nil
+
+	// The image is stored next to the destination, so it ends up in the
+	// same file system and is cleaned up along with it.
+	dir, err := os.MkdirTemp(filepath.Dir(dst), "virtrun-image-")
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer os.RemoveAll(dir)
+
+	if isTarball {
+		err = extractTarball(ref, dir)
+	} else {
+		err = fetch(ctx, ref, arch, dir)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return unpackLayout(dir, arch, dst)
+}
+
+// fetch copies the image with the given name from its registry into the
+// directory as OCI image layout.
+func fetch(ctx context.Context, name string, arch sys.Arch, dir string) error {
+	out, err := exec.CommandContext(ctx, skopeoExecutable, "copy",
+		"--override-os=linux",
+		"--override-arch="+string(arch),
+		"docker://"+name,
+		"oci:"+dir,
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", skopeoExecutable, err,
+			bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// extractTarball extracts the regular files and directories of the image
+// tarball at the given path into the directory.
+func extractTarball(path, dir string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	reader := tar.NewReader(file)
+
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read tarball: %w", err)
+		}
+
+		name := filepath.Join(dir, filepath.Clean("/"+header.Name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(name, dirMode)
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(name), dirMode)
+			if err == nil {
+				err = writeFile(name, reader, fileMode)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unpackLayout applies the layers of the image in the given directory to dst.
+// The directory has either an OCI image layout or a Docker manifest.
+func unpackLayout(dir string, arch sys.Arch, dst string) error {
+	layers, err := readLayers(dir, arch)
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range layers {
+		err := applyLayerFile(layer, dst)
+		if err != nil {
+			return fmt.Errorf("layer %s: %w", filepath.Base(layer), err)
+		}
+	}
+
+	return nil
+}
+
+// readLayers returns the paths of the layer files of the image in the given
+// directory in the order they must be applied.
+func readLayers(dir string, arch sys.Arch) ([]string, error) {
+	var idx manifest
+
+	err := readJSON(filepath.Join(dir, "index.json"), &idx)
+	if errors.Is(err, os.ErrNotExist) {
+		return readDockerLayers(dir)
+	} else if err != nil {
+		return nil, err
+	}
+
+	desc, err := selectManifest(idx.Manifests, arch)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		path, err := blobPath(dir, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		var m manifest
+
+		err = readJSON(path, &m)
+		if err != nil {
+			return nil, err
+		}
+
+		// Indexes reference further manifests, image manifests have layers.
+		if len(m.Manifests) == 0 {
+			return layerPaths(dir, m.Layers)
+		}
+
+		desc, err = selectManifest(m.Manifests, arch)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readDockerLayers returns the paths of the layer files of the image in the
+// given directory that has the format written by "docker save".
+func readDockerLayers(dir string) ([]string, error) {
+	var manifests []dockerManifest
+
+	err := readJSON(filepath.Join(dir, "manifest.json"), &manifests)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: no index.json or manifest.json",
+			ErrInvalidImage)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(manifests) != 1 {
+		return nil, fmt.Errorf("%w: %d images in manifest.json",
+			ErrInvalidImage, len(manifests))
+	}
+
+	layers := make([]string, 0, len(manifests[0].Layers))
+	for _, layer := range manifests[0].Layers {
+		layers = append(layers, filepath.Join(dir, filepath.Clean("/"+layer)))
+	}
+
+	return layers, nil
+}
+
+// selectManifest returns the descriptor of the manifest for the given
+// architecture. A single manifest without platform is used for any
+// architecture.
+func selectManifest(manifests []descriptor, arch sys.Arch) (descriptor, error) {
+	if len(manifests) == 1 && manifests[0].Platform == nil {
+		return manifests[0], nil
+	}
+
+	for _, desc := range manifests {
+		if desc.Platform != nil && desc.Platform.OS == "linux" &&
+			desc.Platform.Architecture == string(arch) {
+			return desc, nil
+		}
+	}
+
+	return descriptor{}, fmt.Errorf("%w: %s", ErrNoManifest, arch)
+}
+
+// layerPaths returns the paths of the blob files of the given layers.
+func layerPaths(dir string, layers []descriptor) ([]string, error) {
+	paths := make([]string, 0, len(layers))
+
+	for _, layer := range layers {
+		path, err := blobPath(dir, layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// blobPath returns the path of the blob with the given digest in the OCI image
+// layout directory.
+func blobPath(dir, digest string) (string, error) {
+	algorithm, hash, found := strings.Cut(digest, ":")
+	if !found || algorithm == "" || hash == "" ||
+		strings.ContainsAny(digest, "/\\") || strings.Contains(digest, "..") {
+		return "", fmt.Errorf("%w: digest %q", ErrInvalidImage, digest)
+	}
+
+	return filepath.Join(dir, "blobs", algorithm, hash), nil
+}
+
+// readJSON decodes the JSON file at the given path into v.
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidImage, filepath.Base(path),
+			err)
+	}
+
+	return nil
+}
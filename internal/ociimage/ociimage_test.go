@@ -0,0 +1,275 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package ociimage_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/ociimage"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// layer returns a tar archive with the given headers. Regular files have
+// their name as content.
+func layer(t *testing.T, headers ...*tar.Header) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	writer := tar.NewWriter(&buf)
+
+	for _, header := range headers {
+		var content []byte
+		if header.Typeflag == tar.TypeReg {
+			content = []byte(header.Name)
+			header.Size = int64(len(content))
+		}
+
+		require.NoError(t, writer.WriteHeader(header))
+		_, err := writer.Write(content)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, writer.Close())
+
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	return buf.Bytes()
+}
+
+func dir(name string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0o755}
+}
+
+func file(name string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644}
+}
+
+func symlink(name, target string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target}
+}
+
+// writeBlob writes the given data as blob into the OCI image layout directory
+// and returns its digest.
+func writeBlob(t *testing.T, layoutDir string, data []byte) string {
+	t.Helper()
+
+	hash := sha256.Sum256(data)
+	digest := hex.EncodeToString(hash[:])
+
+	blobDir := filepath.Join(layoutDir, "blobs", "sha256")
+	require.NoError(t, os.MkdirAll(blobDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(blobDir, digest), data,
+		0o644))
+
+	return "sha256:" + digest
+}
+
+func writeJSON(t *testing.T, path string, v any) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	if path != "" {
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+	}
+
+	return data
+}
+
+// ociLayout writes an OCI image layout with a multi-platform index that has
+// an image with the given layers for arch and an empty one for another
+// architecture.
+func ociLayout(t *testing.T, arch sys.Arch, layers ...[]byte) string {
+	t.Helper()
+
+	layoutDir := t.TempDir()
+
+	manifestFor := func(layers ...[]byte) string {
+		descs := []map[string]any{}
+		for _, layer := range layers {
+			descs = append(descs, map[string]any{
+				"digest": writeBlob(t, layoutDir, layer),
+			})
+		}
+
+		data := writeJSON(t, "", map[string]any{"layers": descs})
+
+		return writeBlob(t, layoutDir, data)
+	}
+
+	platformIndex := writeJSON(t, "", map[string]any{
+		"manifests": []map[string]any{
+			{
+				"digest": manifestFor(),
+				"platform": map[string]any{
+					"architecture": "s390x", "os": "linux",
+				},
+			},
+			{
+				"digest": manifestFor(layers...),
+				"platform": map[string]any{
+					"architecture": string(arch), "os": "linux",
+				},
+			},
+		},
+	})
+
+	writeJSON(t, filepath.Join(layoutDir, "index.json"), map[string]any{
+		"manifests": []map[string]any{
+			{"digest": writeBlob(t, layoutDir, platformIndex)},
+		},
+	})
+
+	return layoutDir
+}
+
+func TestUnpack_Layout(t *testing.T) {
+	layoutDir := ociLayout(t, sys.AMD64,
+		gzipped(t, layer(t,
+			dir("etc/"),
+			file("etc/hosts"),
+			file("etc/passwd"),
+			dir("usr/lib/"),
+			file("usr/lib/libc.so"),
+			symlink("lib", "usr/lib"),
+			dir("var/cache/"),
+			file("var/cache/old"),
+			&tar.Header{
+				Name:     "etc/hosts.link",
+				Typeflag: tar.TypeLink,
+				Linkname: "etc/hosts",
+			},
+			&tar.Header{Name: "dev/null", Typeflag: tar.TypeChar},
+		)),
+		layer(t,
+			file("etc/.wh.passwd"),
+			file("var/cache/.wh..wh..opq"),
+			file("var/cache/new"),
+			file("lib/libm.so"),
+		),
+	)
+
+	dst := t.TempDir()
+
+	err := ociimage.Unpack(context.Background(), layoutDir, sys.AMD64, dst)
+	require.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(dst, "etc/hosts"))
+	assert.FileExists(t, filepath.Join(dst, "etc/hosts.link"))
+	assert.NoFileExists(t, filepath.Join(dst, "etc/passwd"))
+	assert.NoFileExists(t, filepath.Join(dst, "var/cache/old"))
+	assert.FileExists(t, filepath.Join(dst, "var/cache/new"))
+	assert.FileExists(t, filepath.Join(dst, "usr/lib/libm.so"))
+	assert.NoFileExists(t, filepath.Join(dst, "dev/null"))
+
+	target, err := os.Readlink(filepath.Join(dst, "lib"))
+	require.NoError(t, err)
+	assert.Equal(t, "usr/lib", target)
+}
+
+func TestUnpack_SymlinkWithinRoot(t *testing.T) {
+	outside := t.TempDir()
+
+	layoutDir := ociLayout(t, sys.ARM64,
+		layer(t,
+			symlink("abs", outside),
+			symlink("rel", "../../../../../../.."+outside),
+		),
+		layer(t,
+			file("abs/file"),
+			file("rel/file"),
+		),
+	)
+
+	dst := t.TempDir()
+
+	err := ociimage.Unpack(context.Background(), layoutDir, sys.ARM64, dst)
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(outside, "file"))
+	assert.FileExists(t, filepath.Join(dst, outside, "file"))
+}
+
+func TestUnpack_NoManifestForArch(t *testing.T) {
+	layoutDir := ociLayout(t, sys.AMD64)
+
+	err := ociimage.Unpack(context.Background(), layoutDir, sys.RISCV64,
+		t.TempDir())
+	require.ErrorIs(t, err, ociimage.ErrNoManifest)
+}
+
+func TestUnpack_Zstd(t *testing.T) {
+	layoutDir := ociLayout(t, sys.AMD64, []byte{0x28, 0xb5, 0x2f, 0xfd, 0})
+
+	err := ociimage.Unpack(context.Background(), layoutDir, sys.AMD64,
+		t.TempDir())
+	require.ErrorIs(t, err, ociimage.ErrUnsupportedCompression)
+}
+
+func TestUnpack_DockerTarball(t *testing.T) {
+	manifest := writeJSON(t, "", []map[string]any{
+		{"Layers": []string{"abc/layer.tar"}},
+	})
+
+	var buf bytes.Buffer
+
+	writer := tar.NewWriter(&buf)
+
+	for name, data := range map[string][]byte{
+		"manifest.json": manifest,
+		"abc/layer.tar": layer(t, dir("bin/"), file("bin/sh")),
+	} {
+		require.NoError(t, writer.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(data)),
+		}))
+		_, err := writer.Write(data)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, writer.Close())
+
+	path := filepath.Join(t.TempDir(), "image.tar")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+
+	dst := t.TempDir()
+
+	err := ociimage.Unpack(context.Background(), path, sys.AMD64, dst)
+	require.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(dst, "bin/sh"))
+}
+
+func TestUnpack_InvalidImage(t *testing.T) {
+	err := ociimage.Unpack(context.Background(), t.TempDir(), sys.AMD64,
+		t.TempDir())
+	require.ErrorIs(t, err, ociimage.ErrInvalidImage)
+}
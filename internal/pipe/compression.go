@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression defines how the payload of [FrameTypeData] frames is
+// compressed.
+type Compression uint8
+
+// Supported compressions.
+const (
+	// CompressionNone sends data uncompressed. It is the default.
+	CompressionNone Compression = iota
+
+	// CompressionGzip compresses the payload of each data frame with gzip.
+	CompressionGzip
+)
+
+// compressionOverhead is the number of bytes reserved for the gzip header,
+// trailer and block headers, so the payload of incompressible data still fits
+// into a single frame.
+const compressionOverhead = 1024
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+func (c Compression) isKnown() bool {
+	return c == CompressionNone || c == CompressionGzip
+}
+
+// chunkSize returns the maximum size of uncompressed data that is sent in a
+// single data frame.
+func (c Compression) chunkSize() int {
+	if c == CompressionNone {
+		return MaxPayloadSize
+	}
+
+	return MaxPayloadSize - compressionOverhead
+}
+
+func parseHeader(payload []byte) (Compression, error) {
+	if len(payload) != 1 {
+		return 0, fmt.Errorf("%w: header size %d", ErrUnexpectedFrame,
+			len(payload))
+	}
+
+	compression := Compression(payload[0])
+	if !compression.isKnown() {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownCompression, compression)
+	}
+
+	return compression, nil
+}
+
+// compressor compresses data frame payloads. It reuses its buffers for all
+// frames.
+type compressor struct {
+	buf bytes.Buffer
+	gz  *gzip.Writer
+}
+
+func (c *compressor) compress(data []byte) ([]byte, error) {
+	c.buf.Reset()
+
+	if c.gz == nil {
+		c.gz = gzip.NewWriter(&c.buf)
+	} else {
+		c.gz.Reset(&c.buf)
+	}
+
+	if _, err := c.gz.Write(data); err != nil {
+		return nil, fmt.Errorf("compress: %w", err)
+	}
+
+	if err := c.gz.Close(); err != nil {
+		return nil, fmt.Errorf("compress: %w", err)
+	}
+
+	return c.buf.Bytes(), nil
+}
+
+// decompressor decompresses data frame payloads and writes them to the
+// destination.
+type decompressor struct {
+	src bytes.Reader
+	gz  *gzip.Reader
+}
+
+func (d *decompressor) decompress(dst io.Writer, data []byte) error {
+	d.src.Reset(data)
+
+	var err error
+
+	if d.gz == nil {
+		d.gz, err = gzip.NewReader(&d.src)
+	} else {
+		err = d.gz.Reset(&d.src)
+	}
+
+	if err != nil {
+		return fmt.Errorf("decompress: %w", err)
+	}
+
+	_, err = io.Copy(dst, d.gz)
+	if err != nil {
+		return fmt.Errorf("decompress: %w", err)
+	}
+
+	return nil
+}
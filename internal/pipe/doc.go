@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package pipe implements a framed binary protocol for transferring data
+// between guest and host over a virtual console. It is used by the guest init
+// for sending named streams, like collected files, and by the host for
+// decoding them.
+//
+// Each [Frame] is encoded as a type byte, a big endian uint16 channel, a big
+// endian uint32 payload length, the payload and a big endian CRC-32 (IEEE)
+// checksum of all preceding bytes of the frame. Compared to encoding the data
+// as text, the overhead is constant per frame, so binary data like coverage
+// and profile files is transferred with little overhead. The payload of data
+// frames can be compressed additionally, as announced by a header frame. The
+// compression can be chosen per stream, so text stays readable in the raw
+// console output, while binary data is compressed. See
+// [Writer.SetCompression] and [Writer.OpenStreamWithCompression].
+//
+// Each stream uses its own channel, so any number of streams can be
+// multiplexed over a single console. See [Writer.OpenStream].
+//
+// The console device in the guest must be in raw mode, so the terminal line
+// discipline does not alter the data.
+package pipe
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrFrameTooLarge is returned if the payload of a frame exceeds
+	// [MaxPayloadSize].
+	ErrFrameTooLarge = errors.New("frame too large")
+
+	// ErrChecksumMismatch is returned if the checksum of a frame does not
+	// match its content.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrDigestMismatch is returned if the digest of a stream does not match
+	// the received data.
+	ErrDigestMismatch = errors.New("digest mismatch")
+
+	// ErrUnknownFrameType is returned if a frame of unknown type is read.
+	ErrUnknownFrameType = errors.New("unknown frame type")
+
+	// ErrUnknownCompression is returned if a [Compression] is not supported.
+	ErrUnknownCompression = errors.New("unknown compression")
+
+	// ErrTooManyStreams is returned if all channels are in use by open
+	// streams.
+	ErrTooManyStreams = errors.New("too many streams")
+
+	// ErrRemote is returned if the remote end responded to a request with an
+	// error.
+	ErrRemote = errors.New("remote error")
+
+	// ErrConnClosed is returned if a request can not be answered because the
+	// connection is closed.
+	ErrConnClosed = errors.New("connection closed")
+
+	// ErrFlowControlTimeout is returned if the receiver of a stream does not
+	// grant more data in time.
+	ErrFlowControlTimeout = errors.New("flow control timeout")
+
+	// ErrNoHeartbeat is returned if the remote end did not send a heartbeat
+	// in time.
+	ErrNoHeartbeat = errors.New("no heartbeat")
+
+	// ErrUnexpectedFrame is returned if a frame is read that is not valid in
+	// the current state of the stream, like data without an open stream.
+	ErrUnexpectedFrame = errors.New("unexpected frame")
+)
+
+// CorruptionError is returned if corrupted data is received.
+type CorruptionError struct {
+	// Stream is the name of the affected stream, if any is open.
+	Stream string
+
+	// Offset is the byte offset of the corrupted frame in the input.
+	Offset int64
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *CorruptionError) Error() string {
+	if e.Stream != "" {
+		return fmt.Sprintf("corrupt stream %s at offset %d: %v",
+			e.Stream, e.Offset, e.Err)
+	}
+
+	return fmt.Sprintf("corrupt data at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
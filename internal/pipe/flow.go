@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultWindowSize is the default amount of data that may be in flight per
+// stream if flow control is enabled. See [Conn.EnableFlowControl].
+const DefaultWindowSize = 4 * MaxPayloadSize
+
+// flowControlTimeout is the maximum time a stream waits for the receiver to
+// grant more data, so a sender does not hang forever if the receiver is gone.
+const flowControlTimeout = time.Minute
+
+// flowControl tracks the amount of data the receiver granted per channel.
+type flowControl struct {
+	mu      sync.Mutex
+	credits map[uint16]int
+	changed chan struct{}
+	closed  bool
+}
+
+func newFlowControl() *flowControl {
+	return &flowControl{
+		credits: make(map[uint16]int),
+		changed: make(chan struct{}),
+	}
+}
+
+// grant adds the given amount of data the channel may send.
+func (f *flowControl) grant(channel uint16, size int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.credits[channel] += size
+	f.notify()
+}
+
+// close wakes up all waiting streams, as no more data is granted.
+func (f *flowControl) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	f.notify()
+}
+
+// notify wakes up all waiting streams. The lock must be held.
+func (f *flowControl) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// acquire waits until the channel may send the given amount of data.
+func (f *flowControl) acquire(channel uint16, size int) error {
+	timer := time.NewTimer(flowControlTimeout)
+	defer timer.Stop()
+
+	for {
+		f.mu.Lock()
+
+		if f.closed {
+			f.mu.Unlock()
+			return ErrConnClosed
+		}
+
+		if f.credits[channel] >= size {
+			f.credits[channel] -= size
+			f.mu.Unlock()
+
+			return nil
+		}
+
+		changed := f.changed
+		f.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return fmt.Errorf("%w: channel %d", ErrFlowControlTimeout, channel)
+		}
+	}
+}
+
+// release forgets the channel once its stream is closed.
+func (f *flowControl) release(channel uint16) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.credits, channel)
+}
+
+func windowFrame(channel uint16, size int) Frame {
+	return Frame{
+		Type:    FrameTypeWindow,
+		Channel: channel,
+		Payload: binary.BigEndian.AppendUint32(nil, uint32(size)), //nolint:gosec
+	}
+}
+
+func parseWindow(payload []byte) (int, error) {
+	if len(payload) != 4 { //nolint:mnd
+		return 0, fmt.Errorf("%w: window size %d", ErrUnexpectedFrame,
+			len(payload))
+	}
+
+	return int(binary.BigEndian.Uint32(payload)), nil
+}
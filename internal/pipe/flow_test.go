@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowBuffer is a destination that is slower than the sender.
+type slowBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *slowBuffer) Write(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (*slowBuffer) Close() error {
+	return nil
+}
+
+func (b *slowBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Len()
+}
+
+func TestConn_EnableFlowControl(t *testing.T) {
+	senderRead, receiverWrite := io.Pipe()
+	receiverRead, senderWrite := io.Pipe()
+
+	sender := pipe.NewConn(senderWrite)
+	sender.EnableFlowControl(pipe.DefaultWindowSize)
+
+	dst := &slowBuffer{}
+
+	receiver := pipe.NewConn(receiverWrite)
+	receiver.EnableFlowControl(pipe.DefaultWindowSize)
+	receiver.Open = func(string) (io.WriteCloser, error) {
+		return dst, nil
+	}
+
+	received := make(chan error)
+
+	go func() { received <- receiver.Serve(receiverRead) }()
+	go func() { _ = sender.Serve(senderRead) }()
+
+	const (
+		size      = 4 * pipe.DefaultWindowSize
+		chunkSize = 4096
+	)
+
+	stream, err := sender.Writer().OpenStream("large")
+	require.NoError(t, err)
+
+	chunk := bytes.Repeat([]byte("x"), chunkSize)
+
+	for sent := chunkSize; sent <= size; sent += chunkSize {
+		_, err := stream.Write(chunk)
+		require.NoError(t, err)
+
+		inFlight := sent - dst.Len()
+		require.LessOrEqual(t, inFlight, pipe.DefaultWindowSize)
+	}
+
+	require.NoError(t, stream.Close())
+	require.NoError(t, senderWrite.Close())
+	require.NoError(t, <-received)
+	require.NoError(t, receiverWrite.Close())
+
+	assert.Equal(t, size, dst.Len())
+}
+
+func TestConn_EnableFlowControl_Closed(t *testing.T) {
+	conn := pipe.NewConn(io.Discard)
+	conn.EnableFlowControl(pipe.DefaultWindowSize)
+
+	stream, err := conn.Writer().OpenStream("stream")
+	require.NoError(t, err)
+
+	// No data is granted, as there is no receiver. Once the input ends,
+	// waiting streams fail.
+	go func() { _ = conn.Serve(strings.NewReader("")) }()
+
+	_, err = stream.Write([]byte("data"))
+	assert.ErrorIs(t, err, pipe.ErrConnClosed)
+}
@@ -0,0 +1,242 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// MaxPayloadSize is the maximum size of the payload of a single [Frame].
+const MaxPayloadSize = 64 * 1024
+
+const (
+	headerSize   = 7
+	checksumSize = 4
+)
+
+// FrameType defines the meaning of a [Frame].
+type FrameType uint8
+
+// Known frame types.
+const (
+	// FrameTypeOpen starts a stream on the channel of the frame. The payload
+	// is the name of the stream.
+	FrameTypeOpen FrameType = iota + 1
+
+	// FrameTypeData carries data of the stream open on the channel.
+	FrameTypeData
+
+	// FrameTypeClose ends the stream open on the channel. The payload is the
+	// SHA-256 digest of the uncompressed data of the stream.
+	FrameTypeClose
+
+	// FrameTypeHeader announces the [Compression] of all streams opened
+	// afterwards. The payload is a single byte. The channel is ignored.
+	FrameTypeHeader
+
+	// FrameTypeRequest carries a request of the remote end. The payload is a
+	// JSON encoded request. The channel is ignored. See [Conn.Call].
+	FrameTypeRequest
+
+	// FrameTypeResponse carries the response to a request. The payload is a
+	// JSON encoded response. The channel is ignored.
+	FrameTypeResponse
+
+	// FrameTypeWindow grants the sender of the stream on the channel to send
+	// more data. The payload is the amount of data in bytes as big endian
+	// uint32. See [Conn.EnableFlowControl].
+	FrameTypeWindow
+
+	// FrameTypeHeartbeat signals that the remote end is alive. It has no
+	// payload. The channel is ignored. See [Conn.SendHeartbeats].
+	FrameTypeHeartbeat
+)
+
+func (t FrameType) isKnown() bool {
+	return t >= FrameTypeOpen && t <= FrameTypeHeartbeat
+}
+
+// Frame is a single unit of the protocol.
+type Frame struct {
+	Type FrameType
+
+	// Channel identifies the stream the frame belongs to. Frames of
+	// different streams can be interleaved.
+	Channel uint16
+
+	Payload []byte
+}
+
+// Writer writes [Frame]s to an underlying [io.Writer].
+//
+// It is safe for concurrent use, so multiple streams can be written at the
+// same time.
+type Writer struct {
+	w           io.Writer
+	mu          sync.Mutex
+	buf         []byte
+	compression Compression
+	announced   Compression
+	compressor  compressor
+	channels    map[uint16]bool
+	nextChannel uint16
+	flow        *flowControl
+}
+
+// NewWriter creates a new [Writer] that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:        w,
+		channels: make(map[uint16]bool),
+	}
+}
+
+// SetCompression sets the [Compression] used for all streams opened
+// afterwards. It is announced to the receiver by a [FrameTypeHeader] frame.
+func (w *Writer) SetCompression(compression Compression) error {
+	if !compression.isKnown() {
+		return fmt.Errorf("%w: %s", ErrUnknownCompression, compression)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.announce(compression)
+	if err != nil {
+		return err
+	}
+
+	w.compression = compression
+
+	return nil
+}
+
+// announce sends a [FrameTypeHeader] frame for the given [Compression].
+func (w *Writer) announce(compression Compression) error {
+	err := w.writeFrame(Frame{
+		Type:    FrameTypeHeader,
+		Payload: []byte{byte(compression)},
+	})
+	if err != nil {
+		return err
+	}
+
+	w.announced = compression
+
+	return nil
+}
+
+// WriteFrame writes the given frame in a single write.
+func (w *Writer) WriteFrame(frame Frame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writeFrame(frame)
+}
+
+func (w *Writer) writeFrame(frame Frame) error {
+	if len(frame.Payload) > MaxPayloadSize {
+		return fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, len(frame.Payload))
+	}
+
+	buf := w.buf[:0]
+	buf = append(buf, byte(frame.Type))
+	buf = binary.BigEndian.AppendUint16(buf, frame.Channel)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(frame.Payload)))
+	buf = append(buf, frame.Payload...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	w.buf = buf
+
+	_, err := w.w.Write(buf)
+	if err != nil {
+		return fmt.Errorf("write frame: %w", err)
+	}
+
+	return nil
+}
+
+// Reader reads [Frame]s from an underlying [io.Reader].
+type Reader struct {
+	r      io.Reader
+	offset int64
+}
+
+// NewReader creates a new [Reader] that reads from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Offset returns the byte offset of the next frame in the input.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+// ReadFrame reads the next frame.
+//
+// It returns [io.EOF] if the underlying reader is at its end before a frame
+// begins. If it ends within a frame, [io.ErrUnexpectedEOF] is returned.
+// Invalid frames are reported as [CorruptionError].
+func (r *Reader) ReadFrame() (Frame, error) {
+	offset := r.offset
+	corrupt := func(err error) error {
+		return &CorruptionError{Offset: offset, Err: err}
+	}
+
+	header := make([]byte, headerSize)
+
+	n, err := io.ReadFull(r.r, header)
+	r.offset += int64(n)
+
+	if err != nil {
+		return Frame{}, err //nolint:wrapcheck
+	}
+
+	frameType := FrameType(header[0])
+	if !frameType.isKnown() {
+		return Frame{}, corrupt(
+			fmt.Errorf("%w: %d", ErrUnknownFrameType, frameType),
+		)
+	}
+
+	channel := binary.BigEndian.Uint16(header[1:])
+
+	length := binary.BigEndian.Uint32(header[3:])
+	if length > MaxPayloadSize {
+		return Frame{}, corrupt(
+			fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, length),
+		)
+	}
+
+	rest := make([]byte, length+checksumSize)
+
+	n, err = io.ReadFull(r.r, rest)
+	r.offset += int64(n)
+
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return Frame{}, err //nolint:wrapcheck
+	}
+
+	payload := rest[:length]
+	checksum := binary.BigEndian.Uint32(rest[length:])
+
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(header)
+	_, _ = crc.Write(payload)
+
+	if crc.Sum32() != checksum {
+		return Frame{}, corrupt(ErrChecksumMismatch)
+	}
+
+	return Frame{Type: frameType, Channel: channel, Payload: payload}, nil
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	frames := []pipe.Frame{
+		{Type: pipe.FrameTypeOpen, Payload: []byte("/tmp/report.xml")},
+		{
+			Type:    pipe.FrameTypeData,
+			Channel: 0x0102,
+			Payload: []byte{0x00, '\n', '\r', 0xff},
+		},
+		{Type: pipe.FrameTypeClose, Payload: []byte{}},
+	}
+
+	var buf bytes.Buffer
+
+	writer := pipe.NewWriter(&buf)
+	for _, frame := range frames {
+		require.NoError(t, writer.WriteFrame(frame))
+	}
+
+	reader := pipe.NewReader(&buf)
+	for _, expected := range frames {
+		actual, err := reader.ReadFrame()
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+
+	_, err := reader.ReadFrame()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestWriter_WriteFrame_TooLarge(t *testing.T) {
+	frame := pipe.Frame{
+		Type:    pipe.FrameTypeData,
+		Payload: make([]byte, pipe.MaxPayloadSize+1),
+	}
+
+	err := pipe.NewWriter(io.Discard).WriteFrame(frame)
+	assert.ErrorIs(t, err, pipe.ErrFrameTooLarge)
+}
+
+func TestReader_ReadFrame_Invalid(t *testing.T) {
+	var valid bytes.Buffer
+
+	err := pipe.NewWriter(&valid).WriteFrame(pipe.Frame{
+		Type:    pipe.FrameTypeData,
+		Payload: []byte("data"),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		modify      func([]byte) []byte
+		expectedErr error
+	}{
+		{
+			name: "corrupted payload",
+			modify: func(b []byte) []byte {
+				b[8] ^= 0x01
+				return b
+			},
+			expectedErr: pipe.ErrChecksumMismatch,
+		},
+		{
+			name: "unknown type",
+			modify: func(b []byte) []byte {
+				b[0] = 0xff
+				return b
+			},
+			expectedErr: pipe.ErrUnknownFrameType,
+		},
+		{
+			name: "too large",
+			modify: func(b []byte) []byte {
+				b[3] = 0xff
+				return b
+			},
+			expectedErr: pipe.ErrFrameTooLarge,
+		},
+		{
+			name: "truncated",
+			modify: func(b []byte) []byte {
+				return b[:len(b)-1]
+			},
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.modify(bytes.Clone(valid.Bytes()))
+
+			_, err := pipe.NewReader(bytes.NewReader(data)).ReadFrame()
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
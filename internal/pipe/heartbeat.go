@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SendHeartbeats sends a [FrameTypeHeartbeat] frame right away and then
+// periodically with the given interval until the context is done. It returns
+// an error only if a frame can not be written.
+func (c *Conn) SendHeartbeats(
+	ctx context.Context,
+	interval time.Duration,
+) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := c.writer.WriteFrame(Frame{Type: FrameTypeHeartbeat})
+		if err != nil {
+			return fmt.Errorf("heartbeat: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// WatchHeartbeats waits until the context is done or the remote end did not
+// send a heartbeat for longer than the given timeout. In the latter case, an
+// error wrapping [ErrNoHeartbeat] is returned. The timeout starts with the
+// call, so the remote end has the full timeout to send its first heartbeat.
+//
+// Heartbeats are received by [Conn.Serve], which must be running
+// concurrently.
+func (c *Conn) WatchHeartbeats(
+	ctx context.Context,
+	timeout time.Duration,
+) error {
+	start := time.Now().UnixNano()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		last := time.Unix(0, max(start, c.heartbeat.Load()))
+
+		remaining := timeout - time.Since(last)
+		if remaining <= 0 {
+			return fmt.Errorf("%w for %s", ErrNoHeartbeat, timeout)
+		}
+
+		timer.Reset(remaining)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConn_WatchHeartbeats(t *testing.T) {
+	guest, _, host, hostRead := connPair(t)
+
+	go func() { _ = host.Serve(hostRead) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sendDone := make(chan error)
+
+	go func() {
+		sendDone <- guest.SendHeartbeats(ctx, 10*time.Millisecond)
+	}()
+
+	watchCtx, watchCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer watchCancel()
+
+	err := host.WatchHeartbeats(watchCtx, 100*time.Millisecond)
+	require.NoError(t, err, "heartbeats received")
+
+	cancel()
+	require.NoError(t, <-sendDone)
+
+	err = host.WatchHeartbeats(context.Background(), 50*time.Millisecond)
+	require.ErrorIs(t, err, pipe.ErrNoHeartbeat)
+	assert.ErrorContains(t, err, "no heartbeat for 50ms")
+}
+
+func TestConn_SendHeartbeats_WriteError(t *testing.T) {
+	reader, writer := io.Pipe()
+	_ = reader.Close()
+
+	conn := pipe.NewConn(writer)
+
+	err := conn.SendHeartbeats(context.Background(), time.Millisecond)
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
@@ -0,0 +1,343 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Handler handles a request with the given method and JSON encoded
+// parameters. The returned result is JSON encoded and sent as response to the
+// requester. A returned error is sent as error message.
+type Handler func(method string, params json.RawMessage) (any, error)
+
+type request struct {
+	ID     uint32          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	ID     uint32          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Conn is one end of a bidirectional connection. It receives streams and
+// requests from the remote end and can send streams and requests to it.
+type Conn struct {
+	// Open is called for each received stream. Streams are rejected if it is
+	// nil.
+	Open OpenFunc
+
+	// Handler is called for each received request. Requests are rejected if
+	// it is nil. Each request is handled in its own goroutine, so handlers
+	// may send streams and requests themselves.
+	Handler Handler
+
+	writer  *Writer
+	window  int
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan response
+	closed  bool
+
+	// heartbeat is the time of the last received heartbeat in nanoseconds
+	// since the Unix epoch.
+	heartbeat atomic.Int64
+}
+
+// NewConn creates a new [Conn] that sends to w.
+func NewConn(w io.Writer) *Conn {
+	return &Conn{writer: NewWriter(w)}
+}
+
+// EnableFlowControl enables window based flow control for streams in both
+// directions. It must be enabled on both ends of the connection before any
+// stream is opened.
+//
+// The receiver grants the given amount of data per stream initially and
+// grants more as soon as data is written to its destination. The sender
+// blocks if it has no data granted. This way, a fast sender can not overrun a
+// slow destination, and streams with slow destinations do not block other
+// streams. The window must be at least [MaxPayloadSize].
+func (c *Conn) EnableFlowControl(window int) {
+	c.window = max(window, MaxPayloadSize)
+	c.writer.flow = newFlowControl()
+}
+
+// Writer returns the [Writer] of the connection for sending streams.
+func (c *Conn) Writer() *Writer {
+	return c.writer
+}
+
+// Serve reads frames from r until it is at its end.
+//
+// For each stream, [Conn.Open] is called and the data of the stream is
+// written to the returned destination. The destination is closed once the
+// stream is closed. Streams on different channels may be interleaved.
+// Compressed data is decompressed as announced by [FrameTypeHeader] frames.
+//
+// Requests are passed to [Conn.Handler] and responses are passed to the
+// pending [Conn.Call]. Heartbeats are recorded for [Conn.WatchHeartbeats].
+//
+// Corrupted frames and streams with a digest that does not match the received
+// data are reported as [CorruptionError].
+func (c *Conn) Serve(r io.Reader) error {
+	reader := NewReader(r)
+	receiver := receiver{
+		open:    c.Open,
+		streams: make(map[uint16]*receiveStream),
+		window:  c.window,
+		writer:  c.writer,
+	}
+
+	// Make sure all destinations are closed and pending calls and streams
+	// return, if the input ends or fails in the middle of a stream.
+	defer func() {
+		receiver.close()
+		c.closePending()
+
+		if c.writer != nil && c.writer.flow != nil {
+			c.writer.flow.close()
+		}
+	}()
+
+	for {
+		offset := reader.Offset()
+
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// Get the name before handling the frame, as the stream might be
+		// closed by it.
+		name := receiver.name(frame.Channel)
+
+		switch frame.Type {
+		case FrameTypeRequest:
+			err = c.handleRequest(frame.Payload)
+		case FrameTypeResponse:
+			err = c.handleResponse(frame.Payload)
+		case FrameTypeWindow:
+			err = c.handleWindow(frame)
+		case FrameTypeHeartbeat:
+			c.heartbeat.Store(time.Now().UnixNano())
+		default:
+			err = receiver.handle(frame)
+		}
+
+		if errors.Is(err, ErrUnexpectedFrame) ||
+			errors.Is(err, ErrDigestMismatch) {
+			err = &CorruptionError{
+				Stream: name,
+				Offset: offset,
+				Err:    err,
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Call sends a request with the given method and parameters and waits for the
+// response. The result of the response is decoded into result, unless it is
+// nil. An error message of the response is returned as [ErrRemote].
+//
+// The response is read by [Conn.Serve], which must be running concurrently.
+func (c *Conn) Call(
+	ctx context.Context,
+	method string,
+	params any,
+	result any,
+) error {
+	if c.writer == nil {
+		return ErrConnClosed
+	}
+
+	req := request{Method: method}
+
+	if params != nil {
+		var err error
+
+		req.Params, err = json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("encode params: %w", err)
+		}
+	}
+
+	respCh, err := c.register(&req)
+	if err != nil {
+		return err
+	}
+
+	defer c.unregister(req.ID)
+
+	err = c.writeJSON(FrameTypeRequest, req)
+	if err != nil {
+		return err
+	}
+
+	var resp response
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	case r, ok := <-respCh:
+		if !ok {
+			return ErrConnClosed
+		}
+
+		resp = r
+	}
+
+	if resp.Error != "" {
+		return fmt.Errorf("%w: %s: %s", ErrRemote, method, resp.Error)
+	}
+
+	if result != nil {
+		err := json.Unmarshal(resp.Result, result)
+		if err != nil {
+			return fmt.Errorf("decode result: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// register assigns an ID to the request and returns the channel its response
+// is sent to.
+func (c *Conn) register(req *request) (chan response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrConnClosed
+	}
+
+	if c.pending == nil {
+		c.pending = make(map[uint32]chan response)
+	}
+
+	c.nextID++
+	req.ID = c.nextID
+
+	// Buffered, so the response can be passed without blocking, even if the
+	// caller is gone already.
+	respCh := make(chan response, 1)
+	c.pending[req.ID] = respCh
+
+	return respCh, nil
+}
+
+func (c *Conn) unregister(id uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, id)
+}
+
+func (c *Conn) closePending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	for id, respCh := range c.pending {
+		close(respCh)
+		delete(c.pending, id)
+	}
+}
+
+func (c *Conn) handleRequest(payload []byte) error {
+	if c.Handler == nil || c.writer == nil {
+		return fmt.Errorf("%w: request", ErrUnexpectedFrame)
+	}
+
+	var req request
+
+	err := json.Unmarshal(payload, &req)
+	if err != nil {
+		return fmt.Errorf("decode request: %w", err)
+	}
+
+	go func() {
+		resp := response{ID: req.ID}
+
+		result, err := c.Handler(req.Method, req.Params)
+		if err == nil {
+			resp.Result, err = json.Marshal(result)
+		}
+
+		if err != nil {
+			resp.Error = err.Error()
+		}
+
+		// If the response can not be sent, the requester runs into its
+		// timeout or the connection is closed.
+		_ = c.writeJSON(FrameTypeResponse, resp)
+	}()
+
+	return nil
+}
+
+func (c *Conn) handleResponse(payload []byte) error {
+	var resp response
+
+	err := json.Unmarshal(payload, &resp)
+	if err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Responses for calls that are gone already, like due to a timeout, are
+	// dropped.
+	if respCh, exists := c.pending[resp.ID]; exists {
+		respCh <- resp
+
+		delete(c.pending, resp.ID)
+	}
+
+	return nil
+}
+
+func (c *Conn) handleWindow(frame Frame) error {
+	size, err := parseWindow(frame.Payload)
+	if err != nil {
+		return err
+	}
+
+	// Without flow control, grants are irrelevant.
+	if c.writer != nil && c.writer.flow != nil {
+		c.writer.flow.grant(frame.Channel, size)
+	}
+
+	return nil
+}
+
+func (c *Conn) writeJSON(frameType FrameType, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	return c.writer.WriteFrame(Frame{Type: frameType, Payload: payload})
+}
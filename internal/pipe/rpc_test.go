@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connPair returns two connected [pipe.Conn]s. Serving them is up to the
+// caller.
+func connPair(t *testing.T) (*pipe.Conn, io.Reader, *pipe.Conn, io.Reader) {
+	t.Helper()
+
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+
+	t.Cleanup(func() {
+		_ = clientWrite.Close()
+		_ = serverWrite.Close()
+	})
+
+	return pipe.NewConn(clientWrite), clientRead,
+		pipe.NewConn(serverWrite), serverRead
+}
+
+func TestConn_Call(t *testing.T) {
+	client, clientRead, server, serverRead := connPair(t)
+
+	server.Handler = func(method string, params json.RawMessage) (any, error) {
+		switch method {
+		case "echo":
+			var msg string
+			if err := json.Unmarshal(params, &msg); err != nil {
+				return nil, err
+			}
+
+			return msg, nil
+		default:
+			return nil, errors.New("unknown method")
+		}
+	}
+
+	go func() { _ = server.Serve(serverRead) }()
+	go func() { _ = client.Serve(clientRead) }()
+
+	var result string
+
+	err := client.Call(context.Background(), "echo", "hello", &result)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result)
+
+	err = client.Call(context.Background(), "fail", nil, nil)
+	require.ErrorIs(t, err, pipe.ErrRemote)
+	assert.ErrorContains(t, err, "unknown method")
+}
+
+func TestConn_Call_Closed(t *testing.T) {
+	client, _, _, serverRead := connPair(t)
+
+	// Drain the requests without responding.
+	go func() { _, _ = io.Copy(io.Discard, serverRead) }()
+
+	done := make(chan error)
+
+	go func() {
+		done <- client.Call(context.Background(), "never", nil, nil)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := client.Call(ctx, "canceled", nil, nil)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Serving an empty input closes the connection.
+	require.NoError(t, client.Serve(strings.NewReader("")))
+	require.ErrorIs(t, <-done, pipe.ErrConnClosed)
+
+	err = client.Call(context.Background(), "after", nil, nil)
+	require.ErrorIs(t, err, pipe.ErrConnClosed)
+}
@@ -0,0 +1,435 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Stream is a named stream of data written on its own channel of a [Writer].
+//
+// Multiple streams of the same [Writer] can be written concurrently. A single
+// stream must not be used concurrently.
+type Stream struct {
+	writer      *Writer
+	channel     uint16
+	compression Compression
+	digest      hash.Hash
+	closed      bool
+}
+
+// OpenStream opens a new stream with the given name on a free channel.
+//
+// The payload of the data frames of the stream is compressed as set by
+// [Writer.SetCompression].
+func (w *Writer) OpenStream(name string) (*Stream, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.openStream(name, w.compression)
+}
+
+// OpenStreamWithCompression opens a new stream like [Writer.OpenStream], but
+// with the given [Compression] instead of the one set by
+// [Writer.SetCompression]. This way, each stream can use the encoding that
+// suits its data best. If it differs from the compression announced last, a
+// [FrameTypeHeader] frame is sent right before the stream is opened.
+func (w *Writer) OpenStreamWithCompression(
+	name string,
+	compression Compression,
+) (*Stream, error) {
+	if !compression.isKnown() {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCompression, compression)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.openStream(name, compression)
+}
+
+func (w *Writer) openStream(
+	name string,
+	compression Compression,
+) (*Stream, error) {
+	// The receiver applies the compression announced last to each stream
+	// opened, so it must be announced before the open frame.
+	if compression != w.announced {
+		err := w.announce(compression)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	channel, err := w.allocateChannel()
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.writeFrame(Frame{
+		Type:    FrameTypeOpen,
+		Channel: channel,
+		Payload: []byte(name),
+	})
+	if err != nil {
+		delete(w.channels, channel)
+		return nil, err
+	}
+
+	stream := &Stream{
+		writer:      w,
+		channel:     channel,
+		compression: compression,
+		digest:      sha256.New(),
+	}
+
+	return stream, nil
+}
+
+func (w *Writer) allocateChannel() (uint16, error) {
+	for range 1 << 16 {
+		channel := w.nextChannel
+		w.nextChannel++
+
+		if !w.channels[channel] {
+			w.channels[channel] = true
+			return channel, nil
+		}
+	}
+
+	return 0, ErrTooManyStreams
+}
+
+func (w *Writer) writeData(
+	channel uint16,
+	compression Compression,
+	data []byte,
+) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if compression == CompressionGzip {
+		var err error
+
+		data, err = w.compressor.compress(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.writeFrame(Frame{
+		Type:    FrameTypeData,
+		Channel: channel,
+		Payload: data,
+	})
+}
+
+func (w *Writer) closeChannel(channel uint16, digest []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.channels, channel)
+
+	if w.flow != nil {
+		w.flow.release(channel)
+	}
+
+	return w.writeFrame(Frame{
+		Type:    FrameTypeClose,
+		Channel: channel,
+		Payload: digest,
+	})
+}
+
+// Write sends p as [FrameTypeData] frames. Large data is split into multiple
+// frames. If flow control is enabled, it blocks until the receiver granted
+// enough data.
+func (s *Stream) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	chunkSize := s.compression.chunkSize()
+
+	for written := 0; written < len(p); written += chunkSize {
+		chunk := p[written:min(written+chunkSize, len(p))]
+
+		if s.writer.flow != nil {
+			err := s.writer.flow.acquire(s.channel, len(chunk))
+			if err != nil {
+				return written, err
+			}
+		}
+
+		err := s.writer.writeData(s.channel, s.compression, chunk)
+		if err != nil {
+			return written, err
+		}
+
+		_, _ = s.digest.Write(chunk)
+	}
+
+	return len(p), nil
+}
+
+// Close ends the stream with a [FrameTypeClose] frame carrying the digest of
+// all written data. The channel of the stream is freed.
+func (s *Stream) Close() error {
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+
+	return s.writer.closeChannel(s.channel, s.digest.Sum(nil))
+}
+
+// SendStream sends the content of src as stream with the given name.
+//
+// See [Writer.OpenStream] for details.
+func (w *Writer) SendStream(name string, src io.Reader) error {
+	stream, err := w.OpenStream(name)
+	if err != nil {
+		return err
+	}
+
+	return stream.send(src)
+}
+
+// SendStreamWithCompression sends the content of src as stream with the given
+// name and [Compression].
+//
+// See [Writer.OpenStreamWithCompression] for details.
+func (w *Writer) SendStreamWithCompression(
+	name string,
+	compression Compression,
+	src io.Reader,
+) error {
+	stream, err := w.OpenStreamWithCompression(name, compression)
+	if err != nil {
+		return err
+	}
+
+	return stream.send(src)
+}
+
+// send writes the content of src to the stream and closes it.
+func (s *Stream) send(src io.Reader) error {
+	buf := make([]byte, s.compression.chunkSize())
+
+	for {
+		// Fill the buffer as far as possible, so compression is effective
+		// and the number of frames is low.
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if _, err := s.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("read stream: %w", err)
+		}
+	}
+
+	return s.Close()
+}
+
+// OpenFunc returns the destination for the stream with the given name.
+type OpenFunc func(name string) (io.WriteCloser, error)
+
+// ReceiveStreams reads streams sent by a [Writer] from r until it is at its
+// end. See [Conn.Serve] for details.
+func ReceiveStreams(r io.Reader, open OpenFunc) error {
+	conn := Conn{Open: open}
+	return conn.Serve(r)
+}
+
+// receiveStream holds the state of a stream open in [Conn.Serve].
+//
+// The data is written to the destination in the background, so a slow
+// destination does not block other streams. Once written, the data is granted
+// to the sender again, if flow control is enabled.
+type receiveStream struct {
+	name        string
+	dst         io.WriteCloser
+	compression Compression
+	digest      hash.Hash
+	queue       chan []byte
+	done        chan struct{}
+	err         error
+}
+
+// receiveQueueSize is the number of data frames buffered per stream before
+// reading further frames blocks.
+const receiveQueueSize = 64
+
+func (s *receiveStream) run(grant func(size int)) {
+	defer close(s.done)
+
+	for data := range s.queue {
+		// Keep draining after an error, so the sender is not blocked.
+		if s.err == nil {
+			_, s.err = s.dst.Write(data)
+			_, _ = s.digest.Write(data)
+		}
+
+		grant(len(data))
+	}
+}
+
+// wait stops the stream and waits until all queued data is written. The
+// destination is closed.
+func (s *receiveStream) wait() error {
+	close(s.queue)
+	<-s.done
+
+	err := s.dst.Close()
+	if s.err != nil {
+		return fmt.Errorf("write stream: %w", s.err)
+	}
+
+	if err != nil {
+		return fmt.Errorf("close stream: %w", err)
+	}
+
+	return nil
+}
+
+// receiver holds the stream state of [Conn.Serve].
+type receiver struct {
+	open         OpenFunc
+	compression  Compression
+	decompressor decompressor
+	streams      map[uint16]*receiveStream
+
+	// window is the amount of data that is granted initially per stream. It
+	// is 0 if flow control is disabled.
+	window int
+	writer *Writer
+}
+
+func (r *receiver) name(channel uint16) string {
+	if stream, exists := r.streams[channel]; exists {
+		return stream.name
+	}
+
+	return ""
+}
+
+func (r *receiver) handle(frame Frame) error {
+	var err error
+
+	stream, exists := r.streams[frame.Channel]
+
+	switch {
+	case frame.Type == FrameTypeHeader:
+		r.compression, err = parseHeader(frame.Payload)
+		if err != nil {
+			return err
+		}
+	case frame.Type == FrameTypeOpen && !exists && r.open != nil:
+		return r.openStream(frame.Channel, string(frame.Payload))
+	case frame.Type == FrameTypeData && exists:
+		return r.write(stream, frame.Payload)
+	case frame.Type == FrameTypeClose && exists:
+		return r.closeStream(frame.Channel, stream, frame.Payload)
+	default:
+		return fmt.Errorf("%w: type %d on channel %d",
+			ErrUnexpectedFrame, frame.Type, frame.Channel)
+	}
+
+	return nil
+}
+
+// grant sends a [FrameTypeWindow] frame, if flow control is enabled.
+func (r *receiver) grant(channel uint16, size int) {
+	if r.window == 0 || r.writer == nil {
+		return
+	}
+
+	// If this fails, the sender runs into its timeout eventually.
+	_ = r.writer.WriteFrame(windowFrame(channel, size))
+}
+
+func (r *receiver) openStream(channel uint16, name string) error {
+	dst, err := r.open(name)
+	if err != nil {
+		return fmt.Errorf("open stream: %w", err)
+	}
+
+	stream := &receiveStream{
+		name:        name,
+		dst:         dst,
+		compression: r.compression,
+		digest:      sha256.New(),
+		queue:       make(chan []byte, receiveQueueSize),
+		done:        make(chan struct{}),
+	}
+
+	r.streams[channel] = stream
+
+	go stream.run(func(size int) {
+		r.grant(channel, size)
+	})
+
+	r.grant(channel, r.window)
+
+	return nil
+}
+
+func (r *receiver) write(stream *receiveStream, payload []byte) error {
+	if stream.compression == CompressionGzip {
+		var buf bytes.Buffer
+
+		err := r.decompressor.decompress(&buf, payload)
+		if err != nil {
+			return fmt.Errorf("write stream: %w", err)
+		}
+
+		payload = buf.Bytes()
+	}
+
+	stream.queue <- payload
+
+	return nil
+}
+
+func (r *receiver) closeStream(
+	channel uint16,
+	stream *receiveStream,
+	digest []byte,
+) error {
+	delete(r.streams, channel)
+
+	err := stream.wait()
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(digest, stream.digest.Sum(nil)) {
+		return ErrDigestMismatch
+	}
+
+	return nil
+}
+
+// close stops all open streams.
+func (r *receiver) close() {
+	for channel, stream := range r.streams {
+		_ = stream.wait()
+
+		delete(r.streams, channel)
+	}
+}
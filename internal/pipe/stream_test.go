@@ -0,0 +1,258 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package pipe_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	streams := map[string]string{
+		"empty": "",
+		"small": "some\r\ndata\x00",
+		"large": strings.Repeat("x", 2*pipe.MaxPayloadSize+1),
+	}
+
+	var buf bytes.Buffer
+
+	writer := pipe.NewWriter(&buf)
+
+	for _, name := range []string{"empty", "small", "large"} {
+		err := writer.SendStream(name, strings.NewReader(streams[name]))
+		require.NoError(t, err)
+	}
+
+	received := map[string]*bufferCloser{}
+
+	err := pipe.ReceiveStreams(&buf, func(name string) (io.WriteCloser, error) {
+		received[name] = &bufferCloser{}
+		return received[name], nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, received, len(streams))
+
+	for name, expected := range streams {
+		assert.Equal(t, expected, received[name].String(), name)
+		assert.True(t, received[name].closed, name)
+	}
+}
+
+func TestReceiveStreams_UnexpectedFrame(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := pipe.NewWriter(&buf).WriteFrame(pipe.Frame{
+		Type:    pipe.FrameTypeData,
+		Payload: []byte("no stream"),
+	})
+	require.NoError(t, err)
+
+	err = pipe.ReceiveStreams(&buf, func(string) (io.WriteCloser, error) {
+		return &bufferCloser{}, nil
+	})
+	assert.ErrorIs(t, err, pipe.ErrUnexpectedFrame)
+}
+
+func TestStreamRoundTrip_Compression(t *testing.T) {
+	random := make([]byte, 2*pipe.MaxPayloadSize)
+	_, err := rand.NewChaCha8([32]byte{}).Read(random)
+	require.NoError(t, err)
+
+	streams := map[string]string{
+		"compressible":   strings.Repeat("data", pipe.MaxPayloadSize),
+		"incompressible": string(random),
+	}
+
+	tests := []struct {
+		name        string
+		compression pipe.Compression
+	}{
+		{
+			name:        "none",
+			compression: pipe.CompressionNone,
+		},
+		{
+			name:        "gzip",
+			compression: pipe.CompressionGzip,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			writer := pipe.NewWriter(&buf)
+			require.NoError(t, writer.SetCompression(tt.compression))
+
+			for _, name := range []string{"compressible", "incompressible"} {
+				err := writer.SendStream(name, strings.NewReader(streams[name]))
+				require.NoError(t, err)
+			}
+
+			received := map[string]*bufferCloser{}
+
+			err := pipe.ReceiveStreams(&buf, func(
+				name string,
+			) (io.WriteCloser, error) {
+				received[name] = &bufferCloser{}
+				return received[name], nil
+			})
+			require.NoError(t, err)
+
+			for name, expected := range streams {
+				assert.Equal(t, expected, received[name].String(), name)
+			}
+		})
+	}
+}
+
+func TestStreamRoundTrip_CompressionPerStream(t *testing.T) {
+	text := strings.Repeat("plain text\n", 100)
+	binary := strings.Repeat("\x00\x01binary", 100)
+
+	var buf bytes.Buffer
+
+	writer := pipe.NewWriter(&buf)
+	require.NoError(t, writer.SetCompression(pipe.CompressionGzip))
+
+	err := writer.SendStreamWithCompression("text", pipe.CompressionNone,
+		strings.NewReader(text))
+	require.NoError(t, err)
+
+	err = writer.SendStream("binary", strings.NewReader(binary))
+	require.NoError(t, err)
+
+	assert.Contains(t, buf.String(), text, "text sent uncompressed")
+	assert.NotContains(t, buf.String(), binary, "binary sent compressed")
+
+	received := map[string]*bufferCloser{}
+
+	err = pipe.ReceiveStreams(&buf, func(name string) (io.WriteCloser, error) {
+		received[name] = &bufferCloser{}
+		return received[name], nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, text, received["text"].String())
+	assert.Equal(t, binary, received["binary"].String())
+}
+
+func TestWriter_OpenStreamWithCompression_Unknown(t *testing.T) {
+	_, err := pipe.NewWriter(io.Discard).OpenStreamWithCompression("s", 42)
+	assert.ErrorIs(t, err, pipe.ErrUnknownCompression)
+}
+
+func TestWriter_SetCompression_Unknown(t *testing.T) {
+	err := pipe.NewWriter(io.Discard).SetCompression(42)
+	assert.ErrorIs(t, err, pipe.ErrUnknownCompression)
+}
+
+func TestReceiveStreams_Corruption(t *testing.T) {
+	open := func(string) (io.WriteCloser, error) {
+		return &bufferCloser{}, nil
+	}
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		writer := pipe.NewWriter(&buf)
+		frames := []pipe.Frame{
+			{Type: pipe.FrameTypeOpen, Payload: []byte("file")},
+			{Type: pipe.FrameTypeData, Payload: []byte("data")},
+			{Type: pipe.FrameTypeClose, Payload: make([]byte, 32)},
+		}
+
+		for _, frame := range frames {
+			require.NoError(t, writer.WriteFrame(frame))
+		}
+
+		err := pipe.ReceiveStreams(&buf, open)
+		require.ErrorIs(t, err, pipe.ErrDigestMismatch)
+
+		var corruptionErr *pipe.CorruptionError
+		require.ErrorAs(t, err, &corruptionErr)
+		assert.Equal(t, "file", corruptionErr.Stream)
+		assert.Equal(t, int64(15+15), corruptionErr.Offset)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		writer := pipe.NewWriter(&buf)
+		require.NoError(t, writer.SendStream("first", strings.NewReader("a")))
+		require.NoError(t, writer.SendStream("second", strings.NewReader("b")))
+
+		data := buf.Bytes()
+		// Flip a bit in the payload of the data frame of the second stream.
+		offset := bytes.LastIndexByte(data, 'b')
+		data[offset] ^= 0x01
+
+		err := pipe.ReceiveStreams(bytes.NewReader(data), open)
+		require.ErrorIs(t, err, pipe.ErrChecksumMismatch)
+
+		var corruptionErr *pipe.CorruptionError
+		require.ErrorAs(t, err, &corruptionErr)
+		// The stream of a corrupted frame is unknown, as the channel can not
+		// be trusted.
+		assert.Empty(t, corruptionErr.Stream)
+		assert.Equal(t, int64(offset-7), corruptionErr.Offset)
+	})
+}
+
+func TestStreamRoundTrip_Interleaved(t *testing.T) {
+	var buf bytes.Buffer
+
+	writer := pipe.NewWriter(&buf)
+
+	first, err := writer.OpenStream("first")
+	require.NoError(t, err)
+
+	second, err := writer.OpenStream("second")
+	require.NoError(t, err)
+
+	for _, data := range []string{"a", "b", "c"} {
+		_, err := first.Write([]byte(data))
+		require.NoError(t, err)
+
+		_, err = second.Write([]byte(strings.ToUpper(data)))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, second.Close())
+	require.NoError(t, first.Close())
+
+	_, err = first.Write([]byte("closed"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+
+	received := map[string]*bufferCloser{}
+
+	err = pipe.ReceiveStreams(&buf, func(name string) (io.WriteCloser, error) {
+		received[name] = &bufferCloser{}
+		return received[name], nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "abc", received["first"].String())
+	assert.Equal(t, "ABC", received["second"].String())
+}
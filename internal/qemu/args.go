@@ -39,6 +39,24 @@ func (a Argument) Value() string {
 	return a.value
 }
 
+// ID returns the ID of the QEMU object the [Argument] creates, like the "id"
+// option of -object, -netdev, -chardev and -device or the "node-name" option
+// of -blockdev. It returns an empty string if the [Argument] has no ID.
+func (a Argument) ID() string {
+	option, exists := idOptions[a.name]
+	if !exists {
+		return ""
+	}
+
+	for _, opt := range splitOptions(a.value) {
+		if id, found := strings.CutPrefix(opt, option+"="); found {
+			return id
+		}
+	}
+
+	return ""
+}
+
 // UniqueName returns if the name of the [Argument] must be unique in an
 // [CommandSpec] list.
 func (a Argument) UniqueName() bool {
@@ -80,14 +98,39 @@ func RepeatableArg(name string, value ...string) Argument {
 	}
 }
 
+// ObjectArg returns a new repeatable -object [Argument] for a QOM object of
+// the given type with the given ID and properties.
+func ObjectArg(typ, id string, props ...string) Argument {
+	value := append([]string{typ, "id=" + id}, props...)
+	return RepeatableArg("object", value...)
+}
+
+// NetdevArg returns a new repeatable -netdev [Argument] for a network backend
+// of the given type with the given ID and properties.
+func NetdevArg(backend, id string, props ...string) Argument {
+	value := append([]string{backend, "id=" + id}, props...)
+	return RepeatableArg("netdev", value...)
+}
+
+// BlockdevArg returns a new repeatable -blockdev [Argument] for a block node
+// of the given driver with the given node name and properties.
+func BlockdevArg(driver, nodeName string, props ...string) Argument {
+	value := append([]string{"driver=" + driver, "node-name=" + nodeName},
+		props...)
+
+	return RepeatableArg("blockdev", value...)
+}
+
 // BuildArgumentStrings compiles the [Argument]s to into a slice of strings
 // which can be used with [exec.Command].
 //
 // It returns an error if any name uniqueness constraints of any [Argument] is
-// violated.
+// violated or if any ID is used more than once. See [IDRegistry].
 func BuildArgumentStrings(args []Argument) ([]string, error) {
 	s := make([]string, 0, len(args))
 
+	var ids IDRegistry
+
 	for idx, arg := range args {
 		if i := slices.IndexFunc(args[:idx], arg.Equal); i != -1 {
 			return nil, fmt.Errorf(
@@ -98,6 +141,11 @@ func BuildArgumentStrings(args []Argument) ([]string, error) {
 			)
 		}
 
+		err := ids.Register(arg)
+		if err != nil {
+			return nil, err
+		}
+
 		s = append(s, "-"+arg.name)
 
 		if arg.value != "" {
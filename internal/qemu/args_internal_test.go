@@ -150,3 +150,43 @@ func TestRepeatableArg(t *testing.T) {
 		})
 	}
 }
+
+func TestArgsID(t *testing.T) {
+	tests := []struct {
+		name       string
+		arg        Argument
+		expectedID string
+	}{
+		{
+			name:       "no id namespace",
+			arg:        Argument{name: "kernel", value: "id=x"},
+			expectedID: "",
+		},
+		{
+			name:       "no id",
+			arg:        Argument{name: "device", value: "virtconsole,chardev=con0"},
+			expectedID: "",
+		},
+		{
+			name:       "chardev",
+			arg:        Argument{name: "chardev", value: "file,id=con0,path=/x"},
+			expectedID: "con0",
+		},
+		{
+			name:       "escaped comma",
+			arg:        Argument{name: "object", value: "secret,data=a,,id=x,id=s0"},
+			expectedID: "s0",
+		},
+		{
+			name:       "blockdev node name",
+			arg:        Argument{name: "blockdev", value: "driver=file,node-name=d0"},
+			expectedID: "d0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedID, tt.arg.ID())
+		})
+	}
+}
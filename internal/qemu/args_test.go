@@ -46,6 +46,28 @@ func TestBuildArgumentStrings(t *testing.T) {
 			},
 			requireError: require.Error,
 		},
+		{
+			name: "same id different namespaces",
+			args: []qemu.Argument{
+				qemu.ObjectArg("memory-backend-memfd", "mem"),
+				qemu.NetdevArg("user", "mem"),
+			},
+			expect: []string{
+				"-object", "memory-backend-memfd,id=mem",
+				"-netdev", "user,id=mem",
+			},
+			requireError: require.NoError,
+		},
+		{
+			name: "id collision",
+			args: []qemu.Argument{
+				qemu.NetdevArg("user", "net0"),
+				qemu.RepeatableArg("netdev", "tap,id=net0,ifname=tap0"),
+			},
+			requireError: func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, qemu.ErrIDCollision)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -56,3 +78,58 @@ func TestBuildArgumentStrings(t *testing.T) {
 		})
 	}
 }
+
+func TestArgConstructors(t *testing.T) {
+	tests := []struct {
+		name          string
+		arg           qemu.Argument
+		expectedName  string
+		expectedValue string
+		expectedID    string
+	}{
+		{
+			name:          "object",
+			arg:           qemu.ObjectArg("rng-random", "rng0", "filename=/dev/urandom"),
+			expectedName:  "object",
+			expectedValue: "rng-random,id=rng0,filename=/dev/urandom",
+			expectedID:    "rng0",
+		},
+		{
+			name:          "netdev",
+			arg:           qemu.NetdevArg("user", "net0"),
+			expectedName:  "netdev",
+			expectedValue: "user,id=net0",
+			expectedID:    "net0",
+		},
+		{
+			name:          "blockdev",
+			arg:           qemu.BlockdevArg("file", "disk0", "filename=disk.img"),
+			expectedName:  "blockdev",
+			expectedValue: "driver=file,node-name=disk0,filename=disk.img",
+			expectedID:    "disk0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedName, tt.arg.Name())
+			assert.Equal(t, tt.expectedValue, tt.arg.Value())
+			assert.Equal(t, tt.expectedID, tt.arg.ID())
+			assert.False(t, tt.arg.UniqueName())
+		})
+	}
+}
+
+func TestIDRegistry(t *testing.T) {
+	var ids qemu.IDRegistry
+
+	require.NoError(t, ids.Register(qemu.ObjectArg("iothread", "io0")))
+	require.NoError(t, ids.Register(qemu.UniqueArg("kernel", "vmlinuz")))
+	require.NoError(t, ids.Register(qemu.UniqueArg("kernel", "vmlinuz")))
+
+	assert.True(t, ids.Registered("object", "io0"))
+	assert.False(t, ids.Registered("netdev", "io0"))
+
+	err := ids.Register(qemu.RepeatableArg("object", "iothread,id=io0"))
+	require.ErrorIs(t, err, qemu.ErrIDCollision)
+}
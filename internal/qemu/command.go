@@ -5,21 +5,38 @@
 package qemu
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/sys"
 	"golang.org/x/sync/errgroup"
 )
 
 const minAdditionalFileDescriptor = 3
 
+// defaultFDDir is the default of [CommandSpec.FDDir].
+const defaultFDDir = "/dev/fd"
+
+// RawConsoleSuffix is the suffix of the files in [CommandSpec.RawConsoleDir].
+const RawConsoleSuffix = ".raw"
+
 // CommandSpec defines the parameters for a [Command].
 type CommandSpec struct {
 	// Path to the qemu-system binary
@@ -31,9 +48,26 @@ type CommandSpec struct {
 
 	// Path to the initramfs to boot with. This is supposed to be a Initramfs
 	// built with the initramfs sub package with an init that is built with
-	// the sysinit sub package.
+	// the sysinit sub package. It is ignored if UKI is set.
 	Initramfs string
 
+	// InitramfsFile is an open initramfs file, like a memfd, that is used
+	// instead of Initramfs, if set. It is passed to QEMU as the file
+	// descriptor after those of all consoles, so it does not need a path
+	// on disk. It is ignored if UKI is set. The caller is responsible for
+	// closing it.
+	InitramfsFile *os.File
+
+	// UKI indicates that Kernel is a Unified Kernel Image, an EFI executable
+	// with the initramfs and the kernel command line embedded. Neither
+	// Initramfs nor the kernel command line are passed to QEMU then. It must
+	// be booted via UEFI Firmware.
+	UKI bool
+
+	// Path to the firmware to boot with. The QEMU default firmware is used,
+	// if empty.
+	Firmware string
+
 	// QEMU machine type to use. Depends on the QEMU binary used.
 	Machine string
 
@@ -61,21 +95,155 @@ type CommandSpec struct {
 
 	// Additional files attached to consoles besides the default one used for
 	// stdout. They will be present in the guest system as "/dev/ttySx" or
-	// "/dev/hvcx" where x is the index of the slice + 1.
+	// "/dev/hvcx" where x is the index of the slice + 1. Besides host file
+	// paths, [ConsoleOutputStdout] and file descriptors with
+	// [ConsoleOutputFDPrefix] are supported, as well as the keys of
+	// ConsoleWriters.
 	AdditionalConsoles []string
 
+	// ConsoleWriters are the writers of the AdditionalConsoles added with
+	// [CommandSpec.AddConsoleWriter] by their target.
+	ConsoleWriters map[string]io.Writer
+
+	// ArtifactDir adds a console after all AdditionalConsoles the guest can
+	// send files with, if set. Files are expected as streams of the framed
+	// pipe protocol with flow control. They are written into the directory. See
+	// [CommandSpec.ArtifactConsoleDeviceName] for the name of the console in
+	// the guest.
+	ArtifactDir string
+
+	// ArtifactRedirects maps guest directories to host directories. Files
+	// the guest sends from within such a guest directory are written into
+	// the host directory instead of the [CommandSpec.ArtifactDir], relative
+	// to the guest directory. It requires [CommandSpec.ArtifactDir].
+	ArtifactRedirects map[string]string
+
+	// FDDir is the directory QEMU opens the file descriptors it inherits
+	// with, like the ones of the AdditionalConsoles. Default is "/dev/fd".
+	// Use "/proc/self/fd" if "/dev/fd" does not exist, like in some
+	// containers.
+	FDDir string
+
+	// RawConsoleDir is a directory QEMU writes the raw bytes the guest writes
+	// to its consoles into, before any processing by the [Command], if set.
+	// It must exist. The files are named after the IDs of the consoles with
+	// suffix [RawConsoleSuffix], like "stdio.raw" and "con0.raw". Existing
+	// files are overwritten.
+	RawConsoleDir string
+
+	// LogConsole adds a console after all other consoles the guest can
+	// write structured log records to. Records are expected as JSON lines
+	// as written by [slog.JSONHandler]. They are decoded and logged with
+	// the default [slog.Logger]. See [CommandSpec.LogConsoleDeviceName] for
+	// the name of the console in the guest.
+	LogConsole bool
+
+	// ControlConsole adds a bidirectional console after all other consoles
+	// for requests to the guest. The guest is expected to serve requests
+	// with the framed pipe protocol. See [Command.Call] for sending requests
+	// and [CommandSpec.ControlConsoleDeviceName] for the name of the console
+	// in the guest.
+	ControlConsole bool
+
+	// ControlHandler handles requests the guest sends on the control
+	// console. Requests are rejected if it is nil.
+	ControlHandler ControlHandler
+
+	// ControlOpen is called for each stream the guest sends on the control
+	// console. Streams are rejected if it is nil.
+	ControlOpen pipe.OpenFunc
+
+	// HeartbeatTimeout is the time the guest may not send heartbeats on the
+	// control console before it is considered hung and QEMU is stopped. The
+	// timeout includes the boot of the guest. Heartbeats are not watched if
+	// it is 0. It requires [CommandSpec.ControlConsole].
+	HeartbeatTimeout time.Duration
+
+	// ProcessLimits are applied to the QEMU process, like the host CPUs it
+	// is pinned to, so parallel instances on a shared host do not starve
+	// each other.
+	ProcessLimits sys.ProcessLimits
+
+	// Additional kernel command line parameters. They are added before the
+	// init arguments. They must pass [ValidateKernelParam] or an error will
+	// be returned on [Command.Run].
+	KernelParams []string
+
 	// Arguments to pass to the init binary.
 	InitArgs []string
 
 	// Increase guest kernel logging.
 	Verbose bool
 
-	// ExitCodeFmt defines the format of the line communicating the exit code
-	// from the guest. It must contain exactly one integer verb
-	// (probably "%d").
-	ExitCodeFmt string
+	// Interactive passes control characters typed into the terminal, like
+	// Ctrl-C, to the guest instead of interrupting QEMU. QEMU puts the
+	// terminal into raw mode, if stdin is one.
+	Interactive bool
+
+	// ExitCodePrefix is the prefix of the line communicating the exit code
+	// from the guest. The guest must format the line with the protocol
+	// package and the same prefix. The line is versioned and carries a
+	// checksum, so output of the guest containing just the prefix does not
+	// count.
+	ExitCodePrefix string
+
+	// ExitCodeNonce is the nonce the checksum of the line communicating the
+	// exit code is keyed by. It must be passed to the guest, like on the
+	// kernel command line, and should be random for each run, so markers
+	// of other runs do not count.
+	ExitCodeNonce string
+
+	// MainProcess is the name of the main process of the guest. If the OOM
+	// killer kills it, the [GuestOOMError] for it is returned, even if other
+	// processes were killed as well.
+	MainProcess string
+
+	// NotifyFmt defines the format of lines communicating state changes of
+	// the guest. It must contain exactly one string verb (probably "%s").
+	// Notifications are not parsed if it is empty.
+	NotifyFmt string
+
+	// StateHandler is called with each state the guest communicates, if
+	// NotifyFmt is set. It is called by the goroutine processing stdout, so
+	// it must not block.
+	StateHandler func(state string)
+
+	// PhaseStates maps states the guest communicates to the [Phase] they
+	// start. The output is attributed to [PhaseBoot] until the first of them
+	// is received and to [PhaseShutdown] once the exit code is found. See
+	// [Command.Phases].
+	PhaseStates map[string]Phase
+
+	// PhaseMarkers inserts a marker line into the output of the guest at the
+	// start of each [Phase]. See [PhaseMarkerFmt].
+	PhaseMarkers bool
+
+	// LineFilters are applied to each line of the guest's stdout in order.
+	// They are called by the goroutine processing stdout, so they must not
+	// block. See [LineFilter].
+	LineFilters []LineFilter
+
+	// VirtioFS are host directories shared with the guest. The guest memory
+	// is shared with the virtiofsd processes serving them, so Memory must be
+	// set. It requires a virtio transport type.
+	VirtioFS []VirtioFS
+
+	// FailOnKernelReport fails the run if the guest kernel reports a bug,
+	// like a WARN_ON splat, even if the guest returned exit code 0. The kernel
+	// console log level is raised, so all kinds of [KernelReport]s show up in
+	// the output.
+	FailOnKernelReport bool
 }
 
+// ControlHandler handles a request with the given method and JSON encoded
+// parameters sent by the guest on the control console. Streams can be sent to
+// the guest with the given [pipe.Writer] before the response is sent.
+type ControlHandler func(
+	w *pipe.Writer,
+	method string,
+	params json.RawMessage,
+) (any, error)
+
 // AddConsole adds an additional file to the QEMU command. This will be
 // writable from the guest via the device name returned by this command.
 // Console device number is starting at 1, as console 0 is the default stdout.
@@ -84,6 +252,122 @@ func (c *CommandSpec) AddConsole(file string) string {
 	return c.TransportType.ConsoleDeviceName(uint(len(c.AdditionalConsoles)))
 }
 
+// AddConsoleWriter adds an additional console like [CommandSpec.AddConsole]
+// whose output is written to the given writer.
+func (c *CommandSpec) AddConsoleWriter(w io.Writer) string {
+	if c.ConsoleWriters == nil {
+		c.ConsoleWriters = make(map[string]io.Writer)
+	}
+
+	target := consoleOutputWriterPrefix +
+		strconv.Itoa(len(c.AdditionalConsoles)+1)
+	c.ConsoleWriters[target] = w
+
+	return c.AddConsole(target)
+}
+
+// ArtifactConsoleDeviceName returns the name of the console device in the
+// guest that is used for sending files if [CommandSpec.ArtifactDir] is set.
+//
+// Since the artifact console is added after all AdditionalConsoles, the
+// returned name is only valid if no more consoles are added.
+func (c *CommandSpec) ArtifactConsoleDeviceName() string {
+	return c.TransportType.ConsoleDeviceName(
+		uint(len(c.AdditionalConsoles)) + 1,
+	)
+}
+
+// LogConsoleDeviceName returns the name of the console device in the guest
+// that is used for structured log records if [CommandSpec.LogConsole] is set.
+//
+// Since the log console is added after all other consoles, the returned name
+// is only valid if no more consoles are added.
+func (c *CommandSpec) LogConsoleDeviceName() string {
+	index := uint(len(c.AdditionalConsoles)) + 1
+	if c.ArtifactDir != "" {
+		index++
+	}
+
+	return c.TransportType.ConsoleDeviceName(index)
+}
+
+// ControlConsoleDeviceName returns the name of the console device in the
+// guest that is used for requests if [CommandSpec.ControlConsole] is set.
+//
+// Since the control console is added after all other consoles, the returned
+// name is only valid if no more consoles are added.
+func (c *CommandSpec) ControlConsoleDeviceName() string {
+	index := uint(len(c.AdditionalConsoles)) + 1
+	if c.ArtifactDir != "" {
+		index++
+	}
+
+	if c.LogConsole {
+		index++
+	}
+
+	return c.TransportType.ConsoleDeviceName(index)
+}
+
+// Console describes where the output of a console device in the guest goes
+// to on the host.
+type Console struct {
+	// Device is the name of the console device in the guest.
+	Device string `json:"device"`
+
+	// Output is the destination on the host. It is "stdout" for the default
+	// console, the target for [CommandSpec.AdditionalConsoles] and the
+	// purpose for all other consoles.
+	Output string `json:"output"`
+}
+
+// Consoles returns all consoles of the command in the order they are added.
+func (c *CommandSpec) Consoles() []Console {
+	consoles := []Console{
+		{Device: c.TransportType.ConsoleDeviceName(0), Output: "stdout"},
+	}
+
+	if !c.SupportsAdditionalConsoles() {
+		return consoles
+	}
+
+	for idx, file := range c.AdditionalConsoles {
+		consoles = append(consoles, Console{
+			Device: c.TransportType.ConsoleDeviceName(uint(idx) + 1),
+			Output: file,
+		})
+	}
+
+	if c.ArtifactDir != "" {
+		consoles = append(consoles, Console{
+			Device: c.ArtifactConsoleDeviceName(),
+			Output: "artifacts",
+		})
+	}
+
+	if c.LogConsole {
+		consoles = append(consoles, Console{
+			Device: c.LogConsoleDeviceName(),
+			Output: "log",
+		})
+	}
+
+	if c.ControlConsole {
+		consoles = append(consoles, Console{
+			Device: c.ControlConsoleDeviceName(),
+			Output: "control",
+		})
+	}
+
+	return consoles
+}
+
+// SupportsAdditionalConsoles returns false if the machine and transport type
+// combination provides only the single console used for stdio.
+func (c *CommandSpec) SupportsAdditionalConsoles() bool {
+	return c.Machine != "microvm" || c.TransportType != TransportTypeISA
+}
+
 // Validate checks for known incompatibilities.
 func (c *CommandSpec) Validate() error {
 	if !c.TransportType.isKnown() {
@@ -92,16 +376,59 @@ func (c *CommandSpec) Validate() error {
 		}
 	}
 
+	if !c.SupportsAdditionalConsoles() &&
+		(len(c.AdditionalConsoles) > 0 || c.ArtifactDir != "" ||
+			c.LogConsole || c.ControlConsole) {
+		return &ArgumentError{
+			"microvm supports only one isa serial port, used for stdio",
+		}
+	}
+
+	for _, target := range c.AdditionalConsoles {
+		if _, _, err := parseConsoleOutputFD(target); err != nil {
+			return err
+		}
+	}
+
+	for _, param := range c.KernelParams {
+		if err := ValidateKernelParam(param); err != nil {
+			return err
+		}
+	}
+
+	// The kernel command line is compiled from the KernelParams. Another
+	// -append argument would replace it.
+	for _, arg := range c.ExtraArgs {
+		if arg.Name() == "append" {
+			return &ArgumentError{
+				"kernel command line must be given as kernel params, " +
+					"not as -append argument",
+			}
+		}
+	}
+
+	if c.HeartbeatTimeout > 0 && !c.ControlConsole {
+		return &ArgumentError{"heartbeat timeout requires control console"}
+	}
+
+	if c.UKI && c.Firmware == "" {
+		return &ArgumentError{"UKI requires UEFI firmware"}
+	}
+
+	if len(c.VirtioFS) > 0 {
+		if c.TransportType == TransportTypeISA {
+			return &ArgumentError{"virtiofs requires a virtio transport"}
+		}
+
+		if c.Memory == 0 {
+			return &ArgumentError{"virtiofs requires memory size"}
+		}
+	}
+
 	switch c.Machine {
 	case "microvm":
-		switch {
-		case c.TransportType == TransportTypePCI:
+		if c.TransportType == TransportTypePCI {
 			return &ArgumentError{"microvm does not support pci transport"}
-		case c.TransportType == TransportTypeISA &&
-			len(c.AdditionalConsoles) > 0:
-			return &ArgumentError{
-				"microvm supports only one isa serial port, used for stdio",
-			}
 		}
 	case "virt":
 		if c.TransportType == TransportTypeISA {
@@ -122,11 +449,31 @@ func (c *CommandSpec) Validate() error {
 func (c *CommandSpec) arguments() []Argument {
 	args := []Argument{
 		UniqueArg("kernel", c.Kernel),
-		UniqueArg("initrd", c.Initramfs),
+	}
+
+	// A UKI has the initramfs embedded, so it is not passed separately.
+	if !c.UKI {
+		initrd := c.Initramfs
+		if c.InitramfsFile != nil {
+			initrd = c.fdPath(c.initramfsFD())
+		}
+
+		args = append(args, UniqueArg("initrd", initrd))
+	}
+
+	if c.Firmware != "" {
+		args = append(args, UniqueArg("bios", c.Firmware))
 	}
 
 	if c.Machine != "" {
-		args = append(args, UniqueArg("machine", c.Machine))
+		machine := []string{c.Machine}
+
+		// Shared file systems need the guest memory to be shared.
+		if len(c.VirtioFS) > 0 {
+			machine = append(machine, "memory-backend="+virtioFSMemoryBackend)
+		}
+
+		args = append(args, UniqueArg("machine", machine...))
 	}
 
 	if c.CPU != "" {
@@ -154,23 +501,59 @@ func (c *CommandSpec) arguments() []Argument {
 	}
 
 	// Add stdout console.
-	args = c.appendConsoleArgs(args, console{
+	stdio := console{
 		id:      "stdio",
 		backend: "stdio",
-	})
+	}
+
+	if c.Interactive {
+		stdio.opts = append(stdio.opts, "signal=off")
+	}
+
+	args = c.appendConsoleArgs(args, stdio)
 
 	// Write console output to file descriptors. Those are provided by the
-	// [exec.Cmd.ExtraFiles].
-	for idx := range c.AdditionalConsoles {
-		// FDs 0, 1, 2 are standard in, out, err, so start at 3.
-		path := fdPath(minAdditionalFileDescriptor + idx)
-		args = c.appendConsoleArgs(args, console{
-			id:      fmt.Sprintf("con%d", idx),
-			backend: "file",
-			opts:    []string{"path=" + path},
-		})
+	// [exec.Cmd.ExtraFiles]. FDs 0, 1, 2 are standard in, out, err, so start
+	// at 3. Bidirectional consoles read their input from the file descriptor
+	// right after their output file descriptor.
+	fd := minAdditionalFileDescriptor
+	fileConsole := func(id string, bidirectional bool) console {
+		opts := []string{"path=" + c.fdPath(fd)}
+		fd++
+
+		if bidirectional {
+			opts = append(opts, "input-path="+c.fdPath(fd))
+			fd++
+		}
+
+		return console{id: id, backend: "file", opts: opts}
 	}
 
+	consoleCount := len(c.AdditionalConsoles)
+
+	for idx := range consoleCount {
+		id := fmt.Sprintf("con%d", idx)
+		args = c.appendConsoleArgs(args, fileConsole(id, false))
+	}
+
+	// The artifact console is bidirectional for flow control.
+	if c.ArtifactDir != "" {
+		id := fmt.Sprintf("con%d", consoleCount)
+		args = c.appendConsoleArgs(args, fileConsole(id, true))
+		consoleCount++
+	}
+
+	if c.LogConsole {
+		id := fmt.Sprintf("con%d", consoleCount)
+		args = c.appendConsoleArgs(args, fileConsole(id, false))
+	}
+
+	if c.ControlConsole {
+		args = c.appendConsoleArgs(args, fileConsole("control", true))
+	}
+
+	args = append(args, c.virtioFSArgs()...)
+
 	args = append(args,
 		// Disable video output.
 		UniqueArg("display", "none"),
@@ -186,14 +569,18 @@ func (c *CommandSpec) arguments() []Argument {
 
 	args = append(args, c.ExtraArgs...)
 
-	kernelCmdline := strings.Join(c.kernelCmdlineArgs(), " ")
-	args = append(args, RepeatableArg("append", kernelCmdline))
+	// A UKI has the kernel command line embedded. A passed one would
+	// override it, unless secure boot is enforced.
+	if !c.UKI {
+		kernelCmdline := strings.Join(c.KernelCmdline(), " ")
+		args = append(args, RepeatableArg("append", kernelCmdline))
+	}
 
 	return args
 }
 
-// kernelCmdlineArgs reruns the kernel cmdline arguments.
-func (c *CommandSpec) kernelCmdlineArgs() []string {
+// KernelCmdline returns the kernel command line parameters.
+func (c *CommandSpec) KernelCmdline() []string {
 	cmdline := []string{
 		"console=" + c.TransportType.ConsoleDeviceName(0),
 		"panic=-1",
@@ -209,10 +596,16 @@ func (c *CommandSpec) kernelCmdlineArgs() []string {
 
 	if !c.Verbose {
 		cmdline = append(cmdline, "quiet")
+
+		if c.FailOnKernelReport {
+			cmdline = append(cmdline, "loglevel="+kernelReportLogLevel)
+		}
 	}
 
+	cmdline = append(cmdline, c.KernelParams...)
+
 	if len(c.InitArgs) > 0 {
-		cmdline = append(cmdline, "--")
+		cmdline = append(cmdline, initArgsSeparator)
 		cmdline = append(cmdline, c.InitArgs...)
 	}
 
@@ -243,20 +636,66 @@ func (c *CommandSpec) appendConsoleArgs(
 	chardevOpts := []string{console.backend, "id=" + console.id}
 	chardevOpts = append(chardevOpts, console.opts...)
 
+	if c.RawConsoleDir != "" {
+		logFile := filepath.Join(c.RawConsoleDir, console.id+RawConsoleSuffix)
+		chardevOpts = append(chardevOpts,
+			"logfile="+escapeOption(logFile), "logappend=off")
+	}
+
 	chardevArg := RepeatableArg("chardev", strings.Join(chardevOpts, ","))
 
 	return append(args, chardevArg, devArg)
 }
 
-func fdPath(fd int) string {
-	return fmt.Sprintf("/dev/fd/%d", fd)
+// initramfsFD returns the file descriptor [CommandSpec.InitramfsFile] is
+// passed to QEMU as. It follows the file descriptors of all consoles.
+func (c *CommandSpec) initramfsFD() int {
+	fd := minAdditionalFileDescriptor + len(c.AdditionalConsoles)
+
+	// Bidirectional consoles have two file descriptors.
+	if c.ArtifactDir != "" {
+		fd += 2
+	}
+
+	if c.LogConsole {
+		fd++
+	}
+
+	if c.ControlConsole {
+		fd += 2
+	}
+
+	return fd
+}
+
+// fdPath returns the path QEMU opens the given inherited file descriptor
+// with. See [CommandSpec.FDDir].
+func (c *CommandSpec) fdPath(fd int) string {
+	return fmt.Sprintf("%s/%d", cmp.Or(c.FDDir, defaultFDDir), fd)
 }
 
 type Command struct {
 	cmd          *exec.Cmd
 	stdoutParser stdoutParser
 
-	consoleOutput []string
+	consoleOutput     []string
+	consoleWriters    map[string]io.Writer
+	artifactDir       string
+	artifactRedirects map[string]string
+	logConsole        bool
+	controlConsole    bool
+	controlHandler    ControlHandler
+	controlOpen       pipe.OpenFunc
+	heartbeatTimeout  time.Duration
+	processLimits     sys.ProcessLimits
+	kernelCmdline     []string
+	consoles          []Console
+	collector         *fileCollector
+	initramfsFile     *os.File
+
+	// control is the connection to the guest via the control console. It is
+	// set only while the command is running.
+	control atomic.Pointer[pipe.Conn]
 
 	closer []io.Closer
 }
@@ -274,16 +713,36 @@ func NewCommand(ctx context.Context, spec CommandSpec) (*Command, error) {
 		return nil, err
 	}
 
-	if spec.ExitCodeFmt == "" {
-		return nil, &ArgumentError{"ExitCodeFmt must not be empty"}
+	if spec.ExitCodePrefix == "" {
+		return nil, &ArgumentError{"ExitCodePrefix must not be empty"}
 	}
 
 	cmd := &Command{
-		cmd:           exec.CommandContext(ctx, spec.Executable, cmdArgs...),
-		consoleOutput: spec.AdditionalConsoles,
+		cmd:               exec.CommandContext(ctx, spec.Executable, cmdArgs...),
+		consoleOutput:     spec.AdditionalConsoles,
+		consoleWriters:    spec.ConsoleWriters,
+		artifactDir:       spec.ArtifactDir,
+		artifactRedirects: spec.ArtifactRedirects,
+		logConsole:        spec.LogConsole,
+		controlConsole:    spec.ControlConsole,
+		controlHandler:    spec.ControlHandler,
+		controlOpen:       spec.ControlOpen,
+		heartbeatTimeout:  spec.HeartbeatTimeout,
+		processLimits:     spec.ProcessLimits,
+		initramfsFile:     spec.InitramfsFile,
+		kernelCmdline:     spec.KernelCmdline(),
+		consoles:          spec.Consoles(),
 		stdoutParser: stdoutParser{
-			ExitCodeFmt: spec.ExitCodeFmt,
-			Verbose:     spec.Verbose,
+			ExitCodePrefix:     spec.ExitCodePrefix,
+			ExitCodeNonce:      spec.ExitCodeNonce,
+			MainProcess:        spec.MainProcess,
+			NotifyFmt:          spec.NotifyFmt,
+			Verbose:            spec.Verbose,
+			StateHandler:       spec.StateHandler,
+			Filters:            spec.LineFilters,
+			FailOnKernelReport: spec.FailOnKernelReport,
+			PhaseStates:        spec.PhaseStates,
+			PhaseMarkers:       spec.PhaseMarkers,
 		},
 	}
 
@@ -294,6 +753,11 @@ func NewCommand(ctx context.Context, spec CommandSpec) (*Command, error) {
 		return cmd.cmd.Process.Signal(os.Interrupt)
 	}
 
+	// A UKI has the initramfs embedded.
+	if spec.UKI {
+		cmd.initramfsFile = nil
+	}
+
 	return cmd, nil
 }
 
@@ -304,6 +768,71 @@ func (c *Command) String() string {
 	return c.cmd.String()
 }
 
+// Args returns the command line of the QEMU process, starting with the
+// executable.
+func (c *Command) Args() []string {
+	return slices.Clone(c.cmd.Args)
+}
+
+// KernelCmdline returns the parameters of the kernel command line.
+func (c *Command) KernelCmdline() []string {
+	return slices.Clone(c.kernelCmdline)
+}
+
+// Consoles returns the consoles of the command. See [CommandSpec.Consoles].
+func (c *Command) Consoles() []Console {
+	return slices.Clone(c.consoles)
+}
+
+// States returns the state notifications the guest sent. It must not be
+// called before [Command.Run] returned.
+func (c *Command) States() []StateChange {
+	return slices.Clone(c.stdoutParser.states)
+}
+
+// Phases returns the lifecycle phases of the guest along with the lines of
+// the output attributed to them. It must not be called before [Command.Run]
+// returned.
+func (c *Command) Phases() []PhaseSpan {
+	return slices.Clone(c.stdoutParser.phases)
+}
+
+// CPUTime returns the user and system CPU time the QEMU process used. It
+// includes the CPU time of the guest and the emulation overhead. It must not
+// be called before [Command.Run] returned. It is zero, if QEMU did not run.
+func (c *Command) CPUTime() time.Duration {
+	state := c.cmd.ProcessState
+	if state == nil {
+		return 0
+	}
+
+	return state.UserTime() + state.SystemTime()
+}
+
+// ExitCodeFound returns true if the guest communicated an exit code, even if
+// the run failed otherwise, like if QEMU was stopped afterwards. It must not
+// be called before [Command.Run] returned.
+func (c *Command) ExitCodeFound() bool {
+	return c.stdoutParser.exitCodeFound
+}
+
+// KernelReports returns the bug reports of the guest kernel found in the
+// output. It must not be called before [Command.Run] returned.
+func (c *Command) KernelReports() []KernelReport {
+	return slices.Clone(c.stdoutParser.reports)
+}
+
+// CollectedFiles returns the guest paths of the files the guest sent into the
+// [CommandSpec.ArtifactDir]. It must not be called before [Command.Run]
+// returned.
+func (c *Command) CollectedFiles() []string {
+	if c.collector == nil {
+		return nil
+	}
+
+	return slices.Clone(c.collector.received)
+}
+
 // stdoutProcessor creates a new [consoleProcessor] with the command's
 // [stdoutParser].
 func (c *Command) stdoutProcessor(dst io.Writer) (*consoleProcessor, error) {
@@ -321,21 +850,48 @@ func (c *Command) stdoutProcessor(dst io.Writer) (*consoleProcessor, error) {
 	return processor, nil
 }
 
-func (c *Command) addPipeConsoleProcessor(
-	dst io.Writer,
-) (*consoleProcessor, error) {
+// addConsolePipe creates a pipe for the next console and returns its read end.
+func (c *Command) addConsolePipe() (*os.File, error) {
 	readPipe, writePipe, err := os.Pipe()
 	if err != nil {
 		return nil, fmt.Errorf("pipe: %w", err)
 	}
 
-	// Append the write end of the console processor pipe as extra file, so it
-	// is present as additional file descriptor which can be used with the
-	// "file" backend for QEMU console devices. The processor reads from the
-	// read end of the pipe, cleans the output and writes it into the actual
-	// target file on the host.
+	// Append the write end of the pipe as extra file, so it is present as
+	// additional file descriptor which can be used with the "file" backend
+	// for QEMU console devices. The console output is read from the read end
+	// of the pipe.
 	c.cmd.ExtraFiles = append(c.cmd.ExtraFiles, writePipe)
-	c.closer = append(c.closer, writePipe)
+	c.closer = append(c.closer, writePipe, readPipe)
+
+	return readPipe, nil
+}
+
+// addInputPipe creates a pipe for the input of the next console and returns
+// its write end.
+func (c *Command) addInputPipe() (*os.File, error) {
+	readPipe, writePipe, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("pipe: %w", err)
+	}
+
+	// The read end is passed to QEMU the same way as the write end of output
+	// pipes.
+	c.cmd.ExtraFiles = append(c.cmd.ExtraFiles, readPipe)
+	c.closer = append(c.closer, readPipe, writePipe)
+
+	return writePipe, nil
+}
+
+func (c *Command) addPipeConsoleProcessor(
+	dst io.Writer,
+) (*consoleProcessor, error) {
+	// The processor reads from the read end of the pipe, cleans the output
+	// and writes it into the actual target file on the host.
+	readPipe, err := c.addConsolePipe()
+	if err != nil {
+		return nil, err
+	}
 
 	processor := &consoleProcessor{
 		dst: dst,
@@ -358,19 +914,25 @@ func (c *Command) close() {
 // other case, an error is returned. If the QEMU command itself failed,
 // a [CommandError] with the guest flag unset is returned. If the guest
 // returned an error or failed a [CommandError] with guest flag set is
-// returned.
+// returned. If the guest did not send heartbeats in time, a [CommandError]
+// with guest flag set wrapping [pipe.ErrNoHeartbeat] is returned.
 func (c *Command) Run(stdin io.Reader, stdout, stderr io.Writer) error {
 	defer c.close()
 
 	var processors errgroup.Group
 
-	for _, path := range c.consoleOutput {
-		dst, err := os.Create(path)
+	// Consoles may write to stdout as well, so writes are serialized.
+	if slices.Contains(c.consoleOutput, ConsoleOutputStdout) {
+		stdout = &syncWriter{w: stdout}
+	}
+
+	for _, target := range c.consoleOutput {
+		dst, closer, err := openConsoleOutput(target, c.consoleWriters, stdout)
 		if err != nil {
-			return fmt.Errorf("output file: %w", err)
+			return err
 		}
 
-		c.closer = append(c.closer, dst)
+		c.closer = append(c.closer, closer)
 
 		processor, err := c.addPipeConsoleProcessor(dst)
 		if err != nil {
@@ -380,6 +942,76 @@ func (c *Command) Run(stdin io.Reader, stdout, stderr io.Writer) error {
 		processors.Go(processor.run)
 	}
 
+	// The artifact, log and control consoles must be added in the same order
+	// as in the arguments, so they match the file descriptors.
+	if c.artifactDir != "" {
+		readPipe, err := c.addConsolePipe()
+		if err != nil {
+			return err
+		}
+
+		writePipe, err := c.addInputPipe()
+		if err != nil {
+			return err
+		}
+
+		collector := newFileCollector(c.artifactDir, c.artifactRedirects)
+		c.collector = collector
+
+		processors.Go(func() error {
+			return collector.receive(readPipe, writePipe)
+		})
+	}
+
+	if c.logConsole {
+		processor, err := c.addPipeConsoleProcessor(nil)
+		if err != nil {
+			return err
+		}
+
+		processor.fn = newLogRecordParser(slog.Default()).Parse
+
+		processors.Go(processor.run)
+	}
+
+	if c.controlConsole {
+		readPipe, err := c.addConsolePipe()
+		if err != nil {
+			return err
+		}
+
+		writePipe, err := c.addInputPipe()
+		if err != nil {
+			return err
+		}
+
+		conn := pipe.NewConn(writePipe)
+		conn.EnableFlowControl(pipe.DefaultWindowSize)
+		conn.Open = c.controlOpen
+
+		if c.controlHandler != nil {
+			conn.Handler = func(
+				method string,
+				params json.RawMessage,
+			) (any, error) {
+				return c.controlHandler(conn.Writer(), method, params)
+			}
+		}
+
+		c.control.Store(conn)
+
+		defer c.control.Store(nil)
+
+		processors.Go(func() error {
+			return conn.Serve(readPipe)
+		})
+	}
+
+	// The initramfs file follows the consoles, as in the arguments.
+	if c.initramfsFile != nil {
+		c.cmd.ExtraFiles = append(c.cmd.ExtraFiles, c.initramfsFile)
+	}
+
 	c.cmd.Stdin = stdin
 	c.cmd.Stderr = stderr
 
@@ -388,24 +1020,46 @@ func (c *Command) Run(stdin io.Reader, stdout, stderr io.Writer) error {
 		return err
 	}
 
-	if err := c.cmd.Start(); err != nil {
+	c.stdoutParser.start = time.Now()
+
+	if err := c.start(); err != nil {
 		return fmt.Errorf("start: %w", err)
 	}
 
+	stopHeartbeats := func() error { return nil }
+
+	if conn := c.control.Load(); conn != nil && c.heartbeatTimeout > 0 {
+		stopHeartbeats = sync.OnceValue(c.watchHeartbeats(conn))
+		defer stopHeartbeats() //nolint:errcheck
+	}
+
 	if err := stdoutProcessor.run(); err != nil {
 		return fmt.Errorf("stdout parser: %w", err)
 	}
 
-	if err := c.cmd.Wait(); err != nil {
-		return wrapExitError(err)
-	}
+	waitErr := c.cmd.Wait()
+	heartbeatErr := stopHeartbeats()
 
-	// Close all FDs so processors stop.
+	// Close all FDs so processors stop. The initramfs file is owned by the
+	// caller.
 	for _, f := range c.cmd.ExtraFiles {
-		_ = f.Close()
+		if f != c.initramfsFile {
+			_ = f.Close()
+		}
 	}
 
 	err = processors.Wait()
+
+	// A missing heartbeat is the cause of QEMU being stopped, so it takes
+	// precedence.
+	if heartbeatErr != nil {
+		return &CommandError{Err: heartbeatErr, Guest: true}
+	}
+
+	if waitErr != nil {
+		return wrapExitError(waitErr)
+	}
+
 	if err != nil {
 		return fmt.Errorf("processor wait: %w", err)
 	}
@@ -413,6 +1067,95 @@ func (c *Command) Run(stdin io.Reader, stdout, stderr io.Writer) error {
 	return c.stdoutParser.GuestSuccessful()
 }
 
+// start starts QEMU with the process limits applied. The scheduling limits
+// are applied to a locked thread that starts QEMU, so QEMU inherits them
+// before it runs. The thread is terminated afterwards, as the limits can not
+// be reset in all cases, like lowered priorities.
+func (c *Command) start() error {
+	cgroup, err := c.processLimits.OpenCgroup()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if cgroup != nil {
+		defer cgroup.Close()
+
+		c.cmd.SysProcAttr = &syscall.SysProcAttr{
+			UseCgroupFD: true,
+			CgroupFD:    int(cgroup.Fd()),
+		}
+	}
+
+	if !c.processLimits.ThreadLimited() {
+		return c.cmd.Start() //nolint:wrapcheck
+	}
+
+	startErr := make(chan error, 1)
+
+	go func() {
+		// The goroutine exits without unlocking, which terminates the
+		// thread.
+		runtime.LockOSThread()
+
+		err := c.processLimits.ApplyToThread()
+		if err == nil {
+			err = c.cmd.Start()
+		}
+
+		startErr <- err
+	}()
+
+	return <-startErr
+}
+
+// watchHeartbeats interrupts QEMU if the guest does not send heartbeats on the
+// given connection in time. The returned function stops watching and returns
+// the error of the watcher, if it interrupted QEMU.
+func (c *Command) watchHeartbeats(conn *pipe.Conn) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		err := conn.WatchHeartbeats(ctx, c.heartbeatTimeout)
+		if err != nil {
+			_ = c.cmd.Process.Signal(os.Interrupt)
+		}
+
+		done <- err
+	}()
+
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
+
+// Call sends a request with the given method and parameters to the guest via
+// the control console and waits for the response. The result is decoded into
+// result, unless it is nil.
+//
+// It can be used only while [Command.Run] is running and if
+// [CommandSpec.ControlConsole] is set. Otherwise, [ErrControlUnavailable] is
+// returned.
+func (c *Command) Call(
+	ctx context.Context,
+	method string,
+	params any,
+	result any,
+) error {
+	conn := c.control.Load()
+	if conn == nil {
+		return ErrControlUnavailable
+	}
+
+	err := conn.Call(ctx, method, params, result)
+	if err != nil {
+		return fmt.Errorf("call %s: %w", method, err)
+	}
+
+	return nil
+}
+
 func wrapExitError(err error) error {
 	var exitErr *exec.ExitError
 
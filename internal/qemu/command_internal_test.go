@@ -6,8 +6,15 @@ package qemu
 
 import (
 	"context"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/protocol"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -67,6 +74,28 @@ func TestCommandSpec_Arguments(t *testing.T) {
 			expect: "quiet",
 			assert: ArgumentValueAssertionFunc("append", assert.Contains),
 		},
+		{
+			name: "fail on kernel report",
+			spec: CommandSpec{
+				FailOnKernelReport: true,
+			},
+			expect: "loglevel=5",
+			assert: ArgumentValueAssertionFunc("append", assert.Contains),
+		},
+		{
+			name: "kernel params",
+			spec: CommandSpec{
+				KernelParams: []string{
+					"first",
+					"second=2",
+				},
+				InitArgs: []string{
+					"third",
+				},
+			},
+			expect: " first second=2 -- third",
+			assert: ArgumentValueAssertionFunc("append", assert.Contains),
+		},
 		{
 			name: "init args",
 			spec: CommandSpec{
@@ -79,6 +108,81 @@ func TestCommandSpec_Arguments(t *testing.T) {
 			expect: " -- first second third",
 			assert: ArgumentValueAssertionFunc("append", assert.Contains),
 		},
+		{
+			name: "uki",
+			spec: CommandSpec{
+				Kernel:    "/boot/uki.efi",
+				Initramfs: "/tmp/initramfs.cpio",
+				Firmware:  "/usr/share/ovmf/OVMF.fd",
+				UKI:       true,
+			},
+			expect: []Argument{
+				UniqueArg("kernel", "/boot/uki.efi"),
+				UniqueArg("bios", "/usr/share/ovmf/OVMF.fd"),
+				UniqueArg("display", "none"),
+			},
+			assert: assert.Subset,
+		},
+		{
+			name: "uki without initrd",
+			spec: CommandSpec{
+				Initramfs: "/tmp/initramfs.cpio",
+				UKI:       true,
+			},
+			expect: UniqueArg("initrd", "/tmp/initramfs.cpio"),
+			assert: assert.NotContains,
+		},
+		{
+			name: "uki without cmdline",
+			spec: CommandSpec{
+				UKI: true,
+			},
+			expect: "append",
+			assert: func(t assert.TestingT, args, name any, _ ...any) bool {
+				for _, arg := range args.([]Argument) {
+					if arg.Name() == name {
+						return assert.Fail(t, "unexpected argument", name)
+					}
+				}
+
+				return true
+			},
+		},
+		{
+			name: "interactive",
+			spec: CommandSpec{
+				TransportType: TransportTypeMMIO,
+				Interactive:   true,
+			},
+			expect: RepeatableArg("chardev", "stdio,id=stdio,signal=off"),
+			assert: assert.Contains,
+		},
+		{
+			name: "fd dir",
+			spec: CommandSpec{
+				AdditionalConsoles: []string{"/output/file1"},
+				TransportType:      TransportTypePCI,
+				FDDir:              "/proc/self/fd",
+			},
+			expect: RepeatableArg("chardev",
+				"file,id=con0,path=/proc/self/fd/3"),
+			assert: assert.Contains,
+		},
+		{
+			name: "raw console dir",
+			spec: CommandSpec{
+				AdditionalConsoles: []string{"/output/file1"},
+				TransportType:      TransportTypePCI,
+				RawConsoleDir:      "/raw,dir",
+			},
+			expect: []Argument{
+				RepeatableArg("chardev", "stdio,id=stdio,"+
+					"logfile=/raw,,dir/stdio.raw,logappend=off"),
+				RepeatableArg("chardev", "file,id=con0,path=/dev/fd/3,"+
+					"logfile=/raw,,dir/con0.raw,logappend=off"),
+			},
+			assert: assert.Subset,
+		},
 		{
 			name: "serial files virtio-mmio",
 			spec: CommandSpec{
@@ -119,6 +223,106 @@ func TestCommandSpec_Arguments(t *testing.T) {
 			},
 			assert: assert.Subset,
 		},
+		{
+			name: "log console after files",
+			spec: CommandSpec{
+				AdditionalConsoles: []string{
+					"/output/file1",
+				},
+				LogConsole:    true,
+				TransportType: TransportTypePCI,
+			},
+			expect: []Argument{
+				RepeatableArg("chardev", "file,id=con0,path=/dev/fd/3"),
+				RepeatableArg("device", "virtconsole,chardev=con0"),
+				RepeatableArg("chardev", "file,id=con1,path=/dev/fd/4"),
+				RepeatableArg("device", "virtconsole,chardev=con1"),
+			},
+			assert: assert.Subset,
+		},
+		{
+			name: "artifact and log console after files",
+			spec: CommandSpec{
+				AdditionalConsoles: []string{
+					"/output/file1",
+				},
+				ArtifactDir:   "/output/artifacts",
+				LogConsole:    true,
+				TransportType: TransportTypePCI,
+			},
+			expect: []Argument{
+				RepeatableArg("chardev", "file,id=con0,path=/dev/fd/3"),
+				RepeatableArg("device", "virtconsole,chardev=con0"),
+				RepeatableArg("chardev", "file,id=con1,"+
+					"path=/dev/fd/4,input-path=/dev/fd/5"),
+				RepeatableArg("device", "virtconsole,chardev=con1"),
+				RepeatableArg("chardev", "file,id=con2,path=/dev/fd/6"),
+				RepeatableArg("device", "virtconsole,chardev=con2"),
+			},
+			assert: assert.Subset,
+		},
+		{
+			name: "control console after log console",
+			spec: CommandSpec{
+				LogConsole:     true,
+				ControlConsole: true,
+				TransportType:  TransportTypePCI,
+			},
+			expect: []Argument{
+				RepeatableArg("chardev", "file,id=con0,path=/dev/fd/3"),
+				RepeatableArg("device", "virtconsole,chardev=con0"),
+				RepeatableArg("chardev", "file,id=control,"+
+					"path=/dev/fd/4,input-path=/dev/fd/5"),
+				RepeatableArg("device", "virtconsole,chardev=control"),
+			},
+			assert: assert.Subset,
+		},
+		{
+			name: "initramfs file",
+			spec: CommandSpec{
+				Initramfs:          "/tmp/initramfs.cpio",
+				InitramfsFile:      os.Stdin,
+				AdditionalConsoles: []string{"/output/file1"},
+				ControlConsole:     true,
+				TransportType:      TransportTypePCI,
+			},
+			expect: UniqueArg("initrd", "/dev/fd/6"),
+			assert: assert.Contains,
+		},
+		{
+			name: "virtiofs",
+			spec: CommandSpec{
+				Machine:       "q35",
+				Memory:        512,
+				TransportType: TransportTypePCI,
+				VirtioFS: []VirtioFS{
+					{Tag: "hostroot", Socket: "/tmp/virtiofsd.sock"},
+				},
+			},
+			expect: []Argument{
+				UniqueArg("machine", "q35,memory-backend=mem"),
+				RepeatableArg("object", "memory-backend-memfd,id=mem,"+
+					"size=512M,share=on"),
+				RepeatableArg("chardev", "socket,id=vfs0,"+
+					"path=/tmp/virtiofsd.sock"),
+				RepeatableArg("device", "vhost-user-fs-pci,chardev=vfs0,"+
+					"tag=hostroot"),
+			},
+			assert: assert.Subset,
+		},
+		{
+			name: "virtiofs virtio-mmio",
+			spec: CommandSpec{
+				Memory:        512,
+				TransportType: TransportTypeMMIO,
+				VirtioFS: []VirtioFS{
+					{Tag: "hostroot", Socket: "/tmp/virtiofsd.sock"},
+				},
+			},
+			expect: RepeatableArg("device", "vhost-user-fs-device,"+
+				"chardev=vfs0,tag=hostroot"),
+			assert: assert.Contains,
+		},
 		{
 			name: "serial files isa-pci",
 			spec: CommandSpec{
@@ -160,6 +364,84 @@ func TestNewCommand(t *testing.T) {
 				require.ErrorIs(t, err, &ArgumentError{})
 			},
 		},
+		{
+			name: "heartbeat timeout without control console",
+			spec: CommandSpec{
+				TransportType:    TransportTypePCI,
+				HeartbeatTimeout: time.Second,
+				ExitCodePrefix:   "rrr",
+			},
+			assertErr: func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, &ArgumentError{})
+			},
+		},
+		{
+			name: "uki without firmware",
+			spec: CommandSpec{
+				TransportType:  TransportTypePCI,
+				UKI:            true,
+				ExitCodePrefix: "rrr",
+			},
+			assertErr: func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, &ArgumentError{})
+			},
+		},
+		{
+			name: "virtiofs with isa transport",
+			spec: CommandSpec{
+				TransportType:  TransportTypeISA,
+				Memory:         256,
+				VirtioFS:       []VirtioFS{{Tag: "a", Socket: "/a.sock"}},
+				ExitCodePrefix: "rrr",
+			},
+			assertErr: func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, &ArgumentError{})
+			},
+		},
+		{
+			name: "virtiofs without memory",
+			spec: CommandSpec{
+				TransportType:  TransportTypePCI,
+				VirtioFS:       []VirtioFS{{Tag: "a", Socket: "/a.sock"}},
+				ExitCodePrefix: "rrr",
+			},
+			assertErr: func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, &ArgumentError{})
+			},
+		},
+		{
+			name: "reserved kernel param",
+			spec: CommandSpec{
+				TransportType:  TransportTypePCI,
+				KernelParams:   []string{"console=ttyS1"},
+				ExitCodePrefix: "rrr",
+			},
+			assertErr: func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, &ArgumentError{})
+			},
+		},
+		{
+			name: "append extra arg",
+			spec: CommandSpec{
+				TransportType:  TransportTypePCI,
+				ExtraArgs:      []Argument{RepeatableArg("append", "quiet")},
+				ExitCodePrefix: "rrr",
+			},
+			assertErr: func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, &ArgumentError{})
+			},
+		},
+		{
+			name: "invalid console file descriptor",
+			spec: CommandSpec{
+				TransportType:      TransportTypePCI,
+				AdditionalConsoles: []string{"fd:-1"},
+				ExitCodePrefix:     "rrr",
+			},
+			assertErr: func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, &ArgumentError{})
+			},
+		},
 		{
 			name: "with consoles",
 			spec: CommandSpec{
@@ -168,7 +450,7 @@ func TestNewCommand(t *testing.T) {
 				AdditionalConsoles: []string{"one"},
 				NoKVM:              true,
 				Verbose:            true,
-				ExitCodeFmt:        "rrr",
+				ExitCodePrefix:     "rrr",
 			},
 			expectedCmd: &Command{
 				cmd: exec.CommandContext(
@@ -192,8 +474,8 @@ func TestNewCommand(t *testing.T) {
 					"initcall_blacklist=ahci_pci_driver_init",
 				),
 				stdoutParser: stdoutParser{
-					ExitCodeFmt: "rrr",
-					Verbose:     true,
+					ExitCodePrefix: "rrr",
+					Verbose:        true,
 				},
 				consoleOutput: []string{"one"},
 			},
@@ -220,25 +502,25 @@ func TestCommand_Run(t *testing.T) {
 
 	tests := []struct {
 		name      string
-		cmd       Command
+		cmd       *Command
 		assertErr require.ErrorAssertionFunc
 	}{
 		{
 			name: "success no consoles",
-			cmd: Command{
-				cmd: exec.Command("echo", "rc: 0"),
+			cmd: &Command{
+				cmd: exec.Command("echo", protocol.FormatExitCode("rc", "", 0)),
 				stdoutParser: stdoutParser{
-					ExitCodeFmt: "rc: %d",
+					ExitCodePrefix: "rc",
 				},
 			},
 			assertErr: require.NoError,
 		},
 		{
 			name: "success with consoles",
-			cmd: Command{
-				cmd: exec.Command("echo", "rc: 0"),
+			cmd: &Command{
+				cmd: exec.Command("echo", protocol.FormatExitCode("rc", "", 0)),
 				stdoutParser: stdoutParser{
-					ExitCodeFmt: "rc: %d",
+					ExitCodePrefix: "rc",
 				},
 				consoleOutput: []string{
 					tempDir + "/out1",
@@ -251,10 +533,10 @@ func TestCommand_Run(t *testing.T) {
 		},
 		{
 			name: "fail with consoles",
-			cmd: Command{
-				cmd: exec.Command("echo", "rc: 42"),
+			cmd: &Command{
+				cmd: exec.Command("echo", protocol.FormatExitCode("rc", "", 42)),
 				stdoutParser: stdoutParser{
-					ExitCodeFmt: "rc: %d",
+					ExitCodePrefix: "rc",
 				},
 				consoleOutput: []string{
 					tempDir + "/out1",
@@ -270,9 +552,26 @@ func TestCommand_Run(t *testing.T) {
 				assert.Equal(t, ErrGuestNonZeroExitCode, cmdErr.Err)
 			},
 		},
+		{
+			name: "no heartbeat",
+			cmd: &Command{
+				cmd: exec.Command("sleep", "10"),
+				stdoutParser: stdoutParser{
+					ExitCodePrefix: "rc",
+				},
+				controlConsole:   true,
+				heartbeatTimeout: 50 * time.Millisecond,
+			},
+			assertErr: func(t require.TestingT, err error, _ ...any) {
+				var cmdErr *CommandError
+				require.ErrorAs(t, err, &cmdErr)
+				assert.True(t, cmdErr.Guest)
+				require.ErrorIs(t, err, pipe.ErrNoHeartbeat)
+			},
+		},
 		{
 			name: "start error with consoles",
-			cmd: Command{
+			cmd: &Command{
 				cmd: exec.Command("nonexistingprogramthatdoesnotexistanywhere"),
 				consoleOutput: []string{
 					tempDir + "/out1",
@@ -297,3 +596,48 @@ func TestCommand_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestCommand_Run_InitramfsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "initramfs")
+	marker := protocol.FormatExitCode("rc", "", 0) + "\n"
+	err := os.WriteFile(path, []byte(marker), 0o600)
+	require.NoError(t, err)
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = file.Close() })
+
+	// The file is the first additional file descriptor without consoles.
+	cmd := &Command{
+		cmd: exec.Command("cat",
+			(&CommandSpec{}).fdPath(minAdditionalFileDescriptor)),
+		stdoutParser:  stdoutParser{ExitCodePrefix: "rc"},
+		initramfsFile: file,
+	}
+
+	require.NoError(t, cmd.Run(nil, nil, nil))
+
+	_, err = file.Stat()
+	assert.NoError(t, err, "file must not be closed")
+}
+
+func TestCommand_Run_ProcessLimits(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// The exit code is printed only if the process inherited the nice value.
+	cmd := &Command{
+		cmd: exec.Command("sh", "-c",
+			"[ \"$(nice)\" = 19 ] && echo '"+
+				protocol.FormatExitCode("rc", "", 0)+"'"),
+		stdoutParser:  stdoutParser{ExitCodePrefix: "rc"},
+		processLimits: sys.ProcessLimits{Nice: 19},
+	}
+
+	require.NoError(t, cmd.Run(nil, nil, nil))
+}
+
+func TestCommand_Call_Unavailable(t *testing.T) {
+	err := (&Command{}).Call(context.Background(), "method", nil, nil)
+	assert.ErrorIs(t, err, ErrControlUnavailable)
+}
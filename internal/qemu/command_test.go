@@ -5,10 +5,12 @@
 package qemu_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/aibor/virtrun/internal/qemu"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCommmandAddExtraFile(t *testing.T) {
@@ -20,3 +22,59 @@ func TestCommmandAddExtraFile(t *testing.T) {
 	assert.Equal(t, "hvc2", d2)
 	assert.Equal(t, []string{"test", "real"}, s.AdditionalConsoles)
 }
+
+func TestCommandSpec_AddConsoleWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	s := qemu.CommandSpec{}
+	d1 := s.AddConsole("test")
+	d2 := s.AddConsoleWriter(&buf)
+
+	assert.Equal(t, "hvc1", d1)
+	assert.Equal(t, "hvc2", d2)
+	require.Len(t, s.AdditionalConsoles, 2)
+	assert.Same(t, &buf, s.ConsoleWriters[s.AdditionalConsoles[1]])
+}
+
+func TestCommandSpec_Consoles(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     qemu.CommandSpec
+		expected []qemu.Console
+	}{
+		{
+			name: "all",
+			spec: qemu.CommandSpec{
+				TransportType:      qemu.TransportTypePCI,
+				AdditionalConsoles: []string{"out.txt"},
+				ArtifactDir:        "artifacts",
+				LogConsole:         true,
+				ControlConsole:     true,
+			},
+			expected: []qemu.Console{
+				{Device: "hvc0", Output: "stdout"},
+				{Device: "hvc1", Output: "out.txt"},
+				{Device: "hvc2", Output: "artifacts"},
+				{Device: "hvc3", Output: "log"},
+				{Device: "hvc4", Output: "control"},
+			},
+		},
+		{
+			name: "stdout only",
+			spec: qemu.CommandSpec{
+				Machine:            "microvm",
+				TransportType:      qemu.TransportTypeISA,
+				AdditionalConsoles: []string{"out.txt"},
+			},
+			expected: []qemu.Console{
+				{Device: "ttyS0", Output: "stdout"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.spec.Consoles())
+		})
+	}
+}
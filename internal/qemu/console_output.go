@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ConsoleOutputStdout is the target of [CommandSpec.AdditionalConsoles]
+	// that writes the console output to the stdout writer of [Command.Run],
+	// along with the output of the default console.
+	ConsoleOutputStdout = "-"
+
+	// ConsoleOutputFDPrefix is the prefix of targets of
+	// [CommandSpec.AdditionalConsoles] that write the console output to an
+	// open file descriptor of the host process, like "fd:3".
+	ConsoleOutputFDPrefix = "fd:"
+
+	// consoleOutputWriterPrefix is the prefix of the targets of consoles
+	// added with [CommandSpec.AddConsoleWriter].
+	consoleOutputWriterPrefix = "writer:"
+)
+
+// parseConsoleOutputFD returns the file descriptor of the given target, if
+// it has the [ConsoleOutputFDPrefix].
+func parseConsoleOutputFD(target string) (int, bool, error) {
+	value, isFD := strings.CutPrefix(target, ConsoleOutputFDPrefix)
+	if !isFD {
+		return 0, false, nil
+	}
+
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		return 0, true, &ArgumentError{"invalid console file descriptor: " +
+			target}
+	}
+
+	return fd, true, nil
+}
+
+// openConsoleOutput returns the writer for the given target of
+// [CommandSpec.AdditionalConsoles] along with a closer that must be called
+// once the writer is no longer used. Writers for [ConsoleOutputStdout] write
+// to the given stdout.
+func openConsoleOutput(
+	target string,
+	writers map[string]io.Writer,
+	stdout io.Writer,
+) (io.Writer, io.Closer, error) {
+	if w, exists := writers[target]; exists {
+		return w, io.NopCloser(nil), nil
+	}
+
+	if target == ConsoleOutputStdout {
+		return stdout, io.NopCloser(nil), nil
+	}
+
+	fd, isFD, err := parseConsoleOutputFD(target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The file descriptor is duplicated, so closing the file once done does
+	// not close the file descriptor of the host process.
+	if isFD {
+		dup, err := unix.Dup(fd)
+		if err != nil {
+			return nil, nil, fmt.Errorf("dup %s: %w", target, err)
+		}
+
+		file := os.NewFile(uintptr(dup), target)
+
+		return file, file, nil
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("output file: %w", err)
+	}
+
+	return file, file, nil
+}
+
+// syncWriter serializes writes to w, so it can be shared by multiple console
+// processors.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.w.Write(data) //nolint:wrapcheck
+}
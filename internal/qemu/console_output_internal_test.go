@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenConsoleOutput(t *testing.T) {
+	tempDir := t.TempDir()
+
+	fdFile, err := os.Create(filepath.Join(tempDir, "fd"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = fdFile.Close() })
+
+	var stdout, writer bytes.Buffer
+
+	writers := map[string]io.Writer{"writer:1": &writer}
+
+	tests := []struct {
+		name      string
+		target    string
+		read      func(t *testing.T) string
+		assertErr require.ErrorAssertionFunc
+	}{
+		{
+			name:   "file",
+			target: filepath.Join(tempDir, "file"),
+			read: func(t *testing.T) string {
+				t.Helper()
+
+				data, err := os.ReadFile(filepath.Join(tempDir, "file"))
+				require.NoError(t, err)
+
+				return string(data)
+			},
+			assertErr: require.NoError,
+		},
+		{
+			name:      "stdout",
+			target:    ConsoleOutputStdout,
+			read:      func(*testing.T) string { return stdout.String() },
+			assertErr: require.NoError,
+		},
+		{
+			name:      "writer",
+			target:    "writer:1",
+			read:      func(*testing.T) string { return writer.String() },
+			assertErr: require.NoError,
+		},
+		{
+			name:   "file descriptor",
+			target: ConsoleOutputFDPrefix + strconv.Itoa(int(fdFile.Fd())),
+			read: func(t *testing.T) string {
+				t.Helper()
+
+				data, err := os.ReadFile(fdFile.Name())
+				require.NoError(t, err)
+
+				return string(data)
+			},
+			assertErr: require.NoError,
+		},
+		{
+			name:   "invalid file descriptor",
+			target: ConsoleOutputFDPrefix + "x",
+			assertErr: func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, &ArgumentError{})
+			},
+		},
+		{
+			name:      "closed file descriptor",
+			target:    ConsoleOutputFDPrefix + "999",
+			assertErr: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, closer, err := openConsoleOutput(tt.target, writers, &stdout)
+			tt.assertErr(t, err)
+
+			if err != nil {
+				return
+			}
+
+			_, err = io.WriteString(w, "output\n")
+			require.NoError(t, err)
+			require.NoError(t, closer.Close())
+
+			assert.Equal(t, "output\n", tt.read(t))
+		})
+	}
+
+	// The file descriptor of the process is still open.
+	_, err = fdFile.WriteString("more\n")
+	assert.NoError(t, err)
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 )
 
 type lineParseFunc func([]byte) []byte
@@ -55,15 +56,13 @@ func (p consoleProcessor) writeLn(data []byte) error {
 		return nil
 	}
 
-	_, err := p.dst.Write(data)
+	// The line is written at once, so it is not interleaved with lines of
+	// other processors writing to the same destination. The data is clipped,
+	// so appending does not overwrite data of the source buffer.
+	_, err := p.dst.Write(append(slices.Clip(data), '\n'))
 	if err != nil {
 		return fmt.Errorf("write data: %w", err)
 	}
 
-	_, err = p.dst.Write([]byte("\n"))
-	if err != nil {
-		return fmt.Errorf("write newline: %w", err)
-	}
-
 	return nil
 }
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"regexp"
+)
+
+// deviceNameRE matches the device name in the lines of the output of
+// "qemu-system-* -device help", like `name "virtio-serial-pci", bus PCI`.
+var deviceNameRE = regexp.MustCompile(`^\s*name "([^"]+)"`)
+
+// AvailableDevices returns the names of the devices the given QEMU binary
+// provides for the given machine type.
+func AvailableDevices(
+	ctx context.Context,
+	executable string,
+	machine string,
+) (map[string]bool, error) {
+	args := []string{"-device", "help"}
+	if machine != "" {
+		args = append(args, "-machine", machine)
+	}
+
+	output, err := exec.CommandContext(ctx, executable, args...).Output()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return parseDeviceHelp(output), nil
+}
+
+// parseDeviceHelp returns the device names of the given device help output.
+func parseDeviceHelp(output []byte) map[string]bool {
+	devices := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+
+	for scanner.Scan() {
+		match := deviceNameRE.FindStringSubmatch(scanner.Text())
+		if match != nil {
+			devices[match[1]] = true
+		}
+	}
+
+	return devices
+}
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeviceHelp(t *testing.T) {
+	output := `Controller/Bridge/Hub devices:
+name "pcie-root-port", bus PCI
+name "virtio-serial-pci", bus PCI, alias "virtio-serial"
+
+Input devices:
+name "isa-serial", bus ISA
+name "virtconsole", bus virtio-serial-bus
+`
+
+	expected := map[string]bool{
+		"pcie-root-port":    true,
+		"virtio-serial-pci": true,
+		"isa-serial":        true,
+		"virtconsole":       true,
+	}
+
+	assert.Equal(t, expected, parseDeviceHelp([]byte(output)))
+}
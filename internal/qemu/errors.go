@@ -7,9 +7,9 @@ package qemu
 import "errors"
 
 var (
-	// ErrGuestNoExitCodeFound is returned if no exit code matching the
-	// [Command.ExitCodeFmt] is printed by the guest and no other error is
-	// found.
+	// ErrGuestNoExitCodeFound is returned if no exit code with the
+	// [CommandSpec.ExitCodePrefix] is printed by the guest and no other error
+	// is found.
 	ErrGuestNoExitCodeFound = errors.New("guest did not print init exit code")
 
 	// ErrGuestPanic is returned if a kernel panic occurred in the guest
@@ -19,6 +19,14 @@ var (
 	// ErrGuestOom is returned if the guest system ran out of memory.
 	ErrGuestOom = errors.New("guest system ran out of memory")
 
+	// ErrGuestKernelReport is returned if the guest kernel reported a bug and
+	// the run is configured to fail on such reports.
+	ErrGuestKernelReport = errors.New("guest kernel reported a bug")
+
+	// ErrGuestOutputMatch is returned if a line of the guest's output matched
+	// a [FailOnMatch] filter.
+	ErrGuestOutputMatch = errors.New("guest output matched")
+
 	// ErrGuestNonZeroExitCode is returned if the guest did not return exit
 	// code 0.
 	ErrGuestNonZeroExitCode = errors.New("guest did not return exit code 0")
@@ -26,8 +34,16 @@ var (
 	// ErrTransportTypeInvalid is returned if a transport type is invalid.
 	ErrTransportTypeInvalid = errors.New("unknown transport type")
 
+	// ErrControlUnavailable is returned if a request is sent to the guest
+	// while the control console is not available.
+	ErrControlUnavailable = errors.New("control console not available")
+
 	// ErrArgumentCollision is returned if two [Argument]s are considered equal.
 	ErrArgumentCollision = errors.New("colliding args")
+
+	// ErrIDCollision is returned if two [Argument]s create QEMU objects with
+	// the same ID.
+	ErrIDCollision = errors.New("colliding ids")
 )
 
 // ArgumentError indicates an issue with an input argument.
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// fileCollector writes files sent by the guest into its directory.
+//
+// Files are expected as streams of the framed pipe protocol named by the
+// guest path of the file. The path is kept relative to the directory, so
+// "/tmp/report.xml" is written to "DIR/tmp/report.xml". Files within a guest
+// directory that has a redirect are written into the redirect's host
+// directory instead, relative to the guest directory. Existing files are
+// overwritten.
+type fileCollector struct {
+	dir string
+
+	// redirects maps guest directories to host directories.
+	redirects map[string]string
+
+	// received are the cleaned guest paths of all files received.
+	received []string
+}
+
+func newFileCollector(dir string, redirects map[string]string) *fileCollector {
+	return &fileCollector{dir: dir, redirects: redirects}
+}
+
+// receive writes all files read from src into the directory. Flow control
+// frames are written to dst, so the guest does not send faster than the files
+// are written.
+//
+// In case of an error, src is drained, so QEMU is not blocked.
+func (c *fileCollector) receive(src io.Reader, dst io.Writer) error {
+	conn := pipe.NewConn(dst)
+	conn.Open = c.open
+	conn.EnableFlowControl(pipe.DefaultWindowSize)
+
+	err := conn.Serve(src)
+	if err != nil {
+		_, _ = io.Copy(io.Discard, src)
+		return fmt.Errorf("receive: %w", err)
+	}
+
+	return nil
+}
+
+func (c *fileCollector) open(path string) (io.WriteCloser, error) {
+	path = sys.ConfinePath(path)
+	dst, redirected := c.redirect(path)
+
+	file, err := sys.CreateFile(dst)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	// Only files written into the directory are recorded as received.
+	if !redirected {
+		c.received = append(c.received, path)
+	}
+
+	return file, nil
+}
+
+// redirect returns the host path for the given cleaned absolute guest path.
+// It returns true if the path is within a redirected guest directory.
+func (c *fileCollector) redirect(path string) (string, bool) {
+	for guestDir, hostDir := range c.redirects {
+		rel, found := strings.CutPrefix(path, filepath.Clean(guestDir)+"/")
+		if found {
+			return filepath.Join(hostDir, rel), true
+		}
+	}
+
+	return filepath.Join(c.dir, path), false
+}
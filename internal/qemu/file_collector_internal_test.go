@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCollector_Receive(t *testing.T) {
+	tests := []struct {
+		name               string
+		files              map[string]string
+		trailer            []byte
+		redirect           string
+		expected           map[string]string
+		expectedRedirected map[string]string
+		expectedErr        error
+	}{
+		{
+			name: "files",
+			files: map[string]string{
+				"/tmp/report.xml":    "<report/>",
+				"/var/log/empty.log": "",
+			},
+			expected: map[string]string{
+				"tmp/report.xml":    "<report/>",
+				"var/log/empty.log": "",
+			},
+		},
+		{
+			name: "path outside of dir",
+			files: map[string]string{
+				"../../escape": "x",
+			},
+			expected: map[string]string{
+				"escape": "x",
+			},
+		},
+		{
+			name: "redirect",
+			files: map[string]string{
+				"/tmp/report.xml":           "<report/>",
+				"/tmp/cover/covmeta.1":      "meta",
+				"/tmp/cover/sub/covcounter": "counter",
+				"/tmp/coverage.out":         "mode: set",
+			},
+			redirect: "/tmp/cover/",
+			expected: map[string]string{
+				"tmp/report.xml":   "<report/>",
+				"tmp/coverage.out": "mode: set",
+			},
+			expectedRedirected: map[string]string{
+				"covmeta.1":      "meta",
+				"sub/covcounter": "counter",
+			},
+		},
+		{
+			name: "invalid",
+			files: map[string]string{
+				"/first": "x",
+			},
+			trailer: []byte("garbage that is drained"),
+			expected: map[string]string{
+				"first": "x",
+			},
+			expectedErr: pipe.ErrUnknownFrameType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input bytes.Buffer
+
+			writer := pipe.NewWriter(&input)
+			for name, content := range tt.files {
+				err := writer.SendStream(name, strings.NewReader(content))
+				require.NoError(t, err)
+			}
+
+			input.Write(tt.trailer)
+
+			dir := filepath.Join(t.TempDir(), "artifacts")
+			redirectDir := filepath.Join(t.TempDir(), "redirect")
+
+			var redirects map[string]string
+			if tt.redirect != "" {
+				redirects = map[string]string{tt.redirect: redirectDir}
+			}
+
+			collector := newFileCollector(dir, redirects)
+
+			err := collector.receive(&input, io.Discard)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Zero(t, input.Len(), "input drained")
+
+			assert.Equal(t, tt.expected, readFiles(t, dir))
+
+			if tt.expectedRedirected != nil {
+				assert.Equal(t, tt.expectedRedirected, readFiles(t, redirectDir))
+			}
+
+			var expectedReceived []string
+			for path := range tt.expected {
+				expectedReceived = append(expectedReceived, "/"+path)
+			}
+
+			assert.ElementsMatch(t, expectedReceived, collector.received)
+		})
+	}
+}
+
+// readFiles returns the content of all files in the given directory by their
+// path relative to the directory.
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+
+	err := filepath.WalkDir(dir, func(
+		path string,
+		entry os.DirEntry,
+		err error,
+	) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		files[rel] = string(data)
+
+		return err
+	})
+	require.NoError(t, err)
+
+	return files
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// idOptions are the options that set the IDs of the QEMU objects created by
+// an [Argument], by [Argument] name. Each name has its own ID namespace.
+var idOptions = map[string]string{
+	"object":   "id",
+	"netdev":   "id",
+	"chardev":  "id",
+	"device":   "id",
+	"blockdev": "node-name",
+}
+
+// IDRegistry tracks the IDs of QEMU objects created by [Argument]s, so
+// arguments created independently of each other, like built-in ones and
+// [CommandSpec.ExtraArgs], do not collide.
+//
+// The zero value is ready to use.
+type IDRegistry struct {
+	ids map[string]map[string]Argument
+}
+
+// Register adds the ID of the given [Argument]. It returns an
+// [ErrIDCollision] error if the ID is registered already for the same
+// [Argument] name. [Argument]s without ID are ignored.
+func (r *IDRegistry) Register(arg Argument) error {
+	id := arg.ID()
+	if id == "" {
+		return nil
+	}
+
+	if other, exists := r.ids[arg.name][id]; exists {
+		return fmt.Errorf("%w: %s, %s", ErrIDCollision, arg.String(), other)
+	}
+
+	if r.ids == nil {
+		r.ids = make(map[string]map[string]Argument)
+	}
+
+	if r.ids[arg.name] == nil {
+		r.ids[arg.name] = make(map[string]Argument)
+	}
+
+	r.ids[arg.name][id] = arg
+
+	return nil
+}
+
+// Registered returns true if the given ID is registered for the given
+// [Argument] name.
+func (r *IDRegistry) Registered(name, id string) bool {
+	_, exists := r.ids[name][id]
+	return exists
+}
+
+// escapeOption escapes the commas in the given QEMU option value, so it is
+// not split by them.
+func escapeOption(value string) string {
+	return strings.ReplaceAll(value, ",", ",,")
+}
+
+// splitOptions splits the given QEMU option string at commas. Double commas
+// are an escaped literal comma.
+func splitOptions(value string) []string {
+	var (
+		opts    []string
+		current strings.Builder
+	)
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != ',' {
+			current.WriteByte(value[i])
+			continue
+		}
+
+		if i+1 < len(value) && value[i+1] == ',' {
+			current.WriteByte(',')
+			i++
+
+			continue
+		}
+
+		opts = append(opts, current.String())
+		current.Reset()
+	}
+
+	return append(opts, current.String())
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// initArgsSeparator separates the kernel parameters from the
+// [CommandSpec.InitArgs] on the kernel command line.
+const initArgsSeparator = "--"
+
+// reservedKernelParams are the keys of the kernel parameters set by
+// [CommandSpec.KernelCmdline] that must not be overridden, as the command
+// depends on them.
+var reservedKernelParams = []string{"console", "panic"}
+
+// ParseKernelParams splits the given kernel command line into its parameters
+// and validates them with [ValidateKernelParam]. Parameters are separated by
+// whitespace. Values containing whitespace must be enclosed in double quotes,
+// like on the kernel command line.
+func ParseKernelParams(cmdline string) ([]string, error) {
+	var (
+		params  []string
+		current strings.Builder
+		quoted  bool
+	)
+
+	for _, r := range cmdline {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				params = append(params, current.String())
+				current.Reset()
+			}
+
+			continue
+		}
+
+		current.WriteRune(r)
+	}
+
+	if current.Len() > 0 {
+		params = append(params, current.String())
+	}
+
+	for _, param := range params {
+		err := ValidateKernelParam(param)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return params, nil
+}
+
+// ValidateKernelParam returns an [ArgumentError] if the given kernel
+// parameter can not be added to the kernel command line safely. This is the
+// case if it is empty, contains whitespace outside of double quotes, is the
+// separator of the init arguments or overrides a parameter the command
+// depends on, like "console" or "panic".
+func ValidateKernelParam(param string) error {
+	if param == "" {
+		return &ArgumentError{"empty kernel parameter"}
+	}
+
+	if param == initArgsSeparator {
+		return &ArgumentError{
+			"kernel parameter " + initArgsSeparator +
+				" is the init argument separator, use init args instead",
+		}
+	}
+
+	quoted := false
+
+	for _, r := range param {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			return &ArgumentError{
+				"kernel parameter with unquoted whitespace: " + param,
+			}
+		}
+	}
+
+	if quoted {
+		return &ArgumentError{"kernel parameter with unclosed quote: " + param}
+	}
+
+	key, _, _ := strings.Cut(param, "=")
+	if slices.Contains(reservedKernelParams, key) {
+		return &ArgumentError{"reserved kernel parameter: " + key}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu_test
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKernelParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		cmdline   string
+		expected  []string
+		assertErr require.ErrorAssertionFunc
+	}{
+		{
+			name:      "empty",
+			assertErr: require.NoError,
+		},
+		{
+			name:      "params",
+			cmdline:   " nokaslr\tloglevel=7  rd.debug ",
+			expected:  []string{"nokaslr", "loglevel=7", "rd.debug"},
+			assertErr: require.NoError,
+		},
+		{
+			name:      "quoted value",
+			cmdline:   `dyndbg="file a.c +p" nokaslr`,
+			expected:  []string{`dyndbg="file a.c +p"`, "nokaslr"},
+			assertErr: require.NoError,
+		},
+		{
+			name:      "similar to reserved",
+			cmdline:   "consoleblank=0 panic_on_warn=1",
+			expected:  []string{"consoleblank=0", "panic_on_warn=1"},
+			assertErr: require.NoError,
+		},
+		{
+			name:      "console",
+			cmdline:   "nokaslr console=ttyS1",
+			assertErr: argumentError,
+		},
+		{
+			name:      "panic",
+			cmdline:   "panic=0",
+			assertErr: argumentError,
+		},
+		{
+			name:      "init args separator",
+			cmdline:   "nokaslr -- -test.v",
+			assertErr: argumentError,
+		},
+		{
+			name:      "unclosed quote",
+			cmdline:   `dyndbg="file a.c +p`,
+			assertErr: argumentError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := qemu.ParseKernelParams(tt.cmdline)
+			tt.assertErr(t, err)
+
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestValidateKernelParam(t *testing.T) {
+	tests := []struct {
+		name      string
+		param     string
+		assertErr require.ErrorAssertionFunc
+	}{
+		{
+			name:      "valid",
+			param:     "nokaslr",
+			assertErr: require.NoError,
+		},
+		{
+			name:      "quoted whitespace",
+			param:     `VIRTRUN_ENV_FOO="a b"`,
+			assertErr: require.NoError,
+		},
+		{
+			name:      "empty",
+			assertErr: argumentError,
+		},
+		{
+			name:      "unquoted whitespace",
+			param:     "nokaslr quiet",
+			assertErr: argumentError,
+		},
+		{
+			name:      "console without value",
+			param:     "console",
+			assertErr: argumentError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertErr(t, qemu.ValidateKernelParam(tt.param))
+		})
+	}
+}
+
+func argumentError(t require.TestingT, err error, _ ...any) {
+	require.ErrorIs(t, err, &qemu.ArgumentError{})
+}
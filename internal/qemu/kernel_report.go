@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"regexp"
+)
+
+// Kinds of [KernelReport]s.
+const (
+	KernelReportOops    = "oops"
+	KernelReportWarning = "warning"
+	KernelReportLockdep = "lockdep"
+	KernelReportKASAN   = "kasan"
+	KernelReportUBSAN   = "ubsan"
+)
+
+// kernelReportLogLevel is the kernel console log level required for all
+// kinds of [KernelReport]s to show up in the console output. WARN_ON splats
+// and lockdep reports are printed with warning level.
+const kernelReportLogLevel = "5"
+
+// kernelReportREs match the first line of a [KernelReport] by kind. They are
+// checked in order, so more specific ones come first.
+var kernelReportREs = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{
+		kind: KernelReportKASAN,
+		re:   kernelLineRE(`BUG: KASAN: `),
+	},
+	{
+		kind: KernelReportUBSAN,
+		re:   kernelLineRE(`UBSAN: `),
+	},
+	{
+		kind: KernelReportLockdep,
+		re: kernelLineRE(`WARNING: (?:possible (?:circular|recursive) ` +
+			`locking|inconsistent lock state|suspicious RCU usage|` +
+			`possible irq lock inversion|bad unlock balance|` +
+			`lock held when returning)`),
+	},
+	{
+		kind: KernelReportWarning,
+		re:   kernelLineRE(`WARNING: CPU: \d+ PID: \d+ at `),
+	},
+	{
+		kind: KernelReportOops,
+		re: kernelLineRE(`(?:Oops: |kernel BUG at |BUG: unable to handle |` +
+			`BUG: kernel NULL pointer dereference)`),
+	},
+}
+
+// kernelLineRE returns a regular expression that matches kernel log lines
+// starting with the given expression, with or without timestamp.
+func kernelLineRE(expr string) *regexp.Regexp {
+	return regexp.MustCompile(`^(?:\[[0-9. ]+\] )?` + expr)
+}
+
+// KernelReport is a report of the guest kernel about a bug it detected, like
+// an Oops, a WARN_ON splat, a lockdep report or KASAN and UBSAN findings.
+type KernelReport struct {
+	// Kind is the kind of report, like [KernelReportOops].
+	Kind string `json:"kind"`
+
+	// Line is the first line of the report.
+	Line string `json:"line"`
+}
+
+// detectKernelReport returns the [KernelReport] the given line starts, if
+// any.
+func detectKernelReport(line string) (KernelReport, bool) {
+	for _, report := range kernelReportREs {
+		if report.re.MatchString(line) {
+			return KernelReport{Kind: report.kind, Line: line}, true
+		}
+	}
+
+	return KernelReport{}, false
+}
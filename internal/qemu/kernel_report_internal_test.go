@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectKernelReport(t *testing.T) {
+	tests := []struct {
+		line         string
+		expectedKind string
+	}{
+		{
+			line:         "[    2.345678] Oops: general protection fault, probably for non-canonical address 0xdead000000000100: 0000 [#1] PREEMPT SMP NOPTI", //nolint:lll
+			expectedKind: KernelReportOops,
+		},
+		{
+			line:         "[    2.345678] BUG: kernel NULL pointer dereference, address: 0000000000000008", //nolint:lll
+			expectedKind: KernelReportOops,
+		},
+		{
+			line:         "[    2.345678] kernel BUG at mm/slub.c:379!",
+			expectedKind: KernelReportOops,
+		},
+		{
+			line:         "[    1.234567] WARNING: CPU: 0 PID: 93 at drivers/foo/bar.c:42 foo_probe+0x2c/0x40 [foo]", //nolint:lll
+			expectedKind: KernelReportWarning,
+		},
+		{
+			line:         "[    1.234567] WARNING: possible circular locking dependency detected", //nolint:lll
+			expectedKind: KernelReportLockdep,
+		},
+		{
+			line:         "WARNING: suspicious RCU usage",
+			expectedKind: KernelReportLockdep,
+		},
+		{
+			line:         "[    3.141592] BUG: KASAN: slab-use-after-free in foo_release+0x1c/0x30 [foo]", //nolint:lll
+			expectedKind: KernelReportKASAN,
+		},
+		{
+			line:         "[    3.141592] UBSAN: array-index-out-of-bounds in drivers/foo/bar.c:17:9", //nolint:lll
+			expectedKind: KernelReportUBSAN,
+		},
+		{
+			line: "[    0.123456] Run /init as init process",
+		},
+		{
+			line: "test output mentioning WARNING: CPU: 0 PID: 1 at somewhere",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			report, found := detectKernelReport(tt.line)
+			if tt.expectedKind == "" {
+				assert.False(t, found)
+				return
+			}
+
+			require.True(t, found)
+			assert.Equal(t, tt.expectedKind, report.Kind)
+			assert.Equal(t, tt.line, report.Line)
+		})
+	}
+}
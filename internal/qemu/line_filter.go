@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// redactedReplacement replaces matches of [Redact] filters.
+const redactedReplacement = "[REDACTED]"
+
+// LineFilter is called with each line of the guest's stdout. It returns the
+// line to print, which may be modified, or nil to drop it. If it returns an
+// error, the run fails with this error, like it does for a kernel panic.
+// The output is processed further nevertheless.
+//
+// The line must not be retained or modified in place.
+type LineFilter func(line []byte) ([]byte, error)
+
+// FailOnMatch returns a [LineFilter] that fails the run with
+// [ErrGuestOutputMatch] if a line matches the given regular expression, like
+// "WARNING: suspicious RCU usage".
+func FailOnMatch(re *regexp.Regexp) LineFilter {
+	return func(line []byte) ([]byte, error) {
+		if re.Match(line) {
+			return line, fmt.Errorf("%w %s: %q", ErrGuestOutputMatch, re, line)
+		}
+
+		return line, nil
+	}
+}
+
+// Redact returns a [LineFilter] that replaces all matches of the given
+// regular expression, like secrets, in the printed lines.
+func Redact(re *regexp.Regexp) LineFilter {
+	return func(line []byte) ([]byte, error) {
+		return re.ReplaceAllLiteral(line, []byte(redactedReplacement)), nil
+	}
+}
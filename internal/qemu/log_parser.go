@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// logRecordParser decodes structured log records from the guest and logs them
+// with its logger.
+//
+// The records are expected as JSON lines as written by [slog.JSONHandler].
+// Time stamps of the records are dropped, as the guest clock is not
+// necessarily in sync with the host. Lines that can not be decoded are logged
+// as warning.
+type logRecordParser struct {
+	logger *slog.Logger
+}
+
+func newLogRecordParser(logger *slog.Logger) *logRecordParser {
+	return &logRecordParser{
+		logger: logger.With(slog.String("origin", "guest")),
+	}
+}
+
+// Parse can be used as [lineParseFunc]. It never returns any data.
+func (p *logRecordParser) Parse(data []byte) []byte {
+	var record map[string]any
+
+	err := json.Unmarshal(data, &record)
+	if err != nil {
+		p.logger.Warn("Undecodable guest log record",
+			slog.String("line", string(data)))
+
+		return nil
+	}
+
+	var level slog.Level
+
+	if levelStr, ok := record[slog.LevelKey].(string); ok {
+		_ = level.UnmarshalText([]byte(levelStr))
+	}
+
+	msg, _ := record[slog.MessageKey].(string)
+
+	delete(record, slog.TimeKey)
+	delete(record, slog.LevelKey)
+	delete(record, slog.MessageKey)
+
+	attrs := make([]slog.Attr, 0, len(record))
+
+	for _, key := range slices.Sorted(maps.Keys(record)) {
+		attrs = append(attrs, logAttr(key, record[key]))
+	}
+
+	p.logger.LogAttrs(context.Background(), level, msg, attrs...)
+
+	return nil
+}
+
+// logAttr creates a [slog.Attr] for the given decoded JSON value.
+//
+// Durations are encoded as nanoseconds by [slog.JSONHandler], so they are
+// converted back, if the key is "duration".
+func logAttr(key string, value any) slog.Attr {
+	if number, ok := value.(float64); ok && key == "duration" {
+		return slog.Duration(key, time.Duration(number))
+	}
+
+	return slog.Any(key, value)
+}
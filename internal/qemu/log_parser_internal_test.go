@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogRecordParser_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "info record",
+			//nolint:lll
+			input: `{"time":"2024-01-01T00:00:00Z","level":"INFO","msg":"phase done","phase":"mounts","duration":1500000}`,
+			//nolint:lll
+			expected: "level=INFO msg=\"phase done\" origin=guest duration=1.5ms phase=mounts\n",
+		},
+		{
+			name: "error record",
+			//nolint:lll
+			input: `{"level":"ERROR","msg":"phase done","phase":"modules","error":"load failed"}`,
+			//nolint:lll
+			expected: "level=ERROR msg=\"phase done\" origin=guest error=\"load failed\" phase=modules\n",
+		},
+		{
+			name:  "invalid",
+			input: "garbage",
+			//nolint:lll
+			expected: "level=WARN msg=\"Undecodable guest log record\" origin=guest line=garbage\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			logger := slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{
+				ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+					if a.Key == slog.TimeKey {
+						return slog.Attr{}
+					}
+
+					return a
+				},
+			}))
+
+			parser := newLogRecordParser(logger)
+
+			assert.Nil(t, parser.Parse([]byte(tt.input)))
+			assert.Equal(t, tt.expected, output.String())
+		})
+	}
+}
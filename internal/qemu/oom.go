@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// oomRE matches the line the OOM killer of the guest kernel prints, for
+	// the whole system as well as for memory cgroups.
+	oomRE = kernelLineRE(`(?:Memory cgroup o|O)ut of memory: `)
+
+	// oomKillRE matches the process killed by the OOM killer, as printed by
+	// current kernels ("Killed process") and older ones ("Kill process").
+	oomKillRE = kernelLineRE(`(?:Memory cgroup o|O)ut of memory: ` +
+		`Kill(?:ed)? process (\d+) \((.*?)\)(?:[ ,]|$)`)
+
+	// oomStatRE matches the memory stats of the killed process.
+	oomStatRE = regexp.MustCompile(`(total-vm|anon-rss|file-rss|shmem-rss):` +
+		`(\d+)kB`)
+)
+
+// GuestOOMError is returned if the OOM killer of the guest kernel killed a
+// process. It matches [ErrGuestOom] with [errors.Is]. The memory stats are the
+// ones of the killed process in kB, as printed by the kernel. They are zero,
+// if the kernel does not print them.
+type GuestOOMError struct {
+	PID      int
+	Process  string
+	TotalVM  uint64
+	AnonRSS  uint64
+	FileRSS  uint64
+	ShmemRSS uint64
+}
+
+// ParseOOMKill returns the [GuestOOMError] for the given kernel log line, if
+// it reports a process killed by the OOM killer.
+func ParseOOMKill(line string) (*GuestOOMError, bool) {
+	match := oomKillRE.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+
+	pid, err := strconv.Atoi(match[1])
+	if err != nil {
+		return nil, false
+	}
+
+	oomErr := &GuestOOMError{PID: pid, Process: match[2]}
+
+	stats := map[string]*uint64{
+		"total-vm":  &oomErr.TotalVM,
+		"anon-rss":  &oomErr.AnonRSS,
+		"file-rss":  &oomErr.FileRSS,
+		"shmem-rss": &oomErr.ShmemRSS,
+	}
+
+	for _, stat := range oomStatRE.FindAllStringSubmatch(line, -1) {
+		value, err := strconv.ParseUint(stat[2], 10, 64)
+		if err == nil {
+			*stats[stat[1]] = value
+		}
+	}
+
+	return oomErr, true
+}
+
+// Error implements the [error] interface.
+func (e *GuestOOMError) Error() string {
+	return fmt.Sprintf("%s: killed process %d (%s), total-vm: %dkB, "+
+		"anon-rss: %dkB, file-rss: %dkB, shmem-rss: %dkB",
+		ErrGuestOom, e.PID, e.Process, e.TotalVM, e.AnonRSS, e.FileRSS,
+		e.ShmemRSS)
+}
+
+// Is implements the [errors.Is] interface.
+func (*GuestOOMError) Is(other error) bool {
+	_, ok := other.(*GuestOOMError)
+	return ok
+}
+
+// Unwrap implements the [errors.Unwrap] interface.
+func (*GuestOOMError) Unwrap() error {
+	return ErrGuestOom
+}
@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOOMKill(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected *GuestOOMError
+	}{
+		{
+			name: "killed process",
+			line: "[    0.378083] Out of memory: Killed process 116 (main) " +
+				"total-vm:48156kB, anon-rss:43884kB, file-rss:4kB, " +
+				"shmem-rss:2924kB, UID:0 pgtables:140kB oom_score_adj:0",
+			expected: &GuestOOMError{
+				PID:      116,
+				Process:  "main",
+				TotalVM:  48156,
+				AnonRSS:  43884,
+				FileRSS:  4,
+				ShmemRSS: 2924,
+			},
+		},
+		{
+			name: "memory cgroup",
+			line: "[    1.000000] Memory cgroup out of memory: Killed process " +
+				"42 (stress (ng)) total-vm:1024kB, anon-rss:512kB, " +
+				"file-rss:0kB, shmem-rss:0kB, UID:0",
+			expected: &GuestOOMError{
+				PID:     42,
+				Process: "stress (ng)",
+				TotalVM: 1024,
+				AnonRSS: 512,
+			},
+		},
+		{
+			name: "old kernel",
+			line: "[    2.000000] Out of memory: Kill process 7 (main) " +
+				"score 900 or sacrifice child",
+			expected: &GuestOOMError{
+				PID:     7,
+				Process: "main",
+			},
+		},
+		{
+			name: "no kill",
+			line: "[    0.378012] oom-kill:constraint=CONSTRAINT_NONE," +
+				"task=main,pid=116,uid=0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, found := ParseOOMKill(tt.line)
+			assert.Equal(t, tt.expected != nil, found)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestGuestOOMError(t *testing.T) {
+	err := &GuestOOMError{
+		PID:     116,
+		Process: "main",
+		TotalVM: 48156,
+		AnonRSS: 43884,
+	}
+
+	require.ErrorIs(t, err, ErrGuestOom)
+	require.ErrorIs(t, err, &GuestOOMError{})
+	assert.EqualError(t, err, "guest system ran out of memory: killed "+
+		"process 116 (main), total-vm: 48156kB, anon-rss: 43884kB, "+
+		"file-rss: 0kB, shmem-rss: 0kB")
+}
+
+func TestStdoutParser_OOM(t *testing.T) {
+	kill := func(pid, process string) string {
+		return "[    1.000000] Out of memory: Killed process " + pid +
+			" (" + process + ") total-vm:1024kB, anon-rss:512kB"
+	}
+
+	tests := []struct {
+		name            string
+		lines           []string
+		expectedProcess string
+	}{
+		{
+			name:            "other process",
+			lines:           []string{kill("10", "stress")},
+			expectedProcess: "stress",
+		},
+		{
+			name:            "main process after other",
+			lines:           []string{kill("10", "stress"), kill("11", "main")},
+			expectedProcess: "main",
+		},
+		{
+			name:            "other process after main",
+			lines:           []string{kill("11", "main"), kill("10", "stress")},
+			expectedProcess: "main",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := stdoutParser{MainProcess: "main"}
+
+			for _, line := range tt.lines {
+				parser.Parse([]byte(line))
+			}
+
+			var oomErr *GuestOOMError
+
+			err := parser.GuestSuccessful()
+			require.ErrorAs(t, err, &oomErr)
+			assert.Equal(t, tt.expectedProcess, oomErr.Process)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// PhaseMarkerFmt is the format of the marker lines inserted into the output
+// of the guest at the start of each [Phase], if
+// [CommandSpec.PhaseMarkers] is set. The verbs are the phase and the time
+// elapsed since the start of QEMU.
+const PhaseMarkerFmt = "--- virtrun phase=%s elapsed=%s ---"
+
+// Phase is a lifecycle phase of the guest the output is attributed to.
+type Phase string
+
+const (
+	// PhaseBoot lasts from the start of QEMU until the init runs.
+	PhaseBoot Phase = "BOOT"
+
+	// PhaseInit lasts while the init sets up the system.
+	PhaseInit Phase = "INIT"
+
+	// PhaseMainStart lasts while the main binary runs.
+	PhaseMainStart Phase = "MAIN-START"
+
+	// PhaseMainEnd lasts from the return of the main binary until the exit
+	// code is communicated.
+	PhaseMainEnd Phase = "MAIN-END"
+
+	// PhaseShutdown lasts from the communication of the exit code until QEMU
+	// exits.
+	PhaseShutdown Phase = "SHUTDOWN"
+)
+
+// PhaseSpan is a [Phase] of the guest along with the lines of the output
+// attributed to it.
+type PhaseSpan struct {
+	// Phase is the lifecycle phase.
+	Phase Phase `json:"phase"`
+
+	// Elapsed is the time since the start of QEMU the phase started at.
+	Elapsed time.Duration `json:"elapsed"`
+
+	// FirstLine is the number of the first line of the output written in the
+	// phase, starting at 1. Marker lines are counted as well.
+	FirstLine int `json:"firstLine"`
+
+	// Lines is the number of lines of the output written in the phase.
+	Lines int `json:"lines"`
+}
+
+// phaseMarker returns the marker line for the given [Phase] started after
+// the given elapsed time. See [PhaseMarkerFmt].
+func phaseMarker(phase Phase, elapsed time.Duration) []byte {
+	return fmt.Appendf(nil, PhaseMarkerFmt, phase,
+		elapsed.Round(time.Millisecond))
+}
+
+// joinLines joins the given output lines with a newline. Nil lines are
+// skipped.
+func joinLines(first, second []byte) []byte {
+	switch {
+	case first == nil:
+		return second
+	case second == nil:
+		return first
+	default:
+		return bytes.Join([][]byte{first, second}, []byte("\n"))
+	}
+}
+
+// countLines returns the number of lines in the given output line, which may
+// be joined by [joinLines].
+func countLines(data []byte) int {
+	if data == nil {
+		return 0
+	}
+
+	return bytes.Count(data, []byte("\n")) + 1
+}
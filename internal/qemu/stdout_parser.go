@@ -5,26 +5,64 @@
 package qemu
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
-)
+	"time"
 
-var (
-	panicRE = regexp.MustCompile(`^\[[0-9. ]+\] Kernel panic - not syncing: `)
-	oomRE   = regexp.MustCompile(`^\[[0-9. ]+\] Out of memory: `)
+	"github.com/aibor/virtrun/protocol"
 )
 
+var panicRE = regexp.MustCompile(`^\[[0-9. ]+\] Kernel panic - not syncing: `)
+
+// StateChange is a state notification of the guest.
+type StateChange struct {
+	// State is the name of the state the guest communicated.
+	State string `json:"state"`
+
+	// Elapsed is the time since the start of QEMU.
+	Elapsed time.Duration `json:"elapsed"`
+}
+
 // stdoutParser provides a parser that parses stdout from the guest.
 //
 // It detects kernel panics, OOM messages and most importantly it detects the
-// exit code communicated by the guest via stdout. The processor stops when
+// exit code communicated by the guest via stdout. Processes killed by the OOM
+// killer are reported as [GuestOOMError]. The kill of MainProcess takes
+// precedence over kills of other processes. The processor stops when
 // the src is closed. After use, the result can be retrieved by calling
 // [stdoutParser.Err]. It returns a [CommandError] with Guest flag set if either
 // an error is detected or the guest communicated a non zero exit code.
+//
+// If NotifyFmt is set, state notifications of the guest are removed from the
+// output and logged along with the time elapsed since start. StateHandler is
+// called with each state, if set. The Filters are applied to each line in
+// order. See [LineFilter]. [KernelReport]s are recorded and fail the run if
+// FailOnKernelReport is set.
+//
+// Each line written is attributed to a [Phase]. States in PhaseStates start
+// the phase they map to and the exit code starts [PhaseShutdown]. If
+// PhaseMarkers is set, a marker line is inserted at the start of each phase.
 type stdoutParser struct {
-	ExitCodeFmt string
-	Verbose     bool
+	ExitCodePrefix     string
+	ExitCodeNonce      string
+	MainProcess        string
+	NotifyFmt          string
+	Verbose            bool
+	StateHandler       func(state string)
+	Filters            []LineFilter
+	FailOnKernelReport bool
+	PhaseStates        map[string]Phase
+	PhaseMarkers       bool
 
+	start         time.Time
+	lastState     string
+	states        []StateChange
+	phases        []PhaseSpan
+	nextPhase     Phase
+	lines         int
+	reports       []KernelReport
 	exitCodeFound bool
 	exitCode      int
 	err           error
@@ -32,6 +70,83 @@ type stdoutParser struct {
 
 // Parse can be used as [lineParseFunc].
 func (p *stdoutParser) Parse(data []byte) []byte {
+	var marker []byte
+
+	if p.phases == nil {
+		marker = p.startPhase(PhaseBoot)
+	}
+
+	out := p.parse(data)
+
+	// Filters see the lines that are not printed as well, so matches fail the
+	// run even after the exit code has been found.
+	if out == nil {
+		_ = p.filter(data)
+	} else {
+		out = p.filter(out)
+	}
+
+	p.addLines(countLines(out))
+	out = joinLines(marker, out)
+
+	// The line that started a new phase is attributed to the previous one,
+	// so the marker follows it.
+	if p.nextPhase != "" {
+		out = joinLines(out, p.startPhase(p.nextPhase))
+		p.nextPhase = ""
+	}
+
+	return out
+}
+
+// startPhase records the start of the given [Phase]. It returns the marker
+// line for it, if PhaseMarkers is set.
+func (p *stdoutParser) startPhase(phase Phase) []byte {
+	elapsed := time.Since(p.start)
+
+	p.phases = append(p.phases, PhaseSpan{
+		Phase:     phase,
+		Elapsed:   elapsed,
+		FirstLine: p.lines + 1,
+	})
+
+	if !p.PhaseMarkers {
+		return nil
+	}
+
+	marker := phaseMarker(phase, elapsed)
+	p.addLines(1)
+
+	return marker
+}
+
+// addLines attributes the given number of written lines to the current
+// [Phase].
+func (p *stdoutParser) addLines(count int) {
+	p.lines += count
+	p.phases[len(p.phases)-1].Lines += count
+}
+
+// filter applies the Filters to the given line. The first error of any filter
+// is recorded as guest error, unless there is one already.
+func (p *stdoutParser) filter(data []byte) []byte {
+	for _, filter := range p.Filters {
+		if data == nil {
+			break
+		}
+
+		var err error
+
+		data, err = filter(data)
+		if err != nil && p.err == nil {
+			p.err = err
+		}
+	}
+
+	return data
+}
+
+func (p *stdoutParser) parse(data []byte) []byte {
 	line := string(data)
 
 	// Parse the output. Keep going after a match has been found, so
@@ -39,14 +154,21 @@ func (p *stdoutParser) Parse(data []byte) []byte {
 	// information in case of kernel error messages.
 	switch {
 	case oomRE.MatchString(line):
-		p.err = ErrGuestOom
+		p.recordOOM(line)
 		return data
 	case panicRE.MatchString(line):
 		p.err = ErrGuestPanic
 		return data
+	case p.recordKernelReport(line):
+		return data
+	case p.isNotification(line):
+		return p.parseNotification(line)
 	case !p.exitCodeFound:
-		_, err := fmt.Sscanf(line, p.ExitCodeFmt, &p.exitCode)
-		p.exitCodeFound = err == nil
+		p.exitCode, p.exitCodeFound = protocol.ParseExitCode(p.ExitCodePrefix,
+			p.ExitCodeNonce, line)
+		if p.exitCodeFound {
+			p.nextPhase = PhaseShutdown
+		}
 	}
 
 	// Skip line printing once the guest exit code has been found unless the
@@ -58,6 +180,91 @@ func (p *stdoutParser) Parse(data []byte) []byte {
 	return data
 }
 
+// recordOOM records the error for the given OOM killer line, unless the
+// MainProcess was killed already.
+func (p *stdoutParser) recordOOM(line string) {
+	var current *GuestOOMError
+	if errors.As(p.err, &current) && current.Process == p.MainProcess {
+		return
+	}
+
+	oomErr, found := ParseOOMKill(line)
+	if !found {
+		if current == nil {
+			p.err = ErrGuestOom
+		}
+
+		return
+	}
+
+	slog.Warn("Guest process killed by OOM killer",
+		slog.Int("pid", oomErr.PID),
+		slog.String("process", oomErr.Process),
+	)
+
+	p.err = oomErr
+}
+
+// recordKernelReport records the [KernelReport] the given line starts, if
+// any.
+func (p *stdoutParser) recordKernelReport(line string) bool {
+	report, found := detectKernelReport(line)
+	if !found {
+		return false
+	}
+
+	p.reports = append(p.reports, report)
+
+	slog.Warn("Guest kernel report",
+		slog.String("kind", report.Kind),
+		slog.String("line", report.Line),
+	)
+
+	if p.FailOnKernelReport && p.err == nil {
+		p.err = fmt.Errorf("%w: %s", ErrGuestKernelReport, report.Kind)
+	}
+
+	return true
+}
+
+func (p *stdoutParser) isNotification(line string) bool {
+	_, _, found := protocol.CutNotification(p.NotifyFmt, line)
+	return found
+}
+
+// parseNotification records the state notification in the given line. The
+// notification may follow output that did not end with a newline. This
+// output is returned, the notification itself is not.
+func (p *stdoutParser) parseNotification(line string) []byte {
+	before, state, _ := protocol.CutNotification(p.NotifyFmt, line)
+
+	if state != "" {
+		elapsed := time.Since(p.start)
+
+		p.lastState = state
+		p.states = append(p.states, StateChange{State: state, Elapsed: elapsed})
+
+		slog.Debug("Guest state",
+			slog.String("state", state),
+			slog.Duration("elapsed", elapsed),
+		)
+		if p.StateHandler != nil {
+			p.StateHandler(state)
+		}
+
+		phase, exists := p.PhaseStates[state]
+		if exists && phase != p.phases[len(p.phases)-1].Phase {
+			p.nextPhase = phase
+		}
+	}
+
+	if before == "" {
+		return nil
+	}
+
+	return []byte(before)
+}
+
 // GuestSuccessful returns nil if the guest ran successfully.
 //
 // Otherwise, it returns a [CommandError] with the guest flag set.
@@ -66,6 +273,9 @@ func (p *stdoutParser) GuestSuccessful() error {
 
 	if err == nil {
 		switch {
+		case !p.exitCodeFound && p.lastState != "":
+			err = fmt.Errorf("%w (last state: %s)",
+				ErrGuestNoExitCodeFound, p.lastState)
 		case !p.exitCodeFound:
 			err = ErrGuestNoExitCodeFound
 		case p.exitCode != 0:
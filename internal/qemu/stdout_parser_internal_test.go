@@ -6,13 +6,19 @@ package qemu
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/aibor/virtrun/protocol"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStdoutParser_Process(t *testing.T) {
-	exitCodeFmt := "exit code: %d"
+	exitCodePrefix := "exit code"
+	exitCodeNonce := "nonce"
+	notifyFmt := "notify: %s"
 
 	tests := []struct {
 		name                string
@@ -20,6 +26,8 @@ func TestStdoutParser_Process(t *testing.T) {
 		input               []string
 		expected            []string
 		expectedExitCode    int
+		expectedLastState   string
+		expectedStates      []string
 		assertExitCodeFound assert.BoolAssertionFunc
 	}{
 		{
@@ -56,7 +64,7 @@ func TestStdoutParser_Process(t *testing.T) {
 			name: "zero exit code",
 			input: []string{
 				"something out",
-				fmt.Sprintf(exitCodeFmt, 0),
+				protocol.FormatExitCode(exitCodePrefix, exitCodeNonce, 0),
 				"more after",
 			},
 			expected: []string{
@@ -70,12 +78,12 @@ func TestStdoutParser_Process(t *testing.T) {
 			verbose: true,
 			input: []string{
 				"something out",
-				fmt.Sprintf(exitCodeFmt, 0),
+				protocol.FormatExitCode(exitCodePrefix, exitCodeNonce, 0),
 				"more after",
 			},
 			expected: []string{
 				"something out",
-				fmt.Sprintf(exitCodeFmt, 0),
+				protocol.FormatExitCode(exitCodePrefix, exitCodeNonce, 0),
 				"more after",
 			},
 			expectedExitCode:    0,
@@ -85,7 +93,7 @@ func TestStdoutParser_Process(t *testing.T) {
 			name: "non zero exit code",
 			input: []string{
 				"something out",
-				fmt.Sprintf(exitCodeFmt, 4),
+				protocol.FormatExitCode(exitCodePrefix, exitCodeNonce, 4),
 				"more after",
 			},
 			expected: []string{
@@ -99,17 +107,29 @@ func TestStdoutParser_Process(t *testing.T) {
 			verbose: true,
 			input: []string{
 				"something out",
-				fmt.Sprintf(exitCodeFmt, 4),
+				protocol.FormatExitCode(exitCodePrefix, exitCodeNonce, 4),
 				"more after",
 			},
 			expected: []string{
 				"something out",
-				fmt.Sprintf(exitCodeFmt, 4),
+				protocol.FormatExitCode(exitCodePrefix, exitCodeNonce, 4),
 				"more after",
 			},
 			expectedExitCode:    4,
 			assertExitCodeFound: assert.True,
 		},
+		{
+			name: "exit code of other run",
+			input: []string{
+				"something out",
+				protocol.FormatExitCode(exitCodePrefix, "other", 0),
+			},
+			expected: []string{
+				"something out",
+				protocol.FormatExitCode(exitCodePrefix, "other", 0),
+			},
+			assertExitCodeFound: assert.False,
+		},
 		{
 			name: "no exit code",
 			input: []string{
@@ -122,15 +142,37 @@ func TestStdoutParser_Process(t *testing.T) {
 			},
 			assertExitCodeFound: assert.False,
 		},
+		{
+			name: "notifications",
+			input: []string{
+				fmt.Sprintf(notifyFmt, "booted"),
+				"something out",
+				"no newline" + fmt.Sprintf(notifyFmt, "main-finished"),
+			},
+			expected: []string{
+				"something out",
+				"no newline",
+			},
+			expectedLastState:   "main-finished",
+			expectedStates:      []string{"booted", "main-finished"},
+			assertExitCodeFound: assert.False,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var actual []string
 
+			var handled []string
+
 			stdoutParser := stdoutParser{
-				Verbose:     tt.verbose,
-				ExitCodeFmt: exitCodeFmt,
+				Verbose:        tt.verbose,
+				ExitCodePrefix: exitCodePrefix,
+				ExitCodeNonce:  exitCodeNonce,
+				NotifyFmt:      notifyFmt,
+				StateHandler: func(state string) {
+					handled = append(handled, state)
+				},
 			}
 
 			for _, line := range tt.input {
@@ -143,6 +185,201 @@ func TestStdoutParser_Process(t *testing.T) {
 			tt.assertExitCodeFound(t, stdoutParser.exitCodeFound, "exit code found")
 			assert.Equal(t, tt.expectedExitCode, stdoutParser.exitCode, "exit code")
 			assert.Equal(t, tt.expected, actual, "output")
+			assert.Equal(t, tt.expectedLastState, stdoutParser.lastState, "state")
+
+			var states []string
+			for _, change := range stdoutParser.states {
+				states = append(states, change.State)
+			}
+
+			assert.Equal(t, tt.expectedStates, states, "states")
+			assert.Equal(t, tt.expectedStates, handled, "handled states")
+		})
+	}
+}
+
+func TestStdoutParser_GuestSuccessful(t *testing.T) {
+	tests := []struct {
+		name        string
+		parser      stdoutParser
+		expectedErr error
+		expectedMsg string
+	}{
+		{
+			name: "success",
+			parser: stdoutParser{
+				exitCodeFound: true,
+			},
+		},
+		{
+			name: "no exit code",
+			parser: stdoutParser{
+				lastState: "main-started",
+			},
+			expectedErr: ErrGuestNoExitCodeFound,
+			expectedMsg: "qemu guest: guest did not print init exit code " +
+				"(last state: main-started)",
+		},
+		{
+			name: "panic",
+			parser: stdoutParser{
+				lastState: "main-started",
+				err:       ErrGuestPanic,
+			},
+			expectedErr: ErrGuestPanic,
+			expectedMsg: "qemu guest: guest system panicked",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.parser.GuestSuccessful()
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.EqualError(t, err, tt.expectedMsg)
+		})
+	}
+}
+
+func TestStdoutParser_Filters(t *testing.T) {
+	stdoutParser := stdoutParser{
+		ExitCodePrefix: "exit code",
+		Filters: []LineFilter{
+			FailOnMatch(regexp.MustCompile(`suspicious RCU usage`)),
+			Redact(regexp.MustCompile(`token=\w+`)),
+			func(line []byte) ([]byte, error) {
+				if strings.HasPrefix(string(line), "noise") {
+					return nil, nil
+				}
+
+				return line, nil
+			},
+		},
+	}
+
+	input := []string{
+		"login with token=secret",
+		"noise",
+		protocol.FormatExitCode("exit code", "", 0),
+		"[    1.000000] rcu: suspicious RCU usage in test",
+	}
+
+	var actual []string
+
+	for _, line := range input {
+		out := stdoutParser.Parse([]byte(line))
+		if out != nil {
+			actual = append(actual, string(out))
+		}
+	}
+
+	// Lines after the exit code are not printed, but still fail the run.
+	assert.Equal(t, []string{"login with [REDACTED]"}, actual, "output")
+	assert.True(t, stdoutParser.exitCodeFound, "exit code found")
+
+	err := stdoutParser.GuestSuccessful()
+	require.ErrorIs(t, err, ErrGuestOutputMatch)
+	assert.ErrorContains(t, err, "suspicious RCU usage")
+}
+
+func TestStdoutParser_Phases(t *testing.T) {
+	input := []string{
+		"[    0.100000] kernel boot",
+		"notify: booted",
+		"setting up",
+		"notify: setup-done",
+		"notify: main-started",
+		"main outputnotify: main-finished",
+		protocol.FormatExitCode("exit code", "", 0),
+		"[    2.000000] reboot: Power down",
+	}
+
+	for _, markers := range []bool{false, true} {
+		t.Run(fmt.Sprintf("markers %t", markers), func(t *testing.T) {
+			stdoutParser := stdoutParser{
+				ExitCodePrefix: "exit code",
+				NotifyFmt:      "notify: %s",
+				PhaseStates: map[string]Phase{
+					"booted":        PhaseInit,
+					"setup-done":    PhaseInit,
+					"main-started":  PhaseMainStart,
+					"main-finished": PhaseMainEnd,
+				},
+				PhaseMarkers: markers,
+			}
+
+			var actual []string
+
+			for _, line := range input {
+				out := stdoutParser.Parse([]byte(line))
+				if out != nil {
+					actual = append(actual, strings.Split(string(out), "\n")...)
+				}
+			}
+
+			var phases []Phase
+
+			lines := 0
+
+			for _, span := range stdoutParser.phases {
+				assert.Equal(t, lines+1, span.FirstLine, span.Phase)
+
+				if markers {
+					assert.Regexp(t, "^--- virtrun phase="+string(span.Phase)+
+						" elapsed=.* ---$", actual[span.FirstLine-1])
+				}
+
+				phases = append(phases, span.Phase)
+				lines += span.Lines
+			}
+
+			expected := []Phase{
+				PhaseBoot,
+				PhaseInit,
+				PhaseMainStart,
+				PhaseMainEnd,
+				PhaseShutdown,
+			}
+			assert.Equal(t, expected, phases)
+			assert.Len(t, actual, lines)
+		})
+	}
+}
+
+func TestStdoutParser_KernelReports(t *testing.T) {
+	input := []string{
+		"[    1.234567] WARNING: CPU: 0 PID: 93 at foo.c:42 foo_probe+0x2c/0x40",
+		protocol.FormatExitCode("exit code", "", 0),
+	}
+
+	for _, fail := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fail %t", fail), func(t *testing.T) {
+			stdoutParser := stdoutParser{
+				ExitCodePrefix:     "exit code",
+				FailOnKernelReport: fail,
+			}
+
+			for _, line := range input {
+				_ = stdoutParser.Parse([]byte(line))
+			}
+
+			expected := []KernelReport{
+				{Kind: KernelReportWarning, Line: input[0]},
+			}
+			assert.Equal(t, expected, stdoutParser.reports)
+
+			err := stdoutParser.GuestSuccessful()
+			if !fail {
+				assert.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrGuestKernelReport)
+			assert.ErrorContains(t, err, KernelReportWarning)
 		})
 	}
 }
@@ -71,3 +71,51 @@ func (t *TransportType) ConsoleDeviceName(num uint) string {
 
 	return fmt.Sprintf(f, num)
 }
+
+// Device returns the name of the QEMU device the [TransportType] requires.
+func (t *TransportType) Device() string {
+	switch *t {
+	case TransportTypeISA:
+		return "isa-serial"
+	case TransportTypePCI:
+		return "virtio-serial-pci"
+	case TransportTypeMMIO:
+		return "virtio-serial-device"
+	default:
+		return ""
+	}
+}
+
+// KernelConfigOptions returns the kernel build configuration options the
+// guest kernel requires for the [TransportType].
+func (t *TransportType) KernelConfigOptions() []string {
+	switch *t {
+	case TransportTypeISA:
+		return []string{"CONFIG_SERIAL_8250", "CONFIG_SERIAL_8250_CONSOLE"}
+	case TransportTypePCI:
+		return []string{"CONFIG_VIRTIO_PCI", "CONFIG_VIRTIO_CONSOLE"}
+	case TransportTypeMMIO:
+		return []string{"CONFIG_VIRTIO_MMIO", "CONFIG_VIRTIO_CONSOLE"}
+	default:
+		return nil
+	}
+}
+
+// TransportTypesFor returns the [TransportType]s that work with the given
+// machine type in order of preference. See [CommandSpec.Validate].
+func TransportTypesFor(machine string) []TransportType {
+	switch machine {
+	case "microvm":
+		return []TransportType{TransportTypeMMIO, TransportTypeISA}
+	case "virt":
+		return []TransportType{TransportTypeMMIO, TransportTypePCI}
+	case "q35", "pc":
+		return []TransportType{TransportTypePCI, TransportTypeISA}
+	default:
+		return []TransportType{
+			TransportTypePCI,
+			TransportTypeMMIO,
+			TransportTypeISA,
+		}
+	}
+}
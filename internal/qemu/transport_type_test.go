@@ -107,3 +107,98 @@ func TestTransportType_Set(t *testing.T) {
 		})
 	}
 }
+
+func TestTransportType_Device(t *testing.T) {
+	tests := []struct {
+		input    qemu.TransportType
+		expected string
+	}{
+		{
+			input:    qemu.TransportTypeISA,
+			expected: "isa-serial",
+		},
+		{
+			input:    qemu.TransportTypePCI,
+			expected: "virtio-serial-pci",
+		},
+		{
+			input:    qemu.TransportTypeMMIO,
+			expected: "virtio-serial-device",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input.String(), func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.input.Device())
+		})
+	}
+}
+
+func TestTransportType_KernelConfigOptions(t *testing.T) {
+	tests := []struct {
+		input    qemu.TransportType
+		expected []string
+	}{
+		{
+			input:    qemu.TransportTypeISA,
+			expected: []string{"CONFIG_SERIAL_8250", "CONFIG_SERIAL_8250_CONSOLE"},
+		},
+		{
+			input:    qemu.TransportTypePCI,
+			expected: []string{"CONFIG_VIRTIO_PCI", "CONFIG_VIRTIO_CONSOLE"},
+		},
+		{
+			input:    qemu.TransportTypeMMIO,
+			expected: []string{"CONFIG_VIRTIO_MMIO", "CONFIG_VIRTIO_CONSOLE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input.String(), func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.input.KernelConfigOptions())
+		})
+	}
+}
+
+func TestTransportTypesFor(t *testing.T) {
+	tests := []struct {
+		machine  string
+		expected []qemu.TransportType
+	}{
+		{
+			machine: "microvm",
+			expected: []qemu.TransportType{
+				qemu.TransportTypeMMIO,
+				qemu.TransportTypeISA,
+			},
+		},
+		{
+			machine: "virt",
+			expected: []qemu.TransportType{
+				qemu.TransportTypeMMIO,
+				qemu.TransportTypePCI,
+			},
+		},
+		{
+			machine: "q35",
+			expected: []qemu.TransportType{
+				qemu.TransportTypePCI,
+				qemu.TransportTypeISA,
+			},
+		},
+		{
+			machine: "custom",
+			expected: []qemu.TransportType{
+				qemu.TransportTypePCI,
+				qemu.TransportTypeMMIO,
+				qemu.TransportTypeISA,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.machine, func(t *testing.T) {
+			assert.Equal(t, tt.expected, qemu.TransportTypesFor(tt.machine))
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package qemu
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// virtioFSMemoryBackend is the id of the memory backend the guest memory is
+// allocated from, if [CommandSpec.VirtioFS] is set.
+const virtioFSMemoryBackend = "mem"
+
+// VirtioFS is a host directory shared with the guest via a vhost-user-fs
+// device. The directory is served by a virtiofsd process listening on the
+// socket.
+type VirtioFS struct {
+	// Tag is the name the guest mounts the file system by.
+	Tag string
+
+	// Socket is the path of the vhost-user socket of virtiofsd.
+	Socket string
+}
+
+// Device returns the name of the vhost-user-fs device for the given
+// [TransportType].
+func (v *VirtioFS) Device(transportType TransportType) string {
+	if transportType == TransportTypeMMIO {
+		return "vhost-user-fs-device"
+	}
+
+	return "vhost-user-fs-pci"
+}
+
+// virtioFSArgs returns the arguments for the file systems shared via
+// [CommandSpec.VirtioFS]. vhost-user requires the guest memory to be shared
+// with virtiofsd.
+func (c *CommandSpec) virtioFSArgs() []Argument {
+	if len(c.VirtioFS) == 0 {
+		return nil
+	}
+
+	args := []Argument{
+		ObjectArg("memory-backend-memfd", virtioFSMemoryBackend,
+			"size="+strconv.FormatUint(c.Memory, 10)+"M",
+			"share=on",
+		),
+	}
+
+	for idx, fs := range c.VirtioFS {
+		id := fmt.Sprintf("vfs%d", idx)
+		args = append(args,
+			RepeatableArg("chardev", "socket", "id="+id, "path="+fs.Socket),
+			RepeatableArg("device", fs.Device(c.TransportType),
+				"chardev="+id, "tag="+fs.Tag),
+		)
+	}
+
+	return args
+}
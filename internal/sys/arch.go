@@ -6,8 +6,11 @@ package sys
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"runtime"
+
+	"golang.org/x/sys/unix"
 )
 
 type Arch string
@@ -16,9 +19,23 @@ const (
 	AMD64   Arch = "amd64"
 	ARM64   Arch = "arm64"
 	RISCV64 Arch = "riscv64"
+	S390X   Arch = "s390x"
+	MIPS64  Arch = "mips64"
 	Native  Arch = Arch(runtime.GOARCH)
 )
 
+// KVMDevice is the path of the KVM device.
+const KVMDevice = "/dev/kvm"
+
+// kvmAPIVersion is the stable KVM API version, see linux/kvm.h.
+const kvmAPIVersion = 12
+
+// KVM ioctl request numbers, see linux/kvm.h.
+const (
+	kvmGetAPIVersion = 0xae00
+	kvmCreateVM      = 0xae01
+)
+
 var ErrArchNotSupported = errors.New("architecture not supported")
 
 func (a *Arch) String() string {
@@ -29,21 +46,64 @@ func (a *Arch) IsNative() bool {
 	return Native == *a
 }
 
+// IsBigEndian returns true if the architecture is big-endian.
+func (a *Arch) IsBigEndian() bool {
+	return *a == S390X || *a == MIPS64
+}
+
 // KVMAvailable checks if KVM support is available for the given architecture.
+// See [Arch.CheckKVM].
 func (a *Arch) KVMAvailable() bool {
+	return a.CheckKVM() == nil
+}
+
+// CheckKVM returns an error if KVM can not run guests of the given
+// architecture. KVM runs guests of the native architecture only, so guests of
+// other architectures must be emulated. Besides, [KVMDevice] must be
+// accessible and able to create virtual machines, which is not the case in
+// virtual machines without nested virtualization, for example.
+func (a *Arch) CheckKVM() error {
 	if !a.IsNative() {
-		return false
+		return fmt.Errorf("%w: %s guest on %s host", ErrKVMForeignArch, a,
+			Native)
+	}
+
+	return checkKVMDevice(KVMDevice)
+}
+
+// checkKVMDevice returns an error if the KVM device at the given path can
+// not create virtual machines.
+func checkKVMDevice(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err //nolint:wrapcheck
 	}
+	defer file.Close()
 
-	f, err := os.OpenFile("/dev/kvm", os.O_WRONLY, 0)
-	_ = f.Close()
+	fd := int(file.Fd())
 
-	return err == nil
+	version, err := unix.IoctlRetInt(fd, kvmGetAPIVersion)
+	if err != nil {
+		return fmt.Errorf("get API version: %w", err)
+	}
+
+	if version != kvmAPIVersion {
+		return fmt.Errorf("%w: %d", ErrKVMAPIVersion, version)
+	}
+
+	vmFd, err := unix.IoctlRetInt(fd, kvmCreateVM)
+	if err != nil {
+		return fmt.Errorf("create VM: %w", err)
+	}
+
+	_ = unix.Close(vmFd)
+
+	return nil
 }
 
 func (a *Arch) Set(s string) error {
 	switch Arch(s) {
-	case AMD64, ARM64, RISCV64:
+	case AMD64, ARM64, RISCV64, S390X, MIPS64:
 		*a = Arch(s)
 	default:
 		return ErrArchNotSupported
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestArch_CheckKVM_ForeignArch(t *testing.T) {
+	foreign := ARM64
+	if Native == ARM64 {
+		foreign = AMD64
+	}
+
+	err := foreign.CheckKVM()
+	assert.ErrorIs(t, err, ErrKVMForeignArch)
+	assert.False(t, foreign.KVMAvailable())
+}
+
+func TestCheckKVMDevice(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		expectedErr error
+	}{
+		{
+			name:        "missing",
+			path:        filepath.Join(t.TempDir(), "kvm"),
+			expectedErr: os.ErrNotExist,
+		},
+		{
+			name:        "not kvm",
+			path:        os.DevNull,
+			expectedErr: unix.ENOTTY,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkKVMDevice(tt.path)
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FDDir is the directory of the open file descriptors of a process. It is a
+// symlink to "/proc/self/fd" usually, which is missing in some containers.
+const FDDir = "/dev/fd"
+
+// cgroupDir is the directory the cgroup v2 file system is mounted at.
+const cgroupDir = "/sys/fs/cgroup"
+
+// Container describes the container environment a process runs in. See
+// [DetectContainer].
+type Container struct {
+	// Runtime is the container runtime, like "docker" or "podman". It is
+	// empty if the runtime is unknown.
+	Runtime string
+
+	// KVMDeviceMissing is true if [KVMDevice] does not exist.
+	KVMDeviceMissing bool
+
+	// FDDirMissing is true if [FDDir] does not exist.
+	FDDirMissing bool
+
+	// CgroupReadOnly is true if the cgroup file system is mounted read-only,
+	// as it is by default in unprivileged containers.
+	CgroupReadOnly bool
+
+	// MemoryLimit is the memory limit of the cgroup of the process in
+	// bytes. It is 0 if there is no limit.
+	MemoryLimit uint64
+}
+
+// DetectContainer returns the [Container] environment the process runs in.
+// It returns false, if it does not run in a container, as far as can be told.
+// Containers are detected by the files container runtimes create, by the
+// "container" environment variable set by some runtimes and by a read-only
+// cgroup file system.
+func DetectContainer() (Container, bool) {
+	return detectContainer("/", os.Getenv("container"))
+}
+
+// detectContainer returns the [Container] environment of the file system
+// tree at the given root directory. env is the value of the "container"
+// environment variable.
+func detectContainer(root, env string) (Container, bool) {
+	exists := func(path string) bool {
+		_, err := os.Stat(filepath.Join(root, path))
+		return err == nil
+	}
+
+	container := Container{
+		Runtime:          env,
+		KVMDeviceMissing: !exists(KVMDevice),
+		FDDirMissing:     !exists(FDDir),
+		CgroupReadOnly: isReadOnlyMount(
+			filepath.Join(root, "proc/self/mountinfo"), cgroupDir),
+		MemoryLimit: readMemoryLimit(
+			filepath.Join(root, cgroupDir, "memory.max")),
+	}
+
+	// Container runtimes create these files in the root of the containers
+	// they run.
+	markers := []struct {
+		path    string
+		runtime string
+	}{
+		{"/.dockerenv", "docker"},
+		{"/run/.containerenv", "podman"},
+	}
+
+	for _, marker := range markers {
+		if container.Runtime == "" && exists(marker.path) {
+			container.Runtime = marker.runtime
+		}
+	}
+
+	detected := container.Runtime != "" || container.CgroupReadOnly
+
+	return container, detected
+}
+
+// isReadOnlyMount returns true if the file system at the given mount point is
+// mounted read-only as listed in the given mountinfo file, as described in
+// proc_pid_mountinfo(5).
+func isReadOnlyMount(mountinfo, mountPoint string) bool {
+	file, err := os.Open(mountinfo)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[4] != mountPoint {
+			continue
+		}
+
+		return slices.Contains(strings.Split(fields[5], ","), "ro")
+	}
+
+	return false
+}
+
+// readMemoryLimit returns the memory limit in the given cgroup v2
+// "memory.max" file. It returns 0 if there is no limit or if the file can not
+// be read.
+func readMemoryLimit(path string) uint64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return limit
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectContainer(t *testing.T) {
+	const (
+		mountinfoRW = "30 25 0:26 / /sys/fs/cgroup rw,nosuid - cgroup2 " +
+			"cgroup2 rw\n"
+		mountinfoRO = "30 25 0:26 / /sys/fs/cgroup ro,nosuid - cgroup2 " +
+			"cgroup2 rw\n"
+	)
+
+	tests := []struct {
+		name             string
+		files            map[string]string
+		env              string
+		expected         Container
+		expectedDetected bool
+	}{
+		{
+			name: "host",
+			files: map[string]string{
+				"dev/kvm":                  "",
+				"dev/fd/0":                 "",
+				"proc/self/mountinfo":      mountinfoRW,
+				"sys/fs/cgroup/memory.max": "max\n",
+			},
+		},
+		{
+			name: "docker",
+			files: map[string]string{
+				".dockerenv":               "",
+				"proc/self/mountinfo":      mountinfoRO,
+				"sys/fs/cgroup/memory.max": "1073741824\n",
+			},
+			expected: Container{
+				Runtime:          "docker",
+				KVMDeviceMissing: true,
+				FDDirMissing:     true,
+				CgroupReadOnly:   true,
+				MemoryLimit:      1 << 30,
+			},
+			expectedDetected: true,
+		},
+		{
+			name: "podman",
+			files: map[string]string{
+				"dev/kvm":           "",
+				"dev/fd/0":          "",
+				"run/.containerenv": "",
+			},
+			expected:         Container{Runtime: "podman"},
+			expectedDetected: true,
+		},
+		{
+			name: "environment variable",
+			files: map[string]string{
+				"dev/kvm":  "",
+				"dev/fd/0": "",
+			},
+			env:              "lxc",
+			expected:         Container{Runtime: "lxc"},
+			expectedDetected: true,
+		},
+		{
+			name: "read-only cgroup only",
+			files: map[string]string{
+				"dev/kvm":             "",
+				"dev/fd/0":            "",
+				"proc/self/mountinfo": mountinfoRO,
+			},
+			expected:         Container{CgroupReadOnly: true},
+			expectedDetected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+
+			for name, content := range tt.files {
+				path := filepath.Join(root, name)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			}
+
+			actual, detected := detectContainer(root, tt.env)
+			assert.Equal(t, tt.expected, actual)
+			assert.Equal(t, tt.expectedDetected, detected)
+		})
+	}
+}
@@ -13,7 +13,8 @@ import (
 // ReadELFArch returns the [sys.Arch] of the given ELF file.
 //
 // It returns an error if the ELF file is not for Linux or is for an
-// unsupported architecture.
+// unsupported architecture, including 32 bit variants and variants of other
+// byte order than the supported ones.
 func ReadELFArch(fileName string) (Arch, error) {
 	file, err := elfOpen(fileName)
 	if err != nil {
@@ -28,16 +29,39 @@ func ReadELFArch(fileName string) (Arch, error) {
 		return "", fmt.Errorf("%w: %s", ErrOSABINotSupported, file.OSABI)
 	}
 
+	if file.Class != elf.ELFCLASS64 {
+		return "", fmt.Errorf("%w: %s %s", ErrMachineNotSupported,
+			file.Class, file.Machine)
+	}
+
+	var arch Arch
+
 	switch file.Machine {
 	case elf.EM_X86_64:
-		return AMD64, nil
+		arch = AMD64
 	case elf.EM_AARCH64:
-		return ARM64, nil
+		arch = ARM64
 	case elf.EM_RISCV:
-		return RISCV64, nil
+		arch = RISCV64
+	case elf.EM_S390:
+		arch = S390X
+	case elf.EM_MIPS:
+		arch = MIPS64
 	default:
 		return "", fmt.Errorf("%w: %s", ErrMachineNotSupported, file.Machine)
 	}
+
+	byteOrder := elf.ELFDATA2LSB
+	if arch.IsBigEndian() {
+		byteOrder = elf.ELFDATA2MSB
+	}
+
+	if file.Data != byteOrder {
+		return "", fmt.Errorf("%w: %s %s", ErrByteOrderNotSupported,
+			file.Data, file.Machine)
+	}
+
+	return arch, nil
 }
 
 func elfOpen(name string) (*elf.File, error) {
@@ -52,3 +76,25 @@ func elfOpen(name string) (*elf.File, error) {
 
 	return elfFile, nil
 }
+
+// ReadSONAME returns the shared object name of the given ELF file, which is
+// the name the dynamic linker looks for, like "libfoo.so.1". It returns the
+// empty string if the file has none, like executables.
+func ReadSONAME(fileName string) (string, error) {
+	file, err := elfOpen(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sonames, err := file.DynString(elf.DT_SONAME)
+	if err != nil {
+		return "", fmt.Errorf("read soname: %w", err)
+	}
+
+	if len(sonames) == 0 {
+		return "", nil
+	}
+
+	return sonames[0], nil
+}
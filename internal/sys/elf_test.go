@@ -5,7 +5,12 @@
 package sys_test
 
 import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
 	"io/fs"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/aibor/virtrun/internal/sys"
@@ -51,3 +56,86 @@ func TestReadArch(t *testing.T) {
 		})
 	}
 }
+
+func TestReadELFArch_Header(t *testing.T) {
+	// header returns a minimal 64 bit ELF header without program and
+	// section headers.
+	header := func(data elf.Data, machine elf.Machine) []byte {
+		var order binary.ByteOrder = binary.LittleEndian
+		if data == elf.ELFDATA2MSB {
+			order = binary.BigEndian
+		}
+
+		buf := bytes.NewBuffer([]byte{
+			0x7f, 'E', 'L', 'F',
+			byte(elf.ELFCLASS64), byte(data), byte(elf.EV_CURRENT),
+		})
+		buf.Write(make([]byte, elf.EI_NIDENT-buf.Len()))
+
+		_ = binary.Write(buf, order, uint16(elf.ET_EXEC))
+		_ = binary.Write(buf, order, uint16(machine))
+		_ = binary.Write(buf, order, uint32(elf.EV_CURRENT))
+		buf.Write(make([]byte, 64-buf.Len()))
+
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		expected    sys.Arch
+		expectedErr error
+	}{
+		{
+			name:     "little-endian arm64",
+			data:     header(elf.ELFDATA2LSB, elf.EM_AARCH64),
+			expected: sys.ARM64,
+		},
+		{
+			name:        "big-endian arm64",
+			data:        header(elf.ELFDATA2MSB, elf.EM_AARCH64),
+			expectedErr: sys.ErrByteOrderNotSupported,
+		},
+		{
+			name:     "big-endian s390x",
+			data:     header(elf.ELFDATA2MSB, elf.EM_S390),
+			expected: sys.S390X,
+		},
+		{
+			name:     "big-endian mips64",
+			data:     header(elf.ELFDATA2MSB, elf.EM_MIPS),
+			expected: sys.MIPS64,
+		},
+		{
+			name:        "little-endian mips64",
+			data:        header(elf.ELFDATA2LSB, elf.EM_MIPS),
+			expectedErr: sys.ErrByteOrderNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "binary")
+
+			err := os.WriteFile(path, tt.data, 0o600)
+			require.NoError(t, err)
+
+			actual, err := sys.ReadELFArch(path)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestReadSONAME(t *testing.T) {
+	soname, err := sys.ReadSONAME(os.Args[0])
+	require.NoError(t, err)
+	assert.Empty(t, soname, "executables have no SONAME")
+
+	path := filepath.Join(t.TempDir(), "libfoo.so")
+	content := []byte("definitely not an ELF file")
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	_, err = sys.ReadSONAME(path)
+	require.ErrorIs(t, err, sys.ErrNotELFFile)
+}
@@ -20,4 +20,35 @@ var (
 	// ErrMachineNotSupported is returned if the machine type of an ELF file
 	// is not supported.
 	ErrMachineNotSupported = errors.New("machine type not supported")
+
+	// ErrByteOrderNotSupported is returned if the byte order of an ELF file
+	// is not supported. All supported architectures are little-endian.
+	ErrByteOrderNotSupported = errors.New("byte order not supported")
+
+	// ErrKVMForeignArch is returned if KVM is requested for guests of an
+	// architecture other than the native one.
+	ErrKVMForeignArch = errors.New("KVM can not run guests of foreign arch")
+
+	// ErrKVMAPIVersion is returned if the KVM API version is not supported.
+	ErrKVMAPIVersion = errors.New("KVM API version not supported")
+
+	// ErrUnknownKernelFormat is returned if the format of a kernel image is
+	// not known, like for compressed images.
+	ErrUnknownKernelFormat = errors.New("unknown kernel image format")
+
+	// ErrModuleNotFound is returned if a kernel module is not found in a
+	// kernel modules directory.
+	ErrModuleNotFound = errors.New("kernel module not found")
+
+	// ErrInvalidCgroupLimit is returned if a cgroup limit is not in the form
+	// "FILE=VALUE".
+	ErrInvalidCgroupLimit = errors.New("invalid cgroup limit")
+
+	// ErrNotCgroup2 is returned if a cgroup directory is not on a cgroup v2
+	// file system.
+	ErrNotCgroup2 = errors.New("not a cgroup v2 file system")
+
+	// ErrNoKernelConfig is returned if no build configuration is found in a
+	// kernel image.
+	ErrNoKernelConfig = errors.New("no kernel config found")
 )
@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConfinePath cleans the given path as absolute path. Joined with a
+// directory, the result stays within that directory, even if the path is
+// relative or contains "..".
+func ConfinePath(path string) string {
+	return filepath.Clean("/" + path)
+}
+
+// CreateFile creates the file at the given path along with its parent
+// directories. Existing files are overwritten.
+func CreateFile(path string) (*os.File, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("create directory: %w", err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create file: %w", err)
+	}
+
+	return file, nil
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfinePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{
+			name:     "absolute",
+			path:     "/tmp/report.xml",
+			expected: "/tmp/report.xml",
+		},
+		{
+			name:     "relative",
+			path:     "tmp/report.xml",
+			expected: "/tmp/report.xml",
+		},
+		{
+			name:     "parent dirs",
+			path:     "../../etc/passwd",
+			expected: "/etc/passwd",
+		},
+		{
+			name:     "empty",
+			path:     "",
+			expected: "/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sys.ConfinePath(tt.path))
+		})
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "dir", "file")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("old content"), 0o600))
+
+	file, err := sys.CreateFile(path)
+	require.NoError(t, err)
+
+	_, err = file.WriteString("new")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+
+	t.Run("missing parent dirs", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a", "b", "file")
+
+		file, err := sys.CreateFile(path)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		assert.FileExists(t, path)
+	})
+}
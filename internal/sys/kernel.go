@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Magic numbers of the kernel boot image formats and their offsets.
+const (
+	kernelHeaderSize = 0x400
+
+	elfMagic = "\x7fELF"
+
+	bzImageMagicOffset = 0x202
+	bzImageMagic       = "HdrS"
+
+	imageMagicOffset = 0x38
+	arm64ImageMagic  = "ARM\x64"
+	riscvImageMagic  = "RSC\x05"
+)
+
+// ReadKernelArch returns the [Arch] of the given kernel image.
+//
+// Supported are ELF files, like vmlinux, the x86 bzImage format and the
+// Image format of arm64 and riscv64. For other formats, like compressed
+// Image files, [ErrUnknownKernelFormat] is returned.
+func ReadKernelArch(fileName string) (Arch, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	header := make([]byte, kernelHeaderSize)
+
+	n, err := io.ReadFull(file, header)
+	// Shorter files are fine, as their format is just not known.
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) &&
+		!errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read header: %w", err)
+	}
+
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte(elfMagic)):
+		return ReadELFArch(fileName)
+	case hasMagicAt(header, bzImageMagicOffset, bzImageMagic):
+		return AMD64, nil
+	case hasMagicAt(header, imageMagicOffset, arm64ImageMagic):
+		return ARM64, nil
+	case hasMagicAt(header, imageMagicOffset, riscvImageMagic):
+		return RISCV64, nil
+	default:
+		return "", ErrUnknownKernelFormat
+	}
+}
+
+func hasMagicAt(header []byte, offset int, magic string) bool {
+	end := offset + len(magic)
+
+	return len(header) >= end && string(header[offset:end]) == magic
+}
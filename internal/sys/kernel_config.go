@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ikconfigStart and ikconfigEnd enclose the gzip compressed build
+	// configuration in kernel images built with CONFIG_IKCONFIG.
+	ikconfigStart = "IKCFG_ST"
+	ikconfigEnd   = "IKCFG_ED"
+
+	// maxDecompressedKernelSize limits the size of decompressed kernel
+	// images.
+	maxDecompressedKernelSize = 512 << 20
+)
+
+// gzipMagic are the first bytes of gzip compressed files, like
+// /proc/config.gz.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gzipDeflateMagic are the first bytes of gzip compressed data using the
+// deflate method, as found in compressed kernel images.
+var gzipDeflateMagic = []byte{0x1f, 0x8b, 0x08}
+
+// KernelConfig is a kernel build configuration as value by option name, like
+// "CONFIG_VIRTIO_PCI": "y". Options that are not set are not present.
+type KernelConfig map[string]string
+
+// Enabled returns true if all the given options are built in or built as
+// module.
+func (c KernelConfig) Enabled(options ...string) bool {
+	return len(c.Missing(options...)) == 0
+}
+
+// Missing returns the given options that are neither built in nor built as
+// module.
+func (c KernelConfig) Missing(options ...string) []string {
+	var missing []string
+
+	for _, option := range options {
+		value := c[option]
+		if value != "y" && value != "m" {
+			missing = append(missing, option)
+		}
+	}
+
+	return missing
+}
+
+// ReadKernelConfig reads the kernel build configuration file at the given
+// path, like "/boot/config-6.1.0" or a copy of "/proc/config.gz". Gzip
+// compressed files are decompressed.
+func ReadKernelConfig(path string) (KernelConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var reader io.Reader = bytes.NewReader(data)
+
+	if bytes.HasPrefix(data, gzipMagic) {
+		reader, err = gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+	}
+
+	return ParseKernelConfig(reader)
+}
+
+// ParseKernelConfig parses a kernel build configuration in the format of
+// ".config" files. Comments and empty lines are skipped.
+func ParseKernelConfig(r io.Reader) (KernelConfig, error) {
+	config := make(KernelConfig)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+
+		config[name] = strings.Trim(value, `"`)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	return config, nil
+}
+
+// ExtractKernelConfig extracts the build configuration embedded into the
+// kernel image at the given path, if the kernel is built with
+// CONFIG_IKCONFIG. It is found in uncompressed images, like vmlinux, and in
+// images compressed with gzip, like most x86 bzImage files. For other images
+// [ErrNoKernelConfig] is returned.
+func ExtractKernelConfig(path string) (KernelConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	config, found := extractIKConfig(data)
+	if found {
+		return config, nil
+	}
+
+	// Compressed images start with a decompressor. The compressed kernel
+	// follows somewhere after it, so try each possible gzip stream.
+	for offset := 0; ; offset++ {
+		idx := bytes.Index(data[offset:], gzipDeflateMagic)
+		if idx < 0 {
+			break
+		}
+
+		offset += idx
+
+		config, found = extractIKConfig(gunzipMember(data[offset:]))
+		if found {
+			return config, nil
+		}
+	}
+
+	return nil, ErrNoKernelConfig
+}
+
+// extractIKConfig returns the build configuration embedded into the given
+// uncompressed kernel image. It returns false if there is none.
+func extractIKConfig(data []byte) (KernelConfig, bool) {
+	for {
+		start := bytes.Index(data, []byte(ikconfigStart))
+		if start < 0 {
+			return nil, false
+		}
+
+		data = data[start+len(ikconfigStart):]
+
+		end := bytes.Index(data, []byte(ikconfigEnd))
+		if end < 0 {
+			return nil, false
+		}
+
+		if !bytes.HasPrefix(data, gzipMagic) {
+			continue
+		}
+
+		reader, err := gzip.NewReader(bytes.NewReader(data[:end]))
+		if err != nil {
+			continue
+		}
+
+		config, err := ParseKernelConfig(reader)
+		if err == nil && len(config) > 0 {
+			return config, true
+		}
+	}
+}
+
+// gunzipMember returns as much of the decompressed data of the single gzip
+// member at the start of the given data as can be decompressed. Trailing
+// data, like the rest of a kernel image, is ignored.
+func gunzipMember(data []byte) []byte {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	reader.Multistream(false)
+
+	// Errors are expected for data that only looks like gzip. What was
+	// decompressed until then is still worth a look.
+	decompressed, _ := io.ReadAll(io.LimitReader(reader,
+		maxDecompressedKernelSize))
+
+	return decompressed
+}
+
+// FindKernelConfig returns the path of the build configuration file of the
+// kernel at the given path, if it follows the usual naming in "/boot", like
+// "/boot/config-6.1.0" for "/boot/vmlinuz-6.1.0". It returns the empty
+// string if there is none.
+func FindKernelConfig(kernel string) string {
+	dir, name := filepath.Split(kernel)
+
+	for _, prefix := range []string{"vmlinuz-", "vmlinux-", "Image-"} {
+		version, found := strings.CutPrefix(name, prefix)
+		if !found || version == "" {
+			continue
+		}
+
+		path := filepath.Join(dir, "config-"+version)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
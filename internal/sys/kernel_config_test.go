@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const kernelConfig = `#
+# Automatically generated file; DO NOT EDIT.
+#
+CONFIG_VIRTIO_PCI=y
+CONFIG_VIRTIO_CONSOLE=m
+# CONFIG_VIRTIO_MMIO is not set
+CONFIG_LOCALVERSION="-test"
+`
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var compressed bytes.Buffer
+
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	return compressed.Bytes()
+}
+
+func TestReadKernelConfig(t *testing.T) {
+	expected := sys.KernelConfig{
+		"CONFIG_VIRTIO_PCI":     "y",
+		"CONFIG_VIRTIO_CONSOLE": "m",
+		"CONFIG_LOCALVERSION":   "-test",
+	}
+
+	for name, data := range map[string][]byte{
+		"plain": []byte(kernelConfig),
+		"gzip":  gzipData(t, []byte(kernelConfig)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			require.NoError(t, os.WriteFile(path, data, 0o600))
+
+			actual, err := sys.ReadKernelConfig(path)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestKernelConfig_Enabled(t *testing.T) {
+	config := sys.KernelConfig{
+		"CONFIG_VIRTIO_PCI":     "y",
+		"CONFIG_VIRTIO_CONSOLE": "m",
+		"CONFIG_HZ":             "250",
+	}
+
+	assert.True(t, config.Enabled("CONFIG_VIRTIO_PCI", "CONFIG_VIRTIO_CONSOLE"))
+	assert.False(t, config.Enabled("CONFIG_VIRTIO_PCI", "CONFIG_VIRTIO_MMIO"))
+	assert.False(t, config.Enabled("CONFIG_HZ"))
+}
+
+func TestKernelConfig_Missing(t *testing.T) {
+	config := sys.KernelConfig{
+		"CONFIG_VIRTIO_PCI":     "y",
+		"CONFIG_VIRTIO_CONSOLE": "m",
+	}
+
+	assert.Empty(t, config.Missing("CONFIG_VIRTIO_PCI", "CONFIG_VIRTIO_CONSOLE"))
+	assert.Equal(t, []string{"CONFIG_TMPFS", "CONFIG_DEVTMPFS"},
+		config.Missing("CONFIG_TMPFS", "CONFIG_VIRTIO_PCI", "CONFIG_DEVTMPFS"))
+}
+
+func TestExtractKernelConfig(t *testing.T) {
+	expected := sys.KernelConfig{
+		"CONFIG_VIRTIO_PCI":     "y",
+		"CONFIG_VIRTIO_CONSOLE": "m",
+		"CONFIG_LOCALVERSION":   "-test",
+	}
+
+	image := slices.Concat(
+		[]byte("\x7fELF kernel code IKCFG_ST not the config"),
+		[]byte("IKCFG_ST"),
+		gzipData(t, []byte(kernelConfig)),
+		[]byte("IKCFG_ED more kernel code"),
+	)
+
+	// Compressed images have a decompressor in front, which might contain
+	// bytes that look like the start of gzip data.
+	compressedImage := slices.Concat(
+		[]byte("MZ decompressor \x1f\x8b\x08 "),
+		gzipData(t, image),
+		[]byte("trailer"),
+	)
+
+	tests := []struct {
+		name        string
+		image       []byte
+		expected    sys.KernelConfig
+		expectedErr error
+	}{
+		{
+			name:     "uncompressed",
+			image:    image,
+			expected: expected,
+		},
+		{
+			name:     "compressed",
+			image:    compressedImage,
+			expected: expected,
+		},
+		{
+			name:        "no config",
+			image:       gzipData(t, []byte("kernel code")),
+			expectedErr: sys.ErrNoKernelConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vmlinuz")
+			require.NoError(t, os.WriteFile(path, tt.image, 0o600))
+
+			actual, err := sys.ExtractKernelConfig(path)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestFindKernelConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config-6.1.0")
+	require.NoError(t, os.WriteFile(config, []byte(kernelConfig), 0o600))
+
+	assert.Equal(t, config,
+		sys.FindKernelConfig(filepath.Join(dir, "vmlinuz-6.1.0")))
+	assert.Empty(t, sys.FindKernelConfig(filepath.Join(dir, "vmlinuz-6.2.0")))
+	assert.Empty(t, sys.FindKernelConfig(filepath.Join(dir, "bzImage")))
+}
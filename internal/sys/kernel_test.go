@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadKernelArch(t *testing.T) {
+	image := func(offset int, magic string) []byte {
+		data := make([]byte, 0x400)
+		copy(data[offset:], magic)
+
+		return data
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		expected    sys.Arch
+		expectedErr error
+	}{
+		{
+			name:     "bzImage",
+			data:     image(0x202, "HdrS"),
+			expected: sys.AMD64,
+		},
+		{
+			name:     "arm64 Image",
+			data:     image(0x38, "ARM\x64"),
+			expected: sys.ARM64,
+		},
+		{
+			name:     "riscv64 Image",
+			data:     image(0x38, "RSC\x05"),
+			expected: sys.RISCV64,
+		},
+		{
+			name:        "gzip compressed",
+			data:        []byte{0x1f, 0x8b, 0x08, 0x00},
+			expectedErr: sys.ErrUnknownKernelFormat,
+		},
+		{
+			name:        "empty",
+			expectedErr: sys.ErrUnknownKernelFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vmlinuz")
+
+			err := os.WriteFile(path, tt.data, 0o600)
+			require.NoError(t, err)
+
+			arch, err := sys.ReadKernelArch(path)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, arch)
+		})
+	}
+}
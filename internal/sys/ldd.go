@@ -43,7 +43,7 @@ const lddTimeout = 5 * time.Second
 // implementation. Because of this the former procedure is used, so use with
 // great care!
 func Ldd(ctx context.Context, path string) ([]string, error) {
-	interpreter, err := readInterpreter(path)
+	interpreter, err := ReadInterpreter(path)
 	if err != nil {
 		return nil, err
 	}
@@ -63,10 +63,10 @@ func Ldd(ctx context.Context, path string) ([]string, error) {
 	return paths, nil
 }
 
-// readInterpreter fetches the ELF interpreter path from the ELF file. If the
-// file does not have an ELF magic number, [ErrNoELFFile] is returned. If no
+// ReadInterpreter fetches the ELF interpreter path from the ELF file. If the
+// file does not have an ELF magic number, [ErrNotELFFile] is returned. If no
 // interpreter path is found, [ErrNoInterpreter] is returned.
-func readInterpreter(path string) (string, error) {
+func ReadInterpreter(path string) (string, error) {
 	elfFile, err := elfOpen(path)
 	if err != nil {
 		return "", err
@@ -100,7 +100,7 @@ func readInterpreter(path string) (string, error) {
 //
 // This is how the glibc provided ldd works. The main difference is, that
 // it does not try a list of interpreters, but uses the one found in the file
-// itself. so, call [elfFile.readInterpreter] before calling ldd.
+// itself. so, call [ReadInterpreter] before calling ldd.
 //
 // It returns ErrNoInterpreter if the elfFile has no interpreter set.
 func ldd(ctx context.Context, interpreter, path string) (ldInfos, error) {
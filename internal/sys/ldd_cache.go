@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ldSoCache is the cache file of the dynamic linker. Changes to it may change
+// the libraries found, so it is checked along with the libraries.
+const ldSoCache = "/etc/ld.so.cache"
+
+// LddCache caches the results of [Ldd] in a directory, so unchanged binaries
+// do not need to be resolved again. Results are stored by the hash of the
+// content of the ELF file and the environment variable LD_LIBRARY_PATH.
+//
+// A result is used only if the size and modification time of all its
+// libraries and of the dynamic linker's cache are unchanged. Libraries added
+// to search paths later are not detected, though.
+type LddCache struct {
+	Dir string
+}
+
+// lddCacheEntry is a result of [Ldd] as stored by [LddCache].
+type lddCacheEntry struct {
+	// Paths are the paths returned by [Ldd].
+	Paths []string `json:"paths"`
+
+	// Files are the files the result depends on.
+	Files []fileStamp `json:"files"`
+}
+
+// fileStamp identifies the state of a file by size and modification time.
+type fileStamp struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Ldd returns the result of [Ldd] for the ELF file with the given path. A
+// cached result is returned, if valid. Otherwise, [Ldd] is called and its
+// result is cached. Failing to write the cache does not fail the call.
+func (c LddCache) Ldd(ctx context.Context, path string) ([]string, error) {
+	key, err := lddCacheKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entryPath := filepath.Join(c.Dir, key+".json")
+
+	entry, err := readLddCacheEntry(entryPath)
+	if err == nil && entry.valid() {
+		return entry.Paths, nil
+	}
+
+	paths, err := Ldd(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeLddCacheEntry(entryPath, paths)
+	if err != nil {
+		slog.Debug("Writing ldd cache failed",
+			slog.String("path", path),
+			slog.Any("error", err))
+	}
+
+	return paths, nil
+}
+
+// lddCacheKey returns the hex encoded SHA-256 hash of the content of the file
+// with the given path and LD_LIBRARY_PATH.
+func lddCacheKey(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("hash %s: %w", path, err)
+	}
+
+	_, _ = io.WriteString(hash, "\x00"+os.Getenv("LD_LIBRARY_PATH"))
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// valid returns true if all files of the entry are unchanged.
+func (e lddCacheEntry) valid() bool {
+	for _, stamp := range e.Files {
+		actual, err := newFileStamp(stamp.Path)
+		if err != nil || !actual.ModTime.Equal(stamp.ModTime) ||
+			actual.Size != stamp.Size {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newFileStamp returns the [fileStamp] of the file at the given path.
+func newFileStamp(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err //nolint:wrapcheck
+	}
+
+	return fileStamp{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func readLddCacheEntry(path string) (lddCacheEntry, error) {
+	var entry lddCacheEntry
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry, err //nolint:wrapcheck
+	}
+
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return entry, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	return entry, nil
+}
+
+// writeLddCacheEntry writes the entry for the given paths to the given path.
+// The entry is written into a temporary file first and moved into place, so
+// concurrent runs never read partial entries.
+func writeLddCacheEntry(path string, paths []string) error {
+	entry := lddCacheEntry{Paths: paths}
+
+	for _, name := range append([]string{ldSoCache}, paths...) {
+		stamp, err := newFileStamp(name)
+		if errors.Is(err, os.ErrNotExist) && name == ldSoCache {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		entry.Files = append(entry.Files, stamp)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = file.Write(data)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return os.Rename(file.Name(), path) //nolint:wrapcheck
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLddCache_Ldd(t *testing.T) {
+	tempDir := t.TempDir()
+	cache := LddCache{Dir: filepath.Join(tempDir, "cache")}
+
+	binary := filepath.Join(tempDir, "binary")
+	require.NoError(t, os.WriteFile(binary, []byte("binary"), 0o600))
+
+	lib := filepath.Join(tempDir, "lib.so")
+	require.NoError(t, os.WriteFile(lib, []byte("lib"), 0o600))
+
+	key, err := lddCacheKey(binary)
+	require.NoError(t, err)
+
+	entryPath := filepath.Join(cache.Dir, key+".json")
+	require.NoError(t, writeLddCacheEntry(entryPath, []string{lib}))
+
+	t.Run("hit", func(t *testing.T) {
+		// The binary is not an ELF file, so resolving it would fail.
+		actual, err := cache.Ldd(context.Background(), binary)
+		require.NoError(t, err)
+		assert.Equal(t, []string{lib}, actual)
+	})
+
+	t.Run("library changed", func(t *testing.T) {
+		modTime := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(lib, modTime, modTime))
+
+		_, err := cache.Ldd(context.Background(), binary)
+		require.Error(t, err, "must resolve again")
+	})
+}
+
+func TestLddCacheEntry_Valid(t *testing.T) {
+	lib := filepath.Join(t.TempDir(), "lib.so")
+	require.NoError(t, os.WriteFile(lib, []byte("lib"), 0o600))
+
+	stamp, err := newFileStamp(lib)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		modify   func(fileStamp) fileStamp
+		expected bool
+	}{
+		{
+			name:     "unchanged",
+			modify:   func(s fileStamp) fileStamp { return s },
+			expected: true,
+		},
+		{
+			name: "size changed",
+			modify: func(s fileStamp) fileStamp {
+				s.Size++
+				return s
+			},
+		},
+		{
+			name: "mtime changed",
+			modify: func(s fileStamp) fileStamp {
+				s.ModTime = s.ModTime.Add(-time.Second)
+				return s
+			},
+		},
+		{
+			name: "missing",
+			modify: func(s fileStamp) fileStamp {
+				s.Path += ".missing"
+				return s
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := lddCacheEntry{Files: []fileStamp{tt.modify(stamp)}}
+			assert.Equal(t, tt.expected, entry.valid())
+		})
+	}
+}
@@ -14,13 +14,13 @@ import (
 )
 
 func TestELFFileReadInterpreter(t *testing.T) {
-	interpreter, err := readInterpreter("testdata/bin/main")
+	interpreter, err := ReadInterpreter("testdata/bin/main")
 	require.NoError(t, err)
 	assert.NotEmpty(t, interpreter)
 }
 
 func TestELFFileLdd(t *testing.T) {
-	interpreter, err := readInterpreter("testdata/bin/main")
+	interpreter, err := ReadInterpreter("testdata/bin/main")
 	require.NoError(t, err, "must find interpreter")
 
 	tests := []struct {
@@ -19,6 +19,7 @@ import (
 type LibCollection struct {
 	libs        map[string]int
 	searchPaths map[string]int
+	links       map[string]string
 }
 
 func (c *LibCollection) Libs() iter.Seq[string] {
@@ -41,6 +42,24 @@ func (c *LibCollection) SearchPaths() iter.Seq[string] {
 	}
 }
 
+// Links returns the symbolic links the dynamic linker expects next to the
+// libraries by their name, along with the name of the library they point to,
+// like "libfoo.so.1" to "libfoo.so.1.2.3". Both are file names only, as all
+// libraries are expected to be in the same directory.
+func (c *LibCollection) Links() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, name := range slices.Sorted(maps.Keys(c.links)) {
+			if !yield(name, c.links[name]) {
+				return
+			}
+		}
+	}
+}
+
+// LddFunc returns the shared objects required by the ELF file with the given
+// path, like [Ldd].
+type LddFunc func(ctx context.Context, path string) ([]string, error)
+
 // CollectLibsFor recursively resolves the dynamically linked shared objects of
 // all given ELF files.
 //
@@ -48,14 +67,25 @@ func (c *LibCollection) SearchPaths() iter.Seq[string] {
 func CollectLibsFor(
 	ctx context.Context,
 	files ...string,
+) (LibCollection, error) {
+	return CollectLibsWith(ctx, Ldd, files...)
+}
+
+// CollectLibsWith works like [CollectLibsFor] but resolves the shared objects
+// of each file with the given [LddFunc], like [LddCache.Ldd].
+func CollectLibsWith(
+	ctx context.Context,
+	lddFn LddFunc,
+	files ...string,
 ) (LibCollection, error) {
 	collection := LibCollection{
 		libs:        make(map[string]int),
 		searchPaths: make(map[string]int),
+		links:       make(map[string]string),
 	}
 
 	for _, name := range files {
-		err := collectLibsFor(ctx, collection.libs, name)
+		err := collectLibsFor(ctx, lddFn, collection.libs, name)
 		if err != nil {
 			return collection, fmt.Errorf("[%s]: %w", name, err)
 		}
@@ -70,11 +100,65 @@ func CollectLibsFor(
 		}
 	}
 
+	// The same library might be found in multiple directories, like the
+	// interpreter in "/lib64" and "/usr/lib64". All directories are search
+	// paths, so a single copy is enough.
+	dedupeByBaseName(collection.libs)
+
+	for name := range collection.libs {
+		soname, err := ReadSONAME(name)
+		if err != nil {
+			return collection, fmt.Errorf("[%s]: %w", name, err)
+		}
+
+		addSONAMELink(collection.links, collection.libs, name, soname)
+	}
+
 	return collection, nil
 }
 
+// dedupeByBaseName removes all but the first of the given libraries in
+// lexical order that have the same file name.
+func dedupeByBaseName(libs map[string]int) {
+	seen := make(map[string]bool, len(libs))
+
+	for _, path := range slices.Sorted(maps.Keys(libs)) {
+		name := filepath.Base(path)
+		if seen[name] {
+			delete(libs, path)
+			continue
+		}
+
+		seen[name] = true
+	}
+}
+
+// addSONAMELink adds a link from the given SONAME to the file name of the
+// library at the given path, unless they are the same or a library with the
+// SONAME as file name is collected already.
+func addSONAMELink(
+	links map[string]string,
+	libs map[string]int,
+	path string,
+	soname string,
+) {
+	name := filepath.Base(path)
+	if soname == "" || soname == name {
+		return
+	}
+
+	for lib := range libs {
+		if filepath.Base(lib) == soname {
+			return
+		}
+	}
+
+	links[soname] = name
+}
+
 func collectLibsFor(
 	ctx context.Context,
+	lddFn LddFunc,
 	libs map[string]int,
 	name string,
 ) error {
@@ -82,7 +166,7 @@ func collectLibsFor(
 	// Ignore if it is not an ELF file or if it is statically linked (has no
 	// interpreter). Collect the absolute paths of the found shared objects
 	// deduplicated in a set.
-	paths, err := Ldd(ctx, name)
+	paths, err := lddFn(ctx, name)
 	if err != nil {
 		if errors.Is(err, ErrNotELFFile) ||
 			errors.Is(err, ErrNoInterpreter) {
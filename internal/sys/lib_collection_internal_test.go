@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupeByBaseName(t *testing.T) {
+	libs := map[string]int{
+		"/lib64/ld-linux-x86-64.so.2":     1,
+		"/usr/lib64/ld-linux-x86-64.so.2": 1,
+		"/usr/lib64/libc.so.6":            1,
+	}
+
+	dedupeByBaseName(libs)
+
+	expected := map[string]int{
+		"/lib64/ld-linux-x86-64.so.2": 1,
+		"/usr/lib64/libc.so.6":        1,
+	}
+	assert.Equal(t, expected, libs)
+}
+
+func TestAddSONAMELink(t *testing.T) {
+	libs := map[string]int{
+		"/usr/lib/libfoo.so.1.2.3": 1,
+		"/usr/lib/libbar.so.2":     1,
+		"/usr/lib/libbaz.so.3.0":   1,
+		"/usr/lib/libbaz.so.3":     1,
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		soname   string
+		expected map[string]string
+	}{
+		{
+			name:     "no soname",
+			path:     "/usr/lib/libfoo.so.1.2.3",
+			expected: map[string]string{},
+		},
+		{
+			name:     "same name",
+			path:     "/usr/lib/libbar.so.2",
+			soname:   "libbar.so.2",
+			expected: map[string]string{},
+		},
+		{
+			name:     "different name",
+			path:     "/usr/lib/libfoo.so.1.2.3",
+			soname:   "libfoo.so.1",
+			expected: map[string]string{"libfoo.so.1": "libfoo.so.1.2.3"},
+		},
+		{
+			name:     "collected already",
+			path:     "/usr/lib/libbaz.so.3.0",
+			soname:   "libbaz.so.3",
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := make(map[string]string)
+			addSONAMELink(links, libs, tt.path, tt.soname)
+			assert.Equal(t, tt.expected, links)
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ModulesDepFile is the name of the file in a kernel modules directory, like
+// "/lib/modules/6.12.1", that lists the dependencies of each module. It is
+// written by depmod(8).
+const ModulesDepFile = "modules.dep"
+
+// ModulesDep are the dependencies of the modules in a kernel modules
+// directory as read from its [ModulesDepFile].
+type ModulesDep struct {
+	// Dir is the kernel modules directory.
+	Dir string
+
+	// deps are the dependencies of each module by path relative to Dir.
+	deps map[string][]string
+
+	// paths are the paths of the modules relative to Dir by module name.
+	paths map[string]string
+}
+
+// ReadModulesDep reads the [ModulesDepFile] of the given kernel modules
+// directory.
+func ReadModulesDep(dir string) (*ModulesDep, error) {
+	file, err := os.Open(filepath.Join(dir, ModulesDepFile))
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	modulesDep := &ModulesDep{
+		Dir:   dir,
+		deps:  make(map[string][]string),
+		paths: make(map[string]string),
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		module, deps, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		modulesDep.deps[module] = strings.Fields(deps)
+		modulesDep.paths[ModuleName(module)] = module
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", ModulesDepFile, err)
+	}
+
+	return modulesDep, nil
+}
+
+// Resolve returns the paths of the given module and all modules it depends
+// on in the order they must be loaded. The module is given by name, like
+// "veth", or by the path of its file. Files that are not in the modules
+// directory are returned as is without dependencies.
+func (m *ModulesDep) Resolve(module string) ([]string, error) {
+	if !IsModulePath(module) {
+		if m.Dir == "" {
+			return nil, fmt.Errorf("%w: %s: no modules directory given",
+				ErrModuleNotFound, module)
+		}
+
+		path, exists := m.paths[ModuleName(module)]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s in %s", ErrModuleNotFound, module,
+				m.Dir)
+		}
+
+		module = filepath.Join(m.Dir, path)
+	}
+
+	rel, err := filepath.Rel(m.Dir, module)
+	if err != nil {
+		return []string{module}, nil //nolint:nilerr
+	}
+
+	deps, exists := m.deps[rel]
+	if !exists {
+		return []string{module}, nil
+	}
+
+	// Dependencies are listed before their own dependencies, so they are
+	// loaded in reverse order, like modprobe(8) does.
+	paths := make([]string, 0, len(deps)+1)
+	for _, dep := range slices.Backward(deps) {
+		paths = append(paths, filepath.Join(m.Dir, dep))
+	}
+
+	return append(paths, module), nil
+}
+
+// ModuleName returns the name of the kernel module with the given file name
+// or name. Directories and file extensions, like ".ko.zst", are removed and
+// "-" is replaced with "_", as the kernel treats them the same.
+func ModuleName(name string) string {
+	name = filepath.Base(name)
+	name, _, _ = strings.Cut(name, ".ko")
+
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// IsModulePath returns true if the given module is given by the path of its
+// file instead of by name.
+func IsModulePath(module string) bool {
+	return strings.ContainsRune(module, filepath.Separator) ||
+		strings.Contains(module, ".ko")
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModulesDep_Resolve(t *testing.T) {
+	dir := t.TempDir()
+
+	modulesDep := "kernel/net/bridge/br_netfilter.ko.zst: " +
+		"kernel/net/bridge/bridge.ko.zst kernel/net/802/stp.ko.zst " +
+		"kernel/net/llc/llc.ko.zst\n" +
+		"kernel/drivers/net/veth.ko.zst:\n" +
+		"kernel/drivers/net/dummy-net.ko.zst:\n"
+
+	err := os.WriteFile(filepath.Join(dir, sys.ModulesDepFile),
+		[]byte(modulesDep), 0o600)
+	require.NoError(t, err)
+
+	deps, err := sys.ReadModulesDep(dir)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		module      string
+		expected    []string
+		expectedErr error
+	}{
+		{
+			name:   "name with dependencies",
+			module: "br_netfilter",
+			expected: []string{
+				"kernel/net/llc/llc.ko.zst",
+				"kernel/net/802/stp.ko.zst",
+				"kernel/net/bridge/bridge.ko.zst",
+				"kernel/net/bridge/br_netfilter.ko.zst",
+			},
+		},
+		{
+			name:     "name without dependencies",
+			module:   "veth",
+			expected: []string{"kernel/drivers/net/veth.ko.zst"},
+		},
+		{
+			name:     "name with dash",
+			module:   "dummy_net",
+			expected: []string{"kernel/drivers/net/dummy-net.ko.zst"},
+		},
+		{
+			name:     "path in dir",
+			module:   filepath.Join(dir, "kernel/drivers/net/veth.ko.zst"),
+			expected: []string{"kernel/drivers/net/veth.ko.zst"},
+		},
+		{
+			name:     "path outside dir",
+			module:   "/tmp/custom.ko",
+			expected: []string{"/tmp/custom.ko"},
+		},
+		{
+			name:        "unknown name",
+			module:      "missing",
+			expectedErr: sys.ErrModuleNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := deps.Resolve(tt.module)
+			require.ErrorIs(t, err, tt.expectedErr)
+
+			for idx, path := range tt.expected {
+				if !filepath.IsAbs(path) {
+					tt.expected[idx] = filepath.Join(dir, path)
+				}
+			}
+
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestModulesDep_Resolve_NoDir(t *testing.T) {
+	var deps sys.ModulesDep
+
+	actual, err := deps.Resolve("/tmp/custom.ko")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/tmp/custom.ko"}, actual)
+
+	_, err = deps.Resolve("veth")
+	require.ErrorIs(t, err, sys.ErrModuleNotFound)
+}
@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// IOClass is an I/O scheduling class as described in ioprio_set(2).
+type IOClass int
+
+const (
+	// IOClassNone keeps the I/O scheduling class unchanged.
+	IOClassNone IOClass = iota
+
+	// IOClassRealtime gets first access to the disk.
+	IOClassRealtime
+
+	// IOClassBestEffort is the default class of processes.
+	IOClassBestEffort
+
+	// IOClassIdle gets access to the disk only if no other process needs it.
+	IOClassIdle
+)
+
+const (
+	// ioprioWhoProcess applies an I/O priority to a single thread.
+	ioprioWhoProcess = 1
+
+	// ioprioClassShift is the shift of the class in an I/O priority.
+	ioprioClassShift = 13
+)
+
+// ProcessLimits are limits for a host process, so multiple processes on a
+// shared host do not starve each other. The zero value changes nothing.
+type ProcessLimits struct {
+	// CPUs are the host CPUs the process is pinned to. If empty, it runs on
+	// all CPUs.
+	CPUs []int
+
+	// Nice is the nice value of the process as described in
+	// setpriority(2). It is unchanged if 0.
+	Nice int
+
+	// IOClass is the I/O scheduling class of the process.
+	IOClass IOClass
+
+	// IOLevel is the I/O priority level within the IOClass, from 0 for the
+	// highest to 7 for the lowest priority. It is ignored for
+	// [IOClassIdle].
+	IOLevel int
+
+	// Cgroup is a cgroup v2 directory the process is started in. It is
+	// created, if it does not exist.
+	Cgroup string
+
+	// CgroupLimits are written into the interface files of the Cgroup in
+	// the form "FILE=VALUE", like "cpu.max=200000 100000" or
+	// "memory.max=1G".
+	CgroupLimits []string
+}
+
+// ThreadLimited returns true if any of the limits applied by
+// [ProcessLimits.ApplyToThread] is set.
+func (l ProcessLimits) ThreadLimited() bool {
+	return len(l.CPUs) > 0 || l.Nice != 0 || l.IOClass != IOClassNone
+}
+
+// ApplyToThread applies the scheduling limits to the calling thread. Threads
+// and processes it starts afterwards inherit them. The caller must lock the
+// goroutine to its thread. See [runtime.LockOSThread].
+func (l ProcessLimits) ApplyToThread() error {
+	if len(l.CPUs) > 0 {
+		var set unix.CPUSet
+		for _, cpu := range l.CPUs {
+			set.Set(cpu)
+		}
+
+		err := unix.SchedSetaffinity(0, &set)
+		if err != nil {
+			return fmt.Errorf("set cpu affinity: %w", err)
+		}
+	}
+
+	if l.Nice != 0 {
+		err := unix.Setpriority(unix.PRIO_PROCESS, 0, l.Nice)
+		if err != nil {
+			return fmt.Errorf("set nice: %w", err)
+		}
+	}
+
+	if l.IOClass != IOClassNone {
+		prio := int(l.IOClass)<<ioprioClassShift | l.IOLevel
+
+		_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0,
+			uintptr(prio))
+		if errno != 0 {
+			return fmt.Errorf("set io priority: %w", errno)
+		}
+	}
+
+	return nil
+}
+
+// OpenCgroup creates the Cgroup, if it does not exist, and writes the
+// CgroupLimits into it. The Cgroup must be on a cgroup v2 file system and the
+// limits must name existing interface files. The returned directory can be
+// used to start processes in the cgroup. See [syscall.SysProcAttr.CgroupFD].
+// It returns nil if no cgroup is set.
+func (l ProcessLimits) OpenCgroup() (*os.File, error) {
+	if l.Cgroup == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	files := make([]string, len(l.CgroupLimits))
+	values := make([]string, len(l.CgroupLimits))
+
+	for idx, limit := range l.CgroupLimits {
+		file, value, found := strings.Cut(limit, "=")
+		if !found || file == "" || strings.Contains(file, "/") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCgroupLimit, limit)
+		}
+
+		files[idx] = filepath.Join(l.Cgroup, file)
+		values[idx] = value
+	}
+
+	err := checkCgroup2(l.Cgroup)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(l.Cgroup, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("create cgroup: %w", err)
+	}
+
+	for idx, file := range files {
+		err := writeCgroupFile(file, values[idx])
+		if err != nil {
+			return nil, fmt.Errorf("cgroup limit: %w", err)
+		}
+	}
+
+	dir, err := os.Open(l.Cgroup)
+	if err != nil {
+		return nil, fmt.Errorf("open cgroup: %w", err)
+	}
+
+	return dir, nil
+}
+
+// checkCgroup2 returns [ErrNotCgroup2] if the given path, or its nearest
+// existing parent, if the path does not exist yet, is not on a cgroup v2 file
+// system.
+func checkCgroup2(path string) error {
+	for {
+		var stat unix.Statfs_t
+
+		err := unix.Statfs(path, &stat)
+		if errors.Is(err, unix.ENOENT) && filepath.Dir(path) != path {
+			path = filepath.Dir(path)
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("stat cgroup %s: %w", path, err)
+		}
+
+		if stat.Type != unix.CGROUP2_SUPER_MAGIC {
+			return fmt.Errorf("%w: %s", ErrNotCgroup2, path)
+		}
+
+		return nil
+	}
+}
+
+// writeCgroupFile writes the value into an existing cgroup interface file.
+// Unlike [os.WriteFile], it does not create the file, so unknown interface
+// files are reported instead of silently created.
+func writeCgroupFile(path, value string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	_, err = file.WriteString(value)
+	if err != nil {
+		_ = file.Close()
+		return err //nolint:wrapcheck
+	}
+
+	return file.Close() //nolint:wrapcheck
+}
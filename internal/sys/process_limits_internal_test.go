@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sys
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestProcessLimits_ApplyToThread(t *testing.T) {
+	var current unix.CPUSet
+
+	require.NoError(t, unix.SchedGetaffinity(0, &current))
+
+	cpu := 0
+	for !current.IsSet(cpu) {
+		cpu++
+	}
+
+	limits := ProcessLimits{
+		CPUs:    []int{cpu},
+		Nice:    19,
+		IOClass: IOClassIdle,
+	}
+
+	require.True(t, limits.ThreadLimited())
+	assert.False(t, ProcessLimits{Cgroup: "/cgroup"}.ThreadLimited())
+
+	type result struct {
+		err      error
+		cpus     unix.CPUSet
+		priority int
+		ioprio   uintptr
+	}
+
+	results := make(chan result, 1)
+
+	// The goroutine exits without unlocking, so the limited thread is not
+	// reused.
+	go func() {
+		runtime.LockOSThread()
+
+		var res result
+
+		res.err = limits.ApplyToThread()
+		_ = unix.SchedGetaffinity(0, &res.cpus)
+		res.priority, _ = unix.Getpriority(unix.PRIO_PROCESS, 0)
+		res.ioprio, _, _ = unix.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess,
+			0, 0)
+
+		results <- res
+	}()
+
+	res := <-results
+	require.NoError(t, res.err)
+	assert.Equal(t, 1, res.cpus.Count())
+	assert.True(t, res.cpus.IsSet(cpu))
+	// Getpriority returns 20 - nice, so it is never negative.
+	assert.Equal(t, 1, res.priority)
+	assert.Equal(t, uintptr(IOClassIdle), res.ioprio>>ioprioClassShift)
+}
+
+func TestProcessLimits_OpenCgroup(t *testing.T) {
+	t.Run("no cgroup", func(t *testing.T) {
+		dir, err := ProcessLimits{}.OpenCgroup()
+		require.NoError(t, err)
+		assert.Nil(t, dir)
+	})
+
+	t.Run("not cgroup2", func(t *testing.T) {
+		cgroup := filepath.Join(t.TempDir(), "virtrun")
+
+		_, err := ProcessLimits{
+			Cgroup:       cgroup,
+			CgroupLimits: []string{"memory.max=1G"},
+		}.OpenCgroup()
+		require.ErrorIs(t, err, ErrNotCgroup2)
+		assert.NoDirExists(t, cgroup)
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		cgroup := testCgroup(t)
+
+		dir, err := ProcessLimits{
+			Cgroup:       cgroup,
+			CgroupLimits: []string{"pids.max=64"},
+		}.OpenCgroup()
+		require.NoError(t, err)
+		require.NoError(t, dir.Close())
+
+		data, err := os.ReadFile(filepath.Join(cgroup, "pids.max"))
+		require.NoError(t, err)
+		assert.Equal(t, "64\n", string(data))
+	})
+
+	t.Run("unknown interface file", func(t *testing.T) {
+		cgroup := testCgroup(t)
+
+		_, err := ProcessLimits{
+			Cgroup:       cgroup,
+			CgroupLimits: []string{"unknown.max=1"},
+		}.OpenCgroup()
+		require.ErrorIs(t, err, os.ErrNotExist)
+		assert.NoFileExists(t, filepath.Join(cgroup, "unknown.max"))
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+		_, err := ProcessLimits{
+			Cgroup:       t.TempDir(),
+			CgroupLimits: []string{"../memory.max=1G"},
+		}.OpenCgroup()
+		require.ErrorIs(t, err, ErrInvalidCgroupLimit)
+	})
+}
+
+// testCgroup returns the path of a not yet existing child cgroup of the
+// cgroup v2 hierarchy mounted at /sys/fs/cgroup. It skips the test if the
+// hierarchy is not available or not writable.
+func testCgroup(t *testing.T) string {
+	t.Helper()
+
+	const root = "/sys/fs/cgroup"
+
+	if checkCgroup2(root) != nil || unix.Access(root, unix.W_OK) != nil {
+		t.Skip("no writable cgroup v2 hierarchy at " + root)
+	}
+
+	cgroup := filepath.Join(root, "virtrun-test-"+strconv.Itoa(os.Getpid()))
+
+	t.Cleanup(func() { _ = os.Remove(cgroup) })
+
+	return cgroup
+}
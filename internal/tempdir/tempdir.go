@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package tempdir provides temporary directories that are cleaned up even if
+// the process that created them is killed.
+//
+// Each directory has a lock file the creating process holds an exclusive lock
+// on until it removes the directory. The kernel releases the lock once the
+// process is gone, however it terminated. [Sweep] removes the directories
+// that are not locked anymore, so files of crashed or killed runs do not
+// accumulate.
+package tempdir
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Prefix is the name prefix of the directories.
+	Prefix = "virtrun-run-"
+
+	// lockName is the name of the lock file in the directories.
+	lockName = ".lock"
+
+	// staleAge is the age a directory without lock file must have to be
+	// considered stale. A directory without lock file might be one that is
+	// just being created.
+	staleAge = time.Hour
+)
+
+// Dir is a temporary directory locked by the current process.
+type Dir struct {
+	path string
+	lock *os.File
+}
+
+// Create creates a new locked temporary directory in the given parent
+// directory. If it is empty, [os.TempDir] is used. The directory must be
+// removed with [Dir.Remove].
+func Create(parent string) (*Dir, error) {
+	path, err := os.MkdirTemp(parent, Prefix)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	// The lock file is locked under a temporary name and renamed once it is
+	// locked, so [Sweep] never sees an unlocked lock file of a new directory.
+	// Until then, the directory is protected by its age.
+	lock, err := os.CreateTemp(path, lockName+"-*")
+	if err != nil {
+		_ = os.RemoveAll(path)
+		return nil, err //nolint:wrapcheck
+	}
+
+	err = unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err != nil {
+		_ = lock.Close()
+		_ = os.RemoveAll(path)
+
+		return nil, fmt.Errorf("lock: %w", err)
+	}
+
+	err = os.Rename(lock.Name(), filepath.Join(path, lockName))
+	if err != nil {
+		_ = lock.Close()
+		_ = os.RemoveAll(path)
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	return &Dir{path: path, lock: lock}, nil
+}
+
+// Path returns the path of the directory.
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// Remove removes the directory with all its content and releases the lock.
+func (d *Dir) Remove() error {
+	err := os.RemoveAll(d.path)
+	_ = d.lock.Close()
+
+	return err //nolint:wrapcheck
+}
+
+// Sweep removes the directories in the given parent directory that are not
+// locked anymore, because the process that created them did not remove them.
+// If parent is empty, [os.TempDir] is used. The paths of the removed
+// directories are returned.
+func Sweep(parent string) ([]string, error) {
+	if parent == "" {
+		parent = os.TempDir()
+	}
+
+	paths, err := filepath.Glob(filepath.Join(parent, Prefix+"*"))
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var (
+		removed []string
+		errs    []error
+	)
+
+	for _, path := range paths {
+		stale, err := isStale(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if !stale {
+			continue
+		}
+
+		err = os.RemoveAll(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		removed = append(removed, path)
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// isStale returns true if the directory at the given path is not locked by
+// any process.
+func isStale(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	if !info.IsDir() {
+		return false, nil
+	}
+
+	lock, err := os.Open(filepath.Join(path, lockName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Since(info.ModTime()) > staleAge, nil
+	} else if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+	defer lock.Close()
+
+	err = unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("lock %s: %w", path, err)
+	}
+
+	return true, nil
+}
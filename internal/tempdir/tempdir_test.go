@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package tempdir_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/tempdir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreate(t *testing.T) {
+	parent := t.TempDir()
+
+	dir, err := tempdir.Create(parent)
+	require.NoError(t, err)
+
+	assert.DirExists(t, dir.Path())
+	assert.Equal(t, parent, filepath.Dir(dir.Path()))
+	assert.Contains(t, filepath.Base(dir.Path()), tempdir.Prefix)
+
+	err = os.WriteFile(filepath.Join(dir.Path(), "file"), []byte("a"), 0o600)
+	require.NoError(t, err)
+
+	require.NoError(t, dir.Remove())
+	assert.NoDirExists(t, dir.Path())
+}
+
+func TestSweep(t *testing.T) {
+	parent := t.TempDir()
+
+	mkdir := func(name string, files ...string) string {
+		path := filepath.Join(parent, name)
+		require.NoError(t, os.Mkdir(path, 0o755))
+
+		for _, file := range files {
+			err := os.WriteFile(filepath.Join(path, file), nil, 0o600)
+			require.NoError(t, err)
+		}
+
+		return path
+	}
+
+	locked, err := tempdir.Create(parent)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = locked.Remove() })
+
+	// The lock file exists, but no process holds the lock anymore.
+	unlocked := mkdir(tempdir.Prefix+"unlocked", ".lock", "initramfs")
+
+	// A directory without lock file might just be created.
+	creating := mkdir(tempdir.Prefix + "creating")
+
+	abandoned := mkdir(tempdir.Prefix + "abandoned")
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(abandoned, old, old))
+
+	other := mkdir("other", ".lock")
+
+	removed, err := tempdir.Sweep(parent)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{unlocked, abandoned}, removed)
+
+	assert.DirExists(t, locked.Path())
+	assert.DirExists(t, creating)
+	assert.DirExists(t, other)
+	assert.NoDirExists(t, unlocked)
+	assert.NoDirExists(t, abandoned)
+}
+
+func TestCreate_ConcurrentSweep(t *testing.T) {
+	parent := t.TempDir()
+	done := make(chan struct{})
+	swept := make(chan []string)
+
+	go func() {
+		var removed []string
+
+		for {
+			select {
+			case <-done:
+				swept <- removed
+				return
+			default:
+				paths, _ := tempdir.Sweep(parent)
+				removed = append(removed, paths...)
+			}
+		}
+	}()
+
+	var dirs []*tempdir.Dir
+
+	for range 200 {
+		dir, err := tempdir.Create(parent)
+		require.NoError(t, err)
+
+		dirs = append(dirs, dir)
+	}
+
+	close(done)
+	assert.Empty(t, <-swept, "sweep must not remove new directories")
+
+	for _, dir := range dirs {
+		assert.DirExists(t, dir.Path())
+		assert.FileExists(t, filepath.Join(dir.Path(), ".lock"))
+		require.NoError(t, dir.Remove())
+	}
+}
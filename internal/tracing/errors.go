@@ -0,0 +1,11 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package tracing
+
+import "errors"
+
+// ErrExport is returned if the collector responds with a status other than
+// 2xx.
+var ErrExport = errors.New("export failed")
@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// otlpTracesPath is the path of the traces endpoint relative to the
+	// base endpoint URL.
+	otlpTracesPath = "/v1/traces"
+
+	otlpSpanKindInternal = 1
+	otlpStatusCodeError  = 2
+)
+
+// EndpointFromEnv returns the URL traces are exported to as configured by the
+// standard OpenTelemetry environment variables
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT. It is
+// empty if neither is set.
+func EndpointFromEnv() string {
+	if url := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); url != "" {
+		return url
+	}
+
+	if url := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); url != "" {
+		return strings.TrimSuffix(url, "/") + otlpTracesPath
+	}
+
+	return ""
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlp returns the recorded spans as OTLP trace data. Spans that have not
+// been ended are omitted.
+func (t *Tracer) otlp() otlpTraces {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spans := make([]otlpSpan, 0, len(t.spans))
+
+	for _, span := range t.spans {
+		if span.end.IsZero() {
+			continue
+		}
+
+		otlp := otlpSpan{
+			TraceID:           hex.EncodeToString(t.trace[:]),
+			SpanID:            hex.EncodeToString(span.id[:]),
+			Name:              span.name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: unixNano(span.start.UnixNano()),
+			EndTimeUnixNano:   unixNano(span.end.UnixNano()),
+		}
+
+		if span.parent != (spanID{}) {
+			otlp.ParentSpanID = hex.EncodeToString(span.parent[:])
+		}
+
+		for _, attr := range span.attrs {
+			otlp.Attributes = append(otlp.Attributes, otlpAttr(attr.key,
+				attr.value))
+		}
+
+		if span.err != nil {
+			otlp.Status = &otlpStatus{
+				Code:    otlpStatusCodeError,
+				Message: span.err.Error(),
+			}
+		}
+
+		spans = append(spans, otlp)
+	}
+
+	return otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{
+					otlpAttr("service.name", t.service),
+				},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: t.service},
+				Spans: spans,
+			}},
+		}},
+	}
+}
+
+func otlpAttr(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+func unixNano(nsec int64) string {
+	return strconv.FormatInt(nsec, 10)
+}
+
+// Export sends all ended spans as OTLP JSON to the given traces endpoint URL,
+// like "http://localhost:4318/v1/traces".
+func (t *Tracer) Export(
+	ctx context.Context,
+	client *http.Client,
+	url string,
+) error {
+	body, err := json.Marshal(t.otlp())
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url,
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s: %s", ErrExport, url, resp.Status)
+	}
+
+	return nil
+}
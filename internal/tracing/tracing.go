@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package tracing records the phases of a run as spans of a single trace and
+// exports them to an OpenTelemetry collector via OTLP over HTTP.
+//
+// Spans are started with [Start]. Without a [Tracer] in the context, nothing
+// is recorded, so callers do not need to check if tracing is enabled.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+type (
+	traceID [16]byte
+	spanID  [8]byte
+)
+
+// Tracer records the spans of a single trace.
+type Tracer struct {
+	service string
+	trace   traceID
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewTracer creates a new [Tracer] for a new trace. The spans are exported
+// with the given service name.
+func NewTracer(service string) *Tracer {
+	tracer := &Tracer{service: service}
+	_, _ = rand.Read(tracer.trace[:])
+
+	return tracer
+}
+
+func (t *Tracer) newSpan(name string, parent spanID, start time.Time) *Span {
+	span := &Span{
+		tracer: t,
+		name:   name,
+		parent: parent,
+		start:  start,
+	}
+	_, _ = rand.Read(span.id[:])
+
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+
+	return span
+}
+
+// Span is a named and timed phase of the trace. All methods do nothing if
+// the span is nil, as returned by [Start] without [Tracer].
+type Span struct {
+	tracer *Tracer
+	name   string
+	id     spanID
+	parent spanID
+	start  time.Time
+	end    time.Time
+	attrs  []attribute
+	err    error
+}
+
+type attribute struct {
+	key   string
+	value string
+}
+
+type contextKey struct{}
+
+// WithTracer returns a copy of the context the given [Tracer] records the
+// spans started with [Start] into.
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, contextKey{}, &Span{tracer: tracer})
+}
+
+// Start starts a new span with the given name. It is a child of the span in
+// the given context, if any. The returned context has the new span, so spans
+// started with it are its children. The span must be ended with [Span.End].
+//
+// If the context has no [Tracer], the context is returned as is along with a
+// nil span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent, _ := ctx.Value(contextKey{}).(*Span)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	span := parent.tracer.newSpan(name, parent.id, time.Now())
+
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// Add adds a finished child span with the given name and times. It is used
+// for phases that are not observed directly, like those the guest reports.
+func (s *Span) Add(name string, start, end time.Time) {
+	if s == nil {
+		return
+	}
+
+	s.tracer.newSpan(name, s.id, start).end = end
+}
+
+// SetAttr sets an attribute of the span.
+func (s *Span) SetAttr(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.attrs = append(s.attrs, attribute{key: key, value: value})
+}
+
+// SetError marks the span as failed with the given error, if it is not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.err = err
+}
+
+// End ends the span.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.end = time.Now()
+}
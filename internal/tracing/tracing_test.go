@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Start        string `json:"startTimeUnixNano"`
+	End          string `json:"endTimeUnixNano"`
+	Attributes   []struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	} `json:"attributes"`
+	Status *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+// collector returns a server that decodes exported spans into the given
+// slice.
+func collector(t *testing.T, spans *[]exportedSpan) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/traces", r.URL.Path)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+			var data struct {
+				ResourceSpans []struct {
+					ScopeSpans []struct {
+						Spans []exportedSpan `json:"spans"`
+					} `json:"scopeSpans"`
+				} `json:"resourceSpans"`
+			}
+
+			if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&data)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			for _, resource := range data.ResourceSpans {
+				for _, scope := range resource.ScopeSpans {
+					*spans = append(*spans, scope.Spans...)
+				}
+			}
+		},
+	))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestStart_NoTracer(t *testing.T) {
+	ctx := context.Background()
+
+	actualCtx, span := tracing.Start(ctx, "phase")
+	assert.Nil(t, span)
+	assert.Equal(t, ctx, actualCtx)
+
+	// Methods of nil spans must not panic.
+	span.SetAttr("key", "value")
+	span.SetError(assert.AnError)
+	span.Add("child", time.Now(), time.Now())
+	span.End()
+}
+
+func TestTracer_Export(t *testing.T) {
+	var spans []exportedSpan
+
+	server := collector(t, &spans)
+	tracer := tracing.NewTracer("virtrun")
+	ctx := tracing.WithTracer(context.Background(), tracer)
+
+	ctx, root := tracing.Start(ctx, "run")
+	root.SetAttr("binary", "bin.test")
+
+	_, child := tracing.Start(ctx, "build")
+	child.SetError(assert.AnError)
+	child.End()
+
+	start := time.Unix(10, 0)
+	root.Add("guest", start, start.Add(time.Second))
+
+	// Spans that are not ended are not exported.
+	_, _ = tracing.Start(ctx, "unfinished")
+
+	root.End()
+
+	err := tracer.Export(context.Background(), server.Client(),
+		server.URL+"/v1/traces")
+	require.NoError(t, err)
+	require.Len(t, spans, 3)
+
+	rootSpan, buildSpan, guestSpan := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "run", rootSpan.Name)
+	assert.Empty(t, rootSpan.ParentSpanID)
+	require.Len(t, rootSpan.Attributes, 1)
+	assert.Equal(t, "binary", rootSpan.Attributes[0].Key)
+	assert.Equal(t, "bin.test", rootSpan.Attributes[0].Value.StringValue)
+	assert.Nil(t, rootSpan.Status)
+
+	assert.Equal(t, "build", buildSpan.Name)
+	assert.Equal(t, rootSpan.SpanID, buildSpan.ParentSpanID)
+	require.NotNil(t, buildSpan.Status)
+	assert.Equal(t, 2, buildSpan.Status.Code)
+	assert.Equal(t, assert.AnError.Error(), buildSpan.Status.Message)
+
+	assert.Equal(t, "guest", guestSpan.Name)
+	assert.Equal(t, rootSpan.SpanID, guestSpan.ParentSpanID)
+	assert.Equal(t, "10000000000", guestSpan.Start)
+	assert.Equal(t, "11000000000", guestSpan.End)
+
+	for _, span := range spans {
+		assert.Len(t, span.TraceID, 32)
+		assert.Equal(t, rootSpan.TraceID, span.TraceID)
+		assert.Len(t, span.SpanID, 16)
+	}
+}
+
+func TestTracer_Export_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		},
+	))
+	t.Cleanup(server.Close)
+
+	tracer := tracing.NewTracer("virtrun")
+
+	err := tracer.Export(context.Background(), server.Client(), server.URL)
+	require.ErrorIs(t, err, tracing.ErrExport)
+}
+
+func TestEndpointFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		traces   string
+		base     string
+		expected string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:     "base",
+			base:     "http://localhost:4318/",
+			expected: "http://localhost:4318/v1/traces",
+		},
+		{
+			name:     "traces takes precedence",
+			traces:   "http://collector/custom",
+			base:     "http://localhost:4318",
+			expected: "http://collector/custom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", tt.traces)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.base)
+
+			assert.Equal(t, tt.expected, tracing.EndpointFromEnv())
+		})
+	}
+}
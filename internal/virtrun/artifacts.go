@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ArtifactIndexName is the name of the index file written into the artifact
+// directory. See [Artifact].
+const ArtifactIndexName = "virtrun-index.json"
+
+// ArtifactSource is the way an [Artifact] was sent by the guest.
+type ArtifactSource string
+
+const (
+	// ArtifactSourceCollect is used for files collected once the binary
+	// returned. See [Qemu.Collect].
+	ArtifactSourceCollect ArtifactSource = "collect"
+
+	// ArtifactSourceStream is used for files sent as stream on the control
+	// console while the binary runs.
+	ArtifactSourceStream ArtifactSource = "stream"
+
+	// ArtifactSourceConsole is used for the log files of the console output
+	// written by the host. See [Qemu.ConsoleLog].
+	ArtifactSourceConsole ArtifactSource = "console"
+)
+
+// Artifact is a file the guest sent into the artifact directory, or a log file
+// of its console output.
+type Artifact struct {
+	// Path is the guest path of the file. It is the path of the file relative
+	// to the artifact directory as well.
+	Path string `json:"path"`
+
+	// Size is the size of the file in bytes, as written on the host.
+	Size int64 `json:"size"`
+
+	// Source is the way the file was sent.
+	Source ArtifactSource `json:"source"`
+}
+
+// writeArtifactIndex sets the size of the given artifacts and writes them as
+// JSON into the [ArtifactIndexName] file in dir. An existing file is
+// overwritten.
+func writeArtifactIndex(dir string, artifacts []Artifact) error {
+	for idx, artifact := range artifacts {
+		info, err := os.Stat(filepath.Join(dir, artifact.Path))
+		if err != nil {
+			return fmt.Errorf("stat artifact: %w", err)
+		}
+
+		artifacts[idx].Size = info.Size()
+	}
+
+	// Never write null, so the index is always a list.
+	if artifacts == nil {
+		artifacts = []Artifact{}
+	}
+
+	data, err := json.MarshalIndent(artifacts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode index: %w", err)
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, ArtifactIndexName), data, 0o644)
+	if err != nil {
+		return fmt.Errorf("write index: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteArtifactIndex(t *testing.T) {
+	t.Run("artifacts", func(t *testing.T) {
+		dir := t.TempDir()
+
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "tmp"), 0o755))
+		require.NoError(t, os.WriteFile(
+			filepath.Join(dir, "tmp", "report.xml"), []byte("<report/>"), 0o600,
+		))
+
+		artifacts := []Artifact{
+			{Path: "/tmp/report.xml", Source: ArtifactSourceCollect},
+		}
+
+		err := writeArtifactIndex(dir, artifacts)
+		require.NoError(t, err)
+
+		actual, err := os.ReadFile(filepath.Join(dir, ArtifactIndexName))
+		require.NoError(t, err)
+
+		expected := `[
+  {
+    "path": "/tmp/report.xml",
+    "size": 9,
+    "source": "collect"
+  }
+]`
+		assert.Equal(t, expected, string(actual))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "new")
+
+		err := writeArtifactIndex(dir, nil)
+		require.NoError(t, err)
+
+		actual, err := os.ReadFile(filepath.Join(dir, ArtifactIndexName))
+		require.NoError(t, err)
+		assert.Equal(t, "[]", string(actual))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		artifacts := []Artifact{{Path: "/missing"}}
+
+		err := writeArtifactIndex(t.TempDir(), artifacts)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
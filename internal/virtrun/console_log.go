@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+const (
+	// ConsoleLogName is the name of the file the guest console output is
+	// written to, if [Qemu.ConsoleLog] is set.
+	ConsoleLogName = "virtrun-console.log"
+
+	// QemuLogName is the name of the file the QEMU output is written to, if
+	// [Qemu.ConsoleLog] is set.
+	QemuLogName = "virtrun-qemu.log"
+
+	// consoleLogTimeFormat is the format of the time lines of the log files
+	// are prefixed with.
+	consoleLogTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// teeConsoleLog returns a writer that writes to w and into the log file with
+// the given name in dir. Lines in the log file are prefixed with the time they
+// were started. The returned [io.Closer] closes the log file.
+func teeConsoleLog(
+	dir, name string,
+	w io.Writer,
+) (io.Writer, io.Closer, error) {
+	file, err := sys.CreateFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, nil, err //nolint:wrapcheck
+	}
+
+	log := &timestampWriter{w: file, now: time.Now, lineStart: true}
+
+	return io.MultiWriter(w, log), file, nil
+}
+
+// timestampWriter prefixes each line written to w with the time it was
+// started.
+type timestampWriter struct {
+	w         io.Writer
+	now       func() time.Time
+	lineStart bool
+}
+
+func (w *timestampWriter) Write(data []byte) (int, error) {
+	var buf []byte
+
+	for _, char := range data {
+		if w.lineStart {
+			buf = w.now().AppendFormat(buf, consoleLogTimeFormat)
+			buf = append(buf, ' ')
+		}
+
+		buf = append(buf, char)
+		w.lineStart = char == '\n'
+	}
+
+	_, err := w.w.Write(buf)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	return len(data), nil
+}
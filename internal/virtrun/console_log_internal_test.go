@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampWriter(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		tick = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	)
+
+	writer := &timestampWriter{
+		w: &buf,
+		now: func() time.Time {
+			tick = tick.Add(time.Second)
+			return tick
+		},
+		lineStart: true,
+	}
+
+	for _, chunk := range []string{"first ", "line\nsecond", " line\n", "\n"} {
+		n, err := io.WriteString(writer, chunk)
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+
+	expected := "" +
+		"2024-05-01T12:00:01.000Z first line\n" +
+		"2024-05-01T12:00:02.000Z second line\n" +
+		"2024-05-01T12:00:03.000Z \n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestTeeConsoleLog(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		stdout bytes.Buffer
+	)
+
+	writer, closer, err := teeConsoleLog(dir, ConsoleLogName, &stdout)
+	require.NoError(t, err)
+
+	_, err = io.WriteString(writer, "output\n")
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+
+	assert.Equal(t, "output\n", stdout.String())
+
+	data, err := os.ReadFile(filepath.Join(dir, ConsoleLogName))
+	require.NoError(t, err)
+	assert.Regexp(t, `^\S+ output\n$`, string(data))
+}
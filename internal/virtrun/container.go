@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// WarningContainer is the [Warning] code for runs whose defaults are adapted
+// to the container environment virtrun runs in.
+const WarningContainer = "container"
+
+const (
+	// containerMemoryShare is the share of the memory limit of the container
+	// the guest gets at most. QEMU needs memory besides the guest's.
+	containerMemoryShare = 2
+
+	// containerFDDir is the directory QEMU opens its inherited file
+	// descriptors with, if [sys.FDDir] does not exist.
+	containerFDDir = "/proc/self/fd"
+)
+
+// applyContainerDefaults adapts the given config to the given container
+// environment, so runs work in unprivileged containers, like the ones of CI
+// runners. The guest memory is reduced to fit the memory limit of the
+// container and "/proc/self/fd" is used, if "/dev/fd" is missing. Guests are
+// emulated anyway, if KVM is not available. See [applyEmulationDefaults].
+// Each decision is logged, so they can be followed with a verbose log level.
+// It returns the [Warning] for the adapted defaults. Its code is empty, if
+// nothing is adapted.
+func applyContainerDefaults(cfg *Qemu, container sys.Container) Warning {
+	slog.Info("Container detected",
+		slog.String("runtime", container.Runtime),
+		slog.Bool("cgroup_read_only", container.CgroupReadOnly))
+
+	var decisions []string
+
+	if container.KVMDeviceMissing && !cfg.NoKVM {
+		slog.Info("Container has no KVM device, guest is emulated",
+			slog.String("device", sys.KVMDevice))
+	}
+
+	memoryLimit := container.MemoryLimit / containerMemoryShare / (1 << 20)
+	if memoryLimit > 0 && cfg.Memory > memoryLimit {
+		decision := fmt.Sprintf("memory reduced from %d MB to %d MB to fit "+
+			"the container memory limit", cfg.Memory, memoryLimit)
+		decisions = append(decisions, decision)
+
+		slog.Info("Guest memory reduced for container",
+			slog.Uint64("memory", memoryLimit),
+			slog.Uint64("container_limit", container.MemoryLimit>>20))
+
+		cfg.Memory = memoryLimit
+	}
+
+	if container.FDDirMissing && cfg.FDDir == "" {
+		decisions = append(decisions, sys.FDDir+" missing, using "+
+			containerFDDir)
+
+		slog.Info("File descriptor directory missing in container",
+			slog.String("missing", sys.FDDir),
+			slog.String("used", containerFDDir))
+
+		cfg.FDDir = containerFDDir
+	}
+
+	if len(decisions) == 0 {
+		return Warning{}
+	}
+
+	return Warning{
+		Code: WarningContainer,
+		Message: "defaults adapted to container environment: " +
+			strings.Join(decisions, "; "),
+	}
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyContainerDefaults(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          Qemu
+		container    sys.Container
+		expectedCfg  Qemu
+		expectedCode string
+		expectedInfo string
+	}{
+		{
+			name:        "nothing to adapt",
+			cfg:         Qemu{Memory: 256},
+			container:   sys.Container{Runtime: "docker", MemoryLimit: 4 << 30},
+			expectedCfg: Qemu{Memory: 256},
+		},
+		{
+			name:         "memory limit",
+			cfg:          Qemu{Memory: 1024},
+			container:    sys.Container{MemoryLimit: 1 << 30},
+			expectedCfg:  Qemu{Memory: 512},
+			expectedCode: WarningContainer,
+			expectedInfo: "memory reduced from 1024 MB to 512 MB",
+		},
+		{
+			name:         "fd dir missing",
+			cfg:          Qemu{Memory: 256},
+			container:    sys.Container{FDDirMissing: true},
+			expectedCfg:  Qemu{Memory: 256, FDDir: "/proc/self/fd"},
+			expectedCode: WarningContainer,
+			expectedInfo: "/dev/fd missing",
+		},
+		{
+			name:        "fd dir set explicitly",
+			cfg:         Qemu{Memory: 256, FDDir: "/fds"},
+			container:   sys.Container{FDDirMissing: true},
+			expectedCfg: Qemu{Memory: 256, FDDir: "/fds"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning := applyContainerDefaults(&tt.cfg, tt.container)
+
+			assert.Equal(t, tt.expectedCfg, tt.cfg)
+			assert.Equal(t, tt.expectedCode, warning.Code)
+			assert.Contains(t, warning.Message, tt.expectedInfo)
+		})
+	}
+}
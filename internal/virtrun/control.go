@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/sysinit"
+)
+
+// controlHandler returns a [qemu.ControlHandler] that passes requests to the
+// handler of their method.
+func controlHandler(
+	handlers map[string]qemu.ControlHandler,
+) qemu.ControlHandler {
+	return func(
+		w *pipe.Writer,
+		method string,
+		params json.RawMessage,
+	) (any, error) {
+		handler, exists := handlers[method]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+		}
+
+		return handler(w, method, params)
+	}
+}
+
+// controlStreams returns a [pipe.OpenFunc] for streams the guest sends on the
+// control console. Metrics are recorded in result. Streams with
+// [sysinit.FileStreamPrefix] are written into files in dir and added to the
+// artifacts of the result. Streams with [sysinit.ForwardStreamPrefix] are
+// written to the connections of the given forwarder, if any.
+func controlStreams(
+	result *RunResult,
+	dir string,
+	forwarder *forwarder,
+) pipe.OpenFunc {
+	return func(name string) (io.WriteCloser, error) {
+		if strings.HasPrefix(name, sysinit.ForwardStreamPrefix) &&
+			forwarder != nil {
+			return forwarder.bridges.Open(name) //nolint:wrapcheck
+		}
+
+		if path, found := strings.CutPrefix(name, sysinit.FileStreamPrefix); found {
+			path = sys.ConfinePath(path)
+
+			file, err := sys.CreateFile(filepath.Join(dir, path))
+			if err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+
+			result.Artifacts = append(result.Artifacts, Artifact{
+				Path:   path,
+				Source: ArtifactSourceStream,
+			})
+
+			return file, nil
+		}
+
+		switch name {
+		case sysinit.MetricsStreamName:
+			return &metricsRecorder{result: result}, nil
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownStream, name)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlStreams(t *testing.T) {
+	dir := t.TempDir()
+	result := &RunResult{}
+	open := controlStreams(result, dir, nil)
+
+	t.Run("metrics", func(t *testing.T) {
+		dst, err := open(sysinit.MetricsStreamName)
+		require.NoError(t, err)
+		assert.IsType(t, &metricsRecorder{}, dst)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		dst, err := open(sysinit.FileStreamPrefix + "../out/report.txt")
+		require.NoError(t, err)
+
+		_, err = dst.Write([]byte("report"))
+		require.NoError(t, err)
+		require.NoError(t, dst.Close())
+
+		data, err := os.ReadFile(filepath.Join(dir, "out", "report.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "report", string(data))
+
+		expected := []Artifact{
+			{Path: "/out/report.txt", Source: ArtifactSourceStream},
+		}
+		assert.Equal(t, expected, result.Artifacts)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := open("unknown")
+		assert.ErrorIs(t, err, ErrUnknownStream)
+	})
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"cmp"
+	"context"
+
+	"github.com/aibor/virtrun/internal/qemu"
+)
+
+// DryRunInitramfsPath is used as initramfs path in the [Invocation] returned
+// by [DryRun], as no archive is built.
+const DryRunInitramfsPath = "initramfs.cpio"
+
+// DryRunUKIPath is used as kernel path in the [Invocation] returned by
+// [DryRun], if [Qemu.UKI] is set, as no UKI is built.
+const DryRunUKIPath = ukiName
+
+// DryRunVirtiofsdSocket is used as socket path of virtiofsd in the
+// [Invocation] returned by [DryRun], if [Qemu.HostRoot] is set, as virtiofsd
+// is not started.
+const DryRunVirtiofsdSocket = virtiofsdSocketName
+
+// DryRunExitCodeNonce is used as nonce of the exit code marker line in the
+// [Invocation] returned by [DryRun], as the guest is not run.
+const DryRunExitCodeNonce = "nonce"
+
+// Invocation describes how QEMU would be run for a [Spec].
+type Invocation struct {
+	// Args is the QEMU command line, starting with the executable.
+	Args []string `json:"args"`
+
+	// KernelCmdline are the parameters of the guest kernel command line.
+	KernelCmdline []string `json:"kernelCmdline"`
+
+	// Consoles are the consoles of the guest and where their output goes.
+	Consoles []qemu.Console `json:"consoles"`
+}
+
+// DryRun resolves the given [Spec] like [Run] does and returns the resulting
+// [Invocation] without building the initramfs archive or running QEMU. The
+// initramfs path in the QEMU command line is [Initramfs.Archive], if set, or
+// [DryRunInitramfsPath]. The kernel command line is the one that would be
+// embedded into the UKI, if [Qemu.UKI] is set.
+func DryRun(ctx context.Context, spec *Spec) (*Invocation, error) {
+	_, _, err := resolveArch(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	path := cmp.Or(spec.Initramfs.Archive, DryRunInitramfsPath)
+
+	cmdSpec := newCommandSpec(spec.Qemu, path, mainProcessName(spec.Initramfs),
+		&RunResult{})
+	setExitCodeNonce(&cmdSpec, DryRunExitCodeNonce)
+
+	if spec.Qemu.HostRoot {
+		shareHostRoot(&cmdSpec, DryRunVirtiofsdSocket)
+	}
+	kernelCmdline := cmdSpec.KernelCmdline()
+
+	if spec.Qemu.UKI {
+		useUKI(&cmdSpec, DryRunUKIPath)
+	}
+
+	cmd, err := newCommand(ctx, cmdSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	invocation := &Invocation{
+		Args:          cmd.Args(),
+		KernelCmdline: kernelCmdline,
+		Consoles:      cmd.Consoles(),
+	}
+
+	return invocation, nil
+}
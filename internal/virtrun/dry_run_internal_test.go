@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	spec := &Spec{
+		Qemu: Qemu{
+			Executable:    "qemu-test",
+			Kernel:        "/boot/vmlinuz",
+			Machine:       "q35",
+			TransportType: qemu.TransportTypePCI,
+			SMP:           1,
+			NoKVM:         true,
+			Control:       true,
+			InitArgs:      []string{"-test.v"},
+		},
+		Initramfs: Initramfs{
+			Binary: os.Args[0],
+		},
+	}
+
+	invocation, err := DryRun(context.Background(), spec)
+	require.NoError(t, err)
+
+	assert.Equal(t, "qemu-test", invocation.Args[0])
+	assert.Contains(t, invocation.Args, DryRunInitramfsPath)
+	assert.Contains(t, invocation.KernelCmdline, "console=hvc0")
+	assert.Contains(t, invocation.KernelCmdline,
+		sysinit.ParamExitCodeNonce+"="+DryRunExitCodeNonce)
+	assert.Equal(t, []string{"--", "-test.v"},
+		invocation.KernelCmdline[len(invocation.KernelCmdline)-2:])
+
+	expectedConsoles := []qemu.Console{
+		{Device: "hvc0", Output: "stdout"},
+		{Device: "hvc1", Output: "log"},
+		{Device: "hvc2", Output: "control"},
+	}
+	assert.Equal(t, expectedConsoles, invocation.Consoles)
+}
+
+func TestDryRun_ArchMismatch(t *testing.T) {
+	arch := sys.ARM64
+	if sys.Native == sys.ARM64 {
+		arch = sys.AMD64
+	}
+
+	spec := &Spec{
+		Qemu:      Qemu{Arch: arch},
+		Initramfs: Initramfs{Binary: os.Args[0]},
+	}
+
+	_, err := DryRun(context.Background(), spec)
+	assert.ErrorIs(t, err, ErrArchMismatch)
+}
+
+func TestDryRun_KernelArchMismatch(t *testing.T) {
+	// Foreign kernel image in the arm64 or bzImage format.
+	kernel := make([]byte, 0x400)
+	if sys.Native == sys.ARM64 {
+		copy(kernel[0x202:], "HdrS")
+	} else {
+		copy(kernel[0x38:], "ARM\x64")
+	}
+
+	kernelPath := filepath.Join(t.TempDir(), "vmlinuz")
+	require.NoError(t, os.WriteFile(kernelPath, kernel, 0o600))
+
+	spec := &Spec{
+		Qemu:      Qemu{Kernel: kernelPath},
+		Initramfs: Initramfs{Binary: os.Args[0]},
+	}
+
+	_, err := DryRun(context.Background(), spec)
+	require.ErrorIs(t, err, ErrArchMismatch)
+	assert.ErrorContains(t, err, "kernel is")
+}
+
+func TestDryRun_Archive(t *testing.T) {
+	spec := &Spec{
+		Qemu: Qemu{
+			Executable:    "qemu-test",
+			Kernel:        "/boot/vmlinuz",
+			TransportType: qemu.TransportTypePCI,
+		},
+		Initramfs: Initramfs{
+			Binary:  os.Args[0],
+			Archive: "/tmp/initramfs.cpio",
+		},
+	}
+
+	invocation, err := DryRun(context.Background(), spec)
+	require.NoError(t, err)
+
+	assert.Contains(t, invocation.Args, "/tmp/initramfs.cpio")
+	assert.NotContains(t, invocation.Args, DryRunInitramfsPath)
+}
+
+func TestDryRun_UKI(t *testing.T) {
+	spec := &Spec{
+		Qemu: Qemu{
+			Executable:    "qemu-test",
+			Kernel:        "/boot/vmlinuz",
+			Firmware:      "/usr/share/ovmf/OVMF.fd",
+			UKI:           true,
+			TransportType: qemu.TransportTypePCI,
+		},
+		Initramfs: Initramfs{
+			Binary: os.Args[0],
+		},
+	}
+
+	invocation, err := DryRun(context.Background(), spec)
+	require.NoError(t, err)
+
+	assert.Contains(t, invocation.Args, DryRunUKIPath)
+	assert.NotContains(t, invocation.Args, DryRunInitramfsPath)
+	assert.NotContains(t, invocation.Args, "-append")
+	assert.Contains(t, invocation.KernelCmdline, "console=hvc0")
+}
+
+func TestDryRun_HostRoot(t *testing.T) {
+	spec := &Spec{
+		Qemu: Qemu{
+			Executable:    "qemu-test",
+			Kernel:        "/boot/vmlinuz",
+			Machine:       "q35",
+			Memory:        256,
+			HostRoot:      true,
+			TransportType: qemu.TransportTypePCI,
+		},
+		Initramfs: Initramfs{
+			Binary: os.Args[0],
+		},
+	}
+
+	invocation, err := DryRun(context.Background(), spec)
+	require.NoError(t, err)
+
+	assert.Contains(t, invocation.Args,
+		"socket,id=vfs0,path="+DryRunVirtiofsdSocket)
+	assert.Contains(t, invocation.KernelCmdline,
+		sysinit.ParamHostRoot+"="+hostRootTag)
+}
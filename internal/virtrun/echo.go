@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aibor/virtrun/internal/pipe"
+)
+
+// echoRecorder records the round trip times of the requests the guest sends
+// by [sysinit.HostMethodEcho] one after the other. The time between two
+// requests is the time of one round trip, including the time the guest takes
+// to process the response.
+type echoRecorder struct {
+	result *RunResult
+	last   time.Time
+	now    func() time.Time
+}
+
+// handle is a [qemu.ControlHandler] that responds with the given params and
+// records the time since the previous request.
+func (r *echoRecorder) handle(
+	_ *pipe.Writer,
+	_ string,
+	params json.RawMessage,
+) (any, error) {
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+
+	if !r.last.IsZero() {
+		r.result.EchoRoundTrips = append(r.result.EchoRoundTrips,
+			now.Sub(r.last))
+	}
+
+	r.last = now
+
+	return params, nil
+}
@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEchoRecorder(t *testing.T) {
+	result := &RunResult{}
+	now := time.Unix(100, 0)
+	recorder := &echoRecorder{
+		result: result,
+		now:    func() time.Time { return now },
+	}
+
+	steps := []time.Duration{0, time.Millisecond, 3 * time.Millisecond}
+
+	for _, step := range steps {
+		now = now.Add(step)
+
+		response, err := recorder.handle(pipe.NewWriter(io.Discard),
+			sysinit.HostMethodEcho, json.RawMessage("1"))
+		require.NoError(t, err)
+		assert.Equal(t, json.RawMessage("1"), response)
+	}
+
+	expected := []time.Duration{time.Millisecond, 3 * time.Millisecond}
+	assert.Equal(t, expected, result.EchoRoundTrips)
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// EmulationTimeoutFactor is the factor timeouts are scaled by if the guest is
+// emulated because KVM is not available. Emulated guests are about an order
+// of magnitude slower.
+const EmulationTimeoutFactor = 10
+
+// WarningKVMUnavailable is the [Warning] code for runs whose guest is
+// emulated because KVM is not available.
+const WarningKVMUnavailable = "kvm-unavailable"
+
+// emulationMachines are the lightest machine types by arch, which are used
+// for emulated guests, if no machine type is set. Arches missing use their
+// default machine type, which is light already.
+var emulationMachines = map[sys.Arch]string{
+	sys.AMD64: "microvm",
+}
+
+// Warning is a condition of a run that does not fail it, but might explain
+// unexpected behavior, like slow runs.
+type Warning struct {
+	// Code identifies the kind of warning, like [WarningKVMUnavailable].
+	Code string `json:"code"`
+
+	// Message describes the warning.
+	Message string `json:"message"`
+}
+
+// CheckKVM returns an error if the guest of the given spec is emulated
+// because KVM can not run it. It returns nil if KVM is disabled by
+// [Qemu.NoKVM] anyway or if the arch of the main binary can not be read. See
+// [sys.Arch.CheckKVM].
+func CheckKVM(spec *Spec) error {
+	if spec.Qemu.NoKVM {
+		return nil
+	}
+
+	// Run reports the error properly.
+	arch, err := sys.ReadELFArch(spec.Initramfs.Binary)
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+
+	return arch.CheckKVM() //nolint:wrapcheck
+}
+
+// applyEmulationDefaults adapts the given config for a guest that is emulated
+// because KVM is not available as indicated by the given error. The heartbeat
+// timeout is scaled by [EmulationTimeoutFactor]. If the machine type is a
+// default one, as indicated by lightMachine, the lightest machine type of the
+// arch is used instead, if the QEMU executable and the kernel support it. It
+// returns the [Warning] for the result.
+func applyEmulationDefaults(
+	ctx context.Context,
+	cfg *Qemu,
+	arch sys.Arch,
+	kvmErr error,
+	lightMachine bool,
+) Warning {
+	cfg.HeartbeatTimeout *= EmulationTimeoutFactor
+
+	message := "KVM not available, guest is emulated and timeouts are " +
+		"scaled: " + kvmErr.Error()
+
+	machine, exists := emulationMachines[arch]
+	if exists && lightMachine && supportsMachine(ctx, *cfg, machine) {
+		cfg.Machine = machine
+		cfg.TransportType = qemu.TransportTypeMMIO
+		message += "; using machine type " + machine
+	}
+
+	slog.Warn("KVM not available, guest is emulated",
+		slog.String("arch", arch.String()),
+		slog.String("machine", cfg.Machine),
+		slog.Any("error", kvmErr))
+
+	return Warning{Code: WarningKVMUnavailable, Message: message}
+}
+
+// supportsMachine returns true if the QEMU executable of the given config
+// provides the given machine type with virtio-mmio devices and the kernel is
+// known to support them. Unlike [detectTransportType], an unknown kernel
+// config is not good enough, as the default machine type works with more
+// kernels.
+func supportsMachine(ctx context.Context, cfg Qemu, machine string) bool {
+	transport := qemu.TransportTypeMMIO
+
+	devices, err := qemu.AvailableDevices(ctx, cfg.Executable, machine)
+	if err != nil || !devices[transport.Device()] {
+		return false
+	}
+
+	kernelConfig, err := readKernelConfig(cfg)
+	if err != nil {
+		if !errors.Is(err, sys.ErrNoKernelConfig) {
+			slog.Debug("Reading kernel config failed", slog.Any("error", err))
+		}
+
+		return false
+	}
+
+	return kernelConfig.Enabled(transport.KernelConfigOptions()...)
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyEmulationDefaults(t *testing.T) {
+	// The fake QEMU prints the device help output with the virtio-mmio
+	// serial device.
+	fakeQemu := filepath.Join(t.TempDir(), "qemu-system-x86_64")
+	err := os.WriteFile(fakeQemu, []byte("#!/bin/sh\n"+
+		"echo 'name \"virtio-serial-device\", bus virtio-bus'\n"), 0o700)
+	require.NoError(t, err)
+
+	mmioConfig := filepath.Join(t.TempDir(), "config")
+	err = os.WriteFile(mmioConfig,
+		[]byte("CONFIG_VIRTIO_MMIO=y\nCONFIG_VIRTIO_CONSOLE=y\n"), 0o600)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		arch              sys.Arch
+		kernelConfig      string
+		lightMachine      bool
+		expectedMachine   string
+		expectedTransport qemu.TransportType
+	}{
+		{
+			name:              "light machine",
+			arch:              sys.AMD64,
+			kernelConfig:      mmioConfig,
+			lightMachine:      true,
+			expectedMachine:   "microvm",
+			expectedTransport: qemu.TransportTypeMMIO,
+		},
+		{
+			name:              "machine set explicitly",
+			arch:              sys.AMD64,
+			kernelConfig:      mmioConfig,
+			expectedMachine:   "q35",
+			expectedTransport: qemu.TransportTypePCI,
+		},
+		{
+			name:              "kernel config unknown",
+			arch:              sys.AMD64,
+			lightMachine:      true,
+			expectedMachine:   "q35",
+			expectedTransport: qemu.TransportTypePCI,
+		},
+		{
+			name:              "no lighter machine",
+			arch:              sys.ARM64,
+			kernelConfig:      mmioConfig,
+			lightMachine:      true,
+			expectedMachine:   "q35",
+			expectedTransport: qemu.TransportTypePCI,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Qemu{
+				Executable:       fakeQemu,
+				Kernel:           filepath.Join(t.TempDir(), "missing"),
+				KernelConfig:     tt.kernelConfig,
+				Machine:          "q35",
+				TransportType:    qemu.TransportTypePCI,
+				HeartbeatTimeout: time.Second,
+			}
+
+			warning := applyEmulationDefaults(context.Background(), &cfg,
+				tt.arch, errors.New("no kvm"), tt.lightMachine)
+
+			assert.Equal(t, WarningKVMUnavailable, warning.Code)
+			assert.Contains(t, warning.Message, "no kvm")
+			assert.Equal(t, 10*time.Second, cfg.HeartbeatTimeout)
+			assert.Equal(t, tt.expectedMachine, cfg.Machine)
+			assert.Equal(t, tt.expectedTransport, cfg.TransportType)
+		})
+	}
+}
+
+func TestCheckKVM_NoKVM(t *testing.T) {
+	spec := &Spec{Qemu: Qemu{NoKVM: true}}
+	assert.NoError(t, CheckKVM(spec))
+}
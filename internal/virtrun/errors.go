@@ -3,3 +3,55 @@
 // SPDX-License-Identifier: GPL-3.0-or-later
 
 package virtrun
+
+import "errors"
+
+var (
+	// ErrUnknownMethod is returned if the guest sends a request with an
+	// unknown method.
+	ErrUnknownMethod = errors.New("unknown method")
+
+	// ErrUnknownStream is returned if the guest sends a stream with an
+	// unknown name on the control console.
+	ErrUnknownStream = errors.New("unknown stream")
+
+	// ErrArchMismatch is returned if the main binary does not have the
+	// required architecture.
+	ErrArchMismatch = errors.New("architecture mismatch")
+
+	// ErrFileConflict is returned if multiple files would be added to the
+	// initramfs with the same path.
+	ErrFileConflict = errors.New("file conflict")
+
+	// ErrInvalidFileTarget is returned if the target of a [FileTarget] is
+	// neither an absolute guest path nor a plain file name.
+	ErrInvalidFileTarget = errors.New("invalid file target")
+
+	// ErrUnsupportedFileType is returned if a file can not be added to the
+	// initramfs, like sockets or device files.
+	ErrUnsupportedFileType = errors.New("unsupported file type")
+
+	// ErrInitramfsTooLarge is returned if the initramfs archive does not fit
+	// into the guest memory along with its unpacked content.
+	ErrInitramfsTooLarge = errors.New("initramfs too large for guest memory")
+
+	// ErrKernelConfigMissing is returned along with the error of a run that
+	// failed before the guest system started, if the kernel lacks options
+	// the guest system requires. See [MissingKernelConfigOptions].
+	ErrKernelConfigMissing = errors.New("kernel config options missing")
+
+	// ErrVirtiofsdNotFound is returned if the host's root directory should
+	// be shared, but virtiofsd is not found.
+	ErrVirtiofsdNotFound = errors.New("virtiofsd not found")
+
+	// ErrVirtiofsdExited is returned if virtiofsd exits before it is ready.
+	ErrVirtiofsdExited = errors.New("exited before ready")
+
+	// ErrVirtiofsdTimeout is returned if virtiofsd takes too long to get
+	// ready.
+	ErrVirtiofsdTimeout = errors.New("timeout waiting for socket")
+
+	// ErrUnknownForward is returned if the guest requests a forward that is
+	// not configured.
+	ErrUnknownForward = errors.New("unknown forward")
+)
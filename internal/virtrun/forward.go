@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aibor/virtrun/internal/forward"
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/sysinit"
+)
+
+// forwardDialTimeout is the time connecting to the host address of a
+// [Forward] may take.
+const forwardDialTimeout = 5 * time.Second
+
+// Forward is a host socket exposed in the guest.
+type Forward struct {
+	// Guest is the address the guest listens on.
+	Guest forward.Address
+
+	// Host is the address connections are forwarded to.
+	Host forward.Address
+}
+
+// forwarder connects to the host addresses of [Forward]s for connections the
+// guest accepted.
+type forwarder struct {
+	forwards []Forward
+	bridges  forward.Bridges
+}
+
+// handle is the [qemu.ControlHandler] for [sysinit.HostMethodForward]. Once
+// connected, the data read from the connection is sent to the guest in the
+// background.
+func (f *forwarder) handle(
+	w *pipe.Writer,
+	_ string,
+	params json.RawMessage,
+) (any, error) {
+	var p sysinit.ForwardParams
+
+	err := json.Unmarshal(params, &p)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if p.Index < 0 || p.Index >= len(f.forwards) ||
+		!strings.HasPrefix(p.Stream, sysinit.ForwardStreamPrefix) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownForward, p.Index)
+	}
+
+	address := f.forwards[p.Index].Host
+
+	conn, err := net.DialTimeout(address.Network(), address.Address(),
+		forwardDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect %s: %w", address, err)
+	}
+
+	f.bridges.Add(p.Stream, conn)
+
+	go func() {
+		err := f.bridges.Send(w, p.Stream)
+		if err != nil {
+			slog.Debug("Forward stopped", slog.Any("error", err))
+		}
+	}()
+
+	return nil, nil //nolint:nilnil
+}
+
+// guestAddresses returns the guest addresses of the given forwards in the
+// format of [sysinit.ParamForward].
+func guestAddresses(forwards []Forward) string {
+	addresses := make([]string, len(forwards))
+	for idx, forward := range forwards {
+		addresses[idx] = forward.Guest.String()
+	}
+
+	return strings.Join(addresses, ";")
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/forward"
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwarder(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "db.sock")
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = listener.Close() })
+
+	fwd := &forwarder{
+		forwards: []Forward{
+			{
+				Guest: "tcp:127.0.0.1:5432",
+				Host:  forward.Address("unix:" + socket),
+			},
+		},
+	}
+
+	handle := func(params sysinit.ForwardParams) error {
+		data, err := json.Marshal(params)
+		require.NoError(t, err)
+
+		_, err = fwd.handle(pipe.NewWriter(io.Discard),
+			sysinit.HostMethodForward, data)
+
+		return err
+	}
+
+	t.Run("connect", func(t *testing.T) {
+		err := handle(sysinit.ForwardParams{Index: 0, Stream: "forward:1"})
+		require.NoError(t, err)
+
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		_, err = fwd.bridges.Open("forward:1")
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown index", func(t *testing.T) {
+		err := handle(sysinit.ForwardParams{Index: 1, Stream: "forward:2"})
+		require.ErrorIs(t, err, ErrUnknownForward)
+	})
+
+	t.Run("unknown stream", func(t *testing.T) {
+		err := handle(sysinit.ForwardParams{Index: 0, Stream: "file:x"})
+		require.ErrorIs(t, err, ErrUnknownForward)
+	})
+}
+
+func TestNewCommandSpec_Forwards(t *testing.T) {
+	cfg := Qemu{
+		TransportType: qemu.TransportTypePCI,
+		Forwards: []Forward{
+			{Guest: "tcp:127.0.0.1:5432", Host: "unix:/run/db.sock"},
+			{Guest: "unix:/run/cache.sock", Host: "tcp:localhost:6379"},
+		},
+	}
+
+	cmdSpec := newCommandSpec(cfg, "initramfs", mainProcess, &RunResult{})
+
+	assert.True(t, cmdSpec.ControlConsole)
+	assert.NotNil(t, cmdSpec.ControlHandler)
+	assert.Contains(t, cmdSpec.KernelParams,
+		"virtrun.forward=tcp:127.0.0.1:5432;unix:/run/cache.sock")
+
+	_, err := cmdSpec.ControlHandler(pipe.NewWriter(io.Discard),
+		sysinit.HostMethodPush, nil)
+	assert.ErrorIs(t, err, ErrUnknownMethod)
+}
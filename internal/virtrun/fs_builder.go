@@ -40,10 +40,14 @@ func (b *fsBuilder) symlink(target, name string) error {
 	return b.fs.Symlink(target, name) //nolint:wrapcheck
 }
 
+// addFilePathAs adds the host file at source as name. Its metadata is read
+// without opening it, so only its content is read once the archive is
+// written.
 func (b *fsBuilder) addFilePathAs(name, source string) error {
-	return b.add(name, func() (fs.File, error) {
-		return os.Open(source)
-	})
+	openFn := func() (fs.File, error) { return os.Open(source) }
+	statFn := func() (fs.FileInfo, error) { return os.Stat(source) }
+
+	return b.fs.AddWithStat(name, openFn, statFn) //nolint:wrapcheck
 }
 
 func (b *fsBuilder) addFilesTo(dir string, files []string, fn nameFunc) error {
@@ -64,6 +68,112 @@ func (b *fsBuilder) addFilesTo(dir string, files []string, fn nameFunc) error {
 	return nil
 }
 
+// linkFilesTo adds symbolic links to the given files in dir, which must have
+// been added to targetDir with the same name function.
+func (b *fsBuilder) linkFilesTo(
+	dir, targetDir string,
+	files []string,
+	fn nameFunc,
+) error {
+	err := b.mkdirAll(dir)
+	if err != nil {
+		return err
+	}
+
+	for idx, path := range files {
+		name := fn(idx, path)
+
+		err := b.symlink(filepath.Join(targetDir, name), filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addTree adds the file or directory tree at source as name. Regular files,
+// directories and symbolic links are supported.
+func (b *fsBuilder) addTree(name, source string) error {
+	err := b.mkdirAll(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+
+	walkFn := func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		dst := filepath.Join(name, rel)
+
+		switch entry.Type() {
+		case fs.ModeDir:
+			return b.mkdirAll(dst)
+		case fs.ModeSymlink:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			return b.symlink(target, dst)
+		case 0:
+			return b.addFilePathAs(dst, path)
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedFileType, path)
+		}
+	}
+
+	err = filepath.WalkDir(source, walkFn)
+	if err != nil {
+		return fmt.Errorf("walk: %w", err)
+	}
+
+	return nil
+}
+
+// addFS adds all files of the given [fs.FS] with their path in it. Regular
+// files, directories and symbolic links are supported. Symbolic links require
+// the [fs.FS] to implement [initramfs.ReadLinkFS].
+func (b *fsBuilder) addFS(fsys fs.FS) error {
+	walkFn := func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch entry.Type() {
+		case fs.ModeDir:
+			return b.mkdirAll(name)
+		case fs.ModeSymlink:
+			target, err := initramfs.ReadLink(fsys, name)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			return b.symlink(target, name)
+		case 0:
+			openFn := func() (fs.File, error) { return fsys.Open(name) }
+			statFn := func() (fs.FileInfo, error) { return fs.Stat(fsys, name) }
+
+			return b.fs.AddWithStat(name, openFn, statFn) //nolint:wrapcheck
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedFileType, name)
+		}
+	}
+
+	err := fs.WalkDir(fsys, ".", walkFn)
+	if err != nil {
+		return fmt.Errorf("walk: %w", err)
+	}
+
+	return nil
+}
+
 func (b *fsBuilder) symlinkTo(dir string, paths []string) error {
 	for _, path := range paths {
 		if path == dir {
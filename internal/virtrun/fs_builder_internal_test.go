@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/aibor/virtrun/internal/initramfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSBuilder_AddTree(t *testing.T) {
+	src := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(src, "sub", "input.txt"), []byte("input"), 0o600,
+	))
+	require.NoError(t, os.Symlink("sub/input.txt", filepath.Join(src, "link")))
+
+	t.Run("directory", func(t *testing.T) {
+		irfs := initramfs.New()
+		builder := fsBuilder{irfs}
+
+		err := builder.addTree("srv/testdata", src)
+		require.NoError(t, err)
+
+		data, err := fs.ReadFile(irfs, "srv/testdata/sub/input.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "input", string(data))
+
+		target, err := irfs.ReadLink("srv/testdata/link")
+		require.NoError(t, err)
+		assert.Equal(t, "sub/input.txt", target)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		irfs := initramfs.New()
+		builder := fsBuilder{irfs}
+
+		source := filepath.Join(src, "sub", "input.txt")
+
+		err := builder.addTree("etc/input.txt", source)
+		require.NoError(t, err)
+
+		data, err := fs.ReadFile(irfs, "etc/input.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "input", string(data))
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		dir := t.TempDir()
+
+		listener, err := net.Listen("unix", filepath.Join(dir, "sock"))
+		require.NoError(t, err)
+
+		t.Cleanup(func() { _ = listener.Close() })
+
+		builder := fsBuilder{initramfs.New()}
+
+		err = builder.addTree("srv", dir)
+		assert.ErrorIs(t, err, ErrUnsupportedFileType)
+	})
+}
+
+func TestFSBuilder_AddFS(t *testing.T) {
+	content := fstest.MapFS{
+		"etc/app/config.json": {Data: []byte("{}")},
+		"data/fixture.txt":    {Data: []byte("fixture")},
+	}
+
+	t.Run("merged", func(t *testing.T) {
+		irfs := initramfs.New()
+		builder := fsBuilder{irfs}
+
+		require.NoError(t, builder.mkdirAll("data"))
+		require.NoError(t, builder.addFilePathAs("data/other", os.Args[0]))
+
+		err := builder.addFS(content)
+		require.NoError(t, err)
+
+		data, err := fs.ReadFile(irfs, "etc/app/config.json")
+		require.NoError(t, err)
+		assert.Equal(t, "{}", string(data))
+
+		entries, err := fs.ReadDir(irfs, "data")
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		builder := fsBuilder{initramfs.New()}
+
+		require.NoError(t, builder.mkdirAll("data"))
+		require.NoError(t, builder.addFilePathAs("data/fixture.txt", os.Args[0]))
+
+		err := builder.addFS(content)
+		assert.ErrorIs(t, err, initramfs.ErrFileExist)
+	})
+}
+
+func TestFSBuilder_LinkFilesTo(t *testing.T) {
+	irfs := initramfs.New()
+	builder := fsBuilder{irfs}
+
+	files := []string{"/usr/bin/jq", "/opt/tools/helper"}
+
+	err := builder.linkFilesTo("/usr/local/bin", "/data", files, baseName)
+	require.NoError(t, err)
+
+	target, err := irfs.ReadLink("usr/local/bin/helper")
+	require.NoError(t, err)
+	assert.Equal(t, "/data/helper", target)
+}
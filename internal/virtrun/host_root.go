@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/sysinit"
+)
+
+const (
+	// hostRootTag is the virtiofs tag the host's root directory is shared
+	// with.
+	hostRootTag = "hostroot"
+
+	// virtiofsdExecutable is the daemon serving shared directories to
+	// vhost-user-fs devices.
+	virtiofsdExecutable = "virtiofsd"
+
+	// virtiofsdSocketName is the file name of the socket of virtiofsd.
+	virtiofsdSocketName = "virtiofsd.sock"
+
+	// virtiofsdStartTimeout is the time virtiofsd may take to create its
+	// socket.
+	virtiofsdStartTimeout = 5 * time.Second
+)
+
+// virtiofsdPaths are the locations distributions install virtiofsd to, which
+// are usually not in PATH.
+var virtiofsdPaths = []string{
+	"/usr/libexec/virtiofsd",
+	"/usr/lib/qemu/virtiofsd",
+	"/usr/lib/virtiofsd",
+}
+
+// findVirtiofsd returns the path of the virtiofsd executable. The given one
+// is returned, if set. Otherwise it is looked up in PATH and in
+// [virtiofsdPaths].
+func findVirtiofsd(executable string) (string, error) {
+	if executable != "" {
+		return executable, nil
+	}
+
+	path, err := exec.LookPath(virtiofsdExecutable)
+	if err == nil {
+		return path, nil
+	}
+
+	for _, path := range virtiofsdPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", ErrVirtiofsdNotFound
+}
+
+// startVirtiofsd starts virtiofsd sharing the host's root directory
+// read-only. Its socket is created in the given directory. It returns once
+// the socket exists, along with the socket path and a function that stops
+// virtiofsd. virtiofsd exits on its own once QEMU disconnects.
+func startVirtiofsd(
+	ctx context.Context,
+	executable string,
+	dir string,
+) (string, func(), error) {
+	executable, err := findVirtiofsd(executable)
+	if err != nil {
+		return "", nil, err
+	}
+
+	socket := filepath.Join(dir, virtiofsdSocketName)
+
+	cmd := exec.CommandContext(ctx, executable,
+		"--socket-path="+socket,
+		"--shared-dir=/",
+		"--readonly",
+		"--sandbox=none",
+		"--cache=auto",
+	)
+
+	slog.Debug("virtiofsd command", slog.String("command", cmd.String()))
+
+	err = cmd.Start()
+	if err != nil {
+		return "", nil, fmt.Errorf("start virtiofsd: %w", err)
+	}
+
+	var waitErr error
+
+	exited := make(chan struct{})
+
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+
+	stop := func() {
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+
+	err = waitForSocket(socket, exited)
+	if err != nil {
+		stop()
+		return "", nil, fmt.Errorf("virtiofsd: %w", errors.Join(err, waitErr))
+	}
+
+	return socket, stop, nil
+}
+
+// waitForSocket waits until the socket at the given path exists. It fails if
+// the process that creates it exits before or if it takes longer than
+// [virtiofsdStartTimeout].
+func waitForSocket(path string, exited <-chan struct{}) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	timeout := time.After(virtiofsdStartTimeout)
+
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-exited:
+			return ErrVirtiofsdExited
+		case <-timeout:
+			return ErrVirtiofsdTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// shareHostRoot changes the given [qemu.CommandSpec] to share the host's root
+// directory served by virtiofsd on the given socket. The init runs the main
+// binary chrooted into it. See [sysinit.ParamHostRoot].
+func shareHostRoot(cmdSpec *qemu.CommandSpec, socket string) {
+	cmdSpec.VirtioFS = append(cmdSpec.VirtioFS, qemu.VirtioFS{
+		Tag:    hostRootTag,
+		Socket: socket,
+	})
+	cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+		sysinit.ParamHostRoot+"="+hostRootTag)
+}
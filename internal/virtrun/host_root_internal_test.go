@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVirtiofsd creates the socket file given by flag "--socket-path" and
+// waits to be killed.
+const fakeVirtiofsd = `#!/bin/sh
+for arg; do
+	case "$arg" in
+	--socket-path=*) touch "${arg#--socket-path=}" ;;
+	esac
+done
+exec sleep 60
+`
+
+func writeScript(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "virtiofsd")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o755))
+
+	return path
+}
+
+func TestFindVirtiofsd(t *testing.T) {
+	path, err := findVirtiofsd("/opt/virtiofsd")
+	require.NoError(t, err)
+	assert.Equal(t, "/opt/virtiofsd", path)
+}
+
+func TestStartVirtiofsd(t *testing.T) {
+	executable := writeScript(t, fakeVirtiofsd)
+	dir := t.TempDir()
+
+	socket, stop, err := startVirtiofsd(context.Background(), executable, dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(dir, virtiofsdSocketName), socket)
+	assert.FileExists(t, socket)
+
+	stop()
+}
+
+func TestStartVirtiofsd_Exited(t *testing.T) {
+	executable := writeScript(t, "#!/bin/sh\nexit 1\n")
+
+	_, _, err := startVirtiofsd(context.Background(), executable,
+		t.TempDir())
+	require.ErrorIs(t, err, ErrVirtiofsdExited)
+}
@@ -7,39 +7,159 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/aibor/virtrun/sysinit"
 )
 
+// imageRoot is the directory virtrun adds the root file system of an OCI
+// image to, if one is given.
+const imageRoot = "/rootfs"
+
+// hostRoot is the directory the root file system of the host is mounted to
+// with a writable overlay, if it is shared with the guest. The layers of the
+// overlay are mounted below hostRootLayers.
+const (
+	hostRoot       = "/hostroot"
+	hostRootLayers = "/overlay"
+)
+
+// imagePath is the PATH environment variable for binaries run chrooted into
+// the root file system of an image or the host. The directory of the
+// additional files is bind mounted into it.
+const imagePath = "/data:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:" +
+	"/sbin:/bin"
+
 func main() {
-	cfg := sysinit.DefaultConfig()
-	cfg.ModulesDir = "/lib/modules"
-	// Set PATH environment variable to the directory all additional files
-	// are written to by virtrun.
-	cfg.Env["PATH"] = "/data"
-
-	sysinit.Main(cfg, func() (int, error) {
-		// "/main" is the file virtrun copies the given binary to.
-		cmd := exec.Command("/main", os.Args[1:]...)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		var exitErr *exec.ExitError
-
-		err := cmd.Run()
+	// The init config is read before the system is set up, so its
+	// environment variables are set along with the others and the ones given
+	// by the host take precedence. The initramfs is unpacked already, so the
+	// file is available.
+	initCfg, initCfgErr := sysinit.ReadInitConfig(sysinit.InitConfigFile)
+
+	// The system is set up for the additional files written by virtrun, like
+	// with PATH set to their directories. Files pushed at runtime are in
+	// "/data" only.
+	sysinit.DefaultRun(func() (int, error) {
+		if initCfgErr != nil {
+			return -1, fmt.Errorf("init config: %w", initCfgErr)
+		}
+
+		params, err := sysinit.ReadCmdline()
 		if err != nil {
-			if errors.As(err, &exitErr) {
-				return exitErr.ExitCode(), nil
+			return -1, err
+		}
+
+		opts := sysinit.ExecOptions{
+			PTY: params.Has(sysinit.ParamPTY),
+		}
+
+		if value, exists := params[sysinit.ParamOOMScoreAdj]; exists {
+			opts.OOMScoreAdj, err = strconv.Atoi(value)
+			if err != nil {
+				return -1, fmt.Errorf("parse oom score adj: %w", err)
 			}
+		}
 
-			return -1, fmt.Errorf("main: %w", err)
+		if value, exists := params[sysinit.ParamUserNamespace]; exists {
+			mappings := []sysinit.IDMapping{sysinit.DefaultIDMapping}
+
+			if value != "" {
+				mappings, err = sysinit.ParseIDMappings(value)
+				if err != nil {
+					return -1, fmt.Errorf("parse user namespace: %w", err)
+				}
+			}
+
+			opts.UserNamespace = &sysinit.UserNamespace{
+				UIDMappings: mappings,
+				GIDMappings: mappings,
+			}
+		}
+
+		// The debug tool writes its output into the debug dir, which must
+		// exist.
+		if value, exists := params[sysinit.ParamDebugTool]; exists {
+			opts.Wrapper = strings.Split(value, ";")
+
+			err := os.MkdirAll(sysinit.DebugDir, 0o755)
+			if err != nil {
+				return -1, fmt.Errorf("create debug dir: %w", err)
+			}
+		}
+
+		// Steps of the init config run before the main binary is chrooted,
+		// so they see the initramfs as root.
+		err = initCfg.RunSteps()
+		if err != nil {
+			return -1, fmt.Errorf("init config: %w", err)
+		}
+
+		// Units run after the steps. Services keep running while the main
+		// binary runs.
+		units, err := initCfg.StartUnits()
+		if err != nil {
+			return -1, fmt.Errorf("init config: %w", err)
+		}
+
+		// The main binary is run chrooted into the root file system of the
+		// host, if it is shared, or of the image, if there is one. The
+		// special file systems and the directory of the additional files are
+		// made available in it. The host's root file system does not contain
+		// the main binary, so it is made available as well.
+		bindPaths := []string{"/dev", "/proc", "/sys", "/run", "/tmp", "/data"}
+
+		if tag, exists := params[sysinit.ParamHostRoot]; exists {
+			err := sysinit.MountOverlayRoot(tag, hostRoot, hostRootLayers)
+			if err != nil {
+				return -1, fmt.Errorf("host root: %w", err)
+			}
+
+			opts.Root = hostRoot
+			bindPaths = append(bindPaths, "/main")
+		} else if _, err := os.Stat(imageRoot); err == nil {
+			opts.Root = imageRoot
+		}
+
+		if opts.Root != "" {
+			err := sysinit.BindMountInto(opts.Root, bindPaths...)
+			if err != nil {
+				return -1, fmt.Errorf("root: %w", err)
+			}
+
+			err = os.Setenv("PATH", imagePath)
+			if err != nil {
+				return -1, fmt.Errorf("set root PATH: %w", err)
+			}
+		}
+
+		// "/main" is the file virtrun copies the given binary to. With an
+		// image, it is copied into its root file system. With the host's
+		// root file system, it is bind mounted into it. A job of the host
+		// replaces it. Its binary is in "/data", which is available in all
+		// roots.
+		binary, args := "/main", slices.Concat(initCfg.Args, os.Args[1:])
+
+		if job, exists := sysinit.CurrentJob(); exists {
+			binary, args = job.Binary, slices.Concat(initCfg.Args, job.Args)
+		}
+
+		exitCode, err := sysinit.Exec(binary, args, opts)
+
+		// Failing units after the main binary do not change its result, as
+		// they are not related to it.
+		if unitsErr := units.Finish(); unitsErr != nil {
+			sysinit.PrintWarning(fmt.Errorf("units: %w", unitsErr))
+		}
+
+		if err != nil {
+			return exitCode, fmt.Errorf("main: %w", err)
 		}
 
-		return 0, nil
-	})
+		return exitCode, nil
+	}, sysinit.WithEnv(initCfg.Env))
 }
@@ -6,34 +6,46 @@ package virtrun
 
 import (
 	"embed"
+	"fmt"
 	"io/fs"
 	"path/filepath"
 
 	"github.com/aibor/virtrun/internal/sys"
 )
 
-// Pre-compile init programs for all supported architectures. Statically linked
-// so they can be used on any host platform.
+// Pre-compiled init programs are statically linked so they can be used on any
+// host platform. Each is embedded by its own file, so build tags select the
+// ones virtrun is built with:
 //
-//go:generate env CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -buildvcs=false -trimpath -ldflags "-s -w" -o bin/amd64 ./init/
-//go:generate env CGO_ENABLED=0 GOOS=linux GOARCH=arm64 go build -buildvcs=false -trimpath -ldflags "-s -w" -o bin/arm64 ./init/
-//go:generate env CGO_ENABLED=0 GOOS=linux GOARCH=riscv64 go build -buildvcs=false -trimpath -ldflags "-s -w" -o bin/riscv64 ./init/
+//   - By default, the ones for amd64, arm64 and riscv64 are embedded.
+//   - virtrun_bigendian adds the ones for s390x and mips64.
+//   - virtrun_native embeds only the one for the GOARCH virtrun is built
+//     for.
+//   - virtrun_noinit embeds none, for use in standalone mode only.
+//
+// The go:generate directives are in the same files, so "go generate" builds
+// the init programs selected by the given build tags.
 
-// Embed pre-compiled init programs explicitly to trigger build time errors.
+// initProgs are the embedded pre-compiled init programs by arch. Each contains
+// the file "bin/<arch>".
 //
-//go:embed bin/*
-var initsFS embed.FS
+//nolint:gochecknoglobals
+var initProgs = map[sys.Arch]embed.FS{}
 
 // initProgFor returns the pre-built init binary for the arch.
 //
 // The init binary is supposed to set up the system and execute the file
-// "/main". The returned file name can be opened with initFS.Open.
+// "/main".
 func initProgFor(arch sys.Arch) (fs.File, error) {
-	name := filepath.Join("bin", arch.String())
+	fsys, exists := initProgs[arch]
+	if !exists {
+		return nil, fmt.Errorf("%w: no init program embedded for %s",
+			sys.ErrArchNotSupported, arch)
+	}
 
-	file, err := initsFS.Open(name)
+	file, err := fsys.Open(filepath.Join("bin", arch.String()))
 	if err != nil {
-		return nil, sys.ErrArchNotSupported
+		return nil, err //nolint:wrapcheck
 	}
 
 	return file, nil
@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !(virtrun_noinit || (virtrun_native && !amd64))
+
+package virtrun
+
+import (
+	"embed"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+//go:generate env CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -buildvcs=false -trimpath -ldflags "-s -w" -o bin/amd64 ./init/
+
+// Embed pre-compiled init program explicitly to trigger build time errors.
+//
+//go:embed bin/amd64
+var amd64InitFS embed.FS
+
+//nolint:gochecknoinits
+func init() {
+	initProgs[sys.AMD64] = amd64InitFS
+}
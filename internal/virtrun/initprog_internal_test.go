@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -31,7 +32,7 @@ func TestInits(t *testing.T) {
 		},
 		{
 			name:        "unknown arch",
-			arch:        "mips64",
+			arch:        "ppc64le",
 			expectedErr: sys.ErrArchNotSupported,
 		},
 	}
@@ -43,3 +44,22 @@ func TestInits(t *testing.T) {
 		})
 	}
 }
+
+func TestInits_BuildTags(t *testing.T) {
+	arches := []sys.Arch{sys.AMD64, sys.ARM64, sys.RISCV64, sys.S390X, sys.MIPS64}
+
+	for _, arch := range arches {
+		t.Run(string(arch), func(t *testing.T) {
+			file, err := initProgFor(arch)
+
+			// Which ones are embedded depends on the build tags.
+			if _, embedded := initProgs[arch]; !embedded {
+				assert.ErrorIs(t, err, sys.ErrArchNotSupported)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+		})
+	}
+}
@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !(virtrun_noinit || (virtrun_native && !riscv64))
+
+package virtrun
+
+import (
+	"embed"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+//go:generate env CGO_ENABLED=0 GOOS=linux GOARCH=riscv64 go build -buildvcs=false -trimpath -ldflags "-s -w" -o bin/riscv64 ./init/
+
+// Embed pre-compiled init program explicitly to trigger build time errors.
+//
+//go:embed bin/riscv64
+var riscv64InitFS embed.FS
+
+//nolint:gochecknoinits
+func init() {
+	initProgs[sys.RISCV64] = riscv64InitFS
+}
@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build virtrun_bigendian && !(virtrun_noinit || (virtrun_native && !s390x))
+
+package virtrun
+
+import (
+	"embed"
+
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+//go:generate env CGO_ENABLED=0 GOOS=linux GOARCH=s390x go build -buildvcs=false -trimpath -ldflags "-s -w" -o bin/s390x ./init/
+
+// Embed pre-compiled init program explicitly to trigger build time errors.
+//
+//go:embed bin/s390x
+var s390xInitFS embed.FS
+
+//nolint:gochecknoinits
+func init() {
+	initProgs[sys.S390X] = s390xInitFS
+}
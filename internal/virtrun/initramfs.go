@@ -8,35 +8,98 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
 	"os"
+	"path"
 	"slices"
+	"strings"
 
 	"github.com/aibor/virtrun/internal/initramfs"
+	"github.com/aibor/virtrun/internal/ociimage"
 	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/internal/tracing"
+	"github.com/aibor/virtrun/sysinit"
+	"golang.org/x/sys/unix"
 )
 
 const (
-	dataDir    = "/data"
+	dataDir    = sysinit.DataDir
+	binDir     = sysinit.BinDir
 	libsDir    = "/lib"
-	modulesDir = "/lib/modules"
+	modulesDir = sysinit.ModulesDir
+	binfmtDir  = sysinit.BinfmtDir
+
+	// imageRootDir is the directory the root file system of an OCI image is
+	// added to. The init runs the main binary chrooted into it, if present.
+	imageRootDir = "/rootfs"
 )
 
+// DataFilePath returns the guest path of the additional file with the given
+// host path. See [Initramfs.Files].
+func DataFilePath(hostPath string) string {
+	return path.Join(dataDir, baseName(0, hostPath))
+}
+
 type Initramfs struct {
 	// Binary is the main binary that is either called directly or by the init
 	// program depending on the StandaloneInit flag.
 	Binary string
 
 	// Files is a list of any additional files that should be added to the
-	// dataDir directory. For ELF files the required dynamic libraries are
-	// added the libsDir directory.
+	// dataDir directory. They are linked into the binDir directory, so they
+	// can be run by name with the usual PATH as well. Their base names must
+	// be unique. For ELF files the required dynamic libraries are added the
+	// libsDir directory.
 	Files []string
 
+	// FileTargets are additional files that are added with a guest name
+	// different from their host name, like config files expected at a
+	// certain path. Targets that are plain file names are added to the
+	// dataDir directory and linked like Files. For ELF files the required
+	// dynamic libraries are added as well. See [Initramfs.AddFileAs].
+	FileTargets []FileTarget
+
 	// Modules is a list of kernel module files. They are added to the
 	// modulesDir directory.
 	Modules []string
 
+	// KernelModules is a list of kernel modules given by name, like "veth",
+	// or by path. Names are looked up in the [sys.ModulesDepFile] of
+	// KernelModulesDir. Modules they depend on are added as well, in the
+	// order they must be loaded. They are added after Modules.
+	KernelModules []string
+
+	// KernelModulesDir is the kernel modules directory of the kernel, like
+	// "/lib/modules/6.12.1". Required if KernelModules has names.
+	KernelModulesDir string
+
+	// BinfmtFiles is a list of binfmt_misc rule files in the format
+	// described in binfmt.d(5). They are added to the binfmtDir directory.
+	BinfmtFiles []string
+
+	// InitConfig is the path of a JSON file in the format of
+	// [sysinit.InitConfig]. It is added as [sysinit.InitConfigFile], so the
+	// init reads it. Not supported with StandaloneInit.
+	InitConfig string
+
+	// Volumes are host files and directory trees that are copied to their
+	// guest path.
+	Volumes []Volume
+
+	// Content is an additional tree of files, like an [embed.FS] or a
+	// [fstest.MapFS], that is merged into the root of the initramfs. Its
+	// paths are the guest paths, so files can not replace ones added
+	// otherwise. Shared libraries are not added for its ELF files.
+	Content fs.FS
+
+	// Image is the reference of an OCI image whose root file system is
+	// added to the imageRootDir directory. The main binary is copied into it
+	// and run chrooted into it. See [ociimage.Unpack] for the supported
+	// references.
+	Image string
+
 	// StandaloneInit determines if the main Binary should be called as init
 	// directly. The main binary is responsible for a clean shutdown of the
 	// system.
@@ -46,6 +109,97 @@ type Initramfs struct {
 	// returned by [BuildInitramfsArchive]. If set to true, the file is not
 	// removed. Instead, a log message with the file's path is printed.
 	Keep bool
+
+	// Output is the path the archive file is written to instead of a
+	// temporary file. An existing file is overwritten. The file is kept as
+	// if Keep is set.
+	Output string
+
+	// LibCacheDir is the directory the shared libraries resolved for the
+	// ELF files are cached in by the hash of each file's content. See
+	// [sys.LddCache]. If empty, libraries are resolved every time.
+	LibCacheDir string
+
+	// TempDir is the directory temporary files, like the archive file, are
+	// created in. The archive file is created in [os.TempDir] instead, if
+	// Keep is set. Default is [os.TempDir].
+	TempDir string
+
+	// NoMemfd determines if [Run] writes the archive file into TempDir
+	// instead of a memfd, like for QEMU builds that can not load the
+	// initramfs from a file descriptor path. A temporary file is used anyway,
+	// if Keep or Output is set or if memfds are not supported.
+	NoMemfd bool
+
+	// ProgressHandler is called with the progress of building the archive,
+	// if set. It is called at the start of each phase and for each file
+	// written into the archive. See [InitramfsProgress].
+	ProgressHandler func(InitramfsProgress)
+
+	// Archive is the path of a previously built archive file. If set, it is
+	// used by [Run] instead of building a new one and all other fields,
+	// except Binary, are ignored. It is never removed.
+	Archive string
+}
+
+// FileTarget is a host file that is added to the initramfs as the given
+// target. See [Initramfs.FileTargets].
+type FileTarget struct {
+	// Source is the absolute host path.
+	Source string
+
+	// Target is the absolute guest path or a plain file name.
+	Target string
+}
+
+// AddFileAs adds the host file at source as target, which is either an
+// absolute guest path, like "/etc/foo.conf", or a plain file name the file
+// is added with to the additional files. See [Initramfs.FileTargets].
+func (cfg *Initramfs) AddFileAs(source, target string) {
+	cfg.FileTargets = append(cfg.FileTargets, FileTarget{
+		Source: source,
+		Target: target,
+	})
+}
+
+// fileTargets returns the Files and FileTargets of the config split into
+// the ones added to the dataDir directory, whose targets are file names, and
+// the ones added at absolute guest paths.
+func (cfg Initramfs) fileTargets() ([]FileTarget, []FileTarget, error) {
+	var data, absolute []FileTarget
+
+	for _, file := range cfg.Files {
+		data = append(data, FileTarget{Source: file, Target: baseName(0, file)})
+	}
+
+	for _, file := range cfg.FileTargets {
+		switch {
+		case path.IsAbs(file.Target) && path.Clean(file.Target) != "/":
+			file.Target = path.Clean(file.Target)
+			absolute = append(absolute, file)
+		case file.Target != "" && file.Target != "." && file.Target != ".." &&
+			!strings.Contains(file.Target, "/"):
+			data = append(data, file)
+		default:
+			return nil, nil, fmt.Errorf("%w: %s: %q", ErrInvalidFileTarget,
+				file.Source, file.Target)
+		}
+	}
+
+	return data, absolute, nil
+}
+
+// Volume is a host file or directory tree that is copied into the initramfs.
+type Volume struct {
+	// Source is the absolute host path.
+	Source string
+
+	// Target is the absolute guest path.
+	Target string
+
+	// ReadOnly determines if the guest path is made read-only. This is done
+	// by the init, so it must be passed as [Qemu.ReadOnlyPaths] as well.
+	ReadOnly bool
 }
 
 // BuildInitramfsArchive creates a new initramfs CPIO archive file.
@@ -55,22 +209,40 @@ type Initramfs struct {
 // Kernel modules are added to modulesDir directory. For all ELF files the
 // dynamically linked shared objects are collected and added to the libsDir
 // directory. The paths to the directories they have been found at are added as
-// symlinks to the libsDir directory as well.
+// symlinks to the libsDir directory as well, like "/lib64" for the
+// interpreter. Libraries whose file name is not their SONAME are linked to by
+// their SONAME.
 //
-// The CPIO archive is written to [os.TempDir]. The path to the file is
-// returned along with a cleanup function. The caller is responsible to call
-// the function once the archive file is no longer needed.
+// The CPIO archive is written to [os.TempDir], unless [Initramfs.Output] is
+// set. The path to the file is returned along with a cleanup function. The
+// caller is responsible to call the function once the archive file is no
+// longer needed.
 func BuildInitramfsArchive(
 	ctx context.Context,
 	cfg Initramfs,
 	initFileOpenFn initramfs.FileOpenFunc,
 ) (string, func() error, error) {
-	irfs, err := buildInitramfsArchive(ctx, cfg, initFileOpenFn)
+	irfs, cleanup, err := buildInitramfsArchive(ctx, cfg, initFileOpenFn)
 	if err != nil {
 		return "", nil, err
 	}
+	defer cleanup()
+
+	var path string
+
+	if cfg.Output != "" {
+		path = cfg.Output
+		err = writeFSToFile(irfs, path, cfg.ProgressHandler)
+	} else {
+		// A kept archive file must outlive the temporary directory.
+		dir := cfg.TempDir
+		if cfg.Keep {
+			dir = ""
+		}
+
+		path, err = writeFSToTempFile(irfs, dir, cfg.ProgressHandler)
+	}
 
-	path, err := writeFSToTempFile(irfs, "")
 	if err != nil {
 		return "", nil, err
 	}
@@ -79,7 +251,7 @@ func BuildInitramfsArchive(
 
 	var removeFn func() error
 
-	if cfg.Keep {
+	if cfg.Keep || cfg.Output != "" {
 		removeFn = func() error {
 			slog.Info("Keep initramfs archive", slog.String("path", path))
 			return nil
@@ -94,19 +266,95 @@ func BuildInitramfsArchive(
 	return path, removeFn, nil
 }
 
+// buildInitramfsMemfd creates a new initramfs CPIO archive in a memfd like
+// [BuildInitramfsArchive] does, so it is never written to disk. The caller is
+// responsible to close the returned file. It returns an
+// [errors.ErrUnsupported] error if memfds are not supported.
+func buildInitramfsMemfd(
+	ctx context.Context,
+	cfg Initramfs,
+	initFileOpenFn initramfs.FileOpenFunc,
+) (*os.File, error) {
+	// The memfd is created first, so a fallback does not build twice.
+	fd, err := unix.MemfdCreate("initramfs", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("%w: memfd: %w", errors.ErrUnsupported, err)
+	}
+
+	file := os.NewFile(uintptr(fd), "memfd:initramfs")
+
+	irfs, cleanup, err := buildInitramfsArchive(ctx, cfg, initFileOpenFn)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	defer cleanup()
+
+	err = writeArchive(file, irfs, cfg.ProgressHandler)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	slog.Debug("Created initramfs archive in memfd")
+
+	return file, nil
+}
+
+// WriteInitramfsArchive creates a new initramfs CPIO archive file at the given
+// path like [BuildInitramfsArchive] does. The init program matches the
+// architecture of the main binary. An existing file is overwritten.
+func WriteInitramfsArchive(
+	ctx context.Context,
+	cfg Initramfs,
+	path string,
+) error {
+	arch, err := sys.ReadELFArch(cfg.Binary)
+	if err != nil {
+		return fmt.Errorf("read main binary arch: %w", err)
+	}
+
+	initFn := func() (fs.File, error) { return initProgFor(arch) }
+
+	irfs, cleanup, err := buildInitramfsArchive(ctx, cfg, initFn)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return writeFSToFile(irfs, path, cfg.ProgressHandler)
+}
+
 // buildInitramfsArchive creates a new CPIO archive file according to the given
-// [Initramfs] spec.
+// [Initramfs] spec. The returned cleanup function must be called once the
+// archive is written.
 func buildInitramfsArchive(
 	ctx context.Context,
 	cfg Initramfs,
 	initFileOpenFn initramfs.FileOpenFunc,
-) (*initramfs.FS, error) {
+) (*initramfs.FS, func(), error) {
 	binaryFiles := []string{cfg.Binary}
 	binaryFiles = append(binaryFiles, cfg.Files...)
 
-	libs, err := sys.CollectLibsFor(ctx, binaryFiles...)
+	for _, file := range cfg.FileTargets {
+		binaryFiles = append(binaryFiles, file.Source)
+	}
+
+	reportProgress(cfg.ProgressHandler,
+		InitramfsProgress{Phase: InitramfsPhaseLibs})
+
+	lddFn := sys.Ldd
+	if cfg.LibCacheDir != "" {
+		lddFn = sys.LddCache{Dir: cfg.LibCacheDir}.Ldd
+	}
+
+	libsCtx, span := tracing.Start(ctx, "resolve libs")
+	libs, err := sys.CollectLibsWith(libsCtx, lddFn, binaryFiles...)
+	span.SetError(err)
+	span.End()
+
 	if err != nil {
-		return nil, fmt.Errorf("collect libs: %w", err)
+		return nil, nil, fmt.Errorf("collect libs: %w", err)
 	}
 
 	initFn := func(b *fsBuilder, name string) error {
@@ -121,26 +369,78 @@ func buildInitramfsArchive(
 		}
 	}
 
-	irfs, err := buildInitramFS(cfg, libs, initFn)
+	imageDir, cleanup, err := unpackImage(ctx, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("build: %w", err)
+		return nil, nil, fmt.Errorf("image: %w", err)
 	}
 
-	return irfs, nil
+	reportProgress(cfg.ProgressHandler,
+		InitramfsProgress{Phase: InitramfsPhaseTree})
+
+	irfs, err := buildInitramFS(cfg, libs, imageDir, initFn)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("build: %w", err)
+	}
+
+	return irfs, cleanup, nil
+}
+
+// unpackImage unpacks the root file system of [Initramfs.Image] into a
+// temporary directory, if set. The image is used for the architecture of the
+// main binary. The returned cleanup function removes the directory.
+func unpackImage(
+	ctx context.Context,
+	cfg Initramfs,
+) (string, func(), error) {
+	if cfg.Image == "" {
+		return "", func() {}, nil
+	}
+
+	arch, err := sys.ReadELFArch(cfg.Binary)
+	if err != nil {
+		return "", nil, fmt.Errorf("read main binary arch: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(cfg.TempDir, "virtrun-rootfs-")
+	if err != nil {
+		return "", nil, err //nolint:wrapcheck
+	}
+
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	reportProgress(cfg.ProgressHandler,
+		InitramfsProgress{Phase: InitramfsPhaseImage})
+
+	ctx, span := tracing.Start(ctx, "unpack image")
+	span.SetAttr("image", cfg.Image)
+
+	err = ociimage.Unpack(ctx, cfg.Image, arch, dir)
+	span.SetError(err)
+	span.End()
+
+	if err != nil {
+		cleanup()
+		return "", nil, err //nolint:wrapcheck
+	}
+
+	return dir, cleanup, nil
 }
 
-// buildInitramFS creates a new [initramfs.FS].
+// buildInitramFS creates a new [initramfs.FS]. If imageDir is not empty, it
+// is added as root file system of an image with the main binary in it.
 //
 // It does not read any source files. Only the FS file tree is created.
 func buildInitramFS(
 	cfg Initramfs,
 	libs sys.LibCollection,
+	imageDir string,
 	initFn func(*fsBuilder, string) error,
 ) (*initramfs.FS, error) {
 	irfs := initramfs.New()
 	builder := fsBuilder{irfs}
 
-	err := builder.addFilePathAs("main", cfg.Binary)
+	err := addMain(&builder, cfg.Binary, imageDir)
 	if err != nil {
 		return nil, err
 	}
@@ -150,49 +450,285 @@ func buildInitramFS(
 		return nil, err
 	}
 
-	err = builder.addFilesTo(dataDir, cfg.Files, baseName)
+	dataFiles, absoluteFiles, err := cfg.fileTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	// The files are named by their targets, so renamed files conflict with
+	// the ones of the same name.
+	dataSources := make([]string, len(dataFiles))
+	for idx, file := range dataFiles {
+		dataSources[idx] = file.Source
+	}
+
+	dataName := func(idx int, _ string) string {
+		return dataFiles[idx].Target
+	}
+
+	err = checkNameConflicts(dataSources, dataName)
 	if err != nil {
 		return nil, err
 	}
 
-	err = builder.addFilesTo(modulesDir, cfg.Modules, modName)
+	err = builder.addFilesTo(dataDir, dataSources, dataName)
 	if err != nil {
 		return nil, err
 	}
 
+	err = builder.linkFilesTo(binDir, dataDir, dataSources, dataName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range absoluteFiles {
+		err = builder.mkdirAll(path.Dir(file.Target))
+		if err != nil {
+			return nil, err
+		}
+
+		err = builder.addFilePathAs(file.Target, file.Source)
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %w", file.Source, err)
+		}
+	}
+
+	modules, err := resolveKernelModules(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = builder.addFilesTo(modulesDir, modules, modName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.BinfmtFiles) > 0 {
+		err = builder.addFilesTo(binfmtDir, cfg.BinfmtFiles, modName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.InitConfig != "" {
+		err = builder.mkdirAll(path.Dir(sysinit.InitConfigFile))
+		if err != nil {
+			return nil, err
+		}
+
+		err = builder.addFilePathAs(sysinit.InitConfigFile, cfg.InitConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, volume := range cfg.Volumes {
+		err = builder.addTree(volume.Target, volume.Source)
+		if err != nil {
+			return nil, fmt.Errorf("volume %s: %w", volume.Source, err)
+		}
+	}
+
+	if cfg.Content != nil {
+		err = builder.addFS(cfg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("content: %w", err)
+		}
+	}
+
 	err = builder.addFilesTo(libsDir, slices.Collect(libs.Libs()), baseName)
 	if err != nil {
 		return nil, err
 	}
 
+	for name, target := range libs.Links() {
+		err = builder.symlink(target, path.Join(libsDir, name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = builder.symlinkTo(libsDir, slices.Collect(libs.SearchPaths()))
 	if err != nil && !errors.Is(err, initramfs.ErrFileExist) {
 		return nil, err
 	}
 
+	// Copied trees may have links to paths that exist only in the guest.
+	skip := []string{imageRootDir}
+	for _, volume := range cfg.Volumes {
+		skip = append(skip, volume.Target)
+	}
+
+	err = irfs.ResolveAll(skip...)
+	if err != nil {
+		return nil, fmt.Errorf("symbolic links: %w", err)
+	}
+
 	return irfs, nil
 }
 
+// resolveKernelModules returns the module files of the given config in the
+// order they are loaded: all Modules followed by the KernelModules and the
+// modules they depend on. Each file is returned once only.
+func resolveKernelModules(cfg Initramfs) ([]string, error) {
+	if len(cfg.KernelModules) == 0 {
+		return cfg.Modules, nil
+	}
+
+	modulesDep := &sys.ModulesDep{Dir: cfg.KernelModulesDir}
+
+	if cfg.KernelModulesDir != "" {
+		var err error
+
+		modulesDep, err = sys.ReadModulesDep(cfg.KernelModulesDir)
+		if err != nil {
+			return nil, fmt.Errorf("kernel modules: %w", err)
+		}
+	}
+
+	modules := slices.Clone(cfg.Modules)
+
+	for _, module := range cfg.KernelModules {
+		paths, err := modulesDep.Resolve(module)
+		if err != nil {
+			return nil, fmt.Errorf("kernel modules: %w", err)
+		}
+
+		for _, path := range paths {
+			if !slices.Contains(modules, path) {
+				modules = append(modules, path)
+			}
+		}
+	}
+
+	return modules, nil
+}
+
+// checkNameConflicts returns an [ErrFileConflict] if any of the given files
+// have the same name in the initramfs.
+func checkNameConflicts(files []string, fn nameFunc) error {
+	seen := make(map[string]string, len(files))
+
+	for idx, path := range files {
+		name := fn(idx, path)
+
+		if other, exists := seen[name]; exists {
+			return fmt.Errorf("%w: %s and %s both added as %s",
+				ErrFileConflict, other, path, name)
+		}
+
+		seen[name] = path
+	}
+
+	return nil
+}
+
+// addMain adds the main binary as "main". With an image, the main binary is
+// added to the root file system of the image and "main" links to it.
+func addMain(builder *fsBuilder, binary, imageDir string) error {
+	if imageDir == "" {
+		return builder.addFilePathAs("main", binary)
+	}
+
+	err := builder.addTree(imageRootDir, imageDir)
+	if err != nil {
+		return err
+	}
+
+	name := path.Join(imageRootDir, "main")
+
+	err = builder.addFilePathAs(name, binary)
+	if err != nil {
+		return err
+	}
+
+	return builder.symlink(strings.TrimPrefix(name, "/"), "main")
+}
+
+// writeFSToFile writes the [fs.FS] as CPIO archive into the file at the given
+// path. An existing file is overwritten.
+func writeFSToFile(
+	fsys fs.FS,
+	path string,
+	progress func(InitramfsProgress),
+) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create archive file: %w", err)
+	}
+	defer file.Close()
+
+	err = writeArchive(file, fsys, progress)
+	if err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+
+	return file.Close() //nolint:wrapcheck
+}
+
 // writeFSToTempFile writes the [fs.FS] as CPIO archive into a temporary file
 // and returns the absolute path to this file.
 //
-// If the given dir is not empty, th efile is create din this directory.
+// If the given dir is not empty, the file is created in this directory.
 // Otherwise the default tempdir is used. See [os.CreateTemp].
-func writeFSToTempFile(fsys fs.FS, dir string) (string, error) {
+func writeFSToTempFile(
+	fsys fs.FS,
+	dir string,
+	progress func(InitramfsProgress),
+) (string, error) {
 	file, err := os.CreateTemp(dir, "initramfs")
 	if err != nil {
 		return "", fmt.Errorf("create archive file: %w", err)
 	}
 	defer file.Close()
 
-	writer := initramfs.NewCPIOFSWriter(file)
-	defer writer.Close()
-
-	err = writer.AddFS(fsys)
+	err = writeArchive(file, fsys, progress)
 	if err != nil {
 		_ = os.Remove(file.Name())
-		return "", fmt.Errorf("write archive: %w", err)
+		return "", err
 	}
 
 	return file.Name(), nil
 }
+
+// writeArchive writes the [fs.FS] as CPIO archive to w. The progress is
+// reported to the given handler, if set.
+func writeArchive(
+	w io.Writer,
+	fsys fs.FS,
+	progress func(InitramfsProgress),
+) error {
+	writer := initramfs.NewCPIOFSWriter(w)
+	writer.Progress = func(files int, written int64) {
+		reportProgress(progress, InitramfsProgress{
+			Phase: InitramfsPhaseWrite,
+			Files: files,
+			Bytes: written,
+		})
+	}
+
+	reportProgress(progress, InitramfsProgress{Phase: InitramfsPhaseWrite})
+
+	err := writer.AddFS(fsys)
+	if err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+
+	slog.Debug("Wrote initramfs archive",
+		slog.Int("files", writer.Files()),
+		slog.Int64("bytes", writer.Written()))
+
+	reportProgress(progress, InitramfsProgress{
+		Phase: InitramfsPhaseDone,
+		Files: writer.Files(),
+		Bytes: writer.Written(),
+	})
+
+	return nil
+}
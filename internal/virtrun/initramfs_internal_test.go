@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/initramfs"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddMain(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "bin.test")
+	require.NoError(t, os.WriteFile(binary, []byte("main"), 0o755))
+
+	t.Run("without image", func(t *testing.T) {
+		irfs := initramfs.New()
+
+		err := addMain(&fsBuilder{irfs}, binary, "")
+		require.NoError(t, err)
+
+		data, err := fs.ReadFile(irfs, "main")
+		require.NoError(t, err)
+		assert.Equal(t, "main", string(data))
+	})
+
+	t.Run("with image", func(t *testing.T) {
+		imageDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(imageDir, "bin"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(imageDir, "bin", "sh"),
+			[]byte("sh"), 0o755))
+
+		irfs := initramfs.New()
+
+		err := addMain(&fsBuilder{irfs}, binary, imageDir)
+		require.NoError(t, err)
+
+		data, err := fs.ReadFile(irfs, "rootfs/main")
+		require.NoError(t, err)
+		assert.Equal(t, "main", string(data))
+
+		data, err = fs.ReadFile(irfs, "rootfs/bin/sh")
+		require.NoError(t, err)
+		assert.Equal(t, "sh", string(data))
+
+		target, err := irfs.ReadLink("main")
+		require.NoError(t, err)
+		assert.Equal(t, "rootfs/main", target)
+	})
+}
+
+func TestBuildInitramFS_InitConfig(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "bin.test")
+	initConfig := filepath.Join(dir, "init.json")
+
+	require.NoError(t, os.WriteFile(binary, []byte("main"), 0o755))
+	require.NoError(t, os.WriteFile(initConfig, []byte(`{}`), 0o600))
+
+	cfg := Initramfs{
+		Binary:     binary,
+		InitConfig: initConfig,
+	}
+
+	initFn := func(b *fsBuilder, name string) error {
+		return b.symlink("main", name)
+	}
+
+	irfs, err := buildInitramFS(cfg, sys.LibCollection{}, "", initFn)
+	require.NoError(t, err)
+
+	data, err := fs.ReadFile(irfs, "etc/virtrun/init.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(data))
+}
+
+func TestBuildInitramFS_Standalone(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "bin.test")
+	helper := filepath.Join(dir, "helper")
+
+	require.NoError(t, os.WriteFile(binary, []byte("main"), 0o755))
+	require.NoError(t, os.WriteFile(helper, []byte("helper"), 0o755))
+
+	cfg := Initramfs{
+		Binary:         binary,
+		Files:          []string{helper},
+		StandaloneInit: true,
+	}
+
+	// The main binary is the init in standalone mode.
+	initFn := func(b *fsBuilder, name string) error {
+		return b.symlink("main", name)
+	}
+
+	irfs, err := buildInitramFS(cfg, sys.LibCollection{}, "", initFn)
+	require.NoError(t, err)
+
+	target, err := irfs.ReadLink("init")
+	require.NoError(t, err)
+	assert.Equal(t, "main", target)
+
+	data, err := fs.ReadFile(irfs, "data/helper")
+	require.NoError(t, err)
+	assert.Equal(t, "helper", string(data))
+
+	target, err = irfs.ReadLink("usr/local/bin/helper")
+	require.NoError(t, err)
+	assert.Equal(t, "/data/helper", target)
+}
+
+func TestBuildInitramFS_FileTargets(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "bin.test")
+	config := filepath.Join(dir, "foo.conf")
+	tool := filepath.Join(dir, "tool-amd64")
+
+	require.NoError(t, os.WriteFile(binary, []byte("main"), 0o755))
+	require.NoError(t, os.WriteFile(config, []byte("config"), 0o600))
+	require.NoError(t, os.WriteFile(tool, []byte("tool"), 0o755))
+
+	initFn := func(b *fsBuilder, name string) error {
+		return b.symlink("main", name)
+	}
+
+	t.Run("targets", func(t *testing.T) {
+		cfg := Initramfs{Binary: binary}
+		cfg.AddFileAs(config, "/etc/app/foo.conf")
+		cfg.AddFileAs(tool, "tool")
+
+		irfs, err := buildInitramFS(cfg, sys.LibCollection{}, "", initFn)
+		require.NoError(t, err)
+
+		data, err := fs.ReadFile(irfs, "etc/app/foo.conf")
+		require.NoError(t, err)
+		assert.Equal(t, "config", string(data))
+
+		data, err = fs.ReadFile(irfs, "data/tool")
+		require.NoError(t, err)
+		assert.Equal(t, "tool", string(data))
+
+		target, err := irfs.ReadLink("usr/local/bin/tool")
+		require.NoError(t, err)
+		assert.Equal(t, "/data/tool", target)
+	})
+
+	t.Run("name conflict", func(t *testing.T) {
+		cfg := Initramfs{Binary: binary, Files: []string{config}}
+		cfg.AddFileAs(tool, "foo.conf")
+
+		_, err := buildInitramFS(cfg, sys.LibCollection{}, "", initFn)
+		require.ErrorIs(t, err, ErrFileConflict)
+	})
+
+	for _, target := range []string{"", "/", "etc/foo.conf", ".."} {
+		t.Run("invalid target "+target, func(t *testing.T) {
+			cfg := Initramfs{Binary: binary}
+			cfg.AddFileAs(config, target)
+
+			_, err := buildInitramFS(cfg, sys.LibCollection{}, "", initFn)
+			require.ErrorIs(t, err, ErrInvalidFileTarget)
+		})
+	}
+}
+
+func TestCheckNameConflicts(t *testing.T) {
+	err := checkNameConflicts([]string{"/usr/bin/jq", "/bin/sh"}, baseName)
+	require.NoError(t, err)
+
+	err = checkNameConflicts([]string{"/usr/bin/sh", "/bin/sh"}, baseName)
+	require.ErrorIs(t, err, ErrFileConflict)
+	assert.ErrorContains(t, err, "/usr/bin/sh and /bin/sh both added as sh")
+}
+
+func TestResolveKernelModules(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, sys.ModulesDepFile),
+		[]byte("kernel/bridge.ko: kernel/stp.ko kernel/llc.ko\n"+
+			"kernel/stp.ko: kernel/llc.ko\n"), 0o600)
+	require.NoError(t, err)
+
+	cfg := Initramfs{
+		Modules:          []string{"/tmp/custom.ko"},
+		KernelModules:    []string{"stp", "bridge", "/tmp/custom.ko"},
+		KernelModulesDir: dir,
+	}
+
+	actual, err := resolveKernelModules(cfg)
+	require.NoError(t, err)
+
+	expected := []string{
+		"/tmp/custom.ko",
+		filepath.Join(dir, "kernel/llc.ko"),
+		filepath.Join(dir, "kernel/stp.ko"),
+		filepath.Join(dir, "kernel/bridge.ko"),
+	}
+	assert.Equal(t, expected, actual)
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// WarningInitramfsLarge is the [Warning] code for runs whose initramfs
+// takes a large part of the guest memory.
+const WarningInitramfsLarge = "initramfs-large"
+
+const (
+	// initramfsMaxShare is the largest share of the guest memory an
+	// initramfs archive may have. The kernel keeps the archive in memory
+	// while it unpacks it into its root file system, which is in memory as
+	// well, so it needs at least twice the size. Larger archives make the
+	// kernel panic early with a message that does not point to the cause.
+	initramfsMaxShare = 2
+
+	// initramfsWarnShare is the share of the guest memory an initramfs
+	// archive is warned about at. The memory left may not suffice for the
+	// kernel and the binary.
+	initramfsWarnShare = 4
+)
+
+// hintInitramfsSize is appended to errors and warnings about large initramfs
+// archives.
+const hintInitramfsSize = "increase the memory, add fewer files or share " +
+	"the host's root file system instead"
+
+// size returns the size of the archive file in bytes.
+func (a archive) size() (int64, error) {
+	var (
+		info os.FileInfo
+		err  error
+	)
+
+	if a.file != nil {
+		info, err = a.file.Stat()
+	} else {
+		info, err = os.Stat(a.path)
+	}
+
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	return info.Size(), nil
+}
+
+// checkInitramfsSize returns an [ErrInitramfsTooLarge] error if an initramfs
+// archive of the given size in bytes does not fit into the given guest memory
+// in MB. If it fits, but takes a large part of it, a [Warning] is returned.
+// Otherwise, the returned warning is empty. If memory is 0, nothing is
+// checked.
+func checkInitramfsSize(size int64, memory uint64) (Warning, error) {
+	memoryBytes := memory << 20
+	if memoryBytes == 0 || size < 0 {
+		return Warning{}, nil
+	}
+
+	//nolint:gosec
+	sizeBytes := uint64(size)
+
+	switch {
+	case sizeBytes*initramfsMaxShare > memoryBytes:
+		return Warning{}, fmt.Errorf("%w: %d MB archive with %d MB memory, "+
+			"needs more than twice its size: %s", ErrInitramfsTooLarge,
+			sizeBytes>>20, memory, hintInitramfsSize)
+	case sizeBytes*initramfsWarnShare > memoryBytes:
+		slog.Warn("Initramfs takes a large part of the guest memory",
+			slog.Int64("size", size),
+			slog.Uint64("memory", memory))
+
+		return Warning{
+			Code: WarningInitramfsLarge,
+			Message: fmt.Sprintf("%d MB initramfs archive takes a large "+
+				"part of %d MB memory, the guest might run out of "+
+				"memory: %s", sizeBytes>>20, memory, hintInitramfsSize),
+		}, nil
+	default:
+		return Warning{}, nil
+	}
+}
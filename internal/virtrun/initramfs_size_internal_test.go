@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckInitramfsSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		size         int64
+		memory       uint64
+		expectedCode string
+		expectedErr  error
+	}{
+		{
+			name:   "small",
+			size:   10 << 20,
+			memory: 256,
+		},
+		{
+			name:         "large",
+			size:         100 << 20,
+			memory:       256,
+			expectedCode: WarningInitramfsLarge,
+		},
+		{
+			name:        "too large",
+			size:        129 << 20,
+			memory:      256,
+			expectedErr: ErrInitramfsTooLarge,
+		},
+		{
+			name: "memory unknown",
+			size: 1 << 30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning, err := checkInitramfsSize(tt.size, tt.memory)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedCode, warning.Code)
+		})
+	}
+}
+
+func TestArchive_Size(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "initramfs")
+	require.NoError(t, os.WriteFile(path, []byte("archive"), 0o600))
+
+	size, err := archive{path: path}.size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), size)
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = file.Close() })
+
+	size, err = archive{file: file}.size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), size)
+}
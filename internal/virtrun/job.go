@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/sysinit"
+)
+
+// Job is a binary run in a guest that is set up already, instead of the main
+// binary. See [Qemu.NextJob].
+type Job struct {
+	// Binary is the path of the binary on the host. It must be of the
+	// architecture of the guest. The shared libraries it requires are sent
+	// along with it.
+	Binary string
+
+	// Args are the arguments the binary is run with.
+	Args []string
+
+	// Env are additional environment variables in the form "KEY=VALUE".
+	Env []string
+}
+
+// JobFunc returns the [Job] the guest runs. It is called once the guest is
+// set up and may block until a job is available. If it returns an error, the
+// guest fails without running anything.
+type JobFunc func() (Job, error)
+
+// jobLibsFunc returns the ELF interpreter of the given binary and the shared
+// libraries it requires. The interpreter is empty if the binary is statically
+// linked.
+type jobLibsFunc func(binary string) (string, sys.LibCollection, error)
+
+// collectJobLibs is the [jobLibsFunc] resolving the libraries by [sys.Ldd].
+func collectJobLibs(binary string) (string, sys.LibCollection, error) {
+	interpreter, err := sys.ReadInterpreter(binary)
+	if errors.Is(err, sys.ErrNoInterpreter) ||
+		errors.Is(err, sys.ErrNotELFFile) {
+		return "", sys.LibCollection{}, nil
+	} else if err != nil {
+		return "", sys.LibCollection{}, err //nolint:wrapcheck
+	}
+
+	libs, err := sys.CollectLibsFor(context.Background(), binary)
+	if err != nil {
+		return "", sys.LibCollection{}, err //nolint:wrapcheck
+	}
+
+	return interpreter, libs, nil
+}
+
+// jobHandler returns a [qemu.ControlHandler] that sends the [Job] returned by
+// next to the guest once it requests one by [sysinit.HostMethodJob]. The
+// shared libraries returned by libsFn for the binary are sent along with it.
+func jobHandler(next JobFunc, libsFn jobLibsFunc) qemu.ControlHandler {
+	return func(w *pipe.Writer, method string, _ json.RawMessage) (any, error) {
+		if method != sysinit.HostMethodJob {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+		}
+
+		job, err := next()
+		if err != nil {
+			return nil, fmt.Errorf("next job: %w", err)
+		}
+
+		interpreter, libs, err := libsFn(job.Binary)
+		if err != nil {
+			return nil, fmt.Errorf("job libs: %w", err)
+		}
+
+		err = w.SetCompression(pipe.CompressionGzip)
+		if err != nil {
+			return nil, fmt.Errorf("set compression: %w", err)
+		}
+
+		err = sendJobFile(w, sysinit.JobBinaryName, job.Binary)
+		if err != nil {
+			return nil, fmt.Errorf("send job binary: %w", err)
+		}
+
+		for lib := range libs.Libs() {
+			name := path.Join(sysinit.JobLibsDir, filepath.Base(lib))
+
+			err = sendJobFile(w, name, lib)
+			if err != nil {
+				return nil, fmt.Errorf("send job lib: %w", err)
+			}
+		}
+
+		result := sysinit.Job{
+			Args:        job.Args,
+			Env:         job.Env,
+			Interpreter: interpreter,
+		}
+
+		if interpreter != "" {
+			result.Links = maps.Collect(libs.Links())
+		}
+
+		return result, nil
+	}
+}
+
+func sendJobFile(w *pipe.Writer, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	return w.SendStream(name, file) //nolint:wrapcheck
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobHandler(t *testing.T) {
+	script := "#!/bin/sh\nexit 0\n"
+	binary := filepath.Join(t.TempDir(), "bin.test")
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0o600))
+
+	t.Run("job", func(t *testing.T) {
+		handler := jobHandler(func() (Job, error) {
+			return Job{
+				Binary: binary,
+				Args:   []string{"-test.v"},
+				Env:    []string{"KEY=value"},
+			}, nil
+		}, collectJobLibs)
+
+		var buf bytes.Buffer
+
+		result, err := handler(pipe.NewWriter(&buf), sysinit.HostMethodJob,
+			nil)
+		require.NoError(t, err)
+
+		expected := sysinit.Job{
+			Args: []string{"-test.v"},
+			Env:  []string{"KEY=value"},
+		}
+		assert.Equal(t, expected, result)
+
+		received := map[string]*namedBuffer{}
+
+		err = pipe.ReceiveStreams(&buf, func(
+			name string,
+		) (io.WriteCloser, error) {
+			received[name] = &namedBuffer{}
+			return received[name], nil
+		})
+		require.NoError(t, err)
+
+		require.Contains(t, received, sysinit.JobBinaryName)
+		assert.Equal(t, script, received[sysinit.JobBinaryName].String())
+	})
+
+	t.Run("dynamic job", func(t *testing.T) {
+		// Any ELF file does as library, as only its name and SONAME matter.
+		lib, err := os.Executable()
+		require.NoError(t, err)
+
+		libsFn := func(binary string) (string, sys.LibCollection, error) {
+			libs, err := sys.CollectLibsWith(context.Background(),
+				func(context.Context, string) ([]string, error) {
+					return []string{lib}, nil
+				}, binary)
+
+			return "/lib/ld.so.1", libs, err
+		}
+
+		handler := jobHandler(func() (Job, error) {
+			return Job{Binary: binary}, nil
+		}, libsFn)
+
+		var buf bytes.Buffer
+
+		result, err := handler(pipe.NewWriter(&buf), sysinit.HostMethodJob,
+			nil)
+		require.NoError(t, err)
+
+		expected := sysinit.Job{
+			Interpreter: "/lib/ld.so.1",
+			Links:       map[string]string{},
+		}
+		assert.Equal(t, expected, result)
+
+		received := map[string]*namedBuffer{}
+
+		err = pipe.ReceiveStreams(&buf, func(
+			name string,
+		) (io.WriteCloser, error) {
+			received[name] = &namedBuffer{}
+			return received[name], nil
+		})
+		require.NoError(t, err)
+
+		assert.Contains(t, received, sysinit.JobBinaryName)
+		assert.Contains(t, received,
+			path.Join(sysinit.JobLibsDir, filepath.Base(lib)))
+	})
+
+	t.Run("no job", func(t *testing.T) {
+		errNoJob := errors.New("no job")
+
+		handler := jobHandler(func() (Job, error) {
+			return Job{}, errNoJob
+		}, collectJobLibs)
+
+		_, err := handler(pipe.NewWriter(io.Discard), sysinit.HostMethodJob,
+			nil)
+		assert.ErrorIs(t, err, errNoJob)
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		handler := jobHandler(func() (Job, error) {
+			t.Fatal("job requested")
+			return Job{}, nil
+		}, collectJobLibs)
+
+		_, err := handler(pipe.NewWriter(io.Discard), "unknown", nil)
+		assert.ErrorIs(t, err, ErrUnknownMethod)
+	})
+}
+
+func TestNewCommandSpec_Job(t *testing.T) {
+	cfg := Qemu{
+		TransportType: qemu.TransportTypePCI,
+		NextJob:       func() (Job, error) { return Job{}, nil },
+	}
+
+	cmdSpec := newCommandSpec(cfg, "initramfs", mainProcess, &RunResult{})
+
+	assert.True(t, cmdSpec.ControlConsole)
+	assert.NotNil(t, cmdSpec.ControlHandler)
+	assert.Contains(t, cmdSpec.KernelParams, sysinit.ParamJob)
+}
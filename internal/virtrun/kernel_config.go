@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// requiredKernelConfigOptions are the kernel build configuration options the
+// guest system requires, independent of the transport type.
+var requiredKernelConfigOptions = []string{
+	"CONFIG_BLK_DEV_INITRD",
+	"CONFIG_BINFMT_ELF",
+	"CONFIG_DEVTMPFS",
+	"CONFIG_PROC_FS",
+	"CONFIG_SYSFS",
+	"CONFIG_TMPFS",
+}
+
+// hostRootKernelConfigOptions are the kernel build configuration options
+// required for sharing the host's root directory. See [Qemu.HostRoot].
+var hostRootKernelConfigOptions = []string{
+	"CONFIG_FUSE_FS",
+	"CONFIG_VIRTIO_FS",
+	"CONFIG_OVERLAY_FS",
+}
+
+// readKernelConfig returns the build configuration of the kernel of the given
+// config. It is read from [Qemu.KernelConfig], if set. Otherwise, it is read
+// from the file next to the kernel, see [sys.FindKernelConfig], or extracted
+// from the kernel image, see [sys.ExtractKernelConfig]. It returns
+// [sys.ErrNoKernelConfig] if the build configuration is not available.
+func readKernelConfig(cfg Qemu) (sys.KernelConfig, error) {
+	if cfg.KernelConfig != "" {
+		config, err := sys.ReadKernelConfig(cfg.KernelConfig)
+		if err != nil {
+			return nil, fmt.Errorf("read kernel config: %w", err)
+		}
+
+		return config, nil
+	}
+
+	if cfg.Kernel == "" {
+		return nil, sys.ErrNoKernelConfig
+	}
+
+	path := sys.FindKernelConfig(cfg.Kernel)
+	if path != "" {
+		config, err := sys.ReadKernelConfig(path)
+		if err == nil {
+			return config, nil
+		}
+
+		slog.Debug("Failed to read kernel config",
+			slog.String("path", path),
+			slog.Any("error", err))
+	}
+
+	config, err := sys.ExtractKernelConfig(cfg.Kernel)
+	if err != nil {
+		slog.Debug("Failed to extract kernel config",
+			slog.String("kernel", cfg.Kernel),
+			slog.Any("error", err))
+
+		return nil, sys.ErrNoKernelConfig
+	}
+
+	return config, nil
+}
+
+// MissingKernelConfigOptions returns the kernel build configuration options
+// the kernel of the given config lacks for running the guest system. See
+// [readKernelConfig] for where the build configuration is taken from. If
+// [Qemu.TransportType] is not set, the options of the first transport type
+// for [Qemu.Machine] the kernel supports are required. If [Qemu.HostRoot] is
+// set, the options for sharing the host's root directory are required as
+// well. It returns [sys.ErrNoKernelConfig] if the build configuration is not
+// available.
+func MissingKernelConfigOptions(cfg Qemu) ([]string, error) {
+	config, err := readKernelConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	transportType := cfg.TransportType
+	if transportType == "" {
+		candidates := qemu.TransportTypesFor(cfg.Machine)
+		transportType = candidates[0]
+
+		for _, candidate := range candidates {
+			if config.Enabled(candidate.KernelConfigOptions()...) {
+				transportType = candidate
+				break
+			}
+		}
+	}
+
+	options := slices.Concat(requiredKernelConfigOptions,
+		transportType.KernelConfigOptions())
+
+	if cfg.HostRoot {
+		options = append(options, hostRootKernelConfigOptions...)
+	}
+
+	return config.Missing(options...), nil
+}
+
+// checkKernelConfig returns [ErrKernelConfigMissing] with the missing options
+// if the kernel of the given config lacks options the guest system requires.
+// It returns nil if no options are missing or if that can not be determined.
+func checkKernelConfig(cfg Qemu) error {
+	missing, err := MissingKernelConfigOptions(cfg)
+	if err != nil {
+		slog.Debug("Kernel config not checked", slog.Any("error", err))
+		return nil
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrKernelConfigMissing,
+			strings.Join(missing, ", "))
+	}
+
+	return nil
+}
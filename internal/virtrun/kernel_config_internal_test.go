@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baseKernelConfig = `CONFIG_BLK_DEV_INITRD=y
+CONFIG_BINFMT_ELF=y
+CONFIG_DEVTMPFS=y
+CONFIG_PROC_FS=y
+CONFIG_SYSFS=y
+`
+
+func TestMissingKernelConfigOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		machine       string
+		transportType qemu.TransportType
+		kernelConfig  string
+		hostRoot      bool
+		expected      []string
+	}{
+		{
+			name:          "complete",
+			transportType: qemu.TransportTypePCI,
+			kernelConfig: baseKernelConfig + "CONFIG_TMPFS=y\n" +
+				"CONFIG_VIRTIO_PCI=y\nCONFIG_VIRTIO_CONSOLE=y\n",
+		},
+		{
+			name:          "missing",
+			transportType: qemu.TransportTypeMMIO,
+			kernelConfig:  baseKernelConfig + "CONFIG_VIRTIO_CONSOLE=y\n",
+			expected:      []string{"CONFIG_TMPFS", "CONFIG_VIRTIO_MMIO"},
+		},
+		{
+			name:          "host root",
+			transportType: qemu.TransportTypePCI,
+			kernelConfig: baseKernelConfig + "CONFIG_TMPFS=y\n" +
+				"CONFIG_VIRTIO_PCI=y\nCONFIG_VIRTIO_CONSOLE=y\n" +
+				"CONFIG_FUSE_FS=y\nCONFIG_VIRTIO_FS=m\n",
+			hostRoot: true,
+			expected: []string{"CONFIG_OVERLAY_FS"},
+		},
+		{
+			name:    "transport detected",
+			machine: "q35",
+			kernelConfig: baseKernelConfig + "CONFIG_TMPFS=y\n" +
+				"CONFIG_SERIAL_8250=y\nCONFIG_SERIAL_8250_CONSOLE=y\n",
+		},
+		{
+			name:         "transport not supported",
+			machine:      "virt",
+			kernelConfig: baseKernelConfig + "CONFIG_TMPFS=y\n",
+			expected:     []string{"CONFIG_VIRTIO_MMIO", "CONFIG_VIRTIO_CONSOLE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Qemu{
+				Machine:       tt.machine,
+				TransportType: tt.transportType,
+				KernelConfig:  filepath.Join(t.TempDir(), "config"),
+				HostRoot:      tt.hostRoot,
+			}
+
+			err := os.WriteFile(cfg.KernelConfig, []byte(tt.kernelConfig),
+				0o600)
+			require.NoError(t, err)
+
+			actual, err := MissingKernelConfigOptions(cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestMissingKernelConfigOptions_NotAvailable(t *testing.T) {
+	cfg := Qemu{Kernel: filepath.Join(t.TempDir(), "vmlinuz")}
+	require.NoError(t, os.WriteFile(cfg.Kernel, []byte("kernel"), 0o600))
+
+	_, err := MissingKernelConfigOptions(cfg)
+	require.ErrorIs(t, err, sys.ErrNoKernelConfig)
+}
+
+func TestCheckKernelConfig(t *testing.T) {
+	cfg := Qemu{
+		TransportType: qemu.TransportTypePCI,
+		KernelConfig:  filepath.Join(t.TempDir(), "config"),
+	}
+
+	err := os.WriteFile(cfg.KernelConfig, []byte(baseKernelConfig), 0o600)
+	require.NoError(t, err)
+
+	err = checkKernelConfig(cfg)
+	require.ErrorIs(t, err, ErrKernelConfigMissing)
+	assert.ErrorContains(t, err,
+		"CONFIG_TMPFS, CONFIG_VIRTIO_PCI, CONFIG_VIRTIO_CONSOLE")
+
+	require.NoError(t, checkKernelConfig(Qemu{}))
+}
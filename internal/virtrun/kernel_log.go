@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/qemu"
+)
+
+// KernelLogName is the name of the file the kernel log of the guest is
+// written to, if [Qemu.KernelLog] is set.
+const KernelLogName = "virtrun-kernel.log"
+
+// kernelLogWriter decodes the records of the kernel log in the format of
+// "/dev/kmsg", as described in dev-kmsg(4), and writes them to w in the
+// format of dmesg(1), like "[    1.234567] message". Continuation lines with
+// the key value pairs of records are dropped. Lines that are no records are
+// written as they are. If onOOMKill is set, it is called for each line that
+// reports the process named mainProcess killed by the OOM killer.
+type kernelLogWriter struct {
+	w           io.Writer
+	buf         []byte
+	mainProcess string
+	onOOMKill   func(oomErr *qemu.GuestOOMError)
+}
+
+// Write implements [io.Writer].
+func (k *kernelLogWriter) Write(data []byte) (int, error) {
+	k.buf = append(k.buf, data...)
+
+	for {
+		idx := bytes.IndexByte(k.buf, '\n')
+		if idx < 0 {
+			break
+		}
+
+		line := string(k.buf[:idx])
+		k.buf = k.buf[idx+1:]
+
+		// Continuation lines start with a space.
+		if line == "" || line[0] == ' ' {
+			continue
+		}
+
+		line = formatKernelLogRecord(line)
+
+		if k.onOOMKill != nil {
+			oomErr, found := qemu.ParseOOMKill(line)
+			if found && oomErr.Process == k.mainProcess {
+				k.onOOMKill(oomErr)
+			}
+		}
+
+		_, err := io.WriteString(k.w, line+"\n")
+		if err != nil {
+			return 0, err //nolint:wrapcheck
+		}
+	}
+
+	return len(data), nil
+}
+
+// formatKernelLogRecord formats the given record line in the format of
+// "/dev/kmsg" like dmesg(1) does. Invalid records are returned as they are.
+func formatKernelLogRecord(line string) string {
+	header, message, found := strings.Cut(line, ";")
+	if !found {
+		return line
+	}
+
+	fields := strings.Split(header, ",")
+	if len(fields) < 3 {
+		return line
+	}
+
+	usec, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return line
+	}
+
+	return fmt.Sprintf("[%5d.%06d] %s", usec/1e6, usec%1e6, message)
+}
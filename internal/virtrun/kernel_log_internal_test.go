@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernelLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	writer := &kernelLogWriter{w: &buf}
+
+	input := []string{
+		"6,339,5140900,-;NET: Registered protocol",
+		" family 10\n",
+		"4,340,12000001,-;veth: loaded\n SUBSYSTEM=net\n DEVICE=n2\n",
+		"no record\n",
+		"6,341,x,-;bad timestamp\n",
+		"6,342,1,-;incomplete",
+	}
+
+	for _, data := range input {
+		n, err := writer.Write([]byte(data))
+		require.NoError(t, err)
+		assert.Equal(t, len(data), n)
+	}
+
+	expected := "[    5.140900] NET: Registered protocol family 10\n" +
+		"[   12.000001] veth: loaded\n" +
+		"no record\n" +
+		"6,341,x,-;bad timestamp\n"
+
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestKernelLogWriter_OOMKill(t *testing.T) {
+	var killed []*qemu.GuestOOMError
+
+	writer := &kernelLogWriter{
+		w:           io.Discard,
+		mainProcess: mainProcess,
+		onOOMKill: func(oomErr *qemu.GuestOOMError) {
+			killed = append(killed, oomErr)
+		},
+	}
+
+	input := "3,400,1000000,-;Out of memory: Killed process 10 (stress) " +
+		"total-vm:2048kB, anon-rss:1024kB, file-rss:0kB, shmem-rss:0kB\n" +
+		"3,401,2000000,-;Out of memory: Killed process 11 (main) " +
+		"total-vm:4096kB, anon-rss:2048kB, file-rss:4kB, shmem-rss:8kB\n"
+
+	_, err := writer.Write([]byte(input))
+	require.NoError(t, err)
+
+	expected := []*qemu.GuestOOMError{
+		{
+			PID:      11,
+			Process:  "main",
+			TotalVM:  4096,
+			AnonRSS:  2048,
+			FileRSS:  4,
+			ShmemRSS: 8,
+		},
+	}
+	assert.Equal(t, expected, killed)
+}
+
+func TestKernelLogWriter_OOMKillStandalone(t *testing.T) {
+	var killed []*qemu.GuestOOMError
+
+	writer := &kernelLogWriter{
+		w:           io.Discard,
+		mainProcess: standaloneMainProcess,
+		onOOMKill: func(oomErr *qemu.GuestOOMError) {
+			killed = append(killed, oomErr)
+		},
+	}
+
+	input := "3,400,1000000,-;Out of memory: Killed process 1 (init) " +
+		"total-vm:4096kB, anon-rss:2048kB, file-rss:4kB, shmem-rss:8kB\n"
+
+	_, err := writer.Write([]byte(input))
+	require.NoError(t, err)
+
+	require.Len(t, killed, 1)
+	assert.Equal(t, 1, killed[0].PID)
+	assert.Equal(t, "init", killed[0].Process)
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aibor/virtrun/sysinit"
+)
+
+// metricsRecorder decodes [sysinit.Metrics] sent as JSON lines and appends
+// them to the [RunResult].
+type metricsRecorder struct {
+	result *RunResult
+	buf    []byte
+}
+
+func (r *metricsRecorder) Write(data []byte) (int, error) {
+	r.buf = append(r.buf, data...)
+
+	for {
+		line, rest, found := bytes.Cut(r.buf, []byte("\n"))
+		if !found {
+			break
+		}
+
+		var metrics sysinit.Metrics
+
+		err := json.Unmarshal(line, &metrics)
+		if err != nil {
+			return 0, fmt.Errorf("decode metrics: %w", err)
+		}
+
+		r.result.Metrics = append(r.result.Metrics, metrics)
+		r.buf = rest
+	}
+
+	return len(data), nil
+}
+
+func (*metricsRecorder) Close() error {
+	return nil
+}
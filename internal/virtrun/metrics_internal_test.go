@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsRecorder(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		result := &RunResult{}
+		recorder := &metricsRecorder{result: result}
+
+		// Lines may be split across writes.
+		for _, data := range []string{
+			`{"uptime":1000000000,"load1":0.5}` + "\n" + `{"upt`,
+			`ime":2000000000,"ioRead":4096}` + "\n",
+		} {
+			_, err := recorder.Write([]byte(data))
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, recorder.Close())
+
+		expected := []sysinit.Metrics{
+			{Uptime: time.Second, Load1: 0.5},
+			{Uptime: 2 * time.Second, IORead: 4096},
+		}
+		assert.Equal(t, expected, result.Metrics)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		recorder := &metricsRecorder{result: &RunResult{}}
+
+		_, err := recorder.Write([]byte("garbage\n"))
+		assert.ErrorContains(t, err, "decode metrics")
+	})
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+// InitramfsPhase is a phase of building an initramfs archive.
+type InitramfsPhase string
+
+// Phases of building an initramfs archive in the order they are reported.
+const (
+	InitramfsPhaseLibs  InitramfsPhase = "resolve libs"
+	InitramfsPhaseImage InitramfsPhase = "unpack image"
+	InitramfsPhaseTree  InitramfsPhase = "build tree"
+	InitramfsPhaseWrite InitramfsPhase = "write archive"
+	InitramfsPhaseDone  InitramfsPhase = "done"
+)
+
+// InitramfsProgress is reported to [Initramfs.ProgressHandler] while an
+// initramfs archive is built.
+type InitramfsProgress struct {
+	// Phase is the current phase.
+	Phase InitramfsPhase
+
+	// Files is the number of files written into the archive so far.
+	Files int
+
+	// Bytes is the number of bytes written into the archive so far.
+	Bytes int64
+}
+
+// reportProgress calls the given handler with the given progress, if the
+// handler is set.
+func reportProgress(
+	handler func(InitramfsProgress),
+	progress InitramfsProgress,
+) {
+	if handler != nil {
+		handler(progress)
+	}
+}
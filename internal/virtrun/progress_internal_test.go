@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteArchive_Progress(t *testing.T) {
+	var (
+		archive  bytes.Buffer
+		progress []InitramfsProgress
+	)
+
+	fsys := fstest.MapFS{
+		"main": &fstest.MapFile{Data: []byte("binary")},
+	}
+
+	err := writeArchive(&archive, fsys, func(p InitramfsProgress) {
+		progress = append(progress, p)
+	})
+	require.NoError(t, err)
+
+	require.Len(t, progress, 4)
+	assert.Equal(t, InitramfsProgress{Phase: InitramfsPhaseWrite}, progress[0])
+	assert.Equal(t, InitramfsPhaseWrite, progress[1].Phase)
+	assert.Equal(t, 1, progress[1].Files)
+	assert.Equal(t, 2, progress[2].Files)
+
+	// The totals include the trailer written on close.
+	assert.Equal(t, InitramfsProgress{
+		Phase: InitramfsPhaseDone,
+		Files: 2,
+		Bytes: int64(archive.Len()),
+	}, progress[3])
+}
+
+func TestWriteArchive_NoProgressHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main": &fstest.MapFile{Data: []byte("binary")},
+	}
+
+	require.NoError(t, writeArchive(&bytes.Buffer{}, fsys, nil))
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/sysinit"
+)
+
+// pushFilesHandler returns a [qemu.ControlHandler] that sends the given files
+// to the guest once it requests them by [sysinit.HostMethodPush]. The files
+// are named by their base name.
+func pushFilesHandler(files []string) qemu.ControlHandler {
+	return func(w *pipe.Writer, method string, _ json.RawMessage) (any, error) {
+		if method != sysinit.HostMethodPush {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+		}
+
+		err := w.SetCompression(pipe.CompressionGzip)
+		if err != nil {
+			return nil, fmt.Errorf("set compression: %w", err)
+		}
+
+		for _, path := range files {
+			err := pushFile(w, path)
+			if err != nil {
+				return nil, fmt.Errorf("push %s: %w", path, err)
+			}
+		}
+
+		return nil, nil //nolint:nilnil
+	}
+}
+
+func pushFile(w *pipe.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	return w.SendStream(filepath.Base(path), file) //nolint:wrapcheck
+}
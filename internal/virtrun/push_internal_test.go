@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type namedBuffer struct {
+	bytes.Buffer
+}
+
+func (*namedBuffer) Close() error {
+	return nil
+}
+
+func TestPushFilesHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.bin")
+	require.NoError(t, os.WriteFile(path, []byte("input"), 0o600))
+
+	handler := pushFilesHandler([]string{path})
+
+	t.Run("push", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		_, err := handler(pipe.NewWriter(&buf), sysinit.HostMethodPush, nil)
+		require.NoError(t, err)
+
+		received := map[string]*namedBuffer{}
+
+		err = pipe.ReceiveStreams(&buf, func(
+			name string,
+		) (io.WriteCloser, error) {
+			received[name] = &namedBuffer{}
+			return received[name], nil
+		})
+		require.NoError(t, err)
+
+		require.Contains(t, received, "input.bin")
+		assert.Equal(t, "input", received["input.bin"].String())
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		_, err := handler(pipe.NewWriter(io.Discard), "unknown", nil)
+		assert.ErrorIs(t, err, ErrUnknownMethod)
+	})
+}
@@ -5,20 +5,107 @@
 package virtrun
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/aibor/virtrun/internal/qemu"
 	"github.com/aibor/virtrun/internal/sys"
 	"github.com/aibor/virtrun/sysinit"
 )
 
+const bytesPerMB = 1024 * 1024
+
+// SMPEnvVar is the environment variable the number of CPUs of the guest is
+// passed to the guest in, so tests can check against it.
+const SMPEnvVar = "VIRTRUN_SMP"
+
+const (
+	// mainProcess is the name of the process of the main binary in the
+	// guest, as the init runs it as "/main".
+	mainProcess = "main"
+
+	// standaloneMainProcess is the name of the process of the main binary
+	// in standalone mode, as the kernel runs it as "/init".
+	standaloneMainProcess = "init"
+)
+
+// setExitCodeNonce sets the nonce the exit code marker line of the guest must
+// be keyed by and passes it to the guest. See [protocol.FormatExitCode].
+func setExitCodeNonce(cmdSpec *qemu.CommandSpec, nonce string) {
+	cmdSpec.ExitCodeNonce = nonce
+	cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+		sysinit.ParamExitCodeNonce+"="+nonce)
+}
+
+// mainProcessName returns the name of the process of the main binary in the
+// guest for the given [Initramfs] config.
+func mainProcessName(cfg Initramfs) string {
+	if cfg.StandaloneInit {
+		return standaloneMainProcess
+	}
+
+	return mainProcess
+}
+
+// heartbeatsPerTimeout is the number of heartbeats the guest sends within the
+// heartbeat timeout, so single delayed heartbeats do not fail the run.
+const heartbeatsPerTimeout = 4
+
+const (
+	// guestGoTestOutputDir is the guest directory go test output flags are
+	// rewritten to.
+	guestGoTestOutputDir = "/tmp"
+
+	// guestGoTestFuzzCacheDir is the guest directory the go test fuzz cache
+	// flag is rewritten to, as the host's cache is not available.
+	guestGoTestFuzzCacheDir = "/tmp/fuzzcache"
+
+	// guestGoCoverDir is the guest directory binaries built with coverage
+	// instrumentation write their coverage data into. See [Qemu.CoverDir].
+	guestGoCoverDir = "/tmp/gocoverdir"
+)
+
+// phaseStates maps the states the init communicates to the lifecycle phases
+// they start.
+var phaseStates = map[string]qemu.Phase{
+	string(sysinit.StateBooted):       qemu.PhaseInit,
+	string(sysinit.StateMainStarted):  qemu.PhaseMainStart,
+	string(sysinit.StateMainFinished): qemu.PhaseMainEnd,
+}
+
+// GoTestFlagsRewritable are the names of the go test flags, without the
+// "-test." prefix, that are rewritten so they work in the guest. See
+// [Qemu.GoTestFlagRewrite].
+var GoTestFlagsRewritable = []string{
+	"coverprofile",
+	"blockprofile",
+	"cpuprofile",
+	"memprofile",
+	"mutexprofile",
+	"trace",
+	"outputdir",
+	"gocoverdir",
+	"fuzzcachedir",
+	"artifacts",
+}
+
 type Qemu struct {
 	Executable          string
 	Kernel              string
+	KernelConfig        string
+	UKI                 bool
+	UKIfyArgs           []string
+	Firmware            string
+	TempDir             string
 	Machine             string
 	CPU                 string
 	SMP                 uint64
@@ -26,12 +113,56 @@ type Qemu struct {
 	TransportType       qemu.TransportType
 	InitArgs            []string
 	ExtraArgs           []qemu.Argument
+	Consoles            []string
+	ConsoleWriters      []io.Writer
 	NoKVM               bool
+	NoContainerDetect   bool
+	FDDir               string
 	Verbose             bool
 	NoGoTestFlagRewrite bool
+	GoTestFlagRewrite   []string
+	PTY                 bool
+	Interactive         bool
+	Env                 []string
+	MountOptions        []string
+	Sysctls             []string
+	OOMScoreAdj         int
+	Collect             []string
+	ArtifactDir         string
+	ConsoleLog          bool
+	RawConsoleDir       string
+	KernelLog           bool
+	KernelLogWriter     io.Writer
+	CoverDir            string
+	ZramSwap            uint64
+	Seed                string
+	ModulesAutoload     bool
+	UserNamespace       bool
+	IDMappings          string
+	Control             bool
+	PushFiles           []string
+	HeartbeatTimeout    time.Duration
+	MetricsInterval     time.Duration
+	Arch                sys.Arch
+	KernelParams        []string
+	ReadOnlyPaths       []string
+	StateHandler        func(state string)
+	LineFilters         []qemu.LineFilter
+	FailOnKernelReport  bool
+	HostRoot            bool
+	Virtiofsd           string
+	Forwards            []Forward
+	DebugTool           []string
+	PhaseMarkers        bool
+	ProcessLimits       sys.ProcessLimits
+	EchoCount           int
+	NextJob             JobFunc
 }
 
-func (s *Qemu) addDefaultsFor(arch sys.Arch) error {
+// AddDefaultsFor sets the QEMU executable, machine type and transport type
+// for the given [sys.Arch], unless they are set already. KVM is disabled if it
+// can not run guests of the arch. See [sys.Arch.CheckKVM].
+func (s *Qemu) AddDefaultsFor(arch sys.Arch) error {
 	var (
 		executable    string
 		machine       string
@@ -51,6 +182,14 @@ func (s *Qemu) addDefaultsFor(arch sys.Arch) error {
 		executable = "qemu-system-riscv64"
 		machine = "virt"
 		transportType = qemu.TransportTypeMMIO
+	case sys.S390X:
+		executable = "qemu-system-s390x"
+		machine = "s390-ccw-virtio"
+		transportType = qemu.TransportTypePCI
+	case sys.MIPS64:
+		executable = "qemu-system-mips64"
+		machine = "malta"
+		transportType = qemu.TransportTypePCI
 	default:
 		return sys.ErrArchNotSupported
 	}
@@ -67,40 +206,314 @@ func (s *Qemu) addDefaultsFor(arch sys.Arch) error {
 		s.TransportType = transportType
 	}
 
+	// Without KVM, QEMU emulates the guest, which is slow but works.
 	if !s.NoKVM {
-		s.NoKVM = !arch.KVMAvailable()
+		if err := arch.CheckKVM(); err != nil {
+			slog.Debug("KVM not available, guest is emulated",
+				slog.String("arch", arch.String()),
+				slog.Any("error", err))
+
+			s.NoKVM = true
+		}
 	}
 
 	return nil
 }
 
-func NewQemuCommand(
-	ctx context.Context,
+// newCommandSpec creates the [qemu.CommandSpec] for the given [Qemu] config.
+// mainProcess is the name of the process of the main binary in the guest. See
+// [mainProcessName]. Data the guest sends about the run, like
+// [sysinit.Metrics], is recorded in result.
+func newCommandSpec(
 	cfg Qemu,
 	initramfsPath string,
-) (*qemu.Command, error) {
+	mainProcess string,
+	result *RunResult,
+) qemu.CommandSpec {
 	cmdSpec := qemu.CommandSpec{
-		Executable:    cfg.Executable,
-		Kernel:        cfg.Kernel,
-		Initramfs:     initramfsPath,
-		Machine:       cfg.Machine,
-		CPU:           cfg.CPU,
-		Memory:        cfg.Memory,
-		SMP:           cfg.SMP,
-		TransportType: cfg.TransportType,
-		InitArgs:      cfg.InitArgs,
-		ExtraArgs:     cfg.ExtraArgs,
-		NoKVM:         cfg.NoKVM,
-		Verbose:       cfg.Verbose,
-		ExitCodeFmt:   sysinit.ExitCodeFmt,
+		Executable:         cfg.Executable,
+		Kernel:             cfg.Kernel,
+		Initramfs:          initramfsPath,
+		Firmware:           cfg.Firmware,
+		Machine:            cfg.Machine,
+		CPU:                cfg.CPU,
+		Memory:             cfg.Memory,
+		SMP:                cfg.SMP,
+		TransportType:      cfg.TransportType,
+		InitArgs:           cfg.InitArgs,
+		ExtraArgs:          cfg.ExtraArgs,
+		NoKVM:              cfg.NoKVM,
+		Verbose:            cfg.Verbose,
+		Interactive:        cfg.Interactive,
+		ExitCodePrefix:     sysinit.ExitCodePrefix,
+		MainProcess:        mainProcess,
+		NotifyFmt:          sysinit.NotifyFmt,
+		StateHandler:       cfg.StateHandler,
+		LineFilters:        cfg.LineFilters,
+		FailOnKernelReport: cfg.FailOnKernelReport,
+		PhaseStates:        phaseStates,
+		PhaseMarkers:       cfg.PhaseMarkers,
+		RawConsoleDir:      cfg.RawConsoleDir,
+		FDDir:              cfg.FDDir,
+		ProcessLimits:      cfg.ProcessLimits,
+	}
+
+	// Pass the current time, so the guest can set its clock even if it has
+	// no real time clock device.
+	cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+		sysinit.ParamEpoch+"="+strconv.FormatInt(time.Now().Unix(), 10))
+
+	if cfg.PTY {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams, sysinit.ParamPTY)
+	}
+
+	if cfg.ModulesAutoload {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamModulesAutoload)
+	}
+
+	if cfg.UserNamespace {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamUserNamespace+"="+cfg.IDMappings)
+	}
+
+	if len(cfg.MountOptions) > 0 {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamMountOptions+"="+strings.Join(cfg.MountOptions, ";"))
+	}
+
+	if len(cfg.ReadOnlyPaths) > 0 {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamReadOnly+"="+strings.Join(cfg.ReadOnlyPaths, ";"))
+	}
+
+	if len(cfg.Sysctls) > 0 {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamSysctls+"="+strings.Join(cfg.Sysctls, ";"))
+	}
+
+	if cfg.OOMScoreAdj != 0 {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamOOMScoreAdj+"="+strconv.Itoa(cfg.OOMScoreAdj))
+	}
+
+	if cfg.ZramSwap != 0 {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamZramSwap+"="+
+				strconv.FormatUint(cfg.ZramSwap*bytesPerMB, 10))
+	}
+
+	if cfg.Seed != "" {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			"random.trust_cpu=off",
+			"random.trust_bootloader=off",
+			sysinit.ParamSeed+"="+cfg.Seed)
+	}
+
+	cmdSpec.KernelParams = append(cmdSpec.KernelParams, cfg.KernelParams...)
+
+	if cfg.SMP > 0 {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			envParam(SMPEnvVar+"="+strconv.FormatUint(cfg.SMP, 10)))
+	}
+
+	for _, envVar := range cfg.Env {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams, envParam(envVar))
+	}
+
+	// Consoles given explicitly are added first, so their device names do
+	// not depend on other features.
+	// Named consoles are passed to the guest, so binaries find them by name.
+	// See [sysinit.ParamConsoles].
+	var namedConsoles []string
+
+	for _, console := range cfg.Consoles {
+		name, target := splitConsole(console)
+
+		device := cmdSpec.AddConsole(target)
+		if name != "" {
+			namedConsoles = append(namedConsoles, name+"="+device)
+		}
+	}
+
+	if len(namedConsoles) > 0 {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamConsoles+"="+strings.Join(namedConsoles, ";"))
+	}
+
+	for _, w := range cfg.ConsoleWriters {
+		cmdSpec.AddConsoleWriter(w)
+	}
+
+	// The init streams the kernel log to its own console, so it does not
+	// mix with the output of the main binary. It has all messages, so OOM
+	// kills are found even if they are not printed on the console.
+	if cfg.KernelLogWriter != nil {
+		device := cmdSpec.AddConsoleWriter(&kernelLogWriter{
+			w:           cfg.KernelLogWriter,
+			mainProcess: mainProcess,
+			onOOMKill: func(oomErr *qemu.GuestOOMError) {
+				if result.kernelLogOOM == nil {
+					result.kernelLogOOM = oomErr
+				}
+			},
+		})
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamKmsgDevice+"=/dev/"+device)
 	}
 
 	// In order to be useful with "go test -exec", rewrite the file based flags
 	// so the output can be passed from guest to kernel via consoles.
+	collect := cfg.Collect
+	coverDir := cfg.CoverDir
+
 	if !cfg.NoGoTestFlagRewrite {
-		rewriteGoTestFlagsPath(&cmdSpec)
+		guestPaths, flagCoverDir := rewriteGoTestFlagsPath(&cmdSpec,
+			cfg.GoTestFlagRewrite)
+		collect = append(slices.Clip(collect), guestPaths...)
+		coverDir = cmp.Or(flagCoverDir, coverDir)
+	}
+
+	// Binaries built with coverage instrumentation write their coverage data
+	// into the directory given by GOCOVERDIR, which the init creates. The
+	// files are collected into the host's coverage directory directly, so
+	// they can be processed with "go tool covdata".
+	if coverDir != "" {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			envParam("GOCOVERDIR="+guestGoCoverDir))
+		cmdSpec.ArtifactRedirects = map[string]string{
+			guestGoCoverDir: coverDir,
+		}
+		collect = append(slices.Clip(collect), guestGoCoverDir)
+	}
+
+	// The main binary is run under the debug tool, which writes its output
+	// into the debug dir. It is collected, so the output ends up on the host.
+	if len(cfg.DebugTool) > 0 {
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamDebugTool+"="+strings.Join(cfg.DebugTool, ";"))
+		collect = append(slices.Clip(collect), sysinit.DebugDir)
+	}
+
+	// Collected files are sent via a dedicated console. It must be added
+	// after all additional consoles are added.
+	if len(collect) > 0 {
+		cmdSpec.ArtifactDir = cmp.Or(cfg.ArtifactDir, ".")
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamCollect+"="+strings.Join(collect, ";"),
+			sysinit.ParamCollectDevice+"=/dev/"+
+				cmdSpec.ArtifactConsoleDeviceName(),
+		)
+	}
+
+	// Structured log records of the init are sent via a dedicated console,
+	// if available. It must be added after all other consoles are added.
+	if cmdSpec.SupportsAdditionalConsoles() {
+		cmdSpec.LogConsole = true
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamLogDevice+"=/dev/"+cmdSpec.LogConsoleDeviceName())
+	}
+
+	control := cfg.Control && cmdSpec.SupportsAdditionalConsoles()
+	controlHandlers := make(map[string]qemu.ControlHandler)
+
+	// Pushed files are sent via the control console. It is required, so the
+	// command fails if it is not available.
+	if len(cfg.PushFiles) > 0 {
+		control = true
+		controlHandlers[sysinit.HostMethodPush] = pushFilesHandler(
+			cfg.PushFiles)
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams, sysinit.ParamPush)
+	}
+
+	var fwd *forwarder
+
+	// Forwarded connections are sent via the control console. It is
+	// required, so the command fails if it is not available.
+	if len(cfg.Forwards) > 0 {
+		control = true
+		fwd = &forwarder{forwards: cfg.Forwards}
+		controlHandlers[sysinit.HostMethodForward] = fwd.handle
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamForward+"="+guestAddresses(cfg.Forwards))
 	}
 
+	// Round trip times are measured on the control console. It is required,
+	// so the command fails if it is not available.
+	if cfg.EchoCount > 0 {
+		control = true
+		controlHandlers[sysinit.HostMethodEcho] = (&echoRecorder{
+			result: result,
+		}).handle
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamEcho+"="+strconv.Itoa(cfg.EchoCount))
+	}
+
+	// Jobs are sent via the control console. It is required, so the
+	// command fails if it is not available.
+	if cfg.NextJob != nil {
+		control = true
+		controlHandlers[sysinit.HostMethodJob] = jobHandler(cfg.NextJob,
+			collectJobLibs)
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams, sysinit.ParamJob)
+	}
+
+	if len(controlHandlers) > 0 {
+		cmdSpec.ControlHandler = controlHandler(controlHandlers)
+	}
+
+	// Heartbeats are sent via the control console. It is required, so the
+	// command fails if it is not available.
+	if cfg.HeartbeatTimeout > 0 {
+		control = true
+		interval := cfg.HeartbeatTimeout / heartbeatsPerTimeout
+		cmdSpec.HeartbeatTimeout = cfg.HeartbeatTimeout
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamHeartbeat+"="+interval.String())
+	}
+
+	// Metrics are sent via the control console. It is required, so the
+	// command fails if it is not available.
+	if cfg.MetricsInterval > 0 {
+		control = true
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamMetrics+"="+cfg.MetricsInterval.String())
+	}
+
+	// Requests to the guest are sent via a dedicated bidirectional console,
+	// if available. It must be added after all other consoles are added.
+	if control {
+		cmdSpec.ControlConsole = true
+		cmdSpec.ControlOpen = controlStreams(result,
+			cmp.Or(cfg.ArtifactDir, "."), fwd)
+		cmdSpec.KernelParams = append(cmdSpec.KernelParams,
+			sysinit.ParamControlDevice+"=/dev/"+
+				cmdSpec.ControlConsoleDeviceName())
+	}
+
+	return cmdSpec
+}
+
+// splitConsole splits the given console in the form "NAME=TARGET" into name
+// and target. If it has no valid name, it is returned as target with an empty
+// name. Valid names consist of letters, digits, "-", "_" and ".".
+func splitConsole(console string) (string, string) {
+	name, target, found := strings.Cut(console, "=")
+	if !found || name == "" || strings.ContainsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) &&
+			!strings.ContainsRune("-_.", r)
+	}) {
+		return "", console
+	}
+
+	return name, target
+}
+
+// newCommand creates the [qemu.Command] for the given [qemu.CommandSpec].
+func newCommand(
+	ctx context.Context,
+	cmdSpec qemu.CommandSpec,
+) (*qemu.Command, error) {
 	cmd, err := qemu.NewCommand(ctx, cmdSpec)
 	if err != nil {
 		return nil, fmt.Errorf("build command: %w", err)
@@ -111,47 +524,100 @@ func NewQemuCommand(
 	return cmd, nil
 }
 
+// envParam returns the kernel command line parameter for the given
+// environment variable in the form "KEY=VALUE". The value is quoted if it
+// contains white space.
+func envParam(envVar string) string {
+	key, value, _ := strings.Cut(envVar, "=")
+	if strings.ContainsAny(value, " \t") {
+		value = `"` + value + `"`
+	}
+
+	return sysinit.CmdlineEnvPrefix + key + "=" + value
+}
+
 // rewriteGoTestFlagsPath processes file related go test flags in
 // [qemu.CommandSpec.InitArgs] and changes them, so the guest system's writes
-// end up in the host systems file paths.
+// end up in the host systems file paths. Only the flags with the given names
+// are rewritten. If no names are given, all [GoTestFlagsRewritable] are
+// rewritten.
 //
 // It scans [qemu.CommandSpec.InitArgs] for coverage and profile related paths
 // and replaces them with console path. The original paths are added as
-// additional file descriptors to the [qemu.CommandSpec].
+// additional file descriptors to the [qemu.CommandSpec]. The returned guest
+// paths must be collected, like the test artifacts of flag "-test.artifacts".
+// The host directory of flag "-test.gocoverdir" is returned as well, if it is
+// rewritten. Its guest directory is [guestGoCoverDir].
 //
 // It is required that the flags are prefixed with "test" and value is
 // separated form the flag by "=". This is the format the "go test" tool
 // invokes the test binary with.
-func rewriteGoTestFlagsPath(c *qemu.CommandSpec) {
+func rewriteGoTestFlagsPath(
+	c *qemu.CommandSpec,
+	names []string,
+) ([]string, string) {
+	rewrite := func(name string) bool {
+		return len(names) == 0 || slices.Contains(names, name)
+	}
+
 	// Only coverprofile has a relative path to the test pwd and can be
 	// replaced immediately. All other profile files are relative to the actual
 	// test running and need to be prefixed with -test.outputdir. So, collect
 	// them and process them afterwards when "outputdir" is found.
 	needsOutputDirPrefix := make([]int, 0)
 	outputDir := ""
+	guestOutputDir := ""
+	coverDir := ""
+	artifacts := false
 
 	for idx, posArg := range c.InitArgs {
 		splits := strings.Split(posArg, "=")
-		switch splits[0] {
-		case "-test.coverprofile":
-			splits[1] = "/dev/" + c.AddConsole(splits[1])
-			c.InitArgs[idx] = strings.Join(splits, "=")
-		case "-test.blockprofile",
-			"-test.cpuprofile",
-			"-test.memprofile",
-			"-test.mutexprofile",
-			"-test.trace":
-			needsOutputDirPrefix = append(needsOutputDirPrefix, idx)
+		name := strings.TrimPrefix(splits[0], "-test.")
+
+		if len(splits) < 2 {
+			// Boolean flags may be given without value.
+			if name == "artifacts" {
+				artifacts = rewrite(name)
+			}
 
 			continue
-		case "-test.outputdir":
+		}
+
+		switch name {
+		case "coverprofile":
+			if rewrite(name) {
+				splits[1] = "/dev/" + c.AddConsole(splits[1])
+			}
+		case "blockprofile",
+			"cpuprofile",
+			"memprofile",
+			"mutexprofile",
+			"trace":
+			if rewrite(name) {
+				needsOutputDirPrefix = append(needsOutputDirPrefix, idx)
+			}
+		case "outputdir":
 			outputDir = splits[1]
 
-			fallthrough
-		case "-test.gocoverdir":
-			splits[1] = "/tmp"
-			c.InitArgs[idx] = strings.Join(splits, "=")
+			if rewrite(name) {
+				splits[1] = guestGoTestOutputDir
+			}
+
+			guestOutputDir = splits[1]
+		case "gocoverdir":
+			if rewrite(name) {
+				coverDir = splits[1]
+				splits[1] = guestGoCoverDir
+			}
+		case "fuzzcachedir":
+			if rewrite(name) {
+				splits[1] = guestGoTestFuzzCacheDir
+			}
+		case "artifacts":
+			artifacts = rewrite(name) && splits[1] == "true"
 		}
+
+		c.InitArgs[idx] = strings.Join(splits, "=")
 	}
 
 	if outputDir != "" {
@@ -162,4 +628,12 @@ func rewriteGoTestFlagsPath(c *qemu.CommandSpec) {
 			c.InitArgs[argsIdx] = strings.Join(splits, "=")
 		}
 	}
+
+	// Test artifacts are written into the directory "_artifacts" in the
+	// output directory.
+	if artifacts && guestOutputDir != "" {
+		return []string{filepath.Join(guestOutputDir, "_artifacts")}, coverDir
+	}
+
+	return nil, coverDir
 }
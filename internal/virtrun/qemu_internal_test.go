@@ -5,18 +5,25 @@
 package virtrun
 
 import (
+	"bytes"
+	"io"
 	"testing"
 
 	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/sysinit"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestProcessGoTestFlags(t *testing.T) {
 	tests := []struct {
-		name          string
-		inputArgs     []string
-		expectedArgs  []string
-		expectedFiles []string
+		name            string
+		names           []string
+		inputArgs       []string
+		expectedArgs    []string
+		expectedFiles   []string
+		expectedCollect []string
+		expectedCover   string
 	}{
 		{
 			name: "empty",
@@ -43,12 +50,13 @@ func TestProcessGoTestFlags(t *testing.T) {
 			},
 			expectedArgs: []string{
 				"-test.paniconexit0",
-				"-test.gocoverdir=/tmp",
+				"-test.gocoverdir=/tmp/gocoverdir",
 				"-test.coverprofile=/dev/hvc1",
 			},
 			expectedFiles: []string{
 				"cover.out",
 			},
+			expectedCover: "/some/where",
 		},
 		{
 			name: "go output dir dependent flags",
@@ -78,6 +86,43 @@ func TestProcessGoTestFlags(t *testing.T) {
 				"outputdir/trace.out",
 			},
 		},
+		{
+			name: "fuzz cache and artifacts",
+			inputArgs: []string{
+				"-test.fuzzcachedir=/home/user/.cache/go-build/fuzz",
+				"-test.artifacts",
+				"-test.outputdir=outputdir",
+			},
+			expectedArgs: []string{
+				"-test.fuzzcachedir=/tmp/fuzzcache",
+				"-test.artifacts",
+				"-test.outputdir=/tmp",
+			},
+			expectedCollect: []string{
+				"/tmp/_artifacts",
+			},
+		},
+		{
+			name:  "selected flags",
+			names: []string{"cpuprofile", "outputdir"},
+			inputArgs: []string{
+				"-test.coverprofile=cover.out",
+				"-test.cpuprofile=cpu.out",
+				"-test.memprofile=mem.out",
+				"-test.artifacts=true",
+				"-test.outputdir=outputdir",
+			},
+			expectedArgs: []string{
+				"-test.coverprofile=cover.out",
+				"-test.cpuprofile=/dev/hvc1",
+				"-test.memprofile=mem.out",
+				"-test.artifacts=true",
+				"-test.outputdir=/tmp",
+			},
+			expectedFiles: []string{
+				"outputdir/cpu.out",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -85,10 +130,138 @@ func TestProcessGoTestFlags(t *testing.T) {
 			cmdSpec := qemu.CommandSpec{
 				InitArgs: tt.inputArgs,
 			}
-			rewriteGoTestFlagsPath(&cmdSpec)
+			collect, coverDir := rewriteGoTestFlagsPath(&cmdSpec, tt.names)
 
 			assert.Equal(t, tt.expectedArgs, cmdSpec.InitArgs)
 			assert.Equal(t, tt.expectedFiles, cmdSpec.AdditionalConsoles)
+			assert.Equal(t, tt.expectedCollect, collect)
+			assert.Equal(t, tt.expectedCover, coverDir)
+		})
+	}
+}
+
+func TestNewCommandSpec_Consoles(t *testing.T) {
+	var buf bytes.Buffer
+
+	cfg := Qemu{
+		TransportType: qemu.TransportTypePCI,
+		InitArgs:      []string{"-test.coverprofile=cover.out"},
+		Consoles:      []string{"-", "fd:3"},
+		ConsoleWriters: []io.Writer{
+			&buf,
+		},
+	}
+
+	cmdSpec := newCommandSpec(cfg, "initramfs", mainProcess, &RunResult{})
+
+	expectedConsoles := []string{"-", "fd:3", "writer:3", "cover.out"}
+	assert.Equal(t, expectedConsoles, cmdSpec.AdditionalConsoles)
+	assert.Same(t, &buf, cmdSpec.ConsoleWriters["writer:3"])
+	assert.Equal(t, []string{"-test.coverprofile=/dev/hvc4"}, cmdSpec.InitArgs)
+}
+
+func TestNewCommandSpec_NamedConsoles(t *testing.T) {
+	cfg := Qemu{
+		TransportType: qemu.TransportTypeISA,
+		Consoles:      []string{"trace=trace.log", "-", "events=fd:3", "a/b=c"},
+	}
+
+	cmdSpec := newCommandSpec(cfg, "initramfs", mainProcess, &RunResult{})
+
+	expectedConsoles := []string{"trace.log", "-", "fd:3", "a/b=c"}
+	assert.Equal(t, expectedConsoles, cmdSpec.AdditionalConsoles)
+	assert.Contains(t, cmdSpec.KernelParams,
+		"virtrun.consoles=trace=ttyS1;events=ttyS3")
+}
+
+func TestNewCommandSpec_KernelLog(t *testing.T) {
+	var buf bytes.Buffer
+
+	cfg := Qemu{
+		TransportType:   qemu.TransportTypePCI,
+		Consoles:        []string{"-"},
+		KernelLogWriter: &buf,
+	}
+
+	cmdSpec := newCommandSpec(cfg, "initramfs", mainProcess, &RunResult{})
+
+	assert.Equal(t, []string{"-", "writer:2"}, cmdSpec.AdditionalConsoles)
+	assert.Contains(t, cmdSpec.KernelParams, "virtrun.kmsgdev=/dev/hvc2")
+
+	_, err := cmdSpec.ConsoleWriters["writer:2"].Write(
+		[]byte("6,1,2000000,-;hello\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "[    2.000000] hello\n", buf.String())
+}
+
+func TestNewCommandSpec_DebugTool(t *testing.T) {
+	cfg := Qemu{
+		TransportType: qemu.TransportTypePCI,
+		ArtifactDir:   "artifacts",
+		DebugTool:     []string{"/data/strace", "-f", "-o", "/tmp/debug/trace"},
+	}
+
+	cmdSpec := newCommandSpec(cfg, "initramfs", mainProcess, &RunResult{})
+
+	assert.Equal(t, "artifacts", cmdSpec.ArtifactDir)
+	assert.Contains(t, cmdSpec.KernelParams,
+		"virtrun.debugtool=/data/strace;-f;-o;/tmp/debug/trace")
+	assert.Contains(t, cmdSpec.KernelParams, "virtrun.collect=/tmp/debug")
+}
+
+func TestNewCommandSpec_SMP(t *testing.T) {
+	cfg := Qemu{
+		TransportType: qemu.TransportTypePCI,
+		SMP:           4,
+	}
+
+	cmdSpec := newCommandSpec(cfg, "initramfs", mainProcess, &RunResult{})
+
+	assert.Equal(t, uint64(4), cmdSpec.SMP)
+	assert.Contains(t, cmdSpec.KernelParams, "VIRTRUN_ENV_VIRTRUN_SMP=4")
+}
+
+func TestEnvParam(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "FOO=bar",
+			expected: "VIRTRUN_ENV_FOO=bar",
+		},
+		{
+			input:    "EMPTY=",
+			expected: "VIRTRUN_ENV_EMPTY=",
+		},
+		{
+			input:    "SPACE=a b",
+			expected: `VIRTRUN_ENV_SPACE="a b"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, envParam(tt.input))
 		})
 	}
 }
+
+func TestNewCommandSpec_Echo(t *testing.T) {
+	cfg := Qemu{
+		TransportType: qemu.TransportTypePCI,
+		EchoCount:     10,
+	}
+
+	cmdSpec := newCommandSpec(cfg, "initramfs", mainProcess, &RunResult{})
+
+	assert.True(t, cmdSpec.ControlConsole)
+	assert.NotNil(t, cmdSpec.ControlHandler)
+	assert.Contains(t, cmdSpec.KernelParams, sysinit.ParamEcho+"=10")
+}
+
+func TestMainProcessName(t *testing.T) {
+	assert.Equal(t, "main", mainProcessName(Initramfs{}))
+	assert.Equal(t, "init",
+		mainProcessName(Initramfs{StandaloneInit: true}))
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/sys"
+)
+
+// detectTransportType returns the first [qemu.TransportType] that works with
+// the machine type of the given config, is provided by its QEMU executable
+// and is supported by its kernel. Devices and kernel support are checked only
+// if they can be determined. See [readKernelConfig] for where the kernel build
+// configuration is taken from. If no candidate is left, the configured
+// transport type is returned.
+func detectTransportType(
+	ctx context.Context,
+	cfg Qemu,
+) (qemu.TransportType, error) {
+	devices, err := qemu.AvailableDevices(ctx, cfg.Executable, cfg.Machine)
+	if err != nil {
+		slog.Debug("QEMU devices unknown", slog.Any("error", err))
+	}
+
+	kernelConfig, err := readKernelConfig(cfg)
+	if err != nil && !errors.Is(err, sys.ErrNoKernelConfig) {
+		return "", err
+	}
+
+	for _, candidate := range qemu.TransportTypesFor(cfg.Machine) {
+		if devices != nil && !devices[candidate.Device()] {
+			continue
+		}
+
+		if kernelConfig != nil &&
+			!kernelConfig.Enabled(candidate.KernelConfigOptions()...) {
+			continue
+		}
+
+		slog.Debug("Detected transport type",
+			slog.String("transport", candidate.String()))
+
+		return candidate, nil
+	}
+
+	slog.Warn("No supported transport type detected, using default",
+		slog.String("transport", cfg.TransportType.String()))
+
+	return cfg.TransportType, nil
+}
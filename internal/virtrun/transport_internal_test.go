@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectTransportType(t *testing.T) {
+	tests := []struct {
+		name         string
+		machine      string
+		kernelConfig string
+		expected     qemu.TransportType
+	}{
+		{
+			name:     "no info",
+			machine:  "q35",
+			expected: qemu.TransportTypePCI,
+		},
+		{
+			name:         "pci supported",
+			machine:      "q35",
+			kernelConfig: "CONFIG_VIRTIO_PCI=y\nCONFIG_VIRTIO_CONSOLE=y\n",
+			expected:     qemu.TransportTypePCI,
+		},
+		{
+			name:         "pci not supported",
+			machine:      "q35",
+			kernelConfig: "CONFIG_SERIAL_8250=y\nCONFIG_SERIAL_8250_CONSOLE=y\n",
+			expected:     qemu.TransportTypeISA,
+		},
+		{
+			name:         "mmio not supported",
+			machine:      "virt",
+			kernelConfig: "CONFIG_VIRTIO_PCI=y\nCONFIG_VIRTIO_CONSOLE=m\n",
+			expected:     qemu.TransportTypePCI,
+		},
+		{
+			name:         "nothing supported",
+			machine:      "microvm",
+			kernelConfig: "CONFIG_VIRTIO_PCI=y\n",
+			expected:     qemu.TransportTypeMMIO,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Qemu{
+				Executable:    filepath.Join(t.TempDir(), "missing"),
+				Machine:       tt.machine,
+				TransportType: qemu.TransportTypeMMIO,
+			}
+
+			if tt.kernelConfig != "" {
+				cfg.KernelConfig = filepath.Join(t.TempDir(), "config")
+				err := os.WriteFile(cfg.KernelConfig,
+					[]byte(tt.kernelConfig), 0o600)
+				require.NoError(t, err)
+			}
+
+			actual, err := detectTransportType(context.Background(), cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestDetectTransportType_KernelConfigMissing(t *testing.T) {
+	cfg := Qemu{
+		Executable:   filepath.Join(t.TempDir(), "missing"),
+		KernelConfig: filepath.Join(t.TempDir(), "config"),
+	}
+
+	_, err := detectTransportType(context.Background(), cfg)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aibor/virtrun/internal/qemu"
+)
+
+const (
+	// ukifyExecutable is the tool Unified Kernel Images are built with. It is
+	// part of systemd.
+	ukifyExecutable = "ukify"
+
+	// ukiName is the file name of the built Unified Kernel Image.
+	ukiName = "uki.efi"
+)
+
+// buildUKI builds a Unified Kernel Image from the kernel, initramfs and kernel
+// command line of the given [qemu.CommandSpec] into the given directory. The
+// spec is changed to boot the image. The given arguments are passed to
+// "ukify build", like for signing the image.
+func buildUKI(
+	ctx context.Context,
+	cmdSpec *qemu.CommandSpec,
+	dir string,
+	args []string,
+) error {
+	path := filepath.Join(dir, ukiName)
+
+	ukifyArgs := []string{
+		"build",
+		"--linux=" + cmdSpec.Kernel,
+		"--initrd=" + cmdSpec.Initramfs,
+		"--cmdline=" + strings.Join(cmdSpec.KernelCmdline(), " "),
+		"--output=" + path,
+	}
+	ukifyArgs = append(ukifyArgs, args...)
+
+	out, err := exec.CommandContext(ctx, ukifyExecutable, ukifyArgs...).
+		CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", ukifyExecutable, err,
+			bytes.TrimSpace(out))
+	}
+
+	useUKI(cmdSpec, path)
+
+	return nil
+}
+
+// useUKI changes the given [qemu.CommandSpec] to boot the Unified Kernel
+// Image at the given path.
+func useUKI(cmdSpec *qemu.CommandSpec, path string) {
+	cmdSpec.Kernel = path
+	cmdSpec.Initramfs = ""
+	cmdSpec.UKI = true
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUKIfy puts an ukify executable into PATH that writes its arguments
+// into the file given by "--output=" or fails with the given message.
+func fakeUKIfy(t *testing.T, failMsg string) {
+	t.Helper()
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\n"
+
+	if failMsg != "" {
+		script += "echo " + failMsg + "\nexit 1\n"
+	} else {
+		script += "for arg; do case $arg in --output=*) out=${arg#*=};; " +
+			"esac; done\nprintf '%s\\n' \"$@\" > \"$out\"\n"
+	}
+
+	path := filepath.Join(binDir, ukifyExecutable)
+	require.NoError(t, os.WriteFile(path, []byte(script), 0o700))
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestBuildUKI(t *testing.T) {
+	fakeUKIfy(t, "")
+
+	dir := t.TempDir()
+	cmdSpec := qemu.CommandSpec{
+		Kernel:        "/boot/vmlinuz",
+		Initramfs:     "/tmp/initramfs.cpio",
+		TransportType: qemu.TransportTypePCI,
+		KernelParams:  []string{"first"},
+	}
+
+	err := buildUKI(context.Background(), &cmdSpec, dir,
+		[]string{"--secureboot-private-key=key.pem"})
+	require.NoError(t, err)
+
+	ukiPath := filepath.Join(dir, ukiName)
+	assert.Equal(t, ukiPath, cmdSpec.Kernel)
+	assert.Empty(t, cmdSpec.Initramfs)
+	assert.True(t, cmdSpec.UKI)
+
+	data, err := os.ReadFile(ukiPath)
+	require.NoError(t, err)
+
+	expected := []string{
+		"build",
+		"--linux=/boot/vmlinuz",
+		"--initrd=/tmp/initramfs.cpio",
+		"--cmdline=console=hvc0 panic=-1 mitigations=off " +
+			"initcall_blacklist=ahci_pci_driver_init quiet first",
+		"--output=" + ukiPath,
+		"--secureboot-private-key=key.pem",
+	}
+	assert.Equal(t, expected, strings.Split(strings.TrimSpace(string(data)), "\n"))
+}
+
+func TestBuildUKI_Fails(t *testing.T) {
+	fakeUKIfy(t, "no stub found")
+
+	cmdSpec := qemu.CommandSpec{Kernel: "/boot/vmlinuz"}
+
+	err := buildUKI(context.Background(), &cmdSpec, t.TempDir(), nil)
+	require.ErrorContains(t, err, "no stub found")
+	assert.False(t, cmdSpec.UKI)
+}
@@ -5,12 +5,25 @@
 package virtrun
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/aibor/virtrun/internal/qemu"
 	"github.com/aibor/virtrun/internal/sys"
+	"github.com/aibor/virtrun/internal/tracing"
+	"github.com/aibor/virtrun/protocol"
+	"github.com/aibor/virtrun/sysinit"
 )
 
 // Spec describes a single [Run].
@@ -22,45 +35,514 @@ type Spec struct {
 	Initramfs Initramfs
 }
 
+// RunResult holds the data the guest sent about a [Run].
+type RunResult struct {
+	// Metrics are the samples of the resource usage of the guest, if
+	// [Qemu.MetricsInterval] is set.
+	Metrics []sysinit.Metrics
+
+	// Duration is the time QEMU ran.
+	Duration time.Duration
+
+	// BootDuration is the part of the Duration until the guest started the
+	// main binary. It is zero, if the guest did not communicate it.
+	BootDuration time.Duration
+
+	// RunDuration is the part of the Duration the main binary ran. It is
+	// zero, if the guest did not communicate it started the main binary.
+	RunDuration time.Duration
+
+	// InitramfsDuration is the time it took to build the initramfs archive
+	// file. It is close to zero, if [Initramfs.Archive] is set.
+	InitramfsDuration time.Duration
+
+	// EchoRoundTrips are the round trip times of the requests on the control
+	// console, if [Qemu.EchoCount] is set.
+	EchoRoundTrips []time.Duration
+
+	// CPUTime is the user and system CPU time of the QEMU process, so it
+	// includes the CPU time of the guest.
+	CPUTime time.Duration
+
+	// States are the state notifications the guest sent.
+	States []qemu.StateChange
+
+	// Phases are the lifecycle phases of the guest along with the lines of
+	// the output attributed to them.
+	Phases []qemu.PhaseSpan
+
+	// ExitCodeFound is true if the guest communicated an exit code, even if
+	// the run failed otherwise, like if QEMU did not exit in time.
+	ExitCodeFound bool
+
+	// Consoles are the consoles of the guest and where their output went.
+	Consoles []qemu.Console
+
+	// KernelReports are the bug reports of the guest kernel, like WARN_ON
+	// splats or lockdep reports, found in the output.
+	KernelReports []qemu.KernelReport
+
+	// InitramfsSHA256 is the hex encoded SHA-256 hash of the initramfs
+	// archive file.
+	InitramfsSHA256 string
+
+	// Artifacts are the files the guest sent into the artifact directory.
+	Artifacts []Artifact
+
+	// Warnings are conditions that did not fail the run, but might explain
+	// unexpected behavior, like a slow guest.
+	Warnings []Warning
+
+	// kernelLogOOM is the OOM kill of the main process found in the kernel
+	// log, if [Qemu.KernelLog] is set.
+	kernelLogOOM *qemu.GuestOOMError
+}
+
 // Run runs with the given [Spec].
 //
-// An initramfs archive file is built and used for running QEMU. It returns no
-// error if the run succeeds. To succeed, the guest system must explicitly
-// communicate exit code 0. The built initramfs archive file is removed, unless
-// [Spec.Initramfs.Keep] is set to true.
+// An initramfs archive file is built and used for running QEMU, unless
+// [Initramfs.Archive] is set. It returns no error if the run succeeds. To
+// succeed, the guest system must explicitly communicate exit code 0. The built
+// initramfs archive file is removed, unless [Initramfs.Keep] is set to true or
+// [Initramfs.Output] is set. It is built in memory and passed to QEMU as file
+// descriptor, if possible. See [Initramfs.NoMemfd]. If [Qemu.UKI] is set, a
+// Unified Kernel Image is built from the kernel, initramfs and kernel command
+// line and booted instead. If [Qemu.ConsoleLog] is set, the output is written
+// into log files in the artifact directory as well. If [Qemu.KernelLog] is
+// set, the kernel log of the guest is written into the artifact directory. If
+// [Qemu.ArtifactDir] is set, an index of the files the guest sent is written
+// into it. See [ArtifactIndexName]. Defaults are adapted to the container
+// environment virtrun runs in, unless [Qemu.NoContainerDetect] is set.
+//
+// The [RunResult] is returned once QEMU ran, even if the run failed, as it
+// might help finding the cause.
 func Run(
 	ctx context.Context,
 	spec *Spec,
 	stdin io.Reader,
 	stdout, stderr io.Writer,
-) error {
-	arch, err := sys.ReadELFArch(spec.Initramfs.Binary)
+) (*RunResult, error) {
+	var warnings []Warning
+
+	if !spec.Qemu.NoContainerDetect {
+		if container, detected := sys.DetectContainer(); detected {
+			warning := applyContainerDefaults(&spec.Qemu, container)
+			if warning.Code != "" {
+				warnings = append(warnings, warning)
+			}
+		}
+	}
+
+	arch, archWarnings, err := resolveArch(ctx, spec)
 	if err != nil {
-		return fmt.Errorf("read main binary arch: %w", err)
+		return nil, err
 	}
 
-	err = spec.Qemu.addDefaultsFor(arch)
+	warnings = append(warnings, archWarnings...)
+
+	buildStart := time.Now()
+	buildCtx, span := tracing.Start(ctx, "build initramfs")
+	archive, err := initramfsArchive(buildCtx, spec, arch)
+	span.SetError(err)
+	span.End()
+
+	initramfsDuration := time.Since(buildStart)
+
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer archive.remove() //nolint:errcheck
 
-	initFn := func() (fs.File, error) { return initProgFor(arch) }
+	hash, err := archive.sha256()
+	if err != nil {
+		return nil, fmt.Errorf("initramfs hash: %w", err)
+	}
 
-	path, removeFn, err := BuildInitramfsArchive(ctx, spec.Initramfs, initFn)
+	// The kernel panics early if the archive does not fit into memory,
+	// which is hard to relate to the archive's size.
+	size, err := archive.size()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("initramfs size: %w", err)
+	}
+
+	warning, err := checkInitramfsSize(size, spec.Qemu.Memory)
+	if err != nil {
+		return nil, err
+	}
+
+	if warning.Code != "" {
+		warnings = append(warnings, warning)
+	}
+
+	result := &RunResult{
+		InitramfsSHA256:   hash,
+		InitramfsDuration: initramfsDuration,
+		Warnings:          warnings,
 	}
-	defer removeFn() //nolint:errcheck
 
-	cmd, err := NewQemuCommand(ctx, spec.Qemu, path)
+	// The output is teed before QEMU starts, so the log files are complete.
+	if spec.Qemu.ConsoleLog {
+		dir := cmp.Or(spec.Qemu.ArtifactDir, ".")
+
+		logs := []struct {
+			name string
+			w    *io.Writer
+		}{
+			{ConsoleLogName, &stdout},
+			{QemuLogName, &stderr},
+		}
+
+		for _, log := range logs {
+			tee, file, err := teeConsoleLog(dir, log.name, *log.w)
+			if err != nil {
+				return nil, fmt.Errorf("console log: %w", err)
+			}
+			defer file.Close()
+
+			*log.w = tee
+
+			result.Artifacts = append(result.Artifacts, Artifact{
+				Path:   "/" + log.name,
+				Source: ArtifactSourceConsole,
+			})
+		}
+	}
+
+	if spec.Qemu.KernelLog {
+		dir := cmp.Or(spec.Qemu.ArtifactDir, ".")
+
+		file, err := sys.CreateFile(filepath.Join(dir, KernelLogName))
+		if err != nil {
+			return nil, fmt.Errorf("kernel log: %w", err)
+		}
+		defer file.Close()
+
+		spec.Qemu.KernelLogWriter = file
+
+		result.Artifacts = append(result.Artifacts, Artifact{
+			Path:   "/" + KernelLogName,
+			Source: ArtifactSourceConsole,
+		})
+	}
+
+	// QEMU does not create the directory of the raw console files.
+	if spec.Qemu.RawConsoleDir != "" {
+		err := os.MkdirAll(spec.Qemu.RawConsoleDir, 0o755)
+		if err != nil {
+			return nil, fmt.Errorf("raw console dir: %w", err)
+		}
+	}
+
+	cmdSpec := newCommandSpec(spec.Qemu, archive.path,
+		mainProcessName(spec.Initramfs), result)
+	cmdSpec.InitramfsFile = archive.file
+
+	nonce, err := protocol.NewExitCodeNonce()
 	if err != nil {
+		return nil, fmt.Errorf("exit code nonce: %w", err)
+	}
+
+	setExitCodeNonce(&cmdSpec, nonce)
+
+	// virtiofsd must be ready before QEMU connects to it.
+	if spec.Qemu.HostRoot {
+		dir, err := os.MkdirTemp(spec.Qemu.TempDir, "virtrun-virtiofs-")
+		if err != nil {
+			return nil, fmt.Errorf("virtiofs dir: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		socket, stop, err := startVirtiofsd(ctx, spec.Qemu.Virtiofsd, dir)
+		if err != nil {
+			return nil, err
+		}
+		defer stop()
+
+		shareHostRoot(&cmdSpec, socket)
+	}
+
+	// The UKI is built for each run, as the kernel command line differs.
+	if spec.Qemu.UKI {
+		dir, err := os.MkdirTemp(spec.Qemu.TempDir, "virtrun-uki-")
+		if err != nil {
+			return nil, fmt.Errorf("uki dir: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		_, span := tracing.Start(ctx, "build uki")
+		err = buildUKI(ctx, &cmdSpec, dir, spec.Qemu.UKIfyArgs)
+		span.SetError(err)
+		span.End()
+
+		if err != nil {
+			return nil, fmt.Errorf("build uki: %w", err)
+		}
+	}
+
+	cmd, err := newCommand(ctx, cmdSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Consoles = cmd.Consoles()
+
+	_, span = tracing.Start(ctx, "qemu")
+	start := time.Now()
+	runErr := cmd.Run(stdin, stdout, stderr)
+	result.Duration = time.Since(start)
+	result.States = cmd.States()
+	result.Phases = cmd.Phases()
+	result.ExitCodeFound = cmd.ExitCodeFound()
+	result.CPUTime = cmd.CPUTime()
+	result.KernelReports = cmd.KernelReports()
+	result.BootDuration, result.RunDuration = splitDuration(result.States,
+		result.Duration)
+
+	if runErr != nil {
+		runErr = fmt.Errorf("qemu run: %w",
+			withOOMKill(runErr, result.kernelLogOOM))
+
+		// Without any state change, the guest system did not even start,
+		// which is often caused by a kernel built without required options.
+		if len(result.States) == 0 {
+			runErr = errors.Join(runErr, checkKernelConfig(spec.Qemu))
+		}
+	}
+
+	addGuestSpans(span, start, result)
+	span.SetError(runErr)
+	span.End()
+
+	for _, path := range cmd.CollectedFiles() {
+		result.Artifacts = append(result.Artifacts, Artifact{
+			Path:   path,
+			Source: ArtifactSourceCollect,
+		})
+	}
+
+	// The index is written only into an explicitly given directory, so the
+	// current directory is not cluttered. It is written for failed runs as
+	// well, as the artifacts might help finding the cause.
+	if spec.Qemu.ArtifactDir != "" {
+		err := writeArtifactIndex(spec.Qemu.ArtifactDir, result.Artifacts)
+		if err != nil {
+			runErr = errors.Join(runErr, fmt.Errorf("artifact index: %w", err))
+		}
+	}
+
+	return result, runErr
+}
+
+// withOOMKill returns the given error of a run with the given OOM kill of the
+// main process as cause, if the guest failed without a more specific error,
+// like if it did not print an exit code. The error is returned as it is
+// otherwise.
+func withOOMKill(err error, oomErr *qemu.GuestOOMError) error {
+	var cmdErr *qemu.CommandError
+
+	if oomErr == nil || !errors.As(err, &cmdErr) || !cmdErr.Guest {
 		return err
 	}
 
-	err = cmd.Run(stdin, stdout, stderr)
+	if errors.Is(cmdErr.Err, qemu.ErrGuestNoExitCodeFound) ||
+		errors.Is(cmdErr.Err, qemu.ErrGuestNonZeroExitCode) {
+		cmdErr.Err = oomErr
+	}
+
+	return err
+}
+
+// resolveArch returns the [sys.Arch] of the main binary and adds the QEMU
+// defaults for it to the spec. The kernel must be built for the same
+// architecture. It is checked only if its architecture can be determined. If
+// no transport type is set, it is detected. See [detectTransportType]. If the
+// guest is emulated because KVM is not available, the spec is adapted and a
+// [Warning] is returned. See [applyEmulationDefaults].
+func resolveArch(ctx context.Context, spec *Spec) (sys.Arch, []Warning, error) {
+	arch, err := sys.ReadELFArch(spec.Initramfs.Binary)
 	if err != nil {
-		return fmt.Errorf("qemu run: %w", err)
+		return "", nil, fmt.Errorf("read main binary arch: %w", err)
 	}
 
-	return nil
+	if spec.Qemu.Arch != "" && spec.Qemu.Arch != arch {
+		return "", nil, fmt.Errorf("%w: main binary is %s, required is %s",
+			ErrArchMismatch, arch, spec.Qemu.Arch)
+	}
+
+	kernelArch, err := sys.ReadKernelArch(spec.Qemu.Kernel)
+	if err == nil && kernelArch != arch {
+		return "", nil, fmt.Errorf("%w: main binary is %s, kernel is %s",
+			ErrArchMismatch, arch, kernelArch)
+	}
+
+	detect := spec.Qemu.TransportType == ""
+
+	// The machine type can be changed for emulated guests only if neither it
+	// nor anything depending on it is set explicitly.
+	lightMachine := detect && spec.Qemu.Machine == "" &&
+		spec.Qemu.Firmware == "" && !spec.Qemu.UKI
+
+	var kvmErr error
+	if !spec.Qemu.NoKVM {
+		kvmErr = arch.CheckKVM()
+	}
+
+	err = spec.Qemu.AddDefaultsFor(arch)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var warnings []Warning
+
+	if kvmErr != nil {
+		machine := spec.Qemu.Machine
+		warning := applyEmulationDefaults(ctx, &spec.Qemu, arch, kvmErr,
+			lightMachine)
+		warnings = append(warnings, warning)
+
+		// The transport type is set along with the machine type.
+		detect = detect && spec.Qemu.Machine == machine
+	}
+
+	if detect {
+		spec.Qemu.TransportType, err = detectTransportType(ctx, spec.Qemu)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	return arch, warnings, nil
+}
+
+// archive is the initramfs archive file to run QEMU with. It is either the
+// file at path or an open file, like a memfd.
+type archive struct {
+	path   string
+	file   *os.File
+	remove func() error
+}
+
+// sha256 returns the hex encoded SHA-256 hash of the archive file.
+func (a archive) sha256() (string, error) {
+	if a.file != nil {
+		// The offset of the file is left alone by the section reader.
+		return readerSHA256(io.NewSectionReader(a.file, 0, math.MaxInt64))
+	}
+
+	file, err := os.Open(a.path)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	return readerSHA256(file)
+}
+
+// initramfsArchive returns the archive file to use. It builds the archive with
+// the init program for the given arch, unless a previously built one is given.
+// The archive is built into a memfd, unless it must be a file on disk, like
+// for building a UKI. If memfds are not supported, it falls back to a
+// temporary file. See [Initramfs.NoMemfd].
+func initramfsArchive(
+	ctx context.Context,
+	spec *Spec,
+	arch sys.Arch,
+) (archive, error) {
+	cfg := spec.Initramfs
+
+	if cfg.Archive != "" {
+		return archive{
+			path:   cfg.Archive,
+			remove: func() error { return nil },
+		}, nil
+	}
+
+	initFn := func() (fs.File, error) { return initProgFor(arch) }
+
+	if !cfg.NoMemfd && !cfg.Keep && cfg.Output == "" && !spec.Qemu.UKI {
+		file, err := buildInitramfsMemfd(ctx, cfg, initFn)
+		if err == nil {
+			return archive{file: file, remove: file.Close}, nil
+		}
+
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return archive{}, err
+		}
+
+		slog.Debug("Falling back to temporary initramfs archive file",
+			slog.Any("error", err))
+	}
+
+	path, removeFn, err := BuildInitramfsArchive(ctx, cfg, initFn)
+	if err != nil {
+		return archive{}, err
+	}
+
+	return archive{path: path, remove: removeFn}, nil
+}
+
+// readerSHA256 returns the hex encoded SHA-256 hash of the content read from
+// the given reader.
+func readerSHA256(r io.Reader) (string, error) {
+	hash := sha256.New()
+
+	_, err := io.Copy(hash, r)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// splitDuration splits the given total duration of a run into the time until
+// the guest started the main binary and the time the main binary ran, as
+// communicated by the given states. If the guest did not communicate the main
+// binary finished, it is assumed to have run until the end. Both are zero, if
+// the guest did not communicate the main binary started.
+func splitDuration(
+	states []qemu.StateChange,
+	total time.Duration,
+) (time.Duration, time.Duration) {
+	var (
+		boot, end      time.Duration
+		started, ended bool
+	)
+
+	for _, state := range states {
+		switch sysinit.State(state.State) {
+		case sysinit.StateMainStarted:
+			boot, started = state.Elapsed, true
+		case sysinit.StateMainFinished:
+			end, ended = state.Elapsed, true
+		}
+	}
+
+	if !started {
+		return 0, 0
+	}
+
+	if !ended || end < boot {
+		end = max(total, boot)
+	}
+
+	return boot, end - boot
+}
+
+// addGuestSpans adds the phases of the guest as reported by the result to
+// the given span of the QEMU run that started at the given time. They are
+// added only if the guest communicated it started the main binary.
+func addGuestSpans(span *tracing.Span, start time.Time, result *RunResult) {
+	if result.BootDuration == 0 {
+		return
+	}
+
+	mainStart := start.Add(result.BootDuration)
+	mainEnd := mainStart.Add(result.RunDuration)
+
+	span.Add("guest boot", start, mainStart)
+	span.Add("main run", mainStart, mainEnd)
+
+	if end := start.Add(result.Duration); end.After(mainEnd) {
+		span.Add("teardown", mainEnd, end)
+	}
 }
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package virtrun
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitDuration(t *testing.T) {
+	state := func(state sysinit.State, elapsed time.Duration) qemu.StateChange {
+		return qemu.StateChange{State: string(state), Elapsed: elapsed}
+	}
+
+	tests := []struct {
+		name         string
+		states       []qemu.StateChange
+		expectedBoot time.Duration
+		expectedRun  time.Duration
+	}{
+		{
+			name: "no states",
+		},
+		{
+			name: "main not started",
+			states: []qemu.StateChange{
+				state(sysinit.StateBooted, time.Second),
+			},
+		},
+		{
+			name: "main finished",
+			states: []qemu.StateChange{
+				state(sysinit.StateBooted, time.Second),
+				state(sysinit.StateMainStarted, 2*time.Second),
+				state(sysinit.StateMainFinished, 7*time.Second),
+			},
+			expectedBoot: 2 * time.Second,
+			expectedRun:  5 * time.Second,
+		},
+		{
+			name: "main not finished",
+			states: []qemu.StateChange{
+				state(sysinit.StateMainStarted, 2*time.Second),
+			},
+			expectedBoot: 2 * time.Second,
+			expectedRun:  8 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boot, run := splitDuration(tt.states, 10*time.Second)
+			assert.Equal(t, tt.expectedBoot, boot, "boot")
+			assert.Equal(t, tt.expectedRun, run, "run")
+		})
+	}
+}
+
+func TestArchive_SHA256(t *testing.T) {
+	// SHA-256 of "initramfs".
+	expected := "9752c38a9065f7646ffaac3621d1fa2f7dbe726c7e12e511eac7fdb14d4e2a24"
+
+	path := filepath.Join(t.TempDir(), "initramfs.cpio")
+	err := os.WriteFile(path, []byte("initramfs"), 0o600)
+	require.NoError(t, err)
+
+	t.Run("path", func(t *testing.T) {
+		hash, err := archive{path: path}.sha256()
+		require.NoError(t, err)
+		assert.Equal(t, expected, hash)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		file, err := os.Open(path)
+		require.NoError(t, err)
+
+		t.Cleanup(func() { _ = file.Close() })
+
+		hash, err := archive{file: file}.sha256()
+		require.NoError(t, err)
+		assert.Equal(t, expected, hash)
+
+		offset, err := file.Seek(0, io.SeekCurrent)
+		require.NoError(t, err)
+		assert.Zero(t, offset)
+	})
+}
+
+func TestWithOOMKill(t *testing.T) {
+	oomErr := &qemu.GuestOOMError{PID: 116, Process: "main"}
+
+	tests := []struct {
+		name        string
+		err         error
+		oomErr      *qemu.GuestOOMError
+		expectedErr error
+	}{
+		{
+			name: "no exit code",
+			err: &qemu.CommandError{
+				Guest: true,
+				Err:   qemu.ErrGuestNoExitCodeFound,
+			},
+			oomErr:      oomErr,
+			expectedErr: oomErr,
+		},
+		{
+			name: "non zero exit code",
+			err: &qemu.CommandError{
+				Guest:    true,
+				ExitCode: 137,
+				Err:      qemu.ErrGuestNonZeroExitCode,
+			},
+			oomErr:      oomErr,
+			expectedErr: oomErr,
+		},
+		{
+			name: "panic",
+			err: &qemu.CommandError{
+				Guest: true,
+				Err:   qemu.ErrGuestPanic,
+			},
+			oomErr:      oomErr,
+			expectedErr: qemu.ErrGuestPanic,
+		},
+		{
+			name: "host error",
+			err: &qemu.CommandError{
+				Err: qemu.ErrGuestNoExitCodeFound,
+			},
+			oomErr:      oomErr,
+			expectedErr: qemu.ErrGuestNoExitCodeFound,
+		},
+		{
+			name: "no oom kill",
+			err: &qemu.CommandError{
+				Guest: true,
+				Err:   qemu.ErrGuestNoExitCodeFound,
+			},
+			expectedErr: qemu.ErrGuestNoExitCodeFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := withOOMKill(tt.err, tt.oomErr)
+
+			var cmdErr *qemu.CommandError
+
+			require.ErrorAs(t, err, &cmdErr)
+			assert.Equal(t, tt.expectedErr, cmdErr.Err)
+		})
+	}
+}
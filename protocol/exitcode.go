@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExitCodePrefix is the default prefix of the exit code marker line, as
+// printed by the sysinit package.
+const ExitCodePrefix = "SYSINIT_EXIT_CODE"
+
+// ExitCodeVersion is the version of the exit code marker line. Markers of
+// other versions are not recognized.
+const ExitCodeVersion = 3
+
+// exitCodeChecksumSize is the number of bytes of the checksum of the exit code
+// marker line.
+const exitCodeChecksumSize = 8
+
+// exitCodeNonceSize is the number of random bytes of a nonce returned by
+// [NewExitCodeNonce].
+const exitCodeNonceSize = 16
+
+// NewExitCodeNonce returns a new random nonce for the exit code marker line
+// of a single run, encoded in hex. See [FormatExitCode].
+func NewExitCodeNonce() (string, error) {
+	nonce := make([]byte, exitCodeNonceSize)
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("read random: %w", err)
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+// FormatExitCode returns the marker line communicating the given exit code
+// with the given prefix. The checksum of the line is keyed by the nonce the
+// host passed to the guest for the current run. The nonce itself is not part
+// of the line.
+func FormatExitCode(prefix, nonce string, exitCode int) string {
+	payload := exitCodePayload(prefix, exitCode)
+	return payload + " " + exitCodeChecksum(nonce, payload)
+}
+
+// ParseExitCode returns the exit code communicated by the given line with the
+// given prefix and nonce. It returns false if the line is not a valid marker
+// line of the current [ExitCodeVersion] for the nonce. A trailing carriage
+// return, as added by terminals, is ignored.
+func ParseExitCode(prefix, nonce, line string) (int, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	rest, found := strings.CutPrefix(line, exitCodeHeader(prefix))
+	if !found {
+		return 0, false
+	}
+
+	code, checksum, found := strings.Cut(rest, " ")
+	if !found {
+		return 0, false
+	}
+
+	exitCode, err := strconv.Atoi(code)
+	if err != nil {
+		return 0, false
+	}
+
+	payload := exitCodePayload(prefix, exitCode)
+	if payload+" "+checksum != line {
+		return 0, false
+	}
+
+	expected := exitCodeChecksum(nonce, payload)
+	if !hmac.Equal([]byte(checksum), []byte(expected)) {
+		return 0, false
+	}
+
+	return exitCode, true
+}
+
+func exitCodeHeader(prefix string) string {
+	return fmt.Sprintf("%s v%d: ", prefix, ExitCodeVersion)
+}
+
+func exitCodePayload(prefix string, exitCode int) string {
+	return exitCodeHeader(prefix) + strconv.Itoa(exitCode)
+}
+
+func exitCodeChecksum(nonce, payload string) string {
+	mac := hmac.New(sha256.New, []byte(nonce))
+	_, _ = mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil)[:exitCodeChecksumSize])
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package protocol_test
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExitCodeNonce(t *testing.T) {
+	nonce, err := protocol.NewExitCodeNonce()
+	require.NoError(t, err)
+	assert.Len(t, nonce, 32)
+
+	other, err := protocol.NewExitCodeNonce()
+	require.NoError(t, err)
+	assert.NotEqual(t, nonce, other)
+}
+
+func TestFormatExitCode(t *testing.T) {
+	assert.Equal(t, "EXIT v3: 0 fcc4e19619e2115c",
+		protocol.FormatExitCode("EXIT", "nonce", 0))
+}
+
+func TestParseExitCode(t *testing.T) {
+	valid := protocol.FormatExitCode("EXIT", "nonce", 0)
+
+	tests := []struct {
+		name          string
+		line          string
+		expectedCode  int
+		expectedFound bool
+	}{
+		{
+			name:          "zero",
+			line:          valid,
+			expectedFound: true,
+		},
+		{
+			name:          "negative",
+			line:          protocol.FormatExitCode("EXIT", "nonce", -1),
+			expectedCode:  -1,
+			expectedFound: true,
+		},
+		{
+			name:          "carriage return",
+			line:          protocol.FormatExitCode("EXIT", "nonce", 3) + "\r",
+			expectedCode:  3,
+			expectedFound: true,
+		},
+		{
+			name: "other prefix",
+			line: protocol.FormatExitCode("OTHER", "nonce", 0),
+		},
+		{
+			name: "other nonce",
+			line: protocol.FormatExitCode("EXIT", "other", 0),
+		},
+		{
+			name: "no nonce",
+			line: protocol.FormatExitCode("EXIT", "", 0),
+		},
+		{
+			name: "legacy",
+			line: "EXIT: 0",
+		},
+		{
+			name: "other version",
+			line: "EXIT v2: 0 fcc4e19619e2115c",
+		},
+		{
+			name: "missing checksum",
+			line: "EXIT v3: 0",
+		},
+		{
+			name: "wrong checksum",
+			line: "EXIT v3: 0 0000000000000000",
+		},
+		{
+			name: "checksum of other code",
+			line: "EXIT v3: 1 fcc4e19619e2115c",
+		},
+		{
+			name: "non-canonical code",
+			line: "EXIT v3: 00 fcc4e19619e2115c",
+		},
+		{
+			name: "leading output",
+			line: "out" + valid,
+		},
+		{
+			name: "trailing output",
+			line: valid + " out",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, found := protocol.ParseExitCode("EXIT", "nonce", tt.line)
+			assert.Equal(t, tt.expectedFound, found, "found")
+			assert.Equal(t, tt.expectedCode, code, "code")
+		})
+	}
+}
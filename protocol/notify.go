@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NotifyFmt is the default format string of lines communicating state
+// changes of the guest, as printed by the sysinit package. States must not
+// contain white space.
+const NotifyFmt = "SYSINIT_NOTIFY: %s"
+
+// FormatNotification returns the line communicating the given state in the
+// given format.
+func FormatNotification(format, state string) string {
+	return fmt.Sprintf(format, state)
+}
+
+// CutNotification cuts the notification in the given format off the given
+// line. The notification may follow output that did not end with a newline.
+// It returns this output, the state and true if the line contains the
+// prefix of the format. The state is empty if the notification does not
+// match the format. It returns false, if the format is empty.
+func CutNotification(format, line string) (string, string, bool) {
+	prefix, _, _ := strings.Cut(format, "%")
+	if prefix == "" {
+		return line, "", false
+	}
+
+	before, notification, found := strings.Cut(line, prefix)
+	if !found {
+		return line, "", false
+	}
+
+	var state string
+
+	_, err := fmt.Sscanf(prefix+notification, format, &state)
+	if err != nil {
+		return before, "", true
+	}
+
+	return before, state, true
+}
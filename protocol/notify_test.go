@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package protocol_test
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatNotification(t *testing.T) {
+	assert.Equal(t, "SYSINIT_NOTIFY: booted",
+		protocol.FormatNotification(protocol.NotifyFmt, "booted"))
+}
+
+func TestCutNotification(t *testing.T) {
+	tests := []struct {
+		name           string
+		format         string
+		line           string
+		expectedBefore string
+		expectedState  string
+		expectedFound  bool
+	}{
+		{
+			name:          "notification",
+			format:        protocol.NotifyFmt,
+			line:          "SYSINIT_NOTIFY: booted",
+			expectedState: "booted",
+			expectedFound: true,
+		},
+		{
+			name:           "after output",
+			format:         protocol.NotifyFmt,
+			line:           "outSYSINIT_NOTIFY: setup-done",
+			expectedBefore: "out",
+			expectedState:  "setup-done",
+			expectedFound:  true,
+		},
+		{
+			name:          "malformed",
+			format:        protocol.NotifyFmt,
+			line:          "SYSINIT_NOTIFY: ",
+			expectedFound: true,
+		},
+		{
+			name:           "other output",
+			format:         protocol.NotifyFmt,
+			line:           "booted",
+			expectedBefore: "booted",
+		},
+		{
+			name:           "no format",
+			line:           "SYSINIT_NOTIFY: booted",
+			expectedBefore: "SYSINIT_NOTIFY: booted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, state, found := protocol.CutNotification(tt.format, tt.line)
+			assert.Equal(t, tt.expectedBefore, before, "before")
+			assert.Equal(t, tt.expectedState, state, "state")
+			assert.Equal(t, tt.expectedFound, found, "found")
+		})
+	}
+}
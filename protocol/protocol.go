@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package protocol defines the line formats an init in the guest
+// communicates with to the host on its console. The sysinit package
+// implements them for Go. Inits written in other languages must print the
+// same lines to work with virtrun in standalone mode.
+//
+// All lines are terminated by a newline. The host processes stdout line by
+// line.
+//
+// The exit code is printed in a single marker line in the form
+// "PREFIX vVERSION: CODE CHECKSUM", see [FormatExitCode]. The checksum is the
+// first 8 bytes of the HMAC-SHA256 of the line up to the checksum in hex,
+// keyed by a random nonce the host passes for each run on the kernel command
+// line as parameter "virtrun.exitnonce". So, output of the guest that just
+// contains the prefix, like the one of older versions of the protocol, or
+// markers printed in other runs are not mistaken for the marker. The host
+// stops processing the output once it found the marker, so it must be the
+// last line printed before the system is shut down.
+//
+// State changes are printed in lines in the form of [NotifyFmt], see
+// [FormatNotification]. They are optional. The host reports the last state
+// received if the guest does not print an exit code.
+//
+// Errors and warnings are printed on stderr in lines with [ErrorPrefix] and
+// [WarningPrefix]. An error should be printed before the exit code, so it is
+// shown to the user.
+package protocol
+
+// ErrorPrefix is the prefix of lines describing an error of the init.
+const ErrorPrefix = "Error: "
+
+// WarningPrefix is the prefix of lines describing a condition of the init
+// that does not fail it.
+const WarningPrefix = "Warning: "
+
+// FormatError returns the line describing the given error.
+func FormatError(err error) string {
+	return ErrorPrefix + err.Error()
+}
+
+// FormatWarning returns the line describing the given error as warning.
+func FormatWarning(err error) string {
+	return WarningPrefix + err.Error()
+}
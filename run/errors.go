@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package run
+
+import (
+	"errors"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+var (
+	// ErrNoKernel is returned if no kernel is given.
+	ErrNoKernel = errors.New("no kernel given")
+
+	// ErrNoBinary is returned if no binary is given.
+	ErrNoBinary = errors.New("no binary given")
+
+	// ErrGuestNonZeroExitCode is returned if the binary in the guest
+	// returned a non-zero exit code. The exit code is in
+	// [Result.ExitCode].
+	ErrGuestNonZeroExitCode = qemu.ErrGuestNonZeroExitCode
+
+	// ErrGuestNoExitCodeFound is returned if the guest did not communicate
+	// an exit code, like if it did not boot.
+	ErrGuestNoExitCodeFound = qemu.ErrGuestNoExitCodeFound
+
+	// ErrGuestPanic is returned if the guest kernel panicked.
+	ErrGuestPanic = qemu.ErrGuestPanic
+
+	// ErrGuestOom is returned if the guest ran out of memory.
+	ErrGuestOom = qemu.ErrGuestOom
+
+	// ErrGuestOutputMatch is returned if a line of the guest's output matched
+	// a pattern that fails the run.
+	ErrGuestOutputMatch = qemu.ErrGuestOutputMatch
+
+	// ErrGuestKernelReport is returned if the guest kernel reported a bug and
+	// [Spec.FailOnKernelReport] is set.
+	ErrGuestKernelReport = qemu.ErrGuestKernelReport
+
+	// ErrKernelConfigMissing is returned along with the error of a run that
+	// failed before the guest system started, if the kernel lacks options
+	// the guest system requires.
+	ErrKernelConfigMissing = virtrun.ErrKernelConfigMissing
+)
@@ -0,0 +1,274 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package run launches virtrun guests from Go programs without the virtrun
+// command line tool.
+//
+// A guest is a QEMU virtual machine that boots the given kernel with an
+// initramfs built for the given binary. The binary is run by virtrun's init,
+// which communicates its exit code to the host and powers the guest off once
+// the binary returned. Output of the binary is written to the given stdout.
+//
+//	result, err := run.Run(ctx, run.Spec{
+//		Kernel: "/boot/vmlinuz-linux",
+//		Binary: "bin.test",
+//		Args:   []string{"-test.v"},
+//	}, nil, os.Stdout, os.Stderr)
+//
+// Messages are logged with the default [slog.Logger].
+package run
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+)
+
+const (
+	defaultCPU    = "max"
+	defaultMemory = 256
+	defaultSMP    = 1
+)
+
+// Spec describes a single guest run. Only Kernel and Binary are required.
+// Paths are host paths and relative to the current working directory.
+type Spec struct {
+	// Kernel is the path of the kernel to boot.
+	Kernel string
+
+	// Binary is the path of the binary to run in the guest.
+	Binary string
+
+	// Args are the arguments the binary is called with.
+	Args []string
+
+	// Env are environment variables in the form "KEY=VALUE" set for the
+	// binary.
+	Env []string
+
+	// Files are additional files added to the guest's /data directory,
+	// which is in the PATH of the binary. Required shared libraries of ELF
+	// files are added as well.
+	Files []string
+
+	// FileTargets are additional files added with a guest name different
+	// from their host name. See [Spec.AddFileAs].
+	FileTargets []FileTarget
+
+	// Modules are kernel module files that are loaded before the binary is
+	// run.
+	Modules []string
+
+	// Content is a tree of files merged into the root of the guest's file
+	// system, like test fixtures embedded with an [embed.FS], so they do not
+	// need to be written to disk first. Its paths are the guest paths.
+	// Shared libraries of its ELF files are not added.
+	Content fs.FS
+
+	// Standalone runs the binary as init itself, instead of virtrun's init.
+	// The binary must have virtrun support built in with package
+	// [github.com/aibor/virtrun/sysinit].
+	Standalone bool
+
+	// Executable is the QEMU binary. The default depends on the
+	// architecture of the binary.
+	Executable string
+
+	// Machine is the QEMU machine type. The default depends on the
+	// architecture of the binary.
+	Machine string
+
+	// CPU is the QEMU CPU type. Default is "max".
+	CPU string
+
+	// Memory is the memory of the guest in MB. Default is 256.
+	Memory uint64
+
+	// SMP is the number of CPUs of the guest. Default is 1.
+	SMP uint64
+
+	// NoKVM disables hardware acceleration. It is disabled anyway, if KVM
+	// is not available for the architecture of the binary.
+	NoKVM bool
+
+	// Verbose writes the kernel and init output to stdout as well.
+	Verbose bool
+
+	// Collect are glob patterns of absolute guest paths that are copied into
+	// the ArtifactDir once the binary returned, keeping their guest path.
+	Collect []string
+
+	// ArtifactDir is the directory collected files are written to. Default
+	// is the current working directory.
+	ArtifactDir string
+
+	// Consoles are writers the output of additional consoles of the guest is
+	// written to line by line, like a [bytes.Buffer] for in-memory capture.
+	// The binary finds them in the given order after the default console,
+	// like /dev/hvc1 and /dev/hvc2.
+	Consoles []io.Writer
+
+	// Filters are called in order with each line of the output of the
+	// guest's stdout. A filter returns the line to write to stdout, which may
+	// be modified, like redacted, or nil to drop it. If it returns an error,
+	// the run fails with it, like a filter can do for warnings in the kernel
+	// log. The line must not be retained or modified in place.
+	Filters []func(line []byte) ([]byte, error)
+
+	// FailOnKernelReport fails the run with [ErrGuestKernelReport] if the
+	// guest kernel reports a bug, like a WARN_ON splat or a lockdep report.
+	FailOnKernelReport bool
+}
+
+// FileTarget is a host file that is added to the guest as Target. See
+// [Spec.AddFileAs].
+type FileTarget struct {
+	// Source is the host path.
+	Source string
+
+	// Target is the absolute guest path or a file name in the guest's /data
+	// directory.
+	Target string
+}
+
+// AddFileAs adds the host file at source to the guest as target, like a
+// config file expected at "/etc/foo.conf". If target is a plain file name,
+// the file is added to the guest's /data directory with that name, like the
+// Files. Required shared libraries of ELF files are added as well.
+func (s *Spec) AddFileAs(source, target string) {
+	s.FileTargets = append(s.FileTargets, FileTarget{
+		Source: source,
+		Target: target,
+	})
+}
+
+// Result is the result of a guest run.
+type Result struct {
+	// ExitCode is the exit code the binary returned. It is valid only if
+	// [Run] returned no error or [ErrGuestNonZeroExitCode].
+	ExitCode int
+
+	// Duration is the time QEMU ran.
+	Duration time.Duration
+
+	// BootDuration is the part of the Duration until the guest started the
+	// binary.
+	BootDuration time.Duration
+
+	// RunDuration is the part of the Duration the binary ran.
+	RunDuration time.Duration
+
+	// CPUTime is the user and system CPU time of the QEMU process.
+	CPUTime time.Duration
+
+	// Artifacts are the guest paths of the files collected into the
+	// artifact directory.
+	Artifacts []string
+}
+
+// Run runs a guest as described by the given [Spec]. The given stdin is
+// passed to the binary. Output of the binary is written to stdout. Output of
+// QEMU is written to stderr.
+//
+// It returns no error, if the binary returned exit code 0. If it returned a
+// different exit code, [ErrGuestNonZeroExitCode] is returned. The guest is
+// stopped once the context is canceled.
+//
+// The [Result] is returned if the guest ran, even if the run failed.
+func Run(
+	ctx context.Context,
+	spec Spec,
+	stdin io.Reader,
+	stdout, stderr io.Writer,
+) (*Result, error) {
+	internalSpec, err := spec.internal()
+	if err != nil {
+		return nil, err
+	}
+
+	runResult, err := virtrun.Run(ctx, internalSpec, stdin, stdout, stderr)
+	if runResult == nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return newResult(runResult, err), err //nolint:wrapcheck
+}
+
+// internal returns the [virtrun.Spec] for the spec with the defaults set.
+func (s Spec) internal() (*virtrun.Spec, error) {
+	if s.Kernel == "" {
+		return nil, ErrNoKernel
+	}
+
+	if s.Binary == "" {
+		return nil, ErrNoBinary
+	}
+
+	var filters []qemu.LineFilter
+	for _, filter := range s.Filters {
+		filters = append(filters, filter)
+	}
+
+	var fileTargets []virtrun.FileTarget
+	for _, file := range s.FileTargets {
+		fileTargets = append(fileTargets, virtrun.FileTarget(file))
+	}
+
+	return &virtrun.Spec{
+		Qemu: virtrun.Qemu{
+			Executable:         s.Executable,
+			Kernel:             s.Kernel,
+			Machine:            s.Machine,
+			CPU:                cmp.Or(s.CPU, defaultCPU),
+			SMP:                cmp.Or(s.SMP, defaultSMP),
+			Memory:             cmp.Or(s.Memory, defaultMemory),
+			InitArgs:           append([]string{}, s.Args...),
+			NoKVM:              s.NoKVM,
+			Verbose:            s.Verbose,
+			Env:                s.Env,
+			Collect:            s.Collect,
+			ArtifactDir:        s.ArtifactDir,
+			ConsoleWriters:     s.Consoles,
+			LineFilters:        filters,
+			FailOnKernelReport: s.FailOnKernelReport,
+		},
+		Initramfs: virtrun.Initramfs{
+			Binary:         s.Binary,
+			Files:          s.Files,
+			FileTargets:    fileTargets,
+			Modules:        s.Modules,
+			Content:        s.Content,
+			StandaloneInit: s.Standalone,
+		},
+	}, nil
+}
+
+// newResult returns the [Result] for the given result and error of
+// [virtrun.Run].
+func newResult(runResult *virtrun.RunResult, err error) *Result {
+	result := &Result{
+		Duration:     runResult.Duration,
+		BootDuration: runResult.BootDuration,
+		RunDuration:  runResult.RunDuration,
+		CPUTime:      runResult.CPUTime,
+	}
+
+	var cmdErr *qemu.CommandError
+
+	if errors.As(err, &cmdErr) && errors.Is(err, ErrGuestNonZeroExitCode) {
+		result.ExitCode = cmdErr.ExitCode
+	}
+
+	for _, artifact := range runResult.Artifacts {
+		result.Artifacts = append(result.Artifacts, artifact.Path)
+	}
+
+	return result
+}
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package run
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aibor/virtrun/internal/qemu"
+	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpec_Internal(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        Spec
+		expected    *virtrun.Spec
+		expectedErr error
+	}{
+		{
+			name:        "no kernel",
+			spec:        Spec{Binary: "bin.test"},
+			expectedErr: ErrNoKernel,
+		},
+		{
+			name:        "no binary",
+			spec:        Spec{Kernel: "/boot/vmlinuz"},
+			expectedErr: ErrNoBinary,
+		},
+		{
+			name: "defaults",
+			spec: Spec{Kernel: "/boot/vmlinuz", Binary: "bin.test"},
+			expected: &virtrun.Spec{
+				Qemu: virtrun.Qemu{
+					Kernel:   "/boot/vmlinuz",
+					CPU:      "max",
+					SMP:      1,
+					Memory:   256,
+					InitArgs: []string{},
+				},
+				Initramfs: virtrun.Initramfs{
+					Binary: "bin.test",
+				},
+			},
+		},
+		{
+			name: "all",
+			spec: Spec{
+				Kernel:             "/boot/vmlinuz",
+				Binary:             "bin.test",
+				Args:               []string{"-test.v"},
+				Env:                []string{"FOO=bar"},
+				Files:              []string{"/usr/bin/strace"},
+				FileTargets:        []FileTarget{{"foo.conf", "/etc/foo.conf"}},
+				Modules:            []string{"veth.ko"},
+				Content:            fstest.MapFS{},
+				Standalone:         true,
+				Executable:         "qemu-system-aarch64",
+				Machine:            "virt",
+				CPU:                "cortex-a57",
+				Memory:             512,
+				SMP:                2,
+				NoKVM:              true,
+				Verbose:            true,
+				Collect:            []string{"/tmp/*.xml"},
+				ArtifactDir:        "out",
+				Consoles:           []io.Writer{io.Discard},
+				FailOnKernelReport: true,
+			},
+			expected: &virtrun.Spec{
+				Qemu: virtrun.Qemu{
+					Executable:         "qemu-system-aarch64",
+					Kernel:             "/boot/vmlinuz",
+					Machine:            "virt",
+					CPU:                "cortex-a57",
+					SMP:                2,
+					Memory:             512,
+					InitArgs:           []string{"-test.v"},
+					NoKVM:              true,
+					Verbose:            true,
+					Env:                []string{"FOO=bar"},
+					Collect:            []string{"/tmp/*.xml"},
+					ArtifactDir:        "out",
+					ConsoleWriters:     []io.Writer{io.Discard},
+					FailOnKernelReport: true,
+				},
+				Initramfs: virtrun.Initramfs{
+					Binary:         "bin.test",
+					Files:          []string{"/usr/bin/strace"},
+					Modules:        []string{"veth.ko"},
+					Content:        fstest.MapFS{},
+					StandaloneInit: true,
+					FileTargets: []virtrun.FileTarget{
+						{Source: "foo.conf", Target: "/etc/foo.conf"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := tt.spec.internal()
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestNewResult(t *testing.T) {
+	runResult := &virtrun.RunResult{
+		Duration:     time.Second,
+		BootDuration: 300 * time.Millisecond,
+		RunDuration:  600 * time.Millisecond,
+		CPUTime:      2 * time.Second,
+		Artifacts: []virtrun.Artifact{
+			{Path: "/tmp/report.xml"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected *Result
+	}{
+		{
+			name: "success",
+			expected: &Result{
+				Duration:     time.Second,
+				BootDuration: 300 * time.Millisecond,
+				RunDuration:  600 * time.Millisecond,
+				CPUTime:      2 * time.Second,
+				Artifacts:    []string{"/tmp/report.xml"},
+			},
+		},
+		{
+			name: "non zero exit code",
+			err: fmt.Errorf("qemu run: %w", &qemu.CommandError{
+				Err:      qemu.ErrGuestNonZeroExitCode,
+				Guest:    true,
+				ExitCode: 3,
+			}),
+			expected: &Result{
+				ExitCode:     3,
+				Duration:     time.Second,
+				BootDuration: 300 * time.Millisecond,
+				RunDuration:  600 * time.Millisecond,
+				CPUTime:      2 * time.Second,
+				Artifacts:    []string{"/tmp/report.xml"},
+			},
+		},
+		{
+			name: "panic",
+			err: &qemu.CommandError{
+				Err:   qemu.ErrGuestPanic,
+				Guest: true,
+			},
+			expected: &Result{
+				Duration:     time.Second,
+				BootDuration: 300 * time.Millisecond,
+				RunDuration:  600 * time.Millisecond,
+				CPUTime:      2 * time.Second,
+				Artifacts:    []string{"/tmp/report.xml"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, newResult(runResult, tt.err))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// BinfmtMiscDir is the directory the binfmt_misc file system is mounted at.
+const BinfmtMiscDir = "/proc/sys/fs/binfmt_misc"
+
+// RegisterBinfmt registers an interpreter for binaries with the binfmt_misc
+// kernel feature. The rule has the form
+// ":name:type:offset:magic:mask:interpreter:flags" as documented in the kernel
+// documentation admin-guide/binfmt-misc.
+//
+// This requires the binfmt_misc file system to be mounted at [BinfmtMiscDir].
+// The interpreter must be present at the given path. Set the "F" flag, if it
+// should be opened once at registration, so it does not need to be present in
+// other mount namespaces.
+func RegisterBinfmt(rule string) error {
+	register, err := os.OpenFile(BinfmtMiscDir+"/register", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("open register: %w", err)
+	}
+	defer register.Close()
+
+	_, err = register.WriteString(rule)
+	if err != nil {
+		return fmt.Errorf("register binfmt %s: %w", rule, err)
+	}
+
+	return nil
+}
+
+// RegisterBinfmtFrom registers the rules of all files in the given directory
+// in lexicographic order of their paths. Files have the format described in
+// binfmt.d(5): one [RegisterBinfmt] rule per line. Empty lines and lines
+// starting with "#" or ";" are ignored.
+//
+// A missing directory is not an error.
+func RegisterBinfmtFrom(dir string) error {
+	files, err := ListRegularFiles(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("list binfmt files: %w", err)
+	}
+
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open binfmt file: %w", err)
+		}
+
+		rules, err := parseBinfmtRules(file)
+
+		_ = file.Close()
+
+		if err != nil {
+			return fmt.Errorf("read binfmt file %s: %w", path, err)
+		}
+
+		for _, rule := range rules {
+			if err := RegisterBinfmt(rule); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseBinfmtRules returns the rules in the given binfmt.d(5) file.
+func parseBinfmtRules(r io.Reader) ([]string, error) {
+	var rules []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") ||
+			strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		rules = append(rules, line)
+	}
+
+	return rules, scanner.Err() //nolint:wrapcheck
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBinfmtRules(t *testing.T) {
+	input := strings.Join([]string{
+		"# qemu-user interpreters",
+		"",
+		"; another comment",
+		//nolint:lll
+		`:qemu-aarch64:M::\x7fELF\x02\x01\x01:\xff\xff\xff\xff\xff\xff\xff:/data/qemu-aarch64:F`,
+		"  :wasm:E::wasm::/data/wasmtime:  ",
+	}, "\n")
+
+	rules, err := parseBinfmtRules(strings.NewReader(input))
+	require.NoError(t, err)
+
+	expected := []string{
+		//nolint:lll
+		`:qemu-aarch64:M::\x7fELF\x02\x01\x01:\xff\xff\xff\xff\xff\xff\xff:/data/qemu-aarch64:F`,
+		":wasm:E::wasm::/data/wasmtime:",
+	}
+
+	assert.Equal(t, expected, rules)
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultRTCDevice is the path to the default real time clock device.
+const DefaultRTCDevice = "/dev/rtc0"
+
+// ErrNoClockSource is returned if no source for the system clock is
+// available.
+var ErrNoClockSource = errors.New("no clock source available")
+
+// ReadRTC reads the current time from the real time clock device with the
+// given path.
+//
+// The hardware clock is expected to run in UTC, which is the default for QEMU.
+func ReadRTC(path string) (time.Time, error) {
+	return readRTC(path)
+}
+
+// SetSystemClock sets the system clock to the given time.
+func SetSystemClock(t time.Time) error {
+	return setSystemClock(t)
+}
+
+// SyncClock sets the system clock from the real time clock device at the
+// given path.
+//
+// If the device can not be read, the given fallback time is used, unless it
+// is the zero value, in which case [ErrNoClockSource] is returned along with
+// the RTC error.
+func SyncClock(rtcPath string, fallback time.Time) error {
+	now, err := ReadRTC(rtcPath)
+	if err != nil {
+		if fallback.IsZero() {
+			return errors.Join(ErrNoClockSource, err)
+		}
+
+		now = fallback
+	}
+
+	return SetSystemClock(now)
+}
+
+// epochFrom returns the time from the [ParamEpoch] parameter. It returns the
+// zero time if the parameter is not present.
+func epochFrom(params CmdlineParams) (time.Time, error) {
+	value, exists := params[ParamEpoch]
+	if !exists {
+		return time.Time{}, nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse epoch: %w", err)
+	}
+
+	return time.Unix(seconds, 0), nil
+}
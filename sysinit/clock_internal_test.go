@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpochFrom(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    CmdlineParams
+		expected  time.Time
+		assertErr require.ErrorAssertionFunc
+	}{
+		{
+			name:      "missing",
+			params:    CmdlineParams{},
+			assertErr: require.NoError,
+		},
+		{
+			name:      "valid",
+			params:    CmdlineParams{ParamEpoch: "1700000000"},
+			expected:  time.Unix(1700000000, 0),
+			assertErr: require.NoError,
+		},
+		{
+			name:      "invalid",
+			params:    CmdlineParams{ParamEpoch: "yesterday"},
+			assertErr: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := epochFrom(tt.params)
+			tt.assertErr(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
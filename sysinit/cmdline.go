@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Kernel command line parameters the host may set to configure the guest.
+//
+// They are prefixed with "virtrun." so the kernel treats them as module
+// parameters and does not pass them to the init as environment variables or
+// arguments. The same names must be used by the host so they are matched
+// correctly.
+const (
+	// ParamPTY requests the main binary to be run with a pseudo-terminal as
+	// its controlling terminal.
+	ParamPTY = "virtrun.pty"
+
+	// ParamLogDevice is the path of the console device structured log
+	// records of the init are written to.
+	ParamLogDevice = "virtrun.log"
+
+	// ParamMountOptions is a list of additional mount options for known
+	// mount points in the form "PATH:OPTIONS;PATH:OPTIONS". See
+	// [MountPoints.AddOptionsList].
+	ParamMountOptions = "virtrun.mountopts"
+
+	// ParamEpoch is the host's time in seconds since the Unix epoch at the
+	// time the guest is started. It is used to set the system clock if no
+	// real time clock device is available.
+	ParamEpoch = "virtrun.epoch"
+
+	// ParamExitCodeNonce is the random nonce of the current run the exit
+	// code marker line is keyed by. See [PrintExitCode].
+	ParamExitCodeNonce = "virtrun.exitnonce"
+
+	// ParamSysctls is a list of kernel parameters to set in the form
+	// "KEY=VALUE;KEY=VALUE". See [Sysctls.AddList].
+	ParamSysctls = "virtrun.sysctls"
+
+	// ParamOOMScoreAdj is the OOM score adjustment for the main binary. See
+	// [ExecOptions].
+	ParamOOMScoreAdj = "virtrun.oomscoreadj"
+
+	// ParamCollect is a list of glob patterns in the form
+	// "PATTERN;PATTERN" for files that are sent to the host once the main
+	// function returned. See [CollectFiles].
+	ParamCollect = "virtrun.collect"
+
+	// ParamCollectDevice is the path of the console device collected files
+	// are written to.
+	ParamCollectDevice = "virtrun.collectdev"
+
+	// ParamZramSwap is the size in bytes of a zram swap space to enable. See
+	// [EnableZramSwap].
+	ParamZramSwap = "virtrun.zramswap"
+
+	// ParamControlDevice is the path of the console device requests of the
+	// host are received on. See [ControlMethodEnv] and the other control
+	// methods.
+	ParamControlDevice = "virtrun.controldev"
+
+	// ParamPush requests the init to receive files from the host before the
+	// main function is run. See [HostMethodPush].
+	ParamPush = "virtrun.push"
+
+	// ParamEcho is the number of round trip times the init measures on the
+	// control console before the main function is run. See
+	// [HostMethodEcho].
+	ParamEcho = "virtrun.echo"
+
+	// ParamJob requests the init to wait for a job of the host once the
+	// system is set up. The job replaces the main binary given by the init.
+	// See [HostMethodJob].
+	ParamJob = "virtrun.job"
+
+	// ParamHeartbeat is the interval the init sends heartbeats to the host
+	// with on the control console, in the format of [time.ParseDuration].
+	// This way, the host can tell a hung guest from a busy one.
+	ParamHeartbeat = "virtrun.heartbeat"
+
+	// ParamMetrics is the interval the init samples the resource usage of
+	// the system with, in the format of [time.ParseDuration]. The samples
+	// are sent to the host on the control console. See [Metrics].
+	ParamMetrics = "virtrun.metrics"
+
+	// ParamReadOnly is a list of paths in the form "PATH;PATH" that are made
+	// read-only. See [Config.ReadOnlyPaths].
+	ParamReadOnly = "virtrun.readonly"
+
+	// ParamModulesAutoload enables loading only the kernel modules required
+	// by present devices. See [Config.ModulesAutoload].
+	ParamModulesAutoload = "virtrun.modautoload"
+
+	// ParamUserNamespace requests the main binary to be run in a new user
+	// namespace. The value is an optional list of ID mappings used for both
+	// user and group IDs. See [ParseIDMappings] for the format. If empty,
+	// [DefaultIDMapping] is used.
+	ParamUserNamespace = "virtrun.userns"
+
+	// ParamHostRoot is the tag of the virtiofs file system sharing the
+	// host's root directory. The main binary is run chrooted into it with a
+	// writable overlay on top. See [MountOverlayRoot].
+	ParamHostRoot = "virtrun.hostroot"
+
+	// ParamSeed is a random seed as decimal integer for reproducible runs.
+	// See [Config.SeedFromCmdline].
+	ParamSeed = "virtrun.seed"
+
+	// ParamForward is a list of socket addresses in the form
+	// "ADDRESS;ADDRESS" the init listens on. Connections are forwarded to the
+	// host via the control console. See [ForwardParams].
+	ParamForward = "virtrun.forward"
+
+	// ParamDebugTool is a command in the form "PATH;ARG;ARG" the main binary
+	// is run under, like a tracer. See [ExecOptions.Wrapper]. The output of
+	// the tool is expected in [DebugDir].
+	ParamDebugTool = "virtrun.debugtool"
+
+	// ParamKmsgDevice is the path of the console device the records of the
+	// kernel log are streamed to while the init runs, as read from
+	// "/dev/kmsg".
+	ParamKmsgDevice = "virtrun.kmsgdev"
+
+	// ParamConsoles is a list of named additional consoles in the form
+	// "NAME=DEVICE;NAME=DEVICE", like "trace=hvc1". See
+	// [CmdlineParams.Consoles].
+	ParamConsoles = "virtrun.consoles"
+)
+
+// DebugDir is the directory the init creates for the output of the debug
+// tool given by [ParamDebugTool]. It is below "/tmp", so it is available for
+// binaries run chrooted as well.
+const DebugDir = "/tmp/debug"
+
+// CmdlineEnvPrefix is the prefix of kernel command line parameters that are
+// exported as environment variables without the prefix. The host writes them
+// for environment variables that should be present for the main binary.
+const CmdlineEnvPrefix = "VIRTRUN_ENV_"
+
+// CmdlineParams is a map of kernel command line parameter values by name.
+//
+// Parameters without value are present with the empty string as value.
+type CmdlineParams map[string]string
+
+// Has returns true if the parameter with the given name is present.
+func (p CmdlineParams) Has(name string) bool {
+	_, exists := p[name]
+	return exists
+}
+
+// Env returns all parameters with the [CmdlineEnvPrefix]. The prefix is
+// removed from the returned names.
+func (p CmdlineParams) Env() EnvVars {
+	env := make(EnvVars)
+
+	for name, value := range p {
+		key, found := strings.CutPrefix(name, CmdlineEnvPrefix)
+		if found && key != "" {
+			env[key] = value
+		}
+	}
+
+	return env
+}
+
+// Consoles returns the device paths of the named consoles given by
+// [ParamConsoles] by name, like "/dev/hvc1". Malformed entries are ignored.
+func (p CmdlineParams) Consoles() map[string]string {
+	consoles := make(map[string]string)
+
+	for _, entry := range strings.Split(p[ParamConsoles], ";") {
+		name, device, found := strings.Cut(entry, "=")
+		if found && name != "" && device != "" {
+			consoles[name] = "/dev/" + device
+		}
+	}
+
+	return consoles
+}
+
+// ReadCmdline reads and parses the kernel command line of the running system.
+//
+// This requires the proc file system to be mounted at "/proc".
+func ReadCmdline() (CmdlineParams, error) {
+	data, err := os.ReadFile("/proc/cmdline")
+	if err != nil {
+		return nil, fmt.Errorf("read cmdline: %w", err)
+	}
+
+	return ParseCmdline(string(data)), nil
+}
+
+// readCmdlineEarly reads the kernel command line like [ReadCmdline]. If the
+// proc file system is not mounted yet, it is mounted temporarily.
+func readCmdlineEarly() (CmdlineParams, error) {
+	params, err := ReadCmdline()
+	if !errors.Is(err, os.ErrNotExist) {
+		return params, err
+	}
+
+	err = Mount("/proc", MountOptions{FSType: FSTypeProc})
+	if err != nil {
+		return nil, err
+	}
+
+	defer unmount("/proc") //nolint:errcheck
+
+	return ReadCmdline()
+}
+
+// ParseCmdline parses the given kernel command line.
+//
+// Parameters are separated by white space. Values may be enclosed in double
+// quotes, in which case they may contain white space as well. Parsing stops
+// at the init arguments separator "--".
+func ParseCmdline(cmdline string) CmdlineParams {
+	params := make(CmdlineParams)
+
+	for _, field := range splitCmdline(cmdline) {
+		if field == "--" {
+			break
+		}
+
+		name, value, _ := strings.Cut(field, "=")
+		params[name] = strings.ReplaceAll(value, `"`, "")
+	}
+
+	return params
+}
+
+// splitCmdline splits the kernel command line at white space that is not
+// enclosed in double quotes.
+func splitCmdline(cmdline string) []string {
+	var inQuotes bool
+
+	return strings.FieldsFunc(cmdline, func(r rune) bool {
+		if r == '"' {
+			inQuotes = !inQuotes
+		}
+
+		return !inQuotes && (r == ' ' || r == '\t' || r == '\n')
+	})
+}
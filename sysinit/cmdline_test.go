@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit_test
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCmdline(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmdline  string
+		expected sysinit.CmdlineParams
+	}{
+		{
+			name:     "empty",
+			cmdline:  "",
+			expected: sysinit.CmdlineParams{},
+		},
+		{
+			name:    "simple",
+			cmdline: "console=hvc0 quiet panic=-1\n",
+			expected: sysinit.CmdlineParams{
+				"console": "hvc0",
+				"quiet":   "",
+				"panic":   "-1",
+			},
+		},
+		{
+			name:    "quoted value",
+			cmdline: `virtrun.some="with space" other=x`,
+			expected: sysinit.CmdlineParams{
+				"virtrun.some": "with space",
+				"other":        "x",
+			},
+		},
+		{
+			name:    "stops at init args",
+			cmdline: "quiet virtrun.pty -- -test.v virtrun.other",
+			expected: sysinit.CmdlineParams{
+				"quiet":       "",
+				"virtrun.pty": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := sysinit.ParseCmdline(tt.cmdline)
+			assert.Equal(t, tt.expected, actual)
+			assert.False(t, actual.Has("missing"))
+		})
+	}
+}
+
+func TestCmdlineParams_Env(t *testing.T) {
+	params := sysinit.ParseCmdline(
+		`quiet VIRTRUN_ENV_FOO=bar VIRTRUN_ENV_SPACE="a b" VIRTRUN_ENV_ ` +
+			`VIRTRUN_ENV_EMPTY= OTHER=x -- VIRTRUN_ENV_ARG=y`,
+	)
+
+	expected := sysinit.EnvVars{
+		"FOO":   "bar",
+		"SPACE": "a b",
+		"EMPTY": "",
+	}
+
+	assert.Equal(t, expected, params.Env())
+}
+
+func TestCmdlineParams_Consoles(t *testing.T) {
+	params := sysinit.ParseCmdline(
+		`quiet virtrun.consoles=trace=hvc1;events=ttyS2;broken;=hvc3`,
+	)
+
+	expected := map[string]string{
+		"trace":  "/dev/hvc1",
+		"events": "/dev/ttyS2",
+	}
+
+	assert.Equal(t, expected, params.Consoles())
+}
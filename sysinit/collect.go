@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/aibor/virtrun/internal/pipe"
+)
+
+// CollectFiles writes all files matching the given glob patterns to dst, so
+// the host can write them into its artifact directory.
+//
+// Patterns are matched by [filepath.Glob]. Directories are collected
+// recursively. Each file is sent as a stream of the framed pipe protocol
+// named by its absolute path. Text files, like logs, are sent uncompressed,
+// so they are readable in the raw console output. Binary files, like
+// profiles, are sent gzip compressed.
+func CollectFiles(patterns []string, dst io.Writer) error {
+	return collect(patterns, pipe.NewWriter(dst))
+}
+
+func collect(patterns []string, writer *pipe.Writer) error {
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("glob %s: %w", pattern, err)
+		}
+
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(
+				path string,
+				entry fs.DirEntry,
+				err error,
+			) error {
+				if err != nil || !entry.Type().IsRegular() {
+					return err
+				}
+
+				return sendFile(writer, path)
+			})
+			if err != nil {
+				return fmt.Errorf("collect %s: %w", match, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func sendFile(writer *pipe.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	reader := bufio.NewReaderSize(file, textSniffSize)
+
+	// Errors show up again when the file is read for sending.
+	sample, _ := reader.Peek(textSniffSize)
+
+	compression := pipe.CompressionGzip
+	if isText(sample) {
+		compression = pipe.CompressionNone
+	}
+
+	//nolint:wrapcheck
+	return writer.SendStreamWithCompression(absPath, compression, reader)
+}
+
+// textSniffSize is the number of bytes at the start of a file that are
+// checked to tell text from binary files.
+const textSniffSize = 512
+
+// isText returns true if the given sample of a file is valid UTF-8 without
+// NUL bytes. A multi-byte character cut off at the end of the sample is
+// accepted.
+func isText(sample []byte) bool {
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return false
+	}
+
+	for len(sample) > 0 {
+		char, size := utf8.DecodeRune(sample)
+		if char == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(sample)
+		}
+
+		sample = sample[size:]
+	}
+
+	return true
+}
+
+// collectFiles sends the files configured by [Config.CollectFiles] and the
+// kernel command line parameter [ParamCollect] to the device set by
+// [ParamCollectDevice]. If no device is set, nothing is collected.
+func collectFiles(cfg Config, params CmdlineParams) error {
+	patterns := slices.Clone(cfg.CollectFiles)
+
+	if cfg.CollectFilesFromCmdline && params[ParamCollect] != "" {
+		patterns = append(patterns,
+			strings.Split(params[ParamCollect], ";")...)
+	}
+
+	return sendFiles(params[ParamCollectDevice], patterns)
+}
+
+// collectMu serializes sending files to the collect device, as the channels
+// of concurrent senders would collide.
+var collectMu sync.Mutex
+
+// sendFiles sends the files matching the given patterns to the device at the
+// given path. If the path or patterns are empty, nothing is sent.
+func sendFiles(path string, patterns []string) error {
+	if path == "" || len(patterns) == 0 {
+		return nil
+	}
+
+	collectMu.Lock()
+	defer collectMu.Unlock()
+
+	device, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	// Closing the device stops serving the connection as well.
+	defer device.Close()
+
+	// The console must not alter the binary data.
+	if err := setRawTerminal(device); err != nil {
+		return err
+	}
+
+	// The host grants the data it can write, so it is not overrun if its
+	// destination is slow.
+	conn := pipe.NewConn(device)
+	conn.EnableFlowControl(pipe.DefaultWindowSize)
+
+	go func() { _ = conn.Serve(device) }()
+
+	return collect(patterns, conn.Writer())
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type namedBuffer struct {
+	bytes.Buffer
+
+	name string
+}
+
+func (*namedBuffer) Close() error {
+	return nil
+}
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	large := strings.Repeat("x", pipe.MaxPayloadSize+1)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "logs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "report.xml"),
+		[]byte("<report/>"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.txt"),
+		[]byte("ignored"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "logs", "empty.log"),
+		nil, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "logs", "large.log"),
+		[]byte(large), 0o600))
+
+	var output bytes.Buffer
+
+	err := sysinit.CollectFiles([]string{
+		filepath.Join(dir, "*.xml"),
+		filepath.Join(dir, "logs"),
+		filepath.Join(dir, "missing"),
+	}, &output)
+	require.NoError(t, err)
+
+	var received []*namedBuffer
+
+	err = pipe.ReceiveStreams(&output, func(name string) (io.WriteCloser, error) {
+		buf := &namedBuffer{name: name}
+		received = append(received, buf)
+
+		return buf, nil
+	})
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		filepath.Join(dir, "report.xml"):        "<report/>",
+		filepath.Join(dir, "logs", "empty.log"): "",
+		filepath.Join(dir, "logs", "large.log"): large,
+	}
+
+	require.Len(t, received, len(expected))
+
+	for _, buf := range received {
+		assert.Equal(t, expected[buf.name], buf.String(), buf.name)
+	}
+}
+
+func TestCollectFiles_Compression(t *testing.T) {
+	dir := t.TempDir()
+	text := strings.Repeat("log line\n", 100)
+	binary := strings.Repeat("\x00\x01profile", 100)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.log"),
+		[]byte(text), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cpu.pprof"),
+		[]byte(binary), 0o600))
+
+	var output bytes.Buffer
+
+	err := sysinit.CollectFiles([]string{filepath.Join(dir, "*")}, &output)
+	require.NoError(t, err)
+
+	assert.Contains(t, output.String(), text, "text sent uncompressed")
+	assert.NotContains(t, output.String(), binary, "binary sent compressed")
+}
+
+func TestCollectFiles_InvalidPattern(t *testing.T) {
+	err := sysinit.CollectFiles([]string{"[invalid"}, &bytes.Buffer{})
+	assert.ErrorIs(t, err, filepath.ErrBadPattern)
+}
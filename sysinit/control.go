@@ -0,0 +1,355 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aibor/virtrun/internal/hostconn"
+	"github.com/aibor/virtrun/internal/pipe"
+)
+
+// Methods the init serves on the control console provided by the host by
+// kernel command line parameter [ParamControlDevice].
+const (
+	// ControlMethodEnv returns the environment of the init as list of
+	// "KEY=VALUE" strings. It has no parameters.
+	ControlMethodEnv = "env"
+
+	// ControlMethodListFiles returns the entries of a directory as list of
+	// [FileInfo]. The parameters are [ListFilesParams].
+	ControlMethodListFiles = "listFiles"
+
+	// ControlMethodKernelLog returns the tail of the kernel log buffer, like
+	// dmesg(1) does. It has no parameters.
+	ControlMethodKernelLog = "kernelLog"
+
+	// ControlMethodSignal sends a signal to all processes but the init. The
+	// parameters are [SignalParams].
+	ControlMethodSignal = "signal"
+
+	// ControlMethodCollect sends files to the host right away, like it is
+	// done once the main function returned. The parameters are
+	// [CollectParams].
+	ControlMethodCollect = "collect"
+)
+
+// HostMethodPush is the method the init requests from the host on the control
+// console if kernel command line parameter [ParamPush] is present. The host
+// sends files as streams named by their file name. They are written into
+// [DataDir]. The host responds once all files are sent.
+const HostMethodPush = "push"
+
+// HostMethodEcho is the method the init requests from the host on the control
+// console if kernel command line parameter [ParamEcho] is present. The host
+// responds with the parameters. The init sends one request more than the
+// number given by the parameter one after the other, so the host can measure
+// the round trip times as the time between the requests.
+const HostMethodEcho = "echo"
+
+// HostMethodJob is the method the init requests from the host on the control
+// console if kernel command line parameter [ParamJob] is present. The host
+// responds once it has a job for the guest, which may take any time. Before it
+// responds, it sends the binary of the job as stream named [JobBinaryName]
+// and the shared libraries it requires, if any, as streams in [JobLibsDir].
+// They are written into [DataDir]. The result is a [Job].
+const HostMethodJob = "job"
+
+// JobBinaryName is the name of the stream and file the binary of a [Job] is
+// sent as. See [HostMethodJob].
+const JobBinaryName = "job"
+
+// JobLibsDir is the directory the shared libraries of the binary of a [Job]
+// are sent into. See [HostMethodJob].
+const JobLibsDir = "job-libs"
+
+// HostMethodForward is the method the init requests from the host on the
+// control console for each connection accepted on a socket address of kernel
+// command line parameter [ParamForward]. The parameters are [ForwardParams].
+// The host connects to its socket address for the forward and responds once
+// it is connected. Afterwards, the data of both connections is sent as
+// streams with the same name in both directions.
+const HostMethodForward = "forward"
+
+// ForwardStreamPrefix is the prefix of names of the streams of forwarded
+// connections. The rest of the name is a number unique per connection.
+const ForwardStreamPrefix = "forward:"
+
+// FileStreamPrefix is the prefix of names of streams sent on the control
+// console the host writes into files. The rest of the name is the path of the
+// file relative to the host's artifact directory.
+const FileStreamPrefix = "file:"
+
+// maxKernelLogSize is the maximum size of the kernel log returned by
+// [ControlMethodKernelLog], so the response fits into a single frame.
+const maxKernelLogSize = pipe.MaxPayloadSize / 2
+
+var (
+	// ErrUnknownMethod is returned if a request with unknown method is
+	// received on the control console.
+	ErrUnknownMethod = errors.New("unknown method")
+
+	// ErrNoControlDevice is returned if a request to the host is required,
+	// but the host did not provide a control console device.
+	ErrNoControlDevice = errors.New("no control device")
+)
+
+// ListFilesParams are the parameters of [ControlMethodListFiles].
+type ListFilesParams struct {
+	Path string `json:"path"`
+}
+
+// FileInfo describes a directory entry returned by [ControlMethodListFiles].
+type FileInfo struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+	Size int64  `json:"size"`
+}
+
+// SignalParams are the parameters of [ControlMethodSignal].
+type SignalParams struct {
+	Signal syscall.Signal `json:"signal"`
+}
+
+// CollectParams are the parameters of [ControlMethodCollect].
+type CollectParams struct {
+	Patterns []string `json:"patterns"`
+}
+
+// ForwardParams are the parameters of [HostMethodForward].
+type ForwardParams struct {
+	// Index is the index of the socket address in [ParamForward] the
+	// connection was accepted on.
+	Index int `json:"index"`
+
+	// Stream is the name of the streams of the connection.
+	Stream string `json:"stream"`
+}
+
+// controlHandler serves requests received on the control console.
+type controlHandler struct {
+	// collect sends the files matching the given patterns to the host.
+	collect func(patterns []string) error
+}
+
+func (h *controlHandler) handle(
+	method string,
+	params json.RawMessage,
+) (any, error) {
+	switch method {
+	case ControlMethodEnv:
+		return os.Environ(), nil
+	case ControlMethodListFiles:
+		var p ListFilesParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return listFiles(p.Path)
+	case ControlMethodKernelLog:
+		kernelLog, err := readKernelLog()
+		if err != nil {
+			return nil, err
+		}
+
+		return string(kernelLog[max(0, len(kernelLog)-maxKernelLogSize):]), nil
+	case ControlMethodSignal:
+		var p SignalParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return nil, signalAll(p.Signal)
+	case ControlMethodCollect:
+		var p CollectParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return nil, h.collect(p.Patterns)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+	}
+}
+
+func listFiles(path string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	files := make([]FileInfo, 0, len(entries))
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		files = append(files, FileInfo{
+			Name: entry.Name(),
+			Mode: info.Mode().String(),
+			Size: info.Size(),
+		})
+	}
+
+	return files, nil
+}
+
+// openDataFile creates the file with the given name in [DataDir]. Existing
+// files are overwritten.
+func openDataFile(name string) (io.WriteCloser, error) {
+	// Cleaning the name as absolute path ensures it stays within the
+	// directory.
+	path := filepath.Join(DataDir, filepath.Clean("/"+name))
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return os.Create(path) //nolint:wrapcheck
+}
+
+// openControlStream returns the destination of streams sent by the host.
+// Streams of forwarded connections are written to the connection, all others
+// are written to files in [DataDir].
+func openControlStream(name string) (io.WriteCloser, error) {
+	if strings.HasPrefix(name, ForwardStreamPrefix) {
+		return forwards.Open(name) //nolint:wrapcheck
+	}
+
+	return openDataFile(name)
+}
+
+// serveControl serves requests on the control console set by
+// [ParamControlDevice] in the background. Files sent by the host are written
+// to [DataDir]. If no device is set, nothing is served and nil is returned.
+func serveControl(params CmdlineParams) (*pipe.Conn, error) {
+	path := params[ParamControlDevice]
+	if path == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	device, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	// The console must not alter the binary data.
+	if err := setRawTerminal(device); err != nil {
+		_ = device.Close()
+		return nil, err
+	}
+
+	handler := controlHandler{
+		collect: func(patterns []string) error {
+			return sendFiles(params[ParamCollectDevice], patterns)
+		},
+	}
+
+	conn := pipe.NewConn(device)
+	conn.EnableFlowControl(pipe.DefaultWindowSize)
+	conn.Handler = handler.handle
+	conn.Open = openControlStream
+
+	hostconn.Set(conn)
+
+	// The device is never closed, as requests are served until the system
+	// is shut down.
+	go func() {
+		if err := conn.Serve(device); err != nil {
+			PrintWarning(fmt.Errorf("serve control: %w", err))
+		}
+	}()
+
+	return conn, nil
+}
+
+// pushFiles requests the host to send files, if kernel command line parameter
+// [ParamPush] is present. It returns once all files are received.
+func pushFiles(conn *pipe.Conn, params CmdlineParams) error {
+	if !params.Has(ParamPush) {
+		return nil
+	}
+
+	if conn == nil {
+		return ErrNoControlDevice
+	}
+
+	err := conn.Call(context.Background(), HostMethodPush, nil, nil)
+	if err != nil {
+		return fmt.Errorf("request files: %w", err)
+	}
+
+	return nil
+}
+
+// echoHost sends requests by [HostMethodEcho] to the host one after the other,
+// as many as set by kernel command line parameter [ParamEcho] plus one. If the
+// parameter is not present, nothing is sent.
+func echoHost(conn *pipe.Conn, params CmdlineParams) error {
+	value := params[ParamEcho]
+	if value == "" {
+		return nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("parse count: %w", err)
+	}
+
+	if conn == nil {
+		return ErrNoControlDevice
+	}
+
+	for seq := range count + 1 {
+		err := conn.Call(context.Background(), HostMethodEcho, seq, nil)
+		if err != nil {
+			return fmt.Errorf("echo: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// sendHeartbeats sends heartbeats to the host in the background with the
+// interval set by kernel command line parameter [ParamHeartbeat]. If the
+// parameter is not present, no heartbeats are sent.
+func sendHeartbeats(conn *pipe.Conn, params CmdlineParams) error {
+	value := params[ParamHeartbeat]
+	if value == "" {
+		return nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("parse interval: %w", err)
+	}
+
+	if conn == nil {
+		return ErrNoControlDevice
+	}
+
+	// Heartbeats are sent until the system is shut down.
+	go func() {
+		err := conn.SendHeartbeats(context.Background(), interval)
+		if err != nil {
+			PrintWarning(err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlHandler(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"),
+		[]byte("data"), 0o600))
+
+	var collected []string
+
+	handler := controlHandler{
+		collect: func(patterns []string) error {
+			collected = patterns
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		params      any
+		expected    any
+		expectedErr error
+	}{
+		{
+			name:     "env",
+			method:   ControlMethodEnv,
+			expected: os.Environ(),
+		},
+		{
+			name:   "list files",
+			method: ControlMethodListFiles,
+			params: ListFilesParams{Path: dir},
+			expected: []FileInfo{
+				{Name: "file", Mode: "-rw-------", Size: 4},
+			},
+		},
+		{
+			name:        "list missing files",
+			method:      ControlMethodListFiles,
+			params:      ListFilesParams{Path: filepath.Join(dir, "missing")},
+			expectedErr: os.ErrNotExist,
+		},
+		{
+			name:   "collect",
+			method: ControlMethodCollect,
+			params: CollectParams{Patterns: []string{"/tmp/*"}},
+		},
+		{
+			name:        "unknown",
+			method:      "unknown",
+			expectedErr: ErrUnknownMethod,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := json.Marshal(tt.params)
+			require.NoError(t, err)
+
+			actual, err := handler.handle(tt.method, params)
+			require.ErrorIs(t, err, tt.expectedErr)
+
+			if tt.expectedErr == nil {
+				assert.Equal(t, tt.expected, actual)
+			}
+		})
+	}
+
+	assert.Equal(t, []string{"/tmp/*"}, collected)
+}
+
+func TestSendHeartbeats(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      CmdlineParams
+		expectedErr string
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:        "invalid interval",
+			params:      CmdlineParams{ParamHeartbeat: "often"},
+			expectedErr: "parse interval",
+		},
+		{
+			name:        "no control device",
+			params:      CmdlineParams{ParamHeartbeat: "1s"},
+			expectedErr: ErrNoControlDevice.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sendHeartbeats(nil, tt.params)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestEchoHost(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      CmdlineParams
+		expectedErr string
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:        "invalid count",
+			params:      CmdlineParams{ParamEcho: "many"},
+			expectedErr: "parse count",
+		},
+		{
+			name:        "no control device",
+			params:      CmdlineParams{ParamEcho: "10"},
+			expectedErr: ErrNoControlDevice.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := echoHost(nil, tt.params)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"fmt"
+	"maps"
+	"os"
+)
+
+// RunOption changes the [Config] [DefaultRun] sets up the system with.
+type RunOption func(cfg *Config)
+
+// WithEnv adds the given environment variables. Environment variables given
+// by the host on the kernel command line take precedence.
+func WithEnv(env EnvVars) RunOption {
+	return func(cfg *Config) {
+		maps.Copy(cfg.Env, env)
+	}
+}
+
+// WithMountPoint adds a file system to mount at the given path.
+func WithMountPoint(path string, opts MountOptions) RunOption {
+	return func(cfg *Config) {
+		cfg.MountPoints[path] = opts
+	}
+}
+
+// WithSysctl sets the given kernel parameter, like "vm.overcommit_memory".
+func WithSysctl(key, value string) RunOption {
+	return func(cfg *Config) {
+		cfg.Sysctls[key] = value
+	}
+}
+
+// WithConfig calls the given function with the [Config], so any of its fields
+// can be changed.
+func WithConfig(fn func(cfg *Config)) RunOption {
+	return fn
+}
+
+// DefaultRun sets up the system like virtrun's own init does in wrapped mode,
+// runs the given function and shuts down the system. See [Main] for the
+// steps. The system is set up with [VirtrunConfig] changed by the given
+// options. Before the function runs, the directory of the GOCOVERDIR
+// environment variable is created, so binaries built with coverage
+// instrumentation can write their coverage data.
+//
+// Use it for binaries run in standalone mode, so they behave like virtrun's
+// own init as features are added.
+func DefaultRun(fn func() (int, error), opts ...RunOption) {
+	cfg := VirtrunConfig()
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	Main(cfg, func() (int, error) {
+		if dir := os.Getenv("GOCOVERDIR"); dir != "" {
+			err := os.MkdirAll(dir, 0o755)
+			if err != nil {
+				return -1, fmt.Errorf("create coverage dir: %w", err)
+			}
+		}
+
+		return fn()
+	})
+}
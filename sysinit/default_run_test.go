@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit_test
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunOptions(t *testing.T) {
+	cfg := sysinit.VirtrunConfig()
+
+	opts := []sysinit.RunOption{
+		sysinit.WithEnv(sysinit.EnvVars{"FOO": "bar", "PATH": "/bin"}),
+		sysinit.WithMountPoint("/mnt", sysinit.MountOptions{
+			FSType: sysinit.FSTypeTmp,
+		}),
+		sysinit.WithSysctl("vm.overcommit_memory", "1"),
+		sysinit.WithConfig(func(cfg *sysinit.Config) {
+			cfg.ConfigureLoopback = false
+		}),
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	assert.Equal(t, sysinit.EnvVars{"FOO": "bar", "PATH": "/bin"}, cfg.Env)
+	assert.Equal(t, sysinit.FSTypeTmp, cfg.MountPoints["/mnt"].FSType)
+	assert.Contains(t, cfg.MountPoints, "/proc")
+	assert.Equal(t, "1", cfg.Sysctls["vm.overcommit_memory"])
+	assert.False(t, cfg.ConfigureLoopback)
+	assert.Equal(t, sysinit.ModulesDir, cfg.ModulesDir)
+}
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"syscall"
+)
+
+// ExecOptions defines how a binary is run by [Exec].
+type ExecOptions struct {
+	// PTY runs the binary with a newly allocated pseudo-terminal as its
+	// controlling terminal and standard streams. Everything written to the
+	// terminal is copied to stdout. Use it for programs that behave
+	// differently depending on if their output is a terminal or not.
+	PTY bool
+
+	// OOMScoreAdj is the adjustment of the score used by the OOM killer to
+	// choose the process to kill. Valid values range from -1000 to 1000. With
+	// -1000 the process is never killed. With 0, the value is inherited from
+	// the calling process.
+	OOMScoreAdj int
+
+	// UserNamespace runs the binary in a new user namespace, if set. This
+	// allows to test tools that require ID mappings written by a privileged
+	// parent process, like rootless container runtimes.
+	UserNamespace *UserNamespace
+
+	// Root is the directory the binary is run chrooted into, if set. The path
+	// of the binary is resolved within it. Use [BindMountInto] to make
+	// special file systems available in it.
+	Root string
+
+	// Wrapper is a command the binary is run under, like a tracer or a
+	// debugger. The path of the binary and its arguments are appended to it.
+	// The path of the wrapper is resolved within [ExecOptions.Root], if set.
+	Wrapper []string
+}
+
+// Exec runs the binary at the given path with the given arguments and returns
+// its exit code.
+//
+// The standard streams of the binary are connected to the ones of the calling
+// process, unless [ExecOptions.PTY] is set. A non-zero exit code of the binary
+// is not considered an error. An error is returned only if the binary could
+// not be run.
+func Exec(path string, args []string, opts ExecOptions) (int, error) {
+	if len(opts.Wrapper) > 0 {
+		args = slices.Concat(opts.Wrapper[1:], []string{path}, args)
+		path = opts.Wrapper[0]
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+
+	if opts.UserNamespace != nil {
+		setUserNamespace(cmd.SysProcAttr, *opts.UserNamespace)
+	}
+
+	if opts.Root != "" {
+		cmd.SysProcAttr.Chroot = opts.Root
+		cmd.Dir = "/"
+	}
+
+	// The OOM score adjustment is inherited by child processes. Set it for the
+	// calling process before the child is started and restore it once the
+	// child is done.
+	if opts.OOMScoreAdj != 0 {
+		restore, err := setOOMScoreAdj(opts.OOMScoreAdj)
+		if err != nil {
+			return -1, err
+		}
+
+		defer restore()
+	}
+
+	if opts.PTY {
+		return runWithPTY(cmd)
+	}
+
+	return exitCodeFrom(cmd.Run())
+}
+
+// setOOMScoreAdj sets the OOM score adjustment of the calling process and
+// returns a function that restores the previous value.
+func setOOMScoreAdj(value int) (func(), error) {
+	const path = "/proc/self/oom_score_adj"
+
+	previous, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read oom_score_adj: %w", err)
+	}
+
+	err = os.WriteFile(path, []byte(strconv.Itoa(value)), 0)
+	if err != nil {
+		return nil, fmt.Errorf("write oom_score_adj: %w", err)
+	}
+
+	restore := func() {
+		_ = os.WriteFile(path, previous, 0)
+	}
+
+	return restore, nil
+}
+
+// runWithPTY runs the given command with a new pseudo-terminal as controlling
+// terminal.
+func runWithPTY(cmd *exec.Cmd) (int, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return -1, err
+	}
+	defer master.Close()
+
+	stdin := cmd.Stdin
+	stdout := cmd.Stdout
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	setControllingTerminal(cmd.SysProcAttr)
+
+	err = cmd.Start()
+
+	// The slave end is used by the child only. Close it, so reading from
+	// the master end stops once the child terminated.
+	_ = slave.Close()
+
+	if err != nil {
+		return -1, fmt.Errorf("start: %w", err)
+	}
+
+	outputDone := make(chan struct{})
+
+	go func() {
+		// Reading from the master end fails with EIO once all slave file
+		// descriptors are closed, so the error is expected here.
+		_, _ = io.Copy(stdout, master)
+
+		close(outputDone)
+	}()
+
+	// Input is copied as long as the system runs. There is no way to
+	// interrupt a blocking read from stdin, so do not wait for it.
+	go func() {
+		_, _ = io.Copy(master, stdin)
+	}()
+
+	err = cmd.Wait()
+
+	<-outputDone
+
+	return exitCodeFrom(err)
+}
+
+// exitCodeFrom returns the exit code for the error returned by
+// [exec.Cmd.Run] or [exec.Cmd.Wait].
+func exitCodeFrom(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+
+	return -1, err //nolint:wrapcheck
+}
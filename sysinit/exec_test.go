@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit_test
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExec(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		opts     sysinit.ExecOptions
+		expected int
+	}{
+		{
+			name:     "plain",
+			args:     []string{"-c", "exit 3"},
+			expected: 3,
+		},
+		{
+			// The wrapper exits with the number of its positional
+			// arguments, which are the path of the binary and its args.
+			name: "wrapper",
+			args: []string{"-c", "exit 3"},
+			opts: sysinit.ExecOptions{
+				Wrapper: []string{"/bin/sh", "-c", "exit $#", "sh"},
+			},
+			expected: 3,
+		},
+		{
+			name: "wrapper passes path and args",
+			args: []string{"-c", "exit 3"},
+			opts: sysinit.ExecOptions{
+				Wrapper: []string{"/bin/sh", "-c", `exec "$@"`, "sh"},
+			},
+			expected: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exitCode, err := sysinit.Exec("/bin/sh", tt.args, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, exitCode)
+		})
+	}
+}
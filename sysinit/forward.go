@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aibor/virtrun/internal/forward"
+	"github.com/aibor/virtrun/internal/pipe"
+)
+
+// forwards holds the connections forwarded to the host.
+var forwards forward.Bridges
+
+// forwardID is the number of the last forwarded connection.
+var forwardID atomic.Uint64
+
+// startForwards listens on the socket addresses set by kernel command line
+// parameter [ParamForward] and forwards accepted connections to the host in
+// the background. If the parameter is not present, nothing is forwarded.
+func startForwards(conn *pipe.Conn, params CmdlineParams) error {
+	value := params[ParamForward]
+	if value == "" {
+		return nil
+	}
+
+	if conn == nil {
+		return ErrNoControlDevice
+	}
+
+	for idx, s := range strings.Split(value, ";") {
+		address, err := forward.ParseAddress(s)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		listener, err := listen(address)
+		if err != nil {
+			return fmt.Errorf("listen %s: %w", address, err)
+		}
+
+		// Connections are accepted until the system is shut down.
+		go acceptForwards(conn, listener, idx)
+	}
+
+	return nil
+}
+
+// listen listens on the given address. Parent directories of unix sockets are
+// created.
+func listen(address forward.Address) (net.Listener, error) {
+	if address.Network() == "unix" {
+		err := os.MkdirAll(filepath.Dir(address.Address()), 0o755)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
+
+	return net.Listen(address.Network(), address.Address()) //nolint:wrapcheck
+}
+
+// acceptForwards forwards each connection accepted by the given listener to
+// the host. The index is the index of its address in [ParamForward].
+func acceptForwards(conn *pipe.Conn, listener net.Listener, idx int) {
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			PrintWarning(fmt.Errorf("accept: %w", err))
+			return
+		}
+
+		go forwardConn(conn, client, idx)
+	}
+}
+
+// forwardConn requests the host to connect to its address for the forward
+// with the given index and forwards the given connection to it.
+func forwardConn(conn *pipe.Conn, client net.Conn, idx int) {
+	name := ForwardStreamPrefix + strconv.FormatUint(forwardID.Add(1), 10)
+
+	// The connection must be known before the request is sent, as the host
+	// may send data right after it is connected.
+	forwards.Add(name, client)
+
+	params := ForwardParams{Index: idx, Stream: name}
+
+	err := conn.Call(context.Background(), HostMethodForward, params, nil)
+	if err != nil {
+		forwards.Remove(name)
+		PrintWarning(fmt.Errorf("forward: %w", err))
+
+		return
+	}
+
+	err = forwards.Send(conn.Writer(), name)
+	if err != nil {
+		PrintWarning(fmt.Errorf("forward: %w", err))
+	}
+}
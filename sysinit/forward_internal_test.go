@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/forward"
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartForwards(t *testing.T) {
+	conn := pipe.NewConn(io.Discard)
+
+	tests := []struct {
+		name        string
+		conn        *pipe.Conn
+		params      CmdlineParams
+		expectedErr error
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:        "no control device",
+			params:      CmdlineParams{ParamForward: "tcp:127.0.0.1:0"},
+			expectedErr: ErrNoControlDevice,
+		},
+		{
+			name:        "invalid address",
+			conn:        conn,
+			params:      CmdlineParams{ParamForward: "127.0.0.1:0"},
+			expectedErr: forward.ErrInvalidAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := startForwards(tt.conn, tt.params)
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestListen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "db.sock")
+
+	listener, err := listen(forward.Address("unix:" + path))
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+
+	assert.Equal(t, path, listener.Addr().String())
+}
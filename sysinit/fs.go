@@ -6,6 +6,7 @@ package sysinit
 
 import (
 	"cmp"
+	"errors"
 	"fmt"
 	"io/fs"
 	"iter"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 )
 
 // FSType is a file system type.
@@ -20,6 +22,7 @@ type FSType string
 
 // Special file system types.
 const (
+	FSTypeBinfmt   FSType = "binfmt_misc"
 	FSTypeBpf      FSType = "bpf"
 	FSTypeCgroup2  FSType = "cgroup2"
 	FSTypeConfig   FSType = "configfs"
@@ -29,16 +32,21 @@ const (
 	FSTypeFuseCtl  FSType = "fusectl"
 	FSTypeHugeTlb  FSType = "hugetlbfs"
 	FSTypeMqueue   FSType = "mqueue"
+	FSTypeOverlay  FSType = "overlay"
 	FSTypeProc     FSType = "proc"
 	FSTypePstore   FSType = "pstore"
 	FSTypeSecurity FSType = "securityfs"
 	FSTypeSys      FSType = "sysfs"
 	FSTypeTmp      FSType = "tmpfs"
 	FSTypeTracing  FSType = "tracefs"
+	FSTypeVirtiofs FSType = "virtiofs"
 
 	defaultDirMode = 0o755
 )
 
+// ErrMountPointUnknown is returned if a mount point is not known.
+var ErrMountPointUnknown = errors.New("mount point unknown")
+
 // MountOptions contains parameters for a mount point.
 type MountOptions struct {
 	// FSType is the files system type. It must be set to an available [FSType].
@@ -61,6 +69,63 @@ type MountOptions struct {
 	MayFail bool
 }
 
+// ParseMountOptions parses the given comma separated list of mount options as
+// used by mount(8), like "nosuid,size=1G,mode=1777".
+//
+// Options that are known [MountFlags] are returned as flags. All other
+// options are returned as comma separated data string. They are passed to
+// the file system and depend on the [FSType] used.
+func ParseMountOptions(options string) (MountFlags, string) {
+	knownFlags := map[string]MountFlags{
+		"ro":       MountFlagReadOnly,
+		"nosuid":   MountFlagNoSuid,
+		"nodev":    MountFlagNoDev,
+		"noexec":   MountFlagNoExec,
+		"noatime":  MountFlagNoAtime,
+		"relatime": MountFlagRelAtime,
+		"sync":     MountFlagSync,
+	}
+
+	var (
+		flags MountFlags
+		data  []string
+	)
+
+	for _, option := range strings.Split(options, ",") {
+		if option == "" {
+			continue
+		}
+
+		if flag, exists := knownFlags[option]; exists {
+			flags |= flag
+			continue
+		}
+
+		data = append(data, option)
+	}
+
+	return flags, strings.Join(data, ",")
+}
+
+// WithOptions returns a copy of the [MountOptions] with the given comma
+// separated list of mount options added. See [ParseMountOptions] for the
+// format.
+func (o MountOptions) WithOptions(options string) MountOptions {
+	flags, data := ParseMountOptions(options)
+
+	o.Flags |= flags
+
+	if data != "" {
+		if o.Data != "" {
+			o.Data += ","
+		}
+
+		o.Data += data
+	}
+
+	return o
+}
+
 // Mount mounts the system file system of [FSType] at the given path.
 //
 // If path does not exist, it is created. An error is returned if this or the
@@ -77,6 +142,40 @@ func Mount(path string, opts MountOptions) error {
 // MountPoints is a collection of MountPoints.
 type MountPoints map[string]MountOptions
 
+// AddOptions adds the given comma separated list of mount options to the mount
+// point with the given path. See [ParseMountOptions] for the format.
+//
+// It returns [ErrMountPointUnknown] if there is no mount point for the path.
+func (m MountPoints) AddOptions(path, options string) error {
+	opts, exists := m[path]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrMountPointUnknown, path)
+	}
+
+	m[path] = opts.WithOptions(options)
+
+	return nil
+}
+
+// AddOptionsList adds mount options from the given list to the respective
+// mount points. The list has the form "PATH:OPTIONS;PATH:OPTIONS". See
+// [ParseMountOptions] for the format of the options.
+func (m MountPoints) AddOptionsList(list string) error {
+	for _, entry := range strings.Split(list, ";") {
+		if entry == "" {
+			continue
+		}
+
+		path, options, _ := strings.Cut(entry, ":")
+
+		if err := m.AddOptions(path, options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // MountAll mounts the given set of system file systems.
 //
 // The mounts are executed in lexicographic order of the paths.
@@ -94,6 +193,107 @@ func MountAll(mountPoints MountPoints) error {
 	return nil
 }
 
+// MakeReadOnly makes the given files and directories read-only by bind
+// mounting them onto themselves read-only. Paths are processed in the given
+// order.
+func MakeReadOnly(paths ...string) error {
+	for _, path := range paths {
+		if err := bindReadOnly(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BindMountInto bind mounts the given absolute paths recursively to the same
+// path below root, like "/proc" to "ROOT/proc", so they are available for
+// binaries run chrooted into root. Missing mount points are created. Paths that
+// do not exist are skipped. Besides directories, single files can be bind
+// mounted, like the main binary.
+func BindMountInto(root string, paths ...string) error {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		target := filepath.Join(root, path)
+
+		if err := createMountPoint(target, info); err != nil {
+			return fmt.Errorf("create mount point %s: %w", target, err)
+		}
+
+		if err := bindMount(path, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createMountPoint creates the directory or, if the given source is no
+// directory, the empty file at the given path to mount the source onto.
+func createMountPoint(path string, source os.FileInfo) error {
+	if source == nil || source.IsDir() {
+		return os.MkdirAll(path, defaultDirMode) //nolint:wrapcheck
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), defaultDirMode)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, source.Mode().Perm())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return file.Close() //nolint:wrapcheck
+}
+
+// MountOverlayRoot mounts the virtiofs file system with the given tag
+// read-only at "DIR/lower" and an overlay with a writable tmpfs on top of it
+// at root. The tmpfs is mounted at "DIR/rw", so all changes are lost on
+// shutdown. Use [BindMountInto] to make the special file systems available in
+// root.
+func MountOverlayRoot(tag, root, dir string) error {
+	lower := filepath.Join(dir, "lower")
+
+	err := Mount(lower, MountOptions{
+		FSType: FSTypeVirtiofs,
+		Source: tag,
+		Flags:  MountFlagReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+
+	rw := filepath.Join(dir, "rw")
+
+	err = Mount(rw, MountOptions{FSType: FSTypeTmp})
+	if err != nil {
+		return err
+	}
+
+	// Upper and work directory of an overlay must be on the same file
+	// system.
+	upper := filepath.Join(rw, "upper")
+	work := filepath.Join(rw, "work")
+
+	for _, path := range []string{upper, work} {
+		if err := os.Mkdir(path, defaultDirMode); err != nil {
+			return fmt.Errorf("mkdir %s: %w", path, err)
+		}
+	}
+
+	return Mount(root, MountOptions{
+		FSType: FSTypeOverlay,
+		Data: fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s",
+			lower, upper, work),
+	})
+}
+
 // Symlinks is a collection of symbolic links. Keys are symbolic links to
 // create with the value being the target to link to.
 type Symlinks map[string]string
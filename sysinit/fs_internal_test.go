@@ -5,9 +5,12 @@
 package sysinit
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSortedByKeys(t *testing.T) {
@@ -69,3 +72,94 @@ func TestSortedByKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMountOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       string
+		expectedFlags MountFlags
+		expectedData  string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:         "data only",
+			options:      "size=1G,mode=1777",
+			expectedData: "size=1G,mode=1777",
+		},
+		{
+			name:          "flags only",
+			options:       "nosuid,nodev",
+			expectedFlags: MountFlagNoSuid | MountFlagNoDev,
+		},
+		{
+			name:          "mixed",
+			options:       "nosuid,size=2G,,noexec",
+			expectedFlags: MountFlagNoSuid | MountFlagNoExec,
+			expectedData:  "size=2G",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, data := ParseMountOptions(tt.options)
+			assert.Equal(t, tt.expectedFlags, flags, "flags")
+			assert.Equal(t, tt.expectedData, data, "data")
+		})
+	}
+}
+
+func TestMountPoints_AddOptionsList(t *testing.T) {
+	mountPoints := MountPoints{
+		"/tmp": {FSType: FSTypeTmp, Data: "mode=1777"},
+		"/run": {FSType: FSTypeTmp},
+	}
+
+	err := mountPoints.AddOptionsList("/tmp:size=2G,nosuid;/run:noexec")
+	require.NoError(t, err)
+
+	expected := MountPoints{
+		"/tmp": {
+			FSType: FSTypeTmp,
+			Flags:  MountFlagNoSuid,
+			Data:   "mode=1777,size=2G",
+		},
+		"/run": {
+			FSType: FSTypeTmp,
+			Flags:  MountFlagNoExec,
+		},
+	}
+
+	assert.Equal(t, expected, mountPoints)
+
+	err = mountPoints.AddOptionsList("/unknown:size=1G")
+	require.ErrorIs(t, err, ErrMountPointUnknown)
+}
+
+func TestCreateMountPoint(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "main")
+	require.NoError(t, os.WriteFile(file, []byte("binary"), 0o755))
+
+	fileInfo, err := os.Stat(file)
+	require.NoError(t, err)
+
+	dirInfo, err := os.Stat(dir)
+	require.NoError(t, err)
+
+	root := t.TempDir()
+
+	require.NoError(t, createMountPoint(filepath.Join(root, "proc"), dirInfo))
+	require.NoError(t, createMountPoint(filepath.Join(root, "a/main"), fileInfo))
+
+	info, err := os.Stat(filepath.Join(root, "proc"))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	info, err = os.Stat(filepath.Join(root, "a/main"))
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	assert.Zero(t, info.Size())
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// InitConfigFile is the path the host adds an [InitConfig] file to.
+const InitConfigFile = "/etc/virtrun/init.json"
+
+// ErrEmptyStep is returned if a step of an [InitConfig] has no command.
+var ErrEmptyStep = errors.New("empty step")
+
+// InitConfig is a small configuration for customizing an init without
+// writing a custom one. It is read from a JSON file, like:
+//
+//	{
+//	  "env": {"GODEBUG": "madvdontneed=1"},
+//	  "args": ["-test.short"],
+//	  "steps": ["ip link set dev lo mtu 1500", "mkdir -p /tmp/cache"],
+//	  "units": [
+//	    {"name": "data", "type": "mount", "target": "/srv", "fsType": "tmpfs"},
+//	    {"name": "db", "type": "service", "command": "redis-server",
+//	     "after": ["data"]},
+//	    {"name": "main", "type": "main", "after": ["db"]}
+//	  ]
+//	}
+type InitConfig struct {
+	// Env is a set of environment variables that are added to the init's
+	// environment.
+	Env EnvVars `json:"env"`
+
+	// Args are additional arguments for the main binary. They precede the
+	// arguments given by the host.
+	Args []string `json:"args"`
+
+	// Steps are commands that are run in order before the main binary. Each
+	// step is split into words at white space, except for white space
+	// enclosed in double quotes. The first word is the program to run. See
+	// [InitConfig.RunSteps].
+	Steps []string `json:"steps"`
+
+	// Units are mounts, tasks and services that are run in the order of
+	// their dependencies after the Steps. See [InitConfig.StartUnits].
+	Units []Unit `json:"units"`
+}
+
+// ReadInitConfig reads the [InitConfig] from the JSON file at the given path.
+// If the file does not exist, an empty config is returned. Unknown fields are
+// an error, so typos do not go unnoticed.
+func ReadInitConfig(path string) (InitConfig, error) {
+	var cfg InitConfig
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, err //nolint:wrapcheck
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// RunSteps runs the Steps in order with the init's stdout and stderr. It stops
+// at the first step that fails.
+func (c InitConfig) RunSteps() error {
+	for _, step := range c.Steps {
+		words := splitStep(step)
+		if len(words) == 0 {
+			return ErrEmptyStep
+		}
+
+		cmd := exec.Command(words[0], words[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("step %q: %w", step, err)
+		}
+	}
+
+	return nil
+}
+
+// splitStep splits the given step into words like the kernel command line is
+// split, see [ParseCmdline]. The double quotes are removed.
+func splitStep(step string) []string {
+	words := splitCmdline(step)
+
+	for idx, word := range words {
+		words[idx] = strings.ReplaceAll(word, `"`, "")
+	}
+
+	return words
+}
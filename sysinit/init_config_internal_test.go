@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadInitConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    InitConfig
+		assertErr   require.ErrorAssertionFunc
+		missingFile bool
+	}{
+		{
+			name:        "missing",
+			missingFile: true,
+			assertErr:   require.NoError,
+		},
+		{
+			name: "all",
+			content: `{"env": {"FOO": "bar"}, "args": ["-test.short"], ` +
+				`"steps": ["mkdir -p /tmp/cache"], "units": [{"name": "db", ` +
+				`"type": "service", "command": "redis-server"}]}`,
+			expected: InitConfig{
+				Env:   EnvVars{"FOO": "bar"},
+				Args:  []string{"-test.short"},
+				Steps: []string{"mkdir -p /tmp/cache"},
+				Units: []Unit{
+					{Name: "db", Type: UnitTypeService, Command: "redis-server"},
+				},
+			},
+			assertErr: require.NoError,
+		},
+		{
+			name:      "unknown field",
+			content:   `{"environment": {"FOO": "bar"}}`,
+			assertErr: require.Error,
+		},
+		{
+			name:      "malformed",
+			content:   `{"env": `,
+			assertErr: require.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "init.json")
+
+			if !tt.missingFile {
+				err := os.WriteFile(path, []byte(tt.content), 0o600)
+				require.NoError(t, err)
+			}
+
+			actual, err := ReadInitConfig(path)
+			tt.assertErr(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestInitConfig_RunSteps(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg := InitConfig{
+		Steps: []string{
+			`mkdir "` + filepath.Join(dir, "with space") + `"`,
+		},
+	}
+	require.NoError(t, cfg.RunSteps())
+	assert.DirExists(t, filepath.Join(dir, "with space"))
+
+	cfg = InitConfig{Steps: []string{"false", "true"}}
+	require.ErrorContains(t, cfg.RunSteps(), `step "false"`)
+
+	cfg = InitConfig{Steps: []string{" "}}
+	require.ErrorIs(t, cfg.RunSteps(), ErrEmptyStep)
+}
+
+func TestSplitStep(t *testing.T) {
+	expected := []string{"sh", "-c", "echo foo bar"}
+	assert.Equal(t, expected, splitStep(`sh -c "echo foo bar"`))
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aibor/virtrun/internal/pipe"
+)
+
+// Job is a binary the host runs in a guest that is set up already, instead of
+// the main binary. See [HostMethodJob].
+type Job struct {
+	// Binary is the path of the binary of the job in the guest. It is set by
+	// the init once the binary is received.
+	Binary string `json:"-"`
+
+	// Args are the arguments the binary is run with.
+	Args []string `json:"args,omitempty"`
+
+	// Env are additional environment variables in the form "KEY=VALUE".
+	Env []string `json:"env,omitempty"`
+
+	// Interpreter is the path of the ELF interpreter of the binary. It is
+	// empty if the binary is statically linked.
+	Interpreter string `json:"interpreter,omitempty"`
+
+	// Links are the symbolic links the dynamic linker expects in
+	// [JobLibsDir] by their name, along with the name of the library they
+	// point to.
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// currentJob is the job received from the host, if any.
+var currentJob atomic.Pointer[Job]
+
+// CurrentJob returns the [Job] received from the host, if kernel command line
+// parameter [ParamJob] is present. Its environment variables are set already.
+// It returns false if the init does not run jobs.
+func CurrentJob() (Job, bool) {
+	job := currentJob.Load()
+	if job == nil {
+		return Job{}, false
+	}
+
+	return *job, true
+}
+
+// receiveJob requests a [Job] from the host, if kernel command line parameter
+// [ParamJob] is present. It returns once the job and its binary are received.
+// The binary is made executable in the given directory and the environment
+// variables of the job are set. If the binary is dynamically linked, its
+// shared libraries are set up as well.
+func receiveJob(conn *pipe.Conn, params CmdlineParams, dir string) error {
+	if !params.Has(ParamJob) {
+		return nil
+	}
+
+	if conn == nil {
+		return ErrNoControlDevice
+	}
+
+	var job Job
+
+	err := conn.Call(context.Background(), HostMethodJob, nil, &job)
+	if err != nil {
+		return fmt.Errorf("request job: %w", err)
+	}
+
+	job.Binary = filepath.Join(dir, JobBinaryName)
+
+	err = os.Chmod(job.Binary, 0o755)
+	if err != nil {
+		return fmt.Errorf("job binary: %w", err)
+	}
+
+	for _, envVar := range job.Env {
+		key, value, _ := strings.Cut(envVar, "=")
+		if err := setenv(key, value); err != nil {
+			return err
+		}
+	}
+
+	if job.Interpreter != "" {
+		err = setupJobLibs(job, filepath.Join(dir, JobLibsDir))
+		if err != nil {
+			return fmt.Errorf("job libs: %w", err)
+		}
+	}
+
+	currentJob.Store(&job)
+
+	return nil
+}
+
+// setupJobLibs makes the shared libraries of the given [Job] in the given
+// directory available to the dynamic linker. The interpreter of the job is
+// linked to its copy in the directory, unless the guest has one at its path
+// already.
+func setupJobLibs(job Job, libsDir string) error {
+	for name, target := range job.Links {
+		err := os.Symlink(target, filepath.Join(libsDir, filepath.Base(name)))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	_, err := os.Lstat(job.Interpreter)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = os.MkdirAll(filepath.Dir(job.Interpreter), 0o755)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		target := filepath.Join(libsDir, filepath.Base(job.Interpreter))
+
+		err = os.Symlink(target, job.Interpreter)
+	}
+
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	libraryPath := libsDir
+	if current := os.Getenv("LD_LIBRARY_PATH"); current != "" {
+		libraryPath += ":" + current
+	}
+
+	return setenv("LD_LIBRARY_PATH", libraryPath)
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aibor/virtrun/internal/pipe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiveJob(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		require.NoError(t, receiveJob(nil, CmdlineParams{}, t.TempDir()))
+
+		_, exists := CurrentJob()
+		assert.False(t, exists)
+	})
+
+	t.Run("no control device", func(t *testing.T) {
+		err := receiveJob(nil, CmdlineParams{ParamJob: ""}, t.TempDir())
+		require.ErrorIs(t, err, ErrNoControlDevice)
+	})
+
+	t.Run("job", func(t *testing.T) {
+		t.Setenv("VIRTRUN_TEST_JOB", "")
+		t.Cleanup(func() { currentJob.Store(nil) })
+
+		dir := t.TempDir()
+		guest := serveJob(t, dir, Job{
+			Args: []string{"-test.v"},
+			Env:  []string{"VIRTRUN_TEST_JOB=yes"},
+		}, nil)
+
+		err := receiveJob(guest, CmdlineParams{ParamJob: ""}, dir)
+		require.NoError(t, err)
+
+		job, exists := CurrentJob()
+		require.True(t, exists)
+		assert.Equal(t, filepath.Join(dir, JobBinaryName), job.Binary)
+		assert.Equal(t, []string{"-test.v"}, job.Args)
+		assert.Equal(t, "yes", os.Getenv("VIRTRUN_TEST_JOB"))
+
+		info, err := os.Stat(job.Binary)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	})
+
+	t.Run("dynamic job", func(t *testing.T) {
+		t.Setenv("LD_LIBRARY_PATH", "/lib")
+		t.Cleanup(func() { currentJob.Store(nil) })
+
+		dir := t.TempDir()
+		libsDir := filepath.Join(dir, JobLibsDir)
+		interpreter := filepath.Join(t.TempDir(), "lib64", "ld.so.1")
+
+		guest := serveJob(t, dir, Job{
+			Interpreter: interpreter,
+			Links:       map[string]string{"libfoo.so.1": "libfoo.so.1.2"},
+		}, []string{"ld.so.1", "libfoo.so.1.2"})
+
+		err := receiveJob(guest, CmdlineParams{ParamJob: ""}, dir)
+		require.NoError(t, err)
+
+		target, err := os.Readlink(filepath.Join(libsDir, "libfoo.so.1"))
+		require.NoError(t, err)
+		assert.Equal(t, "libfoo.so.1.2", target)
+
+		target, err = os.Readlink(interpreter)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(libsDir, "ld.so.1"), target)
+
+		assert.Equal(t, libsDir+":/lib", os.Getenv("LD_LIBRARY_PATH"))
+	})
+}
+
+// serveJob serves the given job with a binary and the given libraries in
+// [JobLibsDir] to the returned guest connection that writes streams into the
+// given directory.
+func serveJob(t *testing.T, dir string, job Job, libs []string) *pipe.Conn {
+	t.Helper()
+
+	guestRead, hostWrite := io.Pipe()
+	hostRead, guestWrite := io.Pipe()
+
+	t.Cleanup(func() {
+		_ = guestWrite.Close()
+		_ = hostWrite.Close()
+	})
+
+	host := pipe.NewConn(hostWrite)
+	host.Handler = func(method string, _ json.RawMessage) (any, error) {
+		assert.Equal(t, HostMethodJob, method)
+
+		err := host.Writer().SendStream(JobBinaryName,
+			strings.NewReader("binary"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, lib := range libs {
+			err := host.Writer().SendStream(path.Join(JobLibsDir, lib),
+				strings.NewReader("library"))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return job, nil
+	}
+
+	guest := pipe.NewConn(guestWrite)
+	guest.Open = func(name string) (io.WriteCloser, error) {
+		dst := filepath.Join(dir, name)
+
+		err := os.MkdirAll(filepath.Dir(dst), 0o755)
+		if err != nil {
+			return nil, err
+		}
+
+		return os.Create(dst)
+	}
+
+	go func() { _ = host.Serve(hostRead) }()
+	go func() { _ = guest.Serve(guestRead) }()
+
+	return guest
+}
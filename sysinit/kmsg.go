@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	// kmsgDevice is the device the records of the kernel log are read from.
+	kmsgDevice = "/dev/kmsg"
+
+	// kmsgRecordSize is the maximum size of a record of [kmsgDevice]. A
+	// read returns a single record.
+	kmsgRecordSize = 8192
+
+	// kmsgDrainTimeout is the time the records written to the kernel log
+	// before the stream is stopped have to be read.
+	kmsgDrainTimeout = 100 * time.Millisecond
+)
+
+// streamKernelLog streams the records of the kernel log to the console device
+// given by [ParamKmsgDevice], starting with the oldest record in the log
+// buffer. Records are written as read from "/dev/kmsg", as described in
+// dev-kmsg(4). The returned function stops streaming once the records written
+// until then are streamed. If no device is set, nothing is streamed.
+func streamKernelLog(params CmdlineParams) (func(), error) {
+	stop := func() {}
+
+	path := params[ParamKmsgDevice]
+	if path == "" {
+		return stop, nil
+	}
+
+	kmsg, err := os.Open(kmsgDevice)
+	if err != nil {
+		return stop, err //nolint:wrapcheck
+	}
+
+	device, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		_ = kmsg.Close()
+		return stop, err //nolint:wrapcheck
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_ = copyKernelLog(device, kmsg)
+	}()
+
+	stop = func() {
+		// Records are read as soon as they are available, so the deadline
+		// stops reading once all records are read. Without deadline support,
+		// the reading goroutine is left to the shutdown.
+		deadline := time.Now().Add(kmsgDrainTimeout)
+		if err := kmsg.SetReadDeadline(deadline); err == nil {
+			<-done
+		}
+
+		_ = kmsg.Close()
+		_ = device.Close()
+	}
+
+	return stop, nil
+}
+
+// copyKernelLog copies the records read from the given kernel log reader to
+// the given writer until reading fails. Records overwritten in the log buffer
+// before they are read are skipped.
+func copyKernelLog(w io.Writer, kmsg io.Reader) error {
+	buf := make([]byte, kmsgRecordSize)
+
+	for {
+		n, err := kmsg.Read(buf)
+		if errors.Is(err, syscall.EPIPE) {
+			continue
+		}
+
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		_, err = w.Write(buf[:n])
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+}
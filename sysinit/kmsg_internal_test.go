@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"bytes"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordReader returns a single record or error per read, like
+// "/dev/kmsg".
+type recordReader struct {
+	records []any
+}
+
+func (r *recordReader) Read(buf []byte) (int, error) {
+	if len(r.records) == 0 {
+		return 0, io.EOF
+	}
+
+	record := r.records[0]
+	r.records = r.records[1:]
+
+	if err, ok := record.(error); ok {
+		return 0, err
+	}
+
+	return copy(buf, record.(string)), nil
+}
+
+func TestCopyKernelLog(t *testing.T) {
+	var buf bytes.Buffer
+
+	kmsg := &recordReader{records: []any{
+		"6,1,100,-;first\n",
+		syscall.EPIPE,
+		"4,3,200,-;third\n SUBSYSTEM=net\n",
+	}}
+
+	err := copyKernelLog(&buf, kmsg)
+	require.ErrorIs(t, err, io.EOF)
+
+	assert.Equal(t, "6,1,100,-;first\n4,3,200,-;third\n SUBSYSTEM=net\n",
+		buf.String())
+}
+
+func TestStreamKernelLog_NoDevice(t *testing.T) {
+	stop, err := streamKernelLog(CmdlineParams{})
+	require.NoError(t, err)
+
+	stop()
+}
@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+// Directories virtrun adds files of the initramfs to. They are the same in
+// wrapped and standalone mode.
+const (
+	// DataDir is the directory additional files are added to. Files pushed
+	// by the host are written to it as well.
+	DataDir = "/data"
+
+	// BinDir is the directory additional files are linked into, so they can
+	// be run by name.
+	BinDir = "/usr/local/bin"
+
+	// ModulesDir is the directory kernel modules are added to.
+	ModulesDir = "/lib/modules"
+
+	// BinfmtDir is the directory binfmt_misc rule files are added to.
+	BinfmtDir = "/etc/binfmt.d"
+)
+
+// DefaultPath is the PATH environment variable for the directories
+// additional files are added to.
+const DefaultPath = BinDir + ":" + DataDir
+
+// VirtrunConfig creates a new default config for the files added by
+// virtrun. The kernel modules and binfmt_misc rules added by virtrun are
+// loaded and PATH is set to [DefaultPath], like virtrun's own init does in
+// wrapped mode. Use it for binaries run in standalone mode.
+func VirtrunConfig() Config {
+	cfg := DefaultConfig()
+	cfg.ModulesDir = ModulesDir
+	cfg.BinfmtDir = BinfmtDir
+	cfg.Env["PATH"] = DefaultPath
+
+	return cfg
+}
@@ -0,0 +1,23 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit_test
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVirtrunConfig(t *testing.T) {
+	cfg := sysinit.VirtrunConfig()
+
+	assert.Equal(t, "/lib/modules", cfg.ModulesDir)
+	assert.Equal(t, "/etc/binfmt.d", cfg.BinfmtDir)
+	assert.Equal(t, "/usr/local/bin:/data", cfg.Env["PATH"])
+
+	// The default config is not changed.
+	assert.Empty(t, sysinit.DefaultConfig().Env)
+}
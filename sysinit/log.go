@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// initLog is a structured logger that writes JSON records to the log console
+// device provided by the host.
+//
+// The console device is only available once the system is set up. All
+// records written before are buffered and written once the device is opened.
+// If the host does not provide a log console device, records are discarded.
+type initLog struct {
+	*slog.Logger
+
+	writer *deferredWriter
+}
+
+func newInitLog() *initLog {
+	writer := &deferredWriter{}
+
+	return &initLog{
+		Logger: slog.New(slog.NewJSONHandler(writer, nil)),
+		writer: writer,
+	}
+}
+
+// open sets the destination of the [initLog] according to the given kernel
+// command line parameters and writes all buffered records to it.
+//
+// If no log device is set, all records are discarded.
+func (l *initLog) open(params CmdlineParams) error {
+	path := params[ParamLogDevice]
+	if path == "" {
+		return l.writer.setDestination(io.Discard)
+	}
+
+	device, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		_ = l.writer.setDestination(io.Discard)
+		return err //nolint:wrapcheck
+	}
+
+	return l.writer.setDestination(device)
+}
+
+// phase runs the given function and logs its result along with its duration
+// and the given name of the phase.
+//
+// The error returned by the function is passed through.
+func (l *initLog) phase(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	l.phaseDone(name, start, err)
+
+	return err
+}
+
+func (l *initLog) phaseDone(
+	name string,
+	start time.Time,
+	err error,
+	attrs ...slog.Attr,
+) {
+	level := slog.LevelInfo
+
+	attrs = append(attrs,
+		slog.String("phase", name),
+		slog.Duration("duration", time.Since(start)),
+	)
+
+	if err != nil {
+		level = slog.LevelError
+
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	l.LogAttrs(context.Background(), level, "phase done", attrs...)
+}
+
+// deferredWriter buffers all writes until a destination is set.
+type deferredWriter struct {
+	buf bytes.Buffer
+	dst io.Writer
+}
+
+// Write implements [io.Writer].
+func (w *deferredWriter) Write(p []byte) (int, error) {
+	if w.dst == nil {
+		return w.buf.Write(p) //nolint:wrapcheck
+	}
+
+	return w.dst.Write(p) //nolint:wrapcheck
+}
+
+// setDestination sets the destination for all following writes and writes
+// the buffered data to it.
+func (w *deferredWriter) setDestination(dst io.Writer) error {
+	w.dst = dst
+
+	_, err := w.buf.WriteTo(dst)
+
+	return err //nolint:wrapcheck
+}
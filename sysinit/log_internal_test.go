@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeferredWriter(t *testing.T) {
+	var (
+		writer deferredWriter
+		dst    bytes.Buffer
+	)
+
+	_, err := writer.Write([]byte("first "))
+	require.NoError(t, err)
+	assert.Empty(t, dst.String())
+
+	require.NoError(t, writer.setDestination(&dst))
+	assert.Equal(t, "first ", dst.String())
+
+	_, err = writer.Write([]byte("second"))
+	require.NoError(t, err)
+	assert.Equal(t, "first second", dst.String())
+}
+
+func TestInitLog_Phase(t *testing.T) {
+	var dst bytes.Buffer
+
+	log := newInitLog()
+
+	err := log.phase("fail", func() error { return assert.AnError })
+	require.ErrorIs(t, err, assert.AnError)
+
+	require.NoError(t, log.writer.setDestination(&dst))
+
+	var record map[string]any
+
+	require.NoError(t, json.Unmarshal(dst.Bytes(), &record))
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "fail", record["phase"])
+	assert.Equal(t, assert.AnError.Error(), record["error"])
+	assert.Contains(t, record, "duration")
+}
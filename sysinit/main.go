@@ -6,6 +6,12 @@ package sysinit
 
 import (
 	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 )
 
 // ErrNotPidOne may be returned if the process is expected to be run as PID 1
@@ -27,9 +33,19 @@ func IsPidOneChild() bool {
 //
 // Call when done, or deferred right at the beginning of your `TestMain`
 // function.
+//
+// The kernel is silenced, so its shutdown messages do not show up in the
+// output.
 func Poweroff() {
-	// Silence the kernel so it does not show up in our test output.
-	_ = sysctl("kernel/printk", "0")
+	poweroff(ConsoleLogLevelSilent)
+}
+
+// poweroff shuts down the system after setting the given console log level.
+// If it is empty, the console log level is not changed.
+func poweroff(level ConsoleLogLevel) {
+	if level != "" {
+		_ = SetConsoleLogLevel(level)
+	}
 
 	// Use restart instead of poweroff for shutting down the system since it
 	// does not require ACPI. The guest system should be started with noreboot.
@@ -62,6 +78,90 @@ type Config struct {
 	// ModulesDir defines the directory that contains kernel modules. They are
 	// load on init automatically.
 	ModulesDir string
+
+	// ModulesAutoload determines if only those modules in ModulesDir are
+	// loaded that are required by present devices. They are loaded after all
+	// file systems are mounted. It is enabled as well if the kernel command
+	// line parameter [ParamModulesAutoload] is present. See
+	// [LoadModulesForDevices].
+	ModulesAutoload bool
+
+	// EnvFromCmdline determines if kernel command line parameters with the
+	// [CmdlineEnvPrefix] are added to the process's environment without the
+	// prefix. They take precedence over variables set in Env.
+	EnvFromCmdline bool
+
+	// MountOptionsFromCmdline determines if additional mount options for
+	// MountPoints are read from the kernel command line parameter
+	// [ParamMountOptions].
+	MountOptionsFromCmdline bool
+
+	// SyncClock determines if the system clock is set from the real time
+	// clock device [DefaultRTCDevice]. If it is not available, the host time
+	// from kernel command line parameter [ParamEpoch] is used.
+	SyncClock bool
+
+	// ReadOnlyPaths is a list of files and directories that are made
+	// read-only once all file systems are mounted. See [MakeReadOnly].
+	ReadOnlyPaths []string
+
+	// ReadOnlyPathsFromCmdline determines if additional paths for
+	// ReadOnlyPaths are read from the kernel command line parameter
+	// [ParamReadOnly].
+	ReadOnlyPathsFromCmdline bool
+
+	// Sysctls is a set of kernel parameters that are set on init. Use it to
+	// configure rate limiting of kernel messages with
+	// [SysctlPrintkRatelimit] and [SysctlPrintkRatelimitBurst].
+	Sysctls Sysctls
+
+	// SysctlsFromCmdline determines if additional kernel parameters are read
+	// from the kernel command line parameter [ParamSysctls]. They take
+	// precedence over parameters set in Sysctls.
+	SysctlsFromCmdline bool
+
+	// CollectFiles is a list of glob patterns for files that are sent to the
+	// host once the main function returned. Files are sent only if the host
+	// provides a device by kernel command line parameter
+	// [ParamCollectDevice]. See [CollectFiles].
+	CollectFiles []string
+
+	// CollectFilesFromCmdline determines if additional glob patterns for
+	// CollectFiles are read from the kernel command line parameter
+	// [ParamCollect].
+	CollectFilesFromCmdline bool
+
+	// BinfmtDir defines the directory that contains binfmt_misc rules in the
+	// format described in binfmt.d(5). They are registered on init
+	// automatically. See [RegisterBinfmtFrom].
+	BinfmtDir string
+
+	// ZramSwapSize is the size in bytes of a compressed swap space in memory
+	// that is enabled on init. It is disabled if 0. This requires the zram
+	// kernel module. See [EnableZramSwap].
+	ZramSwapSize uint64
+
+	// ZramSwapFromCmdline determines if the ZramSwapSize is read from the
+	// kernel command line parameter [ParamZramSwap]. It takes precedence over
+	// the configured size.
+	ZramSwapFromCmdline bool
+
+	// SeedFromCmdline determines if the random seed from the kernel command
+	// line parameter [ParamSeed] is exported as environment variable
+	// [SeedEnv] and written to [SeedFile]. See [Seed].
+	SeedFromCmdline bool
+
+	// ConsoleLogLevel is the kernel console log level set on init. If empty,
+	// the level set by the kernel command line is kept, which is
+	// [ConsoleLogLevelError] unless the kernel is run verbose. A kernel
+	// parameter "kernel.printk" in Sysctls takes precedence.
+	ConsoleLogLevel ConsoleLogLevel
+
+	// PoweroffConsoleLogLevel is the kernel console log level set right
+	// before the system is shut down. It is [ConsoleLogLevelSilent] by
+	// default, so kernel shutdown messages do not show up in the output. If
+	// empty, the console log level is not changed.
+	PoweroffConsoleLogLevel ConsoleLogLevel
 }
 
 // DefaultConfig creates a new default config.
@@ -77,6 +177,7 @@ func DefaultConfig() Config {
 			"/dev/pts":                 {FSType: FSTypeDevPts, MayFail: true},
 			"/dev/shm":                 {FSType: FSTypeTmp, MayFail: true},
 			"/proc":                    {FSType: FSTypeProc},
+			BinfmtMiscDir:              {FSType: FSTypeBinfmt, MayFail: true},
 			"/run":                     {FSType: FSTypeTmp},
 			"/sys/fs/bpf":              {FSType: FSTypeBpf, MayFail: true},
 			"/sys/fs/cgroup":           {FSType: FSTypeCgroup2, MayFail: true},
@@ -97,8 +198,18 @@ func DefaultConfig() Config {
 			"/dev/stdout": "/proc/self/fd/1",
 			"/dev/stderr": "/proc/self/fd/2",
 		},
-		Env:               EnvVars{},
-		ConfigureLoopback: true,
+		Env:                      EnvVars{},
+		ConfigureLoopback:        true,
+		EnvFromCmdline:           true,
+		MountOptionsFromCmdline:  true,
+		ReadOnlyPathsFromCmdline: true,
+		SyncClock:                true,
+		Sysctls:                  Sysctls{},
+		SysctlsFromCmdline:       true,
+		CollectFilesFromCmdline:  true,
+		ZramSwapFromCmdline:      true,
+		SeedFromCmdline:          true,
+		PoweroffConsoleLogLevel:  ConsoleLogLevelSilent,
 	}
 }
 
@@ -107,13 +218,26 @@ func DefaultConfig() Config {
 // It sets up the system and ensures proper shut down. Preparation steps are:
 // - Guarding itself to be actually PID 1.
 // - Setup system poweroff (on function termination!).
-// - Load additional kernel modules.
+// - Read host provided parameters from the kernel command line.
+// - Load additional kernel modules, unless only required ones are loaded.
 // - Mount all known virtual system file systems.
+// - Make configured paths read-only.
 // - Add well known symlinks in /dev.
+// - Load kernel modules required by present devices, if enabled.
+// - Set kernel parameters.
+// - Enable swap space.
+// - Register binfmt_misc interpreters.
+// - Set the system clock.
 // - Bring loopback interface up.
 // - Set environment variables.
+// - Write the random seed given by the host, if any.
 //
-// Once this is done, the given function is run. The function must not
+// Once this is done, requests of the host are served in the background, if
+// the host provides a control console. Files pushed by the host are received,
+// sockets forwarded to the host are set up, a job of the host is awaited, if
+// requested by [ParamJob], and the given function is run.
+// Afterwards, files configured for collection are sent to the host. The
+// progress is communicated to the host by [Notify]. The function must not
 // terminate the process itself (by calling [os.Exit] or panicking)! Otherwise
 // the proper system termination is missing and the system will panic due to
 // the init program terminating unexpectedly.
@@ -143,7 +267,7 @@ func Main(cfg Config, fn func() (int, error)) {
 	}
 
 	PrintExitCode(exitCode)
-	Poweroff()
+	poweroff(cfg.PoweroffConsoleLogLevel)
 }
 
 func main(cfg Config, fn func() (int, error)) (int, error) {
@@ -151,36 +275,284 @@ func main(cfg Config, fn func() (int, error)) (int, error) {
 		return -2, ErrNotPidOne
 	}
 
+	Notify(StateBooted)
+
+	log := newInitLog()
+
 	// Setup the system.
-	if err := setup(cfg); err != nil {
+	params, err := setup(cfg, log)
+
+	// The log device can be opened only once the system is set up. If this
+	// fails, the records are lost but the main function can still run.
+	if err := log.open(params); err != nil {
+		PrintWarning(fmt.Errorf("open log: %w", err))
+	}
+
+	if err != nil {
 		return -1, err
 	}
 
-	return fn()
+	// Requests of the host are optional, so the main function can run
+	// without.
+	conn, err := serveControl(params)
+	if err != nil {
+		PrintWarning(fmt.Errorf("serve control: %w", err))
+	}
+
+	// Without heartbeats, the host can not tell if the guest hangs, but the
+	// main function can still run.
+	if err := sendHeartbeats(conn, params); err != nil {
+		PrintWarning(fmt.Errorf("send heartbeats: %w", err))
+	}
+
+	// The kernel log is informational only, so the main function can run
+	// without.
+	stopKernelLog, err := streamKernelLog(params)
+	if err != nil {
+		PrintWarning(fmt.Errorf("stream kernel log: %w", err))
+	}
+
+	// Resource usage is informational only, so the main function can run
+	// without.
+	stopMetrics, err := startMetrics(conn, params)
+	if err != nil {
+		PrintWarning(fmt.Errorf("start metrics: %w", err))
+	}
+
+	// The round trip times are measured before the main function runs, so
+	// it does not interfere with them.
+	err = log.phase("echo", func() error {
+		return echoHost(conn, params)
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	// Files pushed by the host are required by the main function, so it
+	// must not run without them.
+	err = log.phase("push", func() error {
+		return pushFiles(conn, params)
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	// Forwarded sockets are required by the main function, so it must not
+	// run without them.
+	err = log.phase("forward", func() error {
+		return startForwards(conn, params)
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	// The job replaces the main function's binary, so it must not run
+	// without. Everything before is done while the guest waits for it.
+	err = log.phase("job", func() error {
+		return receiveJob(conn, params, DataDir)
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	Notify(StateSetupDone)
+	Notify(StateMainStarted)
+
+	start := time.Now()
+	exitCode, err := fn()
+
+	Notify(StateMainFinished)
+
+	stopMetrics()
+
+	log.phaseDone("main", start, err, slog.Int("exit_code", exitCode))
+
+	// Failing to collect files does not change the result of the main
+	// function, as it is not related to it.
+	collectErr := log.phase("collect", func() error {
+		return collectFiles(cfg, params)
+	})
+	if collectErr != nil {
+		PrintWarning(fmt.Errorf("collect files: %w", collectErr))
+	}
+
+	stopKernelLog()
+
+	return exitCode, err
 }
 
-func setup(cfg Config) error {
-	if cfg.ModulesDir != "" {
-		if err := LoadModules(cfg.ModulesDir); err != nil {
+func setup(cfg Config, log *initLog) (CmdlineParams, error) {
+	var params CmdlineParams
+
+	// Parameters set by the host are required before mounting the file
+	// systems as they may contain mount options.
+	err := log.phase("cmdline", func() error {
+		var err error
+
+		params, err = readCmdlineEarly()
+		if err != nil {
 			return err
 		}
+
+		if cfg.MountOptionsFromCmdline {
+			cfg.MountPoints = maps.Clone(cfg.MountPoints)
+
+			return cfg.MountPoints.AddOptionsList(params[ParamMountOptions])
+		}
+
+		return nil
+	})
+	if err != nil {
+		return params, err
+	}
+
+	autoload := cfg.ModulesAutoload || params.Has(ParamModulesAutoload)
+
+	if cfg.ModulesDir != "" && !autoload {
+		err := log.phase("modules", func() error {
+			return LoadModules(cfg.ModulesDir)
+		})
+		if err != nil {
+			return params, err
+		}
 	}
 
 	if cfg.ConfigureLoopback {
-		if err := ConfigureLoopbackInterface(); err != nil {
-			return err
+		err := log.phase("loopback", ConfigureLoopbackInterface)
+		if err != nil {
+			return params, err
+		}
+	}
+
+	err = log.phase("mounts", func() error {
+		return MountAll(cfg.MountPoints)
+	})
+	if err != nil {
+		return params, err
+	}
+
+	err = log.phase("readonly", func() error {
+		paths := slices.Clone(cfg.ReadOnlyPaths)
+
+		if cfg.ReadOnlyPathsFromCmdline && params[ParamReadOnly] != "" {
+			paths = append(paths, strings.Split(params[ParamReadOnly], ";")...)
 		}
+
+		return MakeReadOnly(paths...)
+	})
+	if err != nil {
+		return params, err
 	}
 
-	if err := MountAll(cfg.MountPoints); err != nil {
-		return err
+	err = log.phase("symlinks", func() error {
+		return CreateSymlinks(cfg.Symlinks)
+	})
+	if err != nil {
+		return params, err
+	}
+
+	// Devices are known only once the sys file system is mounted.
+	if cfg.ModulesDir != "" && autoload {
+		err := log.phase("modules", func() error {
+			return LoadModulesForDevices(cfg.ModulesDir, DefaultDevicesDir)
+		})
+		if err != nil {
+			return params, err
+		}
+	}
+
+	err = log.phase("sysctls", func() error {
+		sysctls := maps.Clone(cfg.Sysctls)
+		if sysctls == nil {
+			sysctls = make(Sysctls)
+		}
+
+		if cfg.SysctlsFromCmdline {
+			sysctls.AddList(params[ParamSysctls])
+		}
+
+		if cfg.ConsoleLogLevel != "" {
+			if err := SetConsoleLogLevel(cfg.ConsoleLogLevel); err != nil {
+				return err
+			}
+		}
+
+		return SetSysctls(sysctls)
+	})
+	if err != nil {
+		return params, err
+	}
+
+	err = log.phase("swap", func() error {
+		return setupSwap(cfg, params)
+	})
+	if err != nil {
+		return params, err
+	}
+
+	if cfg.BinfmtDir != "" {
+		err = log.phase("binfmt", func() error {
+			return RegisterBinfmtFrom(cfg.BinfmtDir)
+		})
+		if err != nil {
+			return params, err
+		}
+	}
+
+	if cfg.SyncClock {
+		err = log.phase("clock", func() error {
+			epoch, err := epochFrom(params)
+			if err != nil {
+				return err
+			}
+
+			return SyncClock(DefaultRTCDevice, epoch)
+		})
+		if err != nil {
+			return params, err
+		}
+	}
+
+	err = log.phase("env", func() error {
+		return setupEnv(cfg, params)
+	})
+	if err != nil {
+		return params, err
+	}
+
+	if seed, exists := params[ParamSeed]; cfg.SeedFromCmdline && exists {
+		err = log.phase("seed", func() error {
+			return WriteSeedFile(seed)
+		})
+	}
+
+	return params, err
+}
+
+func setupEnv(cfg Config, params CmdlineParams) error {
+	env := maps.Clone(cfg.Env)
+	if env == nil {
+		env = make(EnvVars)
+	}
+
+	if cfg.EnvFromCmdline {
+		// The kernel passes unknown parameters with values as environment
+		// variables to the init. Remove them, as they are added without
+		// prefix.
+		for key := range params.Env() {
+			if err := unsetenv(CmdlineEnvPrefix + key); err != nil {
+				return err
+			}
+		}
+
+		maps.Copy(env, params.Env())
 	}
 
-	if err := CreateSymlinks(cfg.Symlinks); err != nil {
-		return err
+	if seed, exists := params[ParamSeed]; cfg.SeedFromCmdline && exists {
+		env[SeedEnv] = seed
 	}
 
-	for key, value := range cfg.Env {
+	for key, value := range env {
 		if err := setenv(key, value); err != nil {
 			return err
 		}
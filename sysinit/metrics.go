@@ -0,0 +1,233 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aibor/virtrun/internal/pipe"
+)
+
+// MetricsStreamName is the name of the stream the init sends [Metrics] to the
+// host with on the control console, if kernel command line parameter
+// [ParamMetrics] is present. The stream consists of JSON lines.
+const MetricsStreamName = "metrics"
+
+// clockTicksPerSecond is the unit of CPU times in "/proc/stat". It is fixed
+// for all architectures.
+const clockTicksPerSecond = 100
+
+// Metrics is a sample of the resource usage of the guest system as read from
+// the proc file system. CPU times and I/O are accumulated since boot.
+type Metrics struct {
+	// Uptime is the time since boot.
+	Uptime time.Duration `json:"uptime"`
+
+	// MemoryTotal is the usable memory in bytes.
+	MemoryTotal uint64 `json:"memoryTotal"`
+
+	// MemoryAvailable is the memory in bytes available for new processes.
+	MemoryAvailable uint64 `json:"memoryAvailable"`
+
+	// CPUUser is the CPU time spent in user mode by all CPUs.
+	CPUUser time.Duration `json:"cpuUser"`
+
+	// CPUSystem is the CPU time spent in kernel mode by all CPUs.
+	CPUSystem time.Duration `json:"cpuSystem"`
+
+	// CPUIdle is the CPU time all CPUs were idle.
+	CPUIdle time.Duration `json:"cpuIdle"`
+
+	// Load1 is the load average over the last minute.
+	Load1 float64 `json:"load1"`
+
+	// IORead is the data in bytes read from block devices.
+	IORead uint64 `json:"ioRead"`
+
+	// IOWritten is the data in bytes written to block devices.
+	IOWritten uint64 `json:"ioWritten"`
+}
+
+// readMetrics reads [Metrics] from the given proc file system.
+func readMetrics(proc fs.FS) (Metrics, error) {
+	var metrics Metrics
+
+	readers := map[string]func(fields []string){
+		"uptime": func(fields []string) {
+			seconds, _ := strconv.ParseFloat(fields[0], 64)
+			metrics.Uptime = time.Duration(seconds * float64(time.Second))
+		},
+		"meminfo": func(fields []string) {
+			// Values are in kB.
+			switch fields[0] {
+			case "MemTotal:":
+				metrics.MemoryTotal = parseUint(fields, 1) * 1024
+			case "MemAvailable:":
+				metrics.MemoryAvailable = parseUint(fields, 1) * 1024
+			}
+		},
+		"stat": func(fields []string) {
+			if fields[0] != "cpu" {
+				return
+			}
+
+			ticks := func(idx int) time.Duration {
+				return time.Duration(parseUint(fields, idx)) *
+					time.Second / clockTicksPerSecond
+			}
+
+			metrics.CPUUser = ticks(1)
+			metrics.CPUSystem = ticks(3)
+			metrics.CPUIdle = ticks(4)
+		},
+		"loadavg": func(fields []string) {
+			metrics.Load1, _ = strconv.ParseFloat(fields[0], 64)
+		},
+		"vmstat": func(fields []string) {
+			// Values are in kB.
+			switch fields[0] {
+			case "pgpgin":
+				metrics.IORead = parseUint(fields, 1) * 1024
+			case "pgpgout":
+				metrics.IOWritten = parseUint(fields, 1) * 1024
+			}
+		},
+	}
+
+	for name, fn := range readers {
+		err := readFields(proc, name, fn)
+		if err != nil {
+			return Metrics{}, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// readFields calls fn with the white space separated fields of each non
+// empty line of the given file.
+func readFields(fsys fs.FS, name string, fn func(fields []string)) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			fn(fields)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// parseUint returns the field with the given index as unsigned integer. It
+// returns 0 if the field is not present or invalid.
+func parseUint(fields []string, idx int) uint64 {
+	if idx >= len(fields) {
+		return 0
+	}
+
+	value, _ := strconv.ParseUint(fields[idx], 10, 64)
+
+	return value
+}
+
+// startMetrics sends [Metrics] to the host in the background with the interval
+// set by kernel command line parameter [ParamMetrics]. The returned function
+// sends a last sample and ends the stream. If the parameter is not present,
+// nothing is sent.
+func startMetrics(conn *pipe.Conn, params CmdlineParams) (func(), error) {
+	stop := func() {}
+
+	value := params[ParamMetrics]
+	if value == "" {
+		return stop, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return stop, fmt.Errorf("parse interval: %w", err)
+	}
+
+	if conn == nil {
+		return stop, ErrNoControlDevice
+	}
+
+	stream, err := conn.Writer().OpenStream(MetricsStreamName)
+	if err != nil {
+		return stop, fmt.Errorf("open stream: %w", err)
+	}
+
+	proc := os.DirFS("/proc")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := sendMetrics(stream, proc); err != nil {
+				PrintWarning(err)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	stop = func() {
+		cancel()
+		<-done
+
+		// The last sample covers the end of the main function.
+		if err := sendMetrics(stream, proc); err != nil {
+			PrintWarning(err)
+		}
+
+		if err := stream.Close(); err != nil {
+			PrintWarning(fmt.Errorf("close metrics: %w", err))
+		}
+	}
+
+	return stop, nil
+}
+
+// sendMetrics writes the current [Metrics] as JSON line to w.
+func sendMetrics(w io.Writer, proc fs.FS) error {
+	metrics, err := readMetrics(proc)
+	if err != nil {
+		return fmt.Errorf("read metrics: %w", err)
+	}
+
+	err = json.NewEncoder(w).Encode(metrics)
+	if err != nil {
+		return fmt.Errorf("send metrics: %w", err)
+	}
+
+	return nil
+}
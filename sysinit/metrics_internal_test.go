@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMetrics(t *testing.T) {
+	proc := fstest.MapFS{
+		"uptime": {Data: []byte("12.50 20.00\n")},
+		"meminfo": {Data: []byte(
+			"MemTotal:         246140 kB\n" +
+				"MemFree:          200000 kB\n" +
+				"MemAvailable:     220000 kB\n",
+		)},
+		"stat": {Data: []byte(
+			"cpu  150 0 50 1000 0 0 0 0 0 0\n" +
+				"cpu0 150 0 50 1000 0 0 0 0 0 0\n",
+		)},
+		"loadavg": {Data: []byte("0.42 0.10 0.01 1/80 123\n")},
+		"vmstat": {Data: []byte(
+			"nr_free_pages 50000\n" +
+				"pgpgin 2048\n" +
+				"pgpgout 16\n",
+		)},
+	}
+
+	expected := Metrics{
+		Uptime:          12500 * time.Millisecond,
+		MemoryTotal:     246140 * 1024,
+		MemoryAvailable: 220000 * 1024,
+		CPUUser:         1500 * time.Millisecond,
+		CPUSystem:       500 * time.Millisecond,
+		CPUIdle:         10 * time.Second,
+		Load1:           0.42,
+		IORead:          2048 * 1024,
+		IOWritten:       16 * 1024,
+	}
+
+	actual, err := readMetrics(proc)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	var buf bytes.Buffer
+
+	err = sendMetrics(&buf, proc)
+	require.NoError(t, err)
+
+	var sent Metrics
+
+	err = json.Unmarshal(buf.Bytes(), &sent)
+	require.NoError(t, err)
+	assert.Equal(t, expected, sent)
+}
+
+func TestReadMetrics_Missing(t *testing.T) {
+	_, err := readMetrics(fstest.MapFS{})
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestStartMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      CmdlineParams
+		expectedErr string
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:        "invalid interval",
+			params:      CmdlineParams{ParamMetrics: "often"},
+			expectedErr: "parse interval",
+		},
+		{
+			name:        "no control device",
+			params:      CmdlineParams{ParamMetrics: "1s"},
+			expectedErr: ErrNoControlDevice.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stop, err := startMetrics(nil, tt.params)
+			require.NotNil(t, stop)
+
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			}
+
+			stop()
+		})
+	}
+}
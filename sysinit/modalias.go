@@ -0,0 +1,244 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDevicesDir is the directory that contains all devices known to the
+// kernel, if the sys file system is mounted at "/sys".
+const DefaultDevicesDir = "/sys/devices"
+
+// moduleInfo is the information about a kernel module required for loading
+// it on demand.
+type moduleInfo struct {
+	path    string
+	name    string
+	aliases []string
+	depends []string
+}
+
+// parseModuleInfo parses the content of the ".modinfo" section of a kernel
+// module. It consists of null terminated "key=value" strings.
+func parseModuleInfo(path string, data []byte) moduleInfo {
+	info := moduleInfo{path: path}
+
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		key, value, _ := strings.Cut(string(entry), "=")
+
+		switch key {
+		case "name":
+			info.name = value
+		case "alias":
+			info.aliases = append(info.aliases, value)
+		case "depends":
+			if value != "" {
+				info.depends = strings.Split(value, ",")
+			}
+		}
+	}
+
+	return info
+}
+
+// readModuleInfo reads the [moduleInfo] of the kernel module at the given
+// path.
+func readModuleInfo(path string) (moduleInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return moduleInfo{}, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	moduleReader, err := newModuleReader(file, parseModuleType(path))
+	if err != nil {
+		return moduleInfo{}, fmt.Errorf("module reader: %w", err)
+	}
+
+	var data bytes.Buffer
+
+	_, err = data.ReadFrom(moduleReader)
+	if err != nil {
+		return moduleInfo{}, fmt.Errorf("read module: %w", err)
+	}
+
+	elfFile, err := elf.NewFile(bytes.NewReader(data.Bytes()))
+	if err != nil {
+		return moduleInfo{}, fmt.Errorf("parse module: %w", err)
+	}
+
+	section := elfFile.Section(".modinfo")
+	if section == nil {
+		return moduleInfo{}, fmt.Errorf("%w: no .modinfo section", os.ErrInvalid)
+	}
+
+	sectionData, err := section.Data()
+	if err != nil {
+		return moduleInfo{}, fmt.Errorf("read .modinfo: %w", err)
+	}
+
+	return parseModuleInfo(path, sectionData), nil
+}
+
+// matches returns true if any of the module's aliases matches the given
+// device modalias.
+func (m moduleInfo) matches(modalias string) bool {
+	for _, alias := range m.aliases {
+		// Aliases are shell patterns that do not contain slashes, so
+		// [path.Match] behaves like fnmatch(3).
+		if matched, _ := path.Match(alias, modalias); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesAny returns true if any of the given device modaliases matches.
+func (m moduleInfo) matchesAny(modaliases []string) bool {
+	for _, modalias := range modaliases {
+		if m.matches(modalias) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadDeviceModaliases returns the modaliases of all devices present in the
+// given devices directory, usually [DefaultDevicesDir].
+func ReadDeviceModaliases(dir string) ([]string, error) {
+	var modaliases []string
+
+	err := filepath.WalkDir(dir, func(
+		path string,
+		entry fs.DirEntry,
+		err error,
+	) error {
+		if err != nil || entry.Name() != "modalias" {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			// Some devices do not provide their modalias.
+			return nil //nolint:nilerr
+		}
+
+		modalias := strings.TrimSpace(string(data))
+		if modalias != "" {
+			modaliases = append(modaliases, modalias)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk devices: %w", err)
+	}
+
+	return modaliases, nil
+}
+
+// LoadModulesForDevices loads the kernel modules found in the given directory
+// that are required by the devices present in the devices directory, usually
+// [DefaultDevicesDir].
+//
+// Modules are matched by the modaliases of the devices. Their dependencies
+// are loaded first, if present in the directory. Loaded modules may add more
+// devices, so the devices are scanned again until no more modules are loaded.
+// Modules the information can not be read for, like compressed modules of
+// unsupported formats, are loaded unconditionally.
+func LoadModulesForDevices(dir, devicesDir string) error {
+	files, err := ListRegularFiles(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("list module files: %w", err)
+	}
+
+	loader := moduleLoader{
+		byName: make(map[string]moduleInfo),
+		loaded: make(map[string]bool),
+	}
+
+	for _, file := range files {
+		info, err := readModuleInfo(file)
+		if err != nil {
+			PrintWarning(fmt.Errorf("module info %s: %w", file, err))
+
+			if err := loader.load(moduleInfo{path: file}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		loader.modules = append(loader.modules, info)
+		loader.byName[info.name] = info
+	}
+
+	for {
+		modaliases, err := ReadDeviceModaliases(devicesDir)
+		if err != nil {
+			return err
+		}
+
+		loadedBefore := len(loader.loaded)
+
+		for _, info := range loader.modules {
+			if loader.loaded[info.path] || !info.matchesAny(modaliases) {
+				continue
+			}
+
+			if err := loader.load(info); err != nil {
+				return err
+			}
+		}
+
+		if len(loader.loaded) == loadedBefore {
+			return nil
+		}
+	}
+}
+
+// moduleLoader loads modules along with their dependencies.
+type moduleLoader struct {
+	modules []moduleInfo
+	byName  map[string]moduleInfo
+	loaded  map[string]bool
+}
+
+func (l *moduleLoader) load(info moduleInfo) error {
+	if l.loaded[info.path] {
+		return nil
+	}
+
+	// Mark as loaded before loading dependencies to stop on cyclic
+	// dependencies.
+	l.loaded[info.path] = true
+
+	for _, name := range info.depends {
+		// Dependencies not present are expected to be built into the
+		// kernel.
+		if dep, exists := l.byName[name]; exists {
+			if err := l.load(dep); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := LoadModule(info.path, ""); err != nil {
+		return fmt.Errorf("load module %s: %w", info.path, err)
+	}
+
+	return nil
+}
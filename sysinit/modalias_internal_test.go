@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModuleInfo(t *testing.T) {
+	data := strings.Join([]string{
+		"license=GPL",
+		"depends=virtio_ring,virtio",
+		"alias=virtio:d00000001v*",
+		"alias=pci:v00001AF4d00001000sv*sd*bc*sc*i*",
+		"name=virtio_net",
+		"",
+	}, "\x00")
+
+	expected := moduleInfo{
+		path: "/lib/modules/0000-virtio_net.ko",
+		name: "virtio_net",
+		aliases: []string{
+			"virtio:d00000001v*",
+			"pci:v00001AF4d00001000sv*sd*bc*sc*i*",
+		},
+		depends: []string{"virtio_ring", "virtio"},
+	}
+
+	actual := parseModuleInfo(expected.path, []byte(data))
+	assert.Equal(t, expected, actual)
+}
+
+func TestModuleInfo_MatchesAny(t *testing.T) {
+	info := moduleInfo{
+		aliases: []string{
+			"virtio:d00000001v*",
+			"pci:v00001AF4d00001000sv*sd*bc*sc*i*",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		modaliases []string
+		assert     assert.BoolAssertionFunc
+	}{
+		{
+			name:       "none",
+			modaliases: nil,
+			assert:     assert.False,
+		},
+		{
+			name: "virtio",
+			modaliases: []string{
+				"virtio:d00000003v00001AF4",
+				"virtio:d00000001v00001AF4",
+			},
+			assert: assert.True,
+		},
+		{
+			name: "pci",
+			modaliases: []string{
+				"pci:v00001AF4d00001000sv00001AF4sd00000001bc02sc00i00",
+			},
+			assert: assert.True,
+		},
+		{
+			name: "other",
+			modaliases: []string{
+				"pci:v00008086d000029C0sv00001AF4sd00001100bc06sc00i00",
+			},
+			assert: assert.False,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assert(t, info.matchesAny(tt.modaliases))
+		})
+	}
+}
+
+func TestReadDeviceModaliases(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"pci0000:00/0000:00:01.0/modalias": "pci:v00001AF4d00001000\n",
+		"pci0000:00/0000:00:01.0/vendor":   "0x1af4\n",
+		"platform/serial8250/modalias":     "platform:serial8250\n",
+		"platform/empty/modalias":          "",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	actual, err := ReadDeviceModaliases(dir)
+	require.NoError(t, err)
+
+	expected := []string{
+		"pci:v00001AF4d00001000",
+		"platform:serial8250",
+	}
+
+	assert.Equal(t, expected, actual)
+}
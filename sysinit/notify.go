@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aibor/virtrun/protocol"
+)
+
+// NotifyFmt is the format string for communicating state changes of the
+// guest to the host.
+//
+// The same format string must be configured for the [qemu.Command] so it is
+// matched correctly.
+const NotifyFmt = protocol.NotifyFmt
+
+// State is a state of the guest system communicated by [Notify].
+type State string
+
+// States the init communicates by itself when run by [Main].
+const (
+	// StateBooted is sent once the init is started by the kernel.
+	StateBooted State = "booted"
+
+	// StateSetupDone is sent once the system is set up.
+	StateSetupDone State = "setup-done"
+
+	// StateMainStarted is sent right before the main function is run.
+	StateMainStarted State = "main-started"
+
+	// StateMainFinished is sent once the main function returned.
+	StateMainFinished State = "main-finished"
+)
+
+// Notify prints the magic string communicating the given state to stdout.
+//
+// The host records the time it received the state and reports the last state
+// received if the guest does not communicate an exit code. Custom states can
+// be used as progress markers, as long as they do not contain white space.
+func Notify(state State) {
+	_, _ = fmt.Fprintln(os.Stdout,
+		protocol.FormatNotification(NotifyFmt, string(state)))
+}
@@ -7,29 +7,55 @@ package sysinit
 import (
 	"fmt"
 	"os"
+
+	"github.com/aibor/virtrun/protocol"
 )
 
-// ExitCodeFmt is the format string for communicating the test results
+// ExitCodePrefix is the prefix of the line communicating the exit code of the
+// init to the host. The line is versioned and carries a checksum keyed by the
+// nonce given by [ParamExitCodeNonce], so output of the guest that just
+// contains the prefix does not count.
+//
+// The same prefix must be configured for the [qemu.Command] so it is matched
+// correctly.
+const ExitCodePrefix = protocol.ExitCodePrefix
+
+// ExitCodeFmt is the format string of the line communicating the exit code of
+// older versions.
 //
-// The same format string must be configured for the [qemu.Command] so it is
-// matched correctly.
-const ExitCodeFmt = "SYSINIT_EXIT_CODE: %d"
+// Deprecated: The host does not accept lines in this format anymore. Use
+// [PrintExitCode] instead.
+const ExitCodeFmt = ExitCodePrefix + ": %d"
 
 // PrintExitCode prints the magic string communicating the exit code of the
-// init to stdout.
+// init to stdout. The line is keyed by the nonce given by the host with
+// kernel command line parameter [ParamExitCodeNonce]. If it can not be read,
+// the host does not accept the line.
 func PrintExitCode(exitCode int) {
 	// Ensure newlines before and after to avoid other writes messing up the
 	// exit code communication as much as possible.
-	msgFmt := "\n" + ExitCodeFmt + "\n"
-	_, _ = fmt.Fprintf(os.Stdout, msgFmt, exitCode)
+	_, _ = fmt.Fprintf(os.Stdout, "\n%s\n",
+		protocol.FormatExitCode(ExitCodePrefix, exitCodeNonce(), exitCode))
+}
+
+// exitCodeNonce returns the nonce given by kernel command line parameter
+// [ParamExitCodeNonce]. It is empty if the parameter is absent or the kernel
+// command line can not be read.
+func exitCodeNonce() string {
+	params, err := readCmdlineEarly()
+	if err != nil {
+		return ""
+	}
+
+	return params[ParamExitCodeNonce]
 }
 
 // PrintError prints the given error to stderr.
 func PrintError(err error) {
-	_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	_, _ = fmt.Fprintln(os.Stderr, protocol.FormatError(err))
 }
 
 // PrintWarning prints the given error as warning to os.Stderr).
 func PrintWarning(err error) {
-	_, _ = fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	_, _ = fmt.Fprintln(os.Stderr, protocol.FormatWarning(err))
 }
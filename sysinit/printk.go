@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+// ConsoleLogLevel is a kernel console log level. Only kernel messages with a
+// level lower than the console log level are printed to the console. So, each
+// level prints messages up to and including the level it is named after.
+type ConsoleLogLevel string
+
+// Kernel console log levels.
+const (
+	ConsoleLogLevelSilent    ConsoleLogLevel = "0"
+	ConsoleLogLevelEmergency ConsoleLogLevel = "1"
+	ConsoleLogLevelAlert     ConsoleLogLevel = "2"
+	ConsoleLogLevelCritical  ConsoleLogLevel = "3"
+	ConsoleLogLevelError     ConsoleLogLevel = "4"
+	ConsoleLogLevelWarning   ConsoleLogLevel = "5"
+	ConsoleLogLevelNotice    ConsoleLogLevel = "6"
+	ConsoleLogLevelInfo      ConsoleLogLevel = "7"
+	ConsoleLogLevelDebug     ConsoleLogLevel = "8"
+)
+
+// SetConsoleLogLevel sets the kernel console log level.
+//
+// This requires the proc file system to be mounted at "/proc".
+func SetConsoleLogLevel(level ConsoleLogLevel) error {
+	return sysctl("kernel/printk", string(level))
+}
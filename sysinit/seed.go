@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// SeedEnv is the environment variable the random seed given by the host
+	// is exported as. See [ParamSeed].
+	SeedEnv = "VIRTRUN_SEED"
+
+	// SeedFile is the file the random seed given by the host is written to.
+	// See [ParamSeed].
+	SeedFile = "/run/virtrun/seed"
+
+	seedFileMode = 0o644
+)
+
+// Seed returns the random seed given by the host for reproducible runs, as
+// exported in [SeedEnv]. It returns false if no valid seed is set.
+//
+// Use it to seed random number generators, like those of property-based tests,
+// so failing runs can be reproduced with the same seed.
+func Seed() (int64, bool) {
+	seed, err := strconv.ParseInt(os.Getenv(SeedEnv), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return seed, true
+}
+
+// WriteSeedFile writes the given random seed into [SeedFile], so programs that
+// do not inherit the environment can read it as well.
+func WriteSeedFile(seed string) error {
+	return writeSeedFile(SeedFile, seed)
+}
+
+func writeSeedFile(path, seed string) error {
+	err := os.MkdirAll(filepath.Dir(path), defaultDirMode)
+	if err != nil {
+		return fmt.Errorf("create seed dir: %w", err)
+	}
+
+	err = os.WriteFile(path, []byte(seed+"\n"), seedFileMode)
+	if err != nil {
+		return fmt.Errorf("write seed file: %w", err)
+	}
+
+	return nil
+}
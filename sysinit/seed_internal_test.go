@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeed(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           string
+		expectedSeed  int64
+		expectedFound bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:          "valid",
+			env:           "-42",
+			expectedSeed:  -42,
+			expectedFound: true,
+		},
+		{
+			name: "invalid",
+			env:  "abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(SeedEnv, tt.env)
+
+			seed, found := Seed()
+			assert.Equal(t, tt.expectedFound, found)
+			assert.Equal(t, tt.expectedSeed, seed)
+		})
+	}
+}
+
+func TestWriteSeedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "virtrun", "seed")
+
+	err := writeSeedFile(path, "1234")
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "1234\n", string(content))
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// ZramDevice is the zram block device used by [EnableZramSwap].
+const ZramDevice = "zram0"
+
+// ErrSwapTooSmall is returned if the size for a swap space is smaller than
+// the minimum size of 10 pages.
+var ErrSwapTooSmall = errors.New("swap size too small")
+
+// swapSignature identifies a swap space. It is at the end of the first page.
+const swapSignature = "SWAPSPACE2"
+
+const (
+	// swapMinPages is the minimum size of a swap space accepted by mkswap(8).
+	swapMinPages = 10
+
+	// swapBootBitsSize is the size reserved for boot loaders at the start of
+	// a swap space.
+	swapBootBitsSize = 1024
+
+	swapFileMode = 0o600
+)
+
+// EnableZramSwap creates a compressed swap space in memory of the given size
+// in bytes on the zram device [ZramDevice] and enables it.
+//
+// This requires the zram kernel module to be loaded, the sys file system to
+// be mounted at "/sys" and the device file system at "/dev".
+func EnableZramSwap(size uint64) error {
+	sizePath := "/sys/block/" + ZramDevice + "/disksize"
+
+	err := os.WriteFile(sizePath, []byte(strconv.FormatUint(size, 10)), 0)
+	if err != nil {
+		return fmt.Errorf("set zram size: %w", err)
+	}
+
+	return enableSwap("/dev/"+ZramDevice, size)
+}
+
+// EnableSwapFile creates a swap file of the given size in bytes at the given
+// path and enables it.
+//
+// The file system the file is created on must support swap files. This is not
+// the case for the initramfs root file system or tmpfs.
+func EnableSwapFile(path string, size uint64) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+		swapFileMode)
+	if err != nil {
+		return fmt.Errorf("create swap file: %w", err)
+	}
+
+	// Swap files must not have holes, so actually write the whole file.
+	_, err = io.CopyN(file, zeroReader{}, int64(size)) //nolint:gosec
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("fill swap file: %w", err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("close swap file: %w", err)
+	}
+
+	return enableSwap(path, size)
+}
+
+// setupSwap enables the zram swap space as configured by
+// [Config.ZramSwapSize] or kernel command line parameter [ParamZramSwap].
+func setupSwap(cfg Config, params CmdlineParams) error {
+	size := cfg.ZramSwapSize
+
+	if value, exists := params[ParamZramSwap]; cfg.ZramSwapFromCmdline && exists {
+		var err error
+
+		size, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse zram swap size: %w", err)
+		}
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	return EnableZramSwap(size)
+}
+
+// enableSwap writes the swap header to the given device or file and enables
+// it as swap space.
+func enableSwap(path string, size uint64) error {
+	device, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("open swap device: %w", err)
+	}
+
+	err = writeSwapHeader(device, size, uint64(os.Getpagesize()))
+	if err != nil {
+		_ = device.Close()
+		return err
+	}
+
+	err = device.Close()
+	if err != nil {
+		return fmt.Errorf("close swap device: %w", err)
+	}
+
+	return swapon(path)
+}
+
+// writeSwapHeader writes the header of a swap space with the given size in
+// bytes as mkswap(8) does.
+func writeSwapHeader(dst io.WriterAt, size, pageSize uint64) error {
+	pages := size / pageSize
+	if pages < swapMinPages {
+		return fmt.Errorf("%w: %d pages", ErrSwapTooSmall, pages)
+	}
+
+	// The header consists of the version, the index of the last usable
+	// page and the number of bad pages. It is followed by a UUID, a label
+	// and padding that are left empty.
+	var header []byte
+
+	lastPage := uint32(pages - 1) //nolint:gosec
+
+	header = binary.NativeEndian.AppendUint32(header, 1)
+	header = binary.NativeEndian.AppendUint32(header, lastPage)
+	header = binary.NativeEndian.AppendUint32(header, 0)
+
+	_, err := dst.WriteAt(header, swapBootBitsSize)
+	if err != nil {
+		return fmt.Errorf("write swap header: %w", err)
+	}
+
+	offset := int64(pageSize) - int64(len(swapSignature)) //nolint:gosec
+
+	_, err = dst.WriteAt([]byte(swapSignature), offset)
+	if err != nil {
+		return fmt.Errorf("write swap signature: %w", err)
+	}
+
+	return nil
+}
+
+// zeroReader is an endless source of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSwapHeader(t *testing.T) {
+	const pageSize = 4096
+
+	tests := []struct {
+		name             string
+		size             uint64
+		expectedLastPage uint32
+		expectedErr      error
+	}{
+		{
+			name:             "minimum",
+			size:             10 * pageSize,
+			expectedLastPage: 9,
+		},
+		{
+			name:             "partial page",
+			size:             64*pageSize + 100,
+			expectedLastPage: 63,
+		},
+		{
+			name:        "too small",
+			size:        9 * pageSize,
+			expectedErr: ErrSwapTooSmall,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "swap")
+
+			file, err := os.Create(path)
+			require.NoError(t, err)
+
+			err = writeSwapHeader(file, tt.size, pageSize)
+			require.NoError(t, file.Close())
+			require.ErrorIs(t, err, tt.expectedErr)
+
+			if tt.expectedErr != nil {
+				return
+			}
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Len(t, data, pageSize)
+
+			header := data[swapBootBitsSize:]
+			assert.Equal(t, uint32(1), binary.NativeEndian.Uint32(header))
+			assert.Equal(t, tt.expectedLastPage,
+				binary.NativeEndian.Uint32(header[4:]))
+			assert.Equal(t, swapSignature,
+				string(data[pageSize-len(swapSignature):]))
+		})
+	}
+}
@@ -8,12 +8,27 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"syscall"
+	"time"
+	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
 
+// MountFlags are mount flags as defined by mount(2).
 type MountFlags int
 
+// Common [MountFlags].
+const (
+	MountFlagReadOnly MountFlags = unix.MS_RDONLY
+	MountFlagNoSuid   MountFlags = unix.MS_NOSUID
+	MountFlagNoDev    MountFlags = unix.MS_NODEV
+	MountFlagNoExec   MountFlags = unix.MS_NOEXEC
+	MountFlagNoAtime  MountFlags = unix.MS_NOATIME
+	MountFlagRelAtime MountFlags = unix.MS_RELATIME
+	MountFlagSync     MountFlags = unix.MS_SYNCHRONOUS
+)
+
 func mount(path, source, fsType string, flags MountFlags, data string) error {
 	if source == "" {
 		source = fsType
@@ -26,6 +41,36 @@ func mount(path, source, fsType string, flags MountFlags, data string) error {
 	return nil
 }
 
+func bindReadOnly(path string) error {
+	if err := unix.Mount(path, path, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind mount %s: %w", path, err)
+	}
+
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	if err := unix.Mount("", path, "", flags, ""); err != nil {
+		return fmt.Errorf("remount read-only %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func bindMount(source, target string) error {
+	flags := uintptr(unix.MS_BIND | unix.MS_REC)
+	if err := unix.Mount(source, target, "", flags, ""); err != nil {
+		return fmt.Errorf("bind mount %s: %w", target, err)
+	}
+
+	return nil
+}
+
+func unmount(path string) error {
+	if err := unix.Unmount(path, 0); err != nil {
+		return fmt.Errorf("unmount %s: %w", path, err)
+	}
+
+	return nil
+}
+
 func initModule(data []byte, params string) error {
 	if err := unix.InitModule(data, params); err != nil {
 		return fmt.Errorf("init_module: %w", err)
@@ -79,6 +124,110 @@ func setInterfaceUp(name string) error {
 	return nil
 }
 
+// openPTY opens a new pseudo-terminal pair and returns its master and slave
+// end.
+//
+// It requires the devpts file system to be mounted at "/dev/pts".
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open ptmx: %w", err)
+	}
+
+	fd := int(master.Fd())
+
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("unlock pty: %w", err)
+	}
+
+	num, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("get pty number: %w", err)
+	}
+
+	slaveName := fmt.Sprintf("/dev/pts/%d", num)
+
+	slave, err := os.OpenFile(slaveName, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("open pty slave: %w", err)
+	}
+
+	return master, slave, nil
+}
+
+// setControllingTerminal sets the [syscall.SysProcAttr] for a child process
+// that runs in a new session with its stdin as controlling terminal.
+func setControllingTerminal(attr *syscall.SysProcAttr) {
+	attr.Setsid = true
+	attr.Setctty = true
+	attr.Ctty = 0
+}
+
+// setUserNamespace sets the [syscall.SysProcAttr] for a child process that
+// runs in a new user namespace with the given ID mappings.
+func setUserNamespace(attr *syscall.SysProcAttr, ns UserNamespace) {
+	sysProcIDMaps := func(mappings []IDMapping) []syscall.SysProcIDMap {
+		idMaps := make([]syscall.SysProcIDMap, 0, len(mappings))
+
+		for _, mapping := range mappings {
+			idMaps = append(idMaps, syscall.SysProcIDMap{
+				ContainerID: mapping.ContainerID,
+				HostID:      mapping.HostID,
+				Size:        mapping.Size,
+			})
+		}
+
+		return idMaps
+	}
+
+	attr.Cloneflags |= unix.CLONE_NEWUSER
+	attr.UidMappings = sysProcIDMaps(ns.UIDMappings)
+	attr.GidMappings = sysProcIDMaps(ns.GIDMappings)
+	// The mappings are written by the privileged parent, so setgroups(2)
+	// does not need to be denied.
+	attr.GidMappingsEnableSetgroups = true
+}
+
+func readRTC(path string) (time.Time, error) {
+	rtc, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("open rtc: %w", err)
+	}
+	defer rtc.Close()
+
+	rtcTime, err := unix.IoctlGetRTCTime(int(rtc.Fd()))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read rtc: %w", err)
+	}
+
+	// Year is counted from 1900 and months are counted from 0.
+	t := time.Date(
+		int(rtcTime.Year)+1900,
+		time.Month(rtcTime.Mon+1),
+		int(rtcTime.Mday),
+		int(rtcTime.Hour),
+		int(rtcTime.Min),
+		int(rtcTime.Sec),
+		0,
+		time.UTC,
+	)
+
+	return t, nil
+}
+
+func setSystemClock(t time.Time) error {
+	ts := unix.NsecToTimespec(t.UnixNano())
+
+	if err := unix.ClockSettime(unix.CLOCK_REALTIME, &ts); err != nil {
+		return fmt.Errorf("clock_settime: %w", err)
+	}
+
+	return nil
+}
+
 func sysctl(key, value string) error {
 	const mode = 0o600
 
@@ -110,3 +259,85 @@ func setenv(key, value string) error {
 
 	return nil
 }
+
+func unsetenv(key string) error {
+	if err := unix.Unsetenv(key); err != nil {
+		return fmt.Errorf("unsetenv %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func swapon(path string) error {
+	pathPtr, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return fmt.Errorf("swapon %s: %w", path, err)
+	}
+
+	_, _, errno := unix.Syscall(
+		unix.SYS_SWAPON,
+		uintptr(unsafe.Pointer(pathPtr)),
+		0,
+		0,
+	)
+	if errno != 0 {
+		return fmt.Errorf("swapon %s: %w", path, errno)
+	}
+
+	return nil
+}
+
+// setRawTerminal disables all input and output processing of the terminal
+// line discipline like cfmakeraw(3) does. Files that are not a terminal are
+// ignored.
+func setRawTerminal(file *os.File) error {
+	fd := int(file.Fd())
+
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if errors.Is(err, unix.ENOTTY) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("get termios: %w", err)
+	}
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP |
+		unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG |
+		unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		return fmt.Errorf("set termios: %w", err)
+	}
+
+	return nil
+}
+
+// readKernelLog reads all messages of the kernel log buffer.
+func readKernelLog() ([]byte, error) {
+	size, err := unix.Klogctl(unix.SYSLOG_ACTION_SIZE_BUFFER, nil)
+	if err != nil {
+		return nil, fmt.Errorf("syslog size: %w", err)
+	}
+
+	buf := make([]byte, size)
+
+	n, err := unix.Klogctl(unix.SYSLOG_ACTION_READ_ALL, buf)
+	if err != nil {
+		return nil, fmt.Errorf("syslog read: %w", err)
+	}
+
+	return buf[:n], nil
+}
+
+// signalAll sends the given signal to all processes, except the calling
+// process and the init.
+func signalAll(sig syscall.Signal) error {
+	if err := unix.Kill(-1, sig); err != nil {
+		return fmt.Errorf("kill %s: %w", sig, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"strings"
+)
+
+// Common kernel parameters for controlling out of memory behavior.
+const (
+	// SysctlOvercommitMemory sets the memory overcommit mode: 0 for
+	// heuristic overcommit, 1 for always overcommit, 2 for no overcommit.
+	SysctlOvercommitMemory = "vm.overcommit_memory"
+
+	// SysctlPanicOnOOM determines if the kernel panics on out of memory
+	// instead of running the OOM killer.
+	SysctlPanicOnOOM = "vm.panic_on_oom"
+)
+
+// Common kernel parameters for controlling kernel console messages.
+const (
+	// SysctlPrintkRatelimit sets the minimum number of seconds between rate
+	// limited kernel messages. 0 disables rate limiting.
+	SysctlPrintkRatelimit = "kernel.printk_ratelimit"
+
+	// SysctlPrintkRatelimitBurst sets the number of rate limited kernel
+	// messages printed before rate limiting kicks in.
+	SysctlPrintkRatelimitBurst = "kernel.printk_ratelimit_burst"
+)
+
+// Sysctls is a collection of kernel parameter values by name. Names are in the
+// format used by sysctl(8), like "vm.overcommit_memory".
+type Sysctls map[string]string
+
+// AddList adds the parameters from the given list in the form
+// "KEY=VALUE;KEY=VALUE".
+func (s Sysctls) AddList(list string) {
+	for _, entry := range strings.Split(list, ";") {
+		key, value, found := strings.Cut(entry, "=")
+		if !found || key == "" {
+			continue
+		}
+
+		s[key] = value
+	}
+}
+
+// SetSysctls sets the given kernel parameters in lexicographic order of their
+// names.
+//
+// This requires the proc file system to be mounted at "/proc".
+func SetSysctls(sysctls Sysctls) error {
+	for key, value := range sortedByKeys(sysctls) {
+		if err := sysctl(strings.ReplaceAll(key, ".", "/"), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit_test
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSysctls_AddList(t *testing.T) {
+	sysctls := sysinit.Sysctls{
+		sysinit.SysctlPanicOnOOM: "0",
+	}
+
+	sysctls.AddList("vm.overcommit_memory=2;;invalid;vm.panic_on_oom=1")
+
+	expected := sysinit.Sysctls{
+		sysinit.SysctlOvercommitMemory: "2",
+		sysinit.SysctlPanicOnOOM:       "1",
+	}
+
+	assert.Equal(t, expected, sysctls)
+}
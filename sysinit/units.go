@@ -0,0 +1,374 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const (
+	// unitReadyTimeout is the time a service has to create its ready path.
+	unitReadyTimeout = 10 * time.Second
+
+	// unitReadyInterval is the interval the ready path of a service is
+	// checked in.
+	unitReadyInterval = 10 * time.Millisecond
+
+	// unitStopTimeout is the time a service has to exit once it is asked to
+	// terminate, before it is killed.
+	unitStopTimeout = 5 * time.Second
+)
+
+var (
+	// ErrInvalidUnit is returned if a [Unit] is malformed or references an
+	// unknown unit.
+	ErrInvalidUnit = errors.New("invalid unit")
+
+	// ErrUnitCycle is returned if [Unit]s depend on each other in a cycle.
+	ErrUnitCycle = errors.New("units form a cycle")
+
+	// ErrUnitNotReady is returned if a service [Unit] does not create its
+	// ready path in time.
+	ErrUnitNotReady = errors.New("unit not ready")
+)
+
+// UnitType is the kind of a [Unit].
+type UnitType string
+
+const (
+	// UnitTypeMount mounts a file system.
+	UnitTypeMount UnitType = "mount"
+
+	// UnitTypeTask runs a command to completion.
+	UnitTypeTask UnitType = "task"
+
+	// UnitTypeService starts a command in the background. It runs until the
+	// units ordered after the main binary are done.
+	UnitTypeService UnitType = "service"
+
+	// UnitTypeMain stands for the main binary. It orders the main binary
+	// relative to the other units. Units ordered after it run once the main
+	// binary returned.
+	UnitTypeMain UnitType = "main"
+)
+
+// Unit is a step of the boot of an [InitConfig], like a mount or a service,
+// for testing software that expects a system with multiple services. Units
+// are run in the order given by After and in the order they are declared
+// otherwise.
+type Unit struct {
+	// Name identifies the unit for After.
+	Name string `json:"name"`
+
+	// Type is the kind of the unit.
+	Type UnitType `json:"type"`
+
+	// After are the names of the units that must be done, or started for
+	// services, before this one is run.
+	After []string `json:"after"`
+
+	// Command is the command of task and service units. It is split into
+	// words like the Steps of an [InitConfig].
+	Command string `json:"command"`
+
+	// Ready is a path a service creates once it is ready, like a socket.
+	// Units after the service are run only once it exists. If empty, the
+	// service is considered ready once it is started.
+	Ready string `json:"ready"`
+
+	// Target is the mount point of mount units.
+	Target string `json:"target"`
+
+	// FSType is the file system type of mount units.
+	FSType FSType `json:"fsType"`
+
+	// Source is the source of mount units. It defaults to the FSType.
+	Source string `json:"source"`
+
+	// Options are the mount options of mount units in the format described
+	// by [ParseMountOptions].
+	Options string `json:"options"`
+}
+
+// validate returns an error if the fields required by the unit's type are
+// missing.
+func (u Unit) validate() error {
+	var missing string
+
+	switch u.Type {
+	case UnitTypeMount:
+		switch {
+		case u.Target == "":
+			missing = "target"
+		case u.FSType == "":
+			missing = "fsType"
+		}
+	case UnitTypeTask, UnitTypeService:
+		if len(splitStep(u.Command)) == 0 {
+			missing = "command"
+		}
+	case UnitTypeMain:
+	default:
+		return fmt.Errorf("%w: %s: unknown type %q", ErrInvalidUnit, u.Name,
+			u.Type)
+	}
+
+	if missing != "" {
+		return fmt.Errorf("%w: %s: no %s", ErrInvalidUnit, u.Name, missing)
+	}
+
+	return nil
+}
+
+// orderUnits sorts the given units by their dependencies. Units are kept in
+// the given order unless a dependency requires otherwise. The units are split
+// into the ones to run before the main binary and the ones depending on the
+// [UnitTypeMain] unit, which is not returned itself.
+func orderUnits(units []Unit) ([]Unit, []Unit, error) {
+	indexes := make(map[string]int, len(units))
+	mainName := ""
+
+	for idx, unit := range units {
+		if unit.Name == "" {
+			return nil, nil, fmt.Errorf("%w: unit %d: no name",
+				ErrInvalidUnit, idx)
+		}
+
+		if _, exists := indexes[unit.Name]; exists {
+			return nil, nil, fmt.Errorf("%w: %s: duplicate name",
+				ErrInvalidUnit, unit.Name)
+		}
+
+		err := unit.validate()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if unit.Type == UnitTypeMain {
+			if mainName != "" {
+				return nil, nil, fmt.Errorf("%w: %s: more than one main unit",
+					ErrInvalidUnit, unit.Name)
+			}
+
+			mainName = unit.Name
+		}
+
+		indexes[unit.Name] = idx
+	}
+
+	for _, unit := range units {
+		for _, name := range unit.After {
+			if _, exists := indexes[name]; !exists {
+				return nil, nil, fmt.Errorf("%w: %s: unknown unit %q",
+					ErrInvalidUnit, unit.Name, name)
+			}
+		}
+	}
+
+	var (
+		before, after []Unit
+		afterMain     = make(map[string]bool)
+		done          = make([]bool, len(units))
+	)
+
+	// Each round runs the first unit whose dependencies are done. Unit lists
+	// are short, so the quadratic runtime does not matter.
+	for range units {
+		idx := slices.IndexFunc(units, func(unit Unit) bool {
+			return !done[indexes[unit.Name]] && !slices.ContainsFunc(
+				unit.After,
+				func(name string) bool { return !done[indexes[name]] },
+			)
+		})
+		if idx < 0 {
+			return nil, nil, ErrUnitCycle
+		}
+
+		unit := units[idx]
+		done[idx] = true
+
+		isAfterMain := slices.ContainsFunc(unit.After, func(name string) bool {
+			return name == mainName || afterMain[name]
+		})
+
+		switch {
+		case unit.Type == UnitTypeMain:
+		case isAfterMain:
+			afterMain[unit.Name] = true
+			after = append(after, unit)
+		default:
+			before = append(before, unit)
+		}
+	}
+
+	return before, after, nil
+}
+
+// ValidateUnits returns an error if any of the Units of the config is
+// malformed or if their dependencies can not be satisfied.
+func (c InitConfig) ValidateUnits() error {
+	_, _, err := orderUnits(c.Units)
+	return err
+}
+
+// Units are the running [Unit]s of an [InitConfig]. See
+// [InitConfig.StartUnits].
+type Units struct {
+	after    []Unit
+	services []*exec.Cmd
+}
+
+// StartUnits runs the Units of the config that are not ordered after the
+// [UnitTypeMain] unit. Services keep running until [Units.Finish] is called.
+// If any unit fails, the services started already are stopped.
+func (c InitConfig) StartUnits() (*Units, error) {
+	before, after, err := orderUnits(c.Units)
+	if err != nil {
+		return nil, err
+	}
+
+	units := &Units{after: after}
+
+	for _, unit := range before {
+		err := units.run(unit)
+		if err != nil {
+			return nil, errors.Join(err, units.stopServices())
+		}
+	}
+
+	return units, nil
+}
+
+// Finish runs the units ordered after the [UnitTypeMain] unit and stops all
+// services in reverse order. Units are run even if others failed.
+func (u *Units) Finish() error {
+	var errs []error
+
+	for _, unit := range u.after {
+		errs = append(errs, u.run(unit))
+	}
+
+	errs = append(errs, u.stopServices())
+
+	return errors.Join(errs...)
+}
+
+// run runs the given unit. Services are started and waited for until they
+// are ready.
+func (u *Units) run(unit Unit) error {
+	var err error
+
+	switch unit.Type {
+	case UnitTypeMount:
+		opts := MountOptions{
+			FSType: unit.FSType,
+			Source: unit.Source,
+		}
+
+		err = Mount(unit.Target, opts.WithOptions(unit.Options))
+	case UnitTypeTask:
+		err = unitCommand(unit).Run()
+	case UnitTypeService:
+		err = u.startService(unit)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unit %s: %w", unit.Name, err)
+	}
+
+	return nil
+}
+
+// startService starts the command of the given service unit and waits until
+// its ready path exists.
+func (u *Units) startService(unit Unit) error {
+	cmd := unitCommand(unit)
+
+	err := cmd.Start()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	u.services = append(u.services, cmd)
+
+	if unit.Ready == "" {
+		return nil
+	}
+
+	deadline := time.Now().Add(unitReadyTimeout)
+
+	for {
+		_, err := os.Stat(unit.Ready)
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s: %w", ErrUnitNotReady, unit.Ready, err)
+		}
+
+		time.Sleep(unitReadyInterval)
+	}
+}
+
+// stopServices terminates the started services in reverse order. Services
+// that do not exit in time are killed.
+func (u *Units) stopServices() error {
+	var errs []error
+
+	for _, cmd := range slices.Backward(u.services) {
+		errs = append(errs, stopService(cmd))
+	}
+
+	u.services = nil
+
+	return errors.Join(errs...)
+}
+
+// stopService terminates the given started command. Its exit status is not
+// relevant, as it is expected to exit by the signal.
+func stopService(cmd *exec.Cmd) error {
+	waitErr := make(chan error, 1)
+
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+
+	_ = cmd.Process.Signal(syscall.SIGTERM)
+
+	var err error
+
+	select {
+	case err = <-waitErr:
+	case <-time.After(unitStopTimeout):
+		_ = cmd.Process.Kill()
+		err = <-waitErr
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// unitCommand returns the command of the given task or service unit with the
+// init's stdout and stderr.
+func unitCommand(unit Unit) *exec.Cmd {
+	words := splitStep(unit.Command)
+
+	cmd := exec.Command(words[0], words[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd
+}
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderUnits(t *testing.T) {
+	task := func(name string, after ...string) Unit {
+		return Unit{Name: name, Type: UnitTypeTask, Command: "true", After: after}
+	}
+
+	names := func(units []Unit) []string {
+		var names []string
+		for _, unit := range units {
+			names = append(names, unit.Name)
+		}
+
+		return names
+	}
+
+	tests := []struct {
+		name           string
+		units          []Unit
+		expectedBefore []string
+		expectedAfter  []string
+		expectedErr    error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:           "declaration order",
+			units:          []Unit{task("a"), task("b"), task("c")},
+			expectedBefore: []string{"a", "b", "c"},
+		},
+		{
+			name:           "dependencies",
+			units:          []Unit{task("a", "c"), task("b"), task("c", "b")},
+			expectedBefore: []string{"b", "c", "a"},
+		},
+		{
+			name: "after main",
+			units: []Unit{
+				task("dump", "main"),
+				{Name: "main", Type: UnitTypeMain, After: []string{"db"}},
+				{Name: "db", Type: UnitTypeService, Command: "db"},
+				task("cleanup", "dump"),
+				task("setup"),
+			},
+			expectedBefore: []string{"db", "setup"},
+			expectedAfter:  []string{"dump", "cleanup"},
+		},
+		{
+			name:        "cycle",
+			units:       []Unit{task("a", "b"), task("b", "a")},
+			expectedErr: ErrUnitCycle,
+		},
+		{
+			name:        "unknown dependency",
+			units:       []Unit{task("a", "b")},
+			expectedErr: ErrInvalidUnit,
+		},
+		{
+			name:        "duplicate name",
+			units:       []Unit{task("a"), task("a")},
+			expectedErr: ErrInvalidUnit,
+		},
+		{
+			name:        "no name",
+			units:       []Unit{task("")},
+			expectedErr: ErrInvalidUnit,
+		},
+		{
+			name: "more than one main",
+			units: []Unit{
+				{Name: "a", Type: UnitTypeMain},
+				{Name: "b", Type: UnitTypeMain},
+			},
+			expectedErr: ErrInvalidUnit,
+		},
+		{
+			name:        "unknown type",
+			units:       []Unit{{Name: "a", Type: "timer"}},
+			expectedErr: ErrInvalidUnit,
+		},
+		{
+			name:        "mount without target",
+			units:       []Unit{{Name: "a", Type: UnitTypeMount, FSType: "tmpfs"}},
+			expectedErr: ErrInvalidUnit,
+		},
+		{
+			name:        "service without command",
+			units:       []Unit{{Name: "a", Type: UnitTypeService}},
+			expectedErr: ErrInvalidUnit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after, err := orderUnits(tt.units)
+			require.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedBefore, names(before), "before")
+			assert.Equal(t, tt.expectedAfter, names(after), "after")
+		})
+	}
+}
+
+func TestInitConfig_StartUnits(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	done := filepath.Join(dir, "done")
+
+	cfg := InitConfig{
+		Units: []Unit{
+			{
+				Name:    "service",
+				Type:    UnitTypeService,
+				Command: `sh -c "sleep 0.1; touch ` + ready + `; exec sleep 60"`,
+				Ready:   ready,
+			},
+			{
+				Name: "main",
+				Type: UnitTypeMain,
+			},
+			{
+				Name:    "after",
+				Type:    UnitTypeTask,
+				Command: "touch " + done,
+				After:   []string{"main", "service"},
+			},
+		},
+	}
+
+	units, err := cfg.StartUnits()
+	require.NoError(t, err)
+	assert.FileExists(t, ready)
+	assert.NoFileExists(t, done)
+	require.Len(t, units.services, 1)
+
+	require.NoError(t, units.Finish())
+	assert.FileExists(t, done)
+	assert.Empty(t, units.services)
+}
+
+func TestInitConfig_StartUnits_Fails(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "stopped")
+	ready := filepath.Join(dir, "ready")
+	// The service is ready once the trap is set, so it is not terminated
+	// before.
+	script := "trap 'touch " + marker + "; kill $!; exit' TERM; " +
+		"touch " + ready + "; sleep 60 & wait"
+
+	cfg := InitConfig{
+		Units: []Unit{
+			{
+				Name:    "service",
+				Type:    UnitTypeService,
+				Command: `sh -c "` + script + `"`,
+				Ready:   ready,
+			},
+			{
+				Name:    "task",
+				Type:    UnitTypeTask,
+				Command: "false",
+				After:   []string{"service"},
+			},
+		},
+	}
+
+	_, err := cfg.StartUnits()
+	require.ErrorContains(t, err, "unit task")
+
+	_, err = os.Stat(marker)
+	assert.NoError(t, err, "service stopped")
+}
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidIDMapping is returned if an [IDMapping] can not be parsed.
+var ErrInvalidIDMapping = errors.New("invalid id mapping")
+
+// IDMapping maps a range of user or group IDs in a user namespace to IDs
+// outside of it, as written to /proc/PID/uid_map and /proc/PID/gid_map.
+type IDMapping struct {
+	// ContainerID is the first ID of the range inside the namespace.
+	ContainerID int
+
+	// HostID is the first ID of the range outside of the namespace.
+	HostID int
+
+	// Size is the number of IDs in the range.
+	Size int
+}
+
+// DefaultIDMapping maps root and the following IDs inside the user namespace
+// to unprivileged IDs outside of it, like rootless container runtimes do.
+var DefaultIDMapping = IDMapping{ContainerID: 0, HostID: 100000, Size: 65536}
+
+// UserNamespace defines the user namespace a binary is run in by [Exec].
+//
+// The ID mappings are written by the calling process, so it must be
+// privileged in its own user namespace, as the init is.
+type UserNamespace struct {
+	// UIDMappings are the user ID mappings of the namespace.
+	UIDMappings []IDMapping
+
+	// GIDMappings are the group ID mappings of the namespace.
+	GIDMappings []IDMapping
+}
+
+// ParseIDMappings parses a list of [IDMapping]s in the form
+// "CONTAINERID:HOSTID:SIZE;CONTAINERID:HOSTID:SIZE".
+func ParseIDMappings(list string) ([]IDMapping, error) {
+	var mappings []IDMapping
+
+	for _, entry := range strings.Split(list, ";") {
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.Split(entry, ":")
+		if len(fields) != 3 { //nolint:mnd
+			return nil, fmt.Errorf("%w: %s", ErrInvalidIDMapping, entry)
+		}
+
+		ids := make([]int, len(fields))
+
+		for idx, field := range fields {
+			id, err := strconv.Atoi(field)
+			if err != nil || id < 0 {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidIDMapping, entry)
+			}
+
+			ids[idx] = id
+		}
+
+		mappings = append(mappings, IDMapping{
+			ContainerID: ids[0],
+			HostID:      ids[1],
+			Size:        ids[2],
+		})
+	}
+
+	return mappings, nil
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package sysinit_test
+
+import (
+	"testing"
+
+	"github.com/aibor/virtrun/sysinit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIDMappings(t *testing.T) {
+	tests := []struct {
+		name        string
+		list        string
+		expected    []sysinit.IDMapping
+		expectedErr error
+	}{
+		{
+			name: "empty",
+			list: "",
+		},
+		{
+			name: "single",
+			list: "0:100000:65536",
+			expected: []sysinit.IDMapping{
+				sysinit.DefaultIDMapping,
+			},
+		},
+		{
+			name: "multiple",
+			list: "0:0:1;1:100000:1000",
+			expected: []sysinit.IDMapping{
+				{ContainerID: 0, HostID: 0, Size: 1},
+				{ContainerID: 1, HostID: 100000, Size: 1000},
+			},
+		},
+		{
+			name:        "missing field",
+			list:        "0:100000",
+			expectedErr: sysinit.ErrInvalidIDMapping,
+		},
+		{
+			name:        "negative",
+			list:        "0:-1:1",
+			expectedErr: sysinit.ErrInvalidIDMapping,
+		},
+		{
+			name:        "not a number",
+			list:        "0:x:1",
+			expectedErr: sysinit.ErrInvalidIDMapping,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := sysinit.ParseIDMappings(tt.list)
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
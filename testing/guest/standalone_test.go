@@ -13,9 +13,7 @@ import (
 )
 
 func TestMain(m *testing.M) {
-	cfg := sysinit.DefaultConfig()
-	cfg.ModulesDir = "/lib/modules"
-	cfg.Env["PATH"] = "/data"
-
-	sysinit.RunTests(m, cfg)
+	sysinit.DefaultRun(func() (int, error) {
+		return m.Run(), nil
+	})
 }
@@ -14,6 +14,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -149,6 +150,11 @@ func TestCPUs(t *testing.T) {
 	expected := 1
 	if *testCPUs > 0 {
 		expected = *testCPUs
+	} else if smp := os.Getenv("VIRTRUN_SMP"); smp != "" {
+		var err error
+
+		expected, err = strconv.Atoi(smp)
+		require.NoError(t, err)
 	}
 
 	assert.Equal(t, expected, runtime.NumCPU())
@@ -22,6 +22,7 @@ import (
 	"github.com/aibor/virtrun/internal/cmd"
 	"github.com/aibor/virtrun/internal/qemu"
 	"github.com/aibor/virtrun/internal/virtrun"
+	"github.com/aibor/virtrun/sysinit"
 	"github.com/stretchr/testify/require"
 )
 
@@ -169,7 +170,7 @@ func TestIntegration(t *testing.T) {
 
 			var stdOut, stdErr bytes.Buffer
 
-			err = virtrun.Run(ctx, spec, nil, &stdOut, &stdErr)
+			_, err = virtrun.Run(ctx, spec, nil, &stdOut, &stdErr)
 
 			t.Log(stdOut.String())
 			t.Log(stdErr.String())
@@ -178,3 +179,110 @@ func TestIntegration(t *testing.T) {
 		})
 	}
 }
+
+// TestJob runs a binary as job of a guest that is set up already, like the
+// guests of "virtrun serve" do.
+func TestJob(t *testing.T) {
+	t.Parallel()
+
+	binary, err := cmd.AbsoluteFilePath("bin/return")
+	require.NoError(t, err)
+
+	spec := &virtrun.Spec{
+		Qemu: virtrun.Qemu{
+			Kernel:  KernelPath,
+			Verbose: Verbose,
+			CPU:     "max",
+			Memory:  128,
+			SMP:     1,
+			NextJob: func() (virtrun.Job, error) {
+				return virtrun.Job{Binary: binary, Args: []string{"42"}}, nil
+			},
+		},
+		Initramfs: virtrun.Initramfs{
+			Binary: binary,
+		},
+	}
+
+	if ForceTransportTypePCI {
+		spec.Qemu.TransportType = qemu.TransportTypePCI
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+
+	var stdOut, stdErr bytes.Buffer
+
+	_, err = virtrun.Run(ctx, spec, nil, &stdOut, &stdErr)
+
+	t.Log(stdOut.String())
+	t.Log(stdErr.String())
+
+	var qemuErr *qemu.CommandError
+
+	require.ErrorAs(t, err, &qemuErr)
+	require.Equal(t, 42, qemuErr.ExitCode)
+}
+
+// BenchmarkBoot measures the time it takes to build the initramfs, to boot the
+// guest until the init runs and the round trips on the control console. Run
+// it with different flags and kernels to compare the results with benchstat.
+func BenchmarkBoot(b *testing.B) {
+	binary, err := cmd.AbsoluteFilePath("bin/return")
+	require.NoError(b, err)
+
+	var initramfs, boot, echo time.Duration
+
+	for range b.N {
+		spec := &virtrun.Spec{
+			Qemu: virtrun.Qemu{
+				Kernel:    KernelPath,
+				CPU:       "max",
+				Memory:    128,
+				SMP:       1,
+				InitArgs:  []string{"0"},
+				EchoCount: 10,
+			},
+			Initramfs: virtrun.Initramfs{
+				Binary: binary,
+			},
+		}
+
+		if ForceTransportTypePCI {
+			spec.Qemu.TransportType = qemu.TransportTypePCI
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+		var stdOut, stdErr bytes.Buffer
+
+		result, err := virtrun.Run(ctx, spec, nil, &stdOut, &stdErr)
+
+		cancel()
+
+		if err != nil {
+			b.Log(stdOut.String())
+			b.Log(stdErr.String())
+		}
+
+		require.NoError(b, err)
+
+		initramfs += result.InitramfsDuration
+
+		for _, state := range result.States {
+			if sysinit.State(state.State) == sysinit.StateBooted {
+				boot += state.Elapsed
+			}
+		}
+
+		for _, roundTrip := range result.EchoRoundTrips {
+			echo += roundTrip / time.Duration(len(result.EchoRoundTrips))
+		}
+	}
+
+	runs := float64(b.N)
+
+	b.ReportMetric(float64(initramfs.Microseconds())/runs, "initramfs-µs/op")
+	b.ReportMetric(float64(boot.Microseconds())/runs, "boot-µs/op")
+	b.ReportMetric(float64(echo.Microseconds())/runs, "echo-µs/op")
+}
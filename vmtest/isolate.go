@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package vmtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aibor/virtrun/run"
+)
+
+// TestNameEnv is the name of the environment variable that has the name of
+// the test in a guest started by [Isolate].
+const TestNameEnv = "VIRTRUN_VMTEST_NAME"
+
+// Isolate runs the calling test in its own guest, for tests that change
+// global kernel state and must not share a guest with other tests. It returns
+// true if the test runs in a guest and the test function should continue.
+// On the host, it runs the test binary in a fresh guest with only the given
+// test selected and returns false once the guest is done. Output of the
+// guest is logged with the test and the test fails if it failed in the guest.
+//
+//	func TestSysctl(t *testing.T) {
+//		if !vmtest.Isolate(t) {
+//			return
+//		}
+//		// Runs in its own guest.
+//	}
+//
+// A guest is started for each call, pooled guests are not supported. In a
+// guest started by [Run] or "go test -exec virtrun", the test continues in
+// that guest, so packages should use either of them.
+func Isolate(t *testing.T, opts ...Option) bool {
+	t.Helper()
+
+	if InGuest() {
+		return true
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("vmtest: executable: %v", err)
+	}
+
+	args := []string{"-test.run=" + runPattern(t.Name())}
+	if testing.Verbose() {
+		args = append(args, "-test.v=true")
+	}
+
+	opts = append(slices.Clip(opts), WithEnv(TestNameEnv+"="+t.Name()))
+
+	spec, err := newSpec(executable, args, opts)
+	if err != nil {
+		t.Fatalf("vmtest: %v", err)
+	}
+
+	var output bytes.Buffer
+
+	result, err := run.Run(context.Background(), spec, nil, &output, &output)
+
+	if output.Len() > 0 {
+		t.Log("guest output:\n" + output.String())
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, run.ErrGuestNonZeroExitCode) && result != nil:
+		t.Errorf("vmtest: failed in guest with exit code %d", result.ExitCode)
+	default:
+		t.Errorf("vmtest: %v", err)
+	}
+
+	return false
+}
+
+// runPattern returns the pattern for flag "-test.run" that matches exactly
+// the test with the given name, including its parent tests.
+func runPattern(name string) string {
+	parts := strings.Split(name, "/")
+
+	for idx, part := range parts {
+		parts[idx] = "^" + regexp.QuoteMeta(part) + "$"
+	}
+
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package vmtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{
+			name:     "TestSysctl",
+			expected: "^TestSysctl$",
+		},
+		{
+			name:     "TestSysctl/net.ipv4.ip_forward",
+			expected: `^TestSysctl$/^net\.ipv4\.ip_forward$`,
+		},
+		{
+			name:     "TestMounts/with_(parens)",
+			expected: `^TestMounts$/^with_\(parens\)$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, runPattern(tt.name))
+		})
+	}
+}
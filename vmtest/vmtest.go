@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package vmtest runs the tests of a package in a virtrun guest, without the
+// need for "go test -exec virtrun".
+//
+// Call [Run] from the TestMain function of the package:
+//
+//	func TestMain(m *testing.M) {
+//		vmtest.Run(m, vmtest.WithMemory(512))
+//	}
+//
+// On the host, the test binary is run again in a guest with the same
+// arguments, so go test flags work as usual. In the guest, the tests are run.
+// The kernel is read from the environment variable VIRTRUN_KERNEL, unless
+// given with [WithKernel].
+package vmtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+
+	"github.com/aibor/virtrun/run"
+	"github.com/aibor/virtrun/sysinit"
+)
+
+const (
+	// KernelEnv is the name of the environment variable the path of the
+	// kernel is read from, unless given with [WithKernel].
+	KernelEnv = "VIRTRUN_KERNEL"
+
+	// guestEnv is set in the guest, so the test binary knows it runs there.
+	guestEnv = "VIRTRUN_VMTEST"
+)
+
+// ErrNoKernel is returned if no kernel is given.
+var ErrNoKernel = errors.New("no kernel given (set " + KernelEnv + ")")
+
+// Option changes the [run.Spec] the test binary is run with in the guest.
+type Option func(spec *run.Spec)
+
+// WithKernel sets the path of the kernel to boot.
+func WithKernel(path string) Option {
+	return func(spec *run.Spec) {
+		spec.Kernel = path
+	}
+}
+
+// WithMemory sets the memory of the guest in MB.
+func WithMemory(memory uint64) Option {
+	return func(spec *run.Spec) {
+		spec.Memory = memory
+	}
+}
+
+// WithSMP sets the number of CPUs of the guest.
+func WithSMP(smp uint64) Option {
+	return func(spec *run.Spec) {
+		spec.SMP = smp
+	}
+}
+
+// WithFiles adds files to the guest's /data directory.
+func WithFiles(files ...string) Option {
+	return func(spec *run.Spec) {
+		spec.Files = append(spec.Files, files...)
+	}
+}
+
+// WithFileAs adds the host file at source to the guest as target, which is
+// an absolute guest path or a file name in /data. See [run.Spec.AddFileAs].
+func WithFileAs(source, target string) Option {
+	return func(spec *run.Spec) {
+		spec.AddFileAs(source, target)
+	}
+}
+
+// WithModules adds kernel modules that are loaded before the tests run.
+func WithModules(modules ...string) Option {
+	return func(spec *run.Spec) {
+		spec.Modules = append(spec.Modules, modules...)
+	}
+}
+
+// WithContent sets a tree of files merged into the root of the guest's file
+// system, like test fixtures embedded with an [embed.FS]. See [run.Spec].
+func WithContent(fsys fs.FS) Option {
+	return func(spec *run.Spec) {
+		spec.Content = fsys
+	}
+}
+
+// WithEnv adds environment variables in the form "KEY=VALUE" for the tests.
+func WithEnv(env ...string) Option {
+	return func(spec *run.Spec) {
+		spec.Env = append(spec.Env, env...)
+	}
+}
+
+// WithSpec calls the given function with the [run.Spec], so any of its
+// fields can be changed.
+func WithSpec(fn func(spec *run.Spec)) Option {
+	return fn
+}
+
+// InGuest returns true if the process runs in a virtrun guest. This is the
+// case if it was started by [Run] or by virtrun's init, like with
+// "go test -exec virtrun". The guest is detected by the kernel command line
+// parameter [sysinit.ParamEpoch] the host passes to every guest, as the
+// parent process does not tell a guest from a host running the process under
+// an init reaper, like "docker run --init".
+func InGuest() bool {
+	if os.Getenv(guestEnv) != "" {
+		return true
+	}
+
+	params, err := sysinit.ReadCmdline()
+
+	return err == nil && params.Has(sysinit.ParamEpoch)
+}
+
+// Run runs the tests and exits with their exit code. In a guest, the tests
+// are run directly. Otherwise, the test binary is run in a new guest with the
+// same arguments and the given options applied.
+func Run(m *testing.M, opts ...Option) {
+	if InGuest() {
+		os.Exit(m.Run())
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM)
+	exitCode := runInGuest(ctx, os.Args[1:], os.Stdout, os.Stderr, opts)
+
+	cancel()
+	os.Exit(exitCode)
+}
+
+// runInGuest runs the current executable with the given arguments in a guest
+// and returns its exit code. Errors are written to stderr.
+func runInGuest(
+	ctx context.Context,
+	args []string,
+	stdout, stderr io.Writer,
+	opts []Option,
+) int {
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(stderr, "vmtest: executable: %v\n", err)
+		return 1
+	}
+
+	spec, err := newSpec(executable, args, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "vmtest: %v\n", err)
+		return 1
+	}
+
+	result, err := run.Run(ctx, spec, nil, stdout, stderr)
+
+	return exitCode(result, err, stderr)
+}
+
+// newSpec returns the [run.Spec] for running the given executable with the
+// given arguments in a guest.
+func newSpec(
+	executable string,
+	args []string,
+	opts []Option,
+) (run.Spec, error) {
+	spec := run.Spec{
+		Kernel: os.Getenv(KernelEnv),
+		Binary: executable,
+		Args:   args,
+		Env:    []string{guestEnv + "=1"},
+	}
+
+	for _, opt := range opts {
+		opt(&spec)
+	}
+
+	if spec.Kernel == "" {
+		return spec, ErrNoKernel
+	}
+
+	return spec, nil
+}
+
+// exitCode returns the exit code for the given result and error of
+// [run.Run]. Errors other than a non-zero exit code of the tests are written
+// to stderr.
+func exitCode(result *run.Result, err error, stderr io.Writer) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, run.ErrGuestNonZeroExitCode) && result != nil:
+		return result.ExitCode
+	default:
+		fmt.Fprintf(stderr, "vmtest: %v\n", err)
+		return 1
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2024 Tobias Böhm <code@aibor.de>
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package vmtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/aibor/virtrun/run"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSpec(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		kernelEnv   string
+		expected    run.Spec
+		expectedErr error
+	}{
+		{
+			name:      "kernel from env",
+			kernelEnv: "/boot/from-env",
+			expected: run.Spec{
+				Kernel: "/boot/from-env",
+				Binary: "/tmp/pkg.test",
+				Args:   []string{"-test.v=true"},
+				Env:    []string{"VIRTRUN_VMTEST=1"},
+			},
+		},
+		{
+			name: "options",
+			opts: []Option{
+				WithKernel("/boot/vmlinuz"),
+				WithMemory(512),
+				WithSMP(2),
+				WithFiles("/usr/bin/strace"),
+				WithFileAs("foo.conf", "/etc/foo.conf"),
+				WithModules("veth.ko"),
+				WithContent(fstest.MapFS{}),
+				WithEnv("FOO=bar"),
+				WithSpec(func(spec *run.Spec) {
+					spec.Verbose = true
+				}),
+			},
+			kernelEnv: "/boot/from-env",
+			expected: run.Spec{
+				Kernel:  "/boot/vmlinuz",
+				Binary:  "/tmp/pkg.test",
+				Args:    []string{"-test.v=true"},
+				Env:     []string{"VIRTRUN_VMTEST=1", "FOO=bar"},
+				Files:   []string{"/usr/bin/strace"},
+				Modules: []string{"veth.ko"},
+				Content: fstest.MapFS{},
+				Memory:  512,
+				SMP:     2,
+				Verbose: true,
+				FileTargets: []run.FileTarget{
+					{Source: "foo.conf", Target: "/etc/foo.conf"},
+				},
+			},
+		},
+		{
+			name:        "no kernel",
+			expectedErr: ErrNoKernel,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(KernelEnv, tt.kernelEnv)
+
+			spec, err := newSpec("/tmp/pkg.test",
+				[]string{"-test.v=true"}, tt.opts)
+			require.ErrorIs(t, err, tt.expectedErr)
+
+			if tt.expectedErr == nil {
+				assert.Equal(t, tt.expected, spec)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name           string
+		result         *run.Result
+		err            error
+		expected       int
+		expectedStderr string
+	}{
+		{
+			name:     "success",
+			result:   &run.Result{},
+			expected: 0,
+		},
+		{
+			name:     "failed tests",
+			result:   &run.Result{ExitCode: 3},
+			err:      fmt.Errorf("run: %w", run.ErrGuestNonZeroExitCode),
+			expected: 3,
+		},
+		{
+			name:           "guest failure",
+			result:         &run.Result{},
+			err:            run.ErrGuestPanic,
+			expected:       1,
+			expectedStderr: "vmtest: guest system panicked\n",
+		},
+		{
+			name:           "no result",
+			err:            errors.New("no qemu"),
+			expected:       1,
+			expectedStderr: "vmtest: no qemu\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+
+			assert.Equal(t, tt.expected, exitCode(tt.result, tt.err, &stderr))
+			assert.Equal(t, tt.expectedStderr, stderr.String())
+		})
+	}
+}
+
+func TestInGuest(t *testing.T) {
+	t.Run("host", func(t *testing.T) {
+		t.Setenv(guestEnv, "")
+		assert.False(t, InGuest())
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv(guestEnv, "1")
+		assert.True(t, InGuest())
+	})
+}